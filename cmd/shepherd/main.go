@@ -17,9 +17,11 @@ import (
 	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/netutil"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/node"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/pki"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/server"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/shutdown"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
 )
 
 // 版本信息（编译时注入）
@@ -43,6 +45,10 @@ type App struct {
 	node        *node.Node       // 统一节点实例
 	nodeAdapter *api.NodeAdapter // Node API 适配器
 
+	// 集群 mTLS
+	authority *pki.Authority // Master 的集群 CA
+	identity  *pki.Identity  // Client 的节点证书
+
 	// 运行模式
 	role string
 }
@@ -170,12 +176,21 @@ func (app *App) Initialize(runMode, masterAddr, configPath string) error {
 
 	// 创建模型管理器
 	app.modelMgr = model.NewManager(cfg, app.configMgr, app.procMgr)
+	app.modelMgr.StartIdleReaper()
+
+	// 加载集群 CA 和节点证书
+	if err := app.initTLS(); err != nil {
+		return fmt.Errorf("初始化 TLS 失败: %w", err)
+	}
 
 	// 根据角色初始化分布式组件
 	if err := app.initDistributedComponents(); err != nil {
 		return fmt.Errorf("初始化分布式组件失败: %w", err)
 	}
 
+	// 初始化链路追踪
+	app.initTracing()
+
 	// 创建 HTTP 服务器
 	serverCfg := &server.Config{
 		WebPort:       cfg.Server.WebPort,
@@ -192,6 +207,11 @@ func (app *App) Initialize(runMode, masterAddr, configPath string) error {
 		Version:       Version,
 		BuildTime:     BuildTime,
 		GitCommit:     GitCommit,
+		Authority:     app.authority,
+		Identity:      app.identity,
+	}
+	if app.node != nil {
+		serverCfg.Resources = app.node.GetResourceSnapshot
 	}
 
 	app.srv, err = server.NewServer(serverCfg, app.modelMgr)
@@ -264,12 +284,14 @@ func (app *App) initDistributedComponents() error {
 		if err := app.initClientNode(); err != nil {
 			return fmt.Errorf("初始化 client 节点失败: %w", err)
 		}
+		app.node.SetModelsProvider(app.loadedModels)
 
 	case "hybrid":
 		// Hybrid 模式：创建 Node + NodeAdapter
 		if err := app.initHybridNode(); err != nil {
 			return fmt.Errorf("初始化 hybrid 节点失败: %w", err)
 		}
+		app.node.SetModelsProvider(app.loadedModels)
 		if err := app.initNodeAdapter(); err != nil {
 			return fmt.Errorf("初始化 Node API 适配器失败: %w", err)
 		}
@@ -345,6 +367,35 @@ func (app *App) initHybridNode() error {
 	return nil
 }
 
+// loadedModels 返回本节点已加载的模型，随心跳上报给 Master 用于请求路由
+func (app *App) loadedModels() []node.LoadedModel {
+	statuses := app.modelMgr.ListStatus()
+
+	// 同一模型的多个副本只上报一次，由本节点在副本间分配请求
+	models := make([]node.LoadedModel, 0, len(statuses))
+	seen := make(map[string]bool, len(statuses))
+	for id, status := range statuses {
+		if status.State != model.StateLoaded {
+			continue
+		}
+		modelID := id
+		if status.ModelID != "" {
+			modelID = status.ModelID
+		}
+		if seen[modelID] {
+			continue
+		}
+		seen[modelID] = true
+
+		loaded := node.LoadedModel{ID: modelID, Name: status.Name, Port: status.Port}
+		if m, ok := app.modelMgr.GetModel(modelID); ok {
+			loaded.Alias = m.Alias
+		}
+		models = append(models, loaded)
+	}
+	return models
+}
+
 // generateNodeID 基于设备信息生成稳定的节点ID
 // 优先使用 MAC 地址，其次使用主机名，确保每次启动生成相同的 ID
 func generateNodeID() string {
@@ -405,6 +456,49 @@ func generateNodeID() string {
 	return hostname
 }
 
+// initTLS 加载集群 mTLS 所需的证书
+// Master 加载或创建集群 CA，Client 加载已保存的节点证书（首次启动时为空）
+func (app *App) initTLS() error {
+	isMaster := app.role == "master" || app.role == "hybrid"
+	isClient := app.role == "client" || app.role == "hybrid"
+
+	if ssl := app.cfg.Node.MasterRole.SSL; isMaster && ssl.Enabled {
+		validity := time.Duration(ssl.CertValidity) * 24 * time.Hour
+		authority, err := pki.LoadOrCreateAuthority(ssl.CertPath, ssl.KeyPath, validity)
+		if err != nil {
+			return fmt.Errorf("加载集群 CA 失败: %w", err)
+		}
+		app.authority = authority
+		logger.Infof("集群 mTLS 已启用，CA 指纹: %s", authority.Fingerprint())
+	}
+
+	if ssl := app.cfg.Node.ClientRole.SSL; isClient && ssl.Enabled {
+		identity, err := pki.LoadIdentity(ssl.CertDir)
+		if err != nil {
+			return fmt.Errorf("加载节点证书失败: %w", err)
+		}
+		app.identity = identity
+		if identity.Ready() {
+			logger.Infof("已加载节点证书，有效期至 %s", identity.ExpiresAt().Format(time.RFC3339))
+		} else {
+			logger.Info("尚无节点证书，将在注册时向 Master 申请")
+		}
+	}
+	return nil
+}
+
+// initTracing 按配置启用 OTLP 链路追踪，资源属性标识本节点
+func (app *App) initTracing() {
+	resource := []tracing.Attribute{
+		tracing.String("service.version", Version),
+		tracing.String("shepherd.role", app.role),
+	}
+	if app.node != nil {
+		resource = append(resource, tracing.String("service.instance.id", app.node.GetID()))
+	}
+	tracing.Init(app.cfg.Tracing, resource...)
+}
+
 // buildNodeConfig 从应用配置构建 NodeConfig
 func (app *App) buildNodeConfig() *node.NodeConfig {
 	cfg := app.cfg
@@ -451,6 +545,9 @@ func (app *App) buildNodeConfig() *node.NodeConfig {
 		Tags:              cfg.Node.Tags,
 		Metadata:          cfg.Node.Metadata,
 		Capabilities:      capabilities,
+		Identity:          app.identity,
+		JoinToken:         cfg.Node.ClientRole.SSL.JoinToken,
+		CAFingerprint:     cfg.Node.ClientRole.SSL.CAFingerprint,
 	}
 }
 
@@ -510,7 +607,14 @@ func (app *App) registerShutdownHooks() {
 		}, shutdown.PriorityNormal)
 	}
 
-	// 5. 优先级低：关闭日志系统
+	// 5. 优先级低：导出剩余的追踪数据
+	if tracing.Enabled() {
+		app.shutdownMgr.Register("tracing", func(ctx context.Context) error {
+			return tracing.Shutdown(ctx)
+		}, shutdown.PriorityLow)
+	}
+
+	// 6. 优先级低：关闭日志系统
 	app.shutdownMgr.Register("logger", func(ctx context.Context) error {
 		logger.Info("日志系统已关闭")
 		return nil
@@ -547,15 +651,23 @@ func (app *App) printStartupInfo() {
 	fmt.Printf("✓ 运行模式: %s\n", app.cfg.Mode)
 	fmt.Printf("✓ 节点角色: %s\n", app.role)
 	fmt.Printf("✓ HTTP 服务器已启动，监听 %s:%d\n", app.cfg.Server.Host, app.cfg.Server.WebPort)
-	fmt.Printf("✓ Web UI: http://localhost:%d\n", app.cfg.Server.WebPort)
-	fmt.Printf("✓ OpenAI API: http://localhost:%d/v1\n", app.cfg.Server.WebPort)
+	scheme := "http"
+	if app.cfg.Server.TLS.Enabled {
+		scheme = "https"
+	}
+	fmt.Printf("✓ Web UI: %s://localhost:%d\n", scheme, app.cfg.Server.WebPort)
+	fmt.Printf("✓ OpenAI API: %s://localhost:%d/v1\n", scheme, app.cfg.Server.WebPort)
 
 	if app.cfg.Compatibility.Ollama.Enabled {
-		fmt.Printf("✓ Ollama API: http://localhost:%d\n", app.cfg.Server.OllamaPort)
+		fmt.Printf("✓ Ollama API: %s://localhost:%d\n", scheme, app.cfg.Server.OllamaPort)
 	}
 
 	if app.role == "master" || app.role == "hybrid" {
-		fmt.Printf("✓ Master API: http://localhost:%d/api/master\n", app.cfg.Server.WebPort)
+		fmt.Printf("✓ Master API: %s://localhost:%d/api/master\n", scheme, app.cfg.Server.WebPort)
+	}
+
+	if app.authority != nil {
+		fmt.Printf("✓ 集群 CA 指纹: %s\n", app.authority.Fingerprint())
 	}
 
 	if app.role == "client" && app.node != nil {
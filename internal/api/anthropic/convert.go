@@ -0,0 +1,304 @@
+package anthropic
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/capture"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+)
+
+// MessageContent is message or system content, sent either as a plain string
+// or as an array of content blocks. A string is decoded as one text block.
+type MessageContent []ContentBlock
+
+// UnmarshalJSON accepts both the string and the content block array form
+func (m *MessageContent) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		*m = MessageContent{{Type: "text", Text: text}}
+		return nil
+	}
+
+	var blocks []ContentBlock
+	if err := json.Unmarshal(data, &blocks); err != nil {
+		return err
+	}
+	*m = blocks
+	return nil
+}
+
+// Text joins the text blocks of the content
+func (m MessageContent) Text() string {
+	var parts []string
+	for _, block := range m {
+		if block.Type == "text" {
+			parts = append(parts, block.Text)
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// hasImages reports whether any message contains an image block
+func hasImages(req MessageRequest) bool {
+	for _, msg := range req.Messages {
+		for _, block := range msg.Content {
+			if block.Type == "image" {
+				return true
+			}
+			for _, inner := range block.Content {
+				if inner.Type == "image" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// convertMessages converts the system prompt and messages to OpenAI chat messages.
+// tool_result blocks become "tool" messages, tool_use blocks become assistant
+// tool_calls and image blocks become image_url parts.
+func convertMessages(req MessageRequest) []map[string]interface{} {
+	messages := make([]map[string]interface{}, 0, len(req.Messages)+1)
+
+	if system := req.System.Text(); system != "" {
+		messages = append(messages, map[string]interface{}{
+			"role":    "system",
+			"content": system,
+		})
+	}
+
+	for _, msg := range req.Messages {
+		if msg.Role == "assistant" {
+			messages = append(messages, convertAssistantMessage(msg))
+			continue
+		}
+
+		// tool_result 必须紧跟在对应的 tool_calls 之后，先于同一消息中的其他内容
+		var parts []ContentBlock
+		for _, block := range msg.Content {
+			if block.Type != "tool_result" {
+				parts = append(parts, block)
+				continue
+			}
+			messages = append(messages, map[string]interface{}{
+				"role":         "tool",
+				"tool_call_id": block.ToolUseID,
+				"content":      toolResultText(block),
+			})
+			// tool_result 中的图像作为随后的用户内容发送
+			for _, inner := range block.Content {
+				if inner.Type == "image" {
+					parts = append(parts, inner)
+				}
+			}
+		}
+		if len(parts) > 0 || len(msg.Content) == 0 {
+			messages = append(messages, map[string]interface{}{
+				"role":    msg.Role,
+				"content": convertParts(parts),
+			})
+		}
+	}
+
+	return messages
+}
+
+// convertAssistantMessage converts an assistant message, mapping tool_use
+// blocks to tool_calls. Thinking blocks are not sent back to the model.
+func convertAssistantMessage(msg Message) map[string]interface{} {
+	var text []string
+	var toolCalls []map[string]interface{}
+	for _, block := range msg.Content {
+		switch block.Type {
+		case "text":
+			text = append(text, block.Text)
+		case "tool_use":
+			arguments := "{}"
+			if len(block.Input) > 0 {
+				arguments = string(block.Input)
+			}
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"id":   block.ID,
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":      block.Name,
+					"arguments": arguments,
+				},
+			})
+		}
+	}
+
+	converted := map[string]interface{}{
+		"role":    "assistant",
+		"content": strings.Join(text, "\n"),
+	}
+	if len(toolCalls) > 0 {
+		converted["tool_calls"] = toolCalls
+	}
+	return converted
+}
+
+// convertParts converts user content blocks to an OpenAI content value: a
+// plain string for text only, otherwise an array of text and image_url parts
+func convertParts(blocks []ContentBlock) interface{} {
+	hasImage := false
+	for _, block := range blocks {
+		if block.Type == "image" {
+			hasImage = true
+			break
+		}
+	}
+	if !hasImage {
+		return MessageContent(blocks).Text()
+	}
+
+	parts := make([]map[string]interface{}, 0, len(blocks))
+	for _, block := range blocks {
+		switch block.Type {
+		case "text":
+			parts = append(parts, map[string]interface{}{
+				"type": "text",
+				"text": block.Text,
+			})
+		case "image":
+			if block.Source == nil {
+				continue
+			}
+			url := block.Source.URL
+			if block.Source.Type == "base64" {
+				url = "data:" + block.Source.MediaType + ";base64," + block.Source.Data
+			}
+			parts = append(parts, map[string]interface{}{
+				"type":      "image_url",
+				"image_url": map[string]interface{}{"url": url},
+			})
+		}
+	}
+	return parts
+}
+
+// toolResultText flattens a tool_result to the text sent in a tool message
+func toolResultText(block ContentBlock) string {
+	text := block.Content.Text()
+	if block.IsError {
+		return "Error: " + text
+	}
+	return text
+}
+
+// captureMessages flattens the request to the text messages stored when the
+// conversation is captured
+func captureMessages(req MessageRequest) []capture.Message {
+	var messages []capture.Message
+	if system := req.System.Text(); system != "" {
+		messages = append(messages, capture.Message{Role: "system", Content: system})
+	}
+	for _, msg := range req.Messages {
+		for _, block := range msg.Content {
+			if block.Type == "tool_result" {
+				messages = append(messages, capture.Message{Role: "tool", Content: toolResultText(block)})
+			}
+		}
+		if text := msg.Content.Text(); text != "" {
+			messages = append(messages, capture.Message{Role: msg.Role, Content: text})
+		}
+	}
+	return messages
+}
+
+// routeHints describes a request for virtual model routing
+func routeHints(req MessageRequest) model.RouteHints {
+	texts := []string{req.System.Text()}
+	for _, msg := range req.Messages {
+		texts = append(texts, msg.Content.Text())
+		for _, block := range msg.Content {
+			if block.Type == "tool_result" {
+				texts = append(texts, toolResultText(block))
+			}
+		}
+	}
+	return model.RouteHints{
+		PromptTokens: model.EstimateTokens(texts...),
+		Tools:        len(req.Tools) > 0,
+		Vision:       hasImages(req),
+	}
+}
+
+// convertTools converts Anthropic tools to OpenAI function tools
+func convertTools(tools []Tool) []map[string]interface{} {
+	converted := make([]map[string]interface{}, 0, len(tools))
+	for _, tool := range tools {
+		function := map[string]interface{}{
+			"name": tool.Name,
+		}
+		if tool.Description != "" {
+			function["description"] = tool.Description
+		}
+		if len(tool.InputSchema) > 0 {
+			function["parameters"] = tool.InputSchema
+		}
+		converted = append(converted, map[string]interface{}{
+			"type":     "function",
+			"function": function,
+		})
+	}
+	return converted
+}
+
+// convertToolChoice converts an Anthropic tool_choice to the OpenAI form
+func convertToolChoice(choice *ToolChoice) interface{} {
+	switch choice.Type {
+	case "any":
+		return "required"
+	case "none":
+		return "none"
+	case "tool":
+		return map[string]interface{}{
+			"type":     "function",
+			"function": map[string]interface{}{"name": choice.Name},
+		}
+	default:
+		return "auto"
+	}
+}
+
+// toolUseBlocks converts OpenAI tool_calls from a response message to tool_use blocks
+func toolUseBlocks(toolCalls []interface{}) []ContentBlock {
+	blocks := make([]ContentBlock, 0, len(toolCalls))
+	for _, raw := range toolCalls {
+		call, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		function, _ := call["function"].(map[string]interface{})
+		name, _ := function["name"].(string)
+		arguments, _ := function["arguments"].(string)
+		id, _ := call["id"].(string)
+		if id == "" {
+			id = generateID("toolu")
+		}
+		blocks = append(blocks, ContentBlock{
+			Type:  "tool_use",
+			ID:    id,
+			Name:  name,
+			Input: toolInput(arguments),
+		})
+	}
+	return blocks
+}
+
+// toolInput returns tool call arguments as a JSON object; llama.cpp may
+// return an empty string when the tool takes no arguments
+func toolInput(arguments string) json.RawMessage {
+	if strings.TrimSpace(arguments) == "" || !json.Valid([]byte(arguments)) {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(arguments)
+}
@@ -0,0 +1,159 @@
+package anthropic
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertMessages(t *testing.T) {
+	body := `{
+		"model": "test-model",
+		"max_tokens": 256,
+		"system": [{"type": "text", "text": "You are terse."}, {"type": "text", "text": "Use tools."}],
+		"messages": [
+			{"role": "user", "content": [
+				{"type": "text", "text": "What is in this image, and the weather?"},
+				{"type": "image", "source": {"type": "base64", "media_type": "image/png", "data": "iVBORw0KGgo="}}
+			]},
+			{"role": "assistant", "content": [
+				{"type": "thinking", "thinking": "need weather"},
+				{"type": "text", "text": "Checking."},
+				{"type": "tool_use", "id": "toolu_1", "name": "get_weather", "input": {"city": "Paris"}}
+			]},
+			{"role": "user", "content": [
+				{"type": "tool_result", "tool_use_id": "toolu_1", "content": [{"type": "text", "text": "18C"}]},
+				{"type": "text", "text": "Thanks"}
+			]}
+		]
+	}`
+
+	var req MessageRequest
+	require.NoError(t, json.Unmarshal([]byte(body), &req))
+	assert.True(t, hasImages(req))
+
+	messages := convertMessages(req)
+	require.Len(t, messages, 5)
+
+	assert.Equal(t, "system", messages[0]["role"])
+	assert.Equal(t, "You are terse.\nUse tools.", messages[0]["content"])
+
+	parts := messages[1]["content"].([]map[string]interface{})
+	require.Len(t, parts, 2)
+	assert.Equal(t, "text", parts[0]["type"])
+	assert.Equal(t, "data:image/png;base64,iVBORw0KGgo=", parts[1]["image_url"].(map[string]interface{})["url"])
+
+	assert.Equal(t, "assistant", messages[2]["role"])
+	assert.Equal(t, "Checking.", messages[2]["content"])
+	calls := messages[2]["tool_calls"].([]map[string]interface{})
+	require.Len(t, calls, 1)
+	assert.Equal(t, "toolu_1", calls[0]["id"])
+	assert.JSONEq(t, `{"name":"get_weather","arguments":"{\"city\": \"Paris\"}"}`, mustJSON(t, calls[0]["function"]))
+
+	assert.Equal(t, "tool", messages[3]["role"])
+	assert.Equal(t, "toolu_1", messages[3]["tool_call_id"])
+	assert.Equal(t, "18C", messages[3]["content"])
+
+	assert.Equal(t, "user", messages[4]["role"])
+	assert.Equal(t, "Thanks", messages[4]["content"])
+}
+
+func TestConvertTools(t *testing.T) {
+	tools := convertTools([]Tool{{
+		Name:        "get_weather",
+		Description: "Get the weather",
+		InputSchema: json.RawMessage(`{"type":"object","properties":{"city":{"type":"string"}}}`),
+	}})
+	assert.JSONEq(t, `[{"type":"function","function":{
+		"name":"get_weather",
+		"description":"Get the weather",
+		"parameters":{"type":"object","properties":{"city":{"type":"string"}}}
+	}}]`, mustJSON(t, tools))
+
+	assert.Equal(t, "auto", convertToolChoice(&ToolChoice{Type: "auto"}))
+	assert.Equal(t, "required", convertToolChoice(&ToolChoice{Type: "any"}))
+	assert.Equal(t, "none", convertToolChoice(&ToolChoice{Type: "none"}))
+	assert.JSONEq(t, `{"type":"function","function":{"name":"get_weather"}}`,
+		mustJSON(t, convertToolChoice(&ToolChoice{Type: "tool", Name: "get_weather"})))
+}
+
+func TestConvertResponseToolUse(t *testing.T) {
+	handler := &Handler{}
+
+	var openaiResp map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"choices": [{
+			"message": {
+				"role": "assistant",
+				"content": null,
+				"tool_calls": [
+					{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}},
+					{"type": "function", "function": {"name": "get_time", "arguments": ""}}
+				]
+			},
+			"finish_reason": "tool_calls"
+		}]
+	}`), &openaiResp))
+
+	resp := handler.convertResponse(openaiResp, "test-model")
+	assert.Equal(t, "tool_use", resp.StopReason)
+	require.Len(t, resp.Content, 2)
+	assert.Equal(t, "tool_use", resp.Content[0].Type)
+	assert.Equal(t, "call_1", resp.Content[0].ID)
+	assert.Equal(t, "get_weather", resp.Content[0].Name)
+	assert.JSONEq(t, `{"city":"Paris"}`, string(resp.Content[0].Input))
+	assert.True(t, strings.HasPrefix(resp.Content[1].ID, "toolu_"))
+	assert.JSONEq(t, `{}`, string(resp.Content[1].Input))
+}
+
+func TestStreamResponseToolUse(t *testing.T) {
+	body := strings.Join([]string{
+		`data: {"choices":[{"index":0,"delta":{"content":"Let me check."}}]}`,
+		`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"get_weather","arguments":""}}]}}]}`,
+		`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+		`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`,
+		`data: {"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`data: [DONE]`,
+		``,
+	}, "\n\n")
+
+	_, events := streamUpstream(t, http.StatusOK, body)
+	assert.Equal(t, []string{
+		"message_start",
+		"content_block_start",
+		"content_block_delta",
+		"content_block_stop",
+		"content_block_start",
+		"content_block_delta",
+		"content_block_delta",
+		"content_block_stop",
+		"message_delta",
+		"message_stop",
+	}, eventNames(events))
+
+	block := events[4].data["content_block"].(map[string]interface{})
+	assert.Equal(t, "tool_use", block["type"])
+	assert.Equal(t, "call_1", block["id"])
+	assert.Equal(t, "get_weather", block["name"])
+	assert.Equal(t, 1.0, events[4].data["index"])
+
+	var arguments string
+	for _, e := range events[5:7] {
+		delta := e.data["delta"].(map[string]interface{})
+		assert.Equal(t, "input_json_delta", delta["type"])
+		arguments += delta["partial_json"].(string)
+	}
+	assert.JSONEq(t, `{"city":"Paris"}`, arguments)
+	assert.Equal(t, "tool_use", events[8].data["delta"].(map[string]interface{})["stop_reason"])
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(data)
+}
@@ -3,47 +3,77 @@ package anthropic
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/capture"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/filter"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tokenizer"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
 )
 
 // Handler handles Anthropic API requests
 type Handler struct {
 	modelMgr *model.Manager
 	client   *http.Client
+	usage    *usage.Recorder
+	capture  *capture.Recorder
+	filters  *filter.Registry
 }
 
 // NewHandler creates a new Anthropic API handler
 func NewHandler(modelMgr *model.Manager) *Handler {
 	return &Handler{
 		modelMgr: modelMgr,
-		client:   &http.Client{},
+		client:   &http.Client{Transport: tracing.NewTransport(nil, "llama-server")},
 	}
 }
 
+// SetUsageRecorder sets where token usage of proxied requests is recorded
+func (h *Handler) SetUsageRecorder(recorder *usage.Recorder) {
+	h.usage = recorder
+}
+
+// SetCaptureRecorder sets where captured chats are recorded
+func (h *Handler) SetCaptureRecorder(recorder *capture.Recorder) {
+	h.capture = recorder
+}
+
+// SetFilters sets the registry providing the content filters of each request
+func (h *Handler) SetFilters(registry *filter.Registry) {
+	h.filters = registry
+}
+
 // MessageRequest represents an Anthropic messages API request
 type MessageRequest struct {
 	Model     string         `json:"model"`
 	MaxTokens int            `json:"max_tokens"`
 	Messages  []Message     `json:"messages"`
-	System    string        `json:"system,omitempty"`
+	System    MessageContent `json:"system,omitempty"` // 字符串或文本块数组
 	Temperature float64      `json:"temperature,omitempty"`
 	TopP      float64       `json:"top_p,omitempty"`
 	TopK      int           `json:"top_k,omitempty"`
 	Stream    bool          `json:"stream,omitempty"`
 	StopSequences []string `json:"stop_sequences,omitempty"`
+	Tools         []Tool      `json:"tools,omitempty"`
+	ToolChoice    *ToolChoice `json:"tool_choice,omitempty"`
 }
 
 // Message represents a message in Anthropic format
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role    string         `json:"role"`
+	Content MessageContent `json:"content"`
 }
 
 // MessageResponse represents an Anthropic messages API response
@@ -62,6 +92,44 @@ type MessageResponse struct {
 type ContentBlock struct {
 	Type string `json:"type"`
 	Text string `json:"text,omitempty"`
+
+	// image
+	Source *ImageSource `json:"source,omitempty"`
+
+	// tool_use
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result
+	ToolUseID string         `json:"tool_use_id,omitempty"`
+	Content   MessageContent `json:"content,omitempty"`
+	IsError   bool           `json:"is_error,omitempty"`
+
+	// thinking
+	Thinking string `json:"thinking,omitempty"`
+}
+
+// ImageSource represents the source of an image block
+type ImageSource struct {
+	Type      string `json:"type"` // base64 or url
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// Tool represents a tool the model may call
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// ToolChoice controls how the model uses tools
+type ToolChoice struct {
+	Type                   string `json:"type"` // auto, any, tool, none
+	Name                   string `json:"name,omitempty"`
+	DisableParallelToolUse bool   `json:"disable_parallel_tool_use,omitempty"`
 }
 
 // Usage represents token usage
@@ -100,10 +168,22 @@ func (h *Handler) HandleMessages(c *gin.Context) {
 		return
 	}
 
+	// 请求过滤器作用于转换后的 OpenAI 消息，在选择模型前运行
+	chain := h.filters.Chain(c, req.Model)
+	messages := convertMessages(req)
+	if !chain.Empty() {
+		filtered, err := chain.Request(c.Request.Context(), filter.FromOpenAI(messages))
+		if err != nil {
+			h.sendError(c, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+		messages = filter.ToOpenAI(messages, filtered)
+	}
+
 	// Find the actual model ID
-	actualModelID, err := h.findModel(req.Model)
+	actualModelID, err := h.modelMgr.Route(c.Request.Context(), req.Model, routeHints(req), c.GetHeader(h.modelMgr.SessionHeader()))
 	if err != nil {
-		h.sendError(c, http.StatusNotFound, "invalid_request_error", err.Error())
+		h.sendModelError(c, err)
 		return
 	}
 
@@ -114,33 +194,96 @@ func (h *Handler) HandleMessages(c *gin.Context) {
 		return
 	}
 
+	// 图像输入需要模型以 mmproj 加载
+	if hasImages(req) {
+		if status, _ := h.modelMgr.GetStatus(actualModelID); status == nil || !status.Vision {
+			h.sendError(c, http.StatusBadRequest, "invalid_request",
+				fmt.Sprintf("model %s does not support image input; load it with an mmproj file", req.Model))
+			return
+		}
+	}
+
+	// 等待模型空闲槽位，同时记录请求用于空闲卸载判断
+	done, err := h.modelMgr.AcquireSlot(c.Request.Context(), actualModelID)
+	if err != nil {
+		h.sendModelError(c, err)
+		return
+	}
+	defer done()
+
 	// Convert to OpenAI format and forward
-	h.forwardToOpenAI(c, actualModelID, port, req)
+	h.forwardToOpenAI(c, actualModelID, port, req, messages, chain)
 }
 
-// findModel finds a model by name or ID
-func (h *Handler) findModel(modelName string) (string, error) {
-	statuses := h.modelMgr.ListStatus()
-	models := h.modelMgr.ListModels()
+// HandleCountTokens handles Anthropic count_tokens requests. The model is
+// not loaded on demand: an unloaded model is counted with its GGUF vocabulary.
+func (h *Handler) HandleCountTokens(c *gin.Context) {
+	var req MessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.sendError(c, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	if req.Model == "" {
+		h.sendError(c, http.StatusBadRequest, "invalid_request", "model is required")
+		return
+	}
+	if len(req.Messages) == 0 {
+		h.sendError(c, http.StatusBadRequest, "invalid_request", "messages array is empty")
+		return
+	}
 
-	// First try exact match with ID
-	if status, exists := statuses[modelName]; exists && status.State == model.StateLoaded {
-		return modelName, nil
+	modelName := req.Model
+	concrete, virtual, err := h.modelMgr.ResolveVirtual(c.Request.Context(), modelName, routeHints(req))
+	if err != nil {
+		h.sendModelError(c, err)
+		return
+	}
+	if virtual {
+		modelName = concrete
+	}
+	m, exists := h.modelMgr.ResolveModel(modelName)
+	if !exists {
+		h.sendError(c, http.StatusNotFound, "not_found_error", "model not found: "+req.Model)
+		return
 	}
 
-	// Try to find by name/alias
-	for _, m := range models {
-		status, exists := statuses[m.ID]
-		if !exists || status.State != model.StateLoaded {
-			continue
+	var tools []map[string]interface{}
+	if len(req.Tools) > 0 {
+		tools = convertTools(req.Tools)
+	}
+	count, err := h.modelMgr.CountTokens(c.Request.Context(), m.ID, convertMessages(req), tools)
+	if err != nil {
+		if errors.Is(err, tokenizer.ErrUnsupported) {
+			h.sendError(c, http.StatusBadRequest, "invalid_request", err.Error())
+			return
 		}
+		h.sendError(c, http.StatusInternalServerError, "api_error", err.Error())
+		return
+	}
 
-		if m.Alias == modelName || m.Name == modelName {
-			return m.ID, nil
-		}
+	c.JSON(http.StatusOK, gin.H{"input_tokens": count.Count})
+}
+
+// sendModelError writes model routing, on-demand load and queue errors in
+// the Anthropic error format
+func (h *Handler) sendModelError(c *gin.Context, err error) {
+	status, retryAfter := model.ErrorStatus(err)
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
 	}
 
-	return "", fmt.Errorf("model not found: %s", modelName)
+	switch status {
+	case http.StatusTooManyRequests:
+		h.sendError(c, status, "rate_limit_error", err.Error())
+	case http.StatusServiceUnavailable:
+		h.sendError(c, status, "overloaded_error", err.Error())
+	case http.StatusInternalServerError:
+		h.sendError(c, status, "api_error", err.Error())
+	case http.StatusRequestTimeout:
+		h.sendError(c, status, "timeout_error", err.Error())
+	default:
+		h.sendError(c, status, "invalid_request_error", err.Error())
+	}
 }
 
 // getModelPort returns the port for a loaded model
@@ -161,27 +304,9 @@ func (h *Handler) getModelPort(modelID string) (int, error) {
 	return status.Port, nil
 }
 
-// forwardToOpenAI converts Anthropic request to OpenAI format and forwards
-func (h *Handler) forwardToOpenAI(c *gin.Context, modelID string, port int, anthropicReq MessageRequest) {
-	// Convert Anthropic messages to OpenAI format
-	messages := make([]map[string]interface{}, 0, len(anthropicReq.Messages)+1)
-
-	// Add system message if present
-	if anthropicReq.System != "" {
-		messages = append(messages, map[string]interface{}{
-			"role":    "system",
-			"content": anthropicReq.System,
-		})
-	}
-
-	// Add user messages
-	for _, msg := range anthropicReq.Messages {
-		messages = append(messages, map[string]interface{}{
-			"role":    msg.Role,
-			"content": msg.Content,
-		})
-	}
-
+// forwardToOpenAI converts Anthropic request to OpenAI format and forwards.
+// messages are the converted and filtered messages; chain filters the reply.
+func (h *Handler) forwardToOpenAI(c *gin.Context, modelID string, port int, anthropicReq MessageRequest, messages []map[string]interface{}, chain *filter.Chain) {
 	openaiReq := map[string]interface{}{
 		"model":    modelID,
 		"messages": messages,
@@ -198,6 +323,31 @@ func (h *Handler) forwardToOpenAI(c *gin.Context, modelID string, port int, anth
 	if anthropicReq.TopK > 0 {
 		openaiReq["top_k"] = anthropicReq.TopK
 	}
+	if len(anthropicReq.StopSequences) > 0 {
+		openaiReq["stop"] = anthropicReq.StopSequences
+	}
+	if len(anthropicReq.Tools) > 0 {
+		openaiReq["tools"] = convertTools(anthropicReq.Tools)
+	}
+	if anthropicReq.ToolChoice != nil {
+		openaiReq["tool_choice"] = convertToolChoice(anthropicReq.ToolChoice)
+		if anthropicReq.ToolChoice.DisableParallelToolUse {
+			openaiReq["parallel_tool_calls"] = false
+		}
+	}
+	inputTokens := 0
+	if anthropicReq.Stream {
+		// 让 llama.cpp 在最后一个数据块中返回 token 用量
+		openaiReq["stream_options"] = map[string]interface{}{"include_usage": true}
+
+		// message_start 在生成开始前发送，提示词 token 数需要预先计算
+		tools, _ := openaiReq["tools"].([]map[string]interface{})
+		if count, err := h.modelMgr.CountTokens(c.Request.Context(), modelID, messages, tools); err == nil {
+			inputTokens = count.Count
+		} else {
+			logger.Warn("计算提示词 token 数失败，message_start 中 input_tokens 为 0", "model", modelID, "error", err)
+		}
+	}
 
 	// Marshal request body
 	body, err := json.Marshal(openaiReq)
@@ -207,6 +357,17 @@ func (h *Handler) forwardToOpenAI(c *gin.Context, modelID string, port int, anth
 	}
 
 	url := fmt.Sprintf("http://127.0.0.1:%d/v1/chat/completions", port)
+	captured := captureMessages(anthropicReq)
+	if !chain.Empty() {
+		// 记录过滤后的消息，被脱敏的内容不进入对话存储
+		captured = nil
+		for _, msg := range filter.FromOpenAI(messages) {
+			if msg.Content != "" {
+				captured = append(captured, capture.Message{Role: msg.Role, Content: msg.Content})
+			}
+		}
+	}
+	turn := h.capture.Begin(c.Writer, c.Request, "/v1/messages", captured)
 
 	// Create HTTP request
 	httpReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", url, bytes.NewReader(body))
@@ -218,14 +379,21 @@ func (h *Handler) forwardToOpenAI(c *gin.Context, modelID string, port int, anth
 	httpReq.Header.Set("Content-Type", "application/json")
 
 	// Send request
+	start := time.Now()
 	resp, err := h.client.Do(httpReq)
 	if err != nil {
 		h.sendError(c, http.StatusBadGateway, "internal_error", err.Error())
 		logger.Errorf("转发请求到 llama.cpp 失败: %v", err)
+		h.modelMgr.ReportUpstreamError(modelID, err)
 		return
 	}
 	defer resp.Body.Close()
 
+	if anthropicReq.Stream {
+		h.streamResponse(c, modelID, anthropicReq, inputTokens, resp, start, turn, chain)
+		return
+	}
+
 	// Read response
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -233,6 +401,15 @@ func (h *Handler) forwardToOpenAI(c *gin.Context, modelID string, port int, anth
 		return
 	}
 
+	if u, ok := usage.Parse(respBody); ok && resp.StatusCode == http.StatusOK {
+		h.usage.Record(c.Request, modelID, "/v1/messages", u, start, false)
+	}
+	if resp.StatusCode == http.StatusOK {
+		respBody = chain.Body(c.Request.Context(), respBody)
+		turn.ParseResponse(respBody)
+		turn.Finish(modelID)
+	}
+
 	// Convert OpenAI response to Anthropic format
 	var openaiResp map[string]interface{}
 	if err := json.Unmarshal(respBody, &openaiResp); err != nil {
@@ -263,14 +440,16 @@ func (h *Handler) convertResponse(openaiResp map[string]interface{}, model strin
 	if choices, ok := openaiResp["choices"].([]interface{}); ok && len(choices) > 0 {
 		if firstChoice, ok := choices[0].(map[string]interface{}); ok {
 			if message, ok := firstChoice["message"].(map[string]interface{}); ok {
-				if content, ok := message["content"].(string); ok {
+				toolCalls, _ := message["tool_calls"].([]interface{})
+				if content, ok := message["content"].(string); ok && (content != "" || len(toolCalls) == 0) {
 					resp.Content = []ContentBlock{
 						{Type: "text", Text: content},
 					}
 				}
+				resp.Content = append(resp.Content, toolUseBlocks(toolCalls)...)
 			}
 			if finishReason, ok := firstChoice["finish_reason"].(string); ok {
-				resp.StopReason = finishReason
+				resp.StopReason = stopReason(finishReason)
 			}
 		}
 	}
@@ -311,5 +490,9 @@ func (h *Handler) sendError(c *gin.Context, statusCode int, errorType, message s
 
 // generateID generates a unique ID for Anthropic responses
 func generateID(prefix string) string {
-	return fmt.Sprintf("%s_%s", prefix, "id")
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%s_%d", prefix, time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%s_%s", prefix, hex.EncodeToString(b))
 }
@@ -1,6 +1,7 @@
 package anthropic
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -81,7 +82,7 @@ func TestMessageRequest(t *testing.T) {
 func TestMessage(t *testing.T) {
 	msg := Message{
 		Role:    "user",
-		Content: "Hello, how are you?",
+		Content: MessageContent{{Type: "text", Text: "Hello, how are you?"}},
 	}
 
 	data, err := json.Marshal(msg)
@@ -93,6 +94,11 @@ func TestMessage(t *testing.T) {
 
 	assert.Equal(t, msg.Role, decoded.Role)
 	assert.Equal(t, msg.Content, decoded.Content)
+
+	// 字符串形式的 content 解析为一个文本块
+	err = json.Unmarshal([]byte(`{"role":"user","content":"Hello, how are you?"}`), &decoded)
+	require.NoError(t, err)
+	assert.Equal(t, msg.Content, decoded.Content)
 }
 
 func TestMessageResponse(t *testing.T) {
@@ -252,6 +258,37 @@ func TestHandler_HandleMessages(t *testing.T) {
 	}
 }
 
+func TestHandler_HandleCountTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	modelMgr := model.NewManager(config.DefaultConfig(), nil, process.NewManager())
+	handler := NewHandler(modelMgr)
+	router := gin.New()
+	router.POST("/v1/messages/count_tokens", handler.HandleCountTokens)
+
+	tests := []struct {
+		name       string
+		reqBody    string
+		wantStatus int
+	}{
+		{"missing model", `{"messages": [{"role": "user", "content": "Hello"}]}`, http.StatusBadRequest},
+		{"empty messages", `{"model": "test", "messages": []}`, http.StatusBadRequest},
+		// max_tokens 不是必需的，未知模型返回 404 且不会触发按需加载
+		{"model not found", `{"model": "nonexistent-model", "messages": [{"role": "user", "content": "Hello"}]}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/messages/count_tokens", strings.NewReader(tt.reqBody))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
 func TestHandler_findModel(t *testing.T) {
 	cfg := config.DefaultConfig()
 	procMgr := process.NewManager()
@@ -259,13 +296,13 @@ func TestHandler_findModel(t *testing.T) {
 	handler := NewHandler(modelMgr)
 
 	t.Run("no models loaded", func(t *testing.T) {
-		_, err := handler.findModel("test-model")
+		_, err := handler.modelMgr.Route(context.Background(), "test-model", model.RouteHints{}, "")
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "model not found")
 	})
 
 	t.Run("empty model name", func(t *testing.T) {
-		_, err := handler.findModel("")
+		_, err := handler.modelMgr.Route(context.Background(), "", model.RouteHints{}, "")
 		assert.Error(t, err)
 	})
 }
@@ -323,7 +360,7 @@ func TestHandler_convertResponse(t *testing.T) {
 				assert.Equal(t, "test-model", resp.Model)
 				assert.Len(t, resp.Content, 1)
 				assert.Equal(t, "Hello! How can I help?", resp.Content[0].Text)
-				assert.Equal(t, "stop", resp.StopReason)
+				assert.Equal(t, "end_turn", resp.StopReason)
 				assert.Equal(t, 10, resp.Usage.InputTokens)
 				assert.Equal(t, 20, resp.Usage.OutputTokens)
 			},
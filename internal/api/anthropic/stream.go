@@ -0,0 +1,318 @@
+package anthropic
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/capture"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/filter"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
+)
+
+// stopReason maps an OpenAI finish_reason to an Anthropic stop_reason
+func stopReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case filter.FinishReason:
+		return "refusal"
+	default:
+		return "end_turn"
+	}
+}
+
+// streamChunk is the part of an OpenAI chat completion chunk used for translation
+type streamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// streamTranslator turns llama-server's OpenAI chunk stream into Anthropic
+// message stream events
+type streamTranslator struct {
+	w       io.Writer
+	flusher http.Flusher
+	id      string
+	model   string
+	input   int // 提示词 token 数，在 message_start 中返回
+
+	started    bool   // message_start 已发送
+	blockType  string // 当前未关闭的内容块类型，为空表示没有
+	toolIndex  int    // 当前 tool_use 块对应的上游 tool_calls 下标
+	blocks     int    // 已开始的内容块数量
+	stopReason string // 上游 finish_reason 映射后的结果
+	failed     bool   // 已发送 error 事件
+}
+
+func newStreamTranslator(w io.Writer, flusher http.Flusher, model string, inputTokens int) *streamTranslator {
+	return &streamTranslator{
+		w:       w,
+		flusher: flusher,
+		id:      generateID("msg"),
+		model:   model,
+		input:   inputTokens,
+	}
+}
+
+// handleLine translates one SSE line from upstream
+func (t *streamTranslator) handleLine(line string) {
+	data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+	if !ok || t.failed {
+		return
+	}
+	data = strings.TrimSpace(data)
+	if data == "" || data == "[DONE]" {
+		return
+	}
+
+	var chunk streamChunk
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		logger.Warnf("解析流式响应数据块失败: %v", err)
+		return
+	}
+	if chunk.Error != nil {
+		t.fail(chunk.Error.Message)
+		return
+	}
+
+	t.start()
+	for _, choice := range chunk.Choices {
+		if choice.Delta.Content != "" {
+			if t.blockType != "text" {
+				t.openTextBlock()
+			}
+			t.writeEvent("content_block_delta", map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": t.blocks - 1,
+				"delta": map[string]interface{}{
+					"type": "text_delta",
+					"text": choice.Delta.Content,
+				},
+			})
+		}
+		for _, call := range choice.Delta.ToolCalls {
+			// 每个工具调用的第一个数据块带有 id 和函数名，其后只有参数片段
+			if t.blockType != "tool_use" || call.Index != t.toolIndex {
+				id := call.ID
+				if id == "" {
+					id = generateID("toolu")
+				}
+				t.toolIndex = call.Index
+				t.openBlock("tool_use", map[string]interface{}{
+					"type":  "tool_use",
+					"id":    id,
+					"name":  call.Function.Name,
+					"input": map[string]interface{}{},
+				})
+			}
+			if call.Function.Arguments != "" {
+				t.writeEvent("content_block_delta", map[string]interface{}{
+					"type":  "content_block_delta",
+					"index": t.blocks - 1,
+					"delta": map[string]interface{}{
+						"type":         "input_json_delta",
+						"partial_json": call.Function.Arguments,
+					},
+				})
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			t.stopReason = stopReason(*choice.FinishReason)
+		}
+	}
+}
+
+// finish closes the open content block and ends the message with its stop
+// reason and token usage
+func (t *streamTranslator) finish(u usage.Usage) {
+	if t.failed {
+		return
+	}
+	t.start()
+	if t.blocks == 0 {
+		// 没有生成任何文本时仍返回一个空文本块，与 Anthropic API 行为一致
+		t.openTextBlock()
+	}
+	t.closeBlock()
+
+	if t.stopReason == "" {
+		t.stopReason = "end_turn"
+	}
+	t.writeEvent("message_delta", map[string]interface{}{
+		"type": "message_delta",
+		"delta": map[string]interface{}{
+			"stop_reason":   t.stopReason,
+			"stop_sequence": nil,
+		},
+		"usage": Usage{InputTokens: u.PromptTokens, OutputTokens: u.CompletionTokens},
+	})
+	t.writeEvent("message_stop", map[string]interface{}{"type": "message_stop"})
+}
+
+// fail sends an error event; no further events follow
+func (t *streamTranslator) fail(message string) {
+	t.failed = true
+	t.writeEvent("error", map[string]interface{}{
+		"type": "error",
+		"error": ErrorDetail{
+			Type:    "api_error",
+			Message: message,
+		},
+	})
+}
+
+func (t *streamTranslator) start() {
+	if t.started {
+		return
+	}
+	t.started = true
+	t.writeEvent("message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id":            t.id,
+			"type":          "message",
+			"role":          "assistant",
+			"content":       []ContentBlock{},
+			"model":         t.model,
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         Usage{InputTokens: t.input},
+		},
+	})
+}
+
+func (t *streamTranslator) openTextBlock() {
+	t.openBlock("text", map[string]interface{}{
+		"type": "text",
+		"text": "",
+	})
+}
+
+// openBlock closes the current content block and starts a new one
+func (t *streamTranslator) openBlock(blockType string, block map[string]interface{}) {
+	t.closeBlock()
+	t.blockType = blockType
+	t.blocks++
+	t.writeEvent("content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         t.blocks - 1,
+		"content_block": block,
+	})
+}
+
+func (t *streamTranslator) closeBlock() {
+	if t.blockType == "" {
+		return
+	}
+	t.blockType = ""
+	t.writeEvent("content_block_stop", map[string]interface{}{
+		"type":  "content_block_stop",
+		"index": t.blocks - 1,
+	})
+}
+
+// writeEvent writes one named SSE event and flushes it to the client
+func (t *streamTranslator) writeEvent(event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		logger.Errorf("序列化流式事件失败: %v", err)
+		return
+	}
+	fmt.Fprintf(t.w, "event: %s\ndata: %s\n\n", event, payload)
+	if t.flusher != nil {
+		t.flusher.Flush()
+	}
+}
+
+// streamResponse relays an upstream OpenAI chunk stream as Anthropic events.
+// inputTokens is the prompt token count reported in message_start. turn, if
+// not nil, captures the reply into the conversation store; chain filters the
+// generated text chunk by chunk.
+func (h *Handler) streamResponse(c *gin.Context, modelID string, anthropicReq MessageRequest, inputTokens int, resp *http.Response, start time.Time, turn *capture.Turn, chain *filter.Chain) {
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		h.sendError(c, resp.StatusCode, "api_error", upstreamErrorMessage(respBody))
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable nginx buffering
+	c.Status(http.StatusOK)
+
+	translator := newStreamTranslator(c.Writer, c.Writer, anthropicReq.Model, inputTokens)
+
+	var streamUsage usage.Usage
+	defer func() {
+		h.usage.Record(c.Request, modelID, "/v1/messages", streamUsage, start, true)
+		turn.Finish(modelID)
+	}()
+
+	reader := bufio.NewReader(resp.Body)
+	filters := chain.Stream(c.Request.Context())
+	for {
+		line, err := reader.ReadString('\n')
+		line = filters.Line(line)
+		if u, ok := usage.ParseStreamLine(line); ok {
+			streamUsage = u
+		}
+		turn.ParseStreamLine(line)
+		translator.handleLine(line)
+		if filters.Blocked() {
+			// 被拦截后停止读取，消息以 stop_reason refusal 结束
+			break
+		}
+
+		if err != nil {
+			if c.Request.Context().Err() != nil {
+				return
+			}
+			if err != io.EOF {
+				logger.Errorf("读取流式响应失败: %v", err)
+				translator.fail(err.Error())
+				return
+			}
+			break
+		}
+	}
+
+	translator.finish(streamUsage)
+}
+
+// upstreamErrorMessage extracts the error message from a llama-server error body
+func upstreamErrorMessage(body []byte) string {
+	var resp struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err == nil && resp.Error.Message != "" {
+		return resp.Error.Message
+	}
+	return strings.TrimSpace(string(body))
+}
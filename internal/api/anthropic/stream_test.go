@@ -0,0 +1,143 @@
+package anthropic
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sseEvent 解析后的一个 SSE 事件
+type sseEvent struct {
+	name string
+	data map[string]interface{}
+}
+
+// streamUpstream 用给定的上游响应体调用 streamResponse 并解析输出事件
+func streamUpstream(t *testing.T, status int, body string) (*httptest.ResponseRecorder, []sseEvent) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	handler := NewHandler(model.NewManager(config.DefaultConfig(), nil, process.NewManager()))
+	upstream := &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/messages", nil)
+	handler.streamResponse(c, "test-model", MessageRequest{Model: "claude-test", Stream: true}, 9, upstream, time.Now(), nil, nil)
+
+	var events []sseEvent
+	var current sseEvent
+	scanner := bufio.NewScanner(strings.NewReader(w.Body.String()))
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			current = sseEvent{name: strings.TrimPrefix(line, "event: ")}
+		case strings.HasPrefix(line, "data: "):
+			require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &current.data))
+			events = append(events, current)
+		}
+	}
+	return w, events
+}
+
+func eventNames(events []sseEvent) []string {
+	names := make([]string, len(events))
+	for i, e := range events {
+		names[i] = e.name
+	}
+	return names
+}
+
+func TestStreamResponse(t *testing.T) {
+	t.Run("Text stream", func(t *testing.T) {
+		body := strings.Join([]string{
+			`data: {"choices":[{"index":0,"delta":{"role":"assistant","content":null},"finish_reason":null}]}`,
+			`data: {"choices":[{"index":0,"delta":{"content":"Hello"},"finish_reason":null}]}`,
+			`data: {"choices":[{"index":0,"delta":{"content":" world"},"finish_reason":null}]}`,
+			`data: {"choices":[{"index":0,"delta":{},"finish_reason":"length"}]}`,
+			`data: {"choices":[],"usage":{"prompt_tokens":9,"completion_tokens":2,"total_tokens":11}}`,
+			`data: [DONE]`,
+			``,
+		}, "\n\n")
+
+		w, events := streamUpstream(t, http.StatusOK, body)
+		assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+		assert.Equal(t, []string{
+			"message_start",
+			"content_block_start",
+			"content_block_delta",
+			"content_block_delta",
+			"content_block_stop",
+			"message_delta",
+			"message_stop",
+		}, eventNames(events))
+
+		message := events[0].data["message"].(map[string]interface{})
+		assert.Equal(t, "claude-test", message["model"])
+		assert.True(t, strings.HasPrefix(message["id"].(string), "msg_"))
+		// 提示词 token 数在生成前计算，与上游最终报告的一致
+		assert.Equal(t, map[string]interface{}{"input_tokens": 9.0, "output_tokens": 0.0}, message["usage"])
+
+		delta := events[2].data["delta"].(map[string]interface{})
+		assert.Equal(t, "text_delta", delta["type"])
+		assert.Equal(t, "Hello", delta["text"])
+
+		messageDelta := events[5].data
+		assert.Equal(t, "max_tokens", messageDelta["delta"].(map[string]interface{})["stop_reason"])
+		assert.Equal(t, 2.0, messageDelta["usage"].(map[string]interface{})["output_tokens"])
+		assert.Equal(t, 9.0, messageDelta["usage"].(map[string]interface{})["input_tokens"])
+	})
+
+	t.Run("Empty completion", func(t *testing.T) {
+		body := `data: {"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}` + "\n\ndata: [DONE]\n\n"
+
+		_, events := streamUpstream(t, http.StatusOK, body)
+		assert.Equal(t, []string{
+			"message_start", "content_block_start", "content_block_stop", "message_delta", "message_stop",
+		}, eventNames(events))
+		assert.Equal(t, "end_turn", events[3].data["delta"].(map[string]interface{})["stop_reason"])
+	})
+
+	t.Run("Upstream error in stream", func(t *testing.T) {
+		body := `data: {"choices":[{"index":0,"delta":{"content":"Hi"}}]}` + "\n\n" +
+			`data: {"error":{"code":500,"message":"context shift disabled"}}` + "\n\n"
+
+		_, events := streamUpstream(t, http.StatusOK, body)
+		names := eventNames(events)
+		assert.Equal(t, "error", names[len(names)-1])
+		assert.NotContains(t, names, "message_stop")
+	})
+
+	t.Run("Upstream error status", func(t *testing.T) {
+		w, _ := streamUpstream(t, http.StatusBadRequest, `{"error":{"code":400,"message":"prompt too long"}}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		var resp MessageResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "prompt too long", resp.Error.Message)
+	})
+}
+
+func TestStopReason(t *testing.T) {
+	assert.Equal(t, "end_turn", stopReason("stop"))
+	assert.Equal(t, "max_tokens", stopReason("length"))
+	assert.Equal(t, "tool_use", stopReason("tool_calls"))
+	assert.Equal(t, "refusal", stopReason("content_filter"))
+	assert.Equal(t, "end_turn", stopReason(""))
+}
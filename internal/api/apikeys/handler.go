@@ -0,0 +1,179 @@
+// Package apikeys provides API handlers for managing API keys
+package apikeys
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/api"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/auth"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+)
+
+// Handler handles API key management requests
+type Handler struct {
+	store storage.Store
+}
+
+// NewHandler creates a new API key handler
+func NewHandler(store storage.Store) *Handler {
+	return &Handler{store: store}
+}
+
+// KeyRequest is the body of create and update requests
+type KeyRequest struct {
+	Name          string              `json:"name"`
+	Scopes        []string            `json:"scopes" binding:"required"`
+	AllowedModels []string            `json:"allowedModels"`
+	ExpiresAt     *time.Time          `json:"expiresAt"`
+	Limits        *storage.RateLimits `json:"limits"`  // 省略 = 使用网关默认限额
+	Filters       []string            `json:"filters"` // gateway.filters 中的过滤器名称
+}
+
+// validate checks the scopes, expiry, limits and filters of a request
+func (r *KeyRequest) validate() error {
+	if len(r.Scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range r.Scopes {
+		if !auth.ValidScope(scope) {
+			return fmt.Errorf("unknown scope %q (want inference, read or admin)", scope)
+		}
+	}
+	for _, model := range r.AllowedModels {
+		if strings.TrimSpace(model) == "" {
+			return errors.New("allowedModels must not contain empty names")
+		}
+	}
+	for _, filter := range r.Filters {
+		if strings.TrimSpace(filter) == "" {
+			return errors.New("filters must not contain empty names")
+		}
+	}
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		return errors.New("expiresAt must be in the future")
+	}
+	if l := r.Limits; l != nil && (l.RequestsPerMinute < 0 || l.ConcurrentRequests < 0 || l.TokensPerDay < 0) {
+		return errors.New("limits cannot be negative")
+	}
+	return nil
+}
+
+// CreateKey creates a key. The secret is only returned by this call.
+func (h *Handler) CreateKey(c *gin.Context) {
+	var req KeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "无效的请求: "+err.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		api.BadRequest(c, err.Error())
+		return
+	}
+
+	secret, key, err := auth.GenerateKey()
+	if err != nil {
+		api.InternalError(c, err)
+		return
+	}
+	key.Name = req.Name
+	key.Scopes = req.Scopes
+	key.AllowedModels = req.AllowedModels
+	key.ExpiresAt = req.ExpiresAt
+	key.Limits = req.Limits
+	key.Filters = req.Filters
+
+	if err := h.store.CreateAPIKey(c.Request.Context(), key); err != nil {
+		api.InternalError(c, err)
+		return
+	}
+	logger.Info("API 密钥已创建", "id", key.ID, "name", key.Name, "scopes", key.Scopes)
+
+	api.Success(c, gin.H{"key": secret, "apiKey": key})
+}
+
+// ListKeys returns all keys without their secrets
+func (h *Handler) ListKeys(c *gin.Context) {
+	keys, err := h.store.ListAPIKeys(c.Request.Context())
+	if err != nil {
+		api.InternalError(c, err)
+		return
+	}
+	api.Success(c, gin.H{"keys": keys, "total": len(keys)})
+}
+
+// GetKey returns a single key
+func (h *Handler) GetKey(c *gin.Context) {
+	key, err := h.store.GetAPIKey(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, storage.ErrAPIKeyNotFound) {
+		api.NotFound(c, "API key")
+		return
+	}
+	if err != nil {
+		api.InternalError(c, err)
+		return
+	}
+	api.Success(c, key)
+}
+
+// UpdateKey replaces the name, scopes, allowed models, expiry, limits and filters of a key.
+// The secret cannot be changed; create a new key to rotate it.
+func (h *Handler) UpdateKey(c *gin.Context) {
+	var req KeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "无效的请求: "+err.Error())
+		return
+	}
+	if err := req.validate(); err != nil {
+		api.BadRequest(c, err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	key := &storage.APIKey{
+		ID:            c.Param("id"),
+		Name:          req.Name,
+		Scopes:        req.Scopes,
+		AllowedModels: req.AllowedModels,
+		ExpiresAt:     req.ExpiresAt,
+		Limits:        req.Limits,
+		Filters:       req.Filters,
+	}
+	err := h.store.UpdateAPIKey(ctx, key)
+	if errors.Is(err, storage.ErrAPIKeyNotFound) {
+		api.NotFound(c, "API key")
+		return
+	}
+	if err != nil {
+		api.InternalError(c, err)
+		return
+	}
+	logger.Info("API 密钥已更新", "id", key.ID, "scopes", key.Scopes)
+
+	updated, err := h.store.GetAPIKey(ctx, key.ID)
+	if err != nil {
+		api.InternalError(c, err)
+		return
+	}
+	api.Success(c, updated)
+}
+
+// DeleteKey revokes a key
+func (h *Handler) DeleteKey(c *gin.Context) {
+	id := c.Param("id")
+	err := h.store.DeleteAPIKey(c.Request.Context(), id)
+	if errors.Is(err, storage.ErrAPIKeyNotFound) {
+		api.NotFound(c, "API key")
+		return
+	}
+	if err != nil {
+		api.InternalError(c, err)
+		return
+	}
+	logger.Info("API 密钥已删除", "id", id)
+	api.SuccessWithMessage(c, "API key deleted")
+}
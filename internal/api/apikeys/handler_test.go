@@ -0,0 +1,96 @@
+package apikeys
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/auth"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRouter(t *testing.T) (*gin.Engine, storage.Store) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store, err := storage.NewMemoryStore()
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	h := NewHandler(store)
+	router := gin.New()
+	router.POST("/api/keys", h.CreateKey)
+	router.GET("/api/keys", h.ListKeys)
+	router.GET("/api/keys/:id", h.GetKey)
+	router.PUT("/api/keys/:id", h.UpdateKey)
+	router.DELETE("/api/keys/:id", h.DeleteKey)
+	return router, store
+}
+
+func do(router *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return w
+}
+
+func TestHandler_KeyLifecycle(t *testing.T) {
+	router, store := newTestRouter(t)
+
+	w := do(router, "POST", "/api/keys", `{"name":"ci","scopes":["inference"],"allowedModels":["qwen"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var created struct {
+		Data struct {
+			Key    string         `json:"key"`
+			APIKey storage.APIKey `json:"apiKey"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	secret, id := created.Data.Key, created.Data.APIKey.ID
+	assert.True(t, strings.HasPrefix(secret, created.Data.APIKey.Prefix))
+	assert.NotContains(t, w.Body.String(), `"hash"`)
+
+	// 新密钥立即可用于认证
+	key, err := auth.NewAuthenticator(store, nil).Authenticate(context.Background(), secret)
+	require.NoError(t, err)
+	assert.Equal(t, id, key.ID)
+
+	w = do(router, "GET", "/api/keys", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), secret)
+	assert.Contains(t, w.Body.String(), id)
+
+	w = do(router, "PUT", "/api/keys/"+id, `{"name":"ci","scopes":["read"],"limits":{"requestsPerMinute":60},"filters":["pii"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"scopes":["read"]`)
+	assert.Contains(t, w.Body.String(), `"limits":{"requestsPerMinute":60}`)
+	assert.Contains(t, w.Body.String(), `"filters":["pii"]`)
+
+	assert.Equal(t, http.StatusOK, do(router, "DELETE", "/api/keys/"+id, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(router, "GET", "/api/keys/"+id, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(router, "DELETE", "/api/keys/"+id, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(router, "PUT", "/api/keys/"+id, `{"scopes":["read"]}`).Code)
+}
+
+func TestHandler_CreateKeyValidation(t *testing.T) {
+	router, _ := newTestRouter(t)
+
+	for name, body := range map[string]string{
+		"No scopes":      `{"name":"ci"}`,
+		"Empty scopes":   `{"scopes":[]}`,
+		"Unknown scope":  `{"scopes":["root"]}`,
+		"Expired":        `{"scopes":["read"],"expiresAt":"2020-01-01T00:00:00Z"}`,
+		"Empty model":    `{"scopes":["inference"],"allowedModels":[""]}`,
+		"Negative limit": `{"scopes":["inference"],"limits":{"tokensPerDay":-1}}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, http.StatusBadRequest, do(router, "POST", "/api/keys", body).Code)
+		})
+	}
+}
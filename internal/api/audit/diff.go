@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Diff operations
+const (
+	DiffEqual   = "equal"
+	DiffReplace = "replace"
+	DiffDelete  = "delete"
+	DiffInsert  = "insert"
+)
+
+// DiffLine is one row of a side-by-side diff. Left is the original line and
+// Right the replayed one; the side without a line is omitted.
+type DiffLine struct {
+	Op    string  `json:"op"`
+	Left  *string `json:"left,omitempty"`
+	Right *string `json:"right,omitempty"`
+}
+
+// Diff compares two texts line by line. Deleted and inserted lines between
+// the same pair of equal lines are paired up as replacements.
+func Diff(left, right string) []DiffLine {
+	a := splitLines(left)
+	b := splitLines(right)
+
+	// lcs[i][j] 为 a[i:] 与 b[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	lines := make([]DiffLine, 0, max(len(a), len(b)))
+	var deleted, inserted []string
+	flush := func() {
+		for k := 0; k < len(deleted) || k < len(inserted); k++ {
+			switch {
+			case k < len(deleted) && k < len(inserted):
+				lines = append(lines, DiffLine{Op: DiffReplace, Left: &deleted[k], Right: &inserted[k]})
+			case k < len(deleted):
+				lines = append(lines, DiffLine{Op: DiffDelete, Left: &deleted[k]})
+			default:
+				lines = append(lines, DiffLine{Op: DiffInsert, Right: &inserted[k]})
+			}
+		}
+		deleted, inserted = nil, nil
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			lines = append(lines, DiffLine{Op: DiffEqual, Left: &a[i], Right: &b[j]})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			deleted = append(deleted, a[i])
+			i++
+		default:
+			inserted = append(inserted, b[j])
+			j++
+		}
+	}
+	flush()
+	return lines
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// ExtractOutput returns the generated text of a recorded response. OpenAI,
+// Anthropic and Ollama responses are understood, streamed or not; other
+// bodies, such as errors and embeddings, are returned unchanged.
+func ExtractOutput(body string) string {
+	if text, ok := outputText([]byte(body)); ok {
+		return text
+	}
+
+	// 流式响应：SSE 或 NDJSON，逐块拼接
+	var out strings.Builder
+	found := false
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if data, ok := strings.CutPrefix(line, "data:"); ok {
+			line = strings.TrimSpace(data)
+		}
+		if line == "" || line == "[DONE]" {
+			continue
+		}
+		if text, ok := outputText([]byte(line)); ok {
+			out.WriteString(text)
+			found = true
+		}
+	}
+	if found {
+		return out.String()
+	}
+	return body
+}
+
+// outputChunk covers the text fields of the supported response formats
+type outputChunk struct {
+	// OpenAI
+	Choices []struct {
+		Text    string `json:"text"`
+		Message *struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		Delta *struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	} `json:"choices"`
+	// Anthropic
+	Content json.RawMessage `json:"content"`
+	Delta   *struct {
+		Text string `json:"text"`
+	} `json:"delta"`
+	// Ollama
+	Message *struct {
+		Content string `json:"content"`
+	} `json:"message"`
+	Response *string `json:"response"`
+}
+
+// outputText returns the text of one response or stream chunk, and whether
+// the JSON was a recognised response
+func outputText(data []byte) (string, bool) {
+	var chunk outputChunk
+	if err := json.Unmarshal(data, &chunk); err != nil {
+		return "", false
+	}
+
+	switch {
+	case chunk.Choices != nil:
+		var out strings.Builder
+		if len(chunk.Choices) > 0 {
+			// 多个候选回复时只比较第一个
+			choice := chunk.Choices[0]
+			out.WriteString(choice.Text)
+			if choice.Message != nil {
+				out.WriteString(choice.Message.Content)
+			}
+			if choice.Delta != nil {
+				out.WriteString(choice.Delta.Content)
+			}
+		}
+		return out.String(), true
+	case chunk.Message != nil:
+		return chunk.Message.Content, true
+	case chunk.Response != nil:
+		return *chunk.Response, true
+	case chunk.Delta != nil:
+		return chunk.Delta.Text, true
+	case len(chunk.Content) > 0:
+		var blocks []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(chunk.Content, &blocks); err != nil {
+			return "", false
+		}
+		var out strings.Builder
+		for _, block := range blocks {
+			if block.Type == "text" {
+				out.WriteString(block.Text)
+			}
+		}
+		return out.String(), true
+	}
+	return "", false
+}
@@ -0,0 +1,258 @@
+// Package audit provides API handlers for the request audit log
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/api"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
+)
+
+// dateLayout 查询参数允许只写日期
+const dateLayout = "2006-01-02"
+
+// Handler handles audit API requests
+type Handler struct {
+	store  storage.Store
+	engine http.Handler
+}
+
+// NewHandler creates a new audit handler. Replayed requests are served by
+// engine, so they pass through the same routing as client requests.
+func NewHandler(store storage.Store, engine http.Handler) *Handler {
+	return &Handler{store: store, engine: engine}
+}
+
+// ListRecords returns audit records, newest first, without their bodies.
+//
+// Query parameters:
+//   - model, api_key, node: filters
+//   - from, to: RFC 3339 timestamps or dates (to is exclusive)
+//   - limit (default 100), offset
+func (h *Handler) ListRecords(c *gin.Context) {
+	query := &storage.AuditQuery{
+		ModelID: c.Query("model"),
+		APIKey:  c.Query("api_key"),
+		NodeID:  c.Query("node"),
+	}
+
+	var err error
+	if query.From, err = parseTime(c.Query("from")); err != nil {
+		api.BadRequest(c, fmt.Sprintf("invalid from: %v", err))
+		return
+	}
+	if query.To, err = parseTime(c.Query("to")); err != nil {
+		api.BadRequest(c, fmt.Sprintf("invalid to: %v", err))
+		return
+	}
+	if query.Limit, err = parseCount(c.Query("limit")); err != nil {
+		api.BadRequest(c, fmt.Sprintf("invalid limit: %v", err))
+		return
+	}
+	if query.Offset, err = parseCount(c.Query("offset")); err != nil {
+		api.BadRequest(c, fmt.Sprintf("invalid offset: %v", err))
+		return
+	}
+
+	records, err := h.store.QueryAudit(c.Request.Context(), query)
+	if err != nil {
+		api.InternalError(c, err)
+		return
+	}
+	// 列表不返回请求和响应内容，通过详情接口获取
+	for _, record := range records {
+		record.RequestBody = ""
+		record.ResponseBody = ""
+	}
+
+	api.Success(c, gin.H{"records": records})
+}
+
+// GetRecord returns one audit record including the stored bodies
+func (h *Handler) GetRecord(c *gin.Context) {
+	record, ok := h.getRecord(c)
+	if !ok {
+		return
+	}
+	api.Success(c, record)
+}
+
+// ReplayRequest is the optional body of a replay request
+type ReplayRequest struct {
+	Model string `json:"model"` // 重放使用的模型，空 = 原模型
+}
+
+// ReplayResult summarises one side of a replay comparison
+type ReplayResult struct {
+	Model       string `json:"model"`
+	Status      int    `json:"status"`
+	LatencyMs   int64  `json:"latencyMs"`
+	TotalTokens int    `json:"totalTokens"`
+	Output      string `json:"output"`
+}
+
+// ReplayResponse compares the recorded response with the replayed one
+type ReplayResponse struct {
+	RecordID  int64        `json:"recordId"`
+	Original  ReplayResult `json:"original"`
+	Replay    ReplayResult `json:"replay"`
+	Identical bool         `json:"identical"`
+	Diff      []DiffLine   `json:"diff"`
+}
+
+// ReplayRecord resends a recorded request, optionally to another model, and
+// returns the two outputs with a line diff. The replay is never streamed.
+func (h *Handler) ReplayRecord(c *gin.Context) {
+	record, ok := h.getRecord(c)
+	if !ok {
+		return
+	}
+
+	var req ReplayRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			api.ValidationError(c, err)
+			return
+		}
+	}
+
+	payload, err := replayPayload(record.RequestBody, req.Model)
+	if err != nil {
+		api.BadRequest(c, err.Error())
+		return
+	}
+
+	replay := httptest.NewRecorder()
+	report := &usage.Report{}
+	replayReq, err := http.NewRequestWithContext(usage.WithReport(c.Request.Context(), report),
+		record.Method, record.Path, bytes.NewReader(payload))
+	if err != nil {
+		api.InternalError(c, err)
+		return
+	}
+	replayReq.Header.Set("Content-Type", "application/json")
+	// 使用调用者的凭据转发，重放不会获得超出调用者的权限
+	for _, header := range []string{"Authorization", "x-api-key"} {
+		if value := c.GetHeader(header); value != "" {
+			replayReq.Header.Set(header, value)
+		}
+	}
+
+	start := time.Now()
+	h.engine.ServeHTTP(replay, replayReq)
+	latency := time.Since(start).Milliseconds()
+
+	replayModel, replayUsage := report.Result()
+	if replayModel == "" {
+		replayModel = requestModel(payload)
+	}
+	if replayUsage.IsZero() {
+		replayUsage, _ = usage.Parse(replay.Body.Bytes())
+	}
+
+	original := ReplayResult{
+		Model:       record.ModelID,
+		Status:      record.Status,
+		LatencyMs:   record.LatencyMs,
+		TotalTokens: record.TotalTokens,
+		Output:      ExtractOutput(record.ResponseBody),
+	}
+	result := ReplayResult{
+		Model:       replayModel,
+		Status:      replay.Code,
+		LatencyMs:   latency,
+		TotalTokens: replayUsage.TotalTokens,
+		Output:      ExtractOutput(replay.Body.String()),
+	}
+
+	api.Success(c, ReplayResponse{
+		RecordID:  record.ID,
+		Original:  original,
+		Replay:    result,
+		Identical: original.Output == result.Output,
+		Diff:      Diff(original.Output, result.Output),
+	})
+}
+
+// getRecord loads the record named by the :id parameter, sending the error
+// response when it cannot
+func (h *Handler) getRecord(c *gin.Context) (*storage.AuditRecord, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		api.BadRequest(c, "invalid audit record id")
+		return nil, false
+	}
+	record, err := h.store.GetAudit(c.Request.Context(), id)
+	if errors.Is(err, storage.ErrAuditRecordNotFound) {
+		api.NotFound(c, "Audit record")
+		return nil, false
+	}
+	if err != nil {
+		api.InternalError(c, err)
+		return nil, false
+	}
+	return record, true
+}
+
+// replayPayload rebuilds a recorded request body for replay: the model is
+// replaced when given and streaming is turned off
+func replayPayload(body, model string) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(body)))
+	decoder.UseNumber()
+	var request map[string]interface{}
+	if err := decoder.Decode(&request); err != nil {
+		return nil, fmt.Errorf("recorded request body is incomplete and cannot be replayed")
+	}
+	if model != "" {
+		request["model"] = model
+	}
+	// Ollama 默认流式，显式关闭
+	request["stream"] = false
+	delete(request, "stream_options")
+	return json.Marshal(request)
+}
+
+// requestModel returns the model named in a request body
+func requestModel(body []byte) string {
+	var req struct {
+		Model string `json:"model"`
+	}
+	json.Unmarshal(body, &req)
+	return req.Model
+}
+
+// parseTime 解析 RFC 3339 时间或 UTC 日期，空值表示不限制
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(dateLayout, value)
+}
+
+// parseCount 解析非负整数，空值为 0
+func parseCount(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("must not be negative")
+	}
+	return n, nil
+}
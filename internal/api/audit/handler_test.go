@@ -0,0 +1,210 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestHandler 创建审计 handler，重放请求由回显模型名的上游处理
+func newTestHandler(t *testing.T) (*gin.Engine, storage.Store) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	store, err := storage.NewMemoryStore()
+	require.NoError(t, err)
+
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", func(c *gin.Context) {
+		var req struct {
+			Model         string      `json:"model"`
+			Stream        bool        `json:"stream"`
+			StreamOptions interface{} `json:"stream_options"`
+		}
+		require.NoError(t, c.ShouldBindJSON(&req))
+		assert.False(t, req.Stream)
+		assert.Nil(t, req.StreamOptions)
+		c.JSON(http.StatusOK, gin.H{
+			"choices": []gin.H{{"message": gin.H{"role": "assistant", "content": "Hello\nfrom " + req.Model}}},
+			"usage":   gin.H{"prompt_tokens": 4, "completion_tokens": 3, "total_tokens": 7},
+		})
+	})
+
+	h := NewHandler(store, engine)
+	engine.GET("/api/audit", h.ListRecords)
+	engine.GET("/api/audit/:id", h.GetRecord)
+	engine.POST("/api/audit/:id/replay", h.ReplayRecord)
+	return engine, store
+}
+
+func TestListRecords(t *testing.T) {
+	engine, store := newTestHandler(t)
+	ctx := context.Background()
+	day := time.Date(2026, 10, 15, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, store.RecordAudit(ctx, &storage.AuditRecord{ModelID: "qwen", APIKey: "key-a", RequestBody: "{}", CreatedAt: day}))
+	require.NoError(t, store.RecordAudit(ctx, &storage.AuditRecord{ModelID: "llama", APIKey: "key-a", CreatedAt: day.AddDate(0, 0, 1)}))
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantModels []string
+	}{
+		{name: "All", query: "", wantStatus: http.StatusOK, wantModels: []string{"llama", "qwen"}},
+		{name: "By model", query: "?model=qwen&api_key=key-a", wantStatus: http.StatusOK, wantModels: []string{"qwen"}},
+		{name: "By time", query: "?from=2026-10-16", wantStatus: http.StatusOK, wantModels: []string{"llama"}},
+		{name: "Paged", query: "?limit=1&offset=1", wantStatus: http.StatusOK, wantModels: []string{"qwen"}},
+		{name: "Invalid time", query: "?to=yesterday", wantStatus: http.StatusBadRequest},
+		{name: "Invalid limit", query: "?limit=-1", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			engine.ServeHTTP(w, httptest.NewRequest("GET", "/api/audit"+tt.query, nil))
+			require.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Data struct {
+					Records []map[string]interface{} `json:"records"`
+				} `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			var models []string
+			for _, record := range resp.Data.Records {
+				models = append(models, record["modelId"].(string))
+				assert.NotContains(t, record, "requestBody")
+			}
+			assert.Equal(t, tt.wantModels, models)
+		})
+	}
+}
+
+func TestGetRecord(t *testing.T) {
+	engine, store := newTestHandler(t)
+	record := &storage.AuditRecord{ModelID: "qwen", RequestBody: `{"model":"qwen"}`}
+	require.NoError(t, store.RecordAudit(context.Background(), record))
+
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/api/audit/1", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"requestBody":"{\"model\":\"qwen\"}"`)
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/api/audit/42", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest("GET", "/api/audit/abc", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestReplayRecord(t *testing.T) {
+	engine, store := newTestHandler(t)
+	ctx := context.Background()
+	require.NoError(t, store.RecordAudit(ctx, &storage.AuditRecord{
+		ModelID:     "qwen",
+		Method:      "POST",
+		Path:        "/v1/chat/completions",
+		Status:      http.StatusOK,
+		Stream:      true,
+		RequestBody: `{"model":"qwen","stream":true,"stream_options":{"include_usage":true},"messages":[]}`,
+		ResponseBody: "data: {\"choices\":[{\"delta\":{\"content\":\"Hello\\n\"}}]}\n\n" +
+			"data: {\"choices\":[{\"delta\":{\"content\":\"from qwen\"}}]}\n\ndata: [DONE]\n\n",
+	}))
+	require.NoError(t, store.RecordAudit(ctx, &storage.AuditRecord{
+		Method:      "POST",
+		Path:        "/v1/chat/completions",
+		RequestBody: `{"model":"qwen","messa`,
+		Truncated:   true,
+	}))
+
+	replay := func(id, body string) (*httptest.ResponseRecorder, ReplayResponse) {
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, httptest.NewRequest("POST", "/api/audit/"+id+"/replay", strings.NewReader(body)))
+		var resp struct {
+			Data ReplayResponse `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp.Data
+	}
+
+	t.Run("Same model", func(t *testing.T) {
+		w, resp := replay("1", "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.True(t, resp.Identical)
+		assert.Equal(t, "Hello\nfrom qwen", resp.Original.Output)
+		assert.Equal(t, "qwen", resp.Replay.Model)
+		assert.Equal(t, 7, resp.Replay.TotalTokens)
+		require.Len(t, resp.Diff, 2)
+		assert.Equal(t, DiffEqual, resp.Diff[1].Op)
+	})
+
+	t.Run("Other model", func(t *testing.T) {
+		w, resp := replay("1", `{"model":"llama"}`)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.False(t, resp.Identical)
+		assert.Equal(t, "llama", resp.Replay.Model)
+		assert.Equal(t, "Hello\nfrom llama", resp.Replay.Output)
+		require.Len(t, resp.Diff, 2)
+		assert.Equal(t, DiffReplace, resp.Diff[1].Op)
+		assert.Equal(t, "from qwen", *resp.Diff[1].Left)
+		assert.Equal(t, "from llama", *resp.Diff[1].Right)
+	})
+
+	t.Run("Truncated request", func(t *testing.T) {
+		w, _ := replay("2", "")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestDiff(t *testing.T) {
+	text := func(s string) *string { return &s }
+	assert.Equal(t, []DiffLine{
+		{Op: DiffEqual, Left: text("a"), Right: text("a")},
+		{Op: DiffReplace, Left: text("b"), Right: text("B")},
+		{Op: DiffDelete, Left: text("c")},
+		{Op: DiffEqual, Left: text("d"), Right: text("d")},
+		{Op: DiffInsert, Right: text("e")},
+	}, Diff("a\nb\nc\nd", "a\nB\nd\ne\n"))
+	assert.Empty(t, Diff("", ""))
+}
+
+func TestExtractOutput(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{name: "OpenAI", body: `{"choices":[{"message":{"content":"Hi"}}]}`, want: "Hi"},
+		{name: "OpenAI completion", body: `{"choices":[{"text":"Hi"}]}`, want: "Hi"},
+		{name: "Anthropic", body: `{"content":[{"type":"thinking","thinking":"hmm"},{"type":"text","text":"Hi"}]}`, want: "Hi"},
+		{
+			name: "Anthropic stream",
+			body: "event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"content\":[]}}\n\n" +
+				"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"H\"}}\n\n" +
+				"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"i\"}}\n\n",
+			want: "Hi",
+		},
+		{name: "Ollama chat stream", body: "{\"message\":{\"content\":\"H\"}}\n{\"message\":{\"content\":\"i\"},\"done\":true}\n", want: "Hi"},
+		{name: "Ollama generate", body: `{"response":"Hi","done":true}`, want: "Hi"},
+		{name: "Error", body: `{"error":{"message":"model not found"}}`, want: `{"error":{"message":"model not found"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ExtractOutput(tt.body))
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Package certs provides the API handlers client nodes use to obtain and
+// renew their cluster certificates
+package certs
+
+import (
+	"crypto/subtle"
+	"net"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/api"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/pki"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/types"
+)
+
+// Handler issues node certificates from the cluster CA
+type Handler struct {
+	authority *pki.Authority
+	joinToken string
+	taken     func(nodeID string) bool
+}
+
+// NewHandler creates a certificate handler. An empty join token disables
+// joining; nodes that already hold a certificate can still renew it. taken
+// reports node IDs that a joining node may not claim, such as the master's
+// own and those of registered nodes; nil allows any.
+func NewHandler(authority *pki.Authority, joinToken string, taken func(nodeID string) bool) *Handler {
+	return &Handler{authority: authority, joinToken: joinToken, taken: taken}
+}
+
+// GetCA returns the CA certificate and its fingerprint. Nodes compare the
+// fingerprint with the one they were configured with before joining.
+func (h *Handler) GetCA(c *gin.Context) {
+	api.Success(c, gin.H{
+		"ca":          string(h.authority.CertPEM()),
+		"fingerprint": h.authority.Fingerprint(),
+	})
+}
+
+// Join signs the first certificate of a node that presents the join token
+func (h *Handler) Join(c *gin.Context) {
+	var req pki.JoinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "无效的请求: "+err.Error())
+		return
+	}
+	if h.joinToken == "" || subtle.ConstantTimeCompare([]byte(req.Token), []byte(h.joinToken)) != 1 {
+		logger.Warnf("节点 %s 加入集群被拒绝: 加入令牌无效", req.NodeID)
+		api.Forbidden(c, "invalid join token")
+		return
+	}
+	// 加入令牌不能用于冒充已有节点或主节点
+	if req.NodeID != "" && h.taken != nil && h.taken(req.NodeID) {
+		logger.Warnf("节点 %s 加入集群被拒绝: 节点 ID 已被使用", req.NodeID)
+		api.Error(c, types.ErrConflict, "node ID "+req.NodeID+" is already in use")
+		return
+	}
+	h.issue(c, &req, "节点已加入集群")
+}
+
+// Renew signs a new certificate for a node authenticated by its current one
+func (h *Handler) Renew(c *gin.Context) {
+	nodeID, ok := pki.PeerNodeID(c.Request)
+	if !ok {
+		api.Unauthorized(c, "client certificate required")
+		return
+	}
+
+	var req pki.JoinRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "无效的请求: "+err.Error())
+		return
+	}
+	if req.NodeID != nodeID {
+		api.Forbidden(c, "certificate was issued to node "+nodeID)
+		return
+	}
+	h.issue(c, &req, "节点证书已续期")
+}
+
+// issue 签发证书并返回证书和 CA
+func (h *Handler) issue(c *gin.Context, req *pki.JoinRequest, message string) {
+	if req.NodeID == "" {
+		api.BadRequest(c, "nodeId is required")
+		return
+	}
+	// 证书只包含请求来源地址，不采用证书请求中的名称
+	peer, _, _ := net.SplitHostPort(c.Request.RemoteAddr)
+	certPEM, err := h.authority.SignCSR([]byte(req.CSR), req.NodeID, net.ParseIP(peer))
+	if err != nil {
+		api.BadRequest(c, err.Error())
+		return
+	}
+	cert, err := pki.ParseCertificate(certPEM)
+	if err != nil {
+		api.InternalError(c, err)
+		return
+	}
+	logger.Infof("%s: 节点=%s, 有效期至 %s", message, req.NodeID, cert.NotAfter.Format(time.RFC3339))
+
+	api.Success(c, pki.CertificateResponse{
+		Certificate: string(certPEM),
+		CA:          string(h.authority.CertPEM()),
+		ExpiresAt:   cert.NotAfter,
+	})
+}
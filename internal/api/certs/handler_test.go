@@ -0,0 +1,131 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/pki"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRouter(t *testing.T, joinToken string) (*gin.Engine, *pki.Authority) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	dir := t.TempDir()
+	authority, err := pki.LoadOrCreateAuthority(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"), 0)
+	require.NoError(t, err)
+
+	h := NewHandler(authority, joinToken, func(nodeID string) bool { return nodeID == "master" })
+	router := gin.New()
+	router.GET("/api/cluster/ca", h.GetCA)
+	router.POST("/api/cluster/join", h.Join)
+	router.POST("/api/cluster/renew", h.Renew)
+	return router, authority
+}
+
+// joinBody 生成节点的证书请求
+func joinBody(t *testing.T, nodeID, token string) string {
+	t.Helper()
+	csrPEM, _, err := pki.NewCSR(nodeID, []string{"127.0.0.1"})
+	require.NoError(t, err)
+	body, err := json.Marshal(pki.JoinRequest{NodeID: nodeID, Token: token, CSR: string(csrPEM)})
+	require.NoError(t, err)
+	return string(body)
+}
+
+// withPeer 模拟已通过 TLS 校验的客户端证书
+func withPeer(req *http.Request, cert *x509.Certificate) *http.Request {
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return req
+}
+
+func TestHandler_GetCA(t *testing.T) {
+	router, authority := newTestRouter(t, "secret")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/api/cluster/ca", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Data struct {
+			CA          string `json:"ca"`
+			Fingerprint string `json:"fingerprint"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, string(authority.CertPEM()), resp.Data.CA)
+	assert.Equal(t, authority.Fingerprint(), resp.Data.Fingerprint)
+}
+
+func TestHandler_Join(t *testing.T) {
+	router, authority := newTestRouter(t, "secret")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/cluster/join", strings.NewReader(joinBody(t, "node-a", "wrong"))))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/cluster/join", strings.NewReader(joinBody(t, "node-a", "secret"))))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp struct {
+		Data pki.CertificateResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	cert, err := pki.ParseCertificate([]byte(resp.Data.Certificate))
+	require.NoError(t, err)
+	assert.Equal(t, "node-a", cert.Subject.CommonName)
+	// 证书只包含请求来源地址
+	assert.Empty(t, cert.DNSNames)
+	require.Len(t, cert.IPAddresses, 1)
+	assert.Equal(t, "192.0.2.1", cert.IPAddresses[0].String())
+	assert.Equal(t, string(authority.CertPEM()), resp.Data.CA)
+	assert.Equal(t, cert.NotAfter.Unix(), resp.Data.ExpiresAt.Unix())
+}
+
+func TestHandler_JoinRejectsTakenNodeID(t *testing.T) {
+	router, _ := newTestRouter(t, "secret")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/cluster/join", strings.NewReader(joinBody(t, "master", "secret"))))
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestHandler_JoinDisabledWithoutToken(t *testing.T) {
+	router, _ := newTestRouter(t, "")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/cluster/join", strings.NewReader(joinBody(t, "node-a", ""))))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestHandler_Renew(t *testing.T) {
+	router, authority := newTestRouter(t, "")
+	current, err := authority.Issue("node-a", nil)
+	require.NoError(t, err)
+
+	// 没有客户端证书
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/api/cluster/renew", strings.NewReader(joinBody(t, "node-a", ""))))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// 不能为其他节点续期
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/cluster/renew", strings.NewReader(joinBody(t, "node-b", "")))
+	router.ServeHTTP(w, withPeer(req, current.Leaf))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("POST", "/api/cluster/renew", strings.NewReader(joinBody(t, "node-a", "")))
+	router.ServeHTTP(w, withPeer(req, current.Leaf))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
@@ -2,68 +2,170 @@ package compatibility
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/api/lmstudio"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/api/ollama"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/api/openai"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/audit"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/auth"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/cluster/routing"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/ratelimit"
 )
 
 type ServerManager struct {
-	ollamaServer   *http.Server
-	lmstudioServer *http.Server
-	modelMgr       *model.Manager
-	mu             sync.RWMutex
+	ollamaServer    *http.Server
+	lmstudioServer  *http.Server
+	modelMgr        *model.Manager
+	ollamaHandler   *ollama.Handler
+	openaiHandler   *openai.Handler
+	lmstudioHandler *lmstudio.Handler
+	tlsConfig       *tls.Config // 非空时以 HTTPS 监听
+	authn           *auth.Authenticator
+	limiter         *ratelimit.Limiter
+	auditRec        *audit.Recorder
+	clusterRouting  gin.HandlerFunc // 集群路由中间件，未设置时只在本地处理
+	mu              sync.RWMutex
 }
 
-func NewServerManager(modelMgr *model.Manager) *ServerManager {
+// NewServerManager creates a server manager. The compatibility servers share
+// the main server's API handlers so usage recording and the model repository
+// settings apply to them too.
+func NewServerManager(modelMgr *model.Manager, ollamaHandler *ollama.Handler, openaiHandler *openai.Handler, lmstudioHandler *lmstudio.Handler) *ServerManager {
 	return &ServerManager{
-		modelMgr: modelMgr,
+		modelMgr:        modelMgr,
+		ollamaHandler:   ollamaHandler,
+		openaiHandler:   openaiHandler,
+		lmstudioHandler: lmstudioHandler,
 	}
 }
 
-// StartOllamaServer starts the Ollama compatibility server on the specified port
-func (sm *ServerManager) StartOllamaServer(port int) error {
+// SetTLSConfig makes servers started afterwards serve HTTPS with cfg
+func (sm *ServerManager) SetTLSConfig(cfg *tls.Config) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
+	sm.tlsConfig = cfg
+}
 
-	if sm.ollamaServer != nil {
-		return fmt.Errorf("Ollama server already running")
+// SetAccessControl makes servers started afterwards check API keys, apply
+// rate limits and record audit logs the same way as the main server
+func (sm *ServerManager) SetAccessControl(authn *auth.Authenticator, limiter *ratelimit.Limiter, auditRec *audit.Recorder) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.authn = authn
+	sm.limiter = limiter
+	sm.auditRec = auditRec
+}
+
+// SetClusterRouting makes servers started afterwards forward inference
+// requests for models served by other cluster nodes with handler, the main
+// server's routing middleware
+func (sm *ServerManager) SetClusterRouting(handler gin.HandlerFunc) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.clusterRouting = handler
+}
+
+// require 返回要求密钥具有 scope 的中间件，未设置认证时为空
+func (sm *ServerManager) require(scope string) []gin.HandlerFunc {
+	if sm.authn == nil {
+		return nil
+	}
+	return []gin.HandlerFunc{sm.authn.Require(scope)}
+}
+
+// inference 返回推理接口的中间件：密钥认证、限流和审计，与主服务器一致
+func (sm *ServerManager) inference() []gin.HandlerFunc {
+	return append(sm.require(auth.ScopeInference), sm.limiter.Middleware(), sm.auditRec.Middleware())
+}
+
+// routed 返回推理接口的中间件并在最后加上集群路由。请求被转发到节点主端口上的同名接口，
+// 只能用于主服务器也提供的接口
+func (sm *ServerManager) routed() []gin.HandlerFunc {
+	handlers := sm.inference()
+	if sm.clusterRouting != nil {
+		handlers = append(handlers, sm.clusterRouting)
+	}
+	return handlers
+}
+
+// listen 启动监听，配置了 TLS 时使用 HTTPS
+func listen(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		return srv.ListenAndServeTLS("", "")
 	}
+	return srv.ListenAndServe()
+}
 
+// ollamaEngine builds the routes of the Ollama compatibility server
+func (sm *ServerManager) ollamaEngine() *gin.Engine {
 	// Create a minimal Gin engine
 	engine := gin.New()
-	engine.Use(gin.Recovery())
+	engine.Use(gin.Recovery(), routing.TrustMaster())
 
-	ollamaHandler := ollama.NewHandler(sm.modelMgr)
-	api := engine.Group("/api")
+	ollamaHandler := sm.ollamaHandler
+	api := engine.Group("/api", sm.routed()...)
 	{
-		api.GET("/tags", func(c *gin.Context) {
-			ollamaHandler.HandleTags(c)
-		})
-		api.POST("/chat", func(c *gin.Context) {
-			ollamaHandler.HandleChat(c)
-		})
+		api.POST("/generate", ollamaHandler.HandleGenerate)
+		api.POST("/chat", ollamaHandler.HandleChat)
+		api.POST("/embed", ollamaHandler.HandleEmbed)
+	}
+	models := engine.Group("/api", sm.require(auth.ScopeInference)...)
+	{
+		models.GET("/tags", ollamaHandler.HandleTags)
+		models.GET("/ps", ollamaHandler.HandlePs)
+		models.GET("/version", ollamaHandler.HandleVersion)
+		models.POST("/show", ollamaHandler.HandleShow)
+	}
+	// 下载和删除模型文件需要 admin
+	admin := engine.Group("/api", sm.require(auth.ScopeAdmin)...)
+	{
+		admin.POST("/pull", ollamaHandler.HandlePull)
+		admin.DELETE("/delete", ollamaHandler.HandleDelete)
+	}
+	// Ollama 客户端用 HEAD / 或 GET / 检测服务是否可用
+	engine.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, "Ollama is running")
+	})
+	engine.HEAD("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return engine
+}
+
+// StartOllamaServer starts the Ollama compatibility server on the specified port
+func (sm *ServerManager) StartOllamaServer(port int) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.ollamaServer != nil {
+		return fmt.Errorf("Ollama server already running")
 	}
 
+	engine := sm.ollamaEngine()
+
 	// Create HTTP server
+	// 流式生成和模型拉取可能持续很久，不设置写超时
 	addr := fmt.Sprintf(":%d", port)
 	sm.ollamaServer = &http.Server{
-		Addr:         addr,
-		Handler:      engine,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		Addr:        addr,
+		Handler:     engine,
+		ReadTimeout: 30 * time.Second,
+		TLSConfig:   sm.tlsConfig,
 	}
 
 	// Start server in background
+	srv := sm.ollamaServer
 	go func() {
 		logger.Infof("启动 Ollama 兼容服务器，监听 %s", addr)
-		if err := sm.ollamaServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := listen(srv); err != nil && err != http.ErrServerClosed {
 			logger.Errorf("Ollama 服务器错误: %v", err)
 		}
 		logger.Info("Ollama 服务器已停止")
@@ -98,22 +200,15 @@ func (sm *ServerManager) StopOllamaServer() error {
 	return nil
 }
 
-// StartLMStudioServer starts the LM Studio compatibility server on the specified port
-func (sm *ServerManager) StartLMStudioServer(port int) error {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
-
-	if sm.lmstudioServer != nil {
-		return fmt.Errorf("LM Studio server already running")
-	}
-
+// lmstudioEngine builds the routes of the LM Studio compatibility server
+func (sm *ServerManager) lmstudioEngine() *gin.Engine {
 	// Create a minimal Gin engine
 	engine := gin.New()
-	engine.Use(gin.Recovery())
+	engine.Use(gin.Recovery(), routing.TrustMaster())
 
 	// Setup OpenAI compatible routes for LM Studio
-	openaiHandler := openai.NewHandler(sm.modelMgr)
-	v1 := engine.Group("/v1")
+	openaiHandler := sm.openaiHandler
+	v1 := engine.Group("/v1", sm.routed()...)
 	{
 		v1.GET("/models", func(c *gin.Context) {
 			openaiHandler.HandleModels(c)
@@ -124,21 +219,51 @@ func (sm *ServerManager) StartLMStudioServer(port int) error {
 		v1.POST("/completions", func(c *gin.Context) {
 			openaiHandler.HandleCompletions(c)
 		})
+		v1.POST("/embeddings", func(c *gin.Context) {
+			openaiHandler.HandleEmbeddings(c)
+		})
+	}
+
+	// LM Studio 原生 REST API，响应附带加载状态和生成统计。
+	// 节点主端口没有该接口，不经过集群路由
+	lmstudioHandler := sm.lmstudioHandler
+	v0 := engine.Group("/api/v0", sm.inference()...)
+	{
+		v0.GET("/models", lmstudioHandler.HandleModels)
+		v0.GET("/models/*model", lmstudioHandler.HandleModel)
+		v0.POST("/chat/completions", lmstudioHandler.HandleChatCompletions)
+		v0.POST("/completions", lmstudioHandler.HandleCompletions)
+		v0.POST("/embeddings", lmstudioHandler.HandleEmbeddings)
+	}
+	return engine
+}
+
+// StartLMStudioServer starts the LM Studio compatibility server on the specified port
+func (sm *ServerManager) StartLMStudioServer(port int) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.lmstudioServer != nil {
+		return fmt.Errorf("LM Studio server already running")
 	}
 
+	engine := sm.lmstudioEngine()
+
 	// Create HTTP server
+	// 流式生成可能持续很久，不设置写超时
 	addr := fmt.Sprintf(":%d", port)
 	sm.lmstudioServer = &http.Server{
-		Addr:         addr,
-		Handler:      engine,
-		ReadTimeout:  30 * time.Second,
-		WriteTimeout: 30 * time.Second,
+		Addr:        addr,
+		Handler:     engine,
+		ReadTimeout: 30 * time.Second,
+		TLSConfig:   sm.tlsConfig,
 	}
 
 	// Start server in background
+	srv := sm.lmstudioServer
 	go func() {
 		logger.Infof("启动 LM Studio 兼容服务器，监听 %s", addr)
-		if err := sm.lmstudioServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := listen(srv); err != nil && err != http.ErrServerClosed {
 			logger.Errorf("LM Studio 服务器错误: %v", err)
 		}
 		logger.Info("LM Studio 服务器已停止")
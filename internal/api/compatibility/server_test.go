@@ -0,0 +1,107 @@
+package compatibility
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/api/lmstudio"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/api/ollama"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/api/openai"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/auth"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/ratelimit"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompatibilityServersRequireKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store, err := storage.NewMemoryStore()
+	require.NoError(t, err)
+	cfg := config.DefaultConfig()
+	cfg.Security = config.SecurityConfig{APIKeyEnabled: true}
+	configMgr := config.NewManagerWithPath("standalone", filepath.Join(t.TempDir(), "server.config.yaml"))
+	require.NoError(t, configMgr.Save(cfg))
+
+	secret, key, err := auth.GenerateKey()
+	require.NoError(t, err)
+	key.Scopes = []string{auth.ScopeInference}
+	require.NoError(t, store.CreateAPIKey(context.Background(), key))
+
+	modelMgr := model.NewManager(cfg, configMgr, process.NewManager())
+	openaiHandler := openai.NewHandler(modelMgr)
+	sm := NewServerManager(modelMgr, ollama.NewHandler(modelMgr), openaiHandler, lmstudio.NewHandler(modelMgr, openaiHandler))
+	sm.SetAccessControl(auth.NewAuthenticator(store, configMgr), ratelimit.NewLimiter(store, configMgr), nil)
+
+	serve := func(engine *gin.Engine, method, path, bearer string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"model":"missing","messages":[{"role":"user","content":"hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("Ollama", func(t *testing.T) {
+		engine := sm.ollamaEngine()
+
+		assert.Equal(t, http.StatusUnauthorized, serve(engine, "POST", "/api/chat", ""))
+		assert.Equal(t, http.StatusUnauthorized, serve(engine, "GET", "/api/tags", ""))
+		assert.Equal(t, http.StatusUnauthorized, serve(engine, "DELETE", "/api/delete", ""))
+		// 推理密钥不能拉取或删除模型
+		assert.Equal(t, http.StatusForbidden, serve(engine, "POST", "/api/pull", secret))
+		assert.Equal(t, http.StatusForbidden, serve(engine, "DELETE", "/api/delete", secret))
+		assert.Equal(t, http.StatusNotFound, serve(engine, "POST", "/api/chat", secret))
+		// 服务探测不需要密钥
+		assert.Equal(t, http.StatusOK, serve(engine, "GET", "/", ""))
+	})
+
+	t.Run("LM Studio", func(t *testing.T) {
+		engine := sm.lmstudioEngine()
+
+		assert.Equal(t, http.StatusUnauthorized, serve(engine, "POST", "/v1/chat/completions", ""))
+		assert.Equal(t, http.StatusUnauthorized, serve(engine, "POST", "/api/v0/chat/completions", ""))
+		assert.Equal(t, http.StatusUnauthorized, serve(engine, "GET", "/api/v0/models", ""))
+		assert.Equal(t, http.StatusNotFound, serve(engine, "POST", "/api/v0/chat/completions", secret))
+	})
+}
+
+func TestCompatibilityServersClusterRouting(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	modelMgr := model.NewManager(config.DefaultConfig(), nil, process.NewManager())
+	openaiHandler := openai.NewHandler(modelMgr)
+	sm := NewServerManager(modelMgr, ollama.NewHandler(modelMgr), openaiHandler, lmstudio.NewHandler(modelMgr, openaiHandler))
+	sm.SetClusterRouting(func(c *gin.Context) {
+		c.String(http.StatusOK, "routed")
+		c.Abort()
+	})
+
+	serve := func(engine *gin.Engine, path string) string {
+		req := httptest.NewRequest("POST", path, strings.NewReader(`{"model":"remote","messages":[{"role":"user","content":"hi"}]}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Body.String()
+	}
+
+	// 推理请求与主服务器一样经过集群路由
+	ollamaEngine := sm.ollamaEngine()
+	assert.Equal(t, "routed", serve(ollamaEngine, "/api/chat"))
+	assert.Equal(t, "routed", serve(ollamaEngine, "/api/generate"))
+	lmstudioEngine := sm.lmstudioEngine()
+	assert.Equal(t, "routed", serve(lmstudioEngine, "/v1/chat/completions"))
+	// 原生 REST API 只在本地处理
+	assert.NotEqual(t, "routed", serve(lmstudioEngine, "/api/v0/chat/completions"))
+}
@@ -0,0 +1,354 @@
+package lmstudio
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/filter"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
+)
+
+// Stats are the generation statistics LM Studio adds to completion responses
+type Stats struct {
+	TokensPerSecond  float64 `json:"tokens_per_second"`
+	TimeToFirstToken float64 `json:"time_to_first_token"` // 秒
+	GenerationTime   float64 `json:"generation_time"`     // 秒
+	StopReason       string  `json:"stop_reason"`
+}
+
+// ModelInfo describes the model that served a completion
+type ModelInfo struct {
+	Arch          string `json:"arch"`
+	Quant         string `json:"quant"`
+	Format        string `json:"format"`
+	ContextLength int    `json:"context_length"`
+}
+
+// Runtime describes the inference engine that served a completion
+type Runtime struct {
+	Name             string   `json:"name"`
+	SupportedFormats []string `json:"supported_formats"`
+}
+
+// runtimeInfo is the same for every model: all instances run llama-server
+var runtimeInfo = Runtime{
+	Name:             "llama.cpp",
+	SupportedFormats: []string{"gguf"},
+}
+
+// upstreamTimings are the llama-server timings sent with the last chunk or
+// the full response
+type upstreamTimings struct {
+	PromptN            int     `json:"prompt_n"`
+	PromptMS           float64 `json:"prompt_ms"`
+	PredictedN         int     `json:"predicted_n"`
+	PredictedMS        float64 `json:"predicted_ms"`
+	PredictedPerSecond float64 `json:"predicted_per_second"`
+}
+
+// upstreamResult is the part of a llama-server response or chunk used to
+// build the stats
+type upstreamResult struct {
+	Choices []struct {
+		FinishReason *string `json:"finish_reason"`
+		Text         string  `json:"text"`
+		Delta        struct {
+			Content          string            `json:"content"`
+			ReasoningContent string            `json:"reasoning_content"`
+			ToolCalls        []json.RawMessage `json:"tool_calls"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Timings *upstreamTimings `json:"timings"`
+}
+
+// finishReason returns the first non-empty finish_reason of the choices
+func (r *upstreamResult) finishReason() string {
+	for _, choice := range r.Choices {
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			return *choice.FinishReason
+		}
+	}
+	return ""
+}
+
+// hasOutput reports whether a stream chunk carries generated tokens
+func (r *upstreamResult) hasOutput() bool {
+	for _, choice := range r.Choices {
+		if choice.Text != "" || choice.Delta.Content != "" || choice.Delta.ReasoningContent != "" || len(choice.Delta.ToolCalls) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleChatCompletions handles POST /api/v0/chat/completions
+func (h *Handler) HandleChatCompletions(c *gin.Context) {
+	h.handleCompletion(c, "/v1/chat/completions")
+}
+
+// HandleCompletions handles POST /api/v0/completions
+func (h *Handler) HandleCompletions(c *gin.Context) {
+	h.handleCompletion(c, "/v1/completions")
+}
+
+// handleCompletion forwards an OpenAI style request to llama-server and adds
+// LM Studio's stats, model_info and runtime fields to the response
+func (h *Handler) handleCompletion(c *gin.Context, path string) {
+	var body map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&body); err != nil {
+		h.sendError(c, http.StatusBadRequest, "invalid_request_error", err.Error(), "")
+		return
+	}
+
+	modelName, stream, err := requestModel(body)
+	if err != nil {
+		h.sendError(c, http.StatusBadRequest, "invalid_request_error", err.Error(), "")
+		return
+	}
+	if modelName == "" {
+		h.sendError(c, http.StatusBadRequest, "invalid_request_error", "model is required", "model")
+		return
+	}
+
+	// 请求过滤器在选择模型前运行，被拦截的请求不会触发模型加载
+	chain := h.filters.Chain(c, modelName)
+	if err := filterRequest(c.Request.Context(), chain, body); err != nil {
+		h.sendError(c, http.StatusBadRequest, filter.FinishReason, err.Error(), "")
+		return
+	}
+
+	actualModelID, err := h.modelMgr.Route(c.Request.Context(), modelName, routeHints(body), c.GetHeader(h.modelMgr.SessionHeader()))
+	if err != nil {
+		h.sendModelError(c, err)
+		return
+	}
+
+	if !h.checkGenerative(c, actualModelID, modelName) {
+		return
+	}
+
+	port, err := h.getModelPort(actualModelID)
+	if err != nil {
+		h.sendError(c, http.StatusInternalServerError, "server_error", err.Error(), "")
+		return
+	}
+
+	done, err := h.modelMgr.AcquireSlot(c.Request.Context(), actualModelID)
+	if err != nil {
+		h.sendModelError(c, err)
+		return
+	}
+	defer done()
+
+	body["model"], _ = json.Marshal(actualModelID)
+	payload, err := json.Marshal(body)
+	if err != nil {
+		h.sendError(c, http.StatusInternalServerError, "server_error", err.Error(), "")
+		return
+	}
+
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", port, path)
+	httpReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		h.sendError(c, http.StatusInternalServerError, "server_error", err.Error(), "")
+		return
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		h.sendError(c, http.StatusBadGateway, "model_error", err.Error(), "")
+		logger.Errorf("转发请求到 llama.cpp 失败: %v", err)
+		h.modelMgr.ReportUpstreamError(actualModelID, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	endpoint := "/api/v0" + strings.TrimPrefix(path, "/v1")
+	if stream && resp.StatusCode == http.StatusOK {
+		h.relayStream(c, actualModelID, endpoint, resp, start, chain)
+		return
+	}
+	h.relayResponse(c, actualModelID, endpoint, resp, start, chain)
+}
+
+// filterRequest runs the request filters of chain on the messages or the
+// prompt of a request body
+func filterRequest(ctx context.Context, chain *filter.Chain, body map[string]json.RawMessage) error {
+	if chain.Empty() {
+		return nil
+	}
+	fields := make(map[string]interface{})
+	for _, key := range []string{"messages", "prompt"} {
+		var value interface{}
+		if raw, ok := body[key]; ok && json.Unmarshal(raw, &value) == nil {
+			fields[key] = value
+		}
+	}
+	if err := chain.RequestBody(ctx, fields); err != nil {
+		return err
+	}
+	for key, value := range fields {
+		body[key], _ = json.Marshal(value)
+	}
+	return nil
+}
+
+// relayResponse forwards a non-streaming response, adding the LM Studio
+// fields to successful ones; chain filters the generated text
+func (h *Handler) relayResponse(c *gin.Context, instanceID, endpoint string, resp *http.Response, start time.Time, chain *filter.Chain) {
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		h.sendError(c, http.StatusInternalServerError, "server_error", err.Error(), "")
+		return
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		if u, ok := usage.Parse(respBody); ok {
+			h.usage.Record(c.Request, instanceID, endpoint, u, start, false)
+		}
+		respBody = chain.Body(c.Request.Context(), respBody)
+		// 非流式响应没有首个 token 的时间点，以提示词处理耗时代替
+		if extended, ok := h.extend(respBody, instanceID, -1); ok {
+			respBody = extended
+		}
+	}
+
+	c.Header("Content-Type", "application/json")
+	c.Status(resp.StatusCode)
+	c.Writer.Write(respBody)
+}
+
+// relayStream forwards an SSE stream. The time to first token is measured
+// at the first chunk with output; the LM Studio fields are added to the
+// chunk that carries llama-server's timings. chain filters the generated
+// text chunk by chunk.
+func (h *Handler) relayStream(c *gin.Context, instanceID, endpoint string, resp *http.Response, start time.Time, chain *filter.Chain) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable nginx buffering
+	c.Status(http.StatusOK)
+
+	var streamUsage usage.Usage
+	defer func() {
+		h.usage.Record(c.Request, instanceID, endpoint, streamUsage, start, true)
+	}()
+
+	ttft := time.Duration(-1)
+	reader := bufio.NewReader(resp.Body)
+	filters := chain.Stream(c.Request.Context())
+	for {
+		line, err := reader.ReadString('\n')
+		line = filters.Line(line)
+		if u, ok := usage.ParseStreamLine(line); ok {
+			streamUsage = u
+		}
+
+		if data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:"); ok {
+			data = strings.TrimSpace(data)
+			var chunk upstreamResult
+			if data != "[DONE]" && json.Unmarshal([]byte(data), &chunk) == nil {
+				if ttft < 0 && chunk.hasOutput() {
+					ttft = time.Since(start)
+				}
+				if chunk.Timings != nil {
+					if extended, ok := h.extend([]byte(data), instanceID, ttft); ok {
+						line = "data: " + string(extended) + "\n"
+					}
+				}
+			}
+		}
+
+		if line != "" {
+			c.Writer.Write([]byte(line))
+			c.Writer.Flush()
+		}
+		if filters.Blocked() {
+			// 被拦截后结束流并停止读取，llama-server 随之中止生成
+			c.Writer.Write([]byte("\ndata: [DONE]\n\n"))
+			c.Writer.Flush()
+			return
+		}
+
+		if err != nil {
+			if err != io.EOF && c.Request.Context().Err() == nil {
+				logger.Errorf("读取流式响应失败: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// extend adds stats, model_info and runtime to a response object. A
+// negative ttft means it is taken from the prompt processing time.
+func (h *Handler) extend(data []byte, instanceID string, ttft time.Duration) ([]byte, bool) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, false
+	}
+	var result upstreamResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, false
+	}
+
+	stats, _ := json.Marshal(buildStats(result.Timings, result.finishReason(), ttft))
+	info, _ := json.Marshal(h.modelInfo(instanceID))
+	runtime, _ := json.Marshal(runtimeInfo)
+	fields["stats"] = stats
+	fields["model_info"] = info
+	fields["runtime"] = runtime
+
+	extended, err := json.Marshal(fields)
+	if err != nil {
+		return nil, false
+	}
+	return extended, true
+}
+
+// buildStats converts llama-server timings to LM Studio's stats
+func buildStats(timings *upstreamTimings, finishReason string, ttft time.Duration) Stats {
+	stats := Stats{StopReason: stopReason(finishReason)}
+	if ttft >= 0 {
+		stats.TimeToFirstToken = ttft.Seconds()
+	}
+	if timings == nil {
+		return stats
+	}
+
+	stats.GenerationTime = timings.PredictedMS / 1000
+	stats.TokensPerSecond = timings.PredictedPerSecond
+	if stats.TokensPerSecond == 0 && timings.PredictedMS > 0 {
+		stats.TokensPerSecond = float64(timings.PredictedN) / (timings.PredictedMS / 1000)
+	}
+	if ttft < 0 {
+		stats.TimeToFirstToken = timings.PromptMS / 1000
+	}
+	return stats
+}
+
+// stopReason maps an OpenAI finish_reason to LM Studio's stop_reason
+func stopReason(finishReason string) string {
+	switch finishReason {
+	case "stop":
+		return "eosFound"
+	case "length":
+		return "maxPredictedTokensReached"
+	case "tool_calls":
+		return "toolCalls"
+	case "":
+		return "userStopped"
+	default:
+		return finishReason
+	}
+}
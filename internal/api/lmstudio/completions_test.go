@@ -0,0 +1,113 @@
+package lmstudio
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func upstreamResponse(status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestBuildStats(t *testing.T) {
+	timings := &upstreamTimings{PromptN: 10, PromptMS: 250, PredictedN: 50, PredictedMS: 2000}
+
+	stats := buildStats(timings, "stop", -1)
+	assert.Equal(t, Stats{TokensPerSecond: 25, TimeToFirstToken: 0.25, GenerationTime: 2, StopReason: "eosFound"}, stats)
+
+	stats = buildStats(timings, "length", 300*time.Millisecond)
+	assert.InDelta(t, 0.3, stats.TimeToFirstToken, 1e-9)
+	assert.Equal(t, "maxPredictedTokensReached", stats.StopReason)
+
+	stats = buildStats(nil, "tool_calls", -1)
+	assert.Equal(t, Stats{StopReason: "toolCalls"}, stats)
+}
+
+func TestRelayResponse(t *testing.T) {
+	handler := newTestHandler(t)
+
+	t.Run("Adds stats", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/v0/chat/completions", nil)
+
+		handler.relayResponse(c, "test-model", "/api/v0/chat/completions", upstreamResponse(http.StatusOK,
+			`{"id":"x","choices":[{"message":{"content":"Hi"},"finish_reason":"stop"}],"timings":{"prompt_ms":100,"predicted_n":4,"predicted_ms":200,"predicted_per_second":20}}`),
+			time.Now(), nil)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "x", resp["id"])
+		assert.Equal(t, map[string]interface{}{
+			"tokens_per_second":   20.0,
+			"time_to_first_token": 0.1,
+			"generation_time":     0.2,
+			"stop_reason":         "eosFound",
+		}, resp["stats"])
+		assert.Equal(t, "gguf", resp["model_info"].(map[string]interface{})["format"])
+		assert.Equal(t, "llama.cpp", resp["runtime"].(map[string]interface{})["name"])
+	})
+
+	t.Run("Upstream error is forwarded", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/v0/completions", nil)
+
+		body := `{"error":{"message":"context too long"}}`
+		handler.relayResponse(c, "test-model", "/api/v0/completions", upstreamResponse(http.StatusBadRequest, body), time.Now(), nil)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.JSONEq(t, body, w.Body.String())
+	})
+}
+
+func TestRelayStream(t *testing.T) {
+	handler := newTestHandler(t)
+
+	body := strings.Join([]string{
+		`data: {"choices":[{"index":0,"delta":{"role":"assistant"}}]}`,
+		`data: {"choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+		`data: {"choices":[{"index":0,"delta":{},"finish_reason":"length"}],"timings":{"prompt_ms":100,"predicted_n":4,"predicted_ms":200}}`,
+		`data: [DONE]`,
+	}, "\n\n") + "\n\n"
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/v0/chat/completions", nil)
+	handler.relayStream(c, "test-model", "/api/v0/chat/completions", upstreamResponse(http.StatusOK, body), time.Now(), nil)
+
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+
+	var last map[string]interface{}
+	var chunks int
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		data, ok := strings.CutPrefix(line, "data: ")
+		if !ok || data == "[DONE]" {
+			continue
+		}
+		chunks++
+		require.NoError(t, json.Unmarshal([]byte(data), &last))
+	}
+	assert.Equal(t, 3, chunks)
+	assert.Contains(t, w.Body.String(), "data: [DONE]")
+
+	stats := last["stats"].(map[string]interface{})
+	assert.Equal(t, "maxPredictedTokensReached", stats["stop_reason"])
+	assert.Equal(t, 20.0, stats["tokens_per_second"])
+	assert.Equal(t, 0.2, stats["generation_time"])
+	// 流式响应的首 token 时间按实际到达时间测量
+	assert.Less(t, stats["time_to_first_token"].(float64), 0.1)
+}
@@ -0,0 +1,254 @@
+// Package lmstudio provides the LM Studio REST API (v0) compatibility layer
+package lmstudio
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/api/openai"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/filter"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
+)
+
+// Handler handles LM Studio REST API requests
+type Handler struct {
+	modelMgr *model.Manager
+	openai   *openai.Handler // 向量接口与 OpenAI 兼容，直接复用
+	client   *http.Client
+	usage    *usage.Recorder
+	filters  *filter.Registry
+}
+
+// NewHandler creates a new LM Studio API handler
+func NewHandler(modelMgr *model.Manager, openaiHandler *openai.Handler) *Handler {
+	return &Handler{
+		modelMgr: modelMgr,
+		openai:   openaiHandler,
+		client: &http.Client{
+			Timeout:   0, // No timeout for streaming responses
+			Transport: tracing.NewTransport(nil, "llama-server"),
+		},
+	}
+}
+
+// SetUsageRecorder sets where token usage of proxied requests is recorded
+func (h *Handler) SetUsageRecorder(recorder *usage.Recorder) {
+	h.usage = recorder
+}
+
+// SetFilters sets the registry providing the content filters of each request
+func (h *Handler) SetFilters(registry *filter.Registry) {
+	h.filters = registry
+}
+
+// Model describes a model in the LM Studio catalog
+type Model struct {
+	ID                  string `json:"id"`
+	Object              string `json:"object"`
+	Type                string `json:"type"` // llm, vlm or embeddings
+	Publisher           string `json:"publisher"`
+	Arch                string `json:"arch"`
+	CompatibilityType   string `json:"compatibility_type"`
+	Quantization        string `json:"quantization"`
+	State               string `json:"state"` // loaded or not-loaded
+	MaxContextLength    int    `json:"max_context_length"`
+	LoadedContextLength int    `json:"loaded_context_length,omitempty"`
+}
+
+// ModelsResponse is the response of GET /api/v0/models
+type ModelsResponse struct {
+	Object string  `json:"object"`
+	Data   []Model `json:"data"`
+}
+
+// HandleModels lists all scanned models, loaded or not
+func (h *Handler) HandleModels(c *gin.Context) {
+	models := h.modelMgr.ListModels()
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].ID < models[j].ID
+	})
+
+	data := make([]Model, 0, len(models))
+	for _, m := range models {
+		data = append(data, h.catalogEntry(m))
+	}
+
+	c.JSON(http.StatusOK, ModelsResponse{
+		Object: "list",
+		Data:   data,
+	})
+}
+
+// HandleModel returns one model by ID, alias or name. The route uses a
+// wildcard parameter because model IDs may contain slashes.
+func (h *Handler) HandleModel(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("model"), "/")
+	m, ok := h.modelMgr.ResolveModel(name)
+	if !ok {
+		h.sendError(c, http.StatusNotFound, "model_not_found", fmt.Sprintf("Model %s not found", name), "model")
+		return
+	}
+	c.JSON(http.StatusOK, h.catalogEntry(m))
+}
+
+// HandleEmbeddings handles embedding requests; the response is the same as
+// the OpenAI endpoint
+func (h *Handler) HandleEmbeddings(c *gin.Context) {
+	h.openai.HandleEmbeddings(c)
+}
+
+// catalogEntry builds the catalog entry of a model from its GGUF metadata
+// and load state
+func (h *Handler) catalogEntry(m *model.Model) Model {
+	entry := Model{
+		ID:                m.ID,
+		Object:            "model",
+		Type:              "llm",
+		Publisher:         m.Author,
+		CompatibilityType: "gguf",
+		State:             "not-loaded",
+	}
+
+	if meta := m.Metadata; meta != nil {
+		entry.Arch = meta.Architecture
+		entry.Quantization = meta.Quantization
+		entry.MaxContextLength = meta.ContextLength
+		if entry.Publisher == "" {
+			entry.Publisher = meta.Author
+		}
+		// BERT 系列架构是向量模型
+		if strings.Contains(meta.Architecture, "bert") {
+			entry.Type = "embeddings"
+		}
+	}
+	if m.MmprojPath != "" {
+		entry.Type = "vlm"
+	}
+
+	if h.modelMgr.HasLoadedReplica(m.ID) {
+		entry.State = "loaded"
+	}
+	if status, exists := h.modelMgr.GetStatus(m.ID); exists && status.State == model.StateLoaded {
+		entry.LoadedContextLength = status.CtxSize
+		if status.Embedding {
+			entry.Type = "embeddings"
+		}
+	}
+	return entry
+}
+
+// modelInfo returns the model_info field added to completion responses
+func (h *Handler) modelInfo(instanceID string) ModelInfo {
+	info := ModelInfo{Format: "gguf"}
+
+	modelID := instanceID
+	status, exists := h.modelMgr.GetStatus(instanceID)
+	if exists {
+		info.ContextLength = status.CtxSize
+		if status.ModelID != "" {
+			modelID = status.ModelID
+		}
+	}
+	if m, ok := h.modelMgr.GetModel(modelID); ok && m.Metadata != nil {
+		info.Arch = m.Metadata.Architecture
+		info.Quant = m.Metadata.Quantization
+	}
+	return info
+}
+
+// checkGenerative rejects completion requests to models running in embedding
+// or reranking mode; returns false if an error response was sent
+func (h *Handler) checkGenerative(c *gin.Context, modelID, requested string) bool {
+	status, exists := h.modelMgr.GetStatus(modelID)
+	if !exists || (!status.Embedding && !status.Reranking) {
+		return true
+	}
+
+	h.sendError(c, http.StatusBadRequest, "invalid_request_error",
+		fmt.Sprintf("Model %s is loaded for embeddings or reranking and does not support completions", requested), "model")
+	return false
+}
+
+// sendModelError writes model routing, on-demand load and queue errors in
+// the OpenAI-compatible error format
+func (h *Handler) sendModelError(c *gin.Context, err error) {
+	status, retryAfter := model.ErrorStatus(err)
+	param := "model"
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		param = ""
+	}
+
+	switch status {
+	case http.StatusTooManyRequests:
+		h.sendError(c, status, "rate_limit_error", err.Error(), param)
+	case http.StatusBadRequest:
+		h.sendError(c, status, "invalid_request_error", err.Error(), param)
+	case http.StatusRequestTimeout:
+		h.sendError(c, status, "timeout", err.Error(), "")
+	case http.StatusNotFound:
+		h.sendError(c, status, "model_not_found", err.Error(), param)
+	default:
+		h.sendError(c, status, "server_error", err.Error(), param)
+	}
+}
+
+// getModelPort returns the port for a loaded model
+func (h *Handler) getModelPort(modelID string) (int, error) {
+	status, exists := h.modelMgr.GetStatus(modelID)
+	if !exists {
+		return 0, fmt.Errorf("model not loaded: %s", modelID)
+	}
+
+	if status.State != model.StateLoaded {
+		return 0, fmt.Errorf("model not in loaded state: %s", modelID)
+	}
+
+	if status.Port == 0 {
+		return 0, fmt.Errorf("model port not available: %s", modelID)
+	}
+
+	return status.Port, nil
+}
+
+// sendError sends an OpenAI style error response, as LM Studio does
+func (h *Handler) sendError(c *gin.Context, statusCode int, errorType, message, param string) {
+	c.JSON(statusCode, openai.NewErrorResponse(message, errorType, param, statusCode))
+}
+
+// requestModel reads the model and stream fields of a request body that is
+// otherwise forwarded unchanged
+func requestModel(body map[string]json.RawMessage) (string, bool, error) {
+	var name string
+	if raw, ok := body["model"]; ok {
+		if err := json.Unmarshal(raw, &name); err != nil {
+			return "", false, fmt.Errorf("model must be a string")
+		}
+	}
+	var stream bool
+	if raw, ok := body["stream"]; ok && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &stream); err != nil {
+			return "", false, fmt.Errorf("stream must be a boolean")
+		}
+	}
+	return name, stream, nil
+}
+
+// routeHints describes a raw request for virtual model routing. The prompt
+// length is estimated from the encoded messages or prompt.
+func routeHints(body map[string]json.RawMessage) model.RouteHints {
+	var tools []json.RawMessage
+	json.Unmarshal(body["tools"], &tools)
+	return model.RouteHints{
+		PromptTokens: model.EstimateTokens(string(body["messages"]), string(body["prompt"])),
+		Tools:        len(tools) > 0,
+		Vision:       strings.Contains(string(body["messages"]), `"image_url"`),
+	}
+}
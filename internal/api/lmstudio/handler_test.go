@@ -0,0 +1,104 @@
+package lmstudio
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/api/openai"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/gguf"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestHandler(t *testing.T) *Handler {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.DefaultConfig()
+	cfg.Model.Paths = []string{t.TempDir()}
+	cfg.Model.PathConfigs = nil
+	modelMgr := model.NewManager(cfg, nil, process.NewManager())
+	return NewHandler(modelMgr, openai.NewHandler(modelMgr))
+}
+
+func TestCatalogEntry(t *testing.T) {
+	handler := newTestHandler(t)
+
+	t.Run("LLM", func(t *testing.T) {
+		entry := handler.catalogEntry(&model.Model{
+			ID: "qwen",
+			Metadata: &gguf.Metadata{
+				Architecture:  "qwen2",
+				Quantization:  "Q4_K_M",
+				Author:        "Qwen",
+				ContextLength: 32768,
+			},
+		})
+		assert.Equal(t, Model{
+			ID:                "qwen",
+			Object:            "model",
+			Type:              "llm",
+			Publisher:         "Qwen",
+			Arch:              "qwen2",
+			CompatibilityType: "gguf",
+			Quantization:      "Q4_K_M",
+			State:             "not-loaded",
+			MaxContextLength:  32768,
+		}, entry)
+	})
+
+	t.Run("Vision", func(t *testing.T) {
+		entry := handler.catalogEntry(&model.Model{ID: "llava", Author: "liuhaotian", MmprojPath: "/models/mmproj.gguf"})
+		assert.Equal(t, "vlm", entry.Type)
+		assert.Equal(t, "liuhaotian", entry.Publisher)
+	})
+
+	t.Run("Embeddings", func(t *testing.T) {
+		entry := handler.catalogEntry(&model.Model{ID: "bge", Metadata: &gguf.Metadata{Architecture: "bert"}})
+		assert.Equal(t, "embeddings", entry.Type)
+	})
+}
+
+func TestHandler_ModelEndpoints(t *testing.T) {
+	handler := newTestHandler(t)
+
+	router := gin.New()
+	router.GET("/api/v0/models", handler.HandleModels)
+	router.GET("/api/v0/models/*model", handler.HandleModel)
+	router.POST("/api/v0/chat/completions", handler.HandleChatCompletions)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Empty list", func(t *testing.T) {
+		w := do("GET", "/api/v0/models", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"object":"list","data":[]}`, w.Body.String())
+	})
+
+	t.Run("Unknown model", func(t *testing.T) {
+		w := do("GET", "/api/v0/models/owner/missing", "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Contains(t, w.Body.String(), "owner/missing")
+	})
+
+	t.Run("Missing model field", func(t *testing.T) {
+		w := do("POST", "/api/v0/chat/completions", `{"messages":[]}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Invalid stream field", func(t *testing.T) {
+		w := do("POST", "/api/v0/chat/completions", `{"model":"m","stream":"yes"}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -3,16 +3,20 @@
 package api
 
 import (
+	"context"
 	"fmt"
+	"maps"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/cluster"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/cluster/routing"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/cluster/scanner"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/cluster/scheduler"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/node"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/types"
 )
 
@@ -22,6 +26,7 @@ type NodeAdapter struct {
 	log           *logger.Logger
 	scanner       *scanner.Scanner
 	scheduler     *scheduler.Scheduler
+	routes        *routing.Table                           // 模型路由表，记录各客户端节点已加载的模型
 	eventCallback func(eventType string, data interface{}) // 事件回调函数，用于 WebSocket/SSE 广播
 }
 
@@ -38,6 +43,7 @@ func NewNodeAdapter(n *node.Node, log *logger.Logger, schedulerCfg *config.Sched
 		log:       log,
 		scanner:   scanner.NewScanner(&config.NetworkScanConfig{}, log),
 		scheduler: sched,
+		routes:    routing.NewTable(0),
 	}
 }
 
@@ -51,6 +57,11 @@ func (a *NodeAdapter) GetScheduler() *scheduler.Scheduler {
 	return a.scheduler
 }
 
+// GetRoutes 返回模型路由表（供 server 转发推理请求）
+func (a *NodeAdapter) GetRoutes() *routing.Table {
+	return a.routes
+}
+
 // GetNodeID 返回当前节点 ID
 func (a *NodeAdapter) GetNodeID() string {
 	if a.node == nil {
@@ -124,11 +135,11 @@ func (m *nodeClientManager) GetClient(clientID string) (*cluster.Client, bool) {
 
 // SendCommand 向客户端发送命令
 func (m *nodeClientManager) SendCommand(clientID string, command *cluster.Command) (map[string]interface{}, error) {
-	// 将 cluster.Command 转换为 node.Command
+	// 将 cluster.Command 转换为 node.Command，负载复制一份以免修改任务记录
 	nodeCmd := &node.Command{
 		ID:         command.ID,
 		Type:       node.CommandType(command.Type),
-		Payload:    command.Payload,
+		Payload:    maps.Clone(command.Payload),
 		FromNodeID: m.node.GetID(),
 		ToNodeID:   clientID,
 		CreatedAt:  time.Now(),
@@ -137,8 +148,9 @@ func (m *nodeClientManager) SendCommand(clientID string, command *cluster.Comman
 		MaxRetries: 3,
 	}
 
-	// 将命令加入队列
-	if err := m.node.QueueCommand(clientID, nodeCmd); err != nil {
+	// 将命令加入队列，沿用提交任务的请求所在的 trace
+	ctx := tracing.ContextWithTraceParent(context.Background(), nodeCmd.TraceParent())
+	if err := queueCommand(ctx, m.node, clientID, nodeCmd); err != nil {
 		return nil, err
 	}
 
@@ -148,6 +160,22 @@ func (m *nodeClientManager) SendCommand(clientID string, command *cluster.Comman
 	}, nil
 }
 
+// queueCommand 将命令加入节点队列，并把 trace 上下文写入命令负载，
+// 使客户端节点执行命令的 span 与下发命令的请求处于同一 trace
+func queueCommand(ctx context.Context, n *node.Node, nodeID string, cmd *node.Command) error {
+	ctx, span := tracing.StartWithKind(ctx, tracing.KindProducer, "cluster.dispatch "+string(cmd.Type),
+		tracing.String("shepherd.command.id", cmd.ID),
+		tracing.String("shepherd.command.type", string(cmd.Type)),
+		tracing.String("shepherd.node.id", nodeID),
+	)
+	defer span.End()
+
+	cmd.SetTraceParent(tracing.TraceParent(ctx))
+	err := n.QueueCommand(nodeID, cmd)
+	span.RecordError(err)
+	return err
+}
+
 // convertNodeCapabilitiesToCluster 转换节点能力格式
 func convertNodeCapabilitiesToCluster(cap *node.NodeCapabilities) *cluster.Capabilities {
 	if cap == nil {
@@ -359,6 +387,8 @@ func (a *NodeAdapter) UnregisterNode(c *gin.Context) {
 		return
 	}
 
+	a.routes.RemoveNode(nodeID)
+
 	a.log.Infof("节点注销成功: %s", nodeID)
 	Success(c, gin.H{
 		"message": "节点注销成功",
@@ -393,6 +423,13 @@ func (a *NodeAdapter) HandleHeartbeat(c *gin.Context) {
 
 	a.log.Debugf("心跳处理成功: 节点=%s, 时间=%v", heartbeat.NodeID, heartbeat.Timestamp.Unix())
 
+	// 根据心跳上报的已加载模型刷新路由表
+	if heartbeat.Models != nil {
+		if client, err := a.node.GetClient(heartbeat.NodeID); err == nil {
+			a.routes.UpdateNode(client, heartbeat.Models)
+		}
+	}
+
 	// 广播客户端资源更新事件（通过 WebSocket/SSE）
 	if a.eventCallback != nil && heartbeat.Resources != nil {
 		// 获取更新后的客户端信息
@@ -441,7 +478,7 @@ func (a *NodeAdapter) SendCommand(c *gin.Context) {
 	}
 
 	// 将命令加入队列
-	if err := a.node.QueueCommand(nodeID, &cmd); err != nil {
+	if err := queueCommand(c.Request.Context(), a.node, nodeID, &cmd); err != nil {
 		a.log.Errorf("命令发送失败: %v", err)
 		ErrorWithDetails(c, types.ErrInternalError, "命令发送失败", err.Error())
 		return
@@ -478,12 +515,17 @@ func (a *NodeAdapter) GetCommands(c *gin.Context) {
 // POST /api/master/command/result
 func (a *NodeAdapter) ReportCommandResult(c *gin.Context) {
 	var req struct {
-		NodeID    string      `json:"node_id"`
-		CommandID string      `json:"command_id"`
-		Success   bool        `json:"success"`
-		Output    string      `json:"output"`
-		Error     string      `json:"error,omitempty"`
-		Metadata  interface{} `json:"metadata,omitempty"`
+		NodeID    string                 `json:"node_id"`
+		CommandID string                 `json:"command_id"`
+		Success   bool                   `json:"success"`
+		Output    string                 `json:"output"`
+		Error     string                 `json:"error,omitempty"`
+		Metadata  interface{}            `json:"metadata,omitempty"`
+		Result    map[string]interface{} `json:"result,omitempty"`
+
+		// 客户端直接上报 node.CommandResult 时使用的字段名
+		FromNodeID      string `json:"fromNodeId"`
+		ResultCommandID string `json:"commandId"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -491,6 +533,12 @@ func (a *NodeAdapter) ReportCommandResult(c *gin.Context) {
 		ValidationError(c, err)
 		return
 	}
+	if req.NodeID == "" {
+		req.NodeID = req.FromNodeID
+	}
+	if req.CommandID == "" {
+		req.CommandID = req.ResultCommandID
+	}
 
 	// 验证必需字段
 	if req.NodeID == "" || req.CommandID == "" {
@@ -508,6 +556,9 @@ func (a *NodeAdapter) ReportCommandResult(c *gin.Context) {
 	}
 
 	// 添加结果数据
+	if len(req.Result) > 0 {
+		result.Result = req.Result
+	}
 	if req.Output != "" {
 		if result.Result == nil {
 			result.Result = make(map[string]interface{})
@@ -541,6 +592,10 @@ func (a *NodeAdapter) ReportCommandResult(c *gin.Context) {
 
 	result.Duration = time.Since(startTime).Milliseconds()
 
+	if result.Success {
+		a.updateRoutesFromResult(result)
+	}
+
 	a.log.Infof("命令结果已存储: 节点=%s, 命令=%s, 成功=%v, 耗时=%dms",
 		req.NodeID, req.CommandID, req.Success, result.Duration)
 
@@ -551,6 +606,49 @@ func (a *NodeAdapter) ReportCommandResult(c *gin.Context) {
 	SuccessWithMessage(c, "命令结果已记录")
 }
 
+// ListRoutes 返回模型路由表
+// GET /api/routes
+func (a *NodeAdapter) ListRoutes(c *gin.Context) {
+	routes := a.routes.List()
+	Success(c, gin.H{
+		"routes": routes,
+		"total":  len(routes),
+	})
+}
+
+// updateRoutesFromResult 根据模型加载/卸载命令的结果更新路由表，
+// 不必等待下一次心跳即可转发请求
+func (a *NodeAdapter) updateRoutesFromResult(result *node.CommandResult) {
+	modelID, _ := result.Result["model_id"].(string)
+	if modelID == "" {
+		return
+	}
+
+	if unloaded, _ := result.Result["unloaded"].(bool); unloaded {
+		a.routes.Remove(result.FromNodeID, modelID)
+		return
+	}
+
+	port, _ := result.Result["port"].(float64)
+	if port <= 0 {
+		return
+	}
+	client, err := a.node.GetClient(result.FromNodeID)
+	if err != nil {
+		return
+	}
+
+	a.routes.Add(routing.Route{
+		ModelID:   modelID,
+		NodeID:    client.ID,
+		Address:   client.Address,
+		NodePort:  client.Port,
+		ModelPort: int(port),
+		Source:    routing.SourceCommand,
+	})
+	a.log.Infof("模型路由已更新: 模型=%s, 节点=%s", modelID, client.ID)
+}
+
 // ==================== 路由注册 ====================
 
 // RegisterRoutes 注册所有 API 路由（统一版本）
@@ -587,6 +685,9 @@ func (a *NodeAdapter) RegisterRoutes(router *gin.RouterGroup) {
 	// ========== 集群概览 ==========
 	router.GET("/overview", a.GetClusterOverview)
 
+	// ========== 模型路由表 ==========
+	router.GET("/routes", a.ListRoutes)
+
 	// ========== 兼容性路由（已废弃）==========
 	a.registerDeprecatedRoutes(router)
 
@@ -958,7 +1059,7 @@ func (a *NodeAdapter) GetNodeConfig(c *gin.Context) {
 		CreatedAt: time.Now(),
 	}
 
-	if err := a.node.QueueCommand(nodeID, &cmd); err != nil {
+	if err := queueCommand(c.Request.Context(), a.node, nodeID, &cmd); err != nil {
 		a.log.Errorf("发送获取配置命令失败: %v", err)
 		ErrorWithDetails(c, types.ErrInternalError, "发送命令失败", err.Error())
 		return
@@ -1000,7 +1101,7 @@ func (a *NodeAdapter) TestNodeLlamacpp(c *gin.Context) {
 		cmd.Payload["binary_path"] = req.BinaryPath
 	}
 
-	if err := a.node.QueueCommand(nodeID, &cmd); err != nil {
+	if err := queueCommand(c.Request.Context(), a.node, nodeID, &cmd); err != nil {
 		a.log.Errorf("发送测试命令失败: %v", err)
 		ErrorWithDetails(c, types.ErrInternalError, "发送命令失败", err.Error())
 		return
@@ -2,6 +2,7 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -12,6 +13,7 @@ import (
 	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/node"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -399,6 +401,30 @@ func TestNodeAdapter_SendCommand(t *testing.T) {
 	}
 }
 
+func TestNodeAdapter_SendCommandTraceContext(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer collector.Close()
+	tracing.Init(config.TracingConfig{Enabled: true, Endpoint: collector.URL, SampleRatio: 1})
+	defer tracing.Shutdown(context.Background())
+
+	adapter, n, cleanup := setupTestNodeAdapter(t)
+	defer cleanup()
+	n.RegisterClient(&node.NodeInfo{ID: "test-client", Address: "192.168.1.100", Port: 8080, Role: node.NodeRoleClient})
+
+	ctx := tracing.ContextWithTraceParent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	cmd := &node.Command{ID: "cmd-1", Type: node.CommandTypeLoadModel}
+	require.NoError(t, queueCommand(ctx, adapter.node, "test-client", cmd))
+
+	// 命令负载携带下发 span 的上下文，客户端据此延续同一 trace
+	commands := n.GetPendingCommands("test-client")
+	require.Len(t, commands, 1)
+	sc, ok := tracing.ParseTraceParent(commands[0].TraceParent())
+	require.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.NotEqual(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+}
+
 func TestNodeAdapter_GetCommands(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	adapter, _, cleanup := setupTestNodeAdapter(t)
@@ -652,3 +678,88 @@ func TestNodeAdapter_GetClientScanStatus(t *testing.T) {
 	assert.Contains(t, data, "running")
 	assert.IsType(t, false, data["running"])
 }
+
+func TestNodeAdapter_ModelRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	adapter, n, cleanup := setupTestNodeAdapter(t)
+	defer cleanup()
+
+	require.NoError(t, n.RegisterClient(&node.NodeInfo{
+		ID:      "gpu-client",
+		Address: "192.168.1.100",
+		Port:    9190,
+		Role:    node.NodeRoleClient,
+	}))
+
+	router := gin.New()
+	router.POST("/api/master/heartbeat", adapter.HandleHeartbeat)
+	router.POST("/api/master/command/result", adapter.ReportCommandResult)
+	router.DELETE("/api/master/nodes/:id", adapter.UnregisterNode)
+
+	post := func(path string, body interface{}) int {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", path, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	t.Run("Learned from heartbeat", func(t *testing.T) {
+		code := post("/api/master/heartbeat", node.HeartbeatMessage{
+			NodeID:    "gpu-client",
+			Timestamp: time.Now(),
+			Models:    []node.LoadedModel{{ID: "qwen-7b", Alias: "qwen", Port: 8081}},
+		})
+		require.Equal(t, http.StatusOK, code)
+
+		route, ok := adapter.GetRoutes().Lookup("qwen")
+		require.True(t, ok)
+		assert.Equal(t, "gpu-client", route.NodeID)
+		assert.Equal(t, "192.168.1.100", route.Address)
+		assert.Equal(t, 9190, route.NodePort)
+		assert.Equal(t, 8081, route.ModelPort)
+	})
+
+	t.Run("Heartbeat without models keeps routes", func(t *testing.T) {
+		code := post("/api/master/heartbeat", map[string]interface{}{"nodeId": "gpu-client"})
+		require.Equal(t, http.StatusOK, code)
+
+		_, ok := adapter.GetRoutes().Lookup("qwen-7b")
+		assert.True(t, ok)
+	})
+
+	t.Run("Learned from command result", func(t *testing.T) {
+		code := post("/api/master/command/result", node.CommandResult{
+			CommandID:  "cmd-load",
+			FromNodeID: "gpu-client",
+			Success:    true,
+			Result:     map[string]interface{}{"model_id": "llama-8b", "port": 8082},
+		})
+		require.Equal(t, http.StatusOK, code)
+
+		route, ok := adapter.GetRoutes().Lookup("llama-8b")
+		require.True(t, ok)
+		assert.Equal(t, 8082, route.ModelPort)
+
+		code = post("/api/master/command/result", node.CommandResult{
+			CommandID:  "cmd-unload",
+			FromNodeID: "gpu-client",
+			Success:    true,
+			Result:     map[string]interface{}{"model_id": "llama-8b", "unloaded": true},
+		})
+		require.Equal(t, http.StatusOK, code)
+
+		_, ok = adapter.GetRoutes().Lookup("llama-8b")
+		assert.False(t, ok)
+	})
+
+	t.Run("Removed with node", func(t *testing.T) {
+		req := httptest.NewRequest("DELETE", "/api/master/nodes/gpu-client", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		assert.Empty(t, adapter.GetRoutes().List())
+	})
+}
@@ -0,0 +1,213 @@
+package ollama
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+)
+
+// GenerateRequest represents an Ollama generate request
+type GenerateRequest struct {
+	Model     string            `json:"model"`
+	Prompt    string            `json:"prompt"`
+	System    string            `json:"system,omitempty"`
+	Images    []string          `json:"images,omitempty"` // base64 encoded
+	Raw       bool              `json:"raw,omitempty"`    // 不套用对话模板
+	Stream    *bool             `json:"stream,omitempty"` // 未指定时默认流式
+	Options   *GenerationParams `json:"options,omitempty"`
+	Format    json.RawMessage   `json:"format,omitempty"`
+	Think     *bool             `json:"think,omitempty"`
+	KeepAlive json.RawMessage   `json:"keep_alive,omitempty"`
+}
+
+// GenerateResponse represents an Ollama generate response
+type GenerateResponse struct {
+	Model      string `json:"model"`
+	CreatedAt  string `json:"created_at,omitempty"`
+	Response   string `json:"response"`
+	Thinking   string `json:"thinking,omitempty"`
+	Done       bool   `json:"done"`
+	DoneReason string `json:"done_reason,omitempty"`
+	Metrics
+}
+
+// HandleGenerate handles Ollama generate requests. The prompt is sent through
+// the model's chat template unless raw is set. A request without a prompt
+// only loads the model, or unloads it when keep_alive is 0.
+func (h *Handler) HandleGenerate(c *gin.Context) {
+	startTime := time.Now()
+
+	var req GenerateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Model == "" {
+		h.sendError(c, http.StatusBadRequest, "model is required")
+		return
+	}
+
+	keepAlive, hasKeepAlive, err := parseKeepAlive(req.KeepAlive)
+	if err != nil {
+		h.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Prompt == "" && len(req.Images) == 0 {
+		if hasKeepAlive && keepAlive == 0 {
+			h.unloadModel(c, req.Model)
+			return
+		}
+		h.loadModel(c, req.Model, keepAlive, hasKeepAlive)
+		return
+	}
+
+	body, path, err := generateRequestBody(req)
+	if err != nil {
+		h.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	chain := h.filters.Chain(c, req.Model)
+	if err := chain.RequestBody(c.Request.Context(), body); err != nil {
+		h.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	hints := model.RouteHints{
+		PromptTokens: model.EstimateTokens(req.System, req.Prompt),
+		Vision:       len(req.Images) > 0,
+	}
+	actualModelID, err := h.modelMgr.Route(c.Request.Context(), trimTag(req.Model), hints, c.GetHeader(h.modelMgr.SessionHeader()))
+	if err != nil {
+		h.sendModelError(c, err)
+		return
+	}
+	loadDuration := time.Since(startTime)
+
+	port, err := h.getModelPort(actualModelID)
+	if err != nil {
+		h.sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if len(req.Images) > 0 && !h.supportsVision(actualModelID) {
+		h.sendError(c, http.StatusBadRequest, fmt.Sprintf("%q does not support images", req.Model))
+		return
+	}
+
+	// keep_alive 在请求结束、释放槽位之后生效
+	if hasKeepAlive {
+		defer h.modelMgr.SetKeepAlive(actualModelID, keepAlive)
+	}
+
+	done, err := h.modelMgr.AcquireSlot(c.Request.Context(), actualModelID)
+	if err != nil {
+		h.sendModelError(c, err)
+		return
+	}
+	defer done()
+
+	body["model"] = actualModelID
+	h.proxyGeneration(c, &generation{
+		model:        req.Model,
+		instanceID:   actualModelID,
+		endpoint:     "/api/generate",
+		filters:      chain.Stream(c.Request.Context()),
+		stream:       req.Stream == nil || *req.Stream,
+		start:        startTime,
+		loadDuration: loadDuration,
+	}, port, path, body)
+}
+
+// generateRequestBody converts a generate request to a llama-server request
+// body and returns the upstream path. Raw prompts go to /v1/completions.
+func generateRequestBody(req GenerateRequest) (map[string]interface{}, string, error) {
+	body := map[string]interface{}{}
+	path := "/v1/chat/completions"
+
+	if req.Raw {
+		if len(req.Images) > 0 {
+			return nil, "", fmt.Errorf("images are not supported with raw prompts")
+		}
+		body["prompt"] = req.Prompt
+		path = "/v1/completions"
+	} else {
+		var messages []map[string]interface{}
+		if req.System != "" {
+			messages = append(messages, map[string]interface{}{
+				"role":    "system",
+				"content": req.System,
+			})
+		}
+		user, err := convertMessage(ChatMessage{Role: "user", Content: req.Prompt, Images: req.Images})
+		if err != nil {
+			return nil, "", err
+		}
+		body["messages"] = append(messages, user)
+		if req.Think != nil {
+			body["chat_template_kwargs"] = map[string]interface{}{"enable_thinking": *req.Think}
+		}
+	}
+
+	req.Options.applyTo(body)
+	if err := applyFormat(body, req.Format, !req.Raw); err != nil {
+		return nil, "", err
+	}
+	return body, path, nil
+}
+
+// loadModel handles a generate request without a prompt: the model is loaded
+// and kept for keep_alive
+func (h *Handler) loadModel(c *gin.Context, modelName string, keepAlive time.Duration, hasKeepAlive bool) {
+	startTime := time.Now()
+
+	actualModelID, err := h.modelMgr.Route(c.Request.Context(), trimTag(modelName), model.RouteHints{}, c.GetHeader(h.modelMgr.SessionHeader()))
+	if err != nil {
+		h.sendModelError(c, err)
+		return
+	}
+	if hasKeepAlive {
+		h.modelMgr.SetKeepAlive(actualModelID, keepAlive)
+	}
+
+	loadDuration := time.Since(startTime)
+	c.JSON(http.StatusOK, GenerateResponse{
+		Model:      modelName,
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339Nano),
+		Done:       true,
+		DoneReason: "load",
+		Metrics: Metrics{
+			TotalDuration: loadDuration.Nanoseconds(),
+			LoadDuration:  loadDuration.Nanoseconds(),
+		},
+	})
+}
+
+// unloadModel handles a generate request without a prompt and keep_alive 0:
+// all loaded instances of the model are unloaded once idle
+func (h *Handler) unloadModel(c *gin.Context, modelName string) {
+	m, ok := h.resolveModel(modelName)
+	if !ok {
+		h.sendError(c, http.StatusNotFound, fmt.Sprintf("model %q not found", modelName))
+		return
+	}
+
+	for id, status := range h.modelMgr.ListStatus() {
+		if (id == m.ID || status.ModelID == m.ID) && status.State == model.StateLoaded {
+			h.modelMgr.SetKeepAlive(id, 0)
+		}
+	}
+
+	c.JSON(http.StatusOK, GenerateResponse{
+		Model:      modelName,
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339Nano),
+		Done:       true,
+		DoneReason: "unload",
+	})
+}
@@ -0,0 +1,99 @@
+package ollama
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_HandleGenerate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	modelMgr := model.NewManager(config.DefaultConfig(), nil, process.NewManager())
+	handler := NewHandler(modelMgr)
+
+	tests := []struct {
+		name       string
+		reqBody    string
+		wantStatus int
+	}{
+		{
+			name:       "missing model",
+			reqBody:    `{"prompt": "Hello"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid keep_alive",
+			reqBody:    `{"model": "test", "prompt": "Hello", "keep_alive": "soon"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "invalid format",
+			reqBody:    `{"model": "test", "prompt": "Hello", "format": "yaml"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "raw prompt with images",
+			reqBody:    `{"model": "test", "prompt": "Hello", "raw": true, "images": ["aGk="]}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "model not found",
+			reqBody:    `{"model": "nonexistent-model", "prompt": "Hello"}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:       "unload unknown model",
+			reqBody:    `{"model": "nonexistent-model", "keep_alive": 0}`,
+			wantStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.POST("/api/generate", handler.HandleGenerate)
+
+			req := httptest.NewRequest("POST", "/api/generate", strings.NewReader(tt.reqBody))
+			req.Header.Set("Content-Type", "application/json")
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestGenerateRequestBody(t *testing.T) {
+	think := false
+	body, path, err := generateRequestBody(GenerateRequest{
+		Prompt:  "Why is the sky blue?",
+		System:  "Be brief.",
+		Think:   &think,
+		Options: &GenerationParams{Temperature: 0.2},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "/v1/chat/completions", path)
+	assert.JSONEq(t, `{
+		"messages": [
+			{"role": "system", "content": "Be brief."},
+			{"role": "user", "content": "Why is the sky blue?"}
+		],
+		"chat_template_kwargs": {"enable_thinking": false},
+		"temperature": 0.2
+	}`, mustJSON(t, body))
+
+	body, path, err = generateRequestBody(GenerateRequest{Prompt: "[INST] Hi [/INST]", Raw: true})
+	require.NoError(t, err)
+	assert.Equal(t, "/v1/completions", path)
+	assert.Equal(t, map[string]interface{}{"prompt": "[INST] Hi [/INST]"}, body)
+}
@@ -7,63 +7,152 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/api/openai"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/capture"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/filter"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/modelrepo"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
 )
 
 // Handler handles Ollama API requests
 type Handler struct {
 	modelMgr *model.Manager
 	client   *http.Client
+	usage    *usage.Recorder
+	capture  *capture.Recorder
+	filters  *filter.Registry
+	repo     *modelrepo.Client
 }
 
 // NewHandler creates a new Ollama API handler
 func NewHandler(modelMgr *model.Manager) *Handler {
 	return &Handler{
 		modelMgr: modelMgr,
-		client:   &http.Client{},
+		client:   &http.Client{Transport: tracing.NewTransport(nil, "llama-server")},
 	}
 }
 
+// SetUsageRecorder sets where token usage of proxied requests is recorded
+func (h *Handler) SetUsageRecorder(recorder *usage.Recorder) {
+	h.usage = recorder
+}
+
+// SetCaptureRecorder sets where captured chats are recorded
+func (h *Handler) SetCaptureRecorder(recorder *capture.Recorder) {
+	h.capture = recorder
+}
+
+// SetFilters sets the registry providing the content filters of each request
+func (h *Handler) SetFilters(registry *filter.Registry) {
+	h.filters = registry
+}
+
 // ChatRequest represents an Ollama chat request
 type ChatRequest struct {
-	Model    string         `json:"model"`
-	Messages []ChatMessage `json:"messages"`
-	Stream   bool           `json:"stream,omitempty"`
-	Options  *GenerationParams `json:"options,omitempty"`
-	Format   string         `json:"format,omitempty"`
+	Model     string            `json:"model"`
+	Messages  []ChatMessage     `json:"messages"`
+	Stream    *bool             `json:"stream,omitempty"` // 未指定时默认流式
+	Options   *GenerationParams `json:"options,omitempty"`
+	Format    json.RawMessage   `json:"format,omitempty"` // "json" or a JSON schema
+	Tools     json.RawMessage   `json:"tools,omitempty"`
+	Think     *bool             `json:"think,omitempty"`
+	KeepAlive json.RawMessage   `json:"keep_alive,omitempty"`
 }
 
 // ChatMessage represents a chat message
 type ChatMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	Thinking  string     `json:"thinking,omitempty"`
+	Images    []string   `json:"images,omitempty"` // base64 encoded
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	ToolName  string     `json:"tool_name,omitempty"`
+}
+
+// ToolCall represents a tool call made by the model
+type ToolCall struct {
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction is the called function; arguments are a JSON object
+type ToolCallFunction struct {
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
 }
 
 // GenerationParams represents generation parameters
 type GenerationParams struct {
-	Temperature      float64 `json:"temperature,omitempty"`
-	TopP            float64 `json:"top_p,omitempty"`
-	TopK            int     `json:"top_k,omitempty"`
-	NumPredict      int     `json:"num_predict,omitempty"`
-	RepeatPenalty   float64 `json:"repeat_penalty,omitempty"`
-	Stop            []string `json:"stop,omitempty"`
+	Temperature      float64  `json:"temperature,omitempty"`
+	TopP             float64  `json:"top_p,omitempty"`
+	TopK             int      `json:"top_k,omitempty"`
+	MinP             float64  `json:"min_p,omitempty"`
+	TypicalP         float64  `json:"typical_p,omitempty"`
+	NumPredict       int      `json:"num_predict,omitempty"`
+	NumKeep          int      `json:"num_keep,omitempty"`
+	RepeatPenalty    float64  `json:"repeat_penalty,omitempty"`
+	RepeatLastN      int      `json:"repeat_last_n,omitempty"`
+	PresencePenalty  float64  `json:"presence_penalty,omitempty"`
+	FrequencyPenalty float64  `json:"frequency_penalty,omitempty"`
+	Seed             int      `json:"seed,omitempty"`
+	Mirostat         int      `json:"mirostat,omitempty"`
+	MirostatTau      float64  `json:"mirostat_tau,omitempty"`
+	MirostatEta      float64  `json:"mirostat_eta,omitempty"`
+	Stop             []string `json:"stop,omitempty"`
+
+	present map[string]bool // 请求中出现的选项键
+}
+
+// Metrics are the timing and token counts reported with the final response
+type Metrics struct {
+	TotalDuration      int64 `json:"total_duration,omitempty"`
+	LoadDuration       int64 `json:"load_duration,omitempty"`
+	PromptEvalCount    int   `json:"prompt_eval_count,omitempty"`
+	PromptEvalDuration int64 `json:"prompt_eval_duration,omitempty"`
+	EvalCount          int   `json:"eval_count,omitempty"`
+	EvalDuration       int64 `json:"eval_duration,omitempty"`
 }
 
 // ChatResponse represents an Ollama chat response
 type ChatResponse struct {
-	Model     string        `json:"model"`
-	CreatedAt string       `json:"created_at,omitempty"`
-	Message   ChatMessage  `json:"message,omitempty"`
-	Done      bool          `json:"done,omitempty"`
-	Error     string        `json:"error,omitempty"`
+	Model      string      `json:"model"`
+	CreatedAt  string      `json:"created_at,omitempty"`
+	Message    ChatMessage `json:"message"`
+	Done       bool        `json:"done"`
+	DoneReason string      `json:"done_reason,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Metrics
+}
+
+// EmbedRequest represents an Ollama embed request
+type EmbedRequest struct {
+	Model     string            `json:"model"`
+	Input     json.RawMessage   `json:"input"` // string or []string
+	Truncate  *bool             `json:"truncate,omitempty"`
+	Options   *GenerationParams `json:"options,omitempty"`
+	KeepAlive json.RawMessage   `json:"keep_alive,omitempty"`
+}
+
+// EmbedResponse represents an Ollama embed response
+type EmbedResponse struct {
+	Model           string      `json:"model"`
+	Embeddings      [][]float64 `json:"embeddings"`
+	TotalDuration   int64       `json:"total_duration,omitempty"`
+	LoadDuration    int64       `json:"load_duration,omitempty"`
+	PromptEvalCount int         `json:"prompt_eval_count,omitempty"`
 }
 
 // HandleChat handles Ollama chat completion requests
 func (h *Handler) HandleChat(c *gin.Context) {
+	startTime := time.Now()
+
 	var req ChatRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.sendError(c, http.StatusBadRequest, err.Error())
@@ -81,12 +170,32 @@ func (h *Handler) HandleChat(c *gin.Context) {
 		return
 	}
 
+	keepAlive, hasKeepAlive, err := parseKeepAlive(req.KeepAlive)
+	if err != nil {
+		h.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	body, err := chatRequestBody(req)
+	if err != nil {
+		h.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 请求过滤器在选择模型前运行，被拦截的请求不会触发模型加载
+	chain := h.filters.Chain(c, req.Model)
+	if err := chain.RequestBody(c.Request.Context(), body); err != nil {
+		h.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// Find the actual model ID
-	actualModelID, err := h.findModel(req.Model)
+	actualModelID, err := h.modelMgr.Route(c.Request.Context(), trimTag(req.Model), chatRouteHints(req), c.GetHeader(h.modelMgr.SessionHeader()))
 	if err != nil {
-		h.sendError(c, http.StatusNotFound, err.Error())
+		h.sendModelError(c, err)
 		return
 	}
+	loadDuration := time.Since(startTime)
 
 	// Get model port
 	port, err := h.getModelPort(actualModelID)
@@ -95,43 +204,153 @@ func (h *Handler) HandleChat(c *gin.Context) {
 		return
 	}
 
-	// Convert to OpenAI format and forward
-	h.forwardToOpenAI(c, actualModelID, port, req)
-}
+	if messagesHaveImages(req.Messages) && !h.supportsVision(actualModelID) {
+		h.sendError(c, http.StatusBadRequest, fmt.Sprintf("%q does not support images", req.Model))
+		return
+	}
 
-// HandleTags handles Ollama tags requests
-func (h *Handler) HandleTags(c *gin.Context) {
-	// Return empty tags list for now
-	c.JSON(http.StatusOK, map[string]interface{}{
-		"models": []interface{}{},
-	})
+	// keep_alive 在请求结束、释放槽位之后生效
+	if hasKeepAlive {
+		defer h.modelMgr.SetKeepAlive(actualModelID, keepAlive)
+	}
+
+	// 等待模型空闲槽位，同时记录请求用于空闲卸载判断
+	done, err := h.modelMgr.AcquireSlot(c.Request.Context(), actualModelID)
+	if err != nil {
+		h.sendModelError(c, err)
+		return
+	}
+	defer done()
+
+	messages := make([]capture.Message, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		messages = append(messages, capture.Message{Role: msg.Role, Content: msg.Content, Name: msg.ToolName})
+	}
+	if filtered, ok := body["messages"].([]map[string]interface{}); ok && !chain.Empty() {
+		// 记录过滤后的消息，被脱敏的内容不进入对话存储
+		messages = messages[:0]
+		for _, msg := range filter.FromOpenAI(filtered) {
+			messages = append(messages, capture.Message{Role: msg.Role, Content: msg.Content})
+		}
+	}
+
+	body["model"] = actualModelID
+	h.proxyGeneration(c, &generation{
+		model:        req.Model,
+		instanceID:   actualModelID,
+		endpoint:     "/api/chat",
+		chat:         true,
+		turn:         h.capture.Begin(c.Writer, c.Request, "/api/chat", messages),
+		filters:      chain.Stream(c.Request.Context()),
+		stream:       req.Stream == nil || *req.Stream,
+		start:        startTime,
+		loadDuration: loadDuration,
+	}, port, "/v1/chat/completions", body)
 }
 
-// findModel finds a model by name or ID
-func (h *Handler) findModel(modelName string) (string, error) {
-	statuses := h.modelMgr.ListStatus()
-	models := h.modelMgr.ListModels()
+// HandleEmbed handles Ollama embed requests
+func (h *Handler) HandleEmbed(c *gin.Context) {
+	startTime := time.Now()
+
+	var req EmbedRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.Model == "" {
+		h.sendError(c, http.StatusBadRequest, "model is required")
+		return
+	}
+
+	var inputs []string
+	var single string
+	if err := json.Unmarshal(req.Input, &single); err == nil {
+		inputs = []string{single}
+	} else if err := json.Unmarshal(req.Input, &inputs); err != nil || len(inputs) == 0 {
+		h.sendError(c, http.StatusBadRequest, "input must be a string or a non-empty array of strings")
+		return
+	}
+
+	actualModelID, err := h.modelMgr.Route(c.Request.Context(), trimTag(req.Model), model.RouteHints{PromptTokens: model.EstimateTokens(inputs...)}, c.GetHeader(h.modelMgr.SessionHeader()))
+	if err != nil {
+		h.sendModelError(c, err)
+		return
+	}
+	loadDuration := time.Since(startTime)
 
-	// First try exact match with ID
-	if status, exists := statuses[modelName]; exists && status.State == model.StateLoaded {
-		return modelName, nil
+	port, err := h.getModelPort(actualModelID)
+	if err != nil {
+		h.sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	status, _ := h.modelMgr.GetStatus(actualModelID)
+	if !status.Embedding {
+		h.sendError(c, http.StatusBadRequest, fmt.Sprintf("%q does not support embeddings", req.Model))
+		return
 	}
 
-	// Try to find by name/alias
-	for _, m := range models {
-		status, exists := statuses[m.ID]
-		if !exists || status.State != model.StateLoaded {
-			continue
+	done, err := h.modelMgr.AcquireSlot(c.Request.Context(), actualModelID)
+	if err != nil {
+		h.sendModelError(c, err)
+		return
+	}
+	defer done()
+
+	costs := make([]int, len(inputs))
+	for i, input := range inputs {
+		costs[i] = openai.EstimateTokens(input)
+	}
+
+	resp := EmbedResponse{
+		Model:      req.Model,
+		Embeddings: make([][]float64, len(inputs)),
+	}
+	for _, batch := range openai.SplitBatches(costs, openai.UBatchSize(status)) {
+		var upstream struct {
+			Data []struct {
+				Index     int       `json:"index"`
+				Embedding []float64 `json:"embedding"`
+			} `json:"data"`
+			Usage struct {
+				PromptTokens int `json:"prompt_tokens"`
+			} `json:"usage"`
+		}
+		chunk := map[string]interface{}{
+			"model":           actualModelID,
+			"input":           inputs[batch.Start:batch.End],
+			"encoding_format": "float",
+		}
+		if err := h.postJSON(c, port, "/v1/embeddings", chunk, &upstream); err != nil {
+			h.sendError(c, http.StatusBadGateway, err.Error())
+			return
 		}
 
-		if m.Alias == modelName || m.Name == modelName ||
-			strings.EqualFold(m.Name, modelName) ||
-			strings.Contains(strings.ToLower(m.ID), strings.ToLower(modelName)) {
-			return m.ID, nil
+		for _, data := range upstream.Data {
+			index := batch.Start + data.Index
+			if index >= batch.Start && index < batch.End {
+				resp.Embeddings[index] = data.Embedding
+			}
 		}
+		resp.PromptEvalCount += upstream.Usage.PromptTokens
 	}
 
-	return "", fmt.Errorf("model not found: %s", modelName)
+	h.usage.Record(c.Request, actualModelID, "/api/embed", usage.Usage{PromptTokens: resp.PromptEvalCount}, startTime.Add(loadDuration), false)
+
+	resp.LoadDuration = loadDuration.Nanoseconds()
+	resp.TotalDuration = time.Since(startTime).Nanoseconds()
+	c.JSON(http.StatusOK, resp)
+}
+
+// sendModelError writes model routing, on-demand load and queue errors in
+// the Ollama error format
+func (h *Handler) sendModelError(c *gin.Context, err error) {
+	status, retryAfter := model.ErrorStatus(err)
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+	}
+	h.sendError(c, status, err.Error())
 }
 
 // getModelPort returns the port for a loaded model
@@ -152,73 +371,135 @@ func (h *Handler) getModelPort(modelID string) (int, error) {
 	return status.Port, nil
 }
 
-// forwardToOpenAI converts Ollama request to OpenAI format and forwards
-func (h *Handler) forwardToOpenAI(c *gin.Context, modelID string, port int, ollamaReq ChatRequest) {
-	// Convert to OpenAI format
-	messages := make([]map[string]interface{}, len(ollamaReq.Messages))
-	for i, msg := range ollamaReq.Messages {
-		messages[i] = map[string]interface{}{
-			"role":    msg.Role,
-			"content": msg.Content,
+// chatRequestBody converts an Ollama chat request to an OpenAI chat completion body
+func chatRequestBody(req ChatRequest) (map[string]interface{}, error) {
+	messages := make([]map[string]interface{}, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		converted, err := convertMessage(msg)
+		if err != nil {
+			return nil, err
 		}
+		messages = append(messages, converted)
 	}
 
-	openaiReq := map[string]interface{}{
-		"model":    modelID,
+	body := map[string]interface{}{
 		"messages": messages,
-		"stream":   ollamaReq.Stream,
 	}
+	req.Options.applyTo(body)
+	if err := applyFormat(body, req.Format, true); err != nil {
+		return nil, err
+	}
+	if len(req.Tools) > 0 && string(req.Tools) != "null" {
+		body["tools"] = req.Tools
+	}
+	if req.Think != nil {
+		body["chat_template_kwargs"] = map[string]interface{}{"enable_thinking": *req.Think}
+	}
+	return body, nil
+}
 
-	if ollamaReq.Options != nil {
-		if ollamaReq.Options.Temperature > 0 {
-			openaiReq["temperature"] = ollamaReq.Options.Temperature
+// convertMessage converts one Ollama message to the OpenAI form. Images
+// become image_url parts and tool call arguments are sent as a JSON string.
+func convertMessage(msg ChatMessage) (map[string]interface{}, error) {
+	converted := map[string]interface{}{
+		"role":    msg.Role,
+		"content": msg.Content,
+	}
+
+	if len(msg.Images) > 0 {
+		parts, err := imageParts(msg.Images)
+		if err != nil {
+			return nil, err
 		}
-		if ollamaReq.Options.TopP > 0 {
-			openaiReq["top_p"] = ollamaReq.Options.TopP
+		if msg.Content != "" {
+			parts = append([]map[string]interface{}{{"type": "text", "text": msg.Content}}, parts...)
 		}
-		if ollamaReq.Options.TopK > 0 {
-			openaiReq["top_k"] = ollamaReq.Options.TopK
+		converted["content"] = parts
+	}
+
+	if len(msg.ToolCalls) > 0 {
+		calls := make([]map[string]interface{}, 0, len(msg.ToolCalls))
+		for _, call := range msg.ToolCalls {
+			arguments := "{}"
+			if len(call.Function.Arguments) > 0 && string(call.Function.Arguments) != "null" {
+				arguments = string(call.Function.Arguments)
+			}
+			calls = append(calls, map[string]interface{}{
+				"type": "function",
+				"function": map[string]interface{}{
+					"name":      call.Function.Name,
+					"arguments": arguments,
+				},
+			})
 		}
+		converted["tool_calls"] = calls
 	}
 
-	// Marshal request body
-	body, err := json.Marshal(openaiReq)
-	if err != nil {
-		h.sendError(c, http.StatusInternalServerError, err.Error())
-		return
+	if msg.Role == "tool" && msg.ToolName != "" {
+		converted["name"] = msg.ToolName
 	}
+	return converted, nil
+}
 
-	url := fmt.Sprintf("http://127.0.0.1:%d/v1/chat/completions", port)
+// messagesHaveImages reports whether any message carries images
+func messagesHaveImages(messages []ChatMessage) bool {
+	for _, msg := range messages {
+		if len(msg.Images) > 0 {
+			return true
+		}
+	}
+	return false
+}
 
-	// Create HTTP request
-	httpReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", url, bytes.NewReader(body))
+// chatRouteHints describes a chat request for virtual model routing
+func chatRouteHints(req ChatRequest) model.RouteHints {
+	texts := make([]string, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		texts = append(texts, msg.Content)
+	}
+	tools := bytes.TrimSpace(req.Tools)
+	return model.RouteHints{
+		PromptTokens: model.EstimateTokens(texts...),
+		Tools:        len(tools) > 0 && !bytes.Equal(tools, []byte("null")) && !bytes.Equal(tools, []byte("[]")),
+		Vision:       messagesHaveImages(req.Messages),
+	}
+}
+
+// supportsVision reports whether the instance was started with a projector
+func (h *Handler) supportsVision(instanceID string) bool {
+	status, exists := h.modelMgr.GetStatus(instanceID)
+	return exists && status.Vision
+}
+
+// postJSON sends a JSON request to llama.cpp and decodes a successful response into out
+func (h *Handler) postJSON(c *gin.Context, port int, path string, req interface{}, out interface{}) error {
+	body, err := json.Marshal(req)
 	if err != nil {
-		h.sendError(c, http.StatusInternalServerError, err.Error())
-		return
+		return err
 	}
 
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", port, path)
+	httpReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
 	httpReq.Header.Set("Content-Type", "application/json")
 
-	// Send request
 	resp, err := h.client.Do(httpReq)
 	if err != nil {
-		h.sendError(c, http.StatusBadGateway, err.Error())
 		logger.Errorf("转发请求到 llama.cpp 失败: %v", err)
-		return
+		return err
 	}
 	defer resp.Body.Close()
 
-	// Read response
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		h.sendError(c, http.StatusInternalServerError, err.Error())
-		return
+		return err
 	}
-
-	// Forward response
-	c.Header("Content-Type", "application/json")
-	c.Status(resp.StatusCode)
-	c.Writer.Write(respBody)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("llama.cpp returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return json.Unmarshal(respBody, out)
 }
 
 // sendError sends an error response
@@ -1,6 +1,7 @@
 package ollama
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -205,13 +206,13 @@ func TestHandler_findModel(t *testing.T) {
 	handler := NewHandler(modelMgr)
 
 	t.Run("no models loaded", func(t *testing.T) {
-		_, err := handler.findModel("test-model")
+		_, err := handler.modelMgr.Route(context.Background(), "test-model", model.RouteHints{}, "")
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "model not found")
 	})
 
 	t.Run("empty model name", func(t *testing.T) {
-		_, err := handler.findModel("")
+		_, err := handler.modelMgr.Route(context.Background(), "", model.RouteHints{}, "")
 		assert.Error(t, err)
 	})
 }
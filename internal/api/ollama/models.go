@@ -0,0 +1,317 @@
+package ollama
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+)
+
+// Version is the Ollama API version reported by /api/version. Clients use it
+// to decide which endpoints and fields they may rely on.
+const Version = "0.9.0"
+
+// ModelInfo describes a model in /api/tags and /api/ps responses
+type ModelInfo struct {
+	Name          string       `json:"name"`
+	Model         string       `json:"model"`
+	ModifiedAt    string       `json:"modified_at,omitempty"`
+	Size          int64        `json:"size"`
+	Digest        string       `json:"digest"`
+	Details       ModelDetails `json:"details"`
+	ExpiresAt     string       `json:"expires_at,omitempty"`
+	SizeVRAM      int64        `json:"size_vram,omitempty"`
+	ContextLength int          `json:"context_length,omitempty"`
+}
+
+// ModelDetails is the model summary Ollama reports for each model
+type ModelDetails struct {
+	ParentModel       string   `json:"parent_model"`
+	Format            string   `json:"format"`
+	Family            string   `json:"family"`
+	Families          []string `json:"families"`
+	ParameterSize     string   `json:"parameter_size"`
+	QuantizationLevel string   `json:"quantization_level"`
+}
+
+// ModelRequest names the model for /api/show and /api/delete; older clients
+// send "name" instead of "model"
+type ModelRequest struct {
+	Model   string `json:"model"`
+	Name    string `json:"name"`
+	Verbose bool   `json:"verbose,omitempty"`
+}
+
+// ShowResponse represents an Ollama show response
+type ShowResponse struct {
+	Modelfile    string                 `json:"modelfile"`
+	Parameters   string                 `json:"parameters"`
+	Template     string                 `json:"template"`
+	Details      ModelDetails           `json:"details"`
+	ModelInfo    map[string]interface{} `json:"model_info"`
+	Capabilities []string               `json:"capabilities"`
+	ModifiedAt   string                 `json:"modified_at,omitempty"`
+}
+
+// HandleTags lists all scanned models in Ollama's format
+func (h *Handler) HandleTags(c *gin.Context) {
+	models := h.modelMgr.ListModels()
+	sort.Slice(models, func(i, j int) bool {
+		return tagName(models[i]) < tagName(models[j])
+	})
+
+	tags := make([]ModelInfo, 0, len(models))
+	for _, m := range models {
+		tags = append(tags, modelInfo(m))
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"models": tags,
+	})
+}
+
+// HandleShow describes a model from its GGUF metadata
+func (h *Handler) HandleShow(c *gin.Context) {
+	var req ModelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	m, ok := h.resolveModel(req.name())
+	if !ok {
+		h.sendError(c, http.StatusNotFound, fmt.Sprintf("model %q not found", req.name()))
+		return
+	}
+	status, _ := h.modelMgr.GetStatus(m.ID)
+
+	resp := ShowResponse{
+		Modelfile:    fmt.Sprintf("# Modelfile generated by Shepherd\nFROM %s\n", m.Path),
+		Details:      modelDetails(m),
+		ModelInfo:    map[string]interface{}{},
+		Capabilities: []string{"completion"},
+		ModifiedAt:   formatTime(m.ScannedAt),
+	}
+
+	if meta := m.Metadata; meta != nil {
+		if template, ok := meta.Extra["tokenizer.chat_template"].(string); ok {
+			resp.Template = template
+		}
+
+		arch := meta.Architecture
+		info := resp.ModelInfo
+		info["general.architecture"] = arch
+		info["general.name"] = meta.Name
+		info["general.parameter_count"] = int64(meta.Parameters)
+		info["general.quantization_version"] = meta.QuantizationVersion
+		info["general.file_type"] = meta.FileType
+		for key, value := range map[string]int{
+			"context_length":          meta.ContextLength,
+			"embedding_length":        meta.EmbeddingLength,
+			"block_count":             meta.BlockSize,
+			"feed_forward_length":     meta.FeedForwardLength,
+			"attention.head_count":    meta.HeadCount,
+			"attention.head_count_kv": meta.HeadCountKV,
+			"rope.dimension_count":    meta.RopeDim,
+		} {
+			if value > 0 {
+				info[arch+"."+key] = value
+			}
+		}
+		if meta.TokenizerModel != "" {
+			info["tokenizer.ggml.model"] = meta.TokenizerModel
+		}
+	}
+
+	if status != nil && status.State == model.StateLoaded {
+		if status.CtxSize > 0 {
+			resp.Parameters = fmt.Sprintf("num_ctx %d", status.CtxSize)
+			resp.Modelfile += "PARAMETER " + resp.Parameters + "\n"
+		}
+		// 以 --embedding 启动的实例只提供向量接口
+		if status.Embedding {
+			resp.Capabilities = []string{"embedding"}
+		}
+	}
+	if m.MmprojPath != "" {
+		resp.Capabilities = append(resp.Capabilities, "vision")
+	}
+	if strings.Contains(resp.Template, "tools") {
+		resp.Capabilities = append(resp.Capabilities, "tools")
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandlePs lists the running model instances
+func (h *Handler) HandlePs(c *gin.Context) {
+	now := time.Now()
+	running := make([]ModelInfo, 0)
+
+	for id, status := range h.modelMgr.ListStatus() {
+		if status.State != model.StateLoaded {
+			continue
+		}
+		modelID := status.ModelID
+		if modelID == "" {
+			modelID = id
+		}
+		m, ok := h.modelMgr.GetModel(modelID)
+		if !ok {
+			continue
+		}
+
+		info := modelInfo(m)
+		info.ContextLength = status.CtxSize
+		// 不会空闲卸载的实例返回一个遥远的过期时间，与 Ollama 对 keep_alive -1 的处理一致
+		expiresAt := now.Add(time.Duration(math.MaxInt64))
+		if remaining, ok := h.modelMgr.IdleRemaining(id); ok {
+			expiresAt = now.Add(remaining)
+		}
+		info.ExpiresAt = formatTime(expiresAt)
+		running = append(running, info)
+	}
+
+	sort.Slice(running, func(i, j int) bool {
+		return running[i].Name < running[j].Name
+	})
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"models": running,
+	})
+}
+
+// HandleVersion returns the Ollama API version
+func (h *Handler) HandleVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"version": Version,
+	})
+}
+
+// HandleDelete unloads a model and removes its files
+func (h *Handler) HandleDelete(c *gin.Context) {
+	var req ModelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	m, ok := h.resolveModel(req.name())
+	if !ok {
+		h.sendError(c, http.StatusNotFound, fmt.Sprintf("model %q not found", req.name()))
+		return
+	}
+
+	if err := h.modelMgr.DeleteModel(m.ID); err != nil {
+		switch {
+		case errors.Is(err, model.ErrModelNotFound):
+			h.sendError(c, http.StatusNotFound, err.Error())
+		case errors.Is(err, model.ErrModelBusy):
+			h.sendError(c, http.StatusConflict, err.Error())
+		default:
+			h.sendError(c, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+func (r ModelRequest) name() string {
+	if r.Model != "" {
+		return r.Model
+	}
+	return r.Name
+}
+
+// resolveModel finds a scanned model by tag name, alias, name or ID without
+// loading it
+func (h *Handler) resolveModel(name string) (*model.Model, bool) {
+	if m, ok := h.modelMgr.ResolveModel(name); ok {
+		return m, true
+	}
+	return h.modelMgr.ResolveModel(trimTag(name))
+}
+
+// tagName returns the Ollama "name:tag" form of a model name
+func tagName(m *model.Model) string {
+	name := m.Alias
+	if name == "" {
+		name = m.Name
+	}
+	if name == "" {
+		name = m.ID
+	}
+	if !strings.Contains(name, ":") {
+		name += ":latest"
+	}
+	return name
+}
+
+// trimTag removes the default ":latest" tag clients append to model names
+func trimTag(name string) string {
+	return strings.TrimSuffix(name, ":latest")
+}
+
+func modelInfo(m *model.Model) ModelInfo {
+	size := m.TotalSize
+	if size == 0 {
+		size = m.Size
+	}
+	digest := sha256.Sum256([]byte(m.Path))
+
+	name := tagName(m)
+	return ModelInfo{
+		Name:       name,
+		Model:      name,
+		ModifiedAt: formatTime(m.ScannedAt),
+		Size:       size,
+		Digest:     hex.EncodeToString(digest[:]),
+		Details:    modelDetails(m),
+	}
+}
+
+func modelDetails(m *model.Model) ModelDetails {
+	details := ModelDetails{
+		Format:   "gguf",
+		Families: []string{},
+	}
+	if meta := m.Metadata; meta != nil {
+		details.Family = meta.Architecture
+		if meta.Architecture != "" {
+			details.Families = []string{meta.Architecture}
+		}
+		details.ParameterSize = parameterSize(meta.Parameters)
+		details.QuantizationLevel = meta.Quantization
+	}
+	return details
+}
+
+// parameterSize formats a parameter count the way Ollama does, e.g. "7.6B"
+func parameterSize(parameters float64) string {
+	switch {
+	case parameters >= 1e9:
+		return fmt.Sprintf("%.1fB", parameters/1e9)
+	case parameters >= 1e6:
+		return fmt.Sprintf("%.1fM", parameters/1e6)
+	case parameters > 0:
+		return fmt.Sprintf("%.0f", parameters)
+	default:
+		return ""
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
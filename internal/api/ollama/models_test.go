@@ -0,0 +1,160 @@
+package ollama
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/gguf"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/modelrepo"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTagName(t *testing.T) {
+	assert.Equal(t, "qwen:latest", tagName(&model.Model{ID: "id", Name: "Qwen", Alias: "qwen"}))
+	assert.Equal(t, "Qwen:latest", tagName(&model.Model{ID: "id", Name: "Qwen"}))
+	assert.Equal(t, "qwen:7b", tagName(&model.Model{ID: "id", Alias: "qwen:7b"}))
+	assert.Equal(t, "id:latest", tagName(&model.Model{ID: "id"}))
+
+	assert.Equal(t, "qwen", trimTag("qwen:latest"))
+	assert.Equal(t, "qwen:7b", trimTag("qwen:7b"))
+}
+
+func TestParameterSize(t *testing.T) {
+	assert.Equal(t, "7.6B", parameterSize(7.6e9))
+	assert.Equal(t, "494.0M", parameterSize(494e6))
+	assert.Equal(t, "", parameterSize(0))
+}
+
+func TestHandler_ModelEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	dir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Model.Paths = []string{dir}
+	cfg.Model.PathConfigs = nil
+	modelMgr := model.NewManager(cfg, nil, process.NewManager())
+	handler := NewHandler(modelMgr)
+
+	router := gin.New()
+	router.GET("/api/tags", handler.HandleTags)
+	router.GET("/api/ps", handler.HandlePs)
+	router.GET("/api/version", handler.HandleVersion)
+	router.POST("/api/show", handler.HandleShow)
+	router.DELETE("/api/delete", handler.HandleDelete)
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Version", func(t *testing.T) {
+		w := do("GET", "/api/version", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"version":"`+Version+`"}`, w.Body.String())
+	})
+
+	t.Run("Show unknown model", func(t *testing.T) {
+		w := do("POST", "/api/show", `{"model": "missing"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Delete unknown model", func(t *testing.T) {
+		w := do("DELETE", "/api/delete", `{"model": "missing"}`)
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Empty lists", func(t *testing.T) {
+		for _, path := range []string{"/api/tags", "/api/ps"} {
+			w := do("GET", path, "")
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, `{"models":[]}`, w.Body.String())
+		}
+	})
+}
+
+func TestSelectPullFiles(t *testing.T) {
+	files := []modelrepo.FileInfo{
+		{Name: "Qwen3-8B-Q4_K_M.gguf", Size: 5},
+		{Name: "Qwen3-8B-Q4_K_S.gguf", Size: 4},
+		{Name: "Q8_0/Qwen3-8B-Q8_0-00002-of-00002.gguf", Size: 8},
+		{Name: "Q8_0/Qwen3-8B-Q8_0-00001-of-00002.gguf", Size: 8},
+		{Name: "mmproj-Qwen3-8B-f16.gguf", Size: 1},
+		{Name: "../escape-Q4_K_M.gguf", Size: 1},
+	}
+
+	names := func(selected []modelrepo.FileInfo) []string {
+		var result []string
+		for _, file := range selected {
+			result = append(result, file.Name)
+		}
+		return result
+	}
+
+	selected, err := selectPullFiles(files, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Qwen3-8B-Q4_K_M.gguf", "mmproj-Qwen3-8B-f16.gguf"}, names(selected))
+
+	selected, err = selectPullFiles(files, "q8_0")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"Q8_0/Qwen3-8B-Q8_0-00001-of-00002.gguf",
+		"Q8_0/Qwen3-8B-Q8_0-00002-of-00002.gguf",
+		"mmproj-Qwen3-8B-f16.gguf",
+	}, names(selected))
+
+	// Q4_K 不应匹配 Q4_K_M
+	_, err = selectPullFiles(files, "Q4_K")
+	assert.Error(t, err)
+}
+
+func TestParsePullName(t *testing.T) {
+	repoID, quant, err := parsePullName("hf.co/Qwen/Qwen3-8B-GGUF:Q8_0")
+	require.NoError(t, err)
+	assert.Equal(t, "Qwen/Qwen3-8B-GGUF", repoID)
+	assert.Equal(t, "Q8_0", quant)
+
+	repoID, quant, err = parsePullName("Qwen/Qwen3-8B-GGUF:latest")
+	require.NoError(t, err)
+	assert.Equal(t, "Qwen/Qwen3-8B-GGUF", repoID)
+	assert.Empty(t, quant)
+
+	_, _, err = parsePullName("llama3")
+	assert.Error(t, err)
+}
+
+func TestModelInfo(t *testing.T) {
+	info := modelInfo(&model.Model{
+		ID:        "qwen3-8b",
+		Name:      "Qwen3 8B",
+		Alias:     "qwen3",
+		Path:      "/models/Qwen3-8B-Q4_K_M.gguf",
+		Size:      5 << 30,
+		TotalSize: 10 << 30,
+		Metadata: &gguf.Metadata{
+			Architecture: "qwen3",
+			Parameters:   8.19e9,
+			Quantization: "Q4_K_M",
+		},
+	})
+
+	assert.Equal(t, "qwen3:latest", info.Name)
+	assert.Equal(t, int64(10<<30), info.Size)
+	assert.Len(t, info.Digest, 64)
+	assert.Equal(t, ModelDetails{
+		Format:            "gguf",
+		Family:            "qwen3",
+		Families:          []string{"qwen3"},
+		ParameterSize:     "8.2B",
+		QuantizationLevel: "Q4_K_M",
+	}, info.Details)
+}
@@ -0,0 +1,157 @@
+package ollama
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UnmarshalJSON decodes the options and remembers which keys were sent, so
+// that explicit zero values such as "temperature": 0 are forwarded
+func (p *GenerationParams) UnmarshalJSON(data []byte) error {
+	type plain GenerationParams
+	var decoded plain
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+
+	var keys map[string]json.RawMessage
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return err
+	}
+
+	*p = GenerationParams(decoded)
+	p.present = make(map[string]bool, len(keys))
+	for key := range keys {
+		p.present[key] = true
+	}
+	return nil
+}
+
+// applyTo copies the sampling options to a llama-server request body.
+// Load-time options such as num_ctx and num_gpu are ignored; they are part
+// of the model's load configuration.
+func (p *GenerationParams) applyTo(body map[string]interface{}) {
+	if p == nil {
+		return
+	}
+
+	set := func(key, target string, value interface{}, nonZero bool) {
+		// 选项来自请求时按出现的键转发，代码构造时只转发非零值
+		if p.present[key] || (p.present == nil && nonZero) {
+			body[target] = value
+		}
+	}
+
+	set("temperature", "temperature", p.Temperature, p.Temperature != 0)
+	set("top_p", "top_p", p.TopP, p.TopP != 0)
+	set("top_k", "top_k", p.TopK, p.TopK != 0)
+	set("min_p", "min_p", p.MinP, p.MinP != 0)
+	set("typical_p", "typical_p", p.TypicalP, p.TypicalP != 0)
+	set("num_predict", "n_predict", p.NumPredict, p.NumPredict != 0)
+	set("num_keep", "n_keep", p.NumKeep, p.NumKeep != 0)
+	set("repeat_penalty", "repeat_penalty", p.RepeatPenalty, p.RepeatPenalty != 0)
+	set("repeat_last_n", "repeat_last_n", p.RepeatLastN, p.RepeatLastN != 0)
+	set("presence_penalty", "presence_penalty", p.PresencePenalty, p.PresencePenalty != 0)
+	set("frequency_penalty", "frequency_penalty", p.FrequencyPenalty, p.FrequencyPenalty != 0)
+	set("seed", "seed", p.Seed, p.Seed != 0)
+	set("mirostat", "mirostat", p.Mirostat, p.Mirostat != 0)
+	set("mirostat_tau", "mirostat_tau", p.MirostatTau, p.MirostatTau != 0)
+	set("mirostat_eta", "mirostat_eta", p.MirostatEta, p.MirostatEta != 0)
+	set("stop", "stop", p.Stop, len(p.Stop) > 0)
+}
+
+// parseKeepAlive parses Ollama's keep_alive field: a number of seconds or a
+// duration string such as "5m". A negative value keeps the model loaded
+// indefinitely and zero unloads it after the request. The second return
+// value is false when the field was not sent.
+func parseKeepAlive(raw json.RawMessage) (time.Duration, bool, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, false, nil
+	}
+
+	var seconds float64
+	if err := json.Unmarshal(raw, &seconds); err == nil {
+		return time.Duration(seconds * float64(time.Second)), true, nil
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		return 0, false, fmt.Errorf("invalid keep_alive: %s", raw)
+	}
+	if seconds, err := strconv.ParseFloat(text, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), true, nil
+	}
+	d, err := time.ParseDuration(text)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid keep_alive: %q", text)
+	}
+	return d, true, nil
+}
+
+// applyFormat maps Ollama's format field ("json" or a JSON schema) to a
+// llama-server constraint. Chat requests use response_format, raw
+// completions use json_schema.
+func applyFormat(body map[string]interface{}, format json.RawMessage, chat bool) error {
+	format = bytes.TrimSpace(format)
+	if len(format) == 0 || string(format) == "null" || string(format) == `""` {
+		return nil
+	}
+
+	var schema json.RawMessage
+	var text string
+	if err := json.Unmarshal(format, &text); err == nil {
+		if text != "json" {
+			return fmt.Errorf("invalid format: %q", text)
+		}
+	} else if format[0] == '{' && json.Valid(format) {
+		schema = format
+	} else {
+		return fmt.Errorf("invalid format: %s", format)
+	}
+
+	if !chat {
+		if schema == nil {
+			schema = json.RawMessage(`{}`)
+		}
+		body["json_schema"] = schema
+		return nil
+	}
+
+	if schema == nil {
+		body["response_format"] = map[string]interface{}{"type": "json_object"}
+		return nil
+	}
+	body["response_format"] = map[string]interface{}{
+		"type":        "json_schema",
+		"json_schema": map[string]interface{}{"schema": schema},
+	}
+	return nil
+}
+
+// imageParts converts base64 images to OpenAI image_url content parts. The
+// media type is detected from the image data.
+func imageParts(images []string) ([]map[string]interface{}, error) {
+	parts := make([]map[string]interface{}, 0, len(images))
+	for i, image := range images {
+		data, err := base64.StdEncoding.DecodeString(image)
+		if err != nil {
+			return nil, fmt.Errorf("invalid image %d: %w", i, err)
+		}
+		mediaType := http.DetectContentType(data)
+		if !strings.HasPrefix(mediaType, "image/") {
+			return nil, fmt.Errorf("invalid image %d: unsupported content type %s", i, mediaType)
+		}
+		parts = append(parts, map[string]interface{}{
+			"type":      "image_url",
+			"image_url": map[string]interface{}{"url": "data:" + mediaType + ";base64," + image},
+		})
+	}
+	return parts, nil
+}
@@ -0,0 +1,138 @@
+package ollama
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerationParamsApply(t *testing.T) {
+	t.Run("Forwards options sent by the client", func(t *testing.T) {
+		var params GenerationParams
+		require.NoError(t, json.Unmarshal([]byte(`{
+			"temperature": 0,
+			"num_predict": 128,
+			"num_keep": 4,
+			"repeat_last_n": 64,
+			"min_p": 0.05,
+			"seed": 42,
+			"stop": ["</s>"],
+			"num_ctx": 8192,
+			"num_gpu": 99
+		}`), &params))
+
+		body := map[string]interface{}{}
+		params.applyTo(body)
+		assert.Equal(t, map[string]interface{}{
+			"temperature":   0.0,
+			"n_predict":     128,
+			"n_keep":        4,
+			"repeat_last_n": 64,
+			"min_p":         0.05,
+			"seed":          42,
+			"stop":          []string{"</s>"},
+		}, body)
+	})
+
+	t.Run("Built in code forwards non-zero values", func(t *testing.T) {
+		body := map[string]interface{}{}
+		(&GenerationParams{TopK: 40}).applyTo(body)
+		assert.Equal(t, map[string]interface{}{"top_k": 40}, body)
+	})
+
+	t.Run("Nil options", func(t *testing.T) {
+		body := map[string]interface{}{}
+		(*GenerationParams)(nil).applyTo(body)
+		assert.Empty(t, body)
+	})
+}
+
+func TestParseKeepAlive(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    time.Duration
+		set     bool
+		wantErr bool
+	}{
+		{raw: ``, set: false},
+		{raw: `null`, set: false},
+		{raw: `300`, want: 5 * time.Minute, set: true},
+		{raw: `0`, want: 0, set: true},
+		{raw: `-1`, want: -time.Second, set: true},
+		{raw: `"10m"`, want: 10 * time.Minute, set: true},
+		{raw: `"-1m"`, want: -time.Minute, set: true},
+		{raw: `"3600"`, want: time.Hour, set: true},
+		{raw: `"soon"`, wantErr: true},
+		{raw: `true`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, set, err := parseKeepAlive(json.RawMessage(tt.raw))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.set, set)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestApplyFormat(t *testing.T) {
+	body := map[string]interface{}{}
+	require.NoError(t, applyFormat(body, json.RawMessage(`"json"`), true))
+	assert.Equal(t, map[string]interface{}{"type": "json_object"}, body["response_format"])
+
+	body = map[string]interface{}{}
+	schema := `{"type":"object","properties":{"age":{"type":"integer"}}}`
+	require.NoError(t, applyFormat(body, json.RawMessage(schema), true))
+	assert.JSONEq(t, `{"type":"json_schema","json_schema":{"schema":`+schema+`}}`, mustJSON(t, body["response_format"]))
+
+	body = map[string]interface{}{}
+	require.NoError(t, applyFormat(body, json.RawMessage(schema), false))
+	assert.JSONEq(t, schema, mustJSON(t, body["json_schema"]))
+
+	body = map[string]interface{}{}
+	require.NoError(t, applyFormat(body, nil, true))
+	assert.Empty(t, body)
+
+	assert.Error(t, applyFormat(body, json.RawMessage(`"yaml"`), true))
+}
+
+func TestConvertMessage(t *testing.T) {
+	// 1x1 PNG
+	png := "iVBORw0KGgoAAAANSUhEUgAAAAEAAAABCAYAAAAfFcSJAAAADUlEQVR42mNk+M9QDwADhgGAWjR9awAAAABJRU5ErkJggg=="
+
+	converted, err := convertMessage(ChatMessage{Role: "user", Content: "What is this?", Images: []string{png}})
+	require.NoError(t, err)
+	parts := converted["content"].([]map[string]interface{})
+	require.Len(t, parts, 2)
+	assert.Equal(t, "What is this?", parts[0]["text"])
+	assert.Equal(t, "data:image/png;base64,"+png, parts[1]["image_url"].(map[string]interface{})["url"])
+
+	_, err = convertMessage(ChatMessage{Role: "user", Images: []string{"not base64!"}})
+	assert.Error(t, err)
+
+	var msg ChatMessage
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"role": "assistant",
+		"content": "",
+		"tool_calls": [{"function": {"name": "get_weather", "arguments": {"city": "Paris"}}}]
+	}`), &msg))
+	converted, err = convertMessage(msg)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"type":"function","function":{"name":"get_weather","arguments":"{\"city\": \"Paris\"}"}}]`,
+		mustJSON(t, converted["tool_calls"]))
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return string(data)
+}
@@ -0,0 +1,229 @@
+package ollama
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/modelrepo"
+)
+
+// defaultPullQuant is pulled when the model name has no quantization tag,
+// as Ollama does for Hugging Face repositories
+const defaultPullQuant = "Q4_K_M"
+
+// shardSuffix matches the suffix of split GGUF files
+var shardSuffix = regexp.MustCompile(`-\d{5}-of-\d{5}\.gguf$`)
+
+// PullRequest represents an Ollama pull request
+type PullRequest struct {
+	Model    string `json:"model"`
+	Name     string `json:"name"`
+	Insecure bool   `json:"insecure,omitempty"`
+	Stream   *bool  `json:"stream,omitempty"` // 未指定时默认流式
+}
+
+// PullResponse is one progress line of a pull
+type PullResponse struct {
+	Status    string `json:"status"`
+	Digest    string `json:"digest,omitempty"`
+	Total     int64  `json:"total,omitempty"`
+	Completed int64  `json:"completed,omitempty"`
+}
+
+// SetModelRepo sets the repository client used by /api/pull
+func (h *Handler) SetModelRepo(repo *modelrepo.Client) {
+	h.repo = repo
+}
+
+// HandlePull downloads a GGUF model from Hugging Face into the first model
+// path and rescans. Models are named "hf.co/owner/repo:quant"; the registry
+// prefix and the quantization tag are optional.
+func (h *Handler) HandlePull(c *gin.Context) {
+	var req PullRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := req.Model
+	if name == "" {
+		name = req.Name
+	}
+	repoID, quant, err := parsePullName(name)
+	if err != nil {
+		h.sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if h.repo == nil {
+		h.sendError(c, http.StatusServiceUnavailable, "model repository is not configured")
+		return
+	}
+	scanPaths := h.modelMgr.ScanPaths()
+	if len(scanPaths) == 0 {
+		h.sendError(c, http.StatusInternalServerError, "no model path configured")
+		return
+	}
+
+	files, err := h.repo.ListGGUFFiles(repoID)
+	if err != nil {
+		h.sendError(c, http.StatusBadGateway, fmt.Sprintf("pull model manifest: %v", err))
+		return
+	}
+	selected, err := selectPullFiles(files, quant)
+	if err != nil {
+		h.sendError(c, http.StatusNotFound, err.Error())
+		return
+	}
+
+	stream := req.Stream == nil || *req.Stream
+	var mu sync.Mutex
+	g := &generation{stream: stream}
+	if stream {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Cache-Control", "no-cache")
+		c.Status(http.StatusOK)
+		g.w = c.Writer
+		g.flusher = c.Writer
+	}
+	// 下载进度回调可能来自其他 goroutine
+	progress := func(resp PullResponse) {
+		if !stream {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		g.writeLine(resp)
+	}
+	fail := func(err error) {
+		logger.Error("拉取模型失败", "model", name, "error", err)
+		mu.Lock()
+		defer mu.Unlock()
+		h.generationFailed(c, g, err.Error())
+	}
+
+	progress(PullResponse{Status: "pulling manifest"})
+
+	targetDir := filepath.Join(scanPaths[0], filepath.FromSlash(repoID))
+	for _, file := range selected {
+		target := filepath.Join(targetDir, filepath.FromSlash(file.Name))
+		if info, err := os.Stat(target); err == nil && info.Size() == file.Size {
+			progress(PullResponse{Status: "pulling " + file.Name, Digest: file.Name, Total: file.Size, Completed: file.Size})
+			continue
+		}
+
+		logger.Info("开始拉取模型文件", "repoId", repoID, "file", file.Name, "target", target)
+		progress(PullResponse{Status: "pulling " + file.Name, Digest: file.Name, Total: file.Size})
+		err := h.repo.DownloadFile(c.Request.Context(), repoID, file.Name, target, func(p modelrepo.Progress) {
+			progress(PullResponse{
+				Status:    "pulling " + file.Name,
+				Digest:    file.Name,
+				Total:     file.Size,
+				Completed: int64(p.Percentage / 100 * float64(file.Size)),
+			})
+		})
+		if err != nil {
+			fail(fmt.Errorf("download %s: %w", file.Name, err))
+			return
+		}
+	}
+
+	if _, err := h.modelMgr.Scan(c.Request.Context()); err != nil {
+		fail(fmt.Errorf("scan models: %w", err))
+		return
+	}
+
+	if !stream {
+		c.JSON(http.StatusOK, PullResponse{Status: "success"})
+		return
+	}
+	progress(PullResponse{Status: "success"})
+}
+
+// parsePullName splits a pull name into the repository ID and the
+// quantization tag; "latest" means the default quantization
+func parsePullName(name string) (repoID, quant string, err error) {
+	trimmed := strings.TrimPrefix(name, "https://")
+	for _, prefix := range []string{"hf.co/", "huggingface.co/"} {
+		trimmed = strings.TrimPrefix(trimmed, prefix)
+	}
+
+	repoID, quant, _ = strings.Cut(trimmed, ":")
+	if quant == "latest" {
+		quant = ""
+	}
+	owner, repo, err := modelrepo.ParseRepoID(repoID)
+	if err != nil || owner == "" || repo == "" {
+		return "", "", fmt.Errorf("invalid model name %q: expected hf.co/owner/repo[:quant]", name)
+	}
+	return repoID, quant, nil
+}
+
+// selectPullFiles picks the weight files for a quantization tag, including
+// all shards of a split model, and the first multimodal projector
+func selectPullFiles(files []modelrepo.FileInfo, quant string) ([]modelrepo.FileInfo, error) {
+	var weights, projectors []modelrepo.FileInfo
+	for _, file := range files {
+		if !filepath.IsLocal(filepath.FromSlash(file.Name)) {
+			continue
+		}
+		if strings.Contains(strings.ToLower(filepath.Base(file.Name)), "mmproj") {
+			projectors = append(projectors, file)
+		} else {
+			weights = append(weights, file)
+		}
+	}
+	sort.Slice(weights, func(i, j int) bool { return weights[i].Name < weights[j].Name })
+	sort.Slice(projectors, func(i, j int) bool { return projectors[i].Name < projectors[j].Name })
+
+	chosen := matchQuant(weights, quant)
+	if chosen == nil && quant == "" {
+		if chosen = matchQuant(weights, defaultPullQuant); chosen == nil && len(weights) > 0 {
+			chosen = &weights[0]
+		}
+	}
+	if chosen == nil {
+		if quant == "" {
+			return nil, fmt.Errorf("no GGUF files found in repository")
+		}
+		return nil, fmt.Errorf("no GGUF file matches quantization %q", quant)
+	}
+
+	selected := []modelrepo.FileInfo{*chosen}
+	if shardSuffix.MatchString(chosen.Name) {
+		prefix := shardSuffix.ReplaceAllString(chosen.Name, "")
+		selected = selected[:0]
+		for _, file := range weights {
+			if shardSuffix.MatchString(file.Name) && shardSuffix.ReplaceAllString(file.Name, "") == prefix {
+				selected = append(selected, file)
+			}
+		}
+	}
+	if len(projectors) > 0 {
+		selected = append(selected, projectors[0])
+	}
+	return selected, nil
+}
+
+// matchQuant returns the first file whose name contains the quantization tag
+// as a separate token, so that "Q4_K" does not match "Q4_K_M"
+func matchQuant(files []modelrepo.FileInfo, quant string) *modelrepo.FileInfo {
+	if quant == "" {
+		return nil
+	}
+	pattern := regexp.MustCompile(`(?i)(^|[^a-z0-9])` + regexp.QuoteMeta(quant) + `([^a-z0-9_]|$)`)
+	for i := range files {
+		if pattern.MatchString(files[i].Name) {
+			return &files[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,363 @@
+package ollama
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/capture"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/filter"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
+)
+
+// generation is one chat or generate request relayed from llama-server.
+// Upstream is always streamed; the client gets NDJSON chunks or, with
+// stream disabled, a single aggregated response.
+type generation struct {
+	model        string // 客户端请求的模型名，原样返回
+	instanceID   string
+	endpoint     string // 记录用量的 Ollama 接口路径
+	chat         bool   // /api/chat 返回 message，/api/generate 返回 response
+	stream       bool
+	start        time.Time
+	loadDuration time.Duration
+	turn         *capture.Turn  // 记录到会话存储，不记录时为 nil
+	filters      *filter.Stream // 过滤生成的文本，不过滤时为 nil
+
+	w       io.Writer
+	flusher http.Flusher
+
+	content    strings.Builder // 非流式时累积的输出
+	thinking   strings.Builder
+	toolCalls  []*pendingToolCall
+	doneReason string
+	usage      usage.Usage
+	timings    *upstreamTimings
+}
+
+// pendingToolCall accumulates a streamed tool call until the response ends
+type pendingToolCall struct {
+	name      string
+	arguments strings.Builder
+}
+
+// upstreamChunk is the part of a llama-server completion chunk used here
+type upstreamChunk struct {
+	Choices []struct {
+		Text  string `json:"text"`
+		Delta struct {
+			Content          string `json:"content"`
+			ReasoningContent string `json:"reasoning_content"`
+			ToolCalls        []struct {
+				Index    int `json:"index"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Timings *upstreamTimings `json:"timings"`
+	Error   *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// upstreamTimings are the llama-server timings sent with the last chunk
+type upstreamTimings struct {
+	PromptN     int     `json:"prompt_n"`
+	PromptMS    float64 `json:"prompt_ms"`
+	PredictedN  int     `json:"predicted_n"`
+	PredictedMS float64 `json:"predicted_ms"`
+}
+
+// proxyGeneration sends body to llama-server and relays the result in
+// Ollama's format
+func (h *Handler) proxyGeneration(c *gin.Context, g *generation, port int, path string, body map[string]interface{}) {
+	body["stream"] = true
+	body["stream_options"] = map[string]interface{}{"include_usage": true}
+
+	payload, err := json.Marshal(body)
+	if err != nil {
+		h.sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", port, path)
+	httpReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		h.sendError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	sent := time.Now()
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		h.sendError(c, http.StatusBadGateway, err.Error())
+		logger.Errorf("转发请求到 llama.cpp 失败: %v", err)
+		h.modelMgr.ReportUpstreamError(g.instanceID, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	h.relayGeneration(c, g, resp, sent)
+}
+
+// relayGeneration translates an upstream chunk stream for the client
+func (h *Handler) relayGeneration(c *gin.Context, g *generation, resp *http.Response, sent time.Time) {
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		h.sendError(c, resp.StatusCode, upstreamErrorMessage(respBody))
+		return
+	}
+
+	if g.stream {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no") // Disable nginx buffering
+		c.Status(http.StatusOK)
+		g.w = c.Writer
+		g.flusher = c.Writer
+	}
+
+	defer func() {
+		h.usage.Record(c.Request, g.instanceID, g.endpoint, g.usage, sent, g.stream)
+		g.turn.Finish(g.instanceID)
+	}()
+
+	reader := bufio.NewReader(resp.Body)
+	for {
+		line, err := reader.ReadString('\n')
+		line = g.filters.Line(line)
+		if u, ok := usage.ParseStreamLine(line); ok {
+			g.usage = u
+		}
+		g.turn.ParseStreamLine(line)
+		if message := g.handleLine(line); message != "" {
+			h.generationFailed(c, g, message)
+			return
+		}
+		if g.filters.Blocked() {
+			// 被拦截后停止读取，以 done_reason content_filter 结束
+			break
+		}
+
+		if err != nil {
+			if c.Request.Context().Err() != nil {
+				return
+			}
+			if err != io.EOF {
+				logger.Errorf("读取流式响应失败: %v", err)
+				h.generationFailed(c, g, err.Error())
+				return
+			}
+			break
+		}
+	}
+
+	calls := g.completedToolCalls()
+	if !g.stream {
+		c.JSON(http.StatusOK, g.response(ChatMessage{
+			Content:   g.content.String(),
+			Thinking:  g.thinking.String(),
+			ToolCalls: calls,
+		}, true))
+		return
+	}
+
+	// Ollama 在单独的数据块中返回完整的工具调用
+	if len(calls) > 0 {
+		g.writeLine(g.response(ChatMessage{ToolCalls: calls}, false))
+	}
+	g.writeLine(g.response(ChatMessage{}, true))
+}
+
+// generationFailed reports an upstream error; once streaming has started it
+// is sent as a final {"error": ...} line
+func (h *Handler) generationFailed(c *gin.Context, g *generation, message string) {
+	if !g.stream {
+		h.sendError(c, http.StatusInternalServerError, message)
+		return
+	}
+	g.writeLine(map[string]interface{}{"error": message})
+}
+
+// handleLine processes one SSE line from upstream and returns the upstream
+// error message, if the line carries one
+func (g *generation) handleLine(line string) string {
+	data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+	if !ok {
+		return ""
+	}
+	data = strings.TrimSpace(data)
+	if data == "" || data == "[DONE]" {
+		return ""
+	}
+
+	var chunk upstreamChunk
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		logger.Warnf("解析流式响应数据块失败: %v", err)
+		return ""
+	}
+	if chunk.Error != nil {
+		return chunk.Error.Message
+	}
+	if chunk.Timings != nil {
+		g.timings = chunk.Timings
+	}
+
+	for _, choice := range chunk.Choices {
+		// /v1/completions 返回 text，/v1/chat/completions 返回 delta
+		content := choice.Text + choice.Delta.Content
+		thinking := choice.Delta.ReasoningContent
+		if content != "" || thinking != "" {
+			if g.stream {
+				g.writeLine(g.response(ChatMessage{Content: content, Thinking: thinking}, false))
+			} else {
+				g.content.WriteString(content)
+				g.thinking.WriteString(thinking)
+			}
+		}
+
+		for _, call := range choice.Delta.ToolCalls {
+			if call.Index < 0 {
+				continue
+			}
+			for len(g.toolCalls) <= call.Index {
+				g.toolCalls = append(g.toolCalls, &pendingToolCall{})
+			}
+			pending := g.toolCalls[call.Index]
+			if call.Function.Name != "" {
+				pending.name = call.Function.Name
+			}
+			pending.arguments.WriteString(call.Function.Arguments)
+		}
+
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			g.doneReason = doneReason(*choice.FinishReason)
+		}
+	}
+	return ""
+}
+
+// response builds a chat or generate response object for one chunk. The
+// final chunk carries done_reason and the timing metrics.
+func (g *generation) response(msg ChatMessage, done bool) interface{} {
+	createdAt := time.Now().UTC().Format(time.RFC3339Nano)
+
+	var metrics Metrics
+	var reason string
+	if done {
+		metrics = g.metrics()
+		reason = g.doneReason
+		if reason == "" {
+			reason = "stop"
+		}
+	}
+
+	if g.chat {
+		msg.Role = "assistant"
+		return ChatResponse{
+			Model:      g.model,
+			CreatedAt:  createdAt,
+			Message:    msg,
+			Done:       done,
+			DoneReason: reason,
+			Metrics:    metrics,
+		}
+	}
+	return GenerateResponse{
+		Model:      g.model,
+		CreatedAt:  createdAt,
+		Response:   msg.Content,
+		Thinking:   msg.Thinking,
+		Done:       done,
+		DoneReason: reason,
+		Metrics:    metrics,
+	}
+}
+
+// metrics converts token usage and llama-server timings to Ollama's fields
+func (g *generation) metrics() Metrics {
+	metrics := Metrics{
+		TotalDuration:   time.Since(g.start).Nanoseconds(),
+		LoadDuration:    g.loadDuration.Nanoseconds(),
+		PromptEvalCount: g.usage.PromptTokens,
+		EvalCount:       g.usage.CompletionTokens,
+	}
+	if g.timings != nil {
+		metrics.PromptEvalDuration = int64(g.timings.PromptMS * float64(time.Millisecond))
+		metrics.EvalDuration = int64(g.timings.PredictedMS * float64(time.Millisecond))
+		if metrics.PromptEvalCount == 0 {
+			metrics.PromptEvalCount = g.timings.PromptN
+		}
+		if metrics.EvalCount == 0 {
+			metrics.EvalCount = g.timings.PredictedN
+		}
+	}
+	return metrics
+}
+
+// completedToolCalls returns the accumulated tool calls with their
+// arguments decoded as JSON objects
+func (g *generation) completedToolCalls() []ToolCall {
+	var calls []ToolCall
+	for _, pending := range g.toolCalls {
+		if pending.name == "" {
+			continue
+		}
+		arguments := json.RawMessage(pending.arguments.String())
+		if len(bytes.TrimSpace(arguments)) == 0 || !json.Valid(arguments) {
+			// llama.cpp 对无参数的工具可能返回空字符串
+			arguments = json.RawMessage("{}")
+		}
+		calls = append(calls, ToolCall{Function: ToolCallFunction{Name: pending.name, Arguments: arguments}})
+	}
+	return calls
+}
+
+// writeLine writes one NDJSON line and flushes it to the client
+func (g *generation) writeLine(v interface{}) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		logger.Errorf("序列化流式响应失败: %v", err)
+		return
+	}
+	g.w.Write(append(payload, '\n'))
+	if g.flusher != nil {
+		g.flusher.Flush()
+	}
+}
+
+// doneReason maps an OpenAI finish_reason to Ollama's done_reason
+func doneReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "length"
+	case filter.FinishReason:
+		return filter.FinishReason
+	}
+	return "stop"
+}
+
+// upstreamErrorMessage extracts the error message from a llama-server error body
+func upstreamErrorMessage(body []byte) string {
+	var resp struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &resp); err == nil && resp.Error.Message != "" {
+		return resp.Error.Message
+	}
+	return strings.TrimSpace(string(body))
+}
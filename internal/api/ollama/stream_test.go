@@ -0,0 +1,136 @@
+package ollama
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// relayUpstream 用给定的上游响应体调用 relayGeneration，返回响应和解析后的 NDJSON 行
+func relayUpstream(t *testing.T, g *generation, status int, body string) (*httptest.ResponseRecorder, []map[string]interface{}) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	handler := NewHandler(model.NewManager(config.DefaultConfig(), nil, process.NewManager()))
+	upstream := &http.Response{
+		StatusCode: status,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/chat", nil)
+	g.model = "llama3:latest"
+	g.instanceID = "test-model"
+	g.start = time.Now()
+	handler.relayGeneration(c, g, upstream, time.Now())
+
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(strings.NewReader(w.Body.String()))
+	for scanner.Scan() {
+		var line map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	return w, lines
+}
+
+func sseBody(chunks ...string) string {
+	var b strings.Builder
+	for _, chunk := range chunks {
+		b.WriteString("data: " + chunk + "\n\n")
+	}
+	b.WriteString("data: [DONE]\n\n")
+	return b.String()
+}
+
+func TestRelayGeneration(t *testing.T) {
+	t.Run("Chat stream", func(t *testing.T) {
+		body := sseBody(
+			`{"choices":[{"index":0,"delta":{"role":"assistant","content":null}}]}`,
+			`{"choices":[{"index":0,"delta":{"reasoning_content":"Hmm"}}]}`,
+			`{"choices":[{"index":0,"delta":{"content":"Hello"}}]}`,
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"length"}],"timings":{"prompt_n":9,"prompt_ms":12.5,"predicted_n":2,"predicted_ms":40}}`,
+			`{"choices":[],"usage":{"prompt_tokens":11,"completion_tokens":2,"total_tokens":13}}`,
+		)
+
+		w, lines := relayUpstream(t, &generation{chat: true, stream: true}, http.StatusOK, body)
+		assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+		require.Len(t, lines, 3)
+
+		assert.Equal(t, "Hmm", lines[0]["message"].(map[string]interface{})["thinking"])
+		assert.Equal(t, "Hello", lines[1]["message"].(map[string]interface{})["content"])
+		assert.Equal(t, "assistant", lines[1]["message"].(map[string]interface{})["role"])
+		assert.Equal(t, false, lines[1]["done"])
+		assert.Equal(t, "llama3:latest", lines[1]["model"])
+
+		final := lines[2]
+		assert.Equal(t, true, final["done"])
+		assert.Equal(t, "length", final["done_reason"])
+		assert.Equal(t, 11.0, final["prompt_eval_count"])
+		assert.Equal(t, 2.0, final["eval_count"])
+		assert.Equal(t, 12.5e6, final["prompt_eval_duration"])
+		assert.Equal(t, 40e6, final["eval_duration"])
+	})
+
+	t.Run("Generate without streaming", func(t *testing.T) {
+		body := sseBody(
+			`{"choices":[{"index":0,"text":"Hello"}]}`,
+			`{"choices":[{"index":0,"text":" world","finish_reason":"stop"}]}`,
+		)
+
+		w, lines := relayUpstream(t, &generation{stream: false}, http.StatusOK, body)
+		assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+		require.Len(t, lines, 1)
+		assert.Equal(t, "Hello world", lines[0]["response"])
+		assert.Equal(t, true, lines[0]["done"])
+		assert.Equal(t, "stop", lines[0]["done_reason"])
+		assert.NotContains(t, lines[0], "message")
+	})
+
+	t.Run("Tool calls", func(t *testing.T) {
+		body := sseBody(
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","function":{"name":"get_weather","arguments":""}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"city\":"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`,
+			`{"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		)
+
+		_, lines := relayUpstream(t, &generation{chat: true, stream: true}, http.StatusOK, body)
+		require.Len(t, lines, 2)
+		calls := lines[0]["message"].(map[string]interface{})["tool_calls"].([]interface{})
+		require.Len(t, calls, 1)
+		assert.JSONEq(t, `{"function":{"name":"get_weather","arguments":{"city":"Paris"}}}`, mustJSON(t, calls[0]))
+		assert.Equal(t, "stop", lines[1]["done_reason"])
+	})
+
+	t.Run("Upstream error in stream", func(t *testing.T) {
+		body := sseBody(
+			`{"choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+			`{"error":{"code":500,"message":"context shift disabled"}}`,
+		)
+
+		_, lines := relayUpstream(t, &generation{chat: true, stream: true}, http.StatusOK, body)
+		require.Len(t, lines, 2)
+		assert.Equal(t, "context shift disabled", lines[1]["error"])
+	})
+
+	t.Run("Upstream error status", func(t *testing.T) {
+		w, lines := relayUpstream(t, &generation{chat: true, stream: true}, http.StatusBadRequest,
+			`{"error":{"code":400,"message":"prompt too long"}}`)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		assert.Equal(t, "prompt too long", lines[0]["error"])
+	})
+}
@@ -0,0 +1,372 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
+)
+
+// DefaultUBatchSize is llama.cpp's micro-batch size when --ubatch-size is not set
+const DefaultUBatchSize = 512
+
+// Batch is a half-open range [Start, End) of inputs sent in one upstream request
+type Batch struct {
+	Start int
+	End   int
+}
+
+// EstimateTokens roughly estimates the token count of a text without a
+// tokenizer. It assumes ~3 bytes per token, which over-counts English and
+// roughly matches CJK text, so batches stay on the safe side.
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 1
+	}
+	return (len(text) + 2) / 3
+}
+
+// SplitBatches groups consecutive inputs so that the summed token cost of each
+// batch fits within limit. An input larger than limit is sent on its own and
+// left to llama-server to accept or reject.
+func SplitBatches(costs []int, limit int) []Batch {
+	if limit <= 0 {
+		limit = DefaultUBatchSize
+	}
+
+	var batches []Batch
+	start, total := 0, 0
+	for i, cost := range costs {
+		if i > start && total+cost > limit {
+			batches = append(batches, Batch{Start: start, End: i})
+			start, total = i, 0
+		}
+		total += cost
+	}
+	if start < len(costs) {
+		batches = append(batches, Batch{Start: start, End: len(costs)})
+	}
+	return batches
+}
+
+// UBatchSize returns the micro-batch size a loaded model was started with
+func UBatchSize(status *model.ModelStatus) int {
+	if status == nil || status.UBatchSize <= 0 {
+		return DefaultUBatchSize
+	}
+	return status.UBatchSize
+}
+
+// HandleEmbeddings handles embedding requests
+func (h *Handler) HandleEmbeddings(c *gin.Context) {
+	var req EmbeddingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.sendError(c, http.StatusBadRequest, "invalid_request", err.Error(), "body")
+		return
+	}
+
+	if req.Model == "" {
+		h.sendError(c, http.StatusBadRequest, "invalid_request", "Missing required parameter: model", "model")
+		return
+	}
+
+	inputs, costs, err := parseEmbeddingInput(req.Input)
+	if err != nil {
+		h.sendError(c, http.StatusBadRequest, "invalid_request", err.Error(), "input")
+		return
+	}
+
+	actualModelID, status, ok := h.resolveLoadedModel(c, req.Model)
+	if !ok {
+		return
+	}
+
+	if !status.Embedding {
+		h.sendError(c, http.StatusBadRequest, "invalid_request_error",
+			fmt.Sprintf("Model %s does not support embeddings; load it with the embedding capability enabled", req.Model), "model")
+		return
+	}
+
+	done, err := h.modelMgr.AcquireSlot(c.Request.Context(), actualModelID)
+	if err != nil {
+		h.sendModelError(c, err)
+		return
+	}
+	defer done()
+	start := time.Now()
+
+	batches := SplitBatches(costs, UBatchSize(status))
+	if len(batches) == 1 {
+		h.forwardRequest(c, actualModelID, status.Port, "/v1/embeddings", &req, nil, nil)
+		return
+	}
+
+	logger.Debugf("向量请求分批转发: model=%s, inputs=%d, batches=%d", actualModelID, len(inputs), len(batches))
+
+	merged := EmbeddingResponse{
+		Object: "list",
+		Model:  req.Model,
+		Usage:  &Usage{},
+	}
+	for _, batch := range batches {
+		chunk := req
+		chunk.Input, err = json.Marshal(inputs[batch.Start:batch.End])
+		if err != nil {
+			h.sendError(c, http.StatusInternalServerError, "server_error", err.Error(), "")
+			return
+		}
+
+		var resp EmbeddingResponse
+		if !h.postUpstream(c, status.Port, "/v1/embeddings", &chunk, &resp) {
+			return
+		}
+
+		for _, data := range resp.Data {
+			data.Index += batch.Start
+			merged.Data = append(merged.Data, data)
+		}
+		if resp.Usage != nil {
+			merged.Usage.PromptTokens += resp.Usage.PromptTokens
+			merged.Usage.TotalTokens += resp.Usage.TotalTokens
+		}
+	}
+
+	sort.Slice(merged.Data, func(i, j int) bool {
+		return merged.Data[i].Index < merged.Data[j].Index
+	})
+
+	h.recordMergedUsage(c, actualModelID, "/v1/embeddings", merged.Usage, start)
+	c.JSON(http.StatusOK, merged)
+}
+
+// HandleRerank handles Jina/Cohere style rerank requests
+func (h *Handler) HandleRerank(c *gin.Context) {
+	var req RerankRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.sendError(c, http.StatusBadRequest, "invalid_request", err.Error(), "body")
+		return
+	}
+
+	if req.Model == "" {
+		h.sendError(c, http.StatusBadRequest, "invalid_request", "Missing required parameter: model", "model")
+		return
+	}
+	if req.Query == "" {
+		h.sendError(c, http.StatusBadRequest, "invalid_request", "Missing required parameter: query", "query")
+		return
+	}
+	if len(req.Documents) == 0 {
+		h.sendError(c, http.StatusBadRequest, "invalid_request", "Documents array is empty", "documents")
+		return
+	}
+
+	documents := make([]string, len(req.Documents))
+	costs := make([]int, len(req.Documents))
+	queryCost := EstimateTokens(req.Query)
+	for i, raw := range req.Documents {
+		text, err := documentText(raw)
+		if err != nil {
+			h.sendError(c, http.StatusBadRequest, "invalid_request", fmt.Sprintf("documents[%d]: %v", i, err), "documents")
+			return
+		}
+		documents[i] = text
+		costs[i] = queryCost + EstimateTokens(text)
+	}
+
+	actualModelID, status, ok := h.resolveLoadedModel(c, req.Model)
+	if !ok {
+		return
+	}
+
+	if !status.Reranking {
+		h.sendError(c, http.StatusBadRequest, "invalid_request_error",
+			fmt.Sprintf("Model %s does not support reranking; load it with the rerank capability enabled", req.Model), "model")
+		return
+	}
+
+	done, err := h.modelMgr.AcquireSlot(c.Request.Context(), actualModelID)
+	if err != nil {
+		h.sendModelError(c, err)
+		return
+	}
+	defer done()
+	start := time.Now()
+
+	merged := RerankResponse{
+		Object: "list",
+		Model:  req.Model,
+		Usage:  &Usage{},
+	}
+	for _, batch := range SplitBatches(costs, UBatchSize(status)) {
+		chunk := map[string]interface{}{
+			"model":     req.Model,
+			"query":     req.Query,
+			"documents": documents[batch.Start:batch.End],
+			"top_n":     batch.End - batch.Start,
+		}
+
+		var resp RerankResponse
+		if !h.postUpstream(c, status.Port, "/v1/rerank", chunk, &resp) {
+			return
+		}
+
+		for _, result := range resp.Results {
+			result.Index += batch.Start
+			result.Document = nil
+			merged.Results = append(merged.Results, result)
+		}
+		if resp.Usage != nil {
+			merged.Usage.PromptTokens += resp.Usage.PromptTokens
+			merged.Usage.TotalTokens += resp.Usage.TotalTokens
+		}
+	}
+
+	sort.SliceStable(merged.Results, func(i, j int) bool {
+		return merged.Results[i].RelevanceScore > merged.Results[j].RelevanceScore
+	})
+	if req.TopN > 0 && req.TopN < len(merged.Results) {
+		merged.Results = merged.Results[:req.TopN]
+	}
+	if req.ReturnDocuments {
+		for i := range merged.Results {
+			merged.Results[i].Document, _ = json.Marshal(map[string]string{
+				"text": documents[merged.Results[i].Index],
+			})
+		}
+	}
+
+	h.recordMergedUsage(c, actualModelID, "/v1/rerank", merged.Usage, start)
+	c.JSON(http.StatusOK, merged)
+}
+
+// resolveLoadedModel finds (and loads on demand) the model and returns its status.
+// On failure the error response has already been sent.
+func (h *Handler) resolveLoadedModel(c *gin.Context, name string) (string, *model.ModelStatus, bool) {
+	actualModelID, err := h.modelMgr.Route(c.Request.Context(), name, model.RouteHints{}, c.GetHeader(h.modelMgr.SessionHeader()))
+	if err != nil {
+		h.sendModelError(c, err)
+		return "", nil, false
+	}
+
+	if _, err := h.getModelPort(actualModelID); err != nil {
+		h.sendError(c, http.StatusInternalServerError, "server_error", err.Error(), "")
+		return "", nil, false
+	}
+
+	status, _ := h.modelMgr.GetStatus(actualModelID)
+	return actualModelID, status, true
+}
+
+// postUpstream sends one JSON request to llama.cpp and decodes the response into out.
+// Upstream errors are relayed to the client as-is; returns false if a response was sent.
+func (h *Handler) postUpstream(c *gin.Context, port int, path string, req interface{}, out interface{}) bool {
+	body, err := json.Marshal(req)
+	if err != nil {
+		h.sendError(c, http.StatusInternalServerError, "server_error", err.Error(), "")
+		return false
+	}
+
+	url := fmt.Sprintf("http://127.0.0.1:%d%s", port, path)
+	httpReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", url, bytes.NewReader(body))
+	if err != nil {
+		h.sendError(c, http.StatusInternalServerError, "server_error", err.Error(), "")
+		return false
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		h.sendError(c, http.StatusBadGateway, "model_error", err.Error(), "")
+		logger.Errorf("转发请求到 llama.cpp 失败: %v", err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		h.sendError(c, http.StatusInternalServerError, "server_error", err.Error(), "")
+		return false
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		c.Data(resp.StatusCode, "application/json", respBody)
+		return false
+	}
+
+	if err := json.Unmarshal(respBody, out); err != nil {
+		h.sendError(c, http.StatusBadGateway, "model_error", fmt.Sprintf("invalid upstream response: %v", err), "")
+		return false
+	}
+	return true
+}
+
+// recordMergedUsage records the token usage summed over all upstream batches
+func (h *Handler) recordMergedUsage(c *gin.Context, modelID, path string, merged *Usage, start time.Time) {
+	u := usage.Usage(*merged)
+	h.usage.Record(c.Request, modelID, path, u, start, false)
+}
+
+// parseEmbeddingInput splits the OpenAI input field into individual inputs
+// and their estimated token costs
+func parseEmbeddingInput(raw json.RawMessage) ([]json.RawMessage, []int, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil, fmt.Errorf("Missing required parameter: input")
+	}
+
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return []json.RawMessage{raw}, []int{EstimateTokens(text)}, nil
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, nil, fmt.Errorf("input must be a string, an array of strings or an array of token arrays")
+	}
+	if len(items) == 0 {
+		return nil, nil, fmt.Errorf("Input array is empty")
+	}
+
+	// 单个 token 数组：[1, 2, 3]
+	var tokens []int
+	if err := json.Unmarshal(raw, &tokens); err == nil {
+		return []json.RawMessage{raw}, []int{len(tokens)}, nil
+	}
+
+	costs := make([]int, len(items))
+	for i, item := range items {
+		if err := json.Unmarshal(item, &text); err == nil {
+			costs[i] = EstimateTokens(text)
+			continue
+		}
+		if err := json.Unmarshal(item, &tokens); err == nil {
+			costs[i] = len(tokens)
+			continue
+		}
+		return nil, nil, fmt.Errorf("input[%d] must be a string or an array of tokens", i)
+	}
+	return items, costs, nil
+}
+
+// documentText extracts the text of a rerank document (string or {"text": ...})
+func documentText(raw json.RawMessage) (string, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+
+	var doc struct {
+		Text *string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &doc); err == nil && doc.Text != nil {
+		return *doc.Text, nil
+	}
+	return "", fmt.Errorf("document must be a string or an object with a text field")
+}
@@ -0,0 +1,143 @@
+package openai
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitBatches(t *testing.T) {
+	t.Run("Fits in one batch", func(t *testing.T) {
+		batches := SplitBatches([]int{10, 20, 30}, 512)
+		assert.Equal(t, []Batch{{Start: 0, End: 3}}, batches)
+	})
+
+	t.Run("Splits on limit", func(t *testing.T) {
+		batches := SplitBatches([]int{300, 200, 100, 450}, 512)
+		assert.Equal(t, []Batch{{0, 2}, {2, 3}, {3, 4}}, batches)
+	})
+
+	t.Run("Oversized input alone", func(t *testing.T) {
+		batches := SplitBatches([]int{10, 1000, 10}, 512)
+		assert.Equal(t, []Batch{{0, 1}, {1, 2}, {2, 3}}, batches)
+	})
+
+	t.Run("Default limit", func(t *testing.T) {
+		batches := SplitBatches([]int{500, 500}, 0)
+		assert.Len(t, batches, 2)
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		assert.Empty(t, SplitBatches(nil, 512))
+	})
+}
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 1, EstimateTokens(""))
+	assert.Equal(t, 4, EstimateTokens("hello world!"))
+	// CJK 字符每个 3 字节，约 1 token
+	assert.Equal(t, 2, EstimateTokens("你好"))
+}
+
+func TestUBatchSize(t *testing.T) {
+	assert.Equal(t, DefaultUBatchSize, UBatchSize(nil))
+	assert.Equal(t, DefaultUBatchSize, UBatchSize(&model.ModelStatus{}))
+	assert.Equal(t, 2048, UBatchSize(&model.ModelStatus{UBatchSize: 2048}))
+}
+
+func TestParseEmbeddingInput(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantCount int
+		wantCosts []int
+		wantErr   bool
+	}{
+		{"single string", `"hello world!"`, 1, []int{4}, false},
+		{"string array", `["a", "hello world!"]`, 2, []int{1, 4}, false},
+		{"token array", `[1, 2, 3]`, 1, []int{3}, false},
+		{"token arrays", `[[1, 2], [3, 4, 5]]`, 2, []int{2, 3}, false},
+		{"empty array", `[]`, 0, nil, true},
+		{"object", `{"text": "x"}`, 0, nil, true},
+		{"mixed invalid", `["a", {"b": 1}]`, 0, nil, true},
+		{"missing", ``, 0, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, costs, err := parseEmbeddingInput(json.RawMessage(tt.input))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, items, tt.wantCount)
+			assert.Equal(t, tt.wantCosts, costs)
+		})
+	}
+}
+
+func TestDocumentText(t *testing.T) {
+	text, err := documentText(json.RawMessage(`"plain"`))
+	require.NoError(t, err)
+	assert.Equal(t, "plain", text)
+
+	text, err = documentText(json.RawMessage(`{"text": "object"}`))
+	require.NoError(t, err)
+	assert.Equal(t, "object", text)
+
+	_, err = documentText(json.RawMessage(`{"title": "no text"}`))
+	assert.Error(t, err)
+}
+
+func TestHandleEmbeddingsAndRerank(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.DefaultConfig()
+	modelMgr := model.NewManager(cfg, nil, process.NewManager())
+	handler := NewHandler(modelMgr)
+
+	router := gin.New()
+	router.POST("/v1/embeddings", handler.HandleEmbeddings)
+	router.POST("/v1/rerank", handler.HandleRerank)
+
+	tests := []struct {
+		name       string
+		path       string
+		body       string
+		wantStatus int
+		wantParam  string
+	}{
+		{"embeddings missing model", "/v1/embeddings", `{"input": "hi"}`, http.StatusBadRequest, "model"},
+		{"embeddings invalid input", "/v1/embeddings", `{"model": "m", "input": 42}`, http.StatusBadRequest, "input"},
+		{"embeddings unknown model", "/v1/embeddings", `{"model": "m", "input": "hi"}`, http.StatusNotFound, "model"},
+		{"rerank missing query", "/v1/rerank", `{"model": "m", "documents": ["a"]}`, http.StatusBadRequest, "query"},
+		{"rerank empty documents", "/v1/rerank", `{"model": "m", "query": "q", "documents": []}`, http.StatusBadRequest, "documents"},
+		{"rerank bad document", "/v1/rerank", `{"model": "m", "query": "q", "documents": [1]}`, http.StatusBadRequest, "documents"},
+		{"rerank unknown model", "/v1/rerank", `{"model": "m", "query": "q", "documents": ["a"]}`, http.StatusNotFound, "model"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+
+			var response ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.wantParam, response.Error.Param)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package openai
+
+import (
+	"context"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/filter"
+)
+
+// filterChatMessages runs the request filters of chain on chat messages.
+// Messages taken from the request keep their name and tool calls.
+func filterChatMessages(ctx context.Context, chain *filter.Chain, messages []ChatMessage) ([]ChatMessage, error) {
+	if chain.Empty() {
+		return messages, nil
+	}
+	converted := make([]filter.Message, len(messages))
+	for i, msg := range messages {
+		converted[i] = filter.Message{Role: msg.Role, Content: msg.Content, Index: i}
+	}
+
+	filtered, err := chain.Request(ctx, converted)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]ChatMessage, 0, len(filtered))
+	for _, msg := range filtered {
+		out := ChatMessage{Role: msg.Role, Content: msg.Content}
+		if msg.Index >= 0 && msg.Index < len(messages) {
+			out = messages[msg.Index]
+			out.Role, out.Content = msg.Role, msg.Content
+		}
+		result = append(result, out)
+	}
+	return result, nil
+}
+
+// filterResponseMessages runs the request filters of chain on the messages
+// built from a Responses API request. Rewritten content keeps its images
+// after a single text part.
+func filterResponseMessages(ctx context.Context, chain *filter.Chain, messages []chatMessage) ([]chatMessage, error) {
+	if chain.Empty() {
+		return messages, nil
+	}
+	converted := make([]filter.Message, len(messages))
+	for i, msg := range messages {
+		converted[i] = filter.Message{Role: msg.Role, Content: msg.Content.Text(), Index: i}
+	}
+
+	filtered, err := chain.Request(ctx, converted)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]chatMessage, 0, len(filtered))
+	for _, msg := range filtered {
+		if msg.Index < 0 || msg.Index >= len(messages) {
+			result = append(result, chatMessage{Role: msg.Role, Content: chatContent{{Type: "text", Text: msg.Content}}})
+			continue
+		}
+		out := messages[msg.Index]
+		out.Role = msg.Role
+		if msg.Content != out.Content.Text() {
+			content := chatContent{{Type: "text", Text: msg.Content}}
+			for _, part := range out.Content {
+				if part.Type != "text" {
+					content = append(content, part)
+				}
+			}
+			out.Content = content
+		}
+		result = append(result, out)
+	}
+	return result, nil
+}
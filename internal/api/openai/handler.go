@@ -8,17 +8,28 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/capture"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/filter"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
 )
 
 // Handler handles OpenAI API requests
 type Handler struct {
-	modelMgr *model.Manager
-	client   *http.Client
+	modelMgr  *model.Manager
+	client    *http.Client
+	usage     *usage.Recorder
+	capture   *capture.Recorder
+	filters   *filter.Registry
+	responses storage.Store // 保存的 Responses API 响应，用于 previous_response_id
 }
 
 // NewHandler creates a new OpenAI API handler
@@ -26,11 +37,27 @@ func NewHandler(modelMgr *model.Manager) *Handler {
 	return &Handler{
 		modelMgr: modelMgr,
 		client: &http.Client{
-			Timeout: 0, // No timeout for streaming responses
+			Timeout:   0, // No timeout for streaming responses
+			Transport: tracing.NewTransport(nil, "llama-server"),
 		},
 	}
 }
 
+// SetUsageRecorder sets where token usage of proxied requests is recorded
+func (h *Handler) SetUsageRecorder(recorder *usage.Recorder) {
+	h.usage = recorder
+}
+
+// SetCaptureRecorder sets where captured chats are recorded
+func (h *Handler) SetCaptureRecorder(recorder *capture.Recorder) {
+	h.capture = recorder
+}
+
+// SetFilters sets the registry providing the content filters of each request
+func (h *Handler) SetFilters(registry *filter.Registry) {
+	h.filters = registry
+}
+
 // HandleChatCompletions handles chat completion requests
 func (h *Handler) HandleChatCompletions(c *gin.Context) {
 	var req ChatCompletionRequest
@@ -50,10 +77,19 @@ func (h *Handler) HandleChatCompletions(c *gin.Context) {
 		return
 	}
 
+	// 请求过滤器在选择模型前运行，被拦截的请求不会触发模型加载
+	chain := h.filters.Chain(c, req.Model)
+	filtered, err := filterChatMessages(c.Request.Context(), chain, req.Messages)
+	if err != nil {
+		h.sendError(c, http.StatusBadRequest, filter.FinishReason, err.Error(), "messages")
+		return
+	}
+	req.Messages = filtered
+
 	// Find the actual model ID
-	actualModelID, err := h.findModel(req.Model)
+	actualModelID, err := h.modelMgr.Route(c.Request.Context(), req.Model, chatRouteHints(&req), c.GetHeader(h.modelMgr.SessionHeader()))
 	if err != nil {
-		h.sendError(c, http.StatusNotFound, "model_not_found", err.Error(), "model")
+		h.sendModelError(c, err)
 		return
 	}
 
@@ -64,11 +100,30 @@ func (h *Handler) HandleChatCompletions(c *gin.Context) {
 		return
 	}
 
+	// 向量/重排序模式的模型不提供文本生成
+	if !h.checkGenerative(c, actualModelID, req.Model) {
+		return
+	}
+
+	// 等待模型空闲槽位，同时记录请求用于空闲卸载判断
+	done, err := h.modelMgr.AcquireSlot(c.Request.Context(), actualModelID)
+	if err != nil {
+		h.sendModelError(c, err)
+		return
+	}
+	defer done()
+
+	messages := make([]capture.Message, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		messages = append(messages, capture.Message{Role: msg.Role, Content: msg.Content, Name: msg.Name})
+	}
+	turn := h.capture.Begin(c.Writer, c.Request, "/v1/chat/completions", messages)
+
 	// Forward request to llama.cpp
 	if req.Stream {
-		h.forwardStreamRequest(c, actualModelID, port, "/v1/chat/completions", &req)
+		h.forwardStreamRequest(c, actualModelID, port, "/v1/chat/completions", &req, turn, chain)
 	} else {
-		h.forwardRequest(c, actualModelID, port, "/v1/chat/completions", &req)
+		h.forwardRequest(c, actualModelID, port, "/v1/chat/completions", &req, turn, chain)
 	}
 }
 
@@ -93,10 +148,22 @@ func (h *Handler) HandleCompletions(c *gin.Context) {
 		}
 	}
 
+	// 只过滤字符串形式的提示词，token 数组等形式原样转发
+	chain := h.filters.Chain(c, req.Model)
+	if prompt, ok := req.Prompt.(string); ok {
+		filtered, err := chain.Prompt(c.Request.Context(), prompt)
+		if err != nil {
+			h.sendError(c, http.StatusBadRequest, filter.FinishReason, err.Error(), "prompt")
+			return
+		}
+		req.Prompt = filtered
+	}
+
 	// Find the actual model ID
-	actualModelID, err := h.findModel(req.Model)
+	prompt, _ := json.Marshal(req.Prompt)
+	actualModelID, err := h.modelMgr.Route(c.Request.Context(), req.Model, model.RouteHints{PromptTokens: model.EstimateTokens(string(prompt))}, c.GetHeader(h.modelMgr.SessionHeader()))
 	if err != nil {
-		h.sendError(c, http.StatusNotFound, "model_not_found", err.Error(), "model")
+		h.sendModelError(c, err)
 		return
 	}
 
@@ -107,11 +174,24 @@ func (h *Handler) HandleCompletions(c *gin.Context) {
 		return
 	}
 
+	// 向量/重排序模式的模型不提供文本生成
+	if !h.checkGenerative(c, actualModelID, req.Model) {
+		return
+	}
+
+	// 等待模型空闲槽位，同时记录请求用于空闲卸载判断
+	done, err := h.modelMgr.AcquireSlot(c.Request.Context(), actualModelID)
+	if err != nil {
+		h.sendModelError(c, err)
+		return
+	}
+	defer done()
+
 	// Forward request to llama.cpp
 	if req.Stream {
-		h.forwardStreamRequest(c, actualModelID, port, "/v1/completions", &req)
+		h.forwardStreamRequest(c, actualModelID, port, "/v1/completions", &req, nil, chain)
 	} else {
-		h.forwardRequest(c, actualModelID, port, "/v1/completions", &req)
+		h.forwardRequest(c, actualModelID, port, "/v1/completions", &req, nil, chain)
 	}
 }
 
@@ -133,49 +213,67 @@ func (h *Handler) HandleModels(c *gin.Context) {
 		}
 	}
 
+	// 虚拟模型始终列出，请求时再解析为具体模型
+	for _, vm := range h.modelMgr.ListVirtualModels() {
+		openaiModels = append(openaiModels, Model{
+			ID:      vm.Name,
+			Object:  "model",
+			OwnedBy: "shepherd",
+		})
+	}
+
 	response := NewModelsResponse(openaiModels)
 	c.JSON(http.StatusOK, response)
 }
 
-// findModel finds a model by name or ID
-func (h *Handler) findModel(modelName string) (string, error) {
-	statuses := h.modelMgr.ListStatus()
-	models := h.modelMgr.ListModels()
-
-	// First try exact match with ID
-	if status, exists := statuses[modelName]; exists && status.State == model.StateLoaded {
-		return modelName, nil
+// chatRouteHints describes a chat request for virtual model routing
+func chatRouteHints(req *ChatCompletionRequest) model.RouteHints {
+	texts := make([]string, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		texts = append(texts, msg.Content)
 	}
+	tools, _ := req.Extra["tools"].([]interface{})
+	return model.RouteHints{
+		PromptTokens: model.EstimateTokens(texts...),
+		Tools:        len(tools) > 0,
+	}
+}
 
-	// Try to find by name/alias
-	for _, m := range models {
-		status, exists := statuses[m.ID]
-		if !exists || status.State != model.StateLoaded {
-			continue
-		}
-
-		// Check alias
-		if m.Alias == modelName {
-			return m.ID, nil
-		}
-
-		// Check name
-		if m.Name == modelName {
-			return m.ID, nil
-		}
+// checkGenerative rejects completion requests to models running in embedding
+// or reranking mode; returns false if an error response was sent
+func (h *Handler) checkGenerative(c *gin.Context, modelID, requested string) bool {
+	status, exists := h.modelMgr.GetStatus(modelID)
+	if !exists || (!status.Embedding && !status.Reranking) {
+		return true
+	}
 
-		// Check filename
-		if strings.EqualFold(m.Name, modelName) {
-			return m.ID, nil
-		}
+	h.sendError(c, http.StatusBadRequest, "invalid_request_error",
+		fmt.Sprintf("Model %s is loaded for embeddings or reranking and does not support completions", requested), "model")
+	return false
+}
 
-		// Check if model ID contains the search string
-		if strings.Contains(strings.ToLower(m.ID), strings.ToLower(modelName)) {
-			return m.ID, nil
-		}
+// sendModelError writes model routing, on-demand load and queue errors in
+// the OpenAI error format
+func (h *Handler) sendModelError(c *gin.Context, err error) {
+	status, retryAfter := model.ErrorStatus(err)
+	param := "model"
+	if retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		param = ""
 	}
 
-	return "", fmt.Errorf("model not found: %s", modelName)
+	switch status {
+	case http.StatusTooManyRequests:
+		h.sendError(c, status, "rate_limit_error", err.Error(), param)
+	case http.StatusBadRequest:
+		h.sendError(c, status, "invalid_request_error", err.Error(), param)
+	case http.StatusRequestTimeout:
+		h.sendError(c, status, "timeout", err.Error(), "")
+	case http.StatusNotFound:
+		h.sendError(c, status, "model_not_found", err.Error(), param)
+	default:
+		h.sendError(c, status, "server_error", err.Error(), param)
+	}
 }
 
 // getModelPort returns the port for a loaded model
@@ -196,8 +294,10 @@ func (h *Handler) getModelPort(modelID string) (int, error) {
 	return status.Port, nil
 }
 
-// forwardRequest forwards a non-streaming request to llama.cpp
-func (h *Handler) forwardRequest(c *gin.Context, modelID string, port int, path string, req interface{}) {
+// forwardRequest forwards a non-streaming request to llama.cpp. turn, if
+// not nil, captures the reply into the conversation store; chain filters
+// the generated text.
+func (h *Handler) forwardRequest(c *gin.Context, modelID string, port int, path string, req interface{}, turn *capture.Turn, chain *filter.Chain) {
 	url := fmt.Sprintf("http://127.0.0.1:%d%s", port, path)
 
 	// Marshal request body
@@ -219,10 +319,12 @@ func (h *Handler) forwardRequest(c *gin.Context, modelID string, port int, path
 	httpReq.Header.Set("Authorization", c.Request.Header.Get("Authorization"))
 
 	// Send request
+	start := time.Now()
 	resp, err := h.client.Do(httpReq)
 	if err != nil {
 		h.sendError(c, http.StatusBadGateway, "model_error", err.Error(), "")
 		logger.Errorf("转发请求到 llama.cpp 失败: %v", err)
+		h.modelMgr.ReportUpstreamError(modelID, err)
 		return
 	}
 	defer resp.Body.Close()
@@ -234,6 +336,15 @@ func (h *Handler) forwardRequest(c *gin.Context, modelID string, port int, path
 		return
 	}
 
+	if u, ok := usage.Parse(respBody); ok && resp.StatusCode == http.StatusOK {
+		h.usage.Record(c.Request, modelID, path, u, start, false)
+	}
+	if resp.StatusCode == http.StatusOK {
+		respBody = chain.Body(c.Request.Context(), respBody)
+		turn.ParseResponse(respBody)
+		turn.Finish(modelID)
+	}
+
 	// Forward response
 	c.Header("Content-Type", "application/json")
 	for key, values := range resp.Header {
@@ -241,16 +352,20 @@ func (h *Handler) forwardRequest(c *gin.Context, modelID string, port int, path
 			c.Header(key, value)
 		}
 	}
+	// 过滤器可能改写了响应，按实际长度设置
+	c.Header("Content-Length", strconv.Itoa(len(respBody)))
 	c.Status(resp.StatusCode)
 	c.Writer.Write(respBody)
 }
 
-// forwardStreamRequest forwards a streaming request to llama.cpp
-func (h *Handler) forwardStreamRequest(c *gin.Context, modelID string, port int, path string, req interface{}) {
+// forwardStreamRequest forwards a streaming request to llama.cpp. turn, if
+// not nil, captures the streamed reply into the conversation store; chain
+// filters the generated text chunk by chunk.
+func (h *Handler) forwardStreamRequest(c *gin.Context, modelID string, port int, path string, req interface{}, turn *capture.Turn, chain *filter.Chain) {
 	url := fmt.Sprintf("http://127.0.0.1:%d%s", port, path)
 
 	// Marshal request body
-	body, err := json.Marshal(req)
+	body, includeUsage, err := streamRequestBody(req)
 	if err != nil {
 		h.sendError(c, http.StatusInternalServerError, "server_error", err.Error(), "")
 		return
@@ -268,10 +383,12 @@ func (h *Handler) forwardStreamRequest(c *gin.Context, modelID string, port int,
 	httpReq.Header.Set("Authorization", c.Request.Header.Get("Authorization"))
 
 	// Send request
+	start := time.Now()
 	resp, err := h.client.Do(httpReq)
 	if err != nil {
 		h.sendError(c, http.StatusBadGateway, "model_error", err.Error(), "")
 		logger.Errorf("转发流式请求到 llama.cpp 失败: %v", err)
+		h.modelMgr.ReportUpstreamError(modelID, err)
 		return
 	}
 	defer resp.Body.Close()
@@ -293,6 +410,17 @@ func (h *Handler) forwardStreamRequest(c *gin.Context, modelID string, port int,
 	c.Status(resp.StatusCode)
 
 	reader := bufio.NewReader(resp.Body)
+	filters := chain.Stream(c.Request.Context())
+
+	// 用量在最后一个数据块中返回，客户端中途断开时记录已读到的最后一份
+	var streamUsage usage.Usage
+	skipBlank := false
+	defer func() {
+		h.usage.Record(c.Request, modelID, path, streamUsage, start, true)
+		if resp.StatusCode == http.StatusOK {
+			turn.Finish(modelID)
+		}
+	}()
 
 	for {
 		// Check if client disconnected
@@ -311,12 +439,77 @@ func (h *Handler) forwardStreamRequest(c *gin.Context, modelID string, port int,
 			return
 		}
 
+		line = filters.Line(line)
+		if u, ok := usage.ParseStreamLine(line); ok {
+			streamUsage = u
+		}
+		turn.ParseStreamLine(line)
+		if !includeUsage && usageOnlyChunk(line) {
+			// 客户端未请求用量数据块，连同其后的空行一起去掉
+			skipBlank = true
+			continue
+		}
+		if skipBlank {
+			skipBlank = false
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+		}
+
 		// Write line to client
 		c.Writer.Write([]byte(line))
+		if filters.Blocked() {
+			// 被拦截后结束流并停止读取，llama-server 随之中止生成
+			c.Writer.Write([]byte("\ndata: [DONE]\n\n"))
+			flusher.Flush()
+			return
+		}
 		flusher.Flush()
 	}
 }
 
+// streamRequestBody 序列化流式请求，并要求 llama-server 在最后返回用量数据块以记录用量。
+// includeUsage 表示客户端自己是否请求了用量数据块
+func streamRequestBody(req interface{}) (body []byte, includeUsage bool, err error) {
+	body, err = json.Marshal(req)
+	if err != nil {
+		return nil, false, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, false, err
+	}
+	fields["stream_options"] = json.RawMessage(`{"include_usage":true}`)
+	body, err = json.Marshal(fields)
+
+	var extra map[string]interface{}
+	switch r := req.(type) {
+	case *ChatCompletionRequest:
+		extra = r.Extra
+	case *CompletionRequest:
+		extra = r.Extra
+	}
+	options, _ := extra["stream_options"].(map[string]interface{})
+	includeUsage, _ = options["include_usage"].(bool)
+	return body, includeUsage, err
+}
+
+// usageOnlyChunk 判断数据块是否为 include_usage 产生的、不含 choices 的用量数据块
+func usageOnlyChunk(line string) bool {
+	data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+	if !ok {
+		return false
+	}
+	var chunk struct {
+		Choices []json.RawMessage `json:"choices"`
+		Usage   json.RawMessage   `json:"usage"`
+	}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &chunk); err != nil {
+		return false
+	}
+	return len(chunk.Choices) == 0 && len(chunk.Usage) > 0 && string(chunk.Usage) != "null"
+}
+
 // sendError sends an error response
 func (h *Handler) sendError(c *gin.Context, statusCode int, errorType, message, param string) {
 	response := NewErrorResponse(message, errorType, param, statusCode)
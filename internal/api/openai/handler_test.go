@@ -1,16 +1,23 @@
 package openai
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/filter"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -221,8 +228,173 @@ func TestFindModel(t *testing.T) {
 	handler := NewHandler(modelMgr)
 
 	t.Run("No models loaded", func(t *testing.T) {
-		_, err := handler.findModel("test-model")
+		_, err := handler.modelMgr.Route(context.Background(), "test-model", model.RouteHints{}, "")
 		assert.Error(t, err)
 		assert.Contains(t, err.Error(), "model not found")
 	})
 }
+
+func TestVirtualModels(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.DefaultConfig()
+	cfg.Gateway.VirtualModels = []config.VirtualModelConfig{{Name: "coder", Models: []string{"missing-model"}}}
+	handler := NewHandler(model.NewManager(cfg, nil, process.NewManager()))
+
+	t.Run("Listed in models", func(t *testing.T) {
+		router := gin.New()
+		router.GET("/v1/models", handler.HandleModels)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/models", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response ModelsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.Len(t, response.Data, 1)
+		assert.Equal(t, "coder", response.Data[0].ID)
+	})
+
+	t.Run("No usable model", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+
+		_, err := handler.modelMgr.Route(c.Request.Context(), "coder", model.RouteHints{}, "")
+		assert.ErrorIs(t, err, model.ErrNoVirtualCandidate)
+		handler.sendModelError(c, err)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestChatRouteHints(t *testing.T) {
+	var req ChatCompletionRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"model": "coder",
+		"messages": [{"role": "user", "content": "Write a function"}],
+		"tools": [{"type": "function", "function": {"name": "run"}}]
+	}`), &req))
+
+	hints := chatRouteHints(&req)
+	assert.True(t, hints.Tools)
+	assert.Equal(t, model.EstimateTokens("Write a function"), hints.PromptTokens)
+}
+
+func TestSendModelError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler := NewHandler(model.NewManager(config.DefaultConfig(), nil, process.NewManager()))
+
+	tests := []struct {
+		name           string
+		err            error
+		wantStatus     int
+		wantRetryAfter string
+	}{
+		{"queue full", &model.QueueError{Err: model.ErrQueueFull, RetryAfter: 2500 * time.Millisecond}, http.StatusTooManyRequests, "3"},
+		{"queue timeout", &model.QueueError{Err: model.ErrQueueTimeout}, http.StatusServiceUnavailable, "1"},
+		{"load timeout", model.ErrAutoLoadTimeout, http.StatusServiceUnavailable, ""},
+		{"not found", model.ErrModelNotFound, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			handler.sendModelError(c, tt.err)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantRetryAfter, w.Header().Get("Retry-After"))
+		})
+	}
+}
+
+func TestContentFilters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.DefaultConfig()
+	cfg.Gateway.Filters = []config.FilterConfig{
+		{Name: "banned", Type: config.FilterBannedPhrases, Phrases: []string{"jailbreak"}},
+		{Name: "pii", Type: config.FilterPII},
+	}
+	cfg.Gateway.VirtualModels = []config.VirtualModelConfig{{Name: "safe", Models: []string{"missing-model"}, Filters: []string{"banned", "pii"}}}
+	configMgr := config.NewManagerWithPath("standalone", filepath.Join(t.TempDir(), "server.config.yaml"))
+	require.NoError(t, configMgr.Save(cfg))
+	modelMgr := model.NewManager(cfg, configMgr, process.NewManager())
+
+	handler := NewHandler(modelMgr)
+	handler.SetFilters(filter.NewRegistry(configMgr, modelMgr))
+	router := gin.New()
+	router.POST("/v1/chat/completions", handler.HandleChatCompletions)
+
+	t.Run("Blocked request", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/chat/completions",
+			strings.NewReader(`{"model":"safe","messages":[{"role":"user","content":"Try this JAILBREAK"}]}`)))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		var resp ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, "content_filter", resp.Error.Type)
+		assert.Contains(t, resp.Error.Message, "banned")
+	})
+
+	t.Run("Rewritten messages", func(t *testing.T) {
+		chain := filter.NewRegistry(configMgr, modelMgr).Chain(&gin.Context{}, "safe")
+		messages, err := filterChatMessages(context.Background(), chain, []ChatMessage{
+			{Role: "user", Content: "Mail bob@example.com", Name: "bob"},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []ChatMessage{{Role: "user", Content: "Mail [EMAIL]", Name: "bob"}}, messages)
+	})
+}
+
+func TestStreamUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var upstreamBody map[string]interface{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&upstreamBody))
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\n" +
+			"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":1,\"total_tokens\":4}}\n\n" +
+			"data: [DONE]\n\n"))
+	}))
+	defer upstream.Close()
+	port, err := strconv.Atoi(upstream.URL[strings.LastIndex(upstream.URL, ":")+1:])
+	require.NoError(t, err)
+
+	store, err := storage.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(nil)
+	handler.SetUsageRecorder(usage.NewRecorder(store, nil))
+
+	stream := func(body string) string {
+		var req ChatCompletionRequest
+		require.NoError(t, json.Unmarshal([]byte(body), &req))
+
+		report := &usage.Report{}
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		c.Request = c.Request.WithContext(usage.WithReport(c.Request.Context(), report))
+		handler.forwardStreamRequest(c, "test-model", port, "/v1/chat/completions", &req, nil, nil)
+
+		assert.Equal(t, map[string]interface{}{"include_usage": true}, upstreamBody["stream_options"])
+		_, u := report.Result()
+		assert.Equal(t, 4, u.TotalTokens)
+		return w.Body.String()
+	}
+
+	t.Run("Usage not requested", func(t *testing.T) {
+		body := stream(`{"model":"test-model","messages":[{"role":"user","content":"Hello"}],"stream":true}`)
+		assert.NotContains(t, body, "usage")
+		assert.Equal(t, "data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hi\"}}]}\n\ndata: [DONE]\n\n", body)
+	})
+
+	t.Run("Usage requested", func(t *testing.T) {
+		body := stream(`{"model":"test-model","messages":[{"role":"user","content":"Hello"}],"stream":true,"stream_options":{"include_usage":true}}`)
+		assert.Contains(t, body, `"total_tokens":4`)
+	})
+}
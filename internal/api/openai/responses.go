@@ -0,0 +1,845 @@
+package openai
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/auth"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/capture"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/filter"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
+)
+
+// responseSaveTimeout 响应写入存储的最长时间
+const responseSaveTimeout = 5 * time.Second
+
+// ResponseRequest represents an OpenAI Responses API request
+type ResponseRequest struct {
+	Model              string            `json:"model"`
+	Input              json.RawMessage   `json:"input"` // string or array of input items
+	Instructions       string            `json:"instructions,omitempty"`
+	PreviousResponseID string            `json:"previous_response_id,omitempty"`
+	Tools              []ResponseTool    `json:"tools,omitempty"`
+	ToolChoice         json.RawMessage   `json:"tool_choice,omitempty"` // "auto", "none", "required" or {"type": "function", "name": ...}
+	ParallelToolCalls  *bool             `json:"parallel_tool_calls,omitempty"`
+	Stream             bool              `json:"stream,omitempty"`
+	Store              *bool             `json:"store,omitempty"` // defaults to true
+	Temperature        *float64          `json:"temperature,omitempty"`
+	TopP               *float64          `json:"top_p,omitempty"`
+	MaxOutputTokens    int               `json:"max_output_tokens,omitempty"`
+	Metadata           map[string]string `json:"metadata,omitempty"`
+}
+
+// ResponseInputItem is one item of the input array: a message, a function
+// call made by the model or the output of that call
+type ResponseInputItem struct {
+	Type      string          `json:"type,omitempty"` // message (default), function_call, function_call_output
+	Role      string          `json:"role,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"` // string or array of content parts
+	CallID    string          `json:"call_id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Arguments string          `json:"arguments,omitempty"`
+	Output    string          `json:"output,omitempty"`
+}
+
+// ResponseTool is a tool the model may call; only function tools are supported
+type ResponseTool struct {
+	Type        string          `json:"type"`
+	Name        string          `json:"name,omitempty"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+	Strict      *bool           `json:"strict,omitempty"`
+}
+
+// Response represents a Responses API response object
+type Response struct {
+	ID                 string               `json:"id"`
+	Object             string               `json:"object"`
+	CreatedAt          int64                `json:"created_at"`
+	Status             string               `json:"status"` // in_progress, completed, incomplete, failed
+	Model              string               `json:"model"`
+	Output             []ResponseOutputItem `json:"output"`
+	Instructions       string               `json:"instructions,omitempty"`
+	PreviousResponseID string               `json:"previous_response_id,omitempty"`
+	Tools              []ResponseTool       `json:"tools"`
+	IncompleteDetails  *IncompleteDetails   `json:"incomplete_details"`
+	Error              *ResponseError       `json:"error"`
+	Usage              *ResponseUsage       `json:"usage,omitempty"`
+	Metadata           map[string]string    `json:"metadata,omitempty"`
+}
+
+// ResponseOutputItem is an output message or a function call
+type ResponseOutputItem struct {
+	Type      string               `json:"type"` // message or function_call
+	ID        string               `json:"id"`
+	Status    string               `json:"status"`
+	Role      string               `json:"role,omitempty"`
+	Content   []ResponseOutputText `json:"content,omitempty"`
+	CallID    string               `json:"call_id,omitempty"`
+	Name      string               `json:"name,omitempty"`
+	Arguments string               `json:"arguments,omitempty"`
+}
+
+// MarshalJSON writes only the fields of the item type, always including the
+// content array of messages and the arguments of function calls
+func (item ResponseOutputItem) MarshalJSON() ([]byte, error) {
+	if item.Type == "function_call" {
+		return json.Marshal(struct {
+			Type      string `json:"type"`
+			ID        string `json:"id"`
+			Status    string `json:"status"`
+			CallID    string `json:"call_id"`
+			Name      string `json:"name"`
+			Arguments string `json:"arguments"`
+		}{item.Type, item.ID, item.Status, item.CallID, item.Name, item.Arguments})
+	}
+
+	content := item.Content
+	if content == nil {
+		content = []ResponseOutputText{}
+	}
+	return json.Marshal(struct {
+		Type    string               `json:"type"`
+		ID      string               `json:"id"`
+		Status  string               `json:"status"`
+		Role    string               `json:"role"`
+		Content []ResponseOutputText `json:"content"`
+	}{item.Type, item.ID, item.Status, item.Role, content})
+}
+
+// ResponseOutputText is a text part of an output message
+type ResponseOutputText struct {
+	Type        string        `json:"type"` // output_text
+	Text        string        `json:"text"`
+	Annotations []interface{} `json:"annotations"`
+}
+
+// IncompleteDetails explains why a response is incomplete
+type IncompleteDetails struct {
+	Reason string `json:"reason"`
+}
+
+// ResponseError is the error of a failed response
+type ResponseError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ResponseUsage represents the token usage of a response
+type ResponseUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
+}
+
+// chatMessage is an upstream chat message built from Responses API items and
+// stored for previous_response_id chaining
+type chatMessage struct {
+	Role       string      `json:"role"`
+	Content    chatContent `json:"content"`
+	ToolCalls  []ToolCall  `json:"tool_calls,omitempty"`
+	ToolCallID string      `json:"tool_call_id,omitempty"`
+}
+
+// chatContent is sent upstream as a plain string unless it contains images
+type chatContent []chatPart
+
+// chatPart is a text or image_url content part
+type chatPart struct {
+	Type     string        `json:"type"`
+	Text     string        `json:"text,omitempty"`
+	ImageURL *chatImageURL `json:"image_url,omitempty"`
+}
+
+type chatImageURL struct {
+	URL string `json:"url"`
+}
+
+// MarshalJSON writes text-only content as a string, otherwise as a part array
+func (c chatContent) MarshalJSON() ([]byte, error) {
+	if !c.hasImages() {
+		return json.Marshal(c.Text())
+	}
+	return json.Marshal([]chatPart(c))
+}
+
+// UnmarshalJSON accepts both the string and the part array form
+func (c *chatContent) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if string(data) == "null" {
+		*c = nil
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var text string
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+		*c = chatContent{{Type: "text", Text: text}}
+		return nil
+	}
+
+	var parts []chatPart
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return err
+	}
+	*c = parts
+	return nil
+}
+
+// Text joins the text parts of the content
+func (c chatContent) Text() string {
+	var texts []string
+	for _, part := range c {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+func (c chatContent) hasImages() bool {
+	for _, part := range c {
+		if part.Type == "image_url" {
+			return true
+		}
+	}
+	return false
+}
+
+// SetResponseStore sets where responses are stored for previous_response_id
+// chaining. Without a store, responses are not kept and chaining is rejected.
+func (h *Handler) SetResponseStore(store storage.Store) {
+	h.responses = store
+}
+
+// HandleResponses handles Responses API requests on top of chat completions
+func (h *Handler) HandleResponses(c *gin.Context) {
+	var req ResponseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		h.sendError(c, http.StatusBadRequest, "invalid_request", err.Error(), "body")
+		return
+	}
+
+	if req.Model == "" {
+		h.sendError(c, http.StatusBadRequest, "invalid_request", "Missing required parameter: model", "model")
+		return
+	}
+
+	items, err := parseResponseInput(req.Input)
+	if err != nil {
+		h.sendError(c, http.StatusBadRequest, "invalid_request", err.Error(), "input")
+		return
+	}
+	input, err := convertResponseInput(items)
+	if err != nil {
+		h.sendError(c, http.StatusBadRequest, "invalid_request", err.Error(), "input")
+		return
+	}
+
+	tools, err := convertResponseTools(req.Tools)
+	if err != nil {
+		h.sendError(c, http.StatusBadRequest, "invalid_request", err.Error(), "tools")
+		return
+	}
+	toolChoice, err := convertResponseToolChoice(req.ToolChoice)
+	if err != nil {
+		h.sendError(c, http.StatusBadRequest, "invalid_request", err.Error(), "tool_choice")
+		return
+	}
+
+	owner := responseOwner(c)
+	history, status, err := h.previousMessages(c.Request.Context(), owner, req.PreviousResponseID)
+	if err != nil {
+		h.sendError(c, status, "invalid_request_error", err.Error(), "previous_response_id")
+		return
+	}
+
+	// 指令不随 previous_response_id 继承，每次请求单独发送
+	messages := make([]chatMessage, 0, len(history)+len(input)+1)
+	if req.Instructions != "" {
+		messages = append(messages, chatMessage{Role: "system", Content: chatContent{{Type: "text", Text: req.Instructions}}})
+	}
+	messages = append(messages, history...)
+	messages = append(messages, input...)
+
+	chain := h.filters.Chain(c, req.Model)
+	messages, err = filterResponseMessages(c.Request.Context(), chain, messages)
+	if err != nil {
+		h.sendError(c, http.StatusBadRequest, filter.FinishReason, err.Error(), "input")
+		return
+	}
+
+	actualModelID, err := h.modelMgr.Route(c.Request.Context(), req.Model, responseRouteHints(messages, len(tools) > 0), c.GetHeader(h.modelMgr.SessionHeader()))
+	if err != nil {
+		h.sendModelError(c, err)
+		return
+	}
+
+	port, err := h.getModelPort(actualModelID)
+	if err != nil {
+		h.sendError(c, http.StatusInternalServerError, "server_error", err.Error(), "")
+		return
+	}
+
+	// 向量/重排序模式的模型不提供文本生成
+	if !h.checkGenerative(c, actualModelID, req.Model) {
+		return
+	}
+
+	done, err := h.modelMgr.AcquireSlot(c.Request.Context(), actualModelID)
+	if err != nil {
+		h.sendModelError(c, err)
+		return
+	}
+	defer done()
+
+	chatReq := map[string]interface{}{
+		"model":    actualModelID,
+		"messages": messages,
+		"stream":   req.Stream,
+	}
+	if req.Temperature != nil {
+		chatReq["temperature"] = *req.Temperature
+	}
+	if req.TopP != nil {
+		chatReq["top_p"] = *req.TopP
+	}
+	if req.MaxOutputTokens > 0 {
+		chatReq["max_tokens"] = req.MaxOutputTokens
+	}
+	if len(tools) > 0 {
+		chatReq["tools"] = tools
+	}
+	if toolChoice != nil {
+		chatReq["tool_choice"] = toolChoice
+	}
+	if req.ParallelToolCalls != nil {
+		chatReq["parallel_tool_calls"] = *req.ParallelToolCalls
+	}
+	if req.Stream {
+		// 让 llama.cpp 在最后一个数据块中返回 token 用量
+		chatReq["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+
+	captured := make([]capture.Message, 0, len(messages))
+	for _, msg := range messages {
+		captured = append(captured, capture.Message{Role: msg.Role, Content: msg.Content.Text()})
+	}
+	turn := h.capture.Begin(c.Writer, c.Request, "/v1/responses", captured)
+
+	resp := newResponse(&req)
+	conversation := append(history, input...)
+
+	upstream, start, ok := h.openUpstream(c, actualModelID, port, chatReq)
+	if !ok {
+		return
+	}
+	defer upstream.Body.Close()
+
+	if req.Stream {
+		h.streamResponses(c, actualModelID, resp, upstream, start, turn, chain, func() {
+			h.saveResponse(&req, resp, owner, conversation)
+		})
+		return
+	}
+
+	respBody, err := io.ReadAll(upstream.Body)
+	if err != nil {
+		h.sendError(c, http.StatusInternalServerError, "server_error", err.Error(), "")
+		return
+	}
+	if upstream.StatusCode != http.StatusOK {
+		c.Data(upstream.StatusCode, "application/json", respBody)
+		return
+	}
+	respBody = chain.Body(c.Request.Context(), respBody)
+
+	var chatResp ChatCompletionResponse
+	if err := json.Unmarshal(respBody, &chatResp); err != nil {
+		h.sendError(c, http.StatusBadGateway, "model_error", fmt.Sprintf("invalid upstream response: %v", err), "")
+		return
+	}
+	if u, ok := usage.Parse(respBody); ok {
+		h.usage.Record(c.Request, actualModelID, "/v1/responses", u, start, false)
+	}
+	turn.ParseResponse(respBody)
+	turn.Finish(actualModelID)
+
+	finishReason := ""
+	if len(chatResp.Choices) > 0 {
+		choice := chatResp.Choices[0]
+		finishReason = choice.FinishReason
+		resp.addChatMessage(choice.Message)
+	}
+	resp.complete(finishReason, chatResp.Usage)
+
+	h.saveResponse(&req, resp, owner, conversation)
+	c.JSON(http.StatusOK, resp)
+}
+
+// HandleGetResponse returns a stored response
+func (h *Handler) HandleGetResponse(c *gin.Context) {
+	record, ok := h.storedResponse(c)
+	if !ok {
+		return
+	}
+	c.Data(http.StatusOK, "application/json", []byte(record.Response))
+}
+
+// HandleDeleteResponse deletes a stored response
+func (h *Handler) HandleDeleteResponse(c *gin.Context) {
+	record, ok := h.storedResponse(c)
+	if !ok {
+		return
+	}
+	if err := h.responses.DeleteResponse(c.Request.Context(), record.ID); err != nil {
+		h.sendError(c, http.StatusInternalServerError, "server_error", err.Error(), "")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"id":      record.ID,
+		"object":  "response.deleted",
+		"deleted": true,
+	})
+}
+
+// storedResponse loads the response named in the path; on failure the error
+// response has already been sent. Responses created with another key are
+// reported as not found.
+func (h *Handler) storedResponse(c *gin.Context) (*storage.ResponseRecord, bool) {
+	id := c.Param("id")
+	if h.responses == nil {
+		h.sendError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("Response with id '%s' not found.", id), "id")
+		return nil, false
+	}
+
+	record, err := h.responses.GetResponse(c.Request.Context(), id)
+	if err == nil && record.APIKey != responseOwner(c) {
+		err = storage.ErrResponseNotFound
+	}
+	if errors.Is(err, storage.ErrResponseNotFound) {
+		h.sendError(c, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("Response with id '%s' not found.", id), "id")
+		return nil, false
+	}
+	if err != nil {
+		h.sendError(c, http.StatusInternalServerError, "server_error", err.Error(), "")
+		return nil, false
+	}
+	return record, true
+}
+
+// previousMessages loads the conversation of a stored response created with
+// the owner key; on failure it returns the HTTP status to reply with
+func (h *Handler) previousMessages(ctx context.Context, owner, id string) ([]chatMessage, int, error) {
+	if id == "" {
+		return nil, 0, nil
+	}
+	if h.responses == nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("previous_response_id requires response storage, which is not configured")
+	}
+
+	record, err := h.responses.GetResponse(ctx, id)
+	if err == nil && record.APIKey != owner {
+		err = storage.ErrResponseNotFound
+	}
+	if errors.Is(err, storage.ErrResponseNotFound) {
+		return nil, http.StatusNotFound, fmt.Errorf("Previous response with id '%s' not found.", id)
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	var messages []chatMessage
+	if err := json.Unmarshal([]byte(record.Messages), &messages); err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("stored response %s is corrupt: %v", id, err)
+	}
+	return messages, 0, nil
+}
+
+// saveResponse stores a finished response together with its conversation so
+// later requests with the owner key can continue it; failed responses and
+// store=false requests are not kept
+func (h *Handler) saveResponse(req *ResponseRequest, resp *Response, owner string, conversation []chatMessage) {
+	if h.responses == nil || (req.Store != nil && !*req.Store) || resp.Status == "failed" {
+		return
+	}
+
+	messages, err := json.Marshal(append(conversation, resp.chatMessage()))
+	if err != nil {
+		logger.Errorf("序列化响应会话失败: %v", err)
+		return
+	}
+	body, err := json.Marshal(resp)
+	if err != nil {
+		logger.Errorf("序列化响应失败: %v", err)
+		return
+	}
+
+	// 请求上下文可能已随客户端断开而取消，使用独立的超时上下文
+	ctx, cancel := context.WithTimeout(context.Background(), responseSaveTimeout)
+	defer cancel()
+	if err := h.responses.SaveResponse(ctx, &storage.ResponseRecord{
+		ID:                 resp.ID,
+		PreviousResponseID: resp.PreviousResponseID,
+		Model:              resp.Model,
+		APIKey:             owner,
+		Messages:           string(messages),
+		Response:           string(body),
+	}); err != nil {
+		logger.Errorf("保存响应失败: %v", err)
+	}
+}
+
+// responseOwner returns the ID of the key a request was authenticated with,
+// "" when authentication is disabled
+func responseOwner(c *gin.Context) string {
+	if key, ok := auth.FromContext(c); ok {
+		return key.ID
+	}
+	return ""
+}
+
+// openUpstream sends a chat completion request to llama.cpp. On failure the
+// error response has already been sent.
+func (h *Handler) openUpstream(c *gin.Context, modelID string, port int, req interface{}) (*http.Response, time.Time, bool) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		h.sendError(c, http.StatusInternalServerError, "server_error", err.Error(), "")
+		return nil, time.Time{}, false
+	}
+
+	url := fmt.Sprintf("http://127.0.0.1:%d/v1/chat/completions", port)
+	httpReq, err := http.NewRequestWithContext(c.Request.Context(), "POST", url, bytes.NewReader(body))
+	if err != nil {
+		h.sendError(c, http.StatusInternalServerError, "server_error", err.Error(), "")
+		return nil, time.Time{}, false
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	start := time.Now()
+	resp, err := h.client.Do(httpReq)
+	if err != nil {
+		h.sendError(c, http.StatusBadGateway, "model_error", err.Error(), "")
+		logger.Errorf("转发请求到 llama.cpp 失败: %v", err)
+		h.modelMgr.ReportUpstreamError(modelID, err)
+		return nil, time.Time{}, false
+	}
+	return resp, start, true
+}
+
+// newResponse creates an in-progress response for a request
+func newResponse(req *ResponseRequest) *Response {
+	tools := req.Tools
+	if tools == nil {
+		tools = []ResponseTool{}
+	}
+	return &Response{
+		ID:                 generateID("resp"),
+		Object:             "response",
+		CreatedAt:          time.Now().Unix(),
+		Status:             "in_progress",
+		Model:              req.Model,
+		Output:             []ResponseOutputItem{},
+		Instructions:       req.Instructions,
+		PreviousResponseID: req.PreviousResponseID,
+		Tools:              tools,
+		Metadata:           req.Metadata,
+	}
+}
+
+// addChatMessage adds the output items of a non-streaming chat reply: the
+// text as a message and each tool call as a function_call
+func (r *Response) addChatMessage(msg ChatMessage) {
+	if msg.Content != "" || len(msg.ToolCalls) == 0 {
+		r.Output = append(r.Output, ResponseOutputItem{
+			Type:    "message",
+			ID:      generateID("msg"),
+			Status:  "completed",
+			Role:    "assistant",
+			Content: []ResponseOutputText{newOutputText(msg.Content)},
+		})
+	}
+	for _, call := range msg.ToolCalls {
+		if call.Function == nil {
+			continue
+		}
+		callID := call.ID
+		if callID == "" {
+			callID = generateID("call")
+		}
+		r.Output = append(r.Output, ResponseOutputItem{
+			Type:      "function_call",
+			ID:        generateID("fc"),
+			Status:    "completed",
+			CallID:    callID,
+			Name:      call.Function.Name,
+			Arguments: call.Function.Arguments,
+		})
+	}
+}
+
+// complete sets the final status and usage of the response
+func (r *Response) complete(finishReason string, u *Usage) {
+	r.Status = "completed"
+	reason := ""
+	switch finishReason {
+	case "length":
+		reason = "max_output_tokens"
+	case filter.FinishReason:
+		reason = "content_filter"
+	}
+	if reason != "" {
+		r.Status = "incomplete"
+		r.IncompleteDetails = &IncompleteDetails{Reason: reason}
+		for i := range r.Output {
+			r.Output[i].Status = "incomplete"
+		}
+	}
+	if u != nil {
+		r.Usage = &ResponseUsage{
+			InputTokens:  u.PromptTokens,
+			OutputTokens: u.CompletionTokens,
+			TotalTokens:  u.TotalTokens,
+		}
+	}
+}
+
+// chatMessage converts the output back to the assistant chat message kept
+// in the stored conversation
+func (r *Response) chatMessage() chatMessage {
+	msg := chatMessage{Role: "assistant"}
+	var texts []string
+	for _, item := range r.Output {
+		switch item.Type {
+		case "message":
+			for _, part := range item.Content {
+				texts = append(texts, part.Text)
+			}
+		case "function_call":
+			msg.ToolCalls = append(msg.ToolCalls, ToolCall{
+				ID:       item.CallID,
+				Type:     "function",
+				Function: &FunctionCall{Name: item.Name, Arguments: toolArguments(item.Arguments)},
+			})
+		}
+	}
+	msg.Content = chatContent{{Type: "text", Text: strings.Join(texts, "")}}
+	return msg
+}
+
+func newOutputText(text string) ResponseOutputText {
+	return ResponseOutputText{Type: "output_text", Text: text, Annotations: []interface{}{}}
+}
+
+// parseResponseInput decodes the input field; a string is one user message
+func parseResponseInput(raw json.RawMessage) ([]ResponseInputItem, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, fmt.Errorf("Missing required parameter: input")
+	}
+
+	if raw[0] == '"' {
+		return []ResponseInputItem{{Type: "message", Role: "user", Content: raw}}, nil
+	}
+
+	var items []ResponseInputItem
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, fmt.Errorf("input must be a string or an array of input items")
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("Input array is empty")
+	}
+	return items, nil
+}
+
+// convertResponseInput converts input items to chat messages. function_call
+// items become assistant tool_calls and function_call_output items "tool"
+// messages.
+func convertResponseInput(items []ResponseInputItem) ([]chatMessage, error) {
+	messages := make([]chatMessage, 0, len(items))
+	for i, item := range items {
+		switch item.Type {
+		case "", "message":
+			content, err := convertResponseContent(item.Content)
+			if err != nil {
+				return nil, fmt.Errorf("input[%d]: %v", i, err)
+			}
+			role := item.Role
+			switch role {
+			case "developer":
+				role = "system"
+			case "user", "assistant", "system":
+			default:
+				return nil, fmt.Errorf("input[%d]: unsupported role %q", i, item.Role)
+			}
+			messages = append(messages, chatMessage{Role: role, Content: content})
+
+		case "function_call":
+			call := ToolCall{
+				ID:       item.CallID,
+				Type:     "function",
+				Function: &FunctionCall{Name: item.Name, Arguments: toolArguments(item.Arguments)},
+			}
+			// 连续的函数调用合并到同一条 assistant 消息
+			if last := len(messages) - 1; last >= 0 && messages[last].Role == "assistant" {
+				messages[last].ToolCalls = append(messages[last].ToolCalls, call)
+				continue
+			}
+			messages = append(messages, chatMessage{Role: "assistant", ToolCalls: []ToolCall{call}})
+
+		case "function_call_output":
+			messages = append(messages, chatMessage{
+				Role:       "tool",
+				Content:    chatContent{{Type: "text", Text: item.Output}},
+				ToolCallID: item.CallID,
+			})
+
+		default:
+			return nil, fmt.Errorf("input[%d]: unsupported input item type %q", i, item.Type)
+		}
+	}
+	return messages, nil
+}
+
+// convertResponseContent converts message content, a string or an array of
+// input_text, output_text and input_image parts
+func convertResponseContent(raw json.RawMessage) (chatContent, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return chatContent{{Type: "text", Text: text}}, nil
+	}
+
+	var parts []struct {
+		Type     string `json:"type"`
+		Text     string `json:"text"`
+		Refusal  string `json:"refusal"`
+		ImageURL string `json:"image_url"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return nil, fmt.Errorf("content must be a string or an array of content parts")
+	}
+
+	content := make(chatContent, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "input_text", "output_text":
+			content = append(content, chatPart{Type: "text", Text: part.Text})
+		case "refusal":
+			content = append(content, chatPart{Type: "text", Text: part.Refusal})
+		case "input_image":
+			if part.ImageURL == "" {
+				return nil, fmt.Errorf("input_image requires an image_url; file IDs are not supported")
+			}
+			content = append(content, chatPart{Type: "image_url", ImageURL: &chatImageURL{URL: part.ImageURL}})
+		default:
+			return nil, fmt.Errorf("unsupported content type %q", part.Type)
+		}
+	}
+	return content, nil
+}
+
+// convertResponseTools converts function tools to the chat completions form
+func convertResponseTools(tools []ResponseTool) ([]map[string]interface{}, error) {
+	converted := make([]map[string]interface{}, 0, len(tools))
+	for _, tool := range tools {
+		if tool.Type != "function" {
+			return nil, fmt.Errorf("unsupported tool type %q; only function tools are supported", tool.Type)
+		}
+		if tool.Name == "" {
+			return nil, fmt.Errorf("function tools require a name")
+		}
+
+		function := map[string]interface{}{
+			"name": tool.Name,
+		}
+		if tool.Description != "" {
+			function["description"] = tool.Description
+		}
+		if len(tool.Parameters) > 0 {
+			function["parameters"] = tool.Parameters
+		}
+		if tool.Strict != nil {
+			function["strict"] = *tool.Strict
+		}
+		converted = append(converted, map[string]interface{}{
+			"type":     "function",
+			"function": function,
+		})
+	}
+	return converted, nil
+}
+
+// convertResponseToolChoice converts a tool_choice to the chat completions form
+func convertResponseToolChoice(raw json.RawMessage) (interface{}, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var mode string
+	if err := json.Unmarshal(raw, &mode); err == nil {
+		switch mode {
+		case "auto", "none", "required":
+			return mode, nil
+		}
+		return nil, fmt.Errorf("unsupported tool_choice %q", mode)
+	}
+
+	var choice struct {
+		Type string `json:"type"`
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(raw, &choice); err != nil || choice.Type != "function" || choice.Name == "" {
+		return nil, fmt.Errorf("tool_choice must be auto, none, required or a function tool")
+	}
+	return map[string]interface{}{
+		"type":     "function",
+		"function": map[string]interface{}{"name": choice.Name},
+	}, nil
+}
+
+// responseRouteHints describes a request for virtual model routing
+func responseRouteHints(messages []chatMessage, tools bool) model.RouteHints {
+	texts := make([]string, 0, len(messages))
+	vision := false
+	for _, msg := range messages {
+		texts = append(texts, msg.Content.Text())
+		vision = vision || msg.Content.hasImages()
+	}
+	return model.RouteHints{
+		PromptTokens: model.EstimateTokens(texts...),
+		Tools:        tools,
+		Vision:       vision,
+	}
+}
+
+// toolArguments returns tool call arguments as a JSON object; llama.cpp may
+// return an empty string when the tool takes no arguments
+func toolArguments(arguments string) string {
+	if strings.TrimSpace(arguments) == "" {
+		return "{}"
+	}
+	return arguments
+}
+
+// generateID generates a unique ID for Responses API objects
+func generateID(prefix string) string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%s_%d", prefix, time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%s_%s", prefix, hex.EncodeToString(b))
+}
@@ -0,0 +1,326 @@
+package openai
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/capture"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/filter"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
+)
+
+// responseChunk is the part of a chat completion chunk used for translation
+type responseChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason *string `json:"finish_reason"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// responseStream turns llama-server's chat completion chunk stream into
+// Responses API semantic events
+type responseStream struct {
+	w       io.Writer
+	flusher http.Flusher
+	resp    *Response
+
+	sequence     int    // 下一个事件的 sequence_number
+	started      bool   // response.created 已发送
+	open         int    // 当前未完成的输出项下标，-1 表示没有
+	toolIndex    int    // 当前 function_call 对应的上游 tool_calls 下标
+	finishReason string // 上游 finish_reason
+	failed       bool   // 已发送 response.failed 事件
+}
+
+func newResponseStream(w io.Writer, flusher http.Flusher, resp *Response) *responseStream {
+	return &responseStream{
+		w:       w,
+		flusher: flusher,
+		resp:    resp,
+		open:    -1,
+	}
+}
+
+// handleLine translates one SSE line from upstream
+func (s *responseStream) handleLine(line string) {
+	data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+	if !ok || s.failed {
+		return
+	}
+	data = strings.TrimSpace(data)
+	if data == "" || data == "[DONE]" {
+		return
+	}
+
+	var chunk responseChunk
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		logger.Warnf("解析流式响应数据块失败: %v", err)
+		return
+	}
+	if chunk.Error != nil {
+		s.fail(chunk.Error.Message)
+		return
+	}
+
+	s.start()
+	for _, choice := range chunk.Choices {
+		if choice.Delta.Content != "" {
+			if !s.isOpen("message") {
+				s.openMessage()
+			}
+			item := &s.resp.Output[s.open]
+			item.Content[0].Text += choice.Delta.Content
+			s.writeEvent("response.output_text.delta", map[string]interface{}{
+				"item_id":       item.ID,
+				"output_index":  s.open,
+				"content_index": 0,
+				"delta":         choice.Delta.Content,
+			})
+		}
+		for _, call := range choice.Delta.ToolCalls {
+			// 每个工具调用的第一个数据块带有 id 和函数名，其后只有参数片段
+			if !s.isOpen("function_call") || call.Index != s.toolIndex {
+				s.toolIndex = call.Index
+				s.openFunctionCall(call.ID, call.Function.Name)
+			}
+			if call.Function.Arguments != "" {
+				item := &s.resp.Output[s.open]
+				item.Arguments += call.Function.Arguments
+				s.writeEvent("response.function_call_arguments.delta", map[string]interface{}{
+					"item_id":      item.ID,
+					"output_index": s.open,
+					"delta":        call.Function.Arguments,
+				})
+			}
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			s.finishReason = *choice.FinishReason
+		}
+	}
+}
+
+// finish closes the open output item and completes the response with its
+// token usage
+func (s *responseStream) finish(u usage.Usage) {
+	if s.failed {
+		return
+	}
+	s.start()
+	if len(s.resp.Output) == 0 {
+		// 没有生成任何内容时仍返回一条空消息
+		s.openMessage()
+	}
+	s.closeItem()
+
+	s.resp.complete(s.finishReason, &Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	})
+	event := "response.completed"
+	if s.resp.Status == "incomplete" {
+		event = "response.incomplete"
+	}
+	s.writeEvent(event, map[string]interface{}{"response": s.resp})
+}
+
+// fail marks the response failed; no further events follow
+func (s *responseStream) fail(message string) {
+	s.start()
+	s.failed = true
+	s.resp.Status = "failed"
+	s.resp.Error = &ResponseError{Code: "server_error", Message: message}
+	s.writeEvent("response.failed", map[string]interface{}{"response": s.resp})
+}
+
+func (s *responseStream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	s.writeEvent("response.created", map[string]interface{}{"response": s.resp})
+	s.writeEvent("response.in_progress", map[string]interface{}{"response": s.resp})
+}
+
+// isOpen reports whether an output item of the given type is in progress
+func (s *responseStream) isOpen(itemType string) bool {
+	return s.open >= 0 && s.resp.Output[s.open].Type == itemType
+}
+
+func (s *responseStream) openMessage() {
+	s.openItem(ResponseOutputItem{
+		Type:   "message",
+		ID:     generateID("msg"),
+		Status: "in_progress",
+		Role:   "assistant",
+	})
+
+	item := &s.resp.Output[s.open]
+	item.Content = []ResponseOutputText{newOutputText("")}
+	s.writeEvent("response.content_part.added", map[string]interface{}{
+		"item_id":       item.ID,
+		"output_index":  s.open,
+		"content_index": 0,
+		"part":          item.Content[0],
+	})
+}
+
+func (s *responseStream) openFunctionCall(callID, name string) {
+	if callID == "" {
+		callID = generateID("call")
+	}
+	s.openItem(ResponseOutputItem{
+		Type:   "function_call",
+		ID:     generateID("fc"),
+		Status: "in_progress",
+		CallID: callID,
+		Name:   name,
+	})
+}
+
+// openItem completes the current output item and starts a new one
+func (s *responseStream) openItem(item ResponseOutputItem) {
+	s.closeItem()
+	s.resp.Output = append(s.resp.Output, item)
+	s.open = len(s.resp.Output) - 1
+	s.writeEvent("response.output_item.added", map[string]interface{}{
+		"output_index": s.open,
+		"item":         item,
+	})
+}
+
+// closeItem sends the done events of the open output item
+func (s *responseStream) closeItem() {
+	if s.open < 0 {
+		return
+	}
+	index := s.open
+	s.open = -1
+
+	item := &s.resp.Output[index]
+	item.Status = "completed"
+	if s.finishReason == "length" {
+		item.Status = "incomplete"
+	}
+	switch item.Type {
+	case "message":
+		s.writeEvent("response.output_text.done", map[string]interface{}{
+			"item_id":       item.ID,
+			"output_index":  index,
+			"content_index": 0,
+			"text":          item.Content[0].Text,
+		})
+		s.writeEvent("response.content_part.done", map[string]interface{}{
+			"item_id":       item.ID,
+			"output_index":  index,
+			"content_index": 0,
+			"part":          item.Content[0],
+		})
+	case "function_call":
+		s.writeEvent("response.function_call_arguments.done", map[string]interface{}{
+			"item_id":      item.ID,
+			"output_index": index,
+			"arguments":    item.Arguments,
+		})
+	}
+	s.writeEvent("response.output_item.done", map[string]interface{}{
+		"output_index": index,
+		"item":         item,
+	})
+}
+
+// writeEvent writes one named SSE event and flushes it to the client
+func (s *responseStream) writeEvent(event string, data map[string]interface{}) {
+	data["type"] = event
+	data["sequence_number"] = s.sequence
+	s.sequence++
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		logger.Errorf("序列化流式事件失败: %v", err)
+		return
+	}
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, payload)
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
+
+// streamResponses relays an upstream chat completion stream as Responses API
+// events. turn, if not nil, captures the reply into the conversation store;
+// chain filters the generated text and save is called once the response is
+// complete.
+func (h *Handler) streamResponses(c *gin.Context, modelID string, resp *Response, upstream *http.Response, start time.Time, turn *capture.Turn, chain *filter.Chain, save func()) {
+	if upstream.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(upstream.Body)
+		c.Data(upstream.StatusCode, "application/json", respBody)
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Disable nginx buffering
+	c.Status(http.StatusOK)
+
+	stream := newResponseStream(c.Writer, c.Writer, resp)
+
+	var streamUsage usage.Usage
+	defer func() {
+		h.usage.Record(c.Request, modelID, "/v1/responses", streamUsage, start, true)
+		turn.Finish(modelID)
+	}()
+
+	reader := bufio.NewReader(upstream.Body)
+	filters := chain.Stream(c.Request.Context())
+	for {
+		line, err := reader.ReadString('\n')
+		line = filters.Line(line)
+		if u, ok := usage.ParseStreamLine(line); ok {
+			streamUsage = u
+		}
+		turn.ParseStreamLine(line)
+		stream.handleLine(line)
+		if filters.Blocked() {
+			// 被拦截后停止读取，响应以 content_filter 结束
+			break
+		}
+
+		if err != nil {
+			if c.Request.Context().Err() != nil {
+				return
+			}
+			if err != io.EOF {
+				logger.Errorf("读取流式响应失败: %v", err)
+				stream.fail(err.Error())
+				return
+			}
+			break
+		}
+	}
+
+	stream.finish(streamUsage)
+	if !stream.failed {
+		save()
+	}
+}
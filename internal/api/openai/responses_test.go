@@ -0,0 +1,426 @@
+package openai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/auth"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newResponsesTestHandler(t *testing.T) (*Handler, storage.Store) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store, err := storage.NewMemoryStore()
+	require.NoError(t, err)
+	handler := NewHandler(model.NewManager(config.DefaultConfig(), nil, process.NewManager()))
+	handler.SetResponseStore(store)
+	return handler, store
+}
+
+func TestConvertResponseInput(t *testing.T) {
+	t.Run("String input", func(t *testing.T) {
+		items, err := parseResponseInput(json.RawMessage(`"Hello"`))
+		require.NoError(t, err)
+		messages, err := convertResponseInput(items)
+		require.NoError(t, err)
+
+		body, err := json.Marshal(messages)
+		require.NoError(t, err)
+		assert.JSONEq(t, `[{"role":"user","content":"Hello"}]`, string(body))
+	})
+
+	t.Run("Item array", func(t *testing.T) {
+		items, err := parseResponseInput(json.RawMessage(`[
+			{"role": "developer", "content": "Be brief"},
+			{"type": "message", "role": "user", "content": [
+				{"type": "input_text", "text": "What is in this image?"},
+				{"type": "input_image", "image_url": "data:image/png;base64,AAAA"}
+			]},
+			{"type": "function_call", "call_id": "call_1", "name": "lookup", "arguments": "{\"q\":\"cat\"}"},
+			{"type": "function_call", "call_id": "call_2", "name": "now", "arguments": ""},
+			{"type": "function_call_output", "call_id": "call_1", "output": "a cat"},
+			{"type": "function_call_output", "call_id": "call_2", "output": "noon"}
+		]`))
+		require.NoError(t, err)
+		messages, err := convertResponseInput(items)
+		require.NoError(t, err)
+
+		body, err := json.Marshal(messages)
+		require.NoError(t, err)
+		assert.JSONEq(t, `[
+			{"role": "system", "content": "Be brief"},
+			{"role": "user", "content": [
+				{"type": "text", "text": "What is in this image?"},
+				{"type": "image_url", "image_url": {"url": "data:image/png;base64,AAAA"}}
+			]},
+			{"role": "assistant", "content": "", "tool_calls": [
+				{"id": "call_1", "type": "function", "function": {"name": "lookup", "arguments": "{\"q\":\"cat\"}"}},
+				{"id": "call_2", "type": "function", "function": {"name": "now", "arguments": "{}"}}
+			]},
+			{"role": "tool", "content": "a cat", "tool_call_id": "call_1"},
+			{"role": "tool", "content": "noon", "tool_call_id": "call_2"}
+		]`, string(body))
+
+		hints := responseRouteHints(messages, true)
+		assert.True(t, hints.Vision)
+		assert.True(t, hints.Tools)
+	})
+
+	t.Run("Invalid input", func(t *testing.T) {
+		for _, raw := range []string{``, `42`, `[]`} {
+			_, err := parseResponseInput(json.RawMessage(raw))
+			assert.Error(t, err, raw)
+		}
+
+		for _, raw := range []string{
+			`[{"type": "item_reference", "id": "msg_1"}]`,
+			`[{"role": "robot", "content": "hi"}]`,
+			`[{"role": "user", "content": [{"type": "input_file", "file_id": "file_1"}]}]`,
+			`[{"role": "user", "content": [{"type": "input_image", "file_id": "file_1"}]}]`,
+		} {
+			items, err := parseResponseInput(json.RawMessage(raw))
+			require.NoError(t, err)
+			_, err = convertResponseInput(items)
+			assert.Error(t, err, raw)
+		}
+	})
+}
+
+func TestConvertResponseTools(t *testing.T) {
+	tools, err := convertResponseTools([]ResponseTool{{
+		Type:        "function",
+		Name:        "lookup",
+		Description: "Look something up",
+		Parameters:  json.RawMessage(`{"type":"object"}`),
+	}})
+	require.NoError(t, err)
+	body, err := json.Marshal(tools)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"type":"function","function":{"name":"lookup","description":"Look something up","parameters":{"type":"object"}}}]`, string(body))
+
+	_, err = convertResponseTools([]ResponseTool{{Type: "web_search"}})
+	assert.Error(t, err)
+
+	choice, err := convertResponseToolChoice(json.RawMessage(`"required"`))
+	require.NoError(t, err)
+	assert.Equal(t, "required", choice)
+
+	choice, err = convertResponseToolChoice(json.RawMessage(`{"type":"function","name":"lookup"}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"type":     "function",
+		"function": map[string]interface{}{"name": "lookup"},
+	}, choice)
+
+	choice, err = convertResponseToolChoice(nil)
+	require.NoError(t, err)
+	assert.Nil(t, choice)
+
+	_, err = convertResponseToolChoice(json.RawMessage(`{"type":"web_search"}`))
+	assert.Error(t, err)
+}
+
+func TestResponseFromChat(t *testing.T) {
+	resp := newResponse(&ResponseRequest{Model: "qwen", Instructions: "Be brief"})
+	resp.addChatMessage(ChatMessage{
+		Role:    "assistant",
+		Content: "Let me check.",
+		ToolCalls: []ToolCall{
+			{ID: "call_1", Type: "function", Function: &FunctionCall{Name: "lookup", Arguments: `{"q":"cat"}`}},
+		},
+	})
+	resp.complete("tool_calls", &Usage{PromptTokens: 12, CompletionTokens: 5, TotalTokens: 17})
+
+	assert.Equal(t, "completed", resp.Status)
+	require.Len(t, resp.Output, 2)
+	assert.Equal(t, "message", resp.Output[0].Type)
+	assert.Equal(t, "Let me check.", resp.Output[0].Content[0].Text)
+	assert.Equal(t, "function_call", resp.Output[1].Type)
+	assert.Equal(t, "call_1", resp.Output[1].CallID)
+	assert.Equal(t, &ResponseUsage{InputTokens: 12, OutputTokens: 5, TotalTokens: 17}, resp.Usage)
+
+	body, err := json.Marshal(resp.chatMessage())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"role":"assistant","content":"Let me check.","tool_calls":[
+		{"id":"call_1","type":"function","function":{"name":"lookup","arguments":"{\"q\":\"cat\"}"}}]}`, string(body))
+
+	truncated := newResponse(&ResponseRequest{Model: "qwen"})
+	truncated.addChatMessage(ChatMessage{Role: "assistant", Content: "Once upon"})
+	truncated.complete("length", nil)
+	assert.Equal(t, "incomplete", truncated.Status)
+	assert.Equal(t, &IncompleteDetails{Reason: "max_output_tokens"}, truncated.IncompleteDetails)
+	assert.Equal(t, "incomplete", truncated.Output[0].Status)
+
+	filtered := newResponse(&ResponseRequest{Model: "qwen"})
+	filtered.complete("content_filter", nil)
+	assert.Equal(t, &IncompleteDetails{Reason: "content_filter"}, filtered.IncompleteDetails)
+}
+
+// streamResponsesUpstream 用给定的上游响应体调用 streamResponses 并解析输出事件
+func streamResponsesUpstream(t *testing.T, handler *Handler, body string, save func()) []map[string]interface{} {
+	t.Helper()
+
+	upstream := &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/responses", nil)
+	resp := newResponse(&ResponseRequest{Model: "qwen", Stream: true})
+	handler.streamResponses(c, "test-model", resp, upstream, time.Now(), nil, nil, save)
+	assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+
+	var events []map[string]interface{}
+	scanner := bufio.NewScanner(strings.NewReader(w.Body.String()))
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			var event map[string]interface{}
+			require.NoError(t, json.Unmarshal([]byte(data), &event))
+			events = append(events, event)
+		}
+	}
+	return events
+}
+
+func eventTypes(events []map[string]interface{}) []string {
+	types := make([]string, len(events))
+	for i, event := range events {
+		types[i] = event["type"].(string)
+	}
+	return types
+}
+
+func TestStreamResponses(t *testing.T) {
+	handler, _ := newResponsesTestHandler(t)
+
+	t.Run("Text and function call", func(t *testing.T) {
+		body := strings.Join([]string{
+			`data: {"choices":[{"index":0,"delta":{"role":"assistant","content":null},"finish_reason":null}]}`,
+			`data: {"choices":[{"index":0,"delta":{"content":"Checking"},"finish_reason":null}]}`,
+			`data: {"choices":[{"index":0,"delta":{"content":"."},"finish_reason":null}]}`,
+			`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"lookup","arguments":""}}]},"finish_reason":null}]}`,
+			`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"q\":"}}]},"finish_reason":null}]}`,
+			`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"cat\"}"}}]},"finish_reason":null}]}`,
+			`data: {"choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+			`data: {"choices":[],"usage":{"prompt_tokens":9,"completion_tokens":6,"total_tokens":15}}`,
+			`data: [DONE]`,
+			``,
+		}, "\n\n")
+
+		saved := false
+		events := streamResponsesUpstream(t, handler, body, func() { saved = true })
+		assert.True(t, saved)
+		assert.Equal(t, []string{
+			"response.created",
+			"response.in_progress",
+			"response.output_item.added",
+			"response.content_part.added",
+			"response.output_text.delta",
+			"response.output_text.delta",
+			"response.output_text.done",
+			"response.content_part.done",
+			"response.output_item.done",
+			"response.output_item.added",
+			"response.function_call_arguments.delta",
+			"response.function_call_arguments.delta",
+			"response.function_call_arguments.done",
+			"response.output_item.done",
+			"response.completed",
+		}, eventTypes(events))
+
+		for i, event := range events {
+			assert.Equal(t, float64(i), event["sequence_number"])
+		}
+		assert.Equal(t, "Checking.", events[6]["text"])
+		assert.Equal(t, `{"q":"cat"}`, events[12]["arguments"])
+
+		added := events[2]["item"].(map[string]interface{})
+		assert.Equal(t, []interface{}{}, added["content"])
+
+		completed := events[len(events)-1]["response"].(map[string]interface{})
+		assert.Equal(t, "completed", completed["status"])
+		output := completed["output"].([]interface{})
+		require.Len(t, output, 2)
+		call := output[1].(map[string]interface{})
+		assert.Equal(t, "call_1", call["call_id"])
+		assert.Equal(t, "lookup", call["name"])
+		assert.Equal(t, map[string]interface{}{"input_tokens": float64(9), "output_tokens": float64(6), "total_tokens": float64(15)}, completed["usage"])
+	})
+
+	t.Run("Upstream error", func(t *testing.T) {
+		body := `data: {"error":{"code":500,"message":"context overflow"}}` + "\n\n"
+
+		saved := false
+		events := streamResponsesUpstream(t, handler, body, func() { saved = true })
+		assert.False(t, saved)
+		assert.Equal(t, []string{"response.created", "response.in_progress", "response.failed"}, eventTypes(events))
+
+		failed := events[2]["response"].(map[string]interface{})
+		assert.Equal(t, "failed", failed["status"])
+		assert.Equal(t, "context overflow", failed["error"].(map[string]interface{})["message"])
+	})
+}
+
+func TestResponseChaining(t *testing.T) {
+	handler, store := newResponsesTestHandler(t)
+	ctx := context.Background()
+
+	req := &ResponseRequest{Model: "qwen", Instructions: "Be brief"}
+	first := newResponse(req)
+	first.addChatMessage(ChatMessage{Role: "assistant", Content: "Hello!"})
+	first.complete("stop", nil)
+	handler.saveResponse(req, first, "", []chatMessage{{Role: "user", Content: chatContent{{Type: "text", Text: "Hi"}}}})
+
+	history, _, err := handler.previousMessages(ctx, "", first.ID)
+	require.NoError(t, err)
+	body, err := json.Marshal(history)
+	require.NoError(t, err)
+	// 指令不保存在会话中
+	assert.JSONEq(t, `[{"role":"user","content":"Hi"},{"role":"assistant","content":"Hello!"}]`, string(body))
+
+	_, status, err := handler.previousMessages(ctx, "", "resp_missing")
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// store=false 的响应不保存
+	noStore := false
+	second := newResponse(&ResponseRequest{Model: "qwen"})
+	second.complete("stop", nil)
+	handler.saveResponse(&ResponseRequest{Store: &noStore}, second, "", nil)
+	_, err = store.GetResponse(ctx, second.ID)
+	assert.ErrorIs(t, err, storage.ErrResponseNotFound)
+
+	router := gin.New()
+	router.POST("/v1/responses", handler.HandleResponses)
+	router.GET("/v1/responses/:id", handler.HandleGetResponse)
+	router.DELETE("/v1/responses/:id", handler.HandleDeleteResponse)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/responses/"+first.ID, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	var got Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, first.ID, got.ID)
+	assert.Equal(t, "Be brief", got.Instructions)
+	assert.Equal(t, "Hello!", got.Output[0].Content[0].Text)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("DELETE", "/v1/responses/"+first.ID, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"`+first.ID+`","object":"response.deleted","deleted":true}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/responses/"+first.ID, nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestResponseOwner(t *testing.T) {
+	handler, store := newResponsesTestHandler(t)
+	ctx := context.Background()
+
+	cfg := config.DefaultConfig()
+	cfg.Security = config.SecurityConfig{APIKeyEnabled: true}
+	configMgr := config.NewManagerWithPath("standalone", filepath.Join(t.TempDir(), "server.config.yaml"))
+	require.NoError(t, configMgr.Save(cfg))
+
+	owner, ownerKey, err := auth.GenerateKey()
+	require.NoError(t, err)
+	other, otherKey, err := auth.GenerateKey()
+	require.NoError(t, err)
+	for _, key := range []*storage.APIKey{ownerKey, otherKey} {
+		key.Scopes = []string{auth.ScopeInference}
+		require.NoError(t, store.CreateAPIKey(ctx, key))
+	}
+
+	req := &ResponseRequest{Model: "qwen"}
+	resp := newResponse(req)
+	resp.complete("stop", nil)
+	handler.saveResponse(req, resp, ownerKey.ID, nil)
+
+	router := gin.New()
+	inference := router.Group("/v1", auth.NewAuthenticator(store, configMgr).Require(auth.ScopeInference))
+	inference.POST("/responses", handler.HandleResponses)
+	inference.GET("/responses/:id", handler.HandleGetResponse)
+	inference.DELETE("/responses/:id", handler.HandleDeleteResponse)
+	send := func(method, path, body, secret string) int {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Authorization", "Bearer "+secret)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// 其他密钥创建的响应视为不存在
+	t.Run("Other key", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, send("GET", "/v1/responses/"+resp.ID, "", other))
+		assert.Equal(t, http.StatusNotFound, send("DELETE", "/v1/responses/"+resp.ID, "", other))
+		assert.Equal(t, http.StatusNotFound, send("POST", "/v1/responses",
+			`{"model": "m", "input": "hi", "previous_response_id": "`+resp.ID+`"}`, other))
+
+		_, status, err := handler.previousMessages(ctx, "", resp.ID)
+		assert.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("Owner key", func(t *testing.T) {
+		_, _, err := handler.previousMessages(ctx, ownerKey.ID, resp.ID)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, send("GET", "/v1/responses/"+resp.ID, "", owner))
+		assert.Equal(t, http.StatusOK, send("DELETE", "/v1/responses/"+resp.ID, "", owner))
+		assert.Equal(t, http.StatusNotFound, send("GET", "/v1/responses/"+resp.ID, "", owner))
+	})
+}
+
+func TestHandleResponses(t *testing.T) {
+	handler, _ := newResponsesTestHandler(t)
+	router := gin.New()
+	router.POST("/v1/responses", handler.HandleResponses)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantParam  string
+	}{
+		{"missing model", `{"input": "hi"}`, http.StatusBadRequest, "model"},
+		{"missing input", `{"model": "m"}`, http.StatusBadRequest, "input"},
+		{"unsupported item", `{"model": "m", "input": [{"type": "reasoning"}]}`, http.StatusBadRequest, "input"},
+		{"unsupported tool", `{"model": "m", "input": "hi", "tools": [{"type": "file_search"}]}`, http.StatusBadRequest, "tools"},
+		{"invalid tool choice", `{"model": "m", "input": "hi", "tool_choice": "sometimes"}`, http.StatusBadRequest, "tool_choice"},
+		{"unknown previous response", `{"model": "m", "input": "hi", "previous_response_id": "resp_missing"}`, http.StatusNotFound, "previous_response_id"},
+		{"unknown model", `{"model": "m", "input": "hi"}`, http.StatusNotFound, "model"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/v1/responses", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+
+			var response ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.wantParam, response.Error.Param)
+		})
+	}
+}
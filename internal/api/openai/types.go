@@ -190,6 +190,54 @@ type TopLogprob struct {
 	Bytes   []byte  `json:"bytes,omitempty"`
 }
 
+// EmbeddingRequest represents an embeddings request
+type EmbeddingRequest struct {
+	Model          string          `json:"model"`
+	Input          json.RawMessage `json:"input"` // string, []string, []int or [][]int
+	EncodingFormat string          `json:"encoding_format,omitempty"`
+	Dimensions     int             `json:"dimensions,omitempty"`
+	User           string          `json:"user,omitempty"`
+}
+
+// EmbeddingResponse represents an embeddings response
+type EmbeddingResponse struct {
+	Object string          `json:"object"`
+	Data   []EmbeddingData `json:"data"`
+	Model  string          `json:"model"`
+	Usage  *Usage          `json:"usage,omitempty"`
+}
+
+// EmbeddingData represents a single embedding vector
+type EmbeddingData struct {
+	Object    string          `json:"object"`
+	Index     int             `json:"index"`
+	Embedding json.RawMessage `json:"embedding"` // []float64 or base64 string
+}
+
+// RerankRequest represents a Jina/Cohere style rerank request
+type RerankRequest struct {
+	Model           string            `json:"model"`
+	Query           string            `json:"query"`
+	Documents       []json.RawMessage `json:"documents"` // string or {"text": "..."}
+	TopN            int               `json:"top_n,omitempty"`
+	ReturnDocuments bool              `json:"return_documents,omitempty"`
+}
+
+// RerankResponse represents a rerank response
+type RerankResponse struct {
+	Object  string         `json:"object,omitempty"`
+	Model   string         `json:"model"`
+	Results []RerankResult `json:"results"`
+	Usage   *Usage         `json:"usage,omitempty"`
+}
+
+// RerankResult represents the relevance score of a single document
+type RerankResult struct {
+	Index          int             `json:"index"`
+	RelevanceScore float64         `json:"relevance_score"`
+	Document       json.RawMessage `json:"document,omitempty"`
+}
+
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Error ErrorDetail `json:"error"`
@@ -0,0 +1,87 @@
+// Package usage provides API handlers for token usage reports
+package usage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/api"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+)
+
+// dateLayout 查询参数允许只写日期
+const dateLayout = "2006-01-02"
+
+// Handler handles usage API requests
+type Handler struct {
+	store storage.Store
+}
+
+// NewHandler creates a new usage handler
+func NewHandler(store storage.Store) *Handler {
+	return &Handler{store: store}
+}
+
+// GetUsage returns token usage aggregated by the requested dimensions.
+//
+// Query parameters:
+//   - group_by: comma separated list of model, api_key, node
+//   - bucket: hour, day or month
+//   - from, to: RFC 3339 timestamps or dates (to is exclusive)
+//   - model, api_key, node: filters
+func (h *Handler) GetUsage(c *gin.Context) {
+	query := &storage.UsageQuery{
+		GroupBy: []string{},
+		Bucket:  c.Query("bucket"),
+		ModelID: c.Query("model"),
+		APIKey:  c.Query("api_key"),
+		NodeID:  c.Query("node"),
+	}
+	if groupBy := c.Query("group_by"); groupBy != "" {
+		for _, group := range strings.Split(groupBy, ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				query.GroupBy = append(query.GroupBy, group)
+			}
+		}
+	}
+
+	var err error
+	if query.From, err = parseTime(c.Query("from")); err != nil {
+		api.BadRequest(c, fmt.Sprintf("invalid from: %v", err))
+		return
+	}
+	if query.To, err = parseTime(c.Query("to")); err != nil {
+		api.BadRequest(c, fmt.Sprintf("invalid to: %v", err))
+		return
+	}
+
+	summaries, err := h.store.QueryUsage(c.Request.Context(), query)
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidUsageQuery) {
+			api.BadRequest(c, err.Error())
+			return
+		}
+		api.InternalError(c, err)
+		return
+	}
+
+	api.Success(c, gin.H{
+		"groupBy": query.GroupBy,
+		"bucket":  query.Bucket,
+		"usage":   summaries,
+	})
+}
+
+// parseTime 解析 RFC 3339 时间或 UTC 日期，空值表示不限制
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse(dateLayout, value)
+}
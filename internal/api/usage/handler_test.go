@@ -0,0 +1,76 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler_GetUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	store, err := storage.NewMemoryStore()
+	require.NoError(t, err)
+	defer store.Close()
+
+	ctx := context.Background()
+	day := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+	for _, record := range []*storage.UsageRecord{
+		{ModelID: "model-a", APIKey: "key-a", TotalTokens: 10, CreatedAt: day},
+		{ModelID: "model-a", APIKey: "key-b", TotalTokens: 20, CreatedAt: day},
+		{ModelID: "model-b", APIKey: "key-a", TotalTokens: 5, CreatedAt: day.AddDate(0, 0, 1)},
+	} {
+		require.NoError(t, store.RecordUsage(ctx, record))
+	}
+
+	router := gin.New()
+	router.GET("/api/usage", NewHandler(store).GetUsage)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantTotals []float64
+	}{
+		{"Total", "", http.StatusOK, []float64{35}},
+		{"By model", "?group_by=model", http.StatusOK, []float64{30, 5}},
+		{"By key and day", "?group_by=api_key&bucket=day", http.StatusOK, []float64{10, 20, 5}},
+		{"Date range", "?group_by=model&from=2026-10-16", http.StatusOK, []float64{5}},
+		{"Filter", "?api_key=key-b", http.StatusOK, []float64{20}},
+		{"Unknown group", "?group_by=team", http.StatusBadRequest, nil},
+		{"Invalid date", "?from=yesterday", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest("GET", "/api/usage"+tt.query, nil))
+			require.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantTotals == nil {
+				return
+			}
+
+			var resp struct {
+				Data struct {
+					Usage []struct {
+						TotalTokens float64 `json:"totalTokens"`
+					} `json:"usage"`
+				} `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			totals := make([]float64, 0, len(resp.Data.Usage))
+			for _, u := range resp.Data.Usage {
+				totals = append(totals, u.TotalTokens)
+			}
+			assert.Equal(t, tt.wantTotals, totals)
+		})
+	}
+}
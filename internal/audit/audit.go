@@ -0,0 +1,316 @@
+// Package audit records inference requests and their responses, so an
+// operator can see exactly what was sent to a model and replay it later.
+// Request bodies are redacted before they are stored.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/cluster/routing"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
+)
+
+const (
+	// DefaultMaxBodyBytes is the stored body size used when none is configured
+	DefaultMaxBodyBytes = 64 * 1024
+
+	// Redacted replaces the value of sensitive fields
+	Redacted = "[REDACTED]"
+
+	// recordTimeout 单条审计记录写入存储的最长时间
+	recordTimeout = 5 * time.Second
+
+	// pruneInterval 过期审计记录的清理间隔
+	pruneInterval = time.Hour
+)
+
+// defaultRedactFields 始终脱敏的 JSON 字段名（不区分大小写）
+var defaultRedactFields = []string{"api_key", "apikey", "access_token", "token", "password", "secret", "authorization"}
+
+// Recorder writes audit records for the requests passing its middleware.
+// A nil *Recorder records nothing.
+type Recorder struct {
+	store     storage.Store
+	configMgr *config.Manager
+	nodeID    string
+	mu        sync.RWMutex
+}
+
+// NewRecorder creates a recorder writing to store. configMgr supplies the
+// audit settings; with a nil configMgr nothing is recorded.
+func NewRecorder(store storage.Store, configMgr *config.Manager) *Recorder {
+	return &Recorder{store: store, configMgr: configMgr}
+}
+
+// SetNodeID sets the node ID stored with requests served by this node
+func (r *Recorder) SetNodeID(nodeID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nodeID = nodeID
+}
+
+func (r *Recorder) settings() config.AuditConfig {
+	if r.configMgr == nil {
+		return config.AuditConfig{}
+	}
+	settings := r.configMgr.Get().Gateway.Audit
+	if settings.MaxBodyBytes <= 0 {
+		settings.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	return settings
+}
+
+// Middleware records each POST request passing through it. It must run
+// before cluster routing so forwarded requests are recorded too.
+func (r *Recorder) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if r == nil || c.Request.Method != "POST" {
+			c.Next()
+			return
+		}
+		settings := r.settings()
+		if !settings.Enabled {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		// handler 记录用量时回填解析后的模型和 token 数；重放请求已带有报告时共用
+		report, ok := usage.ReportFrom(c.Request.Context())
+		if !ok {
+			report = &usage.Report{}
+			c.Request = c.Request.WithContext(usage.WithReport(c.Request.Context(), report))
+		}
+
+		log := &eventLog{}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), eventLogKey{}, log))
+
+		writer := &captureWriter{ResponseWriter: c.Writer, limit: settings.MaxBodyBytes}
+		c.Writer = writer
+
+		start := time.Now()
+		c.Next()
+
+		r.record(c, settings, body, writer, report, log, start)
+	}
+}
+
+// eventLog collects the events of a request for its audit record
+type eventLog struct {
+	mu     sync.Mutex
+	events []storage.AuditEvent
+}
+
+type eventLogKey struct{}
+
+// AddEvent adds an event to the audit record of the request of ctx. It does
+// nothing when the request is not being audited.
+func AddEvent(ctx context.Context, event storage.AuditEvent) {
+	log, ok := ctx.Value(eventLogKey{}).(*eventLog)
+	if !ok {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	log.events = append(log.events, event)
+}
+
+func (l *eventLog) list() []storage.AuditEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]storage.AuditEvent(nil), l.events...)
+}
+
+// record stores the audit record of a finished request
+func (r *Recorder) record(c *gin.Context, settings config.AuditConfig, body []byte, writer *captureWriter, report *usage.Report, log *eventLog, start time.Time) {
+	modelID, u := report.Result()
+	if modelID == "" {
+		// 转发到其他节点或未到达上游的请求，取请求中的模型名
+		var req struct {
+			Model string `json:"model"`
+		}
+		json.Unmarshal(body, &req)
+		modelID = req.Model
+	}
+
+	nodeID := writer.Header().Get(routing.NodeHeader)
+	if nodeID == "" {
+		r.mu.RLock()
+		nodeID = r.nodeID
+		r.mu.RUnlock()
+	}
+
+	contentType := writer.Header().Get("Content-Type")
+	requestBody, requestTruncated := truncate(Redact(body, settings.RedactFields), settings.MaxBodyBytes)
+
+	record := &storage.AuditRecord{
+		RequestID:        c.GetString("requestId"),
+		ModelID:          modelID,
+		APIKey:           usage.KeyID(c.Request),
+		NodeID:           nodeID,
+		Method:           c.Request.Method,
+		Path:             c.Request.URL.Path,
+		Status:           writer.Status(),
+		Stream:           strings.Contains(contentType, "text/event-stream") || strings.Contains(contentType, "application/x-ndjson"),
+		LatencyMs:        time.Since(start).Milliseconds(),
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+		RequestBody:      requestBody,
+		ResponseBody:     writer.body.String(),
+		Truncated:        requestTruncated || writer.truncated,
+		Events:           log.list(),
+	}
+
+	// 请求上下文可能已随客户端断开而取消，使用独立的超时上下文
+	ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+	defer cancel()
+	if err := r.store.RecordAudit(ctx, record); err != nil {
+		logger.Warn("记录审计日志失败", "requestId", record.RequestID, "error", err)
+	}
+}
+
+// Run deletes records older than the retention period until ctx is done
+func (r *Recorder) Run(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	ticker := time.NewTicker(pruneInterval)
+	defer ticker.Stop()
+
+	for {
+		r.prune(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Recorder) prune(ctx context.Context) {
+	days := r.settings().RetentionDays
+	if days <= 0 {
+		return
+	}
+	pruned, err := r.store.PruneAudit(ctx, time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		logger.Warn("清理审计日志失败", "error", err)
+		return
+	}
+	if pruned > 0 {
+		logger.Info("已清理过期审计日志", "count", pruned)
+	}
+}
+
+// Redact replaces the values of sensitive fields in a JSON body. Bodies that
+// are not JSON, or contain no sensitive fields, are returned unchanged.
+func Redact(body []byte, extraFields []string) []byte {
+	fields := make(map[string]bool, len(defaultRedactFields)+len(extraFields))
+	for _, field := range defaultRedactFields {
+		fields[field] = true
+	}
+	for _, field := range extraFields {
+		fields[strings.ToLower(field)] = true
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return body
+	}
+	if !redactValue(value, fields) {
+		return body
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return body
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
+
+// redactValue redacts nested objects in place and reports whether anything
+// was replaced
+func redactValue(value interface{}, fields map[string]bool) bool {
+	redacted := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if fields[strings.ToLower(key)] {
+				v[key] = Redacted
+				redacted = true
+				continue
+			}
+			if redactValue(item, fields) {
+				redacted = true
+			}
+		}
+	case []interface{}:
+		for _, item := range v {
+			if redactValue(item, fields) {
+				redacted = true
+			}
+		}
+	}
+	return redacted
+}
+
+// truncate cuts body to limit bytes
+func truncate(body []byte, limit int) (string, bool) {
+	if len(body) <= limit {
+		return string(body), false
+	}
+	return string(body[:limit]), true
+}
+
+// captureWriter keeps the start of the response body while writing it
+// through to the client
+type captureWriter struct {
+	gin.ResponseWriter
+	body      bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (w *captureWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *captureWriter) capture(data []byte) {
+	room := w.limit - w.body.Len()
+	if len(data) > room {
+		w.body.Write(data[:room])
+		w.truncated = true
+		return
+	}
+	w.body.Write(data)
+}
@@ -0,0 +1,147 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/cluster/routing"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRecorder(t *testing.T, settings config.AuditConfig) (*Recorder, storage.Store) {
+	t.Helper()
+	store, err := storage.NewMemoryStore()
+	require.NoError(t, err)
+
+	cfg := config.DefaultConfig()
+	cfg.Gateway.Audit = settings
+	configMgr := config.NewManagerWithPath("standalone", filepath.Join(t.TempDir(), "server.config.yaml"))
+	require.NoError(t, configMgr.Save(cfg))
+
+	return NewRecorder(store, configMgr), store
+}
+
+func newTestEngine(recorder *Recorder, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", func(c *gin.Context) {
+		c.Set("requestId", "req-1")
+		c.Next()
+	}, recorder.Middleware(), handler)
+	return engine
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Run("Records request and response", func(t *testing.T) {
+		recorder, store := newTestRecorder(t, config.AuditConfig{Enabled: true})
+		recorder.SetNodeID("node-1")
+		usageRec := usage.NewRecorder(store, nil)
+		engine := newTestEngine(recorder, func(c *gin.Context) {
+			// handler 仍能读取完整请求体
+			var req struct {
+				Model string `json:"model"`
+			}
+			require.NoError(t, c.ShouldBindJSON(&req))
+			usageRec.Record(c.Request, "qwen-resolved", "/v1/chat/completions", usage.Usage{PromptTokens: 3, CompletionTokens: 2}, time.Now(), false)
+			AddEvent(c.Request.Context(), storage.AuditEvent{Type: "filter.rewrite", Filter: "pii", Stage: "request"})
+			c.JSON(http.StatusOK, gin.H{"model": req.Model})
+		})
+
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"qwen","api_key":"sk-secret"}`))
+		req.Header.Set("Authorization", "Bearer sk-team-a")
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.JSONEq(t, `{"model":"qwen"}`, w.Body.String())
+
+		records, err := store.QueryAudit(context.Background(), &storage.AuditQuery{})
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		record := records[0]
+		assert.Equal(t, "req-1", record.RequestID)
+		assert.Equal(t, "qwen-resolved", record.ModelID)
+		assert.Equal(t, usage.KeyID(req), record.APIKey)
+		assert.Equal(t, "node-1", record.NodeID)
+		assert.Equal(t, "/v1/chat/completions", record.Path)
+		assert.Equal(t, http.StatusOK, record.Status)
+		assert.Equal(t, 5, record.TotalTokens)
+		assert.JSONEq(t, `{"model":"qwen","api_key":"[REDACTED]"}`, record.RequestBody)
+		assert.JSONEq(t, `{"model":"qwen"}`, record.ResponseBody)
+		assert.False(t, record.Stream)
+		assert.False(t, record.Truncated)
+		require.Len(t, record.Events, 1)
+		assert.Equal(t, "pii", record.Events[0].Filter)
+		assert.False(t, record.Events[0].Time.IsZero())
+	})
+
+	t.Run("Forwarded stream", func(t *testing.T) {
+		recorder, store := newTestRecorder(t, config.AuditConfig{Enabled: true, MaxBodyBytes: 16})
+		recorder.SetNodeID("master")
+		engine := newTestEngine(recorder, func(c *gin.Context) {
+			c.Header(routing.NodeHeader, "client-2")
+			c.Header("Content-Type", "text/event-stream")
+			c.String(http.StatusOK, "data: {\"choices\":[]}\n\ndata: [DONE]\n\n")
+		})
+
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"llama","stream":true}`))
+		engine.ServeHTTP(httptest.NewRecorder(), req)
+
+		records, err := store.QueryAudit(context.Background(), &storage.AuditQuery{})
+		require.NoError(t, err)
+		require.Len(t, records, 1)
+		assert.Equal(t, "llama", records[0].ModelID)
+		assert.Equal(t, "client-2", records[0].NodeID)
+		assert.True(t, records[0].Stream)
+		assert.True(t, records[0].Truncated)
+		assert.Len(t, records[0].RequestBody, 16)
+		assert.Len(t, records[0].ResponseBody, 16)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		recorder, store := newTestRecorder(t, config.AuditConfig{})
+		engine := newTestEngine(recorder, func(c *gin.Context) {
+			AddEvent(c.Request.Context(), storage.AuditEvent{Type: "filter.block"})
+			c.Status(http.StatusOK)
+		})
+		engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{}`)))
+
+		records, err := store.QueryAudit(context.Background(), &storage.AuditQuery{})
+		require.NoError(t, err)
+		assert.Empty(t, records)
+	})
+}
+
+func TestRedact(t *testing.T) {
+	body := []byte(`{"model":"qwen","Password":"p","messages":[{"role":"user","content":"<b>hi</b>"}],"metadata":{"user_email":"a@b.c","n":1.50}}`)
+	redacted := Redact(body, []string{"user_email"})
+	assert.Equal(t, `{"Password":"[REDACTED]","messages":[{"content":"<b>hi</b>","role":"user"}],"metadata":{"n":1.50,"user_email":"[REDACTED]"},"model":"qwen"}`, string(redacted))
+
+	// 无敏感字段或非 JSON 时原样返回
+	clean := []byte(`{"model": "qwen"}`)
+	assert.Equal(t, clean, Redact(clean, nil))
+	assert.Equal(t, []byte("not json"), Redact([]byte("not json"), nil))
+}
+
+func TestPrune(t *testing.T) {
+	recorder, store := newTestRecorder(t, config.AuditConfig{Enabled: true, RetentionDays: 7})
+	ctx := context.Background()
+	require.NoError(t, store.RecordAudit(ctx, &storage.AuditRecord{RequestID: "old", CreatedAt: time.Now().AddDate(0, 0, -8)}))
+	require.NoError(t, store.RecordAudit(ctx, &storage.AuditRecord{RequestID: "new"}))
+
+	recorder.prune(ctx)
+
+	records, err := store.QueryAudit(ctx, &storage.AuditQuery{})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, "new", records[0].RequestID)
+}
@@ -0,0 +1,295 @@
+// Package auth authenticates API requests against the keys in the storage
+// backend and enforces their scopes and model allow-lists.
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/api"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/cluster/routing"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
+)
+
+// Scopes a key can be granted
+const (
+	ScopeInference = "inference" // 推理接口（OpenAI / Anthropic / Ollama）
+	ScopeRead      = "read"      // 管理接口只读访问
+	ScopeAdmin     = "admin"     // 全部接口，包括密钥管理
+)
+
+const (
+	// keyPrefix 生成的密钥前缀
+	keyPrefix = "sk-shep-"
+
+	// displayPrefixLen 列表中显示的密钥前缀长度
+	displayPrefixLen = len(keyPrefix) + 6
+
+	// contextKey 认证通过的密钥在 gin.Context 中的键
+	contextKey = "apiKey"
+)
+
+// Authentication errors
+var (
+	ErrMissingKey = errors.New("missing API key")
+	ErrInvalidKey = errors.New("invalid API key")
+	ErrExpiredKey = errors.New("API key expired")
+)
+
+// ValidScope reports whether scope is a known scope
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeInference, ScopeRead, ScopeAdmin:
+		return true
+	}
+	return false
+}
+
+// HasScope reports whether key grants scope. The admin scope grants all.
+func HasScope(key *storage.APIKey, scope string) bool {
+	for _, granted := range key.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// ModelAllowed reports whether key may use model. Keys without an
+// allow-list may use every model.
+func ModelAllowed(key *storage.APIKey, model string) bool {
+	if len(key.AllowedModels) == 0 {
+		return true
+	}
+	for _, allowed := range key.AllowedModels {
+		if allowed == model {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateKey creates a new random key. The secret is returned once and
+// only its hash is kept in the returned record.
+func GenerateKey() (string, *storage.APIKey, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, err
+	}
+	secret := keyPrefix + hex.EncodeToString(buf)
+	return secret, &storage.APIKey{
+		ID:     usage.Fingerprint(secret),
+		Prefix: secret[:displayPrefixLen],
+		Hash:   hashKey(secret),
+	}, nil
+}
+
+func hashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// FromContext returns the key a request was authenticated with
+func FromContext(c *gin.Context) (*storage.APIKey, bool) {
+	value, ok := c.Get(contextKey)
+	if !ok {
+		return nil, false
+	}
+	key, ok := value.(*storage.APIKey)
+	return key, ok
+}
+
+// Authenticator checks request keys. A nil *Authenticator allows everything.
+type Authenticator struct {
+	store     storage.Store
+	configMgr *config.Manager
+}
+
+// NewAuthenticator creates an authenticator for the keys in store.
+// configMgr supplies security.api_key_enabled; with a nil configMgr
+// authentication is disabled.
+func NewAuthenticator(store storage.Store, configMgr *config.Manager) *Authenticator {
+	return &Authenticator{store: store, configMgr: configMgr}
+}
+
+func (a *Authenticator) settings() config.SecurityConfig {
+	if a == nil || a.configMgr == nil {
+		return config.SecurityConfig{}
+	}
+	return a.configMgr.Get().Security
+}
+
+// Enabled reports whether requests must carry a key
+func (a *Authenticator) Enabled() bool {
+	return a.settings().APIKeyEnabled
+}
+
+// Authenticate returns the stored key matching secret. The key configured
+// in security.api_key is accepted as an admin key.
+func (a *Authenticator) Authenticate(ctx context.Context, secret string) (*storage.APIKey, error) {
+	if secret == "" {
+		return nil, ErrMissingKey
+	}
+	id := usage.Fingerprint(secret)
+
+	if configured := a.settings().APIKey; configured != "" &&
+		subtle.ConstantTimeCompare([]byte(secret), []byte(configured)) == 1 {
+		return &storage.APIKey{ID: id, Name: "config", Scopes: []string{ScopeAdmin}}, nil
+	}
+
+	if a.store == nil {
+		return nil, ErrInvalidKey
+	}
+	key, err := a.store.GetAPIKey(ctx, id)
+	if errors.Is(err, storage.ErrAPIKeyNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashKey(secret)), []byte(key.Hash)) != 1 {
+		return nil, ErrInvalidKey
+	}
+	if key.ExpiresAt != nil && !time.Now().Before(*key.ExpiresAt) {
+		return nil, ErrExpiredKey
+	}
+	return key, nil
+}
+
+// Require rejects requests whose key lacks scope. For the inference scope
+// it also checks the model named in the request body against the key's
+// allow-list; requests forwarded by the cluster master were checked there
+// and carry the master's key in routing.KeyHeader instead.
+// It must run before audit and cluster routing.
+func (a *Authenticator) Require(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if scope == ScopeInference && routing.Routed(c) {
+			if key, ok := routedKey(c.Request); ok {
+				c.Set(contextKey, key)
+			}
+			c.Next()
+			return
+		}
+		c.Request.Header.Del(routing.KeyHeader)
+		key, ok := a.check(c, scope)
+		if !ok {
+			return
+		}
+		if key != nil && scope == ScopeInference && len(key.AllowedModels) > 0 && c.Request.Method == http.MethodPost {
+			model := requestModel(c)
+			if model == "" || !ModelAllowed(key, model) {
+				api.Forbidden(c, "API key is not allowed to use model: "+model)
+				c.Abort()
+				return
+			}
+		}
+		if key != nil && scope == ScopeInference {
+			// 请求被路由到其他节点时随之转发，节点据此应用密钥的过滤器
+			if data, err := json.Marshal(forwardedKey{ID: key.ID, Name: key.Name, Filters: key.Filters}); err == nil {
+				c.Request.Header.Set(routing.KeyHeader, string(data))
+			}
+		}
+		c.Next()
+	}
+}
+
+// forwardedKey is the part of a key sent with requests the master routes
+// to other nodes
+type forwardedKey struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name,omitempty"`
+	Filters []string `json:"filters,omitempty"`
+}
+
+// routedKey returns the key the master forwarded with a routed request
+func routedKey(r *http.Request) (*storage.APIKey, bool) {
+	header := r.Header.Get(routing.KeyHeader)
+	if header == "" {
+		return nil, false
+	}
+	var key forwardedKey
+	if err := json.Unmarshal([]byte(header), &key); err != nil || key.ID == "" {
+		return nil, false
+	}
+	return &storage.APIKey{ID: key.ID, Name: key.Name, Scopes: []string{ScopeInference}, Filters: key.Filters}, true
+}
+
+// Management protects management endpoints: reads need the read scope,
+// changes need the admin scope.
+func (a *Authenticator) Management() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := ScopeAdmin
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			scope = ScopeRead
+		}
+		if _, ok := a.check(c, scope); ok {
+			c.Next()
+		}
+	}
+}
+
+// check authenticates the request and verifies scope. It writes the error
+// response and aborts when the request is rejected. The returned key is nil
+// when authentication is disabled.
+func (a *Authenticator) check(c *gin.Context, scope string) (*storage.APIKey, bool) {
+	if !a.Enabled() || c.Request.Method == http.MethodOptions {
+		return nil, true
+	}
+
+	key, err := a.Authenticate(c.Request.Context(), usage.RequestKey(c.Request))
+	if err != nil {
+		if !errors.Is(err, ErrMissingKey) && !errors.Is(err, ErrInvalidKey) && !errors.Is(err, ErrExpiredKey) {
+			api.InternalError(c, err)
+			c.Abort()
+			return nil, false
+		}
+		c.Header("WWW-Authenticate", `Bearer realm="shepherd"`)
+		api.Unauthorized(c, err.Error())
+		c.Abort()
+		return nil, false
+	}
+	if !HasScope(key, scope) {
+		api.Forbidden(c, "API key lacks scope: "+scope)
+		c.Abort()
+		return nil, false
+	}
+
+	c.Set(contextKey, key)
+	return key, true
+}
+
+// requestModel reads the model named in the :id path parameter or in a JSON
+// request body, restoring the body for the handler
+func requestModel(c *gin.Context) string {
+	if id := c.Param("id"); id != "" {
+		return id
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var req struct {
+		Model string `json:"model"`
+		Name  string `json:"name"` // Ollama /api/show 等接口
+	}
+	json.Unmarshal(body, &req)
+	if req.Model != "" {
+		return req.Model
+	}
+	return req.Name
+}
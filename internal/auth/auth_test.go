@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/cluster/routing"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/pki"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestAuthenticator(t *testing.T, security config.SecurityConfig) (*Authenticator, storage.Store) {
+	t.Helper()
+	store, err := storage.NewMemoryStore()
+	require.NoError(t, err)
+
+	cfg := config.DefaultConfig()
+	cfg.Security = security
+	configMgr := config.NewManagerWithPath("standalone", filepath.Join(t.TempDir(), "server.config.yaml"))
+	require.NoError(t, configMgr.Save(cfg))
+
+	return NewAuthenticator(store, configMgr), store
+}
+
+// createKey stores a new key and returns its secret
+func createKey(t *testing.T, store storage.Store, scopes []string, models []string, expires *time.Time) string {
+	t.Helper()
+	secret, key, err := GenerateKey()
+	require.NoError(t, err)
+	key.Scopes = scopes
+	key.AllowedModels = models
+	key.ExpiresAt = expires
+	require.NoError(t, store.CreateAPIKey(context.Background(), key))
+	return secret
+}
+
+func newTestEngine(a *Authenticator) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.POST("/v1/chat/completions", a.Require(ScopeInference), func(c *gin.Context) {
+		// handler 仍能读取完整请求体
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, string(body))
+	})
+	engine.POST("/api/models/:id/tokenize", a.Require(ScopeInference), func(c *gin.Context) { c.Status(http.StatusOK) })
+	management := engine.Group("/api", a.Management())
+	management.GET("/models", func(c *gin.Context) { c.Status(http.StatusOK) })
+	management.POST("/models/:id/load", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return engine
+}
+
+func serve(engine *gin.Engine, method, path, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func bearer(secret string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + secret}}
+}
+
+func TestGenerateKey(t *testing.T) {
+	secret, key, err := GenerateKey()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(secret, keyPrefix))
+	assert.True(t, strings.HasPrefix(secret, key.Prefix))
+	assert.NotContains(t, key.Hash, secret)
+	assert.Regexp(t, `^key-[0-9a-f]{12}$`, key.ID)
+}
+
+func TestDisabled(t *testing.T) {
+	a, _ := newTestAuthenticator(t, config.SecurityConfig{})
+	engine := newTestEngine(a)
+
+	assert.Equal(t, http.StatusOK, serve(engine, "POST", "/v1/chat/completions", `{}`, nil).Code)
+	assert.Equal(t, http.StatusOK, serve(engine, "POST", "/api/models/qwen/load", `{}`, nil).Code)
+
+	var nilAuth *Authenticator
+	assert.False(t, nilAuth.Enabled())
+}
+
+func TestScopes(t *testing.T) {
+	a, store := newTestAuthenticator(t, config.SecurityConfig{APIKeyEnabled: true})
+	engine := newTestEngine(a)
+
+	inference := createKey(t, store, []string{ScopeInference}, nil, nil)
+	read := createKey(t, store, []string{ScopeRead}, nil, nil)
+	admin := createKey(t, store, []string{ScopeAdmin}, nil, nil)
+
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		header http.Header
+		status int
+	}{
+		{"missing key", "POST", "/v1/chat/completions", nil, http.StatusUnauthorized},
+		{"unknown key", "POST", "/v1/chat/completions", bearer("sk-shep-unknown"), http.StatusUnauthorized},
+		{"inference", "POST", "/v1/chat/completions", bearer(inference), http.StatusOK},
+		{"inference via x-api-key", "POST", "/v1/chat/completions", http.Header{"X-Api-Key": {inference}}, http.StatusOK},
+		{"inference on management", "GET", "/api/models", bearer(inference), http.StatusForbidden},
+		{"read on inference", "POST", "/v1/chat/completions", bearer(read), http.StatusForbidden},
+		{"read", "GET", "/api/models", bearer(read), http.StatusOK},
+		{"read cannot change", "POST", "/api/models/qwen/load", bearer(read), http.StatusForbidden},
+		{"admin inference", "POST", "/v1/chat/completions", bearer(admin), http.StatusOK},
+		{"admin change", "POST", "/api/models/qwen/load", bearer(admin), http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := serve(engine, tc.method, tc.path, `{"model":"qwen"}`, tc.header)
+			assert.Equal(t, tc.status, w.Code, w.Body.String())
+			if tc.status == http.StatusUnauthorized {
+				assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestExpiredKey(t *testing.T) {
+	a, store := newTestAuthenticator(t, config.SecurityConfig{APIKeyEnabled: true})
+	past := time.Now().Add(-time.Minute)
+	secret := createKey(t, store, []string{ScopeAdmin}, nil, &past)
+
+	_, err := a.Authenticate(context.Background(), secret)
+	assert.ErrorIs(t, err, ErrExpiredKey)
+	assert.Equal(t, http.StatusUnauthorized, serve(newTestEngine(a), "GET", "/api/models", "", bearer(secret)).Code)
+}
+
+func TestConfigKey(t *testing.T) {
+	a, _ := newTestAuthenticator(t, config.SecurityConfig{APIKeyEnabled: true, APIKey: "legacy-secret"})
+
+	key, err := a.Authenticate(context.Background(), "legacy-secret")
+	require.NoError(t, err)
+	assert.True(t, HasScope(key, ScopeInference))
+	assert.True(t, HasScope(key, ScopeRead))
+
+	_, err = a.Authenticate(context.Background(), "legacy")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestAllowedModels(t *testing.T) {
+	a, store := newTestAuthenticator(t, config.SecurityConfig{APIKeyEnabled: true})
+	engine := newTestEngine(a)
+	secret := createKey(t, store, []string{ScopeInference}, []string{"qwen"}, nil)
+
+	w := serve(engine, "POST", "/v1/chat/completions", `{"model":"qwen"}`, bearer(secret))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"model":"qwen"}`, w.Body.String())
+
+	assert.Equal(t, http.StatusForbidden, serve(engine, "POST", "/v1/chat/completions", `{"model":"llama"}`, bearer(secret)).Code)
+	assert.Equal(t, http.StatusForbidden, serve(engine, "POST", "/v1/chat/completions", `{}`, bearer(secret)).Code)
+
+	// 路径中的模型同样受限
+	assert.Equal(t, http.StatusOK, serve(engine, "POST", "/api/models/qwen/tokenize", `{"content":"hi"}`, bearer(secret)).Code)
+	assert.Equal(t, http.StatusForbidden, serve(engine, "POST", "/api/models/llama/tokenize", `{"content":"hi"}`, bearer(secret)).Code)
+}
+
+func TestRoutedByMaster(t *testing.T) {
+	a, _ := newTestAuthenticator(t, config.SecurityConfig{APIKeyEnabled: true})
+	engine := newTestEngine(a)
+	engine.Use(routing.TrustMaster())
+	engine.POST("/v1/completions", a.Require(ScopeInference), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	dir := t.TempDir()
+	authority, err := pki.LoadOrCreateAuthority(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"), 0)
+	require.NoError(t, err)
+	master, err := authority.Issue("master-1", nil)
+	require.NoError(t, err)
+
+	routed := func(cert *x509.Certificate) int {
+		req := httptest.NewRequest("POST", "/v1/completions", strings.NewReader(`{"model":"qwen"}`))
+		req.Header.Set(routing.RoutedHeader, "master-1")
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Master 转发的请求已在 Master 上校验密钥
+	assert.Equal(t, http.StatusOK, routed(master.Leaf))
+	// 客户端自行设置路由标记仍需要密钥
+	assert.Equal(t, http.StatusUnauthorized, routed(nil))
+}
+
+func TestForwardedKey(t *testing.T) {
+	a, store := newTestAuthenticator(t, config.SecurityConfig{APIKeyEnabled: true})
+	secret, key, err := GenerateKey()
+	require.NoError(t, err)
+	key.Name = "team-a"
+	key.Scopes = []string{ScopeInference}
+	key.Filters = []string{"pii"}
+	require.NoError(t, store.CreateAPIKey(context.Background(), key))
+
+	// Master 认证后在请求上附带密钥，路由到节点时随之转发
+	var forwarded string
+	gin.SetMode(gin.TestMode)
+	master := gin.New()
+	master.POST("/v1/completions", a.Require(ScopeInference), func(c *gin.Context) {
+		forwarded = c.GetHeader(routing.KeyHeader)
+		c.Status(http.StatusOK)
+	})
+	header := bearer(secret)
+	header.Set(routing.KeyHeader, `{"id":"key-spoofed"}`)
+	require.Equal(t, http.StatusOK, serve(master, "POST", "/v1/completions", `{"model":"qwen"}`, header).Code)
+	require.NotEmpty(t, forwarded)
+
+	dir := t.TempDir()
+	authority, err := pki.LoadOrCreateAuthority(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"), 0)
+	require.NoError(t, err)
+	masterCert, err := authority.Issue("master-1", nil)
+	require.NoError(t, err)
+
+	var got *storage.APIKey
+	node := gin.New()
+	node.Use(routing.TrustMaster())
+	node.POST("/v1/completions", a.Require(ScopeInference), func(c *gin.Context) {
+		got, _ = FromContext(c)
+		c.Status(http.StatusOK)
+	})
+	routed := func(cert *x509.Certificate) int {
+		got = nil
+		req := httptest.NewRequest("POST", "/v1/completions", strings.NewReader(`{"model":"qwen"}`))
+		req.Header.Set(routing.RoutedHeader, "master-1")
+		req.Header.Set(routing.KeyHeader, forwarded)
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		w := httptest.NewRecorder()
+		node.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// 节点上 Master 转发的请求使用 Master 认证的密钥
+	require.Equal(t, http.StatusOK, routed(masterCert.Leaf))
+	require.NotNil(t, got)
+	assert.Equal(t, key.ID, got.ID)
+	assert.Equal(t, "team-a", got.Name)
+	assert.Equal(t, []string{"pii"}, got.Filters)
+
+	// 客户端自行附带的密钥不被信任
+	assert.Equal(t, http.StatusUnauthorized, routed(nil))
+	assert.Nil(t, got)
+}
@@ -0,0 +1,346 @@
+// Package capture records proxied chats into the conversation store, so the
+// server keeps a chat history without a separate logging proxy. Capture is
+// opt-in: per request with a conversation ID header, or for all chat
+// requests when enabled in the gateway settings.
+package capture
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
+)
+
+const (
+	// DefaultHeader is the conversation ID header used when none is configured
+	DefaultHeader = "X-Conversation-ID"
+
+	// saveTimeout 一轮对话写入存储的最长时间
+	saveTimeout = 5 * time.Second
+
+	// titleLength 新会话标题取首条用户消息的前若干字符
+	titleLength = 64
+)
+
+// Message is one request message in the handler-neutral form stored
+type Message struct {
+	Role    string
+	Content string
+	Name    string
+}
+
+// Recorder appends captured chats to the conversation store. A nil
+// *Recorder captures nothing, so handlers can call it unconditionally.
+type Recorder struct {
+	store     storage.Store
+	configMgr *config.Manager
+	modelMgr  *model.Manager
+	mu        sync.Mutex // 串行写入，避免同一会话并发创建
+}
+
+// NewRecorder creates a recorder writing to store. configMgr supplies the
+// capture settings and may be nil, in which case only requests with the
+// default header are captured. modelMgr resolves replica instance IDs to
+// their model and may be nil.
+func NewRecorder(store storage.Store, configMgr *config.Manager, modelMgr *model.Manager) *Recorder {
+	return &Recorder{store: store, configMgr: configMgr, modelMgr: modelMgr}
+}
+
+func (r *Recorder) settings() config.CaptureConfig {
+	if r.configMgr == nil {
+		return config.CaptureConfig{Header: DefaultHeader}
+	}
+	settings := r.configMgr.Get().Gateway.Capture
+	if settings.Header == "" {
+		settings.Header = DefaultHeader
+	}
+	return settings
+}
+
+// Begin starts capturing a chat request. It returns nil when the request is
+// not captured. When capture is on globally and the request names no
+// conversation, a new one is created and its ID is returned in the
+// conversation header so the client can continue it.
+func (r *Recorder) Begin(w http.ResponseWriter, req *http.Request, endpoint string, messages []Message) *Turn {
+	if r == nil {
+		return nil
+	}
+
+	settings := r.settings()
+	id := strings.TrimSpace(req.Header.Get(settings.Header))
+	if id == "" {
+		if !settings.Enabled {
+			return nil
+		}
+		id = newConversationID()
+	}
+	w.Header().Set(settings.Header, id)
+
+	return &Turn{
+		recorder:       r,
+		conversationID: id,
+		endpoint:       endpoint,
+		messages:       messages,
+	}
+}
+
+// Turn is one captured request and the assistant reply assembled from the
+// upstream OpenAI-format response. A nil *Turn ignores all calls.
+type Turn struct {
+	recorder       *Recorder
+	conversationID string
+	endpoint       string
+	messages       []Message
+
+	reply     strings.Builder
+	toolCalls []*toolCall
+	usage     usage.Usage
+}
+
+type toolCall struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// upstreamChoice is the part of an upstream choice used for the reply
+type upstreamChoice struct {
+	Text    string `json:"text"`
+	Message *struct {
+		Content   string         `json:"content"`
+		ToolCalls []upstreamCall `json:"tool_calls"`
+	} `json:"message"`
+	Delta *struct {
+		Content   string         `json:"content"`
+		ToolCalls []upstreamCall `json:"tool_calls"`
+	} `json:"delta"`
+}
+
+type upstreamCall struct {
+	Index    int `json:"index"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// ConversationID returns the conversation the turn is appended to
+func (t *Turn) ConversationID() string {
+	if t == nil {
+		return ""
+	}
+	return t.conversationID
+}
+
+// ParseResponse takes the reply and usage from a non-streaming upstream
+// chat completion response
+func (t *Turn) ParseResponse(body []byte) {
+	if t == nil {
+		return
+	}
+	var resp struct {
+		Choices []upstreamChoice `json:"choices"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || len(resp.Choices) == 0 {
+		return
+	}
+	// 多个候选回复时只记录第一个
+	choice := resp.Choices[0]
+	t.reply.WriteString(choice.Text)
+	if choice.Message != nil {
+		t.reply.WriteString(choice.Message.Content)
+		t.addToolCalls(choice.Message.ToolCalls, false)
+	}
+	if u, ok := usage.Parse(body); ok {
+		t.usage = u
+	}
+}
+
+// ParseStreamLine accumulates the reply and usage from one upstream SSE line
+func (t *Turn) ParseStreamLine(line string) {
+	if t == nil {
+		return
+	}
+	if u, ok := usage.ParseStreamLine(line); ok {
+		t.usage = u
+	}
+
+	data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+	if !ok {
+		return
+	}
+	data = strings.TrimSpace(data)
+	if data == "" || data == "[DONE]" {
+		return
+	}
+	var chunk struct {
+		Choices []struct {
+			Index int `json:"index"`
+			upstreamChoice
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		return
+	}
+	for _, choice := range chunk.Choices {
+		if choice.Index != 0 {
+			continue
+		}
+		t.reply.WriteString(choice.Text)
+		if choice.Delta != nil {
+			t.reply.WriteString(choice.Delta.Content)
+			t.addToolCalls(choice.Delta.ToolCalls, true)
+		}
+	}
+}
+
+// addToolCalls records tool calls; streamed calls arrive in pieces that are
+// joined by index
+func (t *Turn) addToolCalls(calls []upstreamCall, streamed bool) {
+	for i, call := range calls {
+		index := i
+		if streamed {
+			index = call.Index
+		}
+		if index < 0 {
+			continue
+		}
+		for len(t.toolCalls) <= index {
+			t.toolCalls = append(t.toolCalls, &toolCall{})
+		}
+		pending := t.toolCalls[index]
+		if call.Function.Name != "" {
+			pending.Name = call.Function.Name
+		}
+		pending.Arguments += call.Function.Arguments
+	}
+}
+
+// Finish stores the turn once the reply is complete. Nothing is stored when
+// upstream produced no reply, e.g. because the request failed.
+func (t *Turn) Finish(instanceID string) {
+	if t == nil || (t.reply.Len() == 0 && len(t.toolCalls) == 0) {
+		return
+	}
+	if err := t.recorder.save(t, instanceID); err != nil {
+		logger.Warn("记录会话失败", "conversationId", t.conversationID, "error", err)
+	}
+}
+
+// save appends the new request messages and the reply to the conversation,
+// creating it first if needed
+func (r *Recorder) save(t *Turn, instanceID string) error {
+	modelID := instanceID
+	if r.modelMgr != nil {
+		if status, exists := r.modelMgr.GetStatus(instanceID); exists && status.ModelID != "" {
+			modelID = status.ModelID
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// 请求上下文可能已随客户端断开而取消，使用独立的超时上下文
+	ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+	defer cancel()
+
+	var system []string
+	var messages []Message
+	for _, msg := range t.messages {
+		if msg.Role == "system" {
+			system = append(system, msg.Content)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+
+	conv, err := r.store.GetConversation(ctx, t.conversationID)
+	switch {
+	case errors.Is(err, storage.ErrConversationNotFound):
+		conv = &storage.Conversation{
+			ID:           t.conversationID,
+			Model:        modelID,
+			Title:        title(messages),
+			SystemPrompt: strings.Join(system, "\n"),
+		}
+		if err := r.store.CreateConversation(ctx, conv); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	case conv.Model != modelID:
+		conv.Model = modelID
+		if err := r.store.UpdateConversation(ctx, conv); err != nil {
+			return err
+		}
+	}
+
+	// 客户端通常每轮发送完整历史，已存储的部分不再重复追加；
+	// 只发送新消息的客户端则全部追加
+	if len(messages) > conv.MessageCount {
+		messages = messages[conv.MessageCount:]
+	}
+	for _, msg := range messages {
+		if err := r.store.CreateMessage(ctx, &storage.Message{
+			ConversationID: conv.ID,
+			Role:           msg.Role,
+			Content:        msg.Content,
+			Name:           msg.Name,
+		}); err != nil {
+			return err
+		}
+	}
+
+	metadata := map[string]interface{}{
+		"model":        modelID,
+		"endpoint":     t.endpoint,
+		"promptTokens": t.usage.PromptTokens,
+	}
+	var calls []toolCall
+	for _, call := range t.toolCalls {
+		if call.Name != "" {
+			calls = append(calls, *call)
+		}
+	}
+	if len(calls) > 0 {
+		metadata["toolCalls"] = calls
+	}
+	return r.store.CreateMessage(ctx, &storage.Message{
+		ConversationID: conv.ID,
+		Role:           "assistant",
+		Content:        t.reply.String(),
+		TokenCount:     t.usage.CompletionTokens,
+		Metadata:       metadata,
+	})
+}
+
+// title returns the start of the first user message
+func title(messages []Message) string {
+	for _, msg := range messages {
+		if msg.Role != "user" {
+			continue
+		}
+		text := strings.Join(strings.Fields(msg.Content), " ")
+		if runes := []rune(text); len(runes) > titleLength {
+			text = string(runes[:titleLength]) + "…"
+		}
+		return text
+	}
+	return ""
+}
+
+func newConversationID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "conv-" + hex.EncodeToString(b)
+}
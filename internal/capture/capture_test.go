@@ -0,0 +1,151 @@
+package capture
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRecorder(t *testing.T) (*Recorder, storage.Store) {
+	t.Helper()
+	store, err := storage.NewMemoryStore()
+	require.NoError(t, err)
+	return NewRecorder(store, nil, nil), store
+}
+
+func TestBegin(t *testing.T) {
+	recorder, _ := newTestRecorder(t)
+
+	t.Run("Without header", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		w := httptest.NewRecorder()
+		assert.Nil(t, recorder.Begin(w, req, "/v1/chat/completions", nil))
+		assert.Empty(t, w.Header().Get(DefaultHeader))
+	})
+
+	t.Run("With header", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		req.Header.Set(DefaultHeader, "conv-1")
+		w := httptest.NewRecorder()
+		turn := recorder.Begin(w, req, "/v1/chat/completions", nil)
+		require.NotNil(t, turn)
+		assert.Equal(t, "conv-1", turn.ConversationID())
+		assert.Equal(t, "conv-1", w.Header().Get(DefaultHeader))
+	})
+
+	t.Run("Nil recorder", func(t *testing.T) {
+		var nilRecorder *Recorder
+		req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		req.Header.Set(DefaultHeader, "conv-1")
+		turn := nilRecorder.Begin(httptest.NewRecorder(), req, "/v1/chat/completions", nil)
+		assert.Nil(t, turn)
+		// nil turn 的方法调用不做任何事
+		turn.ParseStreamLine(`data: {"choices":[{"delta":{"content":"x"}}]}`)
+		turn.Finish("model")
+	})
+}
+
+func TestTurn(t *testing.T) {
+	begin := func(recorder *Recorder, messages ...Message) *Turn {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		req.Header.Set(DefaultHeader, "conv-1")
+		return recorder.Begin(httptest.NewRecorder(), req, "/v1/chat/completions", messages)
+	}
+
+	t.Run("Streamed reply", func(t *testing.T) {
+		recorder, store := newTestRecorder(t)
+		turn := begin(recorder,
+			Message{Role: "system", Content: "Be brief."},
+			Message{Role: "user", Content: "Hello there"},
+		)
+		for _, line := range []string{
+			`data: {"choices":[{"index":0,"delta":{"role":"assistant"}}]}`,
+			`data: {"choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+			`data: {"choices":[{"index":0,"delta":{"content":"!"}}]}`,
+			`data: {"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":2,"total_tokens":14}}`,
+			`data: [DONE]`,
+		} {
+			turn.ParseStreamLine(line)
+		}
+		turn.Finish("qwen")
+
+		conv, err := store.GetConversation(context.Background(), "conv-1")
+		require.NoError(t, err)
+		assert.Equal(t, "qwen", conv.Model)
+		assert.Equal(t, "Hello there", conv.Title)
+		assert.Equal(t, "Be brief.", conv.SystemPrompt)
+
+		messages, err := store.GetMessages(context.Background(), "conv-1", 10, 0)
+		require.NoError(t, err)
+		require.Len(t, messages, 2)
+		assert.Equal(t, "user", messages[0].Role)
+		assert.Equal(t, "assistant", messages[1].Role)
+		assert.Equal(t, "Hi!", messages[1].Content)
+		assert.Equal(t, 2, messages[1].TokenCount)
+		assert.Equal(t, "qwen", messages[1].Metadata["model"])
+		assert.Equal(t, 12, messages[1].Metadata["promptTokens"])
+	})
+
+	t.Run("History is not duplicated", func(t *testing.T) {
+		recorder, store := newTestRecorder(t)
+
+		turn := begin(recorder, Message{Role: "user", Content: "One"})
+		turn.ParseResponse([]byte(`{"choices":[{"message":{"role":"assistant","content":"First"}}]}`))
+		turn.Finish("qwen")
+
+		// 第二轮带完整历史
+		turn = begin(recorder,
+			Message{Role: "user", Content: "One"},
+			Message{Role: "assistant", Content: "First"},
+			Message{Role: "user", Content: "Two"},
+		)
+		turn.ParseResponse([]byte(`{"choices":[{"message":{"role":"assistant","content":"Second"}}]}`))
+		turn.Finish("qwen")
+
+		// 第三轮只发送新消息
+		turn = begin(recorder, Message{Role: "user", Content: "Three"})
+		turn.ParseResponse([]byte(`{"choices":[{"message":{"role":"assistant","content":"Third"}}]}`))
+		turn.Finish("qwen")
+
+		messages, err := store.GetMessages(context.Background(), "conv-1", 10, 0)
+		require.NoError(t, err)
+		var contents []string
+		for _, msg := range messages {
+			contents = append(contents, msg.Content)
+		}
+		assert.Equal(t, []string{"One", "First", "Two", "Second", "Three", "Third"}, contents)
+	})
+
+	t.Run("Tool calls", func(t *testing.T) {
+		recorder, store := newTestRecorder(t)
+		turn := begin(recorder, Message{Role: "user", Content: "Weather?"})
+		turn.ParseStreamLine(`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"name":"get_weather","arguments":"{\"city\":"}}]}}]}`)
+		turn.ParseStreamLine(`data: {"choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"Paris\"}"}}]}}]}`)
+		turn.Finish("qwen")
+
+		messages, err := store.GetMessages(context.Background(), "conv-1", 10, 0)
+		require.NoError(t, err)
+		require.Len(t, messages, 2)
+		assert.Equal(t, []toolCall{{Name: "get_weather", Arguments: `{"city":"Paris"}`}}, messages[1].Metadata["toolCalls"])
+	})
+
+	t.Run("No reply is not stored", func(t *testing.T) {
+		recorder, store := newTestRecorder(t)
+		turn := begin(recorder, Message{Role: "user", Content: "Hello"})
+		turn.Finish("qwen")
+
+		_, err := store.GetConversation(context.Background(), "conv-1")
+		assert.ErrorIs(t, err, storage.ErrConversationNotFound)
+	})
+}
+
+func TestTitle(t *testing.T) {
+	assert.Equal(t, "Hello world", title([]Message{{Role: "assistant", Content: "x"}, {Role: "user", Content: " Hello\n world "}}))
+	assert.Equal(t, strings.Repeat("a", titleLength)+"…", title([]Message{{Role: "user", Content: strings.Repeat("a", 100)}}))
+	assert.Equal(t, "", title(nil))
+}
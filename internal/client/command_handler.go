@@ -13,6 +13,7 @@ import (
 	"github.com/shepherd-project/shepherd/Shepherd/internal/node"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/client/tester"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/types"
 )
 
@@ -72,6 +73,15 @@ func (ch *CommandHandler) Handle(command *node.Command) (*node.CommandResult, er
 
 	startTime := time.Now()
 
+	// 延续 Master 下发命令时写入负载的 trace
+	ctx := tracing.ContextWithTraceParent(context.Background(), command.TraceParent())
+	ctx, span := tracing.StartWithKind(ctx, tracing.KindConsumer, "cluster.command "+string(command.Type),
+		tracing.String("shepherd.command.id", command.ID),
+		tracing.String("shepherd.command.type", string(command.Type)),
+		tracing.String("shepherd.node.id", ch.nodeID),
+	)
+	defer span.End()
+
 	// 创建结果对象
 	result := &node.CommandResult{
 		CommandID:   command.ID,
@@ -84,7 +94,7 @@ func (ch *CommandHandler) Handle(command *node.Command) (*node.CommandResult, er
 	var err error
 	switch command.Type {
 	case node.CommandTypeLoadModel:
-		err = ch.handleLoadModel(command, result)
+		err = ch.handleLoadModel(ctx, command, result)
 	case node.CommandTypeUnloadModel:
 		err = ch.handleUnloadModel(command, result)
 	case node.CommandTypeRunLlamacpp:
@@ -110,6 +120,9 @@ func (ch *CommandHandler) Handle(command *node.Command) (*node.CommandResult, er
 	if err != nil && result.Error == "" {
 		result.Error = err.Error()
 	}
+	if !result.Success {
+		span.SetError(result.Error)
+	}
 
 	if ch.logger != nil {
 		if result.Success {
@@ -132,7 +145,7 @@ func (ch *CommandHandler) Handle(command *node.Command) (*node.CommandResult, er
 //   - temperature: 温度参数 (可选)
 //   - top_p: top_p 参数 (可选)
 //   - top_k: top_k 参数 (可选)
-func (ch *CommandHandler) handleLoadModel(command *node.Command, result *node.CommandResult) error {
+func (ch *CommandHandler) handleLoadModel(ctx context.Context, command *node.Command, result *node.CommandResult) error {
 	modelID, ok := command.Payload["model_id"].(string)
 	if !ok || modelID == "" {
 		result.Success = false
@@ -153,9 +166,10 @@ func (ch *CommandHandler) handleLoadModel(command *node.Command, result *node.Co
 		return fmt.Errorf("模型管理器未初始化")
 	}
 
-	// 构建加载请求
+	// 构建加载请求，加载 span 归入命令所在的 trace
 	req := &model.LoadRequest{
-		ModelID: modelID,
+		ModelID:     modelID,
+		TraceParent: tracing.TraceParent(ctx),
 	}
 
 	// 解析可选参数并记录
@@ -0,0 +1,221 @@
+package routing
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/pki"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
+)
+
+const (
+	// RoutedHeader marks a request already forwarded by a master, so the
+	// receiving node serves it locally instead of routing it again. It is only
+	// honoured on requests authenticated as the master's, see TrustMaster.
+	RoutedHeader = "X-Shepherd-Routed-By"
+	// KeyHeader carries the API key a routed request was authenticated with
+	// on the master, without its secret, so the node applies the key's
+	// filters and ownership. Like RoutedHeader it is only honoured on
+	// requests from the master.
+	KeyHeader = "X-Shepherd-Key"
+	// NodeHeader tells the caller which node served a forwarded request
+	NodeHeader = "X-Shepherd-Node"
+	// defaultSessionHeader 未配置会话请求头时使用的默认值
+	defaultSessionHeader = "X-Session-ID"
+	// peerService 转发请求的 client span 中的对端服务名
+	peerService = "shepherd-node"
+	// routedKey 在 gin.Context 中标记由 Master 转发的请求
+	routedKey = "clusterRouted"
+)
+
+// credentialHeaders 客户端的密钥只在 Master 上校验，不转发给节点
+var credentialHeaders = []string{"Authorization", "X-Api-Key", "Api-Key"}
+
+// TrustMaster marks requests forwarded by the cluster master: those carrying
+// RoutedHeader over a connection authenticated with the master's client
+// certificate. The master already authenticated, limited and audited them.
+// RoutedHeader and KeyHeader are removed from every other request, so
+// clients cannot claim to have been routed. It must run before authentication.
+func TrustMaster() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader(RoutedHeader) != "" && pki.PeerIsMaster(c.Request) {
+			c.Set(routedKey, true)
+		} else {
+			c.Request.Header.Del(RoutedHeader)
+			c.Request.Header.Del(KeyHeader)
+		}
+		c.Next()
+	}
+}
+
+// Routed reports whether TrustMaster marked the request as forwarded by the
+// cluster master
+func Routed(c *gin.Context) bool {
+	return c.GetBool(routedKey)
+}
+
+// Proxy forwards inference requests for models that are not loaded locally
+// to the cluster node serving them
+type Proxy struct {
+	table     *Table
+	nodeID    string
+	isLocal   func(model string) bool
+	transport http.RoundTripper
+	scheme    string // 节点开启集群 mTLS 时为 https
+
+	strategy      string // 多个节点提供同一模型时的负载均衡策略
+	sessionHeader string // 会话粘滞请求头
+}
+
+// NewProxy creates a proxy that routes by table. isLocal reports whether a
+// model is already loaded on this node, in which case it is served locally.
+func NewProxy(table *Table, nodeID string, isLocal func(model string) bool) *Proxy {
+	return &Proxy{
+		table:     table,
+		nodeID:    nodeID,
+		isLocal:   isLocal,
+		transport: tracing.NewTransport(http.DefaultTransport, peerService),
+		scheme:    "http",
+
+		strategy:      config.BalanceLeastRequests,
+		sessionHeader: defaultSessionHeader,
+	}
+}
+
+// SetBalancing sets how requests are spread across nodes serving the same
+// model. Must be called before the proxy handles requests.
+func (p *Proxy) SetBalancing(cfg config.BalancingConfig) {
+	if cfg.Strategy != "" {
+		p.strategy = cfg.Strategy
+	}
+	if cfg.SessionHeader != "" {
+		p.sessionHeader = cfg.SessionHeader
+	}
+}
+
+// SetTLS makes the proxy reach nodes over HTTPS with cfg, which carries the
+// master's client certificate. Must be called before the proxy handles requests.
+func (p *Proxy) SetTLS(cfg *tls.Config) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	p.transport = tracing.NewTransport(transport, peerService)
+	p.scheme = "https"
+}
+
+// Handle forwards the request to the node serving the requested model, or
+// passes it on to the local handler when the model is local or unknown
+func (p *Proxy) Handle(c *gin.Context) {
+	if c.Request.Body == nil || Routed(c) {
+		c.Next()
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body.Close()
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		c.Next()
+		return
+	}
+
+	name := requestModel(body)
+	if name == "" || (p.isLocal != nil && p.isLocal(name)) {
+		c.Next()
+		return
+	}
+
+	route, ok := p.table.Pick(name, c.GetHeader(p.sessionHeader), p.strategy)
+	if !ok {
+		c.Next()
+		return
+	}
+
+	logger.Debugf("请求路由到集群节点: model=%s, node=%s, path=%s", name, route.NodeID, c.Request.URL.Path)
+	ctx, span := tracing.Start(c.Request.Context(), "cluster.route",
+		tracing.String("shepherd.model.name", name),
+		tracing.String("shepherd.model.id", route.ModelID),
+		tracing.String("shepherd.node.id", route.NodeID),
+		tracing.String("shepherd.balancing.strategy", p.strategy),
+	)
+	c.Request = c.Request.WithContext(ctx)
+	done := p.table.Begin(route)
+	p.forward(c, route, body)
+	done()
+	if c.Writer.Status() >= http.StatusInternalServerError {
+		span.SetError(http.StatusText(c.Writer.Status()))
+	}
+	span.End()
+	c.Abort()
+}
+
+// forward 将请求转发到节点的 Shepherd API，流式响应逐块刷新。
+// 节点凭 Master 的客户端证书信任转发的请求，客户端的密钥不随请求转发
+func (p *Proxy) forward(c *gin.Context, route Route, body []byte) {
+	host := net.JoinHostPort(route.Address, strconv.Itoa(route.NodePort))
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = p.scheme
+			req.URL.Host = host
+			req.Host = host
+			for _, header := range credentialHeaders {
+				req.Header.Del(header)
+			}
+			req.Header.Set(RoutedHeader, p.nodeID)
+		},
+		Transport:     p.transport,
+		FlushInterval: -1,
+		ModifyResponse: func(resp *http.Response) error {
+			resp.Header.Set(NodeHeader, route.NodeID)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			logger.Errorf("转发请求到节点 %s 失败: %v", route.NodeID, err)
+			if !errors.Is(err, context.Canceled) {
+				p.table.MarkFailed(route.NodeID)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]string{
+					"message": "failed to reach node " + route.NodeID + ": " + err.Error(),
+					"type":    "server_error",
+				},
+			})
+		},
+	}
+
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	c.Request.ContentLength = int64(len(body))
+	proxy.ServeHTTP(streamWriter{ResponseWriter: c.Writer, flusher: c.Writer}, c.Request)
+}
+
+// streamWriter 只暴露写入与 Flush，避免 ReverseProxy 调用底层 writer 未必支持的 CloseNotify
+type streamWriter struct {
+	http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (w streamWriter) Flush() { w.flusher.Flush() }
+
+// requestModel 从 OpenAI/Anthropic/Ollama 请求体中读取 model 字段
+func requestModel(body []byte) string {
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		return ""
+	}
+	return req.Model
+}
@@ -0,0 +1,201 @@
+package routing
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/pki"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRouter 创建挂载了 Proxy 的路由，本地处理器返回 "local"
+func newTestRouter(proxy *Proxy) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	v1 := router.Group("/v1", TrustMaster(), proxy.Handle)
+	v1.POST("/chat/completions", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, "local:"+string(body))
+	})
+	return router
+}
+
+// addRouteTo 添加一条指向测试服务器的路由
+func addRouteTo(t *testing.T, table *Table, server *httptest.Server, modelID string) {
+	t.Helper()
+	host, portStr, err := net.SplitHostPort(strings.TrimPrefix(strings.TrimPrefix(server.URL, "http://"), "https://"))
+	require.NoError(t, err)
+	port, _ := strconv.Atoi(portStr)
+	table.Add(Route{ModelID: modelID, NodeID: "node-a", Address: host, NodePort: port, ModelPort: 8081})
+}
+
+func TestProxyForwardsRemoteModels(t *testing.T) {
+	var gotRoutedBy, gotBody, gotKey string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRoutedBy = r.Header.Get(RoutedHeader)
+		gotKey = r.Header.Get("Authorization") + r.Header.Get("x-api-key")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"remote"}`)
+	}))
+	defer upstream.Close()
+
+	table := NewTable(0)
+	addRouteTo(t, table, upstream, "remote-model")
+	proxy := NewProxy(table, "master-1", func(model string) bool { return model == "local-model" })
+	router := newTestRouter(proxy)
+
+	t.Run("Remote model", func(t *testing.T) {
+		reqBody := `{"model":"remote-model","messages":[]}`
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(reqBody))
+		req.Header.Set("Authorization", "Bearer sk-client")
+		req.Header.Set("x-api-key", "sk-client")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `{"id":"remote"}`, w.Body.String())
+		assert.Equal(t, "node-a", w.Header().Get(NodeHeader))
+		assert.Equal(t, "master-1", gotRoutedBy)
+		assert.Equal(t, reqBody, gotBody)
+		// 客户端的密钥不转发给节点
+		assert.Empty(t, gotKey)
+	})
+
+	t.Run("Local model", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"local-model"}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, `local:{"model":"local-model"}`, w.Body.String())
+	})
+
+	t.Run("Unknown model", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"other"}`))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, `local:{"model":"other"}`, w.Body.String())
+	})
+
+	t.Run("Already routed", func(t *testing.T) {
+		dir := t.TempDir()
+		authority, err := pki.LoadOrCreateAuthority(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"), 0)
+		require.NoError(t, err)
+		master, err := authority.Issue("another-master", nil)
+		require.NoError(t, err)
+
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"remote-model"}`))
+		req.Header.Set(RoutedHeader, "another-master")
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{master.Leaf}}}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, `local:{"model":"remote-model"}`, w.Body.String())
+	})
+
+	t.Run("Spoofed routed header", func(t *testing.T) {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"remote-model"}`))
+		req.Header.Set(RoutedHeader, "another-master")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, `{"id":"remote"}`, w.Body.String())
+	})
+}
+
+func TestProxyMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	authority, err := pki.LoadOrCreateAuthority(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"), 0)
+	require.NoError(t, err)
+	nodeCert, err := authority.Issue("node-a", []string{"127.0.0.1"})
+	require.NoError(t, err)
+
+	var gotPeer string
+	var gotMaster bool
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPeer, _ = pki.PeerNodeID(r)
+		gotMaster = pki.PeerIsMaster(r)
+		fmt.Fprint(w, `{"id":"remote"}`)
+	}))
+	upstream.TLS = &tls.Config{
+		Certificates: []tls.Certificate{nodeCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    authority.Pool(),
+	}
+	upstream.StartTLS()
+	defer upstream.Close()
+
+	table := NewTable(0)
+	addRouteTo(t, table, upstream, "remote-model")
+	proxy := NewProxy(table, "master-1", nil)
+	proxy.SetTLS(authority.ClientTLSConfig("master-1"))
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"remote-model"}`))
+	w := httptest.NewRecorder()
+	newTestRouter(proxy).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `{"id":"remote"}`, w.Body.String())
+	assert.Equal(t, "master-1", gotPeer)
+	assert.True(t, gotMaster)
+}
+
+func TestProxyStreamsSSE(t *testing.T) {
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer upstream.Close()
+
+	table := NewTable(0)
+	addRouteTo(t, table, upstream, "remote-model")
+	server := httptest.NewServer(newTestRouter(NewProxy(table, "master-1", nil)))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/v1/chat/completions", "application/json",
+		strings.NewReader(`{"model":"remote-model","stream":true}`))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	// 第一块数据应在上游结束前到达客户端
+	reader := bufio.NewReader(resp.Body)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "data: first\n", line)
+
+	close(release)
+	rest, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Contains(t, string(rest), "data: [DONE]")
+}
+
+func TestProxyUnreachableNode(t *testing.T) {
+	table := NewTable(0)
+	table.Add(Route{ModelID: "remote-model", NodeID: "node-a", Address: "127.0.0.1", NodePort: 1})
+	router := newTestRouter(NewProxy(table, "master-1", nil))
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"remote-model"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "node-a")
+}
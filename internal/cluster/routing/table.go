@@ -0,0 +1,311 @@
+// Package routing keeps track of which cluster node serves which model and
+// forwards inference requests for remote models to the owning node.
+package routing
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/node"
+)
+
+// DefaultRouteTTL 路由未被心跳或命令结果刷新的最长时间，超过后不再使用
+// （客户端心跳间隔为 30 秒，允许丢失两次心跳）
+const DefaultRouteTTL = 90 * time.Second
+
+// nodeFailureCooldown 转发失败后节点被跳过的时间
+const nodeFailureCooldown = 30 * time.Second
+
+// Route source values
+const (
+	SourceHeartbeat = "heartbeat"
+	SourceCommand   = "command"
+)
+
+// Route describes a model served by a cluster node
+type Route struct {
+	ModelID   string    `json:"modelId"`
+	Name      string    `json:"name,omitempty"`
+	Alias     string    `json:"alias,omitempty"`
+	NodeID    string    `json:"nodeId"`
+	Address   string    `json:"address"`   // 节点地址
+	NodePort  int       `json:"nodePort"`  // 节点 Shepherd API 端口，请求转发目标
+	ModelPort int       `json:"modelPort"` // 节点上 llama-server 端口
+	Source    string    `json:"source"`    // heartbeat 或 command
+	UpdatedAt time.Time `json:"updatedAt"`
+	Inflight  int       `json:"inflight"` // 经本节点转发、尚未完成的请求数
+	Healthy   bool      `json:"healthy"`  // 近期转发未失败
+}
+
+// Table is a concurrency-safe model routing table
+type Table struct {
+	routes   map[string]map[string]*Route // nodeID -> modelID -> route
+	ttl      time.Duration
+	inflight map[string]int       // nodeID/modelID -> 转发中的请求数
+	failures map[string]time.Time // nodeID -> 最近一次转发失败时间
+	next     map[string]uint64    // 请求的模型名 -> 轮询计数
+	mu       sync.RWMutex
+}
+
+// NewTable creates an empty routing table. A ttl of 0 uses DefaultRouteTTL.
+func NewTable(ttl time.Duration) *Table {
+	if ttl <= 0 {
+		ttl = DefaultRouteTTL
+	}
+	return &Table{
+		routes:   make(map[string]map[string]*Route),
+		ttl:      ttl,
+		inflight: make(map[string]int),
+		failures: make(map[string]time.Time),
+		next:     make(map[string]uint64),
+	}
+}
+
+// UpdateNode replaces all routes of a node with the models it reported
+func (t *Table) UpdateNode(info *node.NodeInfo, models []node.LoadedModel) {
+	now := time.Now()
+	routes := make(map[string]*Route, len(models))
+	for _, m := range models {
+		if m.ID == "" || m.Port == 0 {
+			continue
+		}
+		routes[m.ID] = &Route{
+			ModelID:   m.ID,
+			Name:      m.Name,
+			Alias:     m.Alias,
+			NodeID:    info.ID,
+			Address:   info.Address,
+			NodePort:  info.Port,
+			ModelPort: m.Port,
+			Source:    SourceHeartbeat,
+			UpdatedAt: now,
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(routes) == 0 {
+		delete(t.routes, info.ID)
+		return
+	}
+	t.routes[info.ID] = routes
+}
+
+// Add adds or refreshes a single route
+func (t *Table) Add(route Route) {
+	if route.UpdatedAt.IsZero() {
+		route.UpdatedAt = time.Now()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.routes[route.NodeID] == nil {
+		t.routes[route.NodeID] = make(map[string]*Route)
+	}
+	t.routes[route.NodeID][route.ModelID] = &route
+}
+
+// Remove removes the route of a model on a node
+func (t *Table) Remove(nodeID, modelID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.routes[nodeID], modelID)
+	if len(t.routes[nodeID]) == 0 {
+		delete(t.routes, nodeID)
+	}
+}
+
+// RemoveNode removes all routes of a node
+func (t *Table) RemoveNode(nodeID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.routes, nodeID)
+}
+
+// Lookup finds a live route for a model by ID, alias or name. When several
+// nodes serve the model the most recently refreshed route wins.
+func (t *Table) Lookup(name string) (Route, bool) {
+	if name == "" {
+		return Route{}, false
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	cutoff := time.Now().Add(-t.ttl)
+	var best *Route
+	for _, routes := range t.routes {
+		for _, route := range routes {
+			if route.UpdatedAt.Before(cutoff) || !route.matches(name) {
+				continue
+			}
+			if best == nil || route.UpdatedAt.After(best.UpdatedAt) {
+				best = route
+			}
+		}
+	}
+	if best == nil {
+		return Route{}, false
+	}
+	return *best, true
+}
+
+// Pick chooses the node that should serve a request when several nodes
+// serve the model. Requests with a session key stick to one node, the rest
+// are spread by strategy. Nodes that recently failed a forwarded request are
+// skipped unless no other node is available.
+func (t *Table) Pick(name, sessionKey, strategy string) (Route, bool) {
+	if name == "" {
+		return Route{}, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-t.ttl)
+	var live, healthy []*Route
+	for _, routes := range t.routes {
+		for _, route := range routes {
+			if route.UpdatedAt.Before(cutoff) || !route.matches(name) {
+				continue
+			}
+			live = append(live, route)
+			if t.healthyLocked(route.NodeID, now) {
+				healthy = append(healthy, route)
+			}
+		}
+	}
+	if len(live) == 0 {
+		return Route{}, false
+	}
+
+	candidates := healthy
+	if len(candidates) == 0 {
+		candidates = live
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].NodeID < candidates[j].NodeID })
+
+	if sessionKey != "" {
+		return *stickyRoute(candidates, sessionKey), true
+	}
+
+	next := t.next[name]
+	t.next[name] = next + 1
+	start := int(next % uint64(len(candidates)))
+	if strategy == config.BalanceRoundRobin {
+		return *candidates[start], true
+	}
+
+	// 最少未完成请求，数量相同时从轮询位置开始依次选择
+	best := candidates[start]
+	for i := 1; i < len(candidates); i++ {
+		route := candidates[(start+i)%len(candidates)]
+		if t.inflight[routeKey(route)] < t.inflight[routeKey(best)] {
+			best = route
+		}
+	}
+	return *best, true
+}
+
+// Begin records a request forwarded along a route and returns a function
+// that must be called when it finishes
+func (t *Table) Begin(route Route) func() {
+	key := routeKey(&route)
+
+	t.mu.Lock()
+	t.inflight[key]++
+	t.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if t.inflight[key] <= 1 {
+				delete(t.inflight, key)
+			} else {
+				t.inflight[key]--
+			}
+		})
+	}
+}
+
+// MarkFailed stops routing to a node for a short time after a forwarded
+// request could not reach it
+func (t *Table) MarkFailed(nodeID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.failures[nodeID] = time.Now()
+}
+
+// List returns all live routes ordered by model and node
+func (t *Table) List() []Route {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	now := time.Now()
+	cutoff := now.Add(-t.ttl)
+	list := make([]Route, 0)
+	for _, routes := range t.routes {
+		for _, route := range routes {
+			if !route.UpdatedAt.Before(cutoff) {
+				r := *route
+				r.Inflight = t.inflight[routeKey(route)]
+				r.Healthy = t.healthyLocked(route.NodeID, now)
+				list = append(list, r)
+			}
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].ModelID != list[j].ModelID {
+			return list[i].ModelID < list[j].ModelID
+		}
+		return list[i].NodeID < list[j].NodeID
+	})
+	return list
+}
+
+// healthyLocked 检查节点是否处于转发失败冷却期，调用方需持有 t.mu
+func (t *Table) healthyLocked(nodeID string, now time.Time) bool {
+	failedAt, failed := t.failures[nodeID]
+	return !failed || now.Sub(failedAt) >= nodeFailureCooldown
+}
+
+// routeKey 返回路由的转发计数键
+func routeKey(route *Route) string {
+	return route.NodeID + "/" + route.ModelID
+}
+
+// stickyRoute 按会话键做最高随机权重哈希，节点增减时只有少量会话迁移
+func stickyRoute(candidates []*Route, sessionKey string) *Route {
+	var best *Route
+	var bestScore uint64
+	for _, route := range candidates {
+		h := fnv.New64a()
+		h.Write([]byte(sessionKey))
+		h.Write([]byte{0})
+		h.Write([]byte(route.NodeID))
+		if score := h.Sum64(); best == nil || score > bestScore {
+			best, bestScore = route, score
+		}
+	}
+	return best
+}
+
+// matches 按 ID、别名或名称匹配模型，与本地模型解析规则一致；
+// 与 Ollama 接口一样忽略 Ollama 客户端附带的 :latest 标签
+func (r *Route) matches(name string) bool {
+	name = strings.TrimSuffix(name, ":latest")
+	if r.ModelID == name {
+		return true
+	}
+	if r.Alias != "" && strings.EqualFold(r.Alias, name) {
+		return true
+	}
+	return r.Name != "" && strings.EqualFold(r.Name, name)
+}
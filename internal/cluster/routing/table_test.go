@@ -0,0 +1,144 @@
+package routing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testNode(id string) *node.NodeInfo {
+	return &node.NodeInfo{ID: id, Address: "10.0.0.1", Port: 9190}
+}
+
+func TestTableUpdateNode(t *testing.T) {
+	table := NewTable(0)
+
+	table.UpdateNode(testNode("node-a"), []node.LoadedModel{
+		{ID: "qwen-7b", Name: "Qwen2.5-7B-Instruct", Alias: "qwen", Port: 8081},
+		{ID: "no-port"},
+	})
+
+	routes := table.List()
+	require.Len(t, routes, 1)
+	assert.Equal(t, "qwen-7b", routes[0].ModelID)
+	assert.Equal(t, SourceHeartbeat, routes[0].Source)
+
+	// Ollama 客户端的模型名带 :latest 标签
+	for _, name := range []string{"qwen-7b", "QWEN", "qwen2.5-7b-instruct", "qwen:latest"} {
+		route, ok := table.Lookup(name)
+		require.True(t, ok, name)
+		assert.Equal(t, "node-a", route.NodeID)
+		assert.Equal(t, 8081, route.ModelPort)
+	}
+
+	_, ok := table.Lookup("qwen-7")
+	assert.False(t, ok)
+
+	// 心跳上报空列表时清除该节点的路由
+	table.UpdateNode(testNode("node-a"), []node.LoadedModel{})
+	assert.Empty(t, table.List())
+}
+
+func TestTableAddRemove(t *testing.T) {
+	table := NewTable(0)
+
+	table.Add(Route{ModelID: "m1", NodeID: "node-a", NodePort: 9190, ModelPort: 8081})
+	table.Add(Route{ModelID: "m2", NodeID: "node-a", NodePort: 9190, ModelPort: 8082})
+	table.Add(Route{ModelID: "m1", NodeID: "node-b", NodePort: 9190, ModelPort: 8081})
+	assert.Len(t, table.List(), 3)
+
+	table.Remove("node-a", "m1")
+	route, ok := table.Lookup("m1")
+	require.True(t, ok)
+	assert.Equal(t, "node-b", route.NodeID)
+
+	table.RemoveNode("node-a")
+	_, ok = table.Lookup("m2")
+	assert.False(t, ok)
+}
+
+func TestTableLookupPrefersFreshRoutes(t *testing.T) {
+	table := NewTable(time.Minute)
+
+	table.Add(Route{ModelID: "m1", NodeID: "old", UpdatedAt: time.Now().Add(-30 * time.Second)})
+	table.Add(Route{ModelID: "m1", NodeID: "new", UpdatedAt: time.Now()})
+	table.Add(Route{ModelID: "m2", NodeID: "stale", UpdatedAt: time.Now().Add(-2 * time.Minute)})
+
+	route, ok := table.Lookup("m1")
+	require.True(t, ok)
+	assert.Equal(t, "new", route.NodeID)
+
+	_, ok = table.Lookup("m2")
+	assert.False(t, ok)
+	assert.Len(t, table.List(), 2)
+}
+
+func TestTablePick(t *testing.T) {
+	newTable := func() *Table {
+		table := NewTable(0)
+		table.Add(Route{ModelID: "m1", NodeID: "node-a"})
+		table.Add(Route{ModelID: "m1", NodeID: "node-b"})
+		return table
+	}
+
+	t.Run("Round robin", func(t *testing.T) {
+		table := newTable()
+		picked := make(map[string]int)
+		for i := 0; i < 4; i++ {
+			route, ok := table.Pick("m1", "", config.BalanceRoundRobin)
+			require.True(t, ok)
+			picked[route.NodeID]++
+		}
+		assert.Equal(t, map[string]int{"node-a": 2, "node-b": 2}, picked)
+	})
+
+	t.Run("Least outstanding requests", func(t *testing.T) {
+		table := newTable()
+		route, _ := table.Pick("m1", "", config.BalanceLeastRequests)
+		done := table.Begin(route)
+
+		for i := 0; i < 3; i++ {
+			next, _ := table.Pick("m1", "", config.BalanceLeastRequests)
+			assert.NotEqual(t, route.NodeID, next.NodeID)
+		}
+
+		done()
+		done()
+		for _, r := range table.List() {
+			assert.Equal(t, 0, r.Inflight)
+		}
+	})
+
+	t.Run("Sticky session", func(t *testing.T) {
+		table := newTable()
+		first, _ := table.Pick("m1", "session-1", config.BalanceRoundRobin)
+		for i := 0; i < 5; i++ {
+			route, _ := table.Pick("m1", "session-1", config.BalanceRoundRobin)
+			assert.Equal(t, first.NodeID, route.NodeID)
+		}
+	})
+
+	t.Run("Skips failed node", func(t *testing.T) {
+		table := newTable()
+		table.MarkFailed("node-a")
+		for i := 0; i < 3; i++ {
+			route, _ := table.Pick("m1", "", config.BalanceRoundRobin)
+			assert.Equal(t, "node-b", route.NodeID)
+		}
+
+		// 所有节点都失败时仍返回路由
+		table.MarkFailed("node-b")
+		_, ok := table.Pick("m1", "", config.BalanceRoundRobin)
+		assert.True(t, ok)
+		assert.False(t, table.List()[0].Healthy)
+	})
+
+	t.Run("Unknown model", func(t *testing.T) {
+		_, ok := newTable().Pick("m2", "", config.BalanceLeastRequests)
+		assert.False(t, ok)
+	})
+}
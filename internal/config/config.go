@@ -4,8 +4,11 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
 	"testing"
 
@@ -41,6 +44,8 @@ type Config struct {
 	Compatibility CompatibilityConfig   `mapstructure:"compatibility" yaml:"compatibility" json:"compatibility"`
 	Log           LogConfig             `mapstructure:"log" yaml:"log" json:"log"`
 	Storage       storage.StorageConfig `mapstructure:"storage" yaml:"storage" json:"storage"`
+	Gateway       GatewayConfig         `mapstructure:"gateway" yaml:"gateway" json:"gateway"`
+	Tracing       TracingConfig         `mapstructure:"tracing" yaml:"tracing" json:"tracing"`
 	// Master-Client 分布式配置
 	Mode   string       `mapstructure:"mode" yaml:"mode" json:"mode"`
 	Master MasterConfig `mapstructure:"master" yaml:"master" json:"master"`
@@ -58,6 +63,15 @@ type ServerConfig struct {
 	Host          string `mapstructure:"host" yaml:"host" json:"host"`
 	ReadTimeout   int    `mapstructure:"read_timeout" yaml:"read_timeout" json:"readTimeout"`    // seconds
 	WriteTimeout  int    `mapstructure:"write_timeout" yaml:"write_timeout" json:"writeTimeout"` // seconds
+	// HTTPS，作用于全部监听端口（Web、Ollama、LM Studio）
+	TLS TLSConfig `mapstructure:"tls" yaml:"tls" json:"tls"`
+}
+
+// TLSConfig contains HTTPS settings for the listeners
+type TLSConfig struct {
+	Enabled  bool   `mapstructure:"enabled" yaml:"enabled" json:"enabled"`
+	CertFile string `mapstructure:"cert_file" yaml:"cert_file" json:"certFile"` // 空 = 由内置 CA 签发（client 节点使用 Master 签发的节点证书）
+	KeyFile  string `mapstructure:"key_file" yaml:"key_file" json:"keyFile"`
 }
 
 // ModelConfig contains model scanning and management configuration
@@ -141,6 +155,217 @@ type LMStudioConfig struct {
 	Port    int  `mapstructure:"port" yaml:"port" json:"port"`
 }
 
+// GatewayConfig contains inference gateway settings shared by the
+// OpenAI, Anthropic and Ollama compatible endpoints
+type GatewayConfig struct {
+	AutoLoad   AutoLoadConfig   `mapstructure:"auto_load" yaml:"auto_load" json:"autoLoad"`
+	IdleUnload IdleUnloadConfig `mapstructure:"idle_unload" yaml:"idle_unload" json:"idleUnload"`
+	Queue      QueueConfig      `mapstructure:"queue" yaml:"queue" json:"queue"`
+	Balancing  BalancingConfig  `mapstructure:"balancing" yaml:"balancing" json:"balancing"`
+	Capture    CaptureConfig    `mapstructure:"capture" yaml:"capture" json:"capture"`
+	Audit      AuditConfig      `mapstructure:"audit" yaml:"audit" json:"audit"`
+	RateLimits RateLimitConfig  `mapstructure:"rate_limits" yaml:"rate_limits" json:"rateLimits"`
+
+	VirtualModels []VirtualModelConfig `mapstructure:"virtual_models" yaml:"virtual_models" json:"virtualModels"`
+	Filters       []FilterConfig       `mapstructure:"filters" yaml:"filters" json:"filters"`
+}
+
+// AutoLoadConfig contains on-demand model loading settings
+type AutoLoadConfig struct {
+	Enabled         bool `mapstructure:"enabled" yaml:"enabled" json:"enabled"`                              // 请求未加载的模型时自动加载
+	WaitTimeout     int  `mapstructure:"wait_timeout" yaml:"wait_timeout" json:"waitTimeout"`                // seconds, 等待模型就绪的最长时间
+	MaxLoadedModels int  `mapstructure:"max_loaded_models" yaml:"max_loaded_models" json:"maxLoadedModels"` // 同时运行的模型上限，0 = 不限制
+}
+
+// IdleUnloadConfig contains idle model unloading settings
+type IdleUnloadConfig struct {
+	TTL           int `mapstructure:"ttl" yaml:"ttl" json:"ttl"`                                  // seconds, 空闲超过该时间的模型自动卸载，0 = 不卸载
+	CheckInterval int `mapstructure:"check_interval" yaml:"check_interval" json:"checkInterval"` // seconds, 空闲检查间隔
+}
+
+// QueueConfig contains per-model request admission settings. Each loaded
+// model admits as many concurrent requests as it has parallel slots.
+type QueueConfig struct {
+	MaxQueued int `mapstructure:"max_queued" yaml:"max_queued" json:"maxQueued"` // 每个模型排队请求上限，超出返回 429，0 = 默认 32
+	Timeout   int `mapstructure:"timeout" yaml:"timeout" json:"timeout"`          // seconds, 排队超时返回 503，0 = 默认 60
+}
+
+// Replica balancing strategies
+const (
+	BalanceLeastRequests = "least_requests"
+	BalanceRoundRobin    = "round_robin"
+)
+
+// BalancingConfig contains how requests are spread across the replicas of a
+// model, both local instances and cluster nodes
+type BalancingConfig struct {
+	Strategy      string `mapstructure:"strategy" yaml:"strategy" json:"strategy"`                   // least_requests 或 round_robin，空 = least_requests
+	SessionHeader string `mapstructure:"session_header" yaml:"session_header" json:"sessionHeader"` // 会话粘滞请求头，空 = X-Session-ID
+}
+
+// CaptureConfig contains conversation capture settings. Requests carrying
+// the header are always recorded into that conversation.
+type CaptureConfig struct {
+	Enabled bool   `mapstructure:"enabled" yaml:"enabled" json:"enabled"` // 记录所有对话请求，未指定会话时新建
+	Header  string `mapstructure:"header" yaml:"header" json:"header"`    // 指定会话 ID 的请求头，空 = X-Conversation-ID
+}
+
+// AuditConfig contains request/response audit log settings
+type AuditConfig struct {
+	Enabled       bool     `mapstructure:"enabled" yaml:"enabled" json:"enabled"`                      // 记录推理请求和响应
+	RetentionDays int      `mapstructure:"retention_days" yaml:"retention_days" json:"retentionDays"` // 审计记录保留天数，0 = 永久保留
+	MaxBodyBytes  int      `mapstructure:"max_body_bytes" yaml:"max_body_bytes" json:"maxBodyBytes"`  // 请求和响应各自保存的最大字节数，0 = 默认 64KB
+	RedactFields  []string `mapstructure:"redact_fields" yaml:"redact_fields" json:"redactFields"`    // 额外脱敏的 JSON 字段名
+}
+
+// TracingConfig contains OpenTelemetry trace export settings. Spans are sent
+// to an OTLP/HTTP collector such as the OpenTelemetry Collector or Jaeger.
+type TracingConfig struct {
+	Enabled     bool              `mapstructure:"enabled" yaml:"enabled" json:"enabled"`
+	Endpoint    string            `mapstructure:"endpoint" yaml:"endpoint" json:"endpoint"`            // OTLP/HTTP traces 地址，空 = http://localhost:4318/v1/traces
+	ServiceName string            `mapstructure:"service_name" yaml:"service_name" json:"serviceName"` // service.name 资源属性，空 = shepherd
+	SampleRatio float64           `mapstructure:"sample_ratio" yaml:"sample_ratio" json:"sampleRatio"` // 新 trace 的采样比例 0-1，已有上游 trace 时沿用其采样决定
+	Headers     map[string]string `mapstructure:"headers" yaml:"headers" json:"headers"`               // 导出请求附带的请求头，如采集器认证
+}
+
+// RateLimitConfig contains request and token limits per API key and per
+// model. Keys with their own limits use those instead of KeyDefaults.
+type RateLimitConfig struct {
+	Enabled     bool             `mapstructure:"enabled" yaml:"enabled" json:"enabled"`
+	KeyDefaults RateLimit        `mapstructure:"key_defaults" yaml:"key_defaults" json:"keyDefaults"` // 未单独设置限额的密钥（含无密钥请求）
+	Models      []ModelRateLimit `mapstructure:"models" yaml:"models" json:"models"`                  // 按模型名限制，所有密钥共享
+}
+
+// RateLimit is a set of limits; zero means unlimited
+type RateLimit struct {
+	RequestsPerMinute  int   `mapstructure:"requests_per_minute" yaml:"requests_per_minute" json:"requestsPerMinute"`
+	ConcurrentRequests int   `mapstructure:"concurrent_requests" yaml:"concurrent_requests" json:"concurrentRequests"`
+	TokensPerDay       int64 `mapstructure:"tokens_per_day" yaml:"tokens_per_day" json:"tokensPerDay"` // UTC 自然日
+}
+
+// ModelRateLimit limits the requests for one model name
+type ModelRateLimit struct {
+	Model     string `mapstructure:"model" yaml:"model" json:"model"`
+	RateLimit `mapstructure:",squash" yaml:",inline"`
+}
+
+func (l RateLimit) validate() error {
+	if l.RequestsPerMinute < 0 || l.ConcurrentRequests < 0 || l.TokensPerDay < 0 {
+		return fmt.Errorf("limits cannot be negative")
+	}
+	return nil
+}
+
+// VirtualModelConfig defines a stable model name, such as "chat-default",
+// served by the first suitable model of an ordered fallback list
+type VirtualModelConfig struct {
+	Name        string             `mapstructure:"name" yaml:"name" json:"name"`
+	Description string             `mapstructure:"description" yaml:"description" json:"description,omitempty"`
+	Models      []string           `mapstructure:"models" yaml:"models" json:"models"` // 按顺序回退的模型 ID、别名或名称
+	Rules       []VirtualModelRule `mapstructure:"rules" yaml:"rules" json:"rules,omitempty"`
+	Filters     []string           `mapstructure:"filters" yaml:"filters" json:"filters,omitempty"` // 请求该虚拟模型时启用的过滤器名称
+}
+
+// VirtualModelRule puts its models ahead of the default list for requests
+// matching all of its conditions
+type VirtualModelRule struct {
+	MinPromptTokens int      `mapstructure:"min_prompt_tokens" yaml:"min_prompt_tokens" json:"minPromptTokens,omitempty"` // 估算的提示词 token 数不少于该值
+	Tools           bool     `mapstructure:"tools" yaml:"tools" json:"tools,omitempty"`                                   // 请求带工具定义
+	Vision          bool     `mapstructure:"vision" yaml:"vision" json:"vision,omitempty"`                                // 请求带图像
+	Models          []string `mapstructure:"models" yaml:"models" json:"models"`
+}
+
+// Gateway filter types
+const (
+	FilterPII           = "pii"            // 脱敏邮箱、电话等个人信息
+	FilterBannedPhrases = "banned_phrases" // 拦截或替换违禁词
+	FilterSystemPrompt  = "system_prompt"  // 注入系统提示词
+	FilterGuard         = "guard"          // 由已加载的安全模型分类输出
+)
+
+// Stages a gateway filter applies to
+const (
+	FilterApplyRequest  = "request"
+	FilterApplyResponse = "response"
+	FilterApplyBoth     = "both"
+)
+
+// FilterConfig defines a named content filter of the gateway. Filters are
+// enabled per virtual model or per API key and run in order on the request
+// messages before they are forwarded and on the generated text, including
+// each chunk of a streamed response.
+type FilterConfig struct {
+	Name  string `mapstructure:"name" yaml:"name" json:"name"`
+	Type  string `mapstructure:"type" yaml:"type" json:"type"`
+	Apply string `mapstructure:"apply" yaml:"apply" json:"apply,omitempty"` // request、response 或 both，空 = 按类型默认
+
+	// pii
+	Patterns       []string        `mapstructure:"patterns" yaml:"patterns" json:"patterns,omitempty"` // 内置规则: email、phone、credit_card、ipv4，空 = 全部
+	CustomPatterns []FilterPattern `mapstructure:"custom_patterns" yaml:"custom_patterns" json:"customPatterns,omitempty"`
+
+	// banned_phrases
+	Phrases []string `mapstructure:"phrases" yaml:"phrases" json:"phrases,omitempty"` // 不区分大小写
+	Action  string   `mapstructure:"action" yaml:"action" json:"action,omitempty"`    // block 或 redact，空 = block
+
+	// system_prompt 注入的提示词；guard 的分类提示词，{{text}} 替换为待分类文本
+	Prompt   string `mapstructure:"prompt" yaml:"prompt" json:"prompt,omitempty"`
+	Position string `mapstructure:"position" yaml:"position" json:"position,omitempty"` // prepend、append 或 replace，空 = prepend
+
+	// guard
+	Model       string   `mapstructure:"model" yaml:"model" json:"model,omitempty"`                     // 安全模型 ID、别名或名称，须已加载
+	BlockOn     []string `mapstructure:"block_on" yaml:"block_on" json:"blockOn,omitempty"`             // 分类结果包含任一关键词时拦截，空 = unsafe
+	WindowChars int      `mapstructure:"window_chars" yaml:"window_chars" json:"windowChars,omitempty"` // 流式输出每累积该字符数分类一次，0 = 400
+	FailClosed  bool     `mapstructure:"fail_closed" yaml:"fail_closed" json:"failClosed,omitempty"`    // 安全模型不可用时拦截，默认放行
+}
+
+// FilterPattern is a custom redaction rule of a pii filter
+type FilterPattern struct {
+	Name        string `mapstructure:"name" yaml:"name" json:"name"`
+	Regex       string `mapstructure:"regex" yaml:"regex" json:"regex"`
+	Replacement string `mapstructure:"replacement" yaml:"replacement" json:"replacement,omitempty"` // 空 = [REDACTED]
+}
+
+func (f FilterConfig) validate() error {
+	switch f.Apply {
+	case "", FilterApplyRequest, FilterApplyResponse, FilterApplyBoth:
+	default:
+		return fmt.Errorf("invalid apply: %s", f.Apply)
+	}
+
+	switch f.Type {
+	case FilterPII:
+		for _, pattern := range f.CustomPatterns {
+			if _, err := regexp.Compile(pattern.Regex); err != nil {
+				return fmt.Errorf("invalid pattern %s: %w", pattern.Name, err)
+			}
+		}
+	case FilterBannedPhrases:
+		if len(f.Phrases) == 0 {
+			return fmt.Errorf("no phrases")
+		}
+		if f.Action != "" && f.Action != "block" && f.Action != "redact" {
+			return fmt.Errorf("invalid action: %s", f.Action)
+		}
+	case FilterSystemPrompt:
+		if f.Prompt == "" {
+			return fmt.Errorf("prompt cannot be empty")
+		}
+		if f.Position != "" && f.Position != "prepend" && f.Position != "append" && f.Position != "replace" {
+			return fmt.Errorf("invalid position: %s", f.Position)
+		}
+	case FilterGuard:
+		if f.Model == "" {
+			return fmt.Errorf("model cannot be empty")
+		}
+		if f.WindowChars < 0 {
+			return fmt.Errorf("window chars cannot be negative")
+		}
+	default:
+		return fmt.Errorf("invalid type: %s", f.Type)
+	}
+	return nil
+}
+
 // MasterConfig contains Master node configuration
 // Deprecated: Use Node.MasterRole instead. This type is kept for backward compatibility.
 type MasterConfig struct {
@@ -217,18 +442,31 @@ type NodeMasterRoleConfig struct {
 
 // NodeClientRoleConfig contains Client role specific configuration
 type NodeClientRoleConfig struct {
-	Enabled           bool   `mapstructure:"enabled" yaml:"enabled" json:"enabled"`                                 // 是否启用Client角色
-	MasterAddress     string `mapstructure:"master_address" yaml:"master_address" json:"masterAddress"`             // Master地址
-	RegisterRetry     int    `mapstructure:"register_retry" yaml:"register_retry" json:"registerRetry"`             // 注册重试次数
-	HeartbeatInterval int    `mapstructure:"heartbeat_interval" yaml:"heartbeat_interval" json:"heartbeatInterval"` // 心跳间隔（秒）
-	HeartbeatTimeout  int    `mapstructure:"heartbeat_timeout" yaml:"heartbeat_timeout" json:"heartbeatTimeout"`    // 心跳超时（秒）
+	Enabled           bool                `mapstructure:"enabled" yaml:"enabled" json:"enabled"`                                 // 是否启用Client角色
+	MasterAddress     string              `mapstructure:"master_address" yaml:"master_address" json:"masterAddress"`             // Master地址
+	RegisterRetry     int                 `mapstructure:"register_retry" yaml:"register_retry" json:"registerRetry"`             // 注册重试次数
+	HeartbeatInterval int                 `mapstructure:"heartbeat_interval" yaml:"heartbeat_interval" json:"heartbeatInterval"` // 心跳间隔（秒）
+	HeartbeatTimeout  int                 `mapstructure:"heartbeat_timeout" yaml:"heartbeat_timeout" json:"heartbeatTimeout"`    // 心跳超时（秒）
+	SSL               NodeClientSSLConfig `mapstructure:"ssl" yaml:"ssl" json:"ssl"`                                             // 集群 mTLS 配置
 }
 
-// NodeSSLConfig contains SSL/TLS configuration
+// NodeSSLConfig contains the master's cluster mTLS configuration. The master
+// runs a CA, issues client certificates at join time and refuses node
+// protocol calls without one.
 type NodeSSLConfig struct {
-	Enabled  bool   `mapstructure:"enabled" yaml:"enabled" json:"enabled"`      // 是否启用SSL
-	CertPath string `mapstructure:"cert_path" yaml:"cert_path" json:"certPath"` // 证书路径
-	KeyPath  string `mapstructure:"key_path" yaml:"key_path" json:"keyPath"`    // 密钥路径
+	Enabled      bool   `mapstructure:"enabled" yaml:"enabled" json:"enabled"`                  // 是否启用集群 mTLS
+	CertPath     string `mapstructure:"cert_path" yaml:"cert_path" json:"certPath"`             // CA 证书路径，空 = data/pki/ca.crt，不存在时自动生成
+	KeyPath      string `mapstructure:"key_path" yaml:"key_path" json:"keyPath"`                // CA 私钥路径，空 = data/pki/ca.key
+	JoinToken    string `mapstructure:"join_token" yaml:"join_token" json:"joinToken"`          // 客户端首次加入时出示的令牌，空 = 不接受新节点
+	CertValidity int    `mapstructure:"cert_validity" yaml:"cert_validity" json:"certValidity"` // 节点证书有效期（天），0 = 30
+}
+
+// NodeClientSSLConfig contains a client node's cluster mTLS configuration
+type NodeClientSSLConfig struct {
+	Enabled       bool   `mapstructure:"enabled" yaml:"enabled" json:"enabled"`                     // 是否启用集群 mTLS
+	JoinToken     string `mapstructure:"join_token" yaml:"join_token" json:"joinToken"`             // Master 的加入令牌
+	CAFingerprint string `mapstructure:"ca_fingerprint" yaml:"ca_fingerprint" json:"caFingerprint"` // Master CA 指纹（sha256:...），空 = 信任首次连接时的 CA
+	CertDir       string `mapstructure:"cert_dir" yaml:"cert_dir" json:"certDir"`                   // 节点证书目录，空 = data/pki/node
 }
 
 // NodeResourceConfig contains resource monitoring configuration
@@ -282,6 +520,8 @@ type ModelConfigEntry struct {
 	Size      int64  `json:"size,omitempty"`
 	Alias     string `json:"alias,omitempty"`
 	Favourite bool   `json:"favourite"`
+	Pinned    bool   `json:"pinned,omitempty"`  // 固定模型，不参与空闲卸载
+	IdleTTL   int    `json:"idleTtl,omitempty"` // 空闲自动卸载时间（秒），0 = 使用全局设置，-1 = 从不卸载
 	// 分卷模型相关字段
 	TotalSize    int64             `json:"totalSize,omitempty"`  // 所有分卷的总大小
 	ShardCount   int               `json:"shardCount,omitempty"` // 分卷数量
@@ -412,6 +652,41 @@ func DefaultConfig() *Config {
 				},
 			},
 		},
+		Gateway: GatewayConfig{
+			// 按需加载会启动 llama-server 并卸载其他模型，默认关闭，由运维人员显式开启
+			AutoLoad: AutoLoadConfig{
+				Enabled:         false,
+				WaitTimeout:     300, // 5 minutes
+				MaxLoadedModels: 0,
+			},
+			IdleUnload: IdleUnloadConfig{
+				TTL:           0, // 默认不自动卸载
+				CheckInterval: 30,
+			},
+			Queue: QueueConfig{
+				MaxQueued: 32,
+				Timeout:   60,
+			},
+			Balancing: BalancingConfig{
+				Strategy:      BalanceLeastRequests,
+				SessionHeader: "X-Session-ID",
+			},
+			Capture: CaptureConfig{
+				Enabled: false,
+				Header:  "X-Conversation-ID",
+			},
+			Audit: AuditConfig{
+				Enabled:       false,
+				RetentionDays: 30,
+				MaxBodyBytes:  64 * 1024,
+			},
+		},
+		Tracing: TracingConfig{
+			Enabled:     false,
+			Endpoint:    "http://localhost:4318/v1/traces",
+			ServiceName: "shepherd",
+			SampleRatio: 1,
+		},
 		Master: MasterConfig{
 			Enabled:         false,
 			ClientConfigDir: filepath.Join(cwd, "config", "clients"),
@@ -645,6 +920,10 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid lmstudio port: %d", c.Server.LMStudioPort)
 	}
 
+	if (c.Server.TLS.CertFile == "") != (c.Server.TLS.KeyFile == "") {
+		return fmt.Errorf("tls cert file and key file must be set together")
+	}
+
 	// Check for port conflicts
 	ports := map[int]string{
 		c.Server.WebPort:       "web",
@@ -671,6 +950,86 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("chunk size too small (minimum 1024 bytes)")
 	}
 
+	// Validate gateway settings
+	if c.Gateway.AutoLoad.WaitTimeout < 0 {
+		return fmt.Errorf("auto load wait timeout cannot be negative")
+	}
+	if c.Gateway.AutoLoad.MaxLoadedModels < 0 {
+		return fmt.Errorf("max loaded models cannot be negative")
+	}
+	if c.Gateway.IdleUnload.TTL < 0 {
+		return fmt.Errorf("idle unload ttl cannot be negative")
+	}
+	if c.Gateway.Queue.MaxQueued < 0 {
+		return fmt.Errorf("queue max queued cannot be negative")
+	}
+	if c.Gateway.Queue.Timeout < 0 {
+		return fmt.Errorf("queue timeout cannot be negative")
+	}
+	switch c.Gateway.Balancing.Strategy {
+	case "", BalanceLeastRequests, BalanceRoundRobin:
+	default:
+		return fmt.Errorf("invalid balancing strategy: %s", c.Gateway.Balancing.Strategy)
+	}
+	if err := c.Gateway.RateLimits.KeyDefaults.validate(); err != nil {
+		return fmt.Errorf("rate limit key defaults: %w", err)
+	}
+	for _, limit := range c.Gateway.RateLimits.Models {
+		if limit.Model == "" {
+			return fmt.Errorf("rate limit model cannot be empty")
+		}
+		if err := limit.validate(); err != nil {
+			return fmt.Errorf("rate limit for model %s: %w", limit.Model, err)
+		}
+	}
+	filterNames := make(map[string]bool)
+	for _, filter := range c.Gateway.Filters {
+		if filter.Name == "" {
+			return fmt.Errorf("filter name cannot be empty")
+		}
+		if filterNames[filter.Name] {
+			return fmt.Errorf("duplicate filter: %s", filter.Name)
+		}
+		filterNames[filter.Name] = true
+		if err := filter.validate(); err != nil {
+			return fmt.Errorf("filter %s: %w", filter.Name, err)
+		}
+	}
+	virtualNames := make(map[string]bool)
+	for _, vm := range c.Gateway.VirtualModels {
+		if vm.Name == "" {
+			return fmt.Errorf("virtual model name cannot be empty")
+		}
+		if virtualNames[strings.ToLower(vm.Name)] {
+			return fmt.Errorf("duplicate virtual model: %s", vm.Name)
+		}
+		virtualNames[strings.ToLower(vm.Name)] = true
+		if len(vm.Models) == 0 {
+			return fmt.Errorf("virtual model %s has no models", vm.Name)
+		}
+		for _, rule := range vm.Rules {
+			if len(rule.Models) == 0 {
+				return fmt.Errorf("virtual model %s has a rule without models", vm.Name)
+			}
+		}
+		for _, name := range vm.Filters {
+			if !filterNames[name] {
+				return fmt.Errorf("virtual model %s uses unknown filter: %s", vm.Name, name)
+			}
+		}
+	}
+
+	// Validate tracing settings
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("tracing sample ratio must be between 0 and 1")
+	}
+	if c.Tracing.Enabled && c.Tracing.Endpoint != "" {
+		u, err := url.Parse(c.Tracing.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid tracing endpoint: %s", c.Tracing.Endpoint)
+		}
+	}
+
 	// Validate model paths
 	for _, path := range c.Model.Paths {
 		if path == "" {
@@ -722,13 +1081,26 @@ func (c *Config) validateNodeConfig() error {
 		if c.Node.MasterRole.Port < 1 || c.Node.MasterRole.Port > 65535 {
 			return fmt.Errorf("invalid master role port: %d", c.Node.MasterRole.Port)
 		}
-		if c.Node.MasterRole.SSL.Enabled {
-			if c.Node.MasterRole.SSL.CertPath == "" {
-				return fmt.Errorf("SSL enabled but cert path is empty")
-			}
-			if c.Node.MasterRole.SSL.KeyPath == "" {
-				return fmt.Errorf("SSL enabled but key path is empty")
-			}
+	}
+
+	// 验证集群 mTLS 配置，节点协议与 Web 接口共用端口，因此需要开启 HTTPS
+	if ssl := c.Node.MasterRole.SSL; ssl.Enabled {
+		if !c.Server.TLS.Enabled {
+			return fmt.Errorf("master SSL requires server.tls.enabled")
+		}
+		if (ssl.CertPath == "") != (ssl.KeyPath == "") {
+			return fmt.Errorf("master SSL cert path and key path must be set together")
+		}
+		if ssl.CertValidity < 0 {
+			return fmt.Errorf("master SSL cert validity cannot be negative")
+		}
+	}
+	if c.Node.ClientRole.SSL.Enabled {
+		if !c.Server.TLS.Enabled {
+			return fmt.Errorf("client SSL requires server.tls.enabled")
+		}
+		if addr := c.Node.ClientRole.MasterAddress; addr != "" && !strings.HasPrefix(addr, "https://") {
+			return fmt.Errorf("client SSL requires an https:// master address, got %s", addr)
 		}
 	}
 
@@ -423,6 +423,58 @@ func (m *Manager) SaveModelFavourite(modelID string, favourite bool) error {
 	return m.SaveModelsConfig(models)
 }
 
+// SaveModelPinned saves a model's pinned flag to models config
+func (m *Manager) SaveModelPinned(modelID string, pinned bool) error {
+	models, err := m.LoadModelsConfig()
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i := range models {
+		if models[i].ModelID == modelID {
+			models[i].Pinned = pinned
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		models = append(models, ModelConfigEntry{
+			ModelID: modelID,
+			Pinned:  pinned,
+		})
+	}
+
+	return m.SaveModelsConfig(models)
+}
+
+// SaveModelIdleTTL saves a model's idle unload timeout (seconds) to models config
+func (m *Manager) SaveModelIdleTTL(modelID string, idleTTL int) error {
+	models, err := m.LoadModelsConfig()
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for i := range models {
+		if models[i].ModelID == modelID {
+			models[i].IdleTTL = idleTTL
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		models = append(models, ModelConfigEntry{
+			ModelID: modelID,
+			IdleTTL: idleTTL,
+		})
+	}
+
+	return m.SaveModelsConfig(models)
+}
+
 // LoadFavouriteMap loads all model favourite statuses as a map
 func (m *Manager) LoadFavouriteMap() (map[string]bool, error) {
 	models, err := m.LoadModelsConfigCached()
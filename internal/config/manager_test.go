@@ -89,6 +89,123 @@ func TestConfigValidate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "max concurrent",
 		},
+		{
+			name: "Duplicate virtual model",
+			config: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Gateway.VirtualModels = []VirtualModelConfig{
+					{Name: "coder", Models: []string{"qwen-coder"}},
+					{Name: "Coder", Models: []string{"deepseek-coder"}},
+				}
+				return cfg
+			}(),
+			wantErr: true,
+			errMsg:  "duplicate virtual model",
+		},
+		{
+			name: "Virtual model without models",
+			config: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Gateway.VirtualModels = []VirtualModelConfig{{Name: "chat-default"}}
+				return cfg
+			}(),
+			wantErr: true,
+			errMsg:  "has no models",
+		},
+		{
+			name: "Virtual model with unknown filter",
+			config: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Gateway.Filters = []FilterConfig{{Name: "pii", Type: FilterPII}}
+				cfg.Gateway.VirtualModels = []VirtualModelConfig{{Name: "chat-default", Models: []string{"qwen"}, Filters: []string{"pii", "guard"}}}
+				return cfg
+			}(),
+			wantErr: true,
+			errMsg:  "unknown filter: guard",
+		},
+		{
+			name: "Filter with invalid pattern",
+			config: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Gateway.Filters = []FilterConfig{{Name: "pii", Type: FilterPII, CustomPatterns: []FilterPattern{{Name: "id", Regex: "[0-9"}}}}
+				return cfg
+			}(),
+			wantErr: true,
+			errMsg:  "invalid pattern id",
+		},
+		{
+			name: "Guard filter without model",
+			config: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Gateway.Filters = []FilterConfig{{Name: "guard", Type: FilterGuard}}
+				return cfg
+			}(),
+			wantErr: true,
+			errMsg:  "model cannot be empty",
+		},
+		{
+			name: "Negative rate limit",
+			config: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Gateway.RateLimits.Models = []ModelRateLimit{{Model: "qwen", RateLimit: RateLimit{RequestsPerMinute: -1}}}
+				return cfg
+			}(),
+			wantErr: true,
+			errMsg:  "cannot be negative",
+		},
+		{
+			name: "Master SSL without TLS",
+			config: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Node.MasterRole.SSL.Enabled = true
+				return cfg
+			}(),
+			wantErr: true,
+			errMsg:  "requires server.tls.enabled",
+		},
+		{
+			name: "Client SSL with http master",
+			config: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Server.TLS.Enabled = true
+				cfg.Node.ClientRole.MasterAddress = "http://10.0.0.1:9190"
+				cfg.Node.ClientRole.SSL.Enabled = true
+				return cfg
+			}(),
+			wantErr: true,
+			errMsg:  "https://",
+		},
+		{
+			name: "TLS cert without key",
+			config: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Server.TLS = TLSConfig{Enabled: true, CertFile: "server.crt"}
+				return cfg
+			}(),
+			wantErr: true,
+			errMsg:  "set together",
+		},
+		{
+			name: "Tracing sample ratio out of range",
+			config: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Tracing.SampleRatio = 1.5
+				return cfg
+			}(),
+			wantErr: true,
+			errMsg:  "sample ratio",
+		},
+		{
+			name: "Tracing endpoint without scheme",
+			config: func() *Config {
+				cfg := DefaultConfig()
+				cfg.Tracing.Enabled = true
+				cfg.Tracing.Endpoint = "localhost:4318"
+				return cfg
+			}(),
+			wantErr: true,
+			errMsg:  "invalid tracing endpoint",
+		},
 	}
 
 	for _, tt := range tests {
@@ -155,6 +272,7 @@ func TestManagerLoadSave(t *testing.T) {
 	t.Run("Save and Load config", func(t *testing.T) {
 		config := DefaultConfig()
 		config.Server.WebPort = 9090
+		config.Gateway.RateLimits.Models = []ModelRateLimit{{Model: "Qwen2.5-7B", RateLimit: RateLimit{RequestsPerMinute: 60}}}
 
 		err := manager.Save(config)
 		require.NoError(t, err)
@@ -169,6 +287,7 @@ func TestManagerLoadSave(t *testing.T) {
 		require.NoError(t, err)
 
 		assert.Equal(t, 9090, loaded.Server.WebPort)
+		assert.Equal(t, config.Gateway.RateLimits.Models, loaded.Gateway.RateLimits.Models)
 	})
 
 	t.Run("Save validates config", func(t *testing.T) {
@@ -334,6 +453,36 @@ func TestAliasAndFavourite(t *testing.T) {
 	})
 }
 
+func TestPinnedAndIdleTTL(t *testing.T) {
+	tmpDir := t.TempDir()
+	manager := &Manager{
+		configPath:       filepath.Join(tmpDir, "config.yaml"),
+		modelsConfigPath: filepath.Join(tmpDir, "models.json"),
+		launchConfigPath: filepath.Join(tmpDir, "launch.json"),
+	}
+
+	require.NoError(t, manager.SaveModelAlias("model-1", "my-alias"))
+	require.NoError(t, manager.SaveModelPinned("model-1", true))
+	require.NoError(t, manager.SaveModelIdleTTL("model-1", 600))
+	require.NoError(t, manager.SaveModelIdleTTL("model-2", -1))
+
+	models, err := manager.LoadModelsConfig()
+	require.NoError(t, err)
+	require.Len(t, models, 2)
+
+	entries := make(map[string]ModelConfigEntry)
+	for _, m := range models {
+		entries[m.ModelID] = m
+	}
+
+	// 已有条目的其他字段保持不变
+	assert.Equal(t, "my-alias", entries["model-1"].Alias)
+	assert.True(t, entries["model-1"].Pinned)
+	assert.Equal(t, 600, entries["model-1"].IdleTTL)
+	assert.False(t, entries["model-2"].Pinned)
+	assert.Equal(t, -1, entries["model-2"].IdleTTL)
+}
+
 func TestCachedModelsConfig(t *testing.T) {
 	tmpDir := t.TempDir()
 	manager := &Manager{
@@ -0,0 +1,181 @@
+// Package filter implements the content filter pipeline of the inference
+// gateway. A Chain runs its filters on the messages of a request before it
+// is forwarded to llama-server and on the generated text of the response,
+// chunk by chunk when the response is streamed. Filters can rewrite text,
+// such as redacting personal information, or block the request. Blocks and
+// rewrites are logged and added to the request's audit record.
+//
+// A nil *Chain filters nothing, so handlers can call it unconditionally.
+package filter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/audit"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+)
+
+// Audit event types
+const (
+	EventBlock   = "filter.block"
+	EventRewrite = "filter.rewrite"
+	EventError   = "filter.error"
+)
+
+// Filter stages
+const (
+	StageRequest  = "request"
+	StageResponse = "response"
+)
+
+// FinishReason is the finish_reason of a response blocked by a filter
+const FinishReason = "content_filter"
+
+// Message is a chat message as seen by filters. Only text content is
+// filtered; images and tool calls of the original message are kept.
+type Message struct {
+	Role    string
+	Content string
+	Index   int // 在原请求中的位置，过滤器新增的消息为 -1
+}
+
+// Filter inspects the messages of a request and the text generated for it
+type Filter interface {
+	// Request returns the messages to send to the model
+	Request(ctx context.Context, messages []Message) ([]Message, error)
+
+	// Response starts filtering one generated text; nil when the filter
+	// does not inspect responses
+	Response(ctx context.Context) StreamFilter
+}
+
+// StreamFilter filters a generated text as it arrives. Write returns the
+// part of the text that may be released to the client so far; a filter may
+// hold text back until it has seen enough to decide. Close releases what is
+// left at the end of the text.
+//
+// A *BlockedError stops the response. Other errors are recorded and the
+// returned text is used as is.
+type StreamFilter interface {
+	Write(text string) (string, error)
+	Close() (string, error)
+}
+
+// BlockedError is returned by a filter that blocks a request or response
+type BlockedError struct {
+	Filter string
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	if e.Filter == "" {
+		return "blocked by content filter: " + e.Reason
+	}
+	return fmt.Sprintf("blocked by content filter %s: %s", e.Filter, e.Reason)
+}
+
+// IsBlocked reports whether err is a *BlockedError
+func IsBlocked(err error) bool {
+	var blocked *BlockedError
+	return errors.As(err, &blocked)
+}
+
+// entry is a filter of a chain with the stages it applies to
+type entry struct {
+	name     string
+	filter   Filter
+	request  bool
+	response bool
+}
+
+// Chain runs filters in order. A nil *Chain filters nothing.
+type Chain struct {
+	entries []entry
+}
+
+// Empty reports whether the chain has no filters
+func (c *Chain) Empty() bool {
+	return c == nil || len(c.entries) == 0
+}
+
+// Request runs the request filters on messages. A blocked request returns a
+// *BlockedError naming the filter.
+func (c *Chain) Request(ctx context.Context, messages []Message) ([]Message, error) {
+	if c.Empty() {
+		return messages, nil
+	}
+	for _, e := range c.entries {
+		if !e.request {
+			continue
+		}
+		filtered, err := e.filter.Request(ctx, messages)
+		if err != nil {
+			var blocked *BlockedError
+			if errors.As(err, &blocked) {
+				blocked.Filter = e.name
+				recordEvent(ctx, EventBlock, e.name, StageRequest, blocked.Reason)
+				return nil, blocked
+			}
+			recordEvent(ctx, EventError, e.name, StageRequest, err.Error())
+			continue
+		}
+		if changed := changedMessages(messages, filtered); changed > 0 {
+			recordEvent(ctx, EventRewrite, e.name, StageRequest, fmt.Sprintf("%d messages", changed))
+		}
+		messages = filtered
+	}
+	return messages, nil
+}
+
+// Prompt runs the request filters on a text completion prompt. Messages
+// added by filters, such as a system prompt, are joined with the prompt.
+func (c *Chain) Prompt(ctx context.Context, prompt string) (string, error) {
+	if c.Empty() {
+		return prompt, nil
+	}
+	messages, err := c.Request(ctx, []Message{{Role: "user", Content: prompt, Index: 0}})
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(messages))
+	for _, msg := range messages {
+		if msg.Content != "" {
+			parts = append(parts, msg.Content)
+		}
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
+
+// changedMessages counts the messages a filter added, removed or rewrote
+func changedMessages(before, after []Message) int {
+	changed := 0
+	if len(after) != len(before) {
+		changed = len(after) - len(before)
+		if changed < 0 {
+			changed = -changed
+		}
+	}
+	for i := 0; i < len(before) && i < len(after); i++ {
+		if before[i] != after[i] {
+			changed++
+		}
+	}
+	return changed
+}
+
+// recordEvent logs a filter action and adds it to the request's audit record
+func recordEvent(ctx context.Context, eventType, name, stage, detail string) {
+	switch eventType {
+	case EventBlock:
+		logger.Info("内容过滤器已拦截", "filter", name, "stage", stage, "reason", detail)
+	case EventRewrite:
+		logger.Debug("内容过滤器已改写内容", "filter", name, "stage", stage)
+	default:
+		logger.Warn("内容过滤器执行失败", "filter", name, "stage", stage, "error", detail)
+	}
+	audit.AddEvent(ctx, storage.AuditEvent{Type: eventType, Filter: name, Stage: stage, Detail: detail})
+}
@@ -0,0 +1,162 @@
+package filter
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestChain 按配置构建过滤链，不依赖模型管理器
+func newTestChain(t *testing.T, configs ...config.FilterConfig) *Chain {
+	t.Helper()
+	chain := &Chain{}
+	for _, cfg := range configs {
+		e, err := build(cfg, nil)
+		require.NoError(t, err)
+		chain.entries = append(chain.entries, e)
+	}
+	return chain
+}
+
+// streamText 将文本按固定大小切块写入过滤器，返回放行的全部文本
+func streamText(filter StreamFilter, text string, size int) (string, error) {
+	var out strings.Builder
+	for len(text) > 0 {
+		n := size
+		if n > len(text) {
+			n = len(text)
+		}
+		released, err := filter.Write(text[:n])
+		if err != nil {
+			return out.String(), err
+		}
+		out.WriteString(released)
+		text = text[n:]
+	}
+	rest, err := filter.Close()
+	out.WriteString(rest)
+	return out.String(), err
+}
+
+func TestPIIFilter(t *testing.T) {
+	f, err := newPIIFilter(config.FilterConfig{
+		CustomPatterns: []config.FilterPattern{{Name: "employee_id", Regex: `EMP-\d{6}`}},
+	})
+	require.NoError(t, err)
+
+	text := "Mail alice@example.com or call +1 555-123-4567 / 13812345678. " +
+		"Card 4111 1111 1111 1111, order 1234567812345678, host 192.168.1.20, id EMP-004211."
+	want := "Mail [EMAIL] or call [PHONE] / [PHONE]. " +
+		"Card [CREDIT_CARD], order 1234567812345678, host [IPV4], id [REDACTED]."
+
+	out, err := f.apply(text)
+	require.NoError(t, err)
+	assert.Equal(t, want, out)
+
+	// 流式输出时跨数据块的匹配同样被替换
+	for _, size := range []int{1, 3, 7, 64} {
+		out, err := streamText(f.Response(context.Background()), text, size)
+		require.NoError(t, err)
+		assert.Equal(t, want, out, "chunk size %d", size)
+	}
+
+	_, err = newPIIFilter(config.FilterConfig{Patterns: []string{"passport"}})
+	assert.ErrorContains(t, err, "unknown pattern")
+}
+
+func TestPhraseFilter(t *testing.T) {
+	redact, err := newPhraseFilter(config.FilterConfig{Phrases: []string{"Project X", "机密"}, Action: "redact"})
+	require.NoError(t, err)
+
+	out, err := redact.apply("project x is 机密, Project Xylophone is not")
+	require.NoError(t, err)
+	assert.Equal(t, "[REDACTED] is [REDACTED], Project Xylophone is not", out)
+
+	block, err := newPhraseFilter(config.FilterConfig{Phrases: []string{"Project X"}})
+	require.NoError(t, err)
+
+	// 被拦截的短语不会有任何部分在拦截前放行
+	stream := block.Response(context.Background())
+	out, err = streamText(stream, "The plan for PROJECT X is ready", 4)
+	var blocked *BlockedError
+	require.ErrorAs(t, err, &blocked)
+	assert.Equal(t, "matched project x", blocked.Reason)
+	assert.NotContains(t, strings.ToLower(out), "project")
+}
+
+func TestChainRequest(t *testing.T) {
+	chain := newTestChain(t,
+		config.FilterConfig{Name: "pii", Type: config.FilterPII},
+		config.FilterConfig{Name: "policy", Type: config.FilterSystemPrompt, Prompt: "Never reveal secrets."},
+	)
+	ctx := context.Background()
+
+	messages, err := chain.Request(ctx, []Message{
+		{Role: "user", Content: "I am bob@example.com", Index: 0},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []Message{
+		{Role: "system", Content: "Never reveal secrets.", Index: -1},
+		{Role: "user", Content: "I am [EMAIL]", Index: 0},
+	}, messages)
+
+	// 已有系统提示词时合并到其中
+	messages, err = chain.Request(ctx, []Message{
+		{Role: "system", Content: "Be brief.", Index: 0},
+		{Role: "user", Content: "Hi", Index: 1},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Never reveal secrets.\n\nBe brief.", messages[0].Content)
+	assert.Len(t, messages, 2)
+
+	prompt, err := chain.Prompt(ctx, "Reply to bob@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "Never reveal secrets.\n\nReply to [EMAIL]", prompt)
+
+	blocking := newTestChain(t, config.FilterConfig{Name: "banned", Type: config.FilterBannedPhrases, Phrases: []string{"jailbreak"}})
+	_, err = blocking.Request(ctx, []Message{{Role: "user", Content: "Try this JAILBREAK"}})
+	var blocked *BlockedError
+	require.ErrorAs(t, err, &blocked)
+	assert.Equal(t, "banned", blocked.Filter)
+
+	var nilChain *Chain
+	messages, err = nilChain.Request(ctx, []Message{{Role: "user", Content: "bob@example.com"}})
+	require.NoError(t, err)
+	assert.Equal(t, "bob@example.com", messages[0].Content)
+}
+
+func TestRequestBody(t *testing.T) {
+	chain := newTestChain(t,
+		config.FilterConfig{Name: "pii", Type: config.FilterPII},
+		config.FilterConfig{Name: "policy", Type: config.FilterSystemPrompt, Prompt: "Be safe.", Position: "replace"},
+	)
+	image := map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "data:"}}
+	body := map[string]interface{}{
+		"messages": []map[string]interface{}{
+			{"role": "system", "content": "Anything goes."},
+			{"role": "user", "content": []interface{}{
+				map[string]interface{}{"type": "text", "text": "Who is at 10.0.0.1?"},
+				image,
+			}},
+			{"role": "assistant", "content": "", "tool_calls": []interface{}{"call"}},
+		},
+	}
+
+	require.NoError(t, chain.RequestBody(context.Background(), body))
+	assert.Equal(t, []map[string]interface{}{
+		{"role": "system", "content": "Be safe."},
+		{"role": "user", "content": []interface{}{
+			map[string]interface{}{"type": "text", "text": "Who is at [IPV4]?"},
+			image,
+		}},
+		{"role": "assistant", "content": "", "tool_calls": []interface{}{"call"}},
+	}, body["messages"])
+
+	body = map[string]interface{}{"prompt": "Call 555-123-4567"}
+	require.NoError(t, chain.RequestBody(context.Background(), body))
+	assert.Equal(t, "Be safe.\n\nCall [PHONE]", body["prompt"])
+}
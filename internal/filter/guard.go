@@ -0,0 +1,223 @@
+package filter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
+)
+
+const (
+	// DefaultGuardWindow is the number of streamed characters classified at a time
+	DefaultGuardWindow = 400
+
+	// guardTimeout 单次分类请求的最长时间
+	guardTimeout = 30 * time.Second
+
+	// guardMaxTokens 分类结果的最大 token 数，安全模型通常只返回 safe/unsafe 和类别
+	guardMaxTokens = 32
+)
+
+// guardClient 调用安全模型的 HTTP 客户端
+var guardClient = &http.Client{Timeout: guardTimeout, Transport: tracing.NewTransport(nil, "llama-server")}
+
+// guard classifies text with a guard model, such as Llama Guard, and blocks
+// text the model flags. Requests are judged by their last user message and
+// responses by each new window of text after the end of the previous one.
+type guard struct {
+	classify   func(ctx context.Context, text string) (string, error)
+	blockOn    []string
+	window     int
+	failClosed bool
+}
+
+func newGuard(cfg config.FilterConfig, modelMgr *model.Manager) *guard {
+	g := &guard{
+		classify:   (&guardModel{modelMgr: modelMgr, model: cfg.Model, prompt: cfg.Prompt}).classify,
+		blockOn:    cfg.BlockOn,
+		window:     cfg.WindowChars,
+		failClosed: cfg.FailClosed,
+	}
+	if len(g.blockOn) == 0 {
+		g.blockOn = []string{"unsafe"}
+	}
+	if g.window <= 0 {
+		g.window = DefaultGuardWindow
+	}
+	return g
+}
+
+// check classifies text; a nil error means the text may be released
+func (g *guard) check(ctx context.Context, text string) error {
+	verdict, err := g.classify(ctx, text)
+	if err != nil {
+		if g.failClosed {
+			return &BlockedError{Reason: "guard model unavailable: " + err.Error()}
+		}
+		return err
+	}
+	lower := strings.ToLower(verdict)
+	for _, keyword := range g.blockOn {
+		if strings.Contains(lower, strings.ToLower(keyword)) {
+			return &BlockedError{Reason: strings.Join(strings.Fields(verdict), " ")}
+		}
+	}
+	return nil
+}
+
+// Request classifies the last user message
+func (g *guard) Request(ctx context.Context, messages []Message) ([]Message, error) {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			if err := g.check(ctx, messages[i].Content); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return messages, nil
+}
+
+// Response starts classifying one generated text
+func (g *guard) Response(ctx context.Context) StreamFilter {
+	return &guardStream{guard: g, ctx: ctx}
+}
+
+// guardStream holds generated text back until a window of it has been
+// classified together with the window of text released before it
+type guardStream struct {
+	*guard
+	ctx     context.Context
+	context string // 最近放行的最多 window 个字符，与待分类文本一起发送以识别跨窗口的内容
+	pending strings.Builder
+}
+
+func (s *guardStream) Write(text string) (string, error) {
+	s.pending.WriteString(text)
+	if len([]rune(s.pending.String())) < s.window {
+		return "", nil
+	}
+	return s.release()
+}
+
+func (s *guardStream) Close() (string, error) {
+	if s.pending.Len() == 0 {
+		return "", nil
+	}
+	return s.release()
+}
+
+// release classifies the pending text after the last released window and
+// releases it. When the guard model fails open the text is released with
+// the error; with fail_closed the error blocks the rest of the response.
+func (s *guardStream) release() (string, error) {
+	pending := s.pending.String()
+	err := s.check(s.ctx, s.context+pending)
+	if IsBlocked(err) {
+		return "", err
+	}
+	s.context = lastChars(s.context+pending, s.window)
+	s.pending.Reset()
+	return pending, err
+}
+
+// lastChars returns the last n characters of text
+func lastChars(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return string(runes[len(runes)-n:])
+}
+
+// guardModel sends text to a loaded guard model for classification
+type guardModel struct {
+	modelMgr *model.Manager
+	model    string
+	prompt   string // 含 {{text}} 时替换为待分类文本，否则作为系统提示词
+}
+
+func (m *guardModel) classify(ctx context.Context, text string) (string, error) {
+	resolved, exists := m.modelMgr.ResolveModel(m.model)
+	if !exists {
+		return "", fmt.Errorf("guard model not found: %s", m.model)
+	}
+	instanceID := m.modelMgr.PickReplica(resolved.ID, "")
+	status, exists := m.modelMgr.GetStatus(instanceID)
+	if !exists || status.State != model.StateLoaded || status.Port == 0 {
+		return "", fmt.Errorf("guard model not loaded: %s", m.model)
+	}
+
+	done, err := m.modelMgr.AcquireSlot(ctx, instanceID)
+	if err != nil {
+		return "", err
+	}
+	defer done()
+
+	ctx, cancel := context.WithTimeout(ctx, guardTimeout)
+	defer cancel()
+	return postClassify(ctx, fmt.Sprintf("http://127.0.0.1:%d/v1/chat/completions", status.Port), guardMessages(m.prompt, text))
+}
+
+// guardMessages builds the classification conversation. Without a prompt
+// the text is sent alone so the guard model's own chat template applies.
+func guardMessages(prompt, text string) []map[string]string {
+	switch {
+	case prompt == "":
+		return []map[string]string{{"role": "user", "content": text}}
+	case strings.Contains(prompt, "{{text}}"):
+		return []map[string]string{{"role": "user", "content": strings.ReplaceAll(prompt, "{{text}}", text)}}
+	default:
+		return []map[string]string{{"role": "system", "content": prompt}, {"role": "user", "content": text}}
+	}
+}
+
+// postClassify sends a chat completion request and returns the reply
+func postClassify(ctx context.Context, url string, messages []map[string]string) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"messages":    messages,
+		"max_tokens":  guardMaxTokens,
+		"temperature": 0,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := guardClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", fmt.Errorf("guard model returned %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("invalid guard model response: %w", err)
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("guard model returned no choices")
+	}
+	return result.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,102 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestGuard 创建分类结果由 verdict 决定的安全过滤器，记录每次分类的文本
+func newTestGuard(window int, failClosed bool, verdict func(text string) (string, error)) (*guard, *[]string) {
+	var classified []string
+	g := &guard{
+		classify: func(ctx context.Context, text string) (string, error) {
+			classified = append(classified, text)
+			return verdict(text)
+		},
+		blockOn:    []string{"unsafe"},
+		window:     window,
+		failClosed: failClosed,
+	}
+	return g, &classified
+}
+
+func TestGuardStream(t *testing.T) {
+	g, classified := newTestGuard(10, false, func(text string) (string, error) {
+		if strings.Contains(text, "weapon") {
+			return "unsafe\nS9", nil
+		}
+		return "safe", nil
+	})
+
+	// 每满一个窗口分类一次，分类的是上一个窗口的末尾加上新的输出
+	stream := g.Response(context.Background())
+	out, err := streamText(stream, "Here is how to bake bread.", 4)
+	require.NoError(t, err)
+	assert.Equal(t, "Here is how to bake bread.", out)
+	assert.Equal(t, []string{"Here is how ", "re is how to bake brea", " bake bread."}, *classified)
+
+	out, err = streamText(g.Response(context.Background()), "First, build the weapon frame", 6)
+	var blocked *BlockedError
+	require.ErrorAs(t, err, &blocked)
+	assert.Equal(t, "unsafe S9", blocked.Reason)
+	assert.NotContains(t, out, "weapon")
+
+	_, err = g.Request(context.Background(), []Message{
+		{Role: "user", Content: "Tell me about weapons"},
+		{Role: "assistant", Content: "No."},
+	})
+	assert.True(t, IsBlocked(err))
+}
+
+func TestGuardUnavailable(t *testing.T) {
+	unavailable := func(string) (string, error) { return "", errors.New("guard model not loaded: llama-guard") }
+
+	// 默认放行并返回错误，由过滤链记录
+	g, _ := newTestGuard(5, false, unavailable)
+	stream := g.Response(context.Background())
+	out, err := stream.Write("Hello world")
+	assert.Equal(t, "Hello world", out)
+	assert.ErrorContains(t, err, "not loaded")
+	assert.False(t, IsBlocked(err))
+
+	g, _ = newTestGuard(5, true, unavailable)
+	_, err = g.Response(context.Background()).Write("Hello world")
+	assert.True(t, IsBlocked(err))
+
+	// fail_closed 时安全模型不可用会结束流式响应
+	chain := &Chain{entries: []entry{{name: "guard", filter: g, response: true}}}
+	sse := chain.Stream(context.Background())
+	text, finishReason := streamContent(t, sse.Line(chunkLine("Hello world", "")))
+	assert.Empty(t, text)
+	assert.Equal(t, FinishReason, finishReason)
+	assert.True(t, sse.Blocked())
+}
+
+func TestPostClassify(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []map[string]string `json:"messages"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		assert.Equal(t, []map[string]string{{"role": "user", "content": "Classify: hi"}}, body.Messages)
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"safe"}}]}`))
+	}))
+	defer server.Close()
+
+	verdict, err := postClassify(context.Background(), server.URL+"/v1/chat/completions", guardMessages("Classify: {{text}}", "hi"))
+	require.NoError(t, err)
+	assert.Equal(t, "safe", verdict)
+
+	assert.Equal(t, []map[string]string{{"role": "system", "content": "Be strict."}, {"role": "user", "content": "hi"}},
+		guardMessages("Be strict.", "hi"))
+	assert.Equal(t, []map[string]string{{"role": "user", "content": "hi"}}, guardMessages("", "hi"))
+}
@@ -0,0 +1,128 @@
+package filter
+
+import (
+	"context"
+	"strings"
+)
+
+// RequestBody runs the request filters on an OpenAI format request body in
+// place: its messages, or the prompt of a text completion
+func (c *Chain) RequestBody(ctx context.Context, body map[string]interface{}) error {
+	if c.Empty() {
+		return nil
+	}
+	if prompt, ok := body["prompt"].(string); ok {
+		filtered, err := c.Prompt(ctx, prompt)
+		if err != nil {
+			return err
+		}
+		body["prompt"] = filtered
+	}
+
+	var messages []map[string]interface{}
+	switch v := body["messages"].(type) {
+	case []map[string]interface{}:
+		messages = v
+	case []interface{}:
+		for _, item := range v {
+			if msg, ok := item.(map[string]interface{}); ok {
+				messages = append(messages, msg)
+			}
+		}
+	default:
+		return nil
+	}
+
+	filtered, err := c.Request(ctx, FromOpenAI(messages))
+	if err != nil {
+		return err
+	}
+	body["messages"] = ToOpenAI(messages, filtered)
+	return nil
+}
+
+// FromOpenAI returns the text of OpenAI format messages. Text parts of array
+// content are joined with newlines.
+func FromOpenAI(messages []map[string]interface{}) []Message {
+	converted := make([]Message, len(messages))
+	for i, msg := range messages {
+		role, _ := msg["role"].(string)
+		converted[i] = Message{Role: role, Content: contentText(msg["content"]), Index: i}
+	}
+	return converted
+}
+
+// ToOpenAI builds the filtered OpenAI format messages. Messages taken from
+// the original keep their other fields; rewritten array content keeps its
+// non-text parts after a single text part.
+func ToOpenAI(original []map[string]interface{}, filtered []Message) []map[string]interface{} {
+	messages := make([]map[string]interface{}, 0, len(filtered))
+	for _, msg := range filtered {
+		if msg.Index < 0 || msg.Index >= len(original) {
+			messages = append(messages, map[string]interface{}{"role": msg.Role, "content": msg.Content})
+			continue
+		}
+
+		orig := original[msg.Index]
+		if orig["role"] == msg.Role && contentText(orig["content"]) == msg.Content {
+			messages = append(messages, orig)
+			continue
+		}
+		converted := make(map[string]interface{}, len(orig))
+		for key, value := range orig {
+			converted[key] = value
+		}
+		converted["role"] = msg.Role
+		converted["content"] = replaceText(orig["content"], msg.Content)
+		messages = append(messages, converted)
+	}
+	return messages
+}
+
+// contentText returns the text of string or array message content
+func contentText(content interface{}) string {
+	var parts []string
+	switch v := content.(type) {
+	case string:
+		return v
+	case []interface{}:
+		for _, part := range v {
+			if p, ok := part.(map[string]interface{}); ok {
+				if text, ok := p["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+	case []map[string]interface{}:
+		for _, p := range v {
+			if text, ok := p["text"].(string); ok {
+				parts = append(parts, text)
+			}
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+// replaceText replaces the text of message content, keeping image parts
+func replaceText(content interface{}, text string) interface{} {
+	var others []interface{}
+	switch v := content.(type) {
+	case []interface{}:
+		for _, part := range v {
+			if p, ok := part.(map[string]interface{}); ok && p["type"] == "text" {
+				continue
+			}
+			others = append(others, part)
+		}
+	case []map[string]interface{}:
+		for _, p := range v {
+			if p["type"] != "text" {
+				others = append(others, p)
+			}
+		}
+	default:
+		return text
+	}
+	parts := []interface{}{map[string]interface{}{"type": "text", "text": text}}
+	return append(parts, others...)
+}
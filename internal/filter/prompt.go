@@ -0,0 +1,48 @@
+package filter
+
+import (
+	"context"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+)
+
+// systemPrompt injects a system prompt into every request
+type systemPrompt struct {
+	prompt   string
+	position string // prepend、append 或 replace
+}
+
+func newSystemPrompt(cfg config.FilterConfig) *systemPrompt {
+	position := cfg.Position
+	if position == "" {
+		position = "prepend"
+	}
+	return &systemPrompt{prompt: cfg.Prompt, position: position}
+}
+
+// Request merges the prompt into the first system message, or inserts a
+// system message at the start when there is none
+func (p *systemPrompt) Request(ctx context.Context, messages []Message) ([]Message, error) {
+	filtered := make([]Message, 0, len(messages)+1)
+	filtered = append(filtered, messages...)
+
+	if len(filtered) == 0 || filtered[0].Role != "system" {
+		return append([]Message{{Role: "system", Content: p.prompt, Index: -1}}, filtered...), nil
+	}
+
+	system := &filtered[0]
+	switch {
+	case p.position == "replace" || system.Content == "":
+		system.Content = p.prompt
+	case p.position == "append":
+		system.Content += "\n\n" + p.prompt
+	default:
+		system.Content = p.prompt + "\n\n" + system.Content
+	}
+	return filtered, nil
+}
+
+// Response does not inspect responses
+func (p *systemPrompt) Response(ctx context.Context) StreamFilter {
+	return nil
+}
@@ -0,0 +1,257 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+)
+
+// DefaultReplacement replaces text matched by a rule without its own replacement
+const DefaultReplacement = "[REDACTED]"
+
+// piiHoldback 流式输出时为跨数据块的匹配保留的最大字节数，更长的个人信息可能漏检
+const piiHoldback = 64
+
+// builtinPatterns 内置的个人信息规则
+var builtinPatterns = map[string]rule{
+	"email":       {name: "email", pattern: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), replacement: "[EMAIL]"},
+	"phone":       {name: "phone", pattern: regexp.MustCompile(`(?:\+\d{1,3}[ \-]?)?(?:\(\d{2,4}\)[ \-]?|\b\d{2,4}[ \-])\d{3,4}[ \-]?\d{4}\b|\b1[3-9]\d{9}\b`), replacement: "[PHONE]"},
+	"credit_card": {name: "credit_card", pattern: regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`), replacement: "[CREDIT_CARD]", valid: luhnValid},
+	"ipv4":        {name: "ipv4", pattern: regexp.MustCompile(`\b(?:(?:25[0-5]|2[0-4]\d|1?\d?\d)\.){3}(?:25[0-5]|2[0-4]\d|1?\d?\d)\b`), replacement: "[IPV4]"},
+}
+
+// builtinOrder 内置规则的匹配顺序，较长的数字串优先识别为卡号
+var builtinOrder = []string{"email", "credit_card", "ipv4", "phone"}
+
+// rule replaces or blocks the text matching a pattern
+type rule struct {
+	name        string
+	pattern     *regexp.Regexp
+	replacement string
+	valid       func(string) bool // 进一步校验匹配的文本，为 nil 时不校验
+}
+
+// match is a rule match in a text
+type match struct {
+	start, end int
+	rule       *rule
+}
+
+// redactor rewrites or blocks the text matching its rules. It is used for
+// personal information and banned phrases.
+type redactor struct {
+	rules    []rule
+	block    bool // 命中即拦截，不替换
+	holdback int  // 流式输出时保留的字节数，须不短于最长的匹配
+}
+
+// newPIIFilter creates a filter redacting the built-in and custom patterns
+func newPIIFilter(cfg config.FilterConfig) (*redactor, error) {
+	names := cfg.Patterns
+	if len(names) == 0 {
+		names = builtinOrder
+	}
+
+	r := &redactor{holdback: piiHoldback}
+	for _, name := range names {
+		builtin, exists := builtinPatterns[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown pattern: %s", name)
+		}
+		r.rules = append(r.rules, builtin)
+	}
+	for _, custom := range cfg.CustomPatterns {
+		pattern, err := regexp.Compile(custom.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", custom.Name, err)
+		}
+		replacement := custom.Replacement
+		if replacement == "" {
+			replacement = DefaultReplacement
+		}
+		r.rules = append(r.rules, rule{name: custom.Name, pattern: pattern, replacement: replacement})
+	}
+	return r, nil
+}
+
+// newPhraseFilter creates a filter blocking or redacting phrases, ignoring
+// case. Phrases starting or ending with a letter or digit only match whole words.
+func newPhraseFilter(cfg config.FilterConfig) (*redactor, error) {
+	r := &redactor{block: cfg.Action == "" || cfg.Action == "block"}
+	for _, phrase := range cfg.Phrases {
+		if strings.TrimSpace(phrase) == "" {
+			continue
+		}
+		expr := regexp.QuoteMeta(phrase)
+		if isWordByte(phrase[0]) {
+			expr = `\b` + expr
+		}
+		if isWordByte(phrase[len(phrase)-1]) {
+			expr += `\b`
+		}
+		pattern, err := regexp.Compile("(?i)" + expr)
+		if err != nil {
+			return nil, err
+		}
+		r.rules = append(r.rules, rule{name: phrase, pattern: pattern, replacement: DefaultReplacement})
+		// 多保留一个字节用于判断词边界
+		if len(phrase)+1 > r.holdback {
+			r.holdback = len(phrase) + 1
+		}
+	}
+	if len(r.rules) == 0 {
+		return nil, fmt.Errorf("no phrases")
+	}
+	return r, nil
+}
+
+// luhnValid checks the Luhn checksum of a card number, ignoring separators
+func luhnValid(number string) bool {
+	sum, double := 0, false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		digit := int(c - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+func isWordByte(b byte) bool {
+	return b == '_' || b >= '0' && b <= '9' || b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z'
+}
+
+// Request rewrites or blocks the content of each message
+func (r *redactor) Request(ctx context.Context, messages []Message) ([]Message, error) {
+	filtered := make([]Message, len(messages))
+	for i, msg := range messages {
+		content, err := r.apply(msg.Content)
+		if err != nil {
+			return nil, err
+		}
+		msg.Content = content
+		filtered[i] = msg
+	}
+	return filtered, nil
+}
+
+// Response starts redacting one generated text
+func (r *redactor) Response(ctx context.Context) StreamFilter {
+	return &redactStream{redactor: r}
+}
+
+// matches returns the non-overlapping matches of all rules in text, leftmost first
+func (r *redactor) matches(text string) []match {
+	var all []match
+	for i := range r.rules {
+		for _, loc := range r.rules[i].pattern.FindAllStringIndex(text, -1) {
+			if loc[1] > loc[0] && (r.rules[i].valid == nil || r.rules[i].valid(text[loc[0]:loc[1]])) {
+				all = append(all, match{start: loc[0], end: loc[1], rule: &r.rules[i]})
+			}
+		}
+	}
+	// 起点相同时先列出的规则优先
+	sort.SliceStable(all, func(i, j int) bool { return all[i].start < all[j].start })
+
+	var matches []match
+	end := 0
+	for _, m := range all {
+		if m.start >= end {
+			matches = append(matches, m)
+			end = m.end
+		}
+	}
+	return matches
+}
+
+// apply rewrites a complete text, or blocks it when the redactor blocks
+func (r *redactor) apply(text string) (string, error) {
+	return r.replace(text, r.matches(text))
+}
+
+func (r *redactor) replace(text string, matches []match) (string, error) {
+	if len(matches) == 0 {
+		return text, nil
+	}
+	if r.block {
+		return "", &BlockedError{Reason: "matched " + strings.ToLower(text[matches[0].start:matches[0].end])}
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(text[last:m.start])
+		b.WriteString(m.rule.replacement)
+		last = m.end
+	}
+	b.WriteString(text[last:])
+	return b.String(), nil
+}
+
+// redactStream holds back the end of the text so a match split across
+// chunks is still found
+type redactStream struct {
+	*redactor
+	pending string
+}
+
+func (s *redactStream) Write(text string) (string, error) {
+	s.pending += text
+	matches := s.matches(s.pending)
+	if s.block {
+		// 拦截时不等待保留的文本，除非匹配在末尾且词边界未定
+		for _, m := range matches {
+			if m.end < len(s.pending) || !isWordByte(s.pending[m.end-1]) {
+				return s.replace(s.pending, []match{m})
+			}
+		}
+	}
+
+	cut := len(s.pending) - s.holdback
+	if cut <= 0 {
+		return "", nil
+	}
+
+	// 跨越保留边界的匹配整体保留，等待后续文本
+	released := matches[:0]
+	for _, m := range matches {
+		if m.end <= cut {
+			released = append(released, m)
+			continue
+		}
+		if m.start < cut {
+			cut = m.start
+		}
+		break
+	}
+	for cut > 0 && !utf8.RuneStart(s.pending[cut]) {
+		cut--
+	}
+
+	out, err := s.replace(s.pending[:cut], released)
+	if err != nil {
+		return "", err
+	}
+	s.pending = s.pending[cut:]
+	return out, nil
+}
+
+func (s *redactStream) Close() (string, error) {
+	out, err := s.apply(s.pending)
+	s.pending = ""
+	return out, err
+}
@@ -0,0 +1,207 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/auth"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+)
+
+// Registry builds the filter chain of each request from gateway.filters.
+// Filters are enabled by the virtual model a request names and by its API
+// key; virtual model filters run first. A nil *Registry filters nothing.
+type Registry struct {
+	configMgr *config.Manager
+	modelMgr  *model.Manager
+
+	mu    sync.Mutex
+	built map[string]builtFilter // 按名称缓存已构建的过滤器，配置变化时重建
+}
+
+// builtFilter is a filter built from a configuration
+type builtFilter struct {
+	config string // 构建时配置的 JSON
+	entry  entry
+}
+
+// NewRegistry creates a registry reading filters from configMgr. modelMgr
+// resolves virtual models and serves guard filters.
+func NewRegistry(configMgr *config.Manager, modelMgr *model.Manager) *Registry {
+	return &Registry{configMgr: configMgr, modelMgr: modelMgr, built: make(map[string]builtFilter)}
+}
+
+// Chain returns the filters of a request for modelName, the model name the
+// client sent. It is nil when no filter applies.
+func (r *Registry) Chain(c *gin.Context, modelName string) *Chain {
+	if r == nil || r.configMgr == nil {
+		return nil
+	}
+	configs := r.configMgr.Get().Gateway.Filters
+	if len(configs) == 0 {
+		return nil
+	}
+
+	var names []string
+	served := []string{modelName}
+	if vm, ok := r.modelMgr.VirtualModel(modelName); ok {
+		names = append(names, vm.Filters...)
+		served = vm.Models
+	}
+	if key, ok := auth.FromContext(c); ok {
+		names = append(names, key.Filters...)
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	chain := &Chain{}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		cfg := findConfig(configs, name)
+		if cfg == nil {
+			logger.Warn("跳过无法使用的内容过滤器", "filter", name, "error", "filter not defined in gateway.filters")
+			continue
+		}
+		// 分类请求要等待请求本身占用的槽位，安全模型不能是提供服务的模型或其副本。
+		// 此时拦截请求，不能跳过过滤器放行未经分类的内容
+		if cfg.Type == config.FilterGuard && r.servesWith(served, cfg.Model) {
+			logger.Warn("安全模型与请求模型相同，内容过滤器拦截请求", "filter", name, "model", cfg.Model)
+			chain.entries = append(chain.entries, entry{
+				name:     name,
+				filter:   rejectFilter{reason: "guard model " + cfg.Model + " cannot classify its own requests"},
+				request:  true,
+				response: true,
+			})
+			continue
+		}
+		e, err := r.filter(*cfg)
+		if err != nil {
+			logger.Warn("跳过无法使用的内容过滤器", "filter", name, "error", err)
+			continue
+		}
+		chain.entries = append(chain.entries, e)
+	}
+	if len(chain.entries) == 0 {
+		return nil
+	}
+	return chain
+}
+
+// findConfig returns the filter named name in configs, nil if undefined
+func findConfig(configs []config.FilterConfig, name string) *config.FilterConfig {
+	for i := range configs {
+		if configs[i].Name == name {
+			return &configs[i]
+		}
+	}
+	return nil
+}
+
+// servesWith reports whether guardModel resolves to one of the models that
+// may serve the request
+func (r *Registry) servesWith(served []string, guardModel string) bool {
+	guard, ok := r.modelMgr.ResolveModel(guardModel)
+	if !ok {
+		return false
+	}
+	for _, name := range served {
+		// 请求可以直接指定命名副本的实例 ID
+		if status, ok := r.modelMgr.GetStatus(name); ok && status.ModelID == guard.ID {
+			return true
+		}
+		if m, ok := r.modelMgr.ResolveModel(name); ok && m.ID == guard.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectFilter blocks every request and response. It stands in for a filter
+// that cannot run for a request, so the request fails closed.
+type rejectFilter struct {
+	reason string
+}
+
+func (f rejectFilter) Request(ctx context.Context, messages []Message) ([]Message, error) {
+	return nil, &BlockedError{Reason: f.reason}
+}
+
+func (f rejectFilter) Response(ctx context.Context) StreamFilter {
+	return f
+}
+
+func (f rejectFilter) Write(text string) (string, error) {
+	return "", &BlockedError{Reason: f.reason}
+}
+
+func (f rejectFilter) Close() (string, error) {
+	return "", &BlockedError{Reason: f.reason}
+}
+
+// filter returns the filter built from cfg, rebuilding it when its
+// configuration changed
+func (r *Registry) filter(cfg config.FilterConfig) (entry, error) {
+	name := cfg.Name
+	data, _ := json.Marshal(cfg)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if built, exists := r.built[name]; exists && built.config == string(data) {
+		return built.entry, nil
+	}
+	e, err := build(cfg, r.modelMgr)
+	if err != nil {
+		return entry{}, err
+	}
+	r.built[name] = builtFilter{config: string(data), entry: e}
+	return e, nil
+}
+
+// build creates a filter from its configuration together with the stages
+// it applies to
+func build(cfg config.FilterConfig, modelMgr *model.Manager) (entry, error) {
+	e := entry{name: cfg.Name}
+	defaultApply := config.FilterApplyBoth
+
+	switch cfg.Type {
+	case config.FilterPII:
+		f, err := newPIIFilter(cfg)
+		if err != nil {
+			return entry{}, err
+		}
+		e.filter = f
+	case config.FilterBannedPhrases:
+		f, err := newPhraseFilter(cfg)
+		if err != nil {
+			return entry{}, err
+		}
+		e.filter = f
+	case config.FilterSystemPrompt:
+		e.filter = newSystemPrompt(cfg)
+		defaultApply = config.FilterApplyRequest
+	case config.FilterGuard:
+		e.filter = newGuard(cfg, modelMgr)
+		defaultApply = config.FilterApplyResponse
+	default:
+		return entry{}, fmt.Errorf("unknown filter type: %s", cfg.Type)
+	}
+
+	apply := cfg.Apply
+	if apply == "" {
+		apply = defaultApply
+	}
+	e.request = apply == config.FilterApplyRequest || apply == config.FilterApplyBoth
+	e.response = apply == config.FilterApplyResponse || apply == config.FilterApplyBoth
+	return e, nil
+}
@@ -0,0 +1,153 @@
+package filter
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/auth"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/cluster/routing"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/pki"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chainNames 返回过滤链中过滤器的名称
+func chainNames(chain *Chain) []string {
+	if chain == nil {
+		return nil
+	}
+	names := make([]string, 0, len(chain.entries))
+	for _, e := range chain.entries {
+		names = append(names, e.name)
+	}
+	return names
+}
+
+func TestRegistryChain(t *testing.T) {
+	store, err := storage.NewMemoryStore()
+	require.NoError(t, err)
+
+	cfg := config.DefaultConfig()
+	cfg.Security = config.SecurityConfig{APIKeyEnabled: true}
+	cfg.Gateway.Filters = []config.FilterConfig{
+		{Name: "pii", Type: config.FilterPII},
+		{Name: "policy", Type: config.FilterSystemPrompt, Prompt: "Be safe."},
+	}
+	cfg.Gateway.VirtualModels = []config.VirtualModelConfig{{Name: "safe-chat", Models: []string{"qwen"}, Filters: []string{"pii"}}}
+	configMgr := config.NewManagerWithPath("standalone", filepath.Join(t.TempDir(), "server.config.yaml"))
+	require.NoError(t, configMgr.Save(cfg))
+
+	secret, key, err := auth.GenerateKey()
+	require.NoError(t, err)
+	key.Scopes = []string{auth.ScopeInference}
+	key.Filters = []string{"policy", "pii", "missing"}
+	require.NoError(t, store.CreateAPIKey(context.Background(), key))
+
+	registry := NewRegistry(configMgr, model.NewManager(cfg, configMgr, process.NewManager()))
+	chainFor := func(modelName, bearer string) *Chain {
+		var chain *Chain
+		gin.SetMode(gin.TestMode)
+		engine := gin.New()
+		engine.POST("/v1/chat/completions", auth.NewAuthenticator(store, configMgr).Require(auth.ScopeInference), func(c *gin.Context) {
+			chain = registry.Chain(c, modelName)
+			c.Status(http.StatusOK)
+		})
+		req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		return chain
+	}
+
+	// 虚拟模型的过滤器在前，重复的和未定义的过滤器被跳过
+	assert.Equal(t, []string{"pii", "policy"}, chainNames(chainFor("safe-chat", secret)))
+	assert.Equal(t, []string{"policy", "pii"}, chainNames(chainFor("qwen", secret)))
+
+	// 配置未变化时复用已构建的过滤器
+	first := chainFor("qwen", secret)
+	assert.Same(t, first.entries[0].filter, chainFor("qwen", secret).entries[0].filter)
+
+	// Master 转发的请求没有密钥，使用随请求转发的密钥过滤器
+	dir := t.TempDir()
+	authority, err := pki.LoadOrCreateAuthority(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"), 0)
+	require.NoError(t, err)
+	master, err := authority.Issue("master-1", nil)
+	require.NoError(t, err)
+
+	var routed *Chain
+	engine := gin.New()
+	engine.Use(routing.TrustMaster())
+	engine.POST("/v1/chat/completions", auth.NewAuthenticator(store, configMgr).Require(auth.ScopeInference), func(c *gin.Context) {
+		routed = registry.Chain(c, "safe-chat")
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	req.Header.Set(routing.RoutedHeader, "master-1")
+	req.Header.Set(routing.KeyHeader, `{"id":"`+key.ID+`","filters":["policy"]}`)
+	req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{master.Leaf}}}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"pii", "policy"}, chainNames(routed))
+
+	var nilRegistry *Registry
+	assert.Nil(t, nilRegistry.Chain(nil, "safe-chat"))
+}
+
+// writeModel 写入一个最小的 GGUF 文件，模型名称默认为文件名
+func writeModel(t *testing.T, dir, name string) {
+	t.Helper()
+	header := []byte{'G', 'G', 'U', 'F', 3, 0, 0, 0}
+	data := append(header, make([]byte, 2048-len(header))...)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".gguf"), data, 0644))
+}
+
+func TestRegistryChainRejectsServingGuard(t *testing.T) {
+	dir := t.TempDir()
+	writeModel(t, dir, "chat-model")
+	writeModel(t, dir, "guard-model")
+
+	cfg := config.DefaultConfig()
+	cfg.Model.Paths = []string{dir}
+	cfg.Gateway.Filters = []config.FilterConfig{{Name: "guard", Type: config.FilterGuard, Model: "guard-model"}}
+	cfg.Gateway.VirtualModels = []config.VirtualModelConfig{
+		{Name: "guarded", Models: []string{"chat-model"}, Filters: []string{"guard"}},
+		{Name: "self-guarded", Models: []string{"chat-model", "guard-model"}, Filters: []string{"guard"}},
+	}
+	configMgr := config.NewManagerWithPath("standalone", filepath.Join(t.TempDir(), "server.config.yaml"))
+	require.NoError(t, configMgr.Save(cfg))
+
+	modelMgr := model.NewManager(cfg, configMgr, process.NewManager())
+	_, err := modelMgr.Scan(context.Background())
+	require.NoError(t, err)
+	_, ok := modelMgr.ResolveModel("guard-model")
+	require.True(t, ok)
+
+	registry := NewRegistry(configMgr, modelMgr)
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+
+	assert.Equal(t, []string{"guard"}, chainNames(registry.Chain(c, "guarded")))
+
+	// 安全模型是候选模型之一时，分类请求会等待请求本身占用的槽位，请求和响应都被拦截
+	chain := registry.Chain(c, "self-guarded")
+	assert.Equal(t, []string{"guard"}, chainNames(chain))
+	_, err = chain.Request(context.Background(), []Message{{Role: "user", Content: "Hello"}})
+	var blocked *BlockedError
+	require.ErrorAs(t, err, &blocked)
+	assert.Equal(t, "guard", blocked.Filter)
+	assert.JSONEq(t, `{"choices":[{"index":0,"message":{"role":"assistant","content":""},"finish_reason":"content_filter"}]}`,
+		string(chain.Body(context.Background(), []byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"Hi"},"finish_reason":"stop"}]}`))))
+}
@@ -0,0 +1,297 @@
+package filter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// stage is one response filter working on one generated text
+type stage struct {
+	name    string
+	filter  StreamFilter
+	in, out strings.Builder // 过滤前后的全部文本，用于判断是否改写
+	failed  bool            // 已记录执行失败事件
+}
+
+// textFilter runs the response filters of a chain on one generated text
+type textFilter struct {
+	ctx    context.Context
+	stages []*stage
+}
+
+// textFilter returns a filter for one generated text; nil when no filter
+// of the chain inspects responses
+func (c *Chain) textFilter(ctx context.Context) *textFilter {
+	if c.Empty() {
+		return nil
+	}
+	t := &textFilter{ctx: ctx}
+	for _, e := range c.entries {
+		if !e.response {
+			continue
+		}
+		if sf := e.filter.Response(ctx); sf != nil {
+			t.stages = append(t.stages, &stage{name: e.name, filter: sf})
+		}
+	}
+	if len(t.stages) == 0 {
+		return nil
+	}
+	return t
+}
+
+// write passes text through all filters and returns the text that may be released
+func (t *textFilter) write(text string) (string, error) {
+	for _, st := range t.stages {
+		if text == "" {
+			return "", nil
+		}
+		out, err := st.filter.Write(text)
+		if out, err = t.result(st, text, out, err); err != nil {
+			return "", err
+		}
+		text = out
+	}
+	return text, nil
+}
+
+// close releases the text held back by the filters, passing the text
+// released by each filter through the ones after it
+func (t *textFilter) close() (string, error) {
+	text := ""
+	for _, st := range t.stages {
+		released := ""
+		if text != "" {
+			out, err := st.filter.Write(text)
+			if out, err = t.result(st, text, out, err); err != nil {
+				return "", err
+			}
+			released = out
+		}
+		out, err := st.filter.Close()
+		if out, err = t.result(st, "", out, err); err != nil {
+			return "", err
+		}
+		text = released + out
+
+		if st.in.String() != st.out.String() {
+			recordEvent(t.ctx, EventRewrite, st.name, StageResponse, "")
+		}
+	}
+	return text, nil
+}
+
+// result records the outcome of one filter call. Errors other than blocks
+// are recorded once per filter and the returned text is used.
+func (t *textFilter) result(st *stage, in, out string, err error) (string, error) {
+	var blocked *BlockedError
+	if errors.As(err, &blocked) {
+		blocked.Filter = st.name
+		recordEvent(t.ctx, EventBlock, st.name, StageResponse, blocked.Reason)
+		return "", blocked
+	}
+	if err != nil && !st.failed {
+		st.failed = true
+		recordEvent(t.ctx, EventError, st.name, StageResponse, err.Error())
+	}
+	st.in.WriteString(in)
+	st.out.WriteString(out)
+	return out, nil
+}
+
+// Stream filters the generated text of an OpenAI format SSE stream, chunk
+// by chunk. Text a filter holds back is released in a later chunk, at the
+// latest in the chunk carrying finish_reason. A nil *Stream changes nothing.
+type Stream struct {
+	chain   *Chain
+	ctx     context.Context
+	choices map[int]*textFilter
+	blocked bool
+}
+
+// Stream starts filtering a streamed response; nil when no filter of the
+// chain inspects responses
+func (c *Chain) Stream(ctx context.Context) *Stream {
+	if c.textFilter(ctx) == nil {
+		return nil
+	}
+	return &Stream{chain: c, ctx: ctx, choices: make(map[int]*textFilter)}
+}
+
+// Blocked reports whether a filter blocked the response. The chunk that
+// ended it carries finish_reason content_filter; the caller should stop
+// reading upstream and end the stream.
+func (s *Stream) Blocked() bool {
+	return s != nil && s.blocked
+}
+
+// Line filters one SSE line from llama-server and returns the line to send
+// on. Lines that are not data chunks are returned unchanged.
+func (s *Stream) Line(line string) string {
+	if s == nil {
+		return line
+	}
+	if s.blocked {
+		return ""
+	}
+	data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+	if !ok {
+		return line
+	}
+	data = strings.TrimSpace(data)
+	if data == "" || data == "[DONE]" {
+		return line
+	}
+
+	chunk, ok := decodeObject([]byte(data))
+	if !ok {
+		return line
+	}
+	choices, _ := chunk["choices"].([]interface{})
+
+	changed := false
+	for _, item := range choices {
+		choice, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		filter := s.choiceFilter(choiceIndex(choice))
+		text, setText := choiceText(choice)
+		finishReason, _ := choice["finish_reason"].(string)
+
+		out, err := filter.write(text)
+		if err == nil && finishReason != "" {
+			var rest string
+			rest, err = filter.close()
+			out += rest
+		}
+		if err != nil {
+			s.blocked = true
+			break
+		}
+		if out != text {
+			setText(out)
+			changed = true
+		}
+	}
+
+	if s.blocked {
+		for _, item := range choices {
+			if choice, ok := item.(map[string]interface{}); ok {
+				_, setText := choiceText(choice)
+				setText("")
+				choice["finish_reason"] = FinishReason
+			}
+		}
+		changed = true
+	}
+	if !changed {
+		return line
+	}
+	return "data: " + string(encodeObject(chunk)) + "\n"
+}
+
+func (s *Stream) choiceFilter(index int) *textFilter {
+	filter, exists := s.choices[index]
+	if !exists {
+		filter = s.chain.textFilter(s.ctx)
+		s.choices[index] = filter
+	}
+	return filter
+}
+
+// Body filters the generated text of a non-streamed OpenAI format response.
+// A blocked choice has its text removed and finish_reason content_filter.
+// Bodies that are not JSON are returned unchanged.
+func (c *Chain) Body(ctx context.Context, body []byte) []byte {
+	if c.textFilter(ctx) == nil {
+		return body
+	}
+	resp, ok := decodeObject(body)
+	if !ok {
+		return body
+	}
+	choices, _ := resp["choices"].([]interface{})
+
+	changed := false
+	for _, item := range choices {
+		choice, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		text, setText := choiceText(choice)
+		filter := c.textFilter(ctx)
+		out, err := filter.write(text)
+		if err == nil {
+			var rest string
+			rest, err = filter.close()
+			out += rest
+		}
+		if err != nil {
+			setText("")
+			choice["finish_reason"] = FinishReason
+			changed = true
+			continue
+		}
+		if out != text {
+			setText(out)
+			changed = true
+		}
+	}
+	if !changed {
+		return body
+	}
+	return encodeObject(resp)
+}
+
+// choiceIndex returns the index of a choice
+func choiceIndex(choice map[string]interface{}) int {
+	if index, ok := choice["index"].(json.Number); ok {
+		if i, err := index.Int64(); err == nil {
+			return int(i)
+		}
+	}
+	return 0
+}
+
+// choiceText returns the generated text of a chat or text completion choice,
+// streamed or not, and a function replacing it
+func choiceText(choice map[string]interface{}) (string, func(string)) {
+	for _, key := range []string{"delta", "message"} {
+		if msg, ok := choice[key].(map[string]interface{}); ok {
+			text, _ := msg["content"].(string)
+			return text, func(text string) {
+				if _, exists := msg["content"]; exists || text != "" {
+					msg["content"] = text
+				}
+			}
+		}
+	}
+	text, _ := choice["text"].(string)
+	return text, func(text string) {
+		choice["text"] = text
+	}
+}
+
+// decodeObject decodes a JSON object keeping numbers as they are
+func decodeObject(data []byte) (map[string]interface{}, bool) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil || object == nil {
+		return nil, false
+	}
+	return object, true
+}
+
+// encodeObject encodes a JSON object without escaping HTML characters
+func encodeObject(object map[string]interface{}) []byte {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(object)
+	return bytes.TrimRight(buf.Bytes(), "\n")
+}
@@ -0,0 +1,120 @@
+package filter
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chunkLine 构造 llama-server 的聊天流式数据块
+func chunkLine(content string, finishReason string) string {
+	choice := map[string]interface{}{"index": 0, "delta": map[string]interface{}{"content": content}}
+	if finishReason != "" {
+		choice["delta"] = map[string]interface{}{}
+		choice["finish_reason"] = finishReason
+	}
+	data, _ := json.Marshal(map[string]interface{}{"id": "chatcmpl-1", "choices": []interface{}{choice}})
+	return "data: " + string(data) + "\n"
+}
+
+// streamContent 提取数据块中的文本和 finish_reason
+func streamContent(t *testing.T, line string) (string, string) {
+	t.Helper()
+	if line == "" {
+		return "", ""
+	}
+	var chunk struct {
+		Choices []struct {
+			Delta        struct{ Content string } `json:"delta"`
+			FinishReason string                   `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), "data: ")), &chunk))
+	require.Len(t, chunk.Choices, 1)
+	return chunk.Choices[0].Delta.Content, chunk.Choices[0].FinishReason
+}
+
+func TestStreamLine(t *testing.T) {
+	chain := newTestChain(t, config.FilterConfig{Name: "pii", Type: config.FilterPII})
+	stream := chain.Stream(context.Background())
+	require.NotNil(t, stream)
+
+	var content strings.Builder
+	for _, piece := range []string{"Write to ", "carol@", "example", ".org", " today."} {
+		text, _ := streamContent(t, stream.Line(chunkLine(piece, "")))
+		content.WriteString(text)
+	}
+	// 被保留的文本在带 finish_reason 的数据块中放行
+	text, finishReason := streamContent(t, stream.Line(chunkLine("", "stop")))
+	content.WriteString(text)
+
+	assert.Equal(t, "Write to [EMAIL] today.", content.String())
+	assert.Equal(t, "stop", finishReason)
+	assert.False(t, stream.Blocked())
+
+	// 非数据行、[DONE] 和只有用量的数据块原样转发
+	assert.Equal(t, "\n", stream.Line("\n"))
+	assert.Equal(t, "data: [DONE]\n", stream.Line("data: [DONE]\n"))
+	usageLine := `data: {"choices":[],"usage":{"total_tokens":12}}` + "\n"
+	assert.Equal(t, usageLine, stream.Line(usageLine))
+}
+
+func TestStreamBlocked(t *testing.T) {
+	chain := newTestChain(t, config.FilterConfig{Name: "banned", Type: config.FilterBannedPhrases, Phrases: []string{"launch code"}})
+	stream := chain.Stream(context.Background())
+
+	var content strings.Builder
+	var finishReason string
+	for _, piece := range []string{"The ", "launch ", "code is 0000"} {
+		text, reason := streamContent(t, stream.Line(chunkLine(piece, "")))
+		content.WriteString(text)
+		finishReason = reason
+		if stream.Blocked() {
+			break
+		}
+	}
+	assert.True(t, stream.Blocked())
+	assert.Equal(t, FinishReason, finishReason)
+	assert.NotContains(t, content.String(), "launch")
+
+	// 拦截后不再转发任何数据块
+	assert.Empty(t, stream.Line(chunkLine("more", "")))
+
+	var nilStream *Stream
+	assert.Equal(t, "data: {}\n", nilStream.Line("data: {}\n"))
+	assert.False(t, nilStream.Blocked())
+}
+
+func TestBody(t *testing.T) {
+	chain := newTestChain(t,
+		config.FilterConfig{Name: "pii", Type: config.FilterPII},
+		config.FilterConfig{Name: "policy", Type: config.FilterSystemPrompt, Prompt: "Be safe."},
+	)
+	ctx := context.Background()
+
+	body := []byte(`{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"Mail dave@example.com"},"finish_reason":"stop"}],"usage":{"total_tokens":7}}`)
+	assert.JSONEq(t, `{"id":"chatcmpl-1","choices":[{"index":0,"message":{"role":"assistant","content":"Mail [EMAIL]"},"finish_reason":"stop"}],"usage":{"total_tokens":7}}`,
+		string(chain.Body(ctx, body)))
+
+	// 文本补全的 text 字段
+	body = []byte(`{"choices":[{"index":0,"text":"at 10.1.2.3","finish_reason":"length"}]}`)
+	assert.JSONEq(t, `{"choices":[{"index":0,"text":"at [IPV4]","finish_reason":"length"}]}`, string(chain.Body(ctx, body)))
+
+	// 未改写时返回原响应
+	body = []byte(`{"choices":[{"index":0,"message":{"content":"Hello"}}]}`)
+	assert.Equal(t, string(body), string(chain.Body(ctx, body)))
+
+	blocking := newTestChain(t, config.FilterConfig{Name: "banned", Type: config.FilterBannedPhrases, Phrases: []string{"secret"}})
+	body = []byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"The secret is 42"},"finish_reason":"stop"}]}`)
+	assert.JSONEq(t, `{"choices":[{"index":0,"message":{"role":"assistant","content":""},"finish_reason":"content_filter"}]}`,
+		string(blocking.Body(ctx, body)))
+
+	// 只作用于请求的过滤器不处理响应
+	requestOnly := newTestChain(t, config.FilterConfig{Name: "policy", Type: config.FilterSystemPrompt, Prompt: "Be safe."})
+	assert.Nil(t, requestOnly.Stream(ctx))
+}
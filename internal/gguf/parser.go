@@ -186,6 +186,11 @@ func (p *Parser) GetMetadata() (*Metadata, error) {
 	// Token 词表大小
 	if kv, ok := getKV("tokenizer.ggml.token_count"); ok {
 		meta.TokenCount = getIntValue(kv)
+	} else if kv, ok := getKV("tokenizer.ggml.tokens"); ok {
+		// 标准词表数组，使用其长度
+		if arr := kv.ValueArray(); arr.Len > 0 {
+			meta.TokenCount = int(arr.Len)
+		}
 	} else if kv, ok := getKV("tokenizer.token_list"); ok {
 		// token_list 是一个数组，使用其长度
 		if arr := kv.ValueArray(); arr.Len > 0 {
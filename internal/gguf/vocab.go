@@ -0,0 +1,144 @@
+package gguf
+
+import (
+	"fmt"
+
+	ggufparser "github.com/gpustack/gguf-parser-go"
+)
+
+// MaxDraftVocabSizeDifference is the largest vocabulary size difference
+// llama.cpp accepts between a target model and its draft model
+const MaxDraftVocabSizeDifference = 128
+
+// CheckDraftCompatible reports whether draft can be used as the speculative
+// decoding draft model of target. Like llama.cpp, the tokenizer type and the
+// BOS/EOS tokens must match and the vocabulary sizes may differ only
+// slightly; a different pre-tokenizer is also rejected since it splits text
+// differently. Fields missing from either file are not compared.
+func CheckDraftCompatible(target, draft *Metadata) error {
+	if target == nil || draft == nil {
+		return fmt.Errorf("missing GGUF metadata")
+	}
+
+	if target.TokenizerModel != "" && draft.TokenizerModel != "" && target.TokenizerModel != draft.TokenizerModel {
+		return fmt.Errorf("tokenizer mismatch: target %q, draft %q", target.TokenizerModel, draft.TokenizerModel)
+	}
+	if target.PreToken != "" && draft.PreToken != "" && target.PreToken != draft.PreToken {
+		return fmt.Errorf("pre-tokenizer mismatch: target %q, draft %q", target.PreToken, draft.PreToken)
+	}
+	if target.TokenCount > 0 && draft.TokenCount > 0 {
+		diff := target.TokenCount - draft.TokenCount
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > MaxDraftVocabSizeDifference {
+			return fmt.Errorf("vocabulary size mismatch: target %d, draft %d (max difference %d)",
+				target.TokenCount, draft.TokenCount, MaxDraftVocabSizeDifference)
+		}
+	}
+	if target.BosTokenID != draft.BosTokenID {
+		return fmt.Errorf("BOS token mismatch: target %d, draft %d", target.BosTokenID, draft.BosTokenID)
+	}
+	if target.EosTokenID != draft.EosTokenID {
+		return fmt.Errorf("EOS token mismatch: target %d, draft %d", target.EosTokenID, draft.EosTokenID)
+	}
+	return nil
+}
+
+// Token types of tokenizer.ggml.token_type, as defined by llama.cpp
+const (
+	TokenTypeNormal      = 1
+	TokenTypeUnknown     = 2
+	TokenTypeControl     = 3
+	TokenTypeUserDefined = 4
+	TokenTypeUnused      = 5
+	TokenTypeByte        = 6
+)
+
+// Vocabulary is the tokenizer stored in a GGUF file. Token ID fields are -1
+// when the file does not define the token.
+type Vocabulary struct {
+	Model  string    // tokenizer.ggml.model: llama (SentencePiece)、gpt2 (BPE) 等
+	Pre    string    // tokenizer.ggml.pre 预分词规则
+	Tokens []string  // 下标即 token ID
+	Scores []float32 // SentencePiece 合并优先级
+	Types  []int32   // TokenType*
+	Merges []string  // BPE 合并规则 "a b"，按优先级排序
+
+	BosTokenID     int
+	EosTokenID     int
+	UnknownTokenID int
+
+	AddBOS         bool
+	AddEOS         bool
+	AddSpacePrefix bool
+
+	ChatTemplate string // tokenizer.chat_template (Jinja)
+}
+
+// ReadVocabulary reads the tokenizer vocabulary of a GGUF file. For split
+// models pass the first shard, which holds the metadata.
+func ReadVocabulary(path string) (*Vocabulary, error) {
+	file, err := ggufparser.ParseGGUFFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GGUF file: %w", err)
+	}
+	kvs := file.Header.MetadataKV
+
+	vocab := &Vocabulary{BosTokenID: -1, EosTokenID: -1, UnknownTokenID: -1}
+	if kv, ok := kvs.Get("tokenizer.ggml.model"); ok && kv.ValueType == ggufparser.GGUFMetadataValueTypeString {
+		vocab.Model = kv.ValueString()
+	}
+	if kv, ok := kvs.Get("tokenizer.ggml.pre"); ok && kv.ValueType == ggufparser.GGUFMetadataValueTypeString {
+		vocab.Pre = kv.ValueString()
+	}
+	if kv, ok := kvs.Get("tokenizer.chat_template"); ok && kv.ValueType == ggufparser.GGUFMetadataValueTypeString {
+		vocab.ChatTemplate = kv.ValueString()
+	}
+
+	kv, ok := kvs.Get("tokenizer.ggml.tokens")
+	if !ok || kv.ValueType != ggufparser.GGUFMetadataValueTypeArray || kv.ValueArray().Type != ggufparser.GGUFMetadataValueTypeString {
+		return nil, fmt.Errorf("GGUF file has no tokenizer vocabulary")
+	}
+	vocab.Tokens = kv.ValueArray().ValuesString()
+
+	if kv, ok := kvs.Get("tokenizer.ggml.scores"); ok && kv.ValueType == ggufparser.GGUFMetadataValueTypeArray &&
+		kv.ValueArray().Type == ggufparser.GGUFMetadataValueTypeFloat32 {
+		vocab.Scores = kv.ValueArray().ValuesFloat32()
+	}
+	if kv, ok := kvs.Get("tokenizer.ggml.token_type"); ok && kv.ValueType == ggufparser.GGUFMetadataValueTypeArray &&
+		kv.ValueArray().Type == ggufparser.GGUFMetadataValueTypeInt32 {
+		vocab.Types = kv.ValueArray().ValuesInt32()
+	}
+	if kv, ok := kvs.Get("tokenizer.ggml.merges"); ok && kv.ValueType == ggufparser.GGUFMetadataValueTypeArray &&
+		kv.ValueArray().Type == ggufparser.GGUFMetadataValueTypeString {
+		vocab.Merges = kv.ValueArray().ValuesString()
+	}
+
+	tokenID := func(key string, target *int) {
+		if kv, ok := kvs.Get(key); ok {
+			switch kv.ValueType {
+			case ggufparser.GGUFMetadataValueTypeUint32, ggufparser.GGUFMetadataValueTypeInt32,
+				ggufparser.GGUFMetadataValueTypeUint64, ggufparser.GGUFMetadataValueTypeInt64:
+				*target = ggufparser.ValueNumeric[int](kv)
+			}
+		}
+	}
+	tokenID("tokenizer.ggml.bos_token_id", &vocab.BosTokenID)
+	tokenID("tokenizer.ggml.eos_token_id", &vocab.EosTokenID)
+	tokenID("tokenizer.ggml.unknown_token_id", &vocab.UnknownTokenID)
+
+	// 与 llama.cpp 一致：SentencePiece 默认添加 BOS 和空格前缀，BPE 默认不添加空格前缀
+	vocab.AddBOS = vocab.Model == "llama"
+	vocab.AddSpacePrefix = vocab.Model == "llama"
+	flag := func(key string, target *bool) {
+		if kv, ok := kvs.Get(key); ok && kv.ValueType == ggufparser.GGUFMetadataValueTypeBool {
+			*target = kv.ValueBool()
+		}
+	}
+	flag("tokenizer.ggml.add_bos_token", &vocab.AddBOS)
+	flag("tokenizer.ggml.add_eos_token", &vocab.AddEOS)
+	flag("tokenizer.ggml.add_space_prefix", &vocab.AddSpacePrefix)
+
+	return vocab, nil
+}
@@ -0,0 +1,132 @@
+package gguf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDraftCompatible(t *testing.T) {
+	target := &Metadata{TokenizerModel: "gpt2", PreToken: "qwen2", TokenCount: 151936, BosTokenID: 151643, EosTokenID: 151645}
+
+	tests := []struct {
+		name    string
+		draft   Metadata
+		wantErr bool
+	}{
+		{name: "Same vocabulary", draft: *target},
+		{name: "Large size difference", draft: Metadata{TokenizerModel: "gpt2", PreToken: "qwen2", TokenCount: 151665, BosTokenID: 151643, EosTokenID: 151645}, wantErr: true},
+		{name: "Padded vocabulary", draft: Metadata{TokenizerModel: "gpt2", PreToken: "qwen2", TokenCount: 151900, BosTokenID: 151643, EosTokenID: 151645}},
+		{name: "Unknown pre-tokenizer", draft: Metadata{TokenizerModel: "gpt2", TokenCount: 151936, BosTokenID: 151643, EosTokenID: 151645}},
+		{name: "Other tokenizer", draft: Metadata{TokenizerModel: "llama", TokenCount: 151936, BosTokenID: 151643, EosTokenID: 151645}, wantErr: true},
+		{name: "Other pre-tokenizer", draft: Metadata{TokenizerModel: "gpt2", PreToken: "llama-bpe", TokenCount: 151936, BosTokenID: 151643, EosTokenID: 151645}, wantErr: true},
+		{name: "Other EOS", draft: Metadata{TokenizerModel: "gpt2", PreToken: "qwen2", TokenCount: 151936, BosTokenID: 151643, EosTokenID: 151643}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckDraftCompatible(target, &tt.draft)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	assert.Error(t, CheckDraftCompatible(target, nil))
+}
+
+// writeTestGGUF 写入只含元数据的 GGUF v3 文件
+func writeTestGGUF(t *testing.T, kvs []testKV) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	write := func(v interface{}) { require.NoError(t, binary.Write(&buf, binary.LittleEndian, v)) }
+	writeString := func(s string) {
+		write(uint64(len(s)))
+		buf.WriteString(s)
+	}
+
+	buf.WriteString("GGUF")
+	write(uint32(3))
+	write(uint64(0)) // tensor count
+	write(uint64(len(kvs)))
+	for _, kv := range kvs {
+		writeString(kv.key)
+		switch v := kv.value.(type) {
+		case string:
+			write(uint32(8))
+			writeString(v)
+		case bool:
+			write(uint32(7))
+			write(v)
+		case uint32:
+			write(uint32(4))
+			write(v)
+		case []string:
+			write(uint32(9))
+			write(uint32(8))
+			write(uint64(len(v)))
+			for _, s := range v {
+				writeString(s)
+			}
+		case []float32:
+			write(uint32(9))
+			write(uint32(6))
+			write(uint64(len(v)))
+			write(v)
+		case []int32:
+			write(uint32(9))
+			write(uint32(5))
+			write(uint64(len(v)))
+			write(v)
+		default:
+			t.Fatalf("unsupported value %T", v)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "vocab.gguf")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+	return path
+}
+
+type testKV struct {
+	key   string
+	value interface{}
+}
+
+func TestReadVocabulary(t *testing.T) {
+	path := writeTestGGUF(t, []testKV{
+		{"general.architecture", "qwen2"},
+		{"tokenizer.ggml.model", "gpt2"},
+		{"tokenizer.ggml.pre", "qwen2"},
+		{"tokenizer.ggml.tokens", []string{"<|endoftext|>", "H", "i", "Hi"}},
+		{"tokenizer.ggml.token_type", []int32{TokenTypeControl, TokenTypeNormal, TokenTypeNormal, TokenTypeNormal}},
+		{"tokenizer.ggml.merges", []string{"H i"}},
+		{"tokenizer.ggml.eos_token_id", uint32(0)},
+		{"tokenizer.ggml.add_bos_token", false},
+		{"tokenizer.chat_template", "{{ '<|im_start|>' }}"},
+	})
+
+	vocab, err := ReadVocabulary(path)
+	require.NoError(t, err)
+	assert.Equal(t, "gpt2", vocab.Model)
+	assert.Equal(t, "qwen2", vocab.Pre)
+	assert.Equal(t, []string{"<|endoftext|>", "H", "i", "Hi"}, vocab.Tokens)
+	assert.Equal(t, int32(TokenTypeControl), vocab.Types[0])
+	assert.Equal(t, []string{"H i"}, vocab.Merges)
+	assert.Equal(t, 0, vocab.EosTokenID)
+	assert.Equal(t, -1, vocab.BosTokenID)
+	assert.False(t, vocab.AddBOS)
+	assert.False(t, vocab.AddSpacePrefix)
+	assert.Equal(t, "{{ '<|im_start|>' }}", vocab.ChatTemplate)
+
+	_, err = ReadVocabulary(writeTestGGUF(t, []testKV{{"general.architecture", "llama"}}))
+	assert.Error(t, err)
+}
@@ -0,0 +1,103 @@
+// Package metrics implements the metric types and the Prometheus text
+// exposition format behind the /metrics endpoint. It also parses the text
+// format so that llama-server and client node metrics can be relabelled and
+// re-exported.
+package metrics
+
+import (
+	"sort"
+)
+
+// 指标类型，对应 # TYPE 行
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+	TypeSummary   = "summary"
+	TypeUntyped   = "untyped"
+)
+
+// Label is a metric label
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is one line of a metric family. Name differs from the family name
+// for histogram and summary series (_bucket, _sum, _count).
+type Sample struct {
+	Name   string
+	Labels []Label
+	Value  float64
+}
+
+// Family is a named group of samples sharing HELP and TYPE
+type Family struct {
+	Name    string
+	Help    string
+	Type    string
+	Samples []Sample
+}
+
+// NewFamily creates an empty metric family
+func NewFamily(name, help, typ string) *Family {
+	return &Family{Name: name, Help: help, Type: typ}
+}
+
+// Add appends a sample named after the family. labelPairs alternate label
+// names and values.
+func (f *Family) Add(value float64, labelPairs ...string) {
+	f.Samples = append(f.Samples, Sample{Name: f.Name, Labels: pairs(labelPairs), Value: value})
+}
+
+// Merge combines families with the same name, keeping the HELP and TYPE of
+// the first, and returns them sorted by name
+func Merge(families ...[]*Family) []*Family {
+	byName := make(map[string]*Family)
+	var merged []*Family
+	for _, list := range families {
+		for _, f := range list {
+			if existing, ok := byName[f.Name]; ok {
+				existing.Samples = append(existing.Samples, f.Samples...)
+				continue
+			}
+			copied := *f
+			copied.Samples = append([]Sample(nil), f.Samples...)
+			byName[f.Name] = &copied
+			merged = append(merged, &copied)
+		}
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Name < merged[j].Name })
+	return merged
+}
+
+// AddLabel adds a label to every sample. A label of the same name already on
+// a sample is kept as exported_<name>, as Prometheus does when scraping.
+func AddLabel(families []*Family, name, value string) {
+	for _, f := range families {
+		for i := range f.Samples {
+			sample := &f.Samples[i]
+			labels := make([]Label, 0, len(sample.Labels)+1)
+			labels = append(labels, Label{Name: name, Value: value})
+			for _, l := range sample.Labels {
+				if l.Name == name {
+					l.Name = "exported_" + name
+				}
+				labels = append(labels, l)
+			}
+			sample.Labels = labels
+		}
+	}
+}
+
+// pairs 将交替的名称和值转换为标签
+func pairs(labelPairs []string) []Label {
+	if len(labelPairs) == 0 {
+		return nil
+	}
+	labels := make([]Label, 0, len(labelPairs)/2)
+	for i := 0; i+1 < len(labelPairs); i += 2 {
+		labels = append(labels, Label{Name: labelPairs[i], Value: labelPairs[i+1]})
+	}
+	return labels
+}
@@ -0,0 +1,217 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Collector produces metric families at scrape time
+type Collector interface {
+	Collect() []*Family
+}
+
+// CollectorFunc adapts a function to the Collector interface
+type CollectorFunc func() []*Family
+
+// Collect calls f
+func (f CollectorFunc) Collect() []*Family { return f() }
+
+// Registry holds the collectors exported on /metrics
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []Collector
+}
+
+// Default is the registry package-level metrics register with
+var Default = NewRegistry()
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a collector to the registry
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Gather collects all registered collectors
+func (r *Registry) Gather() []*Family {
+	r.mu.RLock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.RUnlock()
+
+	lists := make([][]*Family, 0, len(collectors))
+	for _, c := range collectors {
+		lists = append(lists, c.Collect())
+	}
+	return Merge(lists...)
+}
+
+// labelKey 标签值组合的唯一键
+func labelKey(values []string) string {
+	return strings.Join(values, "\xff")
+}
+
+// CounterVec is a counter partitioned by label values
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	value  float64
+}
+
+// NewCounterVec creates a counter and registers it with Default
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: make(map[string]*counterValue)}
+	Default.Register(c)
+	return c
+}
+
+// Add increases the counter for the given label values
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.values[key]
+	if !ok {
+		v = &counterValue{labels: append([]string(nil), labelValues...)}
+		c.values[key] = v
+	}
+	v.value += value
+}
+
+// Inc increases the counter for the given label values by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Collect implements Collector
+func (c *CounterVec) Collect() []*Family {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f := NewFamily(c.name, c.help, TypeCounter)
+	for _, key := range sortedKeys(c.values) {
+		v := c.values[key]
+		f.Samples = append(f.Samples, Sample{Name: c.name, Labels: zip(c.labels, v.labels), Value: v.value})
+	}
+	return []*Family{f}
+}
+
+// DefaultBuckets suit request and load durations in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300}
+
+// HistogramVec is a histogram partitioned by label values
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64 // 每个桶的计数（非累计）
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec creates a histogram and registers it with Default. Nil
+// buckets use DefaultBuckets.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &HistogramVec{name: name, help: help, labels: labels, buckets: buckets, values: make(map[string]*histogramValue)}
+	Default.Register(h)
+	return h
+}
+
+// Observe records a value for the given label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	key := labelKey(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	v, ok := h.values[key]
+	if !ok {
+		v = &histogramValue{labels: append([]string(nil), labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = v
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			v.counts[i]++
+			break
+		}
+	}
+	v.count++
+	v.sum += value
+}
+
+// Collect implements Collector
+func (h *HistogramVec) Collect() []*Family {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	f := NewFamily(h.name, h.help, TypeHistogram)
+	for _, key := range sortedKeys(h.values) {
+		v := h.values[key]
+		labels := zip(h.labels, v.labels)
+
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += v.counts[i]
+			f.Samples = append(f.Samples, Sample{
+				Name:   h.name + "_bucket",
+				Labels: append(append([]Label(nil), labels...), Label{Name: "le", Value: formatFloat(bound)}),
+				Value:  float64(cumulative),
+			})
+		}
+		f.Samples = append(f.Samples,
+			Sample{
+				Name:   h.name + "_bucket",
+				Labels: append(append([]Label(nil), labels...), Label{Name: "le", Value: formatFloat(math.Inf(1))}),
+				Value:  float64(v.count),
+			},
+			Sample{Name: h.name + "_sum", Labels: labels, Value: v.sum},
+			Sample{Name: h.name + "_count", Labels: labels, Value: float64(v.count)},
+		)
+	}
+	return []*Family{f}
+}
+
+// zip 组合标签名和标签值
+func zip(names, values []string) []Label {
+	labels := make([]Label, 0, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		labels = append(labels, Label{Name: name, Value: value})
+	}
+	return labels
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCounterVec(t *testing.T) {
+	c := &CounterVec{name: "requests_total", help: "Requests.", labels: []string{"route", "status"}, values: map[string]*counterValue{}}
+	c.Inc("/v1/chat", "200")
+	c.Inc("/v1/chat", "200")
+	c.Add(3, "/v1/chat", "500")
+
+	families := c.Collect()
+	require.Len(t, families, 1)
+	assert.Equal(t, TypeCounter, families[0].Type)
+	assert.Equal(t, []Sample{
+		{Name: "requests_total", Labels: []Label{{"route", "/v1/chat"}, {"status", "200"}}, Value: 2},
+		{Name: "requests_total", Labels: []Label{{"route", "/v1/chat"}, {"status", "500"}}, Value: 3},
+	}, families[0].Samples)
+}
+
+func TestHistogramVec(t *testing.T) {
+	h := &HistogramVec{name: "load_seconds", labels: []string{"model"}, buckets: []float64{1, 10}, values: map[string]*histogramValue{}}
+	h.Observe(0.5, "qwen")
+	h.Observe(5, "qwen")
+	h.Observe(50, "qwen")
+
+	samples := h.Collect()[0].Samples
+	require.Len(t, samples, 5)
+	assert.Equal(t, Sample{Name: "load_seconds_bucket", Labels: []Label{{"model", "qwen"}, {"le", "1"}}, Value: 1}, samples[0])
+	assert.Equal(t, Sample{Name: "load_seconds_bucket", Labels: []Label{{"model", "qwen"}, {"le", "10"}}, Value: 2}, samples[1])
+	assert.Equal(t, Sample{Name: "load_seconds_bucket", Labels: []Label{{"model", "qwen"}, {"le", "+Inf"}}, Value: 3}, samples[2])
+	assert.Equal(t, 55.5, samples[3].Value)
+	assert.Equal(t, 3.0, samples[4].Value)
+}
+
+func TestRegistryGather(t *testing.T) {
+	r := NewRegistry()
+	r.Register(CollectorFunc(func() []*Family {
+		f := NewFamily("b_metric", "", TypeGauge)
+		f.Add(1)
+		return []*Family{f}
+	}))
+	r.Register(CollectorFunc(func() []*Family {
+		f := NewFamily("a_metric", "", TypeGauge)
+		f.Add(2)
+		return []*Family{f}
+	}))
+
+	families := r.Gather()
+	require.Len(t, families, 2)
+	assert.Equal(t, "a_metric", families[0].Name)
+	assert.Equal(t, "b_metric", families[1].Name)
+}
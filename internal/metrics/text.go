@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ContentType is the content type of the text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Write writes families in the Prometheus text exposition format
+func Write(w io.Writer, families []*Family) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		if len(f.Samples) == 0 {
+			continue
+		}
+		if f.Help != "" {
+			fmt.Fprintf(bw, "# HELP %s %s\n", f.Name, escapeHelp(f.Help))
+		}
+		if f.Type != "" {
+			fmt.Fprintf(bw, "# TYPE %s %s\n", f.Name, f.Type)
+		}
+		for _, s := range f.Samples {
+			bw.WriteString(s.Name)
+			if len(s.Labels) > 0 {
+				bw.WriteByte('{')
+				for i, l := range s.Labels {
+					if i > 0 {
+						bw.WriteByte(',')
+					}
+					fmt.Fprintf(bw, "%s=\"%s\"", l.Name, escapeLabel(l.Value))
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteByte(' ')
+			bw.WriteString(formatFloat(s.Value))
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+// Parse reads metric families in the text exposition format. Samples are
+// grouped under the # TYPE or # HELP line that precedes them; timestamps are
+// dropped.
+func Parse(r io.Reader) ([]*Family, error) {
+	var (
+		families []*Family
+		byName   = make(map[string]*Family)
+		current  *Family
+	)
+	family := func(name string) *Family {
+		if f, ok := byName[name]; ok {
+			return f
+		}
+		f := &Family{Name: name, Type: TypeUntyped}
+		byName[name] = f
+		families = append(families, f)
+		return f
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			fields := strings.SplitN(strings.TrimSpace(line[1:]), " ", 3)
+			if len(fields) < 3 || (fields[0] != "HELP" && fields[0] != "TYPE") {
+				continue
+			}
+			current = family(fields[1])
+			if fields[0] == "HELP" {
+				current.Help = unescapeHelp(fields[2])
+			} else {
+				current.Type = fields[2]
+			}
+			continue
+		}
+
+		sample, err := parseSample(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+		target := current
+		if target == nil || !belongsTo(sample.Name, target) {
+			target = family(sample.Name)
+		}
+		target.Samples = append(target.Samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return families, nil
+}
+
+// belongsTo 判断样本是否属于指标族（直方图和摘要带 _bucket/_sum/_count 后缀）
+func belongsTo(name string, f *Family) bool {
+	if name == f.Name {
+		return true
+	}
+	if f.Type != TypeHistogram && f.Type != TypeSummary {
+		return false
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if name == f.Name+suffix {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSample 解析 name{labels} value [timestamp]
+func parseSample(line string) (Sample, error) {
+	var s Sample
+	end := strings.IndexAny(line, "{ \t")
+	if end <= 0 {
+		return s, fmt.Errorf("invalid sample %q", line)
+	}
+	s.Name = line[:end]
+	rest := line[end:]
+
+	if strings.HasPrefix(rest, "{") {
+		labels, n, err := parseLabels(rest)
+		if err != nil {
+			return s, err
+		}
+		s.Labels = labels
+		rest = rest[n:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return s, fmt.Errorf("missing value in %q", line)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return s, fmt.Errorf("invalid value in %q", line)
+	}
+	s.Value = value
+	return s, nil
+}
+
+// parseLabels 解析 {a="1",b="2"}，返回标签和消耗的字节数
+func parseLabels(s string) ([]Label, int, error) {
+	var labels []Label
+	i := 1 // 跳过 {
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == ',') {
+			i++
+		}
+		if i >= len(s) {
+			return nil, 0, fmt.Errorf("unterminated labels in %q", s)
+		}
+		if s[i] == '}' {
+			return labels, i + 1, nil
+		}
+
+		eq := strings.IndexByte(s[i:], '=')
+		if eq < 0 {
+			return nil, 0, fmt.Errorf("invalid labels in %q", s)
+		}
+		name := strings.TrimSpace(s[i : i+eq])
+		i += eq + 1
+		if i >= len(s) || s[i] != '"' {
+			return nil, 0, fmt.Errorf("unquoted label value in %q", s)
+		}
+		i++
+
+		var value strings.Builder
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			value.WriteByte(s[i])
+		}
+		if i >= len(s) {
+			return nil, 0, fmt.Errorf("unterminated label value in %q", s)
+		}
+		i++ // 跳过结束引号
+		labels = append(labels, Label{Name: name, Value: value.String()})
+	}
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper  = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper   = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	helpUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n")
+)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+func escapeHelp(s string) string { return helpEscaper.Replace(s) }
+
+func unescapeHelp(s string) string { return helpUnescaper.Replace(s) }
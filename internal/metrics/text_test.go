@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// llama-server --metrics 的输出片段
+const llamaServerMetrics = `# HELP llamacpp:prompt_tokens_total Number of prompt tokens processed.
+# TYPE llamacpp:prompt_tokens_total counter
+llamacpp:prompt_tokens_total 1234
+# HELP llamacpp:requests_processing Number of requests processing.
+# TYPE llamacpp:requests_processing gauge
+llamacpp:requests_processing 2
+`
+
+func TestParse(t *testing.T) {
+	families, err := Parse(strings.NewReader(llamaServerMetrics))
+	require.NoError(t, err)
+	require.Len(t, families, 2)
+
+	assert.Equal(t, "llamacpp:prompt_tokens_total", families[0].Name)
+	assert.Equal(t, TypeCounter, families[0].Type)
+	assert.Equal(t, "Number of prompt tokens processed.", families[0].Help)
+	require.Len(t, families[0].Samples, 1)
+	assert.Equal(t, 1234.0, families[0].Samples[0].Value)
+	assert.Equal(t, TypeGauge, families[1].Type)
+}
+
+func TestParseHistogramAndLabels(t *testing.T) {
+	input := `# TYPE req_seconds histogram
+req_seconds_bucket{route="/v1/chat",le="0.5"} 3
+req_seconds_bucket{route="/v1/chat",le="+Inf"} 4 1700000000000
+req_seconds_sum{route="/v1/chat"} 1.5
+req_seconds_count{route="/v1/chat"} 4
+other{path="a \"quoted\\ value\"\n"} NaN
+`
+	families, err := Parse(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, families, 2)
+
+	assert.Len(t, families[0].Samples, 4)
+	assert.Equal(t, []Label{{"route", "/v1/chat"}, {"le", "+Inf"}}, families[0].Samples[1].Labels)
+	assert.Equal(t, "other", families[1].Name)
+	assert.Equal(t, TypeUntyped, families[1].Type)
+	assert.Equal(t, "a \"quoted\\ value\"\n", families[1].Samples[0].Labels[0].Value)
+
+	_, err = Parse(strings.NewReader("broken{a=\"1\" 2\n"))
+	assert.Error(t, err)
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	f := NewFamily("shepherd_model_state", "Current state of each model instance.", TypeGauge)
+	f.Add(1, "model", `qwen "7b"`, "state", "loaded")
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, []*Family{f}))
+	assert.Equal(t, `# HELP shepherd_model_state Current state of each model instance.
+# TYPE shepherd_model_state gauge
+shepherd_model_state{model="qwen \"7b\"",state="loaded"} 1
+`, buf.String())
+
+	parsed, err := Parse(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, []*Family{f}, parsed)
+}
+
+func TestMergeAndAddLabel(t *testing.T) {
+	a, err := Parse(strings.NewReader(llamaServerMetrics))
+	require.NoError(t, err)
+	AddLabel(a, "model", "qwen")
+	b, err := Parse(strings.NewReader(llamaServerMetrics))
+	require.NoError(t, err)
+	AddLabel(b, "model", "llama")
+
+	merged := Merge(a, b)
+	require.Len(t, merged, 2)
+	assert.Len(t, merged[0].Samples, 2)
+
+	// 已有同名标签时保留为 exported_ 前缀
+	AddLabel(merged, "model", "node-a")
+	assert.Equal(t, []Label{{"model", "node-a"}, {"exported_model", "qwen"}}, merged[0].Samples[0].Labels)
+
+	var buf bytes.Buffer
+	require.NoError(t, Write(&buf, merged))
+	assert.Equal(t, 1, strings.Count(buf.String(), "# TYPE llamacpp:prompt_tokens_total counter"))
+}
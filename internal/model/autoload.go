@@ -0,0 +1,247 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
+)
+
+// 按需加载相关错误，API 层据此映射 HTTP 状态码
+var (
+	ErrModelNotFound    = errors.New("model not found")
+	ErrAutoLoadDisabled = errors.New("model not loaded and auto load is disabled")
+	ErrAutoLoadTimeout  = errors.New("timed out waiting for model to load")
+	ErrAutoLoadFailed   = errors.New("model failed to load")
+	ErrTooManyModels    = errors.New("maximum number of loaded models reached")
+)
+
+const (
+	// defaultAutoLoadWaitTimeout 配置未设置等待时间时的默认值
+	defaultAutoLoadWaitTimeout = 5 * time.Minute
+	// autoLoadPollInterval 等待模型就绪时的状态轮询间隔
+	autoLoadPollInterval = 200 * time.Millisecond
+)
+
+// LoadConfigProvider returns the load parameters used when a model is loaded
+// on demand. Returning (nil, nil) means no saved configuration exists and the
+// defaults should be used.
+type LoadConfigProvider func(modelID string) (*LoadRequest, error)
+
+// SetLoadConfigProvider sets where on-demand loads read their parameters from
+func (m *Manager) SetLoadConfigProvider(provider LoadConfigProvider) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loadConfigProvider = provider
+}
+
+// ResolveModel finds a scanned model by ID, alias or name, whether it is
+// loaded or not
+func (m *Manager) ResolveModel(name string) (*Model, bool) {
+	if name == "" {
+		return nil, false
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if model, exists := m.models[name]; exists {
+		modelCopy := *model
+		return &modelCopy, true
+	}
+
+	// 未加载模型不做 ID 模糊匹配，避免误加载其他模型
+	for _, model := range m.models {
+		if model.Alias != "" && strings.EqualFold(model.Alias, name) {
+			modelCopy := *model
+			return &modelCopy, true
+		}
+		if strings.EqualFold(model.Name, name) {
+			modelCopy := *model
+			return &modelCopy, true
+		}
+	}
+
+	return nil, false
+}
+
+// EnsureLoaded makes sure the named model is running and returns its ID.
+// An unloaded model is started with its saved load configuration and the call
+// blocks until it is ready, the context is cancelled or the wait timeout expires.
+func (m *Manager) EnsureLoaded(ctx context.Context, name string) (string, error) {
+	model, ok := m.ResolveModel(name)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrModelNotFound, name)
+	}
+
+	if m.HasLoadedReplica(model.ID) {
+		return model.ID, nil
+	}
+
+	autoLoad := m.currentConfig().Gateway.AutoLoad
+	if !autoLoad.Enabled {
+		return "", fmt.Errorf("%w: %s", ErrAutoLoadDisabled, model.ID)
+	}
+
+	ctx, span := tracing.Start(ctx, "model.auto_load", tracing.String("shepherd.model.id", model.ID))
+	defer span.End()
+
+	if err := m.startAutoLoad(ctx, model.ID, autoLoad.MaxLoadedModels); err != nil {
+		span.RecordError(err)
+		return "", err
+	}
+
+	timeout := time.Duration(autoLoad.WaitTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultAutoLoadWaitTimeout
+	}
+
+	err := m.waitForLoaded(ctx, model.ID, timeout)
+	span.RecordError(err)
+	return model.ID, err
+}
+
+// startAutoLoad 为模型触发异步加载，必要时先卸载最久未使用的模型腾出位置
+func (m *Manager) startAutoLoad(ctx context.Context, modelID string, maxLoaded int) error {
+	// 串行化按需加载决策，避免并发请求重复启动或同时抢占名额
+	m.autoLoadMu.Lock()
+	defer m.autoLoadMu.Unlock()
+
+	if status, exists := m.GetStatus(modelID); (exists && status.State == StateLoading) || m.HasLoadedReplica(modelID) {
+		return nil
+	}
+
+	if maxLoaded > 0 {
+		if err := m.makeRoomFor(modelID, maxLoaded); err != nil {
+			return err
+		}
+	}
+
+	req, err := m.autoLoadRequest(modelID)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrAutoLoadFailed, modelID, err)
+	}
+
+	logger.Info("按需加载模型", "modelId", modelID, "ctxSize", req.CtxSize)
+	req.TraceParent = tracing.TraceParent(ctx)
+
+	if _, err := m.LoadAsync(req); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrAutoLoadFailed, modelID, err)
+	}
+	return nil
+}
+
+// makeRoomFor 在达到运行上限时卸载最久未使用的模型
+func (m *Manager) makeRoomFor(modelID string, maxLoaded int) error {
+	for {
+		running := 0
+		var victim *ModelStatus
+		for id, status := range m.ListStatus() {
+			if id == modelID {
+				continue
+			}
+			switch status.State {
+			case StateLoading, StateUnloading:
+				running++
+			case StateLoaded:
+				running++
+				// 固定模型和正在处理请求的模型不参与抢占
+				if status.ActiveRequests > 0 {
+					continue
+				}
+				if model, ok := m.GetModel(statusModelID(id, status)); ok && model.Pinned {
+					continue
+				}
+				if victim == nil || lastActivity(status).Before(lastActivity(victim)) {
+					victim = status
+				}
+			}
+		}
+
+		if running < maxLoaded {
+			return nil
+		}
+		if victim == nil {
+			return fmt.Errorf("%w (%d)", ErrTooManyModels, maxLoaded)
+		}
+
+		logger.Info("已达到模型运行上限，卸载最久未使用的模型", "modelId", victim.ID, "limit", maxLoaded, "requested", modelID)
+		if err := m.Unload(victim.ID); err != nil {
+			return fmt.Errorf("%w (%d): unload %s: %v", ErrTooManyModels, maxLoaded, victim.ID, err)
+		}
+	}
+}
+
+// autoLoadRequest 构建按需加载请求：优先使用保存的加载配置，否则使用默认参数
+func (m *Manager) autoLoadRequest(modelID string) (*LoadRequest, error) {
+	m.mu.RLock()
+	provider := m.loadConfigProvider
+	m.mu.RUnlock()
+
+	if provider != nil {
+		req, err := provider(modelID)
+		if err != nil {
+			return nil, err
+		}
+		if req != nil {
+			req.ModelID = modelID
+			return req, nil
+		}
+	}
+
+	return &LoadRequest{
+		ModelID: modelID,
+		CtxSize: 4096,
+	}, nil
+}
+
+// waitForLoaded 轮询模型状态直到加载完成、失败或超时
+func (m *Manager) waitForLoaded(ctx context.Context, modelID string, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(autoLoadPollInterval)
+	defer ticker.Stop()
+
+	for {
+		status, exists := m.GetStatus(modelID)
+		if exists {
+			switch status.State {
+			case StateLoaded:
+				return nil
+			case StateError:
+				if status.Error != nil {
+					return fmt.Errorf("%w: %s: %v", ErrAutoLoadFailed, modelID, status.Error)
+				}
+				return fmt.Errorf("%w: %s", ErrAutoLoadFailed, modelID)
+			case StateUnloaded:
+				return fmt.Errorf("%w: %s: unloaded while loading", ErrAutoLoadFailed, modelID)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return fmt.Errorf("%w: %s (%s)", ErrAutoLoadTimeout, modelID, timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// currentConfig 返回最新配置，配置管理器不可用时退回初始化时的配置
+func (m *Manager) currentConfig() *config.Config {
+	if m.configMgr != nil {
+		if cfg := m.configMgr.Get(); cfg != nil {
+			return cfg
+		}
+	}
+	if m.config != nil {
+		return m.config
+	}
+	return config.DefaultConfig()
+}
@@ -0,0 +1,196 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// autoLoadModels 为按需加载测试预置的模型
+var autoLoadModels = []Model{
+	{ID: "qwen-7b-q4", Name: "Qwen-7B", Alias: "qwen"},
+	{ID: "llama-8b-q8", Name: "Llama-8B"},
+}
+
+// newAutoLoadTestManager 创建带有预置模型的管理器
+func newAutoLoadTestManager(t *testing.T, autoLoad config.AutoLoadConfig) *Manager {
+	t.Helper()
+
+	cfg := config.DefaultConfig()
+	cfg.Gateway.AutoLoad = autoLoad
+	return newTestManager(t, cfg, autoLoadModels)
+}
+
+func TestResolveModel(t *testing.T) {
+	manager := newAutoLoadTestManager(t, config.AutoLoadConfig{Enabled: true})
+
+	tests := []struct {
+		name    string
+		query   string
+		wantID  string
+		wantHit bool
+	}{
+		{"by id", "qwen-7b-q4", "qwen-7b-q4", true},
+		{"by alias", "QWEN", "qwen-7b-q4", true},
+		{"by name", "llama-8b", "llama-8b-q8", true},
+		{"no fuzzy id match", "llama", "", false},
+		{"empty", "", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, ok := manager.ResolveModel(tt.query)
+			assert.Equal(t, tt.wantHit, ok)
+			if tt.wantHit {
+				assert.Equal(t, tt.wantID, model.ID)
+			}
+		})
+	}
+}
+
+func TestEnsureLoaded(t *testing.T) {
+	t.Run("Unknown model", func(t *testing.T) {
+		manager := newAutoLoadTestManager(t, config.AutoLoadConfig{Enabled: true})
+
+		_, err := manager.EnsureLoaded(context.Background(), "missing")
+		assert.True(t, errors.Is(err, ErrModelNotFound))
+		assert.Contains(t, err.Error(), "model not found")
+	})
+
+	t.Run("Already loaded", func(t *testing.T) {
+		manager := newAutoLoadTestManager(t, config.AutoLoadConfig{Enabled: false})
+		manager.mu.Lock()
+		manager.statuses["qwen-7b-q4"] = &ModelStatus{ID: "qwen-7b-q4", State: StateLoaded, Port: 8081}
+		manager.mu.Unlock()
+
+		id, err := manager.EnsureLoaded(context.Background(), "qwen")
+		require.NoError(t, err)
+		assert.Equal(t, "qwen-7b-q4", id)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		manager := newAutoLoadTestManager(t, config.AutoLoadConfig{Enabled: false})
+
+		_, err := manager.EnsureLoaded(context.Background(), "qwen")
+		assert.True(t, errors.Is(err, ErrAutoLoadDisabled))
+	})
+
+	t.Run("Waits for loading model", func(t *testing.T) {
+		manager := newAutoLoadTestManager(t, config.AutoLoadConfig{Enabled: true, WaitTimeout: 5})
+		manager.mu.Lock()
+		manager.statuses["qwen-7b-q4"] = &ModelStatus{ID: "qwen-7b-q4", State: StateLoading}
+		manager.mu.Unlock()
+
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			manager.mu.Lock()
+			manager.statuses["qwen-7b-q4"].State = StateLoaded
+			manager.statuses["qwen-7b-q4"].Port = 8081
+			manager.mu.Unlock()
+		}()
+
+		id, err := manager.EnsureLoaded(context.Background(), "qwen-7b-q4")
+		require.NoError(t, err)
+		assert.Equal(t, "qwen-7b-q4", id)
+	})
+
+	t.Run("Load error", func(t *testing.T) {
+		manager := newAutoLoadTestManager(t, config.AutoLoadConfig{Enabled: true, WaitTimeout: 5})
+		manager.mu.Lock()
+		manager.statuses["qwen-7b-q4"] = &ModelStatus{ID: "qwen-7b-q4", State: StateLoading}
+		manager.mu.Unlock()
+
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			manager.mu.Lock()
+			manager.statuses["qwen-7b-q4"].State = StateError
+			manager.statuses["qwen-7b-q4"].Error = errors.New("out of memory")
+			manager.mu.Unlock()
+		}()
+
+		_, err := manager.EnsureLoaded(context.Background(), "qwen-7b-q4")
+		assert.True(t, errors.Is(err, ErrAutoLoadFailed))
+		assert.Contains(t, err.Error(), "out of memory")
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		manager := newAutoLoadTestManager(t, config.AutoLoadConfig{Enabled: true, WaitTimeout: 1})
+		manager.mu.Lock()
+		manager.statuses["qwen-7b-q4"] = &ModelStatus{ID: "qwen-7b-q4", State: StateLoading}
+		manager.mu.Unlock()
+
+		_, err := manager.EnsureLoaded(context.Background(), "qwen-7b-q4")
+		assert.True(t, errors.Is(err, ErrAutoLoadTimeout))
+	})
+
+	t.Run("Context cancelled", func(t *testing.T) {
+		manager := newAutoLoadTestManager(t, config.AutoLoadConfig{Enabled: true, WaitTimeout: 30})
+		manager.mu.Lock()
+		manager.statuses["qwen-7b-q4"] = &ModelStatus{ID: "qwen-7b-q4", State: StateLoading}
+		manager.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+
+		_, err := manager.EnsureLoaded(ctx, "qwen-7b-q4")
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+}
+
+func TestMakeRoomForWithoutCandidate(t *testing.T) {
+	manager := newAutoLoadTestManager(t, config.AutoLoadConfig{Enabled: true, MaxLoadedModels: 1})
+	manager.mu.Lock()
+	manager.statuses["llama-8b-q8"] = &ModelStatus{ID: "llama-8b-q8", State: StateLoading}
+	manager.mu.Unlock()
+
+	// 唯一的名额被正在加载的模型占用，不能被抢占
+	err := manager.makeRoomFor("qwen-7b-q4", 1)
+	assert.True(t, errors.Is(err, ErrTooManyModels))
+
+	// 上限未达到时直接放行
+	assert.NoError(t, manager.makeRoomFor("qwen-7b-q4", 2))
+}
+
+func TestAutoLoadRequest(t *testing.T) {
+	manager := newAutoLoadTestManager(t, config.AutoLoadConfig{Enabled: true})
+
+	t.Run("Defaults without provider", func(t *testing.T) {
+		req, err := manager.autoLoadRequest("qwen-7b-q4")
+		require.NoError(t, err)
+		assert.Equal(t, "qwen-7b-q4", req.ModelID)
+		assert.Equal(t, 4096, req.CtxSize)
+	})
+
+	t.Run("Saved config", func(t *testing.T) {
+		manager.SetLoadConfigProvider(func(modelID string) (*LoadRequest, error) {
+			if modelID != "qwen-7b-q4" {
+				return nil, nil
+			}
+			return &LoadRequest{CtxSize: 32768, GPULayers: 99}, nil
+		})
+
+		req, err := manager.autoLoadRequest("qwen-7b-q4")
+		require.NoError(t, err)
+		assert.Equal(t, "qwen-7b-q4", req.ModelID)
+		assert.Equal(t, 32768, req.CtxSize)
+		assert.Equal(t, 99, req.GPULayers)
+
+		req, err = manager.autoLoadRequest("llama-8b-q8")
+		require.NoError(t, err)
+		assert.Equal(t, 4096, req.CtxSize)
+	})
+
+	t.Run("Provider error", func(t *testing.T) {
+		manager.SetLoadConfigProvider(func(modelID string) (*LoadRequest, error) {
+			return nil, errors.New("storage unavailable")
+		})
+
+		_, err := manager.autoLoadRequest("qwen-7b-q4")
+		assert.Error(t, err)
+	})
+}
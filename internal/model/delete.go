@@ -0,0 +1,72 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+)
+
+// ErrModelBusy is returned when a model cannot be deleted while it is loading
+var ErrModelBusy = errors.New("model is loading")
+
+// DeleteModel unloads every instance of a model, removes its files from disk
+// and forgets it. The mmproj file is kept when another model still uses it.
+func (m *Manager) DeleteModel(modelID string) error {
+	m.mu.Lock()
+
+	model, exists := m.models[modelID]
+	if !exists {
+		m.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrModelNotFound, modelID)
+	}
+
+	for id, status := range m.statuses {
+		if statusModelID(id, status) != modelID {
+			continue
+		}
+		if status.State == StateLoading || status.State == StateUnloading {
+			m.mu.Unlock()
+			return fmt.Errorf("%w: %s", ErrModelBusy, id)
+		}
+		if status.State == StateLoaded {
+			if err := m.unloadLocked(id); err != nil {
+				m.mu.Unlock()
+				return err
+			}
+		}
+		delete(m.statuses, id)
+	}
+
+	files := model.ShardFiles
+	if len(files) == 0 {
+		files = []string{model.Path}
+	}
+	if model.MmprojPath != "" {
+		shared := false
+		for id, other := range m.models {
+			if id != modelID && other.MmprojPath == model.MmprojPath {
+				shared = true
+				break
+			}
+		}
+		if !shared {
+			files = append(files, model.MmprojPath)
+		}
+	}
+	delete(m.models, modelID)
+	m.mu.Unlock()
+
+	logger.Info("删除模型", "modelId", modelID, "files", len(files))
+	var errs []error
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			logger.Error("删除模型文件失败", "path", file, "error", err)
+			errs = append(errs, err)
+		}
+	}
+
+	m.saveModels()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,63 @@
+package model
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteModel(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte("GGUF"), 0644))
+		return path
+	}
+
+	manager := NewManager(config.DefaultConfig(), nil, process.NewManager())
+	manager.mu.Lock()
+	manager.models["model-a"] = &Model{
+		ID:         "model-a",
+		Path:       write("a-00001-of-00002.gguf"),
+		ShardFiles: []string{filepath.Join(dir, "a-00001-of-00002.gguf"), write("a-00002-of-00002.gguf")},
+		MmprojPath: write("mmproj.gguf"),
+	}
+	manager.models["model-b"] = &Model{ID: "model-b", Path: write("b.gguf"), MmprojPath: filepath.Join(dir, "mmproj.gguf")}
+	manager.statuses["model-a@r1"] = &ModelStatus{ID: "model-a@r1", ModelID: "model-a", State: StateUnloaded}
+	manager.mu.Unlock()
+
+	require.NoError(t, manager.DeleteModel("model-a"))
+
+	_, exists := manager.GetModel("model-a")
+	assert.False(t, exists)
+	_, exists = manager.GetStatus("model-a@r1")
+	assert.False(t, exists)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	// mmproj 仍被 model-b 使用，保留
+	assert.ElementsMatch(t, []string{"b.gguf", "mmproj.gguf"}, names)
+
+	assert.ErrorIs(t, manager.DeleteModel("model-a"), ErrModelNotFound)
+}
+
+func TestDeleteModelLoading(t *testing.T) {
+	manager := NewManager(config.DefaultConfig(), nil, process.NewManager())
+	manager.mu.Lock()
+	manager.models["model-a"] = &Model{ID: "model-a", Path: filepath.Join(t.TempDir(), "a.gguf")}
+	manager.statuses["model-a"] = &ModelStatus{ID: "model-a", State: StateLoading}
+	manager.mu.Unlock()
+
+	assert.ErrorIs(t, manager.DeleteModel("model-a"), ErrModelBusy)
+	_, exists := manager.GetModel("model-a")
+	assert.True(t, exists)
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/gguf"
+)
+
+// ErrDraftIncompatible is returned when a draft model cannot be used for
+// speculative decoding with the target model
+var ErrDraftIncompatible = errors.New("draft model is incompatible with the target model")
+
+// DraftStats reports the speculative decoding results of a model instance
+type DraftStats struct {
+	DraftModelID   string  `json:"draftModelId"`
+	Accepted       int64   `json:"accepted"`       // 被目标模型接受的草稿 token 数
+	Generated      int64   `json:"generated"`      // 草稿模型生成的 token 数
+	AcceptanceRate float64 `json:"acceptanceRate"` // Accepted / Generated，尚无数据时为 0
+}
+
+// CheckDraftModel verifies that draftID names a scanned model whose
+// vocabulary matches the one of modelID, as llama.cpp requires for -md
+func (m *Manager) CheckDraftModel(modelID, draftID string) error {
+	_, err := m.draftModelPath(modelID, draftID)
+	return err
+}
+
+// draftModelPath 校验草稿模型并返回传给 -md 的文件路径
+func (m *Manager) draftModelPath(modelID, draftID string) (string, error) {
+	if draftID == "" {
+		return "", nil
+	}
+	if draftID == modelID {
+		return "", fmt.Errorf("%w: a model cannot be its own draft model", ErrDraftIncompatible)
+	}
+
+	target, exists := m.GetModel(modelID)
+	if !exists {
+		return "", fmt.Errorf("model not found: %s", modelID)
+	}
+	draft, exists := m.GetModel(draftID)
+	if !exists {
+		return "", fmt.Errorf("draft model not found: %s", draftID)
+	}
+	if err := gguf.CheckDraftCompatible(target.Metadata, draft.Metadata); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrDraftIncompatible, err)
+	}
+
+	if len(draft.ShardFiles) > 0 {
+		return draft.ShardFiles[0], nil
+	}
+	return draft.Path, nil
+}
+
+// recordDraftStats 累加一次请求的草稿接受统计
+func (m *Manager) recordDraftStats(status *ModelStatus, accepted, generated int) {
+	m.mu.Lock()
+	status.DraftAccepted += int64(accepted)
+	status.DraftGenerated += int64(generated)
+	m.mu.Unlock()
+}
+
+// DraftStats returns the speculative decoding stats of a model instance;
+// ok is false when the instance does not exist or runs without a draft model
+func (m *Manager) DraftStats(instanceID string) (DraftStats, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status, exists := m.statuses[instanceID]
+	if !exists || status.DraftModelID == "" {
+		return DraftStats{}, false
+	}
+
+	stats := DraftStats{
+		DraftModelID: status.DraftModelID,
+		Accepted:     status.DraftAccepted,
+		Generated:    status.DraftGenerated,
+	}
+	if stats.Generated > 0 {
+		stats.AcceptanceRate = float64(stats.Accepted) / float64(stats.Generated)
+	}
+	return stats, true
+}
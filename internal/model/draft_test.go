@@ -0,0 +1,81 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/gguf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newDraftTestManager(t *testing.T) *Manager {
+	t.Helper()
+
+	qwen := &gguf.Metadata{TokenizerModel: "gpt2", PreToken: "qwen2", TokenCount: 151936, BosTokenID: 151643, EosTokenID: 151645}
+	llama := &gguf.Metadata{TokenizerModel: "gpt2", PreToken: "llama-bpe", TokenCount: 128256, BosTokenID: 128000, EosTokenID: 128009}
+	return newTestManager(t, nil, []Model{
+		{ID: "qwen-32b", Path: "/models/qwen-32b.gguf", Metadata: qwen},
+		{ID: "qwen-0.5b", Path: "/models/qwen-0.5b.gguf", Metadata: qwen},
+		{
+			ID:         "qwen-1.5b",
+			Path:       "/models/qwen-1.5b-00001-of-00002.gguf",
+			ShardFiles: []string{"/models/qwen-1.5b-00001-of-00002.gguf", "/models/qwen-1.5b-00002-of-00002.gguf"},
+			Metadata:   qwen,
+		},
+		{ID: "llama-1b", Path: "/models/llama-1b.gguf", Metadata: llama},
+	})
+}
+
+func TestDraftModelPath(t *testing.T) {
+	manager := newDraftTestManager(t)
+
+	path, err := manager.draftModelPath("qwen-32b", "qwen-0.5b")
+	require.NoError(t, err)
+	assert.Equal(t, "/models/qwen-0.5b.gguf", path)
+
+	path, err = manager.draftModelPath("qwen-32b", "qwen-1.5b")
+	require.NoError(t, err)
+	assert.Equal(t, "/models/qwen-1.5b-00001-of-00002.gguf", path)
+
+	path, err = manager.draftModelPath("qwen-32b", "")
+	require.NoError(t, err)
+	assert.Empty(t, path)
+
+	assert.ErrorIs(t, manager.CheckDraftModel("qwen-32b", "llama-1b"), ErrDraftIncompatible)
+	assert.ErrorIs(t, manager.CheckDraftModel("qwen-32b", "qwen-32b"), ErrDraftIncompatible)
+	assert.Error(t, manager.CheckDraftModel("qwen-32b", "missing"))
+}
+
+func TestLoadRejectsIncompatibleDraft(t *testing.T) {
+	manager := newDraftTestManager(t)
+
+	_, err := manager.Load(&LoadRequest{ModelID: "qwen-32b", DraftModelID: "llama-1b"})
+	assert.ErrorIs(t, err, ErrDraftIncompatible)
+	_, err = manager.LoadAsync(&LoadRequest{ModelID: "qwen-32b", DraftModelID: "llama-1b"})
+	assert.ErrorIs(t, err, ErrDraftIncompatible)
+
+	_, exists := manager.GetStatus("qwen-32b")
+	assert.False(t, exists)
+}
+
+func TestDraftStats(t *testing.T) {
+	manager := newDraftTestManager(t)
+	status := &ModelStatus{ID: "qwen-32b", ModelID: "qwen-32b", State: StateLoaded, DraftModelID: "qwen-0.5b"}
+	manager.mu.Lock()
+	manager.statuses["qwen-32b"] = status
+	manager.statuses["llama-1b"] = &ModelStatus{ID: "llama-1b", ModelID: "llama-1b", State: StateLoaded}
+	manager.mu.Unlock()
+
+	stats, ok := manager.DraftStats("qwen-32b")
+	require.True(t, ok)
+	assert.Zero(t, stats.AcceptanceRate)
+
+	manager.recordDraftStats(status, 19, 33)
+	manager.recordDraftStats(status, 11, 17)
+	stats, ok = manager.DraftStats("qwen-32b")
+	require.True(t, ok)
+	assert.Equal(t, DraftStats{DraftModelID: "qwen-0.5b", Accepted: 30, Generated: 50, AcceptanceRate: 0.6}, stats)
+
+	_, ok = manager.DraftStats("llama-1b")
+	assert.False(t, ok)
+}
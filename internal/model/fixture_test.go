@@ -0,0 +1,34 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
+)
+
+// testModelA 是空闲卸载、排队和副本测试共用的模型
+var testModelA = []Model{{ID: "model-a", Name: "Model A"}}
+
+// newTestManager 创建带有预置模型和实例状态的管理器（不依赖配置管理器）。
+// cfg 为 nil 时使用默认配置；模型和状态按值复制，测试之间可以共用同一组数据。
+func newTestManager(t *testing.T, cfg *config.Config, models []Model, statuses ...ModelStatus) *Manager {
+	t.Helper()
+
+	if cfg == nil {
+		cfg = config.DefaultConfig()
+	}
+	manager := NewManager(cfg, nil, process.NewManager())
+
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+	for i := range models {
+		model := models[i]
+		manager.models[model.ID] = &model
+	}
+	for i := range statuses {
+		status := statuses[i]
+		manager.statuses[status.ID] = &status
+	}
+	return manager
+}
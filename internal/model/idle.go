@@ -0,0 +1,231 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+)
+
+// defaultIdleCheckInterval 配置未设置检查间隔时的默认值
+const defaultIdleCheckInterval = 30 * time.Second
+
+// IdleInfo describes the idle-unload state of a loaded model
+type IdleInfo struct {
+	ModelID        string    `json:"modelId"`
+	Pinned         bool      `json:"pinned"`
+	IdleTTL        int64     `json:"idleTtl"`       // seconds, 0 = 不自动卸载
+	IdleRemaining  int64     `json:"idleRemaining"` // seconds, -1 = 不自动卸载
+	ActiveRequests int       `json:"activeRequests"`
+	LastRequestAt  time.Time `json:"lastRequestAt,omitempty"`
+}
+
+// BeginRequest records a proxied request to a model and returns a function
+// that must be called when the request finishes. Models with requests in
+// flight are never unloaded for being idle.
+func (m *Manager) BeginRequest(modelID string) func() {
+	m.mu.Lock()
+	if status, exists := m.statuses[modelID]; exists {
+		status.ActiveRequests++
+		status.LastRequestAt = time.Now()
+	}
+	m.mu.Unlock()
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if status, exists := m.statuses[modelID]; exists {
+			if status.ActiveRequests > 0 {
+				status.ActiveRequests--
+			}
+			status.LastRequestAt = time.Now()
+		}
+	}
+}
+
+// SetKeepAlive overrides how long an instance stays loaded after its last
+// request, as requested by Ollama clients through keep_alive. A negative
+// duration keeps it loaded until it is unloaded explicitly; zero unloads it
+// as soon as no request is in flight. Pinned models are never unloaded.
+func (m *Manager) SetKeepAlive(instanceID string, keepAlive time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status, exists := m.statuses[instanceID]
+	if !exists || status.State != StateLoaded {
+		return
+	}
+	status.KeepAlive = keepAlive
+	status.KeepAliveSet = true
+
+	if keepAlive == 0 && status.ActiveRequests == 0 &&
+		m.idleTTLLocked(m.currentConfig().Gateway.IdleUnload.TTL, instanceID) > 0 {
+		logger.Info("请求指定 keep_alive 为 0，卸载模型", "modelId", instanceID)
+		if err := m.unloadLocked(instanceID); err != nil {
+			logger.Error("模型卸载失败", "modelId", instanceID, "error", err)
+		}
+	}
+}
+
+// IdleRemaining returns how long a loaded model may stay idle before it is
+// unloaded. The second return value is false when the model is not subject
+// to idle unloading.
+func (m *Manager) IdleRemaining(modelID string) (time.Duration, bool) {
+	ttl := m.idleTTL(m.currentConfig().Gateway.IdleUnload.TTL, modelID)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status, exists := m.statuses[modelID]
+	if !exists || status.State != StateLoaded || ttl <= 0 {
+		return 0, false
+	}
+	return idleRemaining(status, ttl, time.Now()), true
+}
+
+// ListIdleInfo returns the idle-unload state of all loaded models
+func (m *Manager) ListIdleInfo() []IdleInfo {
+	globalTTL := m.currentConfig().Gateway.IdleUnload.TTL
+	now := time.Now()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	infos := make([]IdleInfo, 0, len(m.statuses))
+	for id, status := range m.statuses {
+		if status.State != StateLoaded {
+			continue
+		}
+
+		info := IdleInfo{
+			ModelID:        id,
+			IdleRemaining:  -1,
+			ActiveRequests: status.ActiveRequests,
+			LastRequestAt:  status.LastRequestAt,
+		}
+		// 命名副本按所属模型判断是否固定
+		if model, exists := m.models[statusModelID(id, status)]; exists {
+			info.Pinned = model.Pinned
+		}
+		if ttl := m.idleTTLLocked(globalTTL, id); ttl > 0 {
+			info.IdleTTL = int64(ttl / time.Second)
+			info.IdleRemaining = int64(idleRemaining(status, ttl, now) / time.Second)
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// StartIdleReaper starts the background loop that unloads idle models
+func (m *Manager) StartIdleReaper() {
+	interval := time.Duration(m.currentConfig().Gateway.IdleUnload.CheckInterval) * time.Second
+	if interval <= 0 {
+		interval = defaultIdleCheckInterval
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-ticker.C:
+				m.reapIdleModels(time.Now())
+			}
+		}
+	}()
+
+	logger.Info("空闲模型卸载检查已启动", "interval", interval.String())
+}
+
+// reapIdleModels 卸载空闲时间超过 TTL 的模型，返回被卸载的模型 ID
+func (m *Manager) reapIdleModels(now time.Time) []string {
+	globalTTL := m.currentConfig().Gateway.IdleUnload.TTL
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var unloaded []string
+	for id, status := range m.statuses {
+		if status.State != StateLoaded || status.ActiveRequests > 0 {
+			continue
+		}
+		ttl := m.idleTTLLocked(globalTTL, id)
+		if ttl <= 0 || idleRemaining(status, ttl, now) > 0 {
+			continue
+		}
+
+		logger.Info("模型空闲超时，自动卸载", "modelId", id, "idleTtl", ttl.String())
+		if err := m.unloadLocked(id); err != nil {
+			logger.Error("空闲模型卸载失败", "modelId", id, "error", err)
+			continue
+		}
+		unloaded = append(unloaded, id)
+	}
+	return unloaded
+}
+
+// idleTTL 返回模型生效的空闲卸载时间，0 表示不卸载
+func (m *Manager) idleTTL(globalTTL int, modelID string) time.Duration {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.idleTTLLocked(globalTTL, modelID)
+}
+
+// idleTTLLocked 同 idleTTL，调用方需持有 m.mu
+func (m *Manager) idleTTLLocked(globalTTL int, instanceID string) time.Duration {
+	// 命名副本使用所属模型的设置
+	modelID := instanceID
+	status, hasStatus := m.statuses[instanceID]
+	if hasStatus {
+		modelID = statusModelID(instanceID, status)
+	}
+
+	ttl := globalTTL
+	if model, exists := m.models[modelID]; exists {
+		if model.Pinned || model.IdleTTL < 0 {
+			return 0
+		}
+		if model.IdleTTL > 0 {
+			ttl = model.IdleTTL
+		}
+	}
+	// 请求指定的保留时间优先于全局和模型设置，固定的模型除外
+	if hasStatus && status.KeepAliveSet {
+		if status.KeepAlive < 0 {
+			return 0
+		}
+		if status.KeepAlive == 0 {
+			return time.Nanosecond
+		}
+		return status.KeepAlive
+	}
+	if ttl <= 0 {
+		return 0
+	}
+	return time.Duration(ttl) * time.Second
+}
+
+// lastActivity 返回模型最近一次活动时间（加载完成或最近请求）
+func lastActivity(status *ModelStatus) time.Time {
+	if status.LastRequestAt.After(status.LoadedAt) {
+		return status.LastRequestAt
+	}
+	return status.LoadedAt
+}
+
+// idleRemaining 计算剩余空闲时间，有请求在处理时返回完整 TTL
+func idleRemaining(status *ModelStatus, ttl time.Duration, now time.Time) time.Duration {
+	if status.ActiveRequests > 0 {
+		return ttl
+	}
+	remaining := ttl - now.Sub(lastActivity(status))
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
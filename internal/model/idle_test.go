@@ -0,0 +1,157 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newIdleTestManager 创建一个已加载模型的管理器，全局空闲超时为 globalTTL 秒
+func newIdleTestManager(t *testing.T, globalTTL int) *Manager {
+	t.Helper()
+
+	cfg := config.DefaultConfig()
+	cfg.Gateway.IdleUnload.TTL = globalTTL
+	return newTestManager(t, cfg, testModelA, ModelStatus{
+		ID:       "model-a",
+		State:    StateLoaded,
+		Port:     8081,
+		LoadedAt: time.Now().Add(-10 * time.Minute),
+	})
+}
+
+func TestBeginRequest(t *testing.T) {
+	manager := newIdleTestManager(t, 60)
+
+	done := manager.BeginRequest("model-a")
+	status, _ := manager.GetStatus("model-a")
+	assert.Equal(t, 1, status.ActiveRequests)
+	assert.False(t, status.LastRequestAt.IsZero())
+
+	done()
+	status, _ = manager.GetStatus("model-a")
+	assert.Equal(t, 0, status.ActiveRequests)
+
+	// 未加载的模型不报错
+	manager.BeginRequest("unknown")()
+}
+
+func TestIdleTTLResolution(t *testing.T) {
+	manager := newIdleTestManager(t, 60)
+
+	assert.Equal(t, 60*time.Second, manager.idleTTL(60, "model-a"))
+
+	require.NoError(t, manager.SetIdleTTL("model-a", 300))
+	assert.Equal(t, 300*time.Second, manager.idleTTL(60, "model-a"))
+
+	require.NoError(t, manager.SetIdleTTL("model-a", -1))
+	assert.Equal(t, time.Duration(0), manager.idleTTL(60, "model-a"))
+
+	require.NoError(t, manager.SetIdleTTL("model-a", 0))
+	require.NoError(t, manager.SetPinned("model-a", true))
+	assert.Equal(t, time.Duration(0), manager.idleTTL(60, "model-a"))
+
+	assert.Error(t, manager.SetIdleTTL("model-a", -2))
+	assert.Error(t, manager.SetPinned("missing", true))
+}
+
+func TestIdleRemaining(t *testing.T) {
+	t.Run("Disabled globally", func(t *testing.T) {
+		manager := newIdleTestManager(t, 0)
+		_, ok := manager.IdleRemaining("model-a")
+		assert.False(t, ok)
+	})
+
+	t.Run("Counts from last request", func(t *testing.T) {
+		manager := newIdleTestManager(t, 3600)
+		manager.mu.Lock()
+		manager.statuses["model-a"].LastRequestAt = time.Now().Add(-time.Minute)
+		manager.mu.Unlock()
+
+		remaining, ok := manager.IdleRemaining("model-a")
+		require.True(t, ok)
+		assert.InDelta(t, float64(59*time.Minute), float64(remaining), float64(5*time.Second))
+	})
+
+	t.Run("Listed for loaded models", func(t *testing.T) {
+		manager := newIdleTestManager(t, 3600)
+		infos := manager.ListIdleInfo()
+		require.Len(t, infos, 1)
+		assert.Equal(t, "model-a", infos[0].ModelID)
+		assert.Equal(t, int64(3600), infos[0].IdleTTL)
+		assert.InDelta(t, 3000, infos[0].IdleRemaining, 5)
+
+		require.NoError(t, manager.SetPinned("model-a", true))
+		infos = manager.ListIdleInfo()
+		assert.True(t, infos[0].Pinned)
+		assert.Equal(t, int64(-1), infos[0].IdleRemaining)
+	})
+
+	t.Run("Replicas follow their model", func(t *testing.T) {
+		manager := newIdleTestManager(t, 3600)
+		replicaID := ReplicaInstanceID("model-a", "gpu1")
+		manager.mu.Lock()
+		manager.statuses[replicaID] = &ModelStatus{ID: replicaID, ModelID: "model-a", Replica: "gpu1", State: StateLoaded, Port: 8082}
+		manager.mu.Unlock()
+		require.NoError(t, manager.SetPinned("model-a", true))
+
+		infos := manager.ListIdleInfo()
+		require.Len(t, infos, 2)
+		for _, info := range infos {
+			assert.True(t, info.Pinned, info.ModelID)
+		}
+	})
+}
+
+func TestReapIdleModels(t *testing.T) {
+	t.Run("Skips models within ttl", func(t *testing.T) {
+		manager := newIdleTestManager(t, 3600)
+		assert.Empty(t, manager.reapIdleModels(time.Now()))
+	})
+
+	t.Run("Skips pinned models", func(t *testing.T) {
+		manager := newIdleTestManager(t, 60)
+		require.NoError(t, manager.SetPinned("model-a", true))
+		assert.Empty(t, manager.reapIdleModels(time.Now()))
+	})
+
+	t.Run("Skips models with requests in flight", func(t *testing.T) {
+		manager := newIdleTestManager(t, 60)
+		done := manager.BeginRequest("model-a")
+		defer done()
+		assert.Empty(t, manager.reapIdleModels(time.Now().Add(time.Hour)))
+	})
+
+	t.Run("Attempts to unload idle models", func(t *testing.T) {
+		manager := newIdleTestManager(t, 60)
+
+		// 测试环境中没有真实进程，卸载会失败，模型保持已加载状态
+		assert.Empty(t, manager.reapIdleModels(time.Now()))
+		status, _ := manager.GetStatus("model-a")
+		assert.Equal(t, StateLoaded, status.State)
+	})
+}
+
+func TestSetKeepAlive(t *testing.T) {
+	manager := newIdleTestManager(t, 60)
+
+	manager.SetKeepAlive("model-a", 10*time.Minute)
+	assert.Equal(t, 10*time.Minute, manager.idleTTL(60, "model-a"))
+
+	// 负数表示一直保留
+	manager.SetKeepAlive("model-a", -1)
+	assert.Equal(t, time.Duration(0), manager.idleTTL(60, "model-a"))
+
+	// 固定的模型不受 keep_alive 影响
+	manager.SetKeepAlive("model-a", 5*time.Minute)
+	require.NoError(t, manager.SetPinned("model-a", true))
+	assert.Equal(t, time.Duration(0), manager.idleTTL(60, "model-a"))
+
+	// 未加载的模型忽略
+	manager.SetKeepAlive("missing", time.Minute)
+	_, exists := manager.GetStatus("missing")
+	assert.False(t, exists)
+}
@@ -0,0 +1,193 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
+)
+
+// ErrAdapterIncompatible is returned when a LoRA adapter was not trained for
+// the architecture of the model it is attached to
+var ErrAdapterIncompatible = errors.New("adapter is incompatible with the model")
+
+// adapterType 是 LoRA 适配器文件的 general.type
+const adapterType = "adapter"
+
+// Adapter is a scanned LoRA adapter GGUF file
+type Adapter struct {
+	ID           string    `json:"id"`
+	Name         string    `json:"name"`
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	Architecture string    `json:"architecture"` // 适配器对应的基础模型架构
+	ScannedAt    time.Time `json:"scannedAt"`
+}
+
+// AdapterRef attaches a scanned adapter to a model at load time
+type AdapterRef struct {
+	ID    string   `json:"id"`
+	Scale *float64 `json:"scale,omitempty"` // 为空时使用 1.0；0 表示加载但暂不生效
+}
+
+// isAdapter 判断扫描到的 GGUF 文件是否为 LoRA 适配器
+func isAdapter(model *Model) bool {
+	return model.Metadata != nil && model.Metadata.Type == adapterType
+}
+
+// newAdapter 将按模型读取的适配器文件转换为目录条目
+func newAdapter(model *Model) *Adapter {
+	return &Adapter{
+		ID:           model.ID,
+		Name:         model.Name,
+		Path:         model.Path,
+		Size:         model.Size,
+		Architecture: model.Metadata.Architecture,
+		ScannedAt:    model.ScannedAt,
+	}
+}
+
+// ListAdapters returns all scanned adapters ordered by name
+func (m *Manager) ListAdapters() []*Adapter {
+	m.mu.RLock()
+	adapters := make([]*Adapter, 0, len(m.adapters))
+	for _, adapter := range m.adapters {
+		adapterCopy := *adapter
+		adapters = append(adapters, &adapterCopy)
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(adapters, func(i, j int) bool {
+		if adapters[i].Name != adapters[j].Name {
+			return adapters[i].Name < adapters[j].Name
+		}
+		return adapters[i].ID < adapters[j].ID
+	})
+	return adapters
+}
+
+// GetAdapter returns a scanned adapter by ID
+func (m *Manager) GetAdapter(id string) (*Adapter, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	adapter, exists := m.adapters[id]
+	if !exists {
+		return nil, false
+	}
+	adapterCopy := *adapter
+	return &adapterCopy, true
+}
+
+// CompatibleAdapters returns the adapters that can be attached to a model
+func (m *Manager) CompatibleAdapters(modelID string) []*Adapter {
+	model, exists := m.GetModel(modelID)
+	if !exists {
+		return nil
+	}
+
+	var compatible []*Adapter
+	for _, adapter := range m.ListAdapters() {
+		if adapterFits(model, adapter) {
+			compatible = append(compatible, adapter)
+		}
+	}
+	return compatible
+}
+
+// AdapterBaseModels returns the IDs of the models an adapter can be attached to
+func (m *Manager) AdapterBaseModels(adapterID string) []string {
+	adapter, exists := m.GetAdapter(adapterID)
+	if !exists {
+		return nil
+	}
+
+	var ids []string
+	for _, model := range m.ListModels() {
+		if adapterFits(model, adapter) {
+			ids = append(ids, model.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// adapterFits 适配器与模型的架构一致时可以挂载
+func adapterFits(model *Model, adapter *Adapter) bool {
+	return model.Metadata != nil && adapter.Architecture != "" &&
+		strings.EqualFold(model.Metadata.Architecture, adapter.Architecture)
+}
+
+// resolveAdapters 校验加载请求中的适配器并转换为启动参数
+func (m *Manager) resolveAdapters(modelID string, refs []AdapterRef) ([]process.LoraAdapter, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	model, exists := m.GetModel(modelID)
+	if !exists {
+		return nil, fmt.Errorf("model not found: %s", modelID)
+	}
+
+	seen := make(map[string]bool, len(refs))
+	adapters := make([]process.LoraAdapter, 0, len(refs))
+	for _, ref := range refs {
+		adapter, exists := m.GetAdapter(ref.ID)
+		if !exists {
+			return nil, fmt.Errorf("adapter not found: %s", ref.ID)
+		}
+		if seen[adapter.ID] {
+			return nil, fmt.Errorf("adapter attached twice: %s", adapter.ID)
+		}
+		seen[adapter.ID] = true
+		if !adapterFits(model, adapter) {
+			arch := ""
+			if model.Metadata != nil {
+				arch = model.Metadata.Architecture
+			}
+			return nil, fmt.Errorf("%w: adapter %s is for %q, model is %q", ErrAdapterIncompatible, adapter.ID, adapter.Architecture, arch)
+		}
+
+		scale := 1.0
+		if ref.Scale != nil {
+			scale = *ref.Scale
+		}
+		adapters = append(adapters, process.LoraAdapter{Path: adapter.Path, Scale: scale})
+	}
+	return adapters, nil
+}
+
+// CheckAdapters verifies that the adapters of a load request exist and
+// match the architecture of the model
+func (m *Manager) CheckAdapters(modelID string, refs []AdapterRef) error {
+	_, err := m.resolveAdapters(modelID, refs)
+	return err
+}
+
+// InstanceAdapters returns the adapter IDs a loaded instance was started
+// with, in llama-server adapter ID order, and the port of the instance
+func (m *Manager) InstanceAdapters(instanceID string) (adapterIDs []string, port int, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status, exists := m.statuses[instanceID]
+	if !exists || status.State != StateLoaded {
+		return nil, 0, false
+	}
+	return append([]string(nil), status.Adapters...), status.Port, true
+}
+
+// adapterIDs 返回加载请求中的适配器 ID
+func adapterIDs(refs []AdapterRef) []string {
+	if len(refs) == 0 {
+		return nil
+	}
+	ids := make([]string, len(refs))
+	for i, ref := range refs {
+		ids[i] = ref.ID
+	}
+	return ids
+}
@@ -0,0 +1,93 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/gguf"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLoraTestManager(t *testing.T) *Manager {
+	t.Helper()
+
+	manager := newTestManager(t, nil, []Model{
+		{ID: "llama-8b", Metadata: &gguf.Metadata{Type: "model", Architecture: "llama"}},
+		{ID: "llama-3b", Metadata: &gguf.Metadata{Type: "model", Architecture: "llama"}},
+		{ID: "qwen-7b", Metadata: &gguf.Metadata{Type: "model", Architecture: "qwen2"}},
+	})
+	manager.mu.Lock()
+	for _, adapter := range []*Adapter{
+		{ID: "sql", Name: "SQL", Path: "/adapters/sql.gguf", Architecture: "llama"},
+		{ID: "chat", Name: "Chat", Path: "/adapters/chat.gguf", Architecture: "LLaMA"},
+		{ID: "qwen-code", Name: "Code", Path: "/adapters/qwen-code.gguf", Architecture: "qwen2"},
+	} {
+		manager.adapters[adapter.ID] = adapter
+	}
+	manager.mu.Unlock()
+
+	return manager
+}
+
+func TestIsAdapter(t *testing.T) {
+	assert.True(t, isAdapter(&Model{Metadata: &gguf.Metadata{Type: "adapter"}}))
+	assert.False(t, isAdapter(&Model{Metadata: &gguf.Metadata{Type: "model"}}))
+	assert.False(t, isAdapter(&Model{}))
+}
+
+func TestAdapterCatalog(t *testing.T) {
+	manager := newLoraTestManager(t)
+
+	var names []string
+	for _, adapter := range manager.ListAdapters() {
+		names = append(names, adapter.Name)
+	}
+	assert.Equal(t, []string{"Chat", "Code", "SQL"}, names)
+
+	var compatible []string
+	for _, adapter := range manager.CompatibleAdapters("llama-8b") {
+		compatible = append(compatible, adapter.ID)
+	}
+	assert.Equal(t, []string{"chat", "sql"}, compatible)
+	assert.Nil(t, manager.CompatibleAdapters("missing"))
+
+	assert.Equal(t, []string{"llama-3b", "llama-8b"}, manager.AdapterBaseModels("sql"))
+	assert.Equal(t, []string{"qwen-7b"}, manager.AdapterBaseModels("qwen-code"))
+}
+
+func TestResolveAdapters(t *testing.T) {
+	manager := newLoraTestManager(t)
+	half := 0.5
+
+	adapters, err := manager.resolveAdapters("llama-8b", []AdapterRef{{ID: "sql"}, {ID: "chat", Scale: &half}})
+	require.NoError(t, err)
+	assert.Equal(t, []process.LoraAdapter{
+		{Path: "/adapters/sql.gguf", Scale: 1},
+		{Path: "/adapters/chat.gguf", Scale: 0.5},
+	}, adapters)
+
+	assert.ErrorIs(t, manager.CheckAdapters("llama-8b", []AdapterRef{{ID: "qwen-code"}}), ErrAdapterIncompatible)
+	assert.Error(t, manager.CheckAdapters("llama-8b", []AdapterRef{{ID: "missing"}}))
+	assert.Error(t, manager.CheckAdapters("llama-8b", []AdapterRef{{ID: "sql"}, {ID: "sql"}}))
+	assert.NoError(t, manager.CheckAdapters("llama-8b", nil))
+
+	_, err = manager.Load(&LoadRequest{ModelID: "llama-8b", Adapters: []AdapterRef{{ID: "qwen-code"}}})
+	assert.ErrorIs(t, err, ErrAdapterIncompatible)
+}
+
+func TestInstanceAdapters(t *testing.T) {
+	manager := newLoraTestManager(t)
+	manager.mu.Lock()
+	manager.statuses["llama-8b"] = &ModelStatus{ID: "llama-8b", ModelID: "llama-8b", State: StateLoaded, Port: 8081, Adapters: []string{"sql", "chat"}}
+	manager.statuses["qwen-7b"] = &ModelStatus{ID: "qwen-7b", ModelID: "qwen-7b", State: StateLoading}
+	manager.mu.Unlock()
+
+	ids, port, ok := manager.InstanceAdapters("llama-8b")
+	require.True(t, ok)
+	assert.Equal(t, []string{"sql", "chat"}, ids)
+	assert.Equal(t, 8081, port)
+
+	_, _, ok = manager.InstanceAdapters("qwen-7b")
+	assert.False(t, ok)
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/shepherd-project/shepherd/Shepherd/internal/gguf"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tokenizer"
 )
 
 // Manager manages model scanning and loading
@@ -26,9 +27,30 @@ type Manager struct {
 	processMgr *process.Manager
 
 	models     map[string]*Model
+	adapters   map[string]*Adapter // LoRA 适配器，与模型分开编目
 	statuses   map[string]*ModelStatus
 	scanStatus *ScanStatus
 
+	// 按需加载
+	loadConfigProvider LoadConfigProvider
+	autoLoadMu         sync.Mutex
+
+	// 请求排队（按模型并发槽位限流）
+	queues  map[string]*admissionQueue
+	queueMu sync.Mutex
+
+	// 副本负载均衡
+	replicaFailures map[string]time.Time // 实例 ID -> 最近一次上游连接失败时间
+	replicaNext     map[string]uint64    // 模型 ID -> 轮询计数
+	replicaMu       sync.Mutex
+
+	// 槽位存档目录索引
+	slotMu sync.Mutex
+
+	// 未加载模型的本地分词器缓存
+	tokenizers  map[string]*tokenizer.Tokenizer
+	tokenizerMu sync.Mutex
+
 	mu     sync.RWMutex
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -53,10 +75,16 @@ func NewManager(cfg *config.Config, cfgMgr *config.Manager, procMgr *process.Man
 		configMgr:  cfgMgr,
 		processMgr: procMgr,
 		models:     make(map[string]*Model),
+		adapters:   make(map[string]*Adapter),
 		statuses:   make(map[string]*ModelStatus),
 		scanStatus: &ScanStatus{},
+		queues:     make(map[string]*admissionQueue),
 		ctx:        ctx,
 		cancel:     cancel,
+
+		replicaFailures: make(map[string]time.Time),
+		replicaNext:     make(map[string]uint64),
+		tokenizers:      make(map[string]*tokenizer.Tokenizer),
 	}
 
 	// Log initialization info
@@ -118,7 +146,15 @@ func (m *Manager) Scan(ctx context.Context) (*ScanResult, error) {
 	// Update models map（先清空，再添加）
 	m.mu.Lock()
 	m.models = make(map[string]*Model) // 清空旧数据
+	m.adapters = make(map[string]*Adapter)
 	for _, model := range result.Models {
+		// LoRA 适配器单独编目，不作为可加载模型
+		if isAdapter(model) {
+			adapter := newAdapter(model)
+			m.adapters[adapter.ID] = adapter
+			result.Adapters = append(result.Adapters, adapter)
+			continue
+		}
 		m.models[model.ID] = model
 	}
 
@@ -129,8 +165,9 @@ func (m *Manager) Scan(ctx context.Context) (*ScanResult, error) {
 	}
 
 	modelCount := len(m.models)
+	adapterCount := len(m.adapters)
 	m.mu.Unlock()
-	logger.Info("模型缓存已更新", "modelCount", modelCount)
+	logger.Info("模型缓存已更新", "modelCount", modelCount, "adapterCount", adapterCount)
 
 	// Save to config
 	m.saveModels()
@@ -482,6 +519,11 @@ func (m *Manager) getScanPaths() []string {
 	return cfg.Model.Paths
 }
 
+// ScanPaths returns the configured model scan paths
+func (m *Manager) ScanPaths() []string {
+	return m.getScanPaths()
+}
+
 // calculatePathPrefix calculates a short path prefix for display
 func (m *Manager) calculatePathPrefix(path string) string {
 	// Get directory of the model file
@@ -592,26 +634,54 @@ func (m *Manager) Load(req *LoadRequest) (*LoadResult, error) {
 		return nil, fmt.Errorf("model not found: %s", req.ModelID)
 	}
 
-	logger.Info("开始加载模型", "modelId", req.ModelID, "modelName", model.Name, "ctxSize", req.CtxSize, "gpuLayers", req.GPULayers)
+	draftPath, err := m.draftModelPath(req.ModelID, req.DraftModelID)
+	if err != nil {
+		logger.Warn("模型加载失败: 草稿模型不可用", "modelId", req.ModelID, "draftModelId", req.DraftModelID, "error", err)
+		return nil, err
+	}
+	loraAdapters, err := m.resolveAdapters(req.ModelID, req.Adapters)
+	if err != nil {
+		logger.Warn("模型加载失败: LoRA 适配器不可用", "modelId", req.ModelID, "error", err)
+		return nil, err
+	}
+
+	instanceID := ReplicaInstanceID(req.ModelID, req.Replica)
+	logger.Info("开始加载模型", "modelId", instanceID, "modelName", model.Name, "ctxSize", req.CtxSize, "gpuLayers", req.GPULayers)
 
 	// Check if already loading
 	m.mu.Lock()
-	if status, exists := m.statuses[req.ModelID]; exists && status.State == StateLoading {
+	if status, exists := m.statuses[instanceID]; exists && status.State == StateLoading {
 		m.mu.Unlock()
-		logger.Warn("模型加载失败: 模型正在加载中", "modelId", req.ModelID)
-		return nil, fmt.Errorf("model already loading: %s", req.ModelID)
+		logger.Warn("模型加载失败: 模型正在加载中", "modelId", instanceID)
+		return nil, fmt.Errorf("model already loading: %s", instanceID)
 	}
 
 	// Create status
 	status := &ModelStatus{
-		ID:    req.ModelID,
-		Name:  model.Name,
-		State: StateLoading,
-	}
-	m.statuses[req.ModelID] = status
+		ID:            instanceID,
+		ModelID:       req.ModelID,
+		Replica:       req.Replica,
+		Name:          model.Name,
+		State:         StateLoading,
+		CtxSize:       req.CtxSize,
+		Embedding:     req.Embedding,
+		Reranking:     req.Reranking,
+		UBatchSize:    req.UBatchSize,
+		Vision:        req.MmprojPath != "",
+		ParallelSlots: req.ParallelSlots,
+		DraftModelID:  req.DraftModelID,
+		Adapters:      adapterIDs(req.Adapters),
+		Metrics:       req.EnableMetrics,
+		SlotSavePath:  req.SlotSavePath,
+	}
+	m.statuses[instanceID] = status
 	m.mu.Unlock()
 
 	startTime := time.Now()
+	defer m.observeLoad(status, startTime)
+	trace := startLoadTrace(req, instanceID, false)
+	defer m.endLoadTrace(trace, status)
+	trace.next("prepare")
 
 	// Find llama.cpp binary
 	binPath := m.findLlamaCppBinary()
@@ -620,10 +690,10 @@ func (m *Manager) Load(req *LoadRequest) (*LoadResult, error) {
 		status.State = StateError
 		status.Error = fmt.Errorf("llama.cpp binary not found")
 		m.mu.Unlock()
-		logger.Error("模型加载失败: llama.cpp 二进制文件未找到", "modelId", req.ModelID)
+		logger.Error("模型加载失败: llama.cpp 二进制文件未找到", "modelId", status.ID)
 		return &LoadResult{
 			Success: false,
-			ModelID: req.ModelID,
+			ModelID: status.ID,
 			Error:   status.Error,
 		}, status.Error
 	}
@@ -639,6 +709,8 @@ func (m *Manager) Load(req *LoadRequest) (*LoadResult, error) {
 
 	// Convert to process.LoadRequest and build command
 	procReq := toProcessLoadRequest(req, modelPath, port)
+	procReq.DraftModelPath = draftPath
+	procReq.LoraAdapters = loraAdapters
 	cmd, err := process.BuildCommandFromRequest(procReq, binPath)
 	if err != nil {
 		m.mu.Lock()
@@ -647,22 +719,23 @@ func (m *Manager) Load(req *LoadRequest) (*LoadResult, error) {
 		m.mu.Unlock()
 		return &LoadResult{
 			Success: false,
-			ModelID: req.ModelID,
+			ModelID: status.ID,
 			Error:   err,
 		}, err
 	}
 
 	// Start process
-	proc, err := m.processMgr.Start(req.ModelID, model.Name, cmd, binPath)
+	trace.next("start_process")
+	proc, err := m.processMgr.Start(status.ID, model.Name, cmd, binPath)
 	if err != nil {
 		m.mu.Lock()
 		status.State = StateError
 		status.Error = err
 		m.mu.Unlock()
-		logger.Error("模型加载失败: 启动进程失败", "modelId", req.ModelID, "error", err)
+		logger.Error("模型加载失败: 启动进程失败", "modelId", status.ID, "error", err)
 		return &LoadResult{
 			Success: false,
-			ModelID: req.ModelID,
+			ModelID: status.ID,
 			Error:   err,
 		}, err
 	}
@@ -671,7 +744,11 @@ func (m *Manager) Load(req *LoadRequest) (*LoadResult, error) {
 	proc.SetOutputHandler(func(line string) {
 		// 过滤掉过于频繁的日志
 		if !strings.Contains(line, "update_slots") && !strings.Contains(line, "log_server_r") {
-			logger.Debug(fmt.Sprintf("[%s] %s", req.ModelID, line))
+			logger.Debug(fmt.Sprintf("[%s] %s", status.ID, line))
+		}
+
+		if accepted, generated, ok := process.ParseDraftAcceptance(line); ok {
+			m.recordDraftStats(status, accepted, generated)
 		}
 	})
 
@@ -685,11 +762,14 @@ func (m *Manager) Load(req *LoadRequest) (*LoadResult, error) {
 
 	duration := time.Since(startTime)
 
-	logger.Info("模型加载成功", "modelId", req.ModelID, "port", port, "duration", duration.String(), "pid", proc.GetPID())
+	logger.Info("模型加载成功", "modelId", status.ID, "port", port, "duration", duration.String(), "pid", proc.GetPID())
+	if req.RestoreSlots {
+		m.startSlotRestore(status.ID, port, req.SlotSavePath)
+	}
 
 	return &LoadResult{
 		Success:  true,
-		ModelID:  req.ModelID,
+		ModelID:  status.ID,
 		Port:     port,
 		CtxSize:  req.CtxSize,
 		Duration: duration,
@@ -704,14 +784,24 @@ func (m *Manager) LoadAsync(req *LoadRequest) (*LoadResult, error) {
 		return nil, fmt.Errorf("model not found: %s", req.ModelID)
 	}
 
+	// 草稿模型或适配器不可用时直接拒绝，避免启动后才失败
+	if err := m.CheckDraftModel(req.ModelID, req.DraftModelID); err != nil {
+		return nil, err
+	}
+	if err := m.CheckAdapters(req.ModelID, req.Adapters); err != nil {
+		return nil, err
+	}
+
+	instanceID := ReplicaInstanceID(req.ModelID, req.Replica)
+
 	// Check if already loaded
 	m.mu.RLock()
-	if status, exists := m.statuses[req.ModelID]; exists {
+	if status, exists := m.statuses[instanceID]; exists {
 		if status.State == StateLoaded {
 			m.mu.RUnlock()
 			return &LoadResult{
 				Success:  true,
-				ModelID:  req.ModelID,
+				ModelID:  status.ID,
 				Port:     status.Port,
 				Async:    true,
 				AlreadyLoaded: true,
@@ -721,7 +811,7 @@ func (m *Manager) LoadAsync(req *LoadRequest) (*LoadResult, error) {
 			m.mu.RUnlock()
 			return &LoadResult{
 				Success:  true,
-				ModelID:  req.ModelID,
+				ModelID:  status.ID,
 				Async:    true,
 				Loading:  true,
 			}, nil
@@ -732,11 +822,23 @@ func (m *Manager) LoadAsync(req *LoadRequest) (*LoadResult, error) {
 	// 创建初始状态
 	m.mu.Lock()
 	status := &ModelStatus{
-		ID:    req.ModelID,
-		Name:  model.Name,
-		State: StateLoading,
-	}
-	m.statuses[req.ModelID] = status
+		ID:            instanceID,
+		ModelID:       req.ModelID,
+		Replica:       req.Replica,
+		Name:          model.Name,
+		State:         StateLoading,
+		CtxSize:       req.CtxSize,
+		Embedding:     req.Embedding,
+		Reranking:     req.Reranking,
+		UBatchSize:    req.UBatchSize,
+		Vision:        req.MmprojPath != "",
+		ParallelSlots: req.ParallelSlots,
+		DraftModelID:  req.DraftModelID,
+		Adapters:      adapterIDs(req.Adapters),
+		Metrics:       req.EnableMetrics,
+		SlotSavePath:  req.SlotSavePath,
+	}
+	m.statuses[instanceID] = status
 	m.mu.Unlock()
 
 	// 启动异步加载
@@ -744,7 +846,7 @@ func (m *Manager) LoadAsync(req *LoadRequest) (*LoadResult, error) {
 
 	return &LoadResult{
 		Success:  true,
-		ModelID:  req.ModelID,
+		ModelID:  status.ID,
 		Async:    true,
 		Loading:  true,
 	}, nil
@@ -753,8 +855,12 @@ func (m *Manager) LoadAsync(req *LoadRequest) (*LoadResult, error) {
 // loadModelAsync 后台异步加载模型
 func (m *Manager) loadModelAsync(req *LoadRequest, status *ModelStatus) {
 	startTime := time.Now()
+	defer m.observeLoad(status, startTime)
+	trace := startLoadTrace(req, status.ID, true)
+	defer m.endLoadTrace(trace, status)
+	trace.next("prepare")
 
-	logger.Info("开始异步加载模型", "modelId", req.ModelID)
+	logger.Info("开始异步加载模型", "modelId", status.ID)
 
 	// Find llama.cpp binary
 	binPath := m.findLlamaCppBinary()
@@ -763,7 +869,7 @@ func (m *Manager) loadModelAsync(req *LoadRequest, status *ModelStatus) {
 		status.State = StateError
 		status.Error = fmt.Errorf("llama.cpp binary not found")
 		m.mu.Unlock()
-		logger.Error("异步模型加载失败: llama.cpp 二进制文件未找到", "modelId", req.ModelID)
+		logger.Error("异步模型加载失败: llama.cpp 二进制文件未找到", "modelId", status.ID)
 		return
 	}
 
@@ -774,33 +880,55 @@ func (m *Manager) loadModelAsync(req *LoadRequest, status *ModelStatus) {
 	modelPath := model.Path
 	if len(model.ShardFiles) > 0 {
 		modelPath = model.ShardFiles[0]
-		logger.Info("使用分卷模型主文件", "modelId", req.ModelID, "mainFile", modelPath, "shardCount", len(model.ShardFiles))
+		logger.Info("使用分卷模型主文件", "modelId", status.ID, "mainFile", modelPath, "shardCount", len(model.ShardFiles))
+	}
+
+	draftPath, err := m.draftModelPath(req.ModelID, req.DraftModelID)
+	if err != nil {
+		m.mu.Lock()
+		status.State = StateError
+		status.Error = err
+		m.mu.Unlock()
+		logger.Error("异步模型加载失败: 草稿模型不可用", "modelId", status.ID, "draftModelId", req.DraftModelID, "error", err)
+		return
+	}
+	loraAdapters, err := m.resolveAdapters(req.ModelID, req.Adapters)
+	if err != nil {
+		m.mu.Lock()
+		status.State = StateError
+		status.Error = err
+		m.mu.Unlock()
+		logger.Error("异步模型加载失败: LoRA 适配器不可用", "modelId", status.ID, "error", err)
+		return
 	}
 
 	// Convert to process.LoadRequest and build command
 	procReq := toProcessLoadRequest(req, modelPath, port)
+	procReq.DraftModelPath = draftPath
+	procReq.LoraAdapters = loraAdapters
 	cmd, err := process.BuildCommandFromRequest(procReq, binPath)
 	if err != nil {
 		m.mu.Lock()
 		status.State = StateError
 		status.Error = err
 		m.mu.Unlock()
-		logger.Error("异步模型加载失败: 构建命令失败", "modelId", req.ModelID, "error", err)
+		logger.Error("异步模型加载失败: 构建命令失败", "modelId", status.ID, "error", err)
 		return
 	}
 
 	// Start process
-	proc, err := m.processMgr.Start(req.ModelID, model.Name, cmd, binPath)
+	trace.next("start_process")
+	proc, err := m.processMgr.Start(status.ID, model.Name, cmd, binPath)
 	if err != nil {
 		m.mu.Lock()
 		status.State = StateError
 		status.Error = err
 		m.mu.Unlock()
-		logger.Error("异步模型加载失败: 启动进程失败", "modelId", req.ModelID, "error", err)
+		logger.Error("异步模型加载失败: 启动进程失败", "modelId", status.ID, "error", err)
 		return
 	}
 
-	logger.Info("异步模型加载: 进程已启动", "modelId", req.ModelID, "pid", proc.GetPID(), "port", port)
+	logger.Info("异步模型加载: 进程已启动", "modelId", status.ID, "pid", proc.GetPID(), "port", port)
 
 	// 等待加载完成（监控进程输出）
 	loadCompleted := make(chan bool, 1)
@@ -812,7 +940,11 @@ func (m *Manager) loadModelAsync(req *LoadRequest, status *ModelStatus) {
 		// 过滤掉过于频繁的日志
 		if !strings.Contains(line, "update_slots") && !strings.Contains(line, "log_server_r") {
 			// 使用 debug 级别记录 llama.cpp 输出，避免日志过多
-			logger.Debug(fmt.Sprintf("[%s] %s", req.ModelID, line))
+			logger.Debug(fmt.Sprintf("[%s] %s", status.ID, line))
+		}
+
+		if accepted, generated, ok := process.ParseDraftAcceptance(line); ok {
+			m.recordDraftStats(status, accepted, generated)
 		}
 
 		// 检测加载完成
@@ -825,6 +957,7 @@ func (m *Manager) loadModelAsync(req *LoadRequest, status *ModelStatus) {
 	})
 
 	// 等待加载完成或超时
+	trace.next("wait_ready")
 	select {
 	case <-loadCompleted:
 		m.mu.Lock()
@@ -834,25 +967,28 @@ func (m *Manager) loadModelAsync(req *LoadRequest, status *ModelStatus) {
 		status.LoadedAt = time.Now()
 		m.mu.Unlock()
 		duration := time.Since(startTime)
-		logger.Info("异步模型加载成功", "modelId", req.ModelID, "port", port, "duration", duration.String())
+		logger.Info("异步模型加载成功", "modelId", status.ID, "port", port, "duration", duration.String())
+		if req.RestoreSlots {
+			m.startSlotRestore(status.ID, port, req.SlotSavePath)
+		}
 
 	case err := <-loadError:
 		m.mu.Lock()
 		status.State = StateError
 		status.Error = err
 		m.mu.Unlock()
-		logger.Error("异步模型加载失败", "modelId", req.ModelID, "error", err)
+		logger.Error("异步模型加载失败", "modelId", status.ID, "error", err)
 		// 清理进程
-		m.processMgr.Stop(req.ModelID)
+		m.processMgr.Stop(status.ID)
 
 	case <-time.After(10 * time.Minute):
 		m.mu.Lock()
 		status.State = StateError
 		status.Error = fmt.Errorf("模型加载超时 (10分钟)")
 		m.mu.Unlock()
-		logger.Error("异步模型加载超时", "modelId", req.ModelID, "timeout", "10m")
+		logger.Error("异步模型加载超时", "modelId", status.ID, "timeout", "10m")
 		// 清理进程
-		m.processMgr.Stop(req.ModelID)
+		m.processMgr.Stop(status.ID)
 	}
 }
 
@@ -872,6 +1008,11 @@ func (m *Manager) Unload(modelID string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	return m.unloadLocked(modelID)
+}
+
+// unloadLocked 停止模型进程并更新状态，调用方需持有 m.mu
+func (m *Manager) unloadLocked(modelID string) error {
 	status, exists := m.statuses[modelID]
 	if !exists {
 		logger.Warn("模型卸载失败: 模型未加载", "modelId", modelID)
@@ -886,7 +1027,10 @@ func (m *Manager) Unload(modelID string) error {
 	logger.Info("开始卸载模型", "modelId", modelID, "modelName", status.Name, "port", status.Port)
 
 	// Stop process
-	if err := m.processMgr.Stop(modelID); err != nil {
+	startTime := time.Now()
+	err := m.processMgr.Stop(modelID)
+	observeUnload(modelID, startTime, err)
+	if err != nil {
 		logger.Error("模型卸载失败: 停止进程失败", "modelId", modelID, "error", err)
 		return err
 	}
@@ -895,6 +1039,7 @@ func (m *Manager) Unload(modelID string) error {
 	status.State = StateUnloaded
 	status.ProcessID = ""
 	status.Port = 0
+	m.dropQueue(modelID)
 
 	logger.Info("模型卸载成功", "modelId", modelID, "modelName", status.Name)
 
@@ -983,6 +1128,71 @@ func (m *Manager) SetFavourite(modelID string, favourite bool) error {
 	return nil
 }
 
+// SetPinned sets whether a model is exempt from idle unloading
+func (m *Manager) SetPinned(modelID string, pinned bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	model, exists := m.models[modelID]
+	if !exists {
+		return fmt.Errorf("model not found: %s", modelID)
+	}
+
+	model.Pinned = pinned
+
+	// Save to config
+	if m.configMgr != nil {
+		if err := m.configMgr.SaveModelPinned(modelID, pinned); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SetIdleTTL sets a model's idle unload timeout in seconds
+// (0 = use the global setting, -1 = never unload)
+func (m *Manager) SetIdleTTL(modelID string, idleTTL int) error {
+	if idleTTL < -1 {
+		return fmt.Errorf("invalid idle ttl: %d", idleTTL)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	model, exists := m.models[modelID]
+	if !exists {
+		return fmt.Errorf("model not found: %s", modelID)
+	}
+
+	model.IdleTTL = idleTTL
+
+	// Save to config
+	if m.configMgr != nil {
+		if err := m.configMgr.SaveModelIdleTTL(modelID, idleTTL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RecordTokens adds the tokens used by a request to the model's running total
+// and returns the ID of the model the instance belongs to
+func (m *Manager) RecordTokens(instanceID string, tokens int64) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	modelID := instanceID
+	if status, exists := m.statuses[instanceID]; exists {
+		modelID = statusModelID(instanceID, status)
+	}
+	if model, exists := m.models[modelID]; exists {
+		model.TotalTokens += tokens
+	}
+	return modelID
+}
+
 // loadModels loads models from config
 func (m *Manager) loadModels() {
 	if m.configMgr == nil {
@@ -1014,7 +1224,10 @@ func (m *Manager) loadModels() {
 		// Try to load the model from disk
 		if info, err := os.Stat(cfgModel.Path); err == nil && !info.IsDir() {
 			model, err := m.loadModel(cfgModel.Path)
-			if err == nil {
+			if err == nil && isAdapter(model) {
+				model.ID = cfgModel.ModelID
+				m.adapters[model.ID] = newAdapter(model)
+			} else if err == nil {
 				model.ID = cfgModel.ModelID
 				if alias, ok := aliases[model.ID]; ok {
 					model.Alias = alias
@@ -1022,6 +1235,8 @@ func (m *Manager) loadModels() {
 				if fav, ok := favourites[model.ID]; ok {
 					model.Favourite = fav
 				}
+				model.Pinned = cfgModel.Pinned
+				model.IdleTTL = cfgModel.IdleTTL
 
 				// 加载分卷模型信息（如果配置中有保存）
 				if cfgModel.ShardCount > 0 && len(cfgModel.ShardFiles) > 0 {
@@ -1079,6 +1294,8 @@ func (m *Manager) saveModels() {
 			Size:      model.Size,
 			Alias:     model.Alias,
 			Favourite: model.Favourite,
+			Pinned:    model.Pinned,
+			IdleTTL:   model.IdleTTL,
 		}
 
 		// 保存分卷模型信息
@@ -1121,6 +1338,20 @@ func (m *Manager) saveModels() {
 		configModels = append(configModels, entry)
 	}
 
+	// LoRA 适配器与模型保存在同一列表，加载时按文件类型区分
+	for _, adapter := range m.adapters {
+		configModels = append(configModels, config.ModelConfigEntry{
+			ModelID: adapter.ID,
+			Path:    adapter.Path,
+			Size:    adapter.Size,
+			PrimaryModel: &config.PrimaryModelInfo{
+				FileName:     filepath.Base(adapter.Path),
+				Name:         adapter.Name,
+				Architecture: adapter.Architecture,
+			},
+		})
+	}
+
 	m.configMgr.SaveModelsConfig(configModels)
 }
 
@@ -1729,6 +1960,7 @@ func toProcessLoadRequest(req *LoadRequest, modelPath string, port int) *process
 		// Additional sampling parameters
 		LogitsAll:        req.LogitsAll,
 		Reranking:        req.Reranking,
+		Embedding:        req.Embedding,
 		MinP:             req.MinP,
 		PresencePenalty:  req.PresencePenalty,
 		FrequencyPenalty: req.FrequencyPenalty,
@@ -1737,5 +1969,10 @@ func toProcessLoadRequest(req *LoadRequest, modelPath string, port int) *process
 		DisableJinja:     req.DisableJinja,
 		ChatTemplate:     req.ChatTemplate,
 		ContextShift:     req.ContextShift,
+		// Speculative decoding (DraftModelPath is resolved by the caller)
+		DraftMax:       req.DraftMax,
+		DraftMin:       req.DraftMin,
+		DraftGPULayers: req.DraftGPULayers,
+		DraftDevices:   req.DraftDevices,
 	}
 }
\ No newline at end of file
@@ -0,0 +1,72 @@
+package model
+
+import (
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/metrics"
+)
+
+// 模型加载和卸载耗时，按实例 ID 和结果区分
+var (
+	loadDuration = metrics.NewHistogramVec("shepherd_model_load_duration_seconds",
+		"Time taken to start a llama-server instance until it is ready.",
+		[]float64{1, 2.5, 5, 10, 20, 30, 60, 120, 300, 600}, "model", "result")
+	unloadDuration = metrics.NewHistogramVec("shepherd_model_unload_duration_seconds",
+		"Time taken to stop a llama-server instance.",
+		[]float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}, "model", "result")
+)
+
+// observeLoad 记录加载耗时，结果取决于加载结束时的状态
+func (m *Manager) observeLoad(status *ModelStatus, start time.Time) {
+	m.mu.RLock()
+	state := status.State
+	m.mu.RUnlock()
+
+	result := "success"
+	if state != StateLoaded {
+		result = "error"
+	}
+	loadDuration.Observe(time.Since(start).Seconds(), status.ID, result)
+}
+
+// observeUnload 记录卸载耗时
+func observeUnload(modelID string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	unloadDuration.Observe(time.Since(start).Seconds(), modelID, result)
+}
+
+// Collect exports the state, slots and admission queue of every model
+// instance
+func (m *Manager) Collect() []*metrics.Family {
+	states := metrics.NewFamily("shepherd_model_state",
+		"Current state of each model instance (1 for the current state).", metrics.TypeGauge)
+	for _, status := range m.ListStatus() {
+		for _, state := range []LoadState{StateUnloaded, StateLoading, StateLoaded, StateUnloading, StateError} {
+			value := 0.0
+			if status.State == state {
+				value = 1
+			}
+			states.Add(value, "model", status.ID, "state", state.String())
+		}
+	}
+
+	queued := metrics.NewFamily("shepherd_model_queue_depth", "Requests waiting for a free slot.", metrics.TypeGauge)
+	active := metrics.NewFamily("shepherd_model_active_requests", "Requests holding a slot.", metrics.TypeGauge)
+	slots := metrics.NewFamily("shepherd_model_slots", "Parallel slots of the model instance.", metrics.TypeGauge)
+	admitted := metrics.NewFamily("shepherd_model_queue_admitted_total", "Requests admitted to the model.", metrics.TypeCounter)
+	rejected := metrics.NewFamily("shepherd_model_queue_rejected_total", "Requests rejected because the queue was full.", metrics.TypeCounter)
+	timedOut := metrics.NewFamily("shepherd_model_queue_timeouts_total", "Requests that timed out in the queue.", metrics.TypeCounter)
+	for _, q := range m.ListQueueStats() {
+		queued.Add(float64(q.Queued), "model", q.ModelID)
+		active.Add(float64(q.Active), "model", q.ModelID)
+		slots.Add(float64(q.Slots), "model", q.ModelID)
+		admitted.Add(float64(q.Admitted), "model", q.ModelID)
+		rejected.Add(float64(q.Rejected), "model", q.ModelID)
+		timedOut.Add(float64(q.TimedOut), "model", q.ModelID)
+	}
+
+	return []*metrics.Family{states, queued, active, slots, admitted, rejected, timedOut}
+}
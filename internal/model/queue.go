@@ -0,0 +1,311 @@
+package model
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
+)
+
+// 请求排队相关错误，API 层据此返回 429/503 并附带 Retry-After
+var (
+	ErrQueueFull    = errors.New("model request queue is full")
+	ErrQueueTimeout = errors.New("timed out waiting in model request queue")
+	ErrQueueClosed  = errors.New("model was unloaded while the request was queued")
+)
+
+const (
+	// defaultParallelSlots llama.cpp 未指定 --parallel 时自动使用的槽位数
+	defaultParallelSlots = 4
+	// defaultQueueMaxQueued 配置未设置排队上限时的默认值
+	defaultQueueMaxQueued = 32
+	// defaultQueueTimeout 配置未设置排队超时时的默认值
+	defaultQueueTimeout = 60 * time.Second
+	// serviceTimeWeight 平均处理时间的指数移动平均权重
+	serviceTimeWeight = 0.2
+)
+
+// QueueStats describes the admission queue of a loaded model
+type QueueStats struct {
+	ModelID    string `json:"modelId"`
+	Slots      int    `json:"slots"`      // 可同时处理的请求数
+	Active     int    `json:"active"`     // 正在处理的请求数
+	Queued     int    `json:"queued"`     // 正在排队的请求数
+	MaxQueued  int    `json:"maxQueued"`  // 排队上限
+	Admitted   int64  `json:"admitted"`   // 累计放行的请求数
+	Rejected   int64  `json:"rejected"`   // 因队列已满被拒绝的请求数
+	TimedOut   int64  `json:"timedOut"`   // 排队超时的请求数
+	AvgWaitMs  int64  `json:"avgWaitMs"`  // 放行请求的平均排队时间
+	MaxWaitMs  int64  `json:"maxWaitMs"`  // 放行请求的最长排队时间
+	LastWaitMs int64  `json:"lastWaitMs"` // 最近一次放行请求的排队时间
+	Saturated  bool   `json:"saturated"`  // 所有槽位均被占用
+}
+
+// QueueError is returned when a request cannot be admitted to a model.
+// RetryAfter is a hint for the Retry-After response header.
+type QueueError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *QueueError) Error() string { return e.Err.Error() }
+
+func (e *QueueError) Unwrap() error { return e.Err }
+
+// RetryAfterSeconds returns the Retry-After hint rounded up to whole seconds
+func (e *QueueError) RetryAfterSeconds() int {
+	seconds := int(math.Ceil(e.RetryAfter.Seconds()))
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// queueWaiter 排队中的请求，granted 后 ready 被关闭
+type queueWaiter struct {
+	ready   chan struct{}
+	granted bool
+	err     error
+}
+
+// admissionQueue 单个模型的并发控制与 FIFO 等待队列
+type admissionQueue struct {
+	slots   int
+	active  int
+	waiters *list.List
+
+	admitted  int64
+	rejected  int64
+	timedOut  int64
+	waitTotal time.Duration
+	maxWait   time.Duration
+	lastWait  time.Duration
+
+	avgService time.Duration // 请求处理时间的指数移动平均，用于估算 Retry-After
+}
+
+// AcquireSlot waits for a free parallel slot on a loaded model and returns a
+// function that must be called when the request finishes. The request counts
+// as model activity from the moment it is queued. Returns a *QueueError when
+// the queue is full, the wait times out or the model is unloaded.
+func (m *Manager) AcquireSlot(ctx context.Context, modelID string) (func(), error) {
+	_, span := tracing.Start(ctx, "model.queue_wait", tracing.String("shepherd.model.id", modelID))
+	release, err := m.acquireSlot(ctx, modelID)
+	span.RecordError(err)
+	span.End()
+	return release, err
+}
+
+// acquireSlot 排队等待空闲槽位
+func (m *Manager) acquireSlot(ctx context.Context, modelID string) (func(), error) {
+	cfg := m.currentConfig().Gateway.Queue
+	maxQueued := cfg.MaxQueued
+	if maxQueued <= 0 {
+		maxQueued = defaultQueueMaxQueued
+	}
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultQueueTimeout
+	}
+
+	slots := defaultParallelSlots
+	if status, exists := m.GetStatus(modelID); exists && status.ParallelSlots > 0 {
+		slots = status.ParallelSlots
+	}
+
+	finish := m.BeginRequest(modelID)
+
+	m.queueMu.Lock()
+	q, exists := m.queues[modelID]
+	if !exists {
+		q = &admissionQueue{slots: slots, waiters: list.New()}
+		m.queues[modelID] = q
+	}
+
+	// 有空闲槽位且无人排队时直接放行
+	if q.active < q.slots && q.waiters.Len() == 0 {
+		q.active++
+		q.recordWait(0)
+		m.queueMu.Unlock()
+		return m.releaseFunc(modelID, q, finish), nil
+	}
+
+	if q.waiters.Len() >= maxQueued {
+		q.rejected++
+		retryAfter := q.estimateWait(q.waiters.Len())
+		m.queueMu.Unlock()
+		finish()
+		logger.Warn("模型请求队列已满", "modelId", modelID, "queued", maxQueued)
+		return nil, &QueueError{Err: ErrQueueFull, RetryAfter: retryAfter}
+	}
+
+	waiter := &queueWaiter{ready: make(chan struct{})}
+	elem := q.waiters.PushBack(waiter)
+	m.queueMu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var waitErr error
+	select {
+	case <-waiter.ready:
+	case <-timer.C:
+		waitErr = ErrQueueTimeout
+	case <-ctx.Done():
+		waitErr = ctx.Err()
+	}
+
+	m.queueMu.Lock()
+	if waiter.err != nil {
+		m.queueMu.Unlock()
+		finish()
+		return nil, &QueueError{Err: waiter.err, RetryAfter: time.Second}
+	}
+	if !waiter.granted {
+		// 超时或客户端断开，退出队列
+		q.waiters.Remove(elem)
+		retryAfter := q.estimateWait(q.waiters.Len())
+		if errors.Is(waitErr, ErrQueueTimeout) {
+			q.timedOut++
+		}
+		m.queueMu.Unlock()
+		finish()
+		if errors.Is(waitErr, ErrQueueTimeout) {
+			logger.Warn("模型请求排队超时", "modelId", modelID, "timeout", timeout.String())
+			return nil, &QueueError{Err: ErrQueueTimeout, RetryAfter: retryAfter}
+		}
+		return nil, waitErr
+	}
+	q.recordWait(time.Since(start))
+	m.queueMu.Unlock()
+
+	return m.releaseFunc(modelID, q, finish), nil
+}
+
+// releaseFunc 返回释放槽位的函数，槽位直接交给队首请求
+func (m *Manager) releaseFunc(modelID string, q *admissionQueue, finish func()) func() {
+	start := time.Now()
+	released := false
+
+	return func() {
+		m.queueMu.Lock()
+		if !released {
+			released = true
+			q.recordService(time.Since(start))
+			if front := q.waiters.Front(); front != nil {
+				waiter := q.waiters.Remove(front).(*queueWaiter)
+				waiter.granted = true
+				close(waiter.ready)
+			} else {
+				q.active--
+			}
+		}
+		m.queueMu.Unlock()
+		finish()
+	}
+}
+
+// QueueStats returns the admission queue state of a model
+func (m *Manager) QueueStats(modelID string) (QueueStats, bool) {
+	maxQueued := m.currentConfig().Gateway.Queue.MaxQueued
+	if maxQueued <= 0 {
+		maxQueued = defaultQueueMaxQueued
+	}
+
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+
+	q, exists := m.queues[modelID]
+	if !exists {
+		return QueueStats{}, false
+	}
+	return q.stats(modelID, maxQueued), true
+}
+
+// ListQueueStats returns the admission queue state of all models that have
+// received requests since they were loaded
+func (m *Manager) ListQueueStats() []QueueStats {
+	maxQueued := m.currentConfig().Gateway.Queue.MaxQueued
+	if maxQueued <= 0 {
+		maxQueued = defaultQueueMaxQueued
+	}
+
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+
+	stats := make([]QueueStats, 0, len(m.queues))
+	for id, q := range m.queues {
+		stats = append(stats, q.stats(id, maxQueued))
+	}
+	return stats
+}
+
+// dropQueue 模型卸载时移除其队列，排队中的请求以 ErrQueueClosed 结束
+func (m *Manager) dropQueue(modelID string) {
+	m.queueMu.Lock()
+	defer m.queueMu.Unlock()
+
+	q, exists := m.queues[modelID]
+	if !exists {
+		return
+	}
+	for elem := q.waiters.Front(); elem != nil; elem = elem.Next() {
+		waiter := elem.Value.(*queueWaiter)
+		waiter.err = ErrQueueClosed
+		close(waiter.ready)
+	}
+	q.waiters.Init()
+	delete(m.queues, modelID)
+}
+
+func (q *admissionQueue) recordWait(wait time.Duration) {
+	q.admitted++
+	q.waitTotal += wait
+	q.lastWait = wait
+	if wait > q.maxWait {
+		q.maxWait = wait
+	}
+}
+
+func (q *admissionQueue) recordService(d time.Duration) {
+	if q.avgService == 0 {
+		q.avgService = d
+		return
+	}
+	q.avgService = time.Duration(float64(q.avgService)*(1-serviceTimeWeight) + float64(d)*serviceTimeWeight)
+}
+
+// estimateWait 估算排在 position 个请求之后需要等待的时间
+func (q *admissionQueue) estimateWait(position int) time.Duration {
+	service := q.avgService
+	if service <= 0 {
+		service = time.Second
+	}
+	rounds := position/q.slots + 1
+	return time.Duration(rounds) * service
+}
+
+func (q *admissionQueue) stats(modelID string, maxQueued int) QueueStats {
+	stats := QueueStats{
+		ModelID:    modelID,
+		Slots:      q.slots,
+		Active:     q.active,
+		Queued:     q.waiters.Len(),
+		MaxQueued:  maxQueued,
+		Admitted:   q.admitted,
+		Rejected:   q.rejected,
+		TimedOut:   q.timedOut,
+		MaxWaitMs:  q.maxWait.Milliseconds(),
+		LastWaitMs: q.lastWait.Milliseconds(),
+		Saturated:  q.active >= q.slots,
+	}
+	if q.admitted > 0 {
+		stats.AvgWaitMs = (q.waitTotal / time.Duration(q.admitted)).Milliseconds()
+	}
+	return stats
+}
@@ -0,0 +1,188 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newQueueTestManager 创建一个已加载模型的管理器，模型有 slots 个并发槽位
+func newQueueTestManager(t *testing.T, slots, maxQueued, timeout int) *Manager {
+	t.Helper()
+
+	cfg := config.DefaultConfig()
+	cfg.Gateway.Queue.MaxQueued = maxQueued
+	cfg.Gateway.Queue.Timeout = timeout
+	return newTestManager(t, cfg, testModelA, ModelStatus{
+		ID:            "model-a",
+		State:         StateLoaded,
+		Port:          8081,
+		ParallelSlots: slots,
+		LoadedAt:      time.Now(),
+	})
+}
+
+func TestAcquireSlot(t *testing.T) {
+	t.Run("Admits up to slot count", func(t *testing.T) {
+		manager := newQueueTestManager(t, 2, 4, 60)
+
+		release1, err := manager.AcquireSlot(context.Background(), "model-a")
+		require.NoError(t, err)
+		release2, err := manager.AcquireSlot(context.Background(), "model-a")
+		require.NoError(t, err)
+
+		stats, ok := manager.QueueStats("model-a")
+		require.True(t, ok)
+		assert.Equal(t, 2, stats.Slots)
+		assert.Equal(t, 2, stats.Active)
+		assert.True(t, stats.Saturated)
+
+		status, _ := manager.GetStatus("model-a")
+		assert.Equal(t, 2, status.ActiveRequests)
+
+		release1()
+		release2()
+		// 重复释放不影响计数
+		release2()
+
+		stats, _ = manager.QueueStats("model-a")
+		assert.Equal(t, 0, stats.Active)
+		assert.Equal(t, int64(2), stats.Admitted)
+	})
+
+	t.Run("Queued request gets released slot", func(t *testing.T) {
+		manager := newQueueTestManager(t, 1, 4, 60)
+
+		release, err := manager.AcquireSlot(context.Background(), "model-a")
+		require.NoError(t, err)
+
+		admitted := make(chan func())
+		go func() {
+			next, err := manager.AcquireSlot(context.Background(), "model-a")
+			if err == nil {
+				admitted <- next
+			}
+		}()
+
+		require.Eventually(t, func() bool {
+			stats, _ := manager.QueueStats("model-a")
+			return stats.Queued == 1
+		}, time.Second, 5*time.Millisecond)
+
+		release()
+		select {
+		case next := <-admitted:
+			stats, _ := manager.QueueStats("model-a")
+			assert.Equal(t, 1, stats.Active)
+			assert.Equal(t, 0, stats.Queued)
+			next()
+		case <-time.After(time.Second):
+			t.Fatal("queued request was not admitted")
+		}
+	})
+
+	t.Run("Rejects when queue is full", func(t *testing.T) {
+		manager := newQueueTestManager(t, 1, 1, 60)
+
+		release, err := manager.AcquireSlot(context.Background(), "model-a")
+		require.NoError(t, err)
+		defer release()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go manager.AcquireSlot(ctx, "model-a")
+		defer cancel()
+
+		require.Eventually(t, func() bool {
+			stats, _ := manager.QueueStats("model-a")
+			return stats.Queued == 1
+		}, time.Second, 5*time.Millisecond)
+
+		_, err = manager.AcquireSlot(context.Background(), "model-a")
+		require.ErrorIs(t, err, ErrQueueFull)
+
+		var queueErr *QueueError
+		require.True(t, errors.As(err, &queueErr))
+		assert.GreaterOrEqual(t, queueErr.RetryAfterSeconds(), 1)
+
+		stats, _ := manager.QueueStats("model-a")
+		assert.Equal(t, int64(1), stats.Rejected)
+	})
+
+	t.Run("Times out in queue", func(t *testing.T) {
+		manager := newQueueTestManager(t, 1, 4, 1)
+
+		release, err := manager.AcquireSlot(context.Background(), "model-a")
+		require.NoError(t, err)
+		defer release()
+
+		_, err = manager.AcquireSlot(context.Background(), "model-a")
+		require.ErrorIs(t, err, ErrQueueTimeout)
+
+		stats, _ := manager.QueueStats("model-a")
+		assert.Equal(t, int64(1), stats.TimedOut)
+		assert.Equal(t, 0, stats.Queued)
+	})
+
+	t.Run("Client cancel leaves queue", func(t *testing.T) {
+		manager := newQueueTestManager(t, 1, 4, 60)
+
+		release, err := manager.AcquireSlot(context.Background(), "model-a")
+		require.NoError(t, err)
+		defer release()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err = manager.AcquireSlot(ctx, "model-a")
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		stats, _ := manager.QueueStats("model-a")
+		assert.Equal(t, 0, stats.Queued)
+		assert.Equal(t, int64(0), stats.TimedOut)
+
+		status, _ := manager.GetStatus("model-a")
+		assert.Equal(t, 1, status.ActiveRequests)
+	})
+
+	t.Run("Unload wakes queued requests", func(t *testing.T) {
+		manager := newQueueTestManager(t, 1, 4, 60)
+
+		release, err := manager.AcquireSlot(context.Background(), "model-a")
+		require.NoError(t, err)
+		defer release()
+
+		result := make(chan error)
+		go func() {
+			_, err := manager.AcquireSlot(context.Background(), "model-a")
+			result <- err
+		}()
+
+		require.Eventually(t, func() bool {
+			stats, _ := manager.QueueStats("model-a")
+			return stats.Queued == 1
+		}, time.Second, 5*time.Millisecond)
+
+		manager.dropQueue("model-a")
+		assert.ErrorIs(t, <-result, ErrQueueClosed)
+
+		_, exists := manager.QueueStats("model-a")
+		assert.False(t, exists)
+	})
+
+	t.Run("Default slots", func(t *testing.T) {
+		manager := newQueueTestManager(t, 0, 0, 0)
+
+		release, err := manager.AcquireSlot(context.Background(), "model-a")
+		require.NoError(t, err)
+		defer release()
+
+		stats, _ := manager.QueueStats("model-a")
+		assert.Equal(t, defaultParallelSlots, stats.Slots)
+		assert.Equal(t, defaultQueueMaxQueued, stats.MaxQueued)
+		assert.Len(t, manager.ListQueueStats(), 1)
+	})
+}
@@ -0,0 +1,221 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sort"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+)
+
+const (
+	// replicaSeparator 命名副本实例 ID 中模型 ID 与副本名的分隔符
+	replicaSeparator = "@"
+	// defaultSessionHeader 配置未设置会话请求头时的默认值
+	defaultSessionHeader = "X-Session-ID"
+	// replicaFailureCooldown 上游连接失败后副本被跳过的时间
+	replicaFailureCooldown = 30 * time.Second
+)
+
+// ReplicaInfo describes one running instance of a model
+type ReplicaInfo struct {
+	InstanceID     string `json:"instanceId"`
+	ModelID        string `json:"modelId"`
+	Replica        string `json:"replica,omitempty"`
+	State          string `json:"state"`
+	Port           int    `json:"port"`
+	ActiveRequests int    `json:"activeRequests"`
+	Healthy        bool   `json:"healthy"`
+}
+
+// replicaCandidate 参与负载均衡的已加载实例
+type replicaCandidate struct {
+	id     string
+	active int
+}
+
+// ReplicaInstanceID returns the status key of a model instance. The default
+// instance uses the model ID itself, named replicas use "modelID@replica".
+func ReplicaInstanceID(modelID, replica string) string {
+	if replica == "" {
+		return modelID
+	}
+	return modelID + replicaSeparator + replica
+}
+
+// SessionHeader returns the request header used for sticky replica routing
+func (m *Manager) SessionHeader() string {
+	if header := m.currentConfig().Gateway.Balancing.SessionHeader; header != "" {
+		return header
+	}
+	return defaultSessionHeader
+}
+
+// PickReplica chooses the instance that should serve a request for a model.
+// A named replica instance ID is returned unchanged. Otherwise requests with
+// a session key stick to one healthy replica, and the rest are spread by the
+// configured strategy. Unhealthy replicas are skipped unless none is healthy.
+func (m *Manager) PickReplica(modelID, sessionKey string) string {
+	strategy := m.currentConfig().Gateway.Balancing.Strategy
+
+	m.mu.RLock()
+	if status, exists := m.statuses[modelID]; exists && status.Replica != "" {
+		m.mu.RUnlock()
+		return modelID
+	}
+	var loaded []replicaCandidate
+	for id, status := range m.statuses {
+		if status.State == StateLoaded && statusModelID(id, status) == modelID {
+			loaded = append(loaded, replicaCandidate{id: id, active: status.ActiveRequests})
+		}
+	}
+	m.mu.RUnlock()
+
+	if len(loaded) == 0 {
+		return modelID
+	}
+	if len(loaded) == 1 {
+		return loaded[0].id
+	}
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].id < loaded[j].id })
+
+	now := time.Now()
+	candidates := make([]replicaCandidate, 0, len(loaded))
+	for _, c := range loaded {
+		if m.replicaHealthy(c.id, now) {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		logger.Warn("模型所有副本均不健康，仍尝试转发", "modelId", modelID, "replicas", len(loaded))
+		candidates = loaded
+	}
+
+	if sessionKey != "" {
+		return stickyReplica(candidates, sessionKey)
+	}
+
+	m.replicaMu.Lock()
+	next := m.replicaNext[modelID]
+	m.replicaNext[modelID] = next + 1
+	m.replicaMu.Unlock()
+
+	start := int(next % uint64(len(candidates)))
+	if strategy == config.BalanceRoundRobin {
+		return candidates[start].id
+	}
+
+	// 最少未完成请求，数量相同时从轮询位置开始依次选择
+	best := candidates[start]
+	for i := 1; i < len(candidates); i++ {
+		c := candidates[(start+i)%len(candidates)]
+		if c.active < best.active {
+			best = c
+		}
+	}
+	return best.id
+}
+
+// ReportUpstreamError marks a replica unhealthy for a short time after a
+// request to its llama-server could not be delivered. Errors caused by the
+// client going away are ignored.
+func (m *Manager) ReportUpstreamError(instanceID string, err error) {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+
+	m.replicaMu.Lock()
+	m.replicaFailures[instanceID] = time.Now()
+	m.replicaMu.Unlock()
+
+	logger.Warn("模型副本请求失败，暂停分配请求", "modelId", instanceID, "cooldown", replicaFailureCooldown.String(), "error", err)
+}
+
+// ListReplicas returns all instances of a model ordered by instance ID
+func (m *Manager) ListReplicas(modelID string) []ReplicaInfo {
+	m.mu.RLock()
+	replicas := make([]ReplicaInfo, 0)
+	for id, status := range m.statuses {
+		if statusModelID(id, status) != modelID {
+			continue
+		}
+		replicas = append(replicas, ReplicaInfo{
+			InstanceID:     id,
+			ModelID:        modelID,
+			Replica:        status.Replica,
+			State:          status.State.String(),
+			Port:           status.Port,
+			ActiveRequests: status.ActiveRequests,
+			Healthy:        status.State == StateLoaded,
+		})
+	}
+	m.mu.RUnlock()
+
+	now := time.Now()
+	for i := range replicas {
+		replicas[i].Healthy = replicas[i].Healthy && m.replicaHealthy(replicas[i].InstanceID, now)
+	}
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].InstanceID < replicas[j].InstanceID })
+	return replicas
+}
+
+// HasLoadedReplica reports whether any instance of a model is loaded
+func (m *Manager) HasLoadedReplica(modelID string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for id, status := range m.statuses {
+		if status.State == StateLoaded && statusModelID(id, status) == modelID {
+			return true
+		}
+	}
+	return false
+}
+
+// replicaHealthy 进程已退出或近期连接失败的副本视为不健康
+func (m *Manager) replicaHealthy(instanceID string, now time.Time) bool {
+	m.replicaMu.Lock()
+	failedAt, failed := m.replicaFailures[instanceID]
+	if failed && now.Sub(failedAt) >= replicaFailureCooldown {
+		delete(m.replicaFailures, instanceID)
+		failed = false
+	}
+	m.replicaMu.Unlock()
+	if failed {
+		return false
+	}
+
+	if m.processMgr != nil {
+		if proc, exists := m.processMgr.Get(instanceID); exists && !proc.IsRunning() {
+			return false
+		}
+	}
+	return true
+}
+
+// stickyReplica 按会话键做最高随机权重哈希，副本增减时只有少量会话迁移
+func stickyReplica(candidates []replicaCandidate, sessionKey string) string {
+	var best string
+	var bestScore uint64
+	for _, c := range candidates {
+		h := fnv.New64a()
+		h.Write([]byte(sessionKey))
+		h.Write([]byte{0})
+		h.Write([]byte(c.id))
+		if score := h.Sum64(); best == "" || score > bestScore {
+			best, bestScore = c.id, score
+		}
+	}
+	return best
+}
+
+// statusModelID 返回实例所属的模型 ID
+func statusModelID(instanceID string, status *ModelStatus) string {
+	if status.ModelID != "" {
+		return status.ModelID
+	}
+	return instanceID
+}
@@ -0,0 +1,106 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newReplicaTestManager 创建一个模型有默认实例和 gpu1 副本的管理器
+func newReplicaTestManager(t *testing.T, strategy string) *Manager {
+	t.Helper()
+
+	cfg := config.DefaultConfig()
+	cfg.Gateway.Balancing.Strategy = strategy
+	replicaID := ReplicaInstanceID("model-a", "gpu1")
+	return newTestManager(t, cfg, testModelA,
+		ModelStatus{ID: "model-a", ModelID: "model-a", State: StateLoaded, Port: 8081, LoadedAt: time.Now()},
+		ModelStatus{ID: replicaID, ModelID: "model-a", Replica: "gpu1", State: StateLoaded, Port: 8082, LoadedAt: time.Now()},
+	)
+}
+
+func TestReplicaInstanceID(t *testing.T) {
+	assert.Equal(t, "model-a", ReplicaInstanceID("model-a", ""))
+	assert.Equal(t, "model-a@gpu1", ReplicaInstanceID("model-a", "gpu1"))
+}
+
+func TestPickReplica(t *testing.T) {
+	t.Run("Round robin", func(t *testing.T) {
+		manager := newReplicaTestManager(t, config.BalanceRoundRobin)
+
+		picked := make(map[string]int)
+		for i := 0; i < 4; i++ {
+			picked[manager.PickReplica("model-a", "")]++
+		}
+		assert.Equal(t, map[string]int{"model-a": 2, "model-a@gpu1": 2}, picked)
+	})
+
+	t.Run("Least outstanding requests", func(t *testing.T) {
+		manager := newReplicaTestManager(t, config.BalanceLeastRequests)
+
+		finish := manager.BeginRequest("model-a")
+		defer finish()
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, "model-a@gpu1", manager.PickReplica("model-a", ""))
+		}
+	})
+
+	t.Run("Sticky session", func(t *testing.T) {
+		manager := newReplicaTestManager(t, config.BalanceRoundRobin)
+
+		first := manager.PickReplica("model-a", "session-1")
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, first, manager.PickReplica("model-a", "session-1"))
+		}
+	})
+
+	t.Run("Skips unhealthy replica", func(t *testing.T) {
+		manager := newReplicaTestManager(t, config.BalanceRoundRobin)
+
+		manager.ReportUpstreamError("model-a@gpu1", errors.New("connection refused"))
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, "model-a", manager.PickReplica("model-a", ""))
+		}
+
+		// 客户端取消不影响副本健康状态
+		manager.ReportUpstreamError("model-a", context.Canceled)
+		assert.Equal(t, "model-a", manager.PickReplica("model-a", ""))
+
+		// 所有副本均不健康时仍然转发
+		manager.ReportUpstreamError("model-a", errors.New("connection refused"))
+		assert.NotEmpty(t, manager.PickReplica("model-a", ""))
+
+		replicas := manager.ListReplicas("model-a")
+		require.Len(t, replicas, 2)
+		assert.False(t, replicas[0].Healthy)
+		assert.Equal(t, "gpu1", replicas[1].Replica)
+	})
+
+	t.Run("Explicit replica", func(t *testing.T) {
+		manager := newReplicaTestManager(t, config.BalanceRoundRobin)
+
+		for i := 0; i < 3; i++ {
+			assert.Equal(t, "model-a@gpu1", manager.PickReplica("model-a@gpu1", ""))
+		}
+	})
+
+	t.Run("Only replica loaded", func(t *testing.T) {
+		manager := newReplicaTestManager(t, config.BalanceRoundRobin)
+		manager.mu.Lock()
+		manager.statuses["model-a"].State = StateUnloaded
+		manager.mu.Unlock()
+
+		assert.True(t, manager.HasLoadedReplica("model-a"))
+		assert.Equal(t, "model-a@gpu1", manager.PickReplica("model-a", ""))
+
+		// 已有副本运行时不触发按需加载
+		id, err := manager.EnsureLoaded(context.Background(), "Model A")
+		require.NoError(t, err)
+		assert.Equal(t, "model-a", id)
+	})
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// Route resolves the model named in an API request to the instance that
+// serves it: a virtual model name is resolved by its rules, a loaded instance
+// is matched by its exact ID, any other name is resolved by ID, alias or name
+// and loaded on demand, and the replica is picked by the balancing strategy.
+// sessionKey keeps a session on one replica; empty means none.
+func (m *Manager) Route(ctx context.Context, name string, hints RouteHints, sessionKey string) (string, error) {
+	// 虚拟模型名先按规则和回退顺序解析为具体模型
+	concrete, virtual, err := m.ResolveVirtual(ctx, name, hints)
+	if err != nil {
+		return "", err
+	}
+	if virtual {
+		name = concrete
+	}
+
+	modelID := name
+	if !m.instanceLoaded(name) {
+		// 按 ID、别名或名称精确解析，未加载的模型按保存的配置按需加载
+		if modelID, err = m.EnsureLoaded(ctx, name); err != nil {
+			return "", err
+		}
+	}
+	return m.PickReplica(modelID, sessionKey), nil
+}
+
+// instanceLoaded 判断 name 是否为已加载实例的 ID（包括命名副本 model@replica）
+func (m *Manager) instanceLoaded(name string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status, exists := m.statuses[name]
+	return exists && status.State == StateLoaded
+}
+
+// ErrorStatus maps errors returned by Route and AcquireSlot to an HTTP
+// status code, along with the Retry-After hint in seconds (0 = none)
+func ErrorStatus(err error) (status int, retryAfter int) {
+	var queueErr *QueueError
+	if errors.As(err, &queueErr) {
+		retryAfter = queueErr.RetryAfterSeconds()
+	}
+
+	switch {
+	case errors.Is(err, ErrQueueFull):
+		return http.StatusTooManyRequests, retryAfter
+	case errors.Is(err, ErrQueueTimeout), errors.Is(err, ErrQueueClosed),
+		errors.Is(err, ErrAutoLoadTimeout), errors.Is(err, ErrTooManyModels):
+		return http.StatusServiceUnavailable, retryAfter
+	case errors.Is(err, ErrNoVirtualCandidate):
+		return http.StatusBadRequest, retryAfter
+	case errors.Is(err, ErrAutoLoadFailed):
+		return http.StatusInternalServerError, retryAfter
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusRequestTimeout, retryAfter
+	default:
+		return http.StatusNotFound, retryAfter
+	}
+}
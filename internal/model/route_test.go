@@ -0,0 +1,92 @@
+package model
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoute(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.DefaultConfig()
+	cfg.Gateway.VirtualModels = []config.VirtualModelConfig{{Name: "chat", Models: []string{"Qwen-7B"}}}
+	manager := newTestManager(t, cfg, autoLoadModels,
+		ModelStatus{ID: "qwen-7b-q4", ModelID: "qwen-7b-q4", State: StateLoaded, Port: 8081},
+		ModelStatus{ID: "qwen-7b-q4@gpu1", ModelID: "qwen-7b-q4", Replica: "gpu1", State: StateLoaded, Port: 8082},
+	)
+
+	for _, name := range []string{"qwen-7b-q4", "qwen", "Qwen-7B", "chat"} {
+		instanceID, err := manager.Route(ctx, name, RouteHints{}, "session-1")
+		require.NoError(t, err, name)
+		assert.Contains(t, []string{"qwen-7b-q4", "qwen-7b-q4@gpu1"}, instanceID, name)
+	}
+
+	// 同一会话固定在同一个副本上
+	first, err := manager.Route(ctx, "qwen", RouteHints{}, "session-2")
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		instanceID, err := manager.Route(ctx, "qwen", RouteHints{}, "session-2")
+		require.NoError(t, err)
+		assert.Equal(t, first, instanceID)
+	}
+
+	// 未加载的模型交给按需加载
+	_, err = manager.Route(ctx, "llama-8b", RouteHints{}, "")
+	assert.ErrorIs(t, err, ErrAutoLoadDisabled)
+	_, err = manager.Route(ctx, "missing", RouteHints{}, "")
+	assert.ErrorIs(t, err, ErrModelNotFound)
+	_, err = manager.Route(ctx, "", RouteHints{}, "")
+	assert.ErrorIs(t, err, ErrModelNotFound)
+	// 模型 ID 的片段不匹配任何模型
+	_, err = manager.Route(ctx, "7b-q4", RouteHints{}, "")
+	assert.ErrorIs(t, err, ErrModelNotFound)
+}
+
+func TestRouteOverlappingIDs(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.DefaultConfig()
+	cfg.Gateway.AutoLoad.Enabled = false
+	manager := newTestManager(t, cfg, []Model{
+		{ID: "llama", Name: "Llama"},
+		{ID: "llama-70b", Name: "Llama-70B"},
+	}, ModelStatus{ID: "llama-70b", ModelID: "llama-70b", State: StateLoaded, Port: 8081})
+
+	// 请求未加载的 llama 时不能由 ID 包含 llama 的已加载模型处理，而是按需加载
+	_, err := manager.Route(ctx, "llama", RouteHints{}, "")
+	assert.ErrorIs(t, err, ErrAutoLoadDisabled)
+
+	instanceID, err := manager.Route(ctx, "llama-70b", RouteHints{}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "llama-70b", instanceID)
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		wantStatus     int
+		wantRetryAfter int
+	}{
+		{"queue full", &QueueError{Err: ErrQueueFull, RetryAfter: 2500 * time.Millisecond}, http.StatusTooManyRequests, 3},
+		{"queue timeout", &QueueError{Err: ErrQueueTimeout, RetryAfter: time.Second}, http.StatusServiceUnavailable, 1},
+		{"load timeout", ErrAutoLoadTimeout, http.StatusServiceUnavailable, 0},
+		{"no candidate", ErrNoVirtualCandidate, http.StatusBadRequest, 0},
+		{"load failed", ErrAutoLoadFailed, http.StatusInternalServerError, 0},
+		{"cancelled", context.Canceled, http.StatusRequestTimeout, 0},
+		{"disabled", ErrAutoLoadDisabled, http.StatusNotFound, 0},
+		{"not found", ErrModelNotFound, http.StatusNotFound, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, retryAfter := ErrorStatus(tt.err)
+			assert.Equal(t, tt.wantStatus, status)
+			assert.Equal(t, tt.wantRetryAfter, retryAfter)
+		})
+	}
+}
@@ -0,0 +1,507 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+)
+
+var (
+	// ErrModelNotLoaded is returned when a slot action targets an instance that is not running
+	ErrModelNotLoaded = errors.New("model is not loaded")
+	// ErrSlotSaveDisabled is returned when the instance was started without --slot-save-path
+	ErrSlotSaveDisabled = errors.New("model was loaded without a slot save path")
+	// ErrInvalidSlotFile is returned for slot file names llama-server would reject
+	ErrInvalidSlotFile = errors.New("invalid slot file name")
+	// ErrSavedSlotNotFound is returned when a slot file is not in the catalogue
+	ErrSavedSlotNotFound = errors.New("saved slot not found")
+)
+
+const (
+	// slotIndexFile 槽位存档目录中记录已保存槽位的索引文件
+	slotIndexFile = "shepherd-slots.json"
+	// slotReadyTimeout 加载后等待 llama-server 就绪以恢复槽位的最长时间
+	slotReadyTimeout = 10 * time.Minute
+	// slotReadyInterval 等待就绪时的轮询间隔
+	slotReadyInterval = 500 * time.Millisecond
+)
+
+// slotClient 调用 llama-server /slots 接口的 HTTP 客户端，保存大上下文的缓存可能较慢
+var slotClient = &http.Client{Timeout: 5 * time.Minute}
+
+// Slot is a parallel slot of a running llama-server instance
+type Slot struct {
+	ID         int  `json:"id"`
+	CtxSize    int  `json:"ctxSize"`
+	Processing bool `json:"processing"`
+	TaskID     int  `json:"taskId"` // 最近处理的任务 ID，-1 表示从未使用
+}
+
+// SavedSlot is a slot KV cache file catalogued in the slot save directory
+type SavedSlot struct {
+	Filename string    `json:"filename"`
+	ModelID  string    `json:"modelId"`  // 保存该槽位的实例 ID
+	Slot     int       `json:"slot"`     // 保存时的槽位 ID
+	Tokens   int       `json:"tokens"`   // 缓存的 token 数
+	Size     int64     `json:"size"`     // 文件大小（字节）
+	OnUnload bool      `json:"onUnload"` // 卸载时自动保存，加载时指定 restoreSlots 即可恢复
+	SavedAt  time.Time `json:"savedAt"`
+}
+
+// UnloadOptions controls how a model instance is unloaded
+type UnloadOptions struct {
+	SaveSlots bool `json:"saveSlots"` // 卸载前保存所有使用过的槽位
+}
+
+// llamaSlot 是 llama-server GET /slots 返回的槽位
+type llamaSlot struct {
+	ID           int  `json:"id"`
+	NCtx         int  `json:"n_ctx"`
+	IsProcessing bool `json:"is_processing"`
+	IDTask       int  `json:"id_task"`
+}
+
+// llamaSlotResult 是 llama-server POST /slots/{id} 的返回结果
+type llamaSlotResult struct {
+	NSaved    int   `json:"n_saved"`
+	NWritten  int64 `json:"n_written"`
+	NRestored int   `json:"n_restored"`
+	NErased   int   `json:"n_erased"`
+}
+
+// ListSlots returns the slots of a loaded instance
+func (m *Manager) ListSlots(ctx context.Context, instanceID string) ([]Slot, error) {
+	port, _, err := m.slotInstance(instanceID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	slots, err := fetchSlots(ctx, port)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Slot, len(slots))
+	for i, slot := range slots {
+		result[i] = Slot{ID: slot.ID, CtxSize: slot.NCtx, Processing: slot.IsProcessing, TaskID: slot.IDTask}
+	}
+	return result, nil
+}
+
+// SaveSlot saves the KV cache of a slot to a file in the slot save directory
+// and catalogues it. An empty filename uses "<instance>-slot<id>.bin".
+func (m *Manager) SaveSlot(ctx context.Context, instanceID string, slot int, filename string) (*SavedSlot, error) {
+	return m.saveSlot(ctx, instanceID, slot, filename, false)
+}
+
+// RestoreSlot loads a saved KV cache file into a slot and returns the number
+// of restored tokens
+func (m *Manager) RestoreSlot(ctx context.Context, instanceID string, slot int, filename string) (int, error) {
+	port, _, err := m.slotInstance(instanceID, true)
+	if err != nil {
+		return 0, err
+	}
+	if !validSlotFilename(filename) {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidSlotFile, filename)
+	}
+
+	result, err := slotAction(ctx, port, slot, "restore", filename)
+	if err != nil {
+		return 0, err
+	}
+	logger.Info("槽位缓存已恢复", "modelId", instanceID, "slot", slot, "filename", filename, "tokens", result.NRestored)
+	return result.NRestored, nil
+}
+
+// EraseSlot clears the KV cache of a slot and returns the number of erased tokens
+func (m *Manager) EraseSlot(ctx context.Context, instanceID string, slot int) (int, error) {
+	port, _, err := m.slotInstance(instanceID, false)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := slotAction(ctx, port, slot, "erase", "")
+	if err != nil {
+		return 0, err
+	}
+	logger.Info("槽位缓存已清除", "modelId", instanceID, "slot", slot, "tokens", result.NErased)
+	return result.NErased, nil
+}
+
+// SavedSlots returns the slot files saved by an instance, newest first.
+// The instance need not be loaded as long as it was loaded with a slot save path.
+func (m *Manager) SavedSlots(instanceID string) ([]*SavedSlot, error) {
+	dir := m.slotSaveDir(instanceID)
+	if dir == "" {
+		return []*SavedSlot{}, nil
+	}
+
+	m.slotMu.Lock()
+	defer m.slotMu.Unlock()
+
+	index, err := readSlotIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+	saved := make([]*SavedSlot, 0, len(index))
+	for _, entry := range index {
+		if entry.ModelID == instanceID {
+			saved = append(saved, entry)
+		}
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i].SavedAt.After(saved[j].SavedAt) })
+	return saved, nil
+}
+
+// DeleteSavedSlot removes a saved slot file of an instance and its catalogue entry
+func (m *Manager) DeleteSavedSlot(instanceID, filename string) error {
+	if !validSlotFilename(filename) {
+		return fmt.Errorf("%w: %q", ErrInvalidSlotFile, filename)
+	}
+	dir := m.slotSaveDir(instanceID)
+	if dir == "" {
+		return fmt.Errorf("%w: %s", ErrSavedSlotNotFound, filename)
+	}
+
+	m.slotMu.Lock()
+	defer m.slotMu.Unlock()
+
+	index, err := readSlotIndex(dir)
+	if err != nil {
+		return err
+	}
+	entry, exists := index[filename]
+	if !exists || entry.ModelID != instanceID {
+		return fmt.Errorf("%w: %s", ErrSavedSlotNotFound, filename)
+	}
+	if err := os.Remove(filepath.Join(dir, filename)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(index, filename)
+	logger.Info("已删除槽位存档", "modelId", instanceID, "filename", filename)
+	return writeSlotIndex(dir, index)
+}
+
+// SaveAllSlots saves every slot of an instance that has processed a request.
+// The files are marked so that a later load with RestoreSlots restores them.
+func (m *Manager) SaveAllSlots(ctx context.Context, instanceID string) ([]*SavedSlot, error) {
+	port, _, err := m.slotInstance(instanceID, true)
+	if err != nil {
+		return nil, err
+	}
+	slots, err := fetchSlots(ctx, port)
+	if err != nil {
+		return nil, err
+	}
+
+	saved := make([]*SavedSlot, 0, len(slots))
+	for _, slot := range slots {
+		if slot.IDTask < 0 {
+			continue
+		}
+		entry, err := m.saveSlot(ctx, instanceID, slot.ID, "", true)
+		if err != nil {
+			return saved, fmt.Errorf("save slot %d: %w", slot.ID, err)
+		}
+		if entry != nil {
+			saved = append(saved, entry)
+		}
+	}
+	return saved, nil
+}
+
+// UnloadWithOptions unloads a model instance, saving its slots first when requested.
+// The instance stays loaded when saving fails.
+func (m *Manager) UnloadWithOptions(modelID string, opts UnloadOptions) error {
+	if opts.SaveSlots {
+		ctx, cancel := context.WithTimeout(m.ctx, slotClient.Timeout)
+		saved, err := m.SaveAllSlots(ctx, modelID)
+		cancel()
+		if err != nil {
+			logger.Warn("模型卸载失败: 保存槽位失败", "modelId", modelID, "error", err)
+			return err
+		}
+		logger.Info("卸载前已保存槽位", "modelId", modelID, "slots", len(saved))
+	}
+	return m.Unload(modelID)
+}
+
+// saveSlot 保存槽位并写入目录索引，空槽位（0 个 token）不编目
+func (m *Manager) saveSlot(ctx context.Context, instanceID string, slot int, filename string, onUnload bool) (*SavedSlot, error) {
+	port, dir, err := m.slotInstance(instanceID, true)
+	if err != nil {
+		return nil, err
+	}
+	if filename == "" {
+		filename = defaultSlotFilename(instanceID, slot)
+	}
+	if !validSlotFilename(filename) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSlotFile, filename)
+	}
+
+	result, err := slotAction(ctx, port, slot, "save", filename)
+	if err != nil {
+		return nil, err
+	}
+
+	m.slotMu.Lock()
+	defer m.slotMu.Unlock()
+
+	index, err := readSlotIndex(dir)
+	if err != nil {
+		return nil, err
+	}
+	if onUnload && result.NSaved == 0 {
+		os.Remove(filepath.Join(dir, filename))
+		delete(index, filename)
+		return nil, writeSlotIndex(dir, index)
+	}
+
+	entry := &SavedSlot{
+		Filename: filename,
+		ModelID:  instanceID,
+		Slot:     slot,
+		Tokens:   result.NSaved,
+		Size:     result.NWritten,
+		OnUnload: onUnload,
+		SavedAt:  time.Now(),
+	}
+	index[filename] = entry
+	if err := writeSlotIndex(dir, index); err != nil {
+		return nil, err
+	}
+	logger.Info("槽位缓存已保存", "modelId", instanceID, "slot", slot, "filename", filename, "tokens", result.NSaved, "size", result.NWritten)
+	return entry, nil
+}
+
+// startSlotRestore 在后台等待新加载的实例就绪后恢复其卸载时保存的槽位
+func (m *Manager) startSlotRestore(instanceID string, port int, dir string) {
+	if dir == "" {
+		logger.Warn("跳过槽位恢复: 未配置 slotSavePath", "modelId", instanceID)
+		return
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ctx, cancel := context.WithTimeout(m.ctx, slotReadyTimeout)
+		defer cancel()
+		if err := waitForServer(ctx, port); err != nil {
+			logger.Warn("跳过槽位恢复: 实例未就绪", "modelId", instanceID, "error", err)
+			return
+		}
+
+		m.slotMu.Lock()
+		index, err := readSlotIndex(dir)
+		m.slotMu.Unlock()
+		if err != nil {
+			logger.Warn("跳过槽位恢复: 读取槽位索引失败", "modelId", instanceID, "error", err)
+			return
+		}
+
+		restored := 0
+		for _, entry := range index {
+			if !entry.OnUnload || entry.ModelID != instanceID {
+				continue
+			}
+			if _, err := slotAction(ctx, port, entry.Slot, "restore", entry.Filename); err != nil {
+				logger.Warn("槽位恢复失败", "modelId", instanceID, "slot", entry.Slot, "filename", entry.Filename, "error", err)
+				continue
+			}
+			restored++
+		}
+		if restored > 0 {
+			logger.Info("已恢复卸载时保存的槽位", "modelId", instanceID, "slots", restored)
+		}
+	}()
+}
+
+// slotInstance 返回已加载实例的端口和槽位存档目录
+func (m *Manager) slotInstance(instanceID string, needDir bool) (int, string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	status, exists := m.statuses[instanceID]
+	if !exists || status.State != StateLoaded {
+		return 0, "", fmt.Errorf("%w: %s", ErrModelNotLoaded, instanceID)
+	}
+	if needDir && status.SlotSavePath == "" {
+		return 0, "", fmt.Errorf("%w: %s", ErrSlotSaveDisabled, instanceID)
+	}
+	return status.Port, status.SlotSavePath, nil
+}
+
+// slotSaveDir 返回实例最近一次加载时使用的槽位存档目录
+func (m *Manager) slotSaveDir(instanceID string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if status, exists := m.statuses[instanceID]; exists {
+		return status.SlotSavePath
+	}
+	return ""
+}
+
+// defaultSlotFilename 返回槽位的默认存档文件名
+func defaultSlotFilename(instanceID string, slot int) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, instanceID)
+	return fmt.Sprintf("%s-slot%d.bin", name, slot)
+}
+
+// validSlotFilename 检查文件名是否为存档目录中的普通文件名
+func validSlotFilename(filename string) bool {
+	if filename == "" || len(filename) > 255 || filename == slotIndexFile {
+		return false
+	}
+	if filename == "." || filename == ".." || strings.ContainsAny(filename, `/\:`) {
+		return false
+	}
+	for _, r := range filename {
+		if r < 0x20 || r == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// readSlotIndex 读取存档目录的槽位索引，调用方需持有 m.slotMu
+func readSlotIndex(dir string) (map[string]*SavedSlot, error) {
+	data, err := os.ReadFile(filepath.Join(dir, slotIndexFile))
+	if os.IsNotExist(err) {
+		return map[string]*SavedSlot{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*SavedSlot
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid slot index %s: %w", slotIndexFile, err)
+	}
+	index := make(map[string]*SavedSlot, len(entries))
+	for _, entry := range entries {
+		index[entry.Filename] = entry
+	}
+	return index, nil
+}
+
+// writeSlotIndex 写入存档目录的槽位索引，调用方需持有 m.slotMu
+func writeSlotIndex(dir string, index map[string]*SavedSlot) error {
+	entries := make([]*SavedSlot, 0, len(index))
+	for _, entry := range index {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Filename < entries[j].Filename })
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, slotIndexFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// fetchSlots 读取 llama-server 的槽位列表
+func fetchSlots(ctx context.Context, port int) ([]llamaSlot, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/slots", port), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := slotClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("llama-server returned %d: %s", resp.StatusCode, body)
+	}
+	var slots []llamaSlot
+	if err := json.NewDecoder(resp.Body).Decode(&slots); err != nil {
+		return nil, fmt.Errorf("invalid /slots response: %w", err)
+	}
+	return slots, nil
+}
+
+// slotAction 对 llama-server 的槽位执行 save / restore / erase
+func slotAction(ctx context.Context, port, slot int, action, filename string) (*llamaSlotResult, error) {
+	var body io.Reader
+	if filename != "" {
+		data, err := json.Marshal(map[string]string{"filename": filename})
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%d/slots/%d?action=%s", port, slot, action)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := slotClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("llama-server returned %d: %s", resp.StatusCode, body)
+	}
+	var result llamaSlotResult
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid /slots %s response: %w", action, err)
+	}
+	return &result, nil
+}
+
+// waitForServer 轮询 llama-server /health 直到就绪
+func waitForServer(ctx context.Context, port int) error {
+	url := fmt.Sprintf("http://127.0.0.1:%d/health", port)
+	ticker := time.NewTicker(slotReadyInterval)
+	defer ticker.Stop()
+
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		if resp, err := slotClient.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
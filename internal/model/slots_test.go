@@ -0,0 +1,193 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSlotServer 模拟 llama-server 的 /slots 和 /health 接口，记录收到的槽位操作
+type fakeSlotServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	actions []string
+}
+
+func newFakeSlotServer(t *testing.T) *fakeSlotServer {
+	f := &fakeSlotServer{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/health":
+			w.Write([]byte(`{"status":"ok"}`))
+		case r.URL.Path == "/slots":
+			w.Write([]byte(`[{"id":0,"n_ctx":4096,"is_processing":false,"id_task":12},{"id":1,"n_ctx":4096,"is_processing":true,"id_task":13},{"id":2,"n_ctx":4096,"is_processing":false,"id_task":-1}]`))
+		default:
+			var body struct {
+				Filename string `json:"filename"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			action := r.URL.Query().Get("action")
+			f.mu.Lock()
+			f.actions = append(f.actions, action+" "+r.URL.Path+" "+body.Filename)
+			f.mu.Unlock()
+
+			switch action {
+			case "save":
+				// 槽位 1 正在处理首个请求，尚无缓存
+				saved := 1745
+				if r.URL.Path == "/slots/1" {
+					saved = 0
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"n_saved": saved, "n_written": saved * 8192})
+			case "restore":
+				w.Write([]byte(`{"n_restored":1745,"n_read":14295040}`))
+			case "erase":
+				w.Write([]byte(`{"n_erased":1745}`))
+			default:
+				w.WriteHeader(http.StatusBadRequest)
+			}
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeSlotServer) port(t *testing.T) int {
+	u, err := url.Parse(f.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+	return port
+}
+
+func newSlotTestManager(t *testing.T, port int, dir string) *Manager {
+	t.Helper()
+
+	return newTestManager(t, nil, nil,
+		ModelStatus{ID: "qwen-7b", ModelID: "qwen-7b", State: StateLoaded, Port: port, SlotSavePath: dir},
+		ModelStatus{ID: "llama-8b", ModelID: "llama-8b", State: StateLoaded, Port: port},
+	)
+}
+
+func TestSlotActions(t *testing.T) {
+	server := newFakeSlotServer(t)
+	dir := t.TempDir()
+	manager := newSlotTestManager(t, server.port(t), dir)
+	ctx := context.Background()
+
+	slots, err := manager.ListSlots(ctx, "qwen-7b")
+	require.NoError(t, err)
+	require.Len(t, slots, 3)
+	assert.Equal(t, Slot{ID: 1, CtxSize: 4096, Processing: true, TaskID: 13}, slots[1])
+
+	saved, err := manager.SaveSlot(ctx, "qwen-7b", 0, "")
+	require.NoError(t, err)
+	assert.Equal(t, "qwen-7b-slot0.bin", saved.Filename)
+	assert.Equal(t, 1745, saved.Tokens)
+	assert.Equal(t, int64(1745*8192), saved.Size)
+	assert.False(t, saved.OnUnload)
+
+	_, err = manager.SaveSlot(ctx, "qwen-7b", 0, "system-prompt.bin")
+	require.NoError(t, err)
+	catalogue, err := manager.SavedSlots("qwen-7b")
+	require.NoError(t, err)
+	require.Len(t, catalogue, 2)
+	assert.Equal(t, "system-prompt.bin", catalogue[0].Filename)
+	assert.FileExists(t, filepath.Join(dir, slotIndexFile))
+
+	tokens, err := manager.RestoreSlot(ctx, "qwen-7b", 1, "system-prompt.bin")
+	require.NoError(t, err)
+	assert.Equal(t, 1745, tokens)
+	tokens, err = manager.EraseSlot(ctx, "qwen-7b", 1)
+	require.NoError(t, err)
+	assert.Equal(t, 1745, tokens)
+
+	assert.Equal(t, []string{
+		"save /slots/0 qwen-7b-slot0.bin",
+		"save /slots/0 system-prompt.bin",
+		"restore /slots/1 system-prompt.bin",
+		"erase /slots/1 ",
+	}, server.actions)
+
+	require.NoError(t, manager.DeleteSavedSlot("qwen-7b", "system-prompt.bin"))
+	assert.ErrorIs(t, manager.DeleteSavedSlot("qwen-7b", "system-prompt.bin"), ErrSavedSlotNotFound)
+	catalogue, err = manager.SavedSlots("qwen-7b")
+	require.NoError(t, err)
+	assert.Len(t, catalogue, 1)
+}
+
+func TestSlotErrors(t *testing.T) {
+	server := newFakeSlotServer(t)
+	manager := newSlotTestManager(t, server.port(t), t.TempDir())
+	ctx := context.Background()
+
+	_, err := manager.ListSlots(ctx, "missing")
+	assert.ErrorIs(t, err, ErrModelNotLoaded)
+	_, err = manager.SaveSlot(ctx, "llama-8b", 0, "")
+	assert.ErrorIs(t, err, ErrSlotSaveDisabled)
+
+	for _, filename := range []string{"", "../escape.bin", "dir/file.bin", slotIndexFile, ".."} {
+		_, err = manager.RestoreSlot(ctx, "qwen-7b", 0, filename)
+		assert.ErrorIs(t, err, ErrInvalidSlotFile, filename)
+	}
+
+	// 其他实例的存档不可删除
+	_, err = manager.SaveSlot(ctx, "qwen-7b", 0, "shared.bin")
+	require.NoError(t, err)
+	manager.statuses["qwen-7b@b"] = &ModelStatus{ID: "qwen-7b@b", ModelID: "qwen-7b", State: StateUnloaded, SlotSavePath: manager.statuses["qwen-7b"].SlotSavePath}
+	assert.ErrorIs(t, manager.DeleteSavedSlot("qwen-7b@b", "shared.bin"), ErrSavedSlotNotFound)
+}
+
+func TestDefaultSlotFilename(t *testing.T) {
+	assert.Equal(t, "qwen-7b-slot0.bin", defaultSlotFilename("qwen-7b", 0))
+	assert.Equal(t, "qwen-7b_long-ctx-slot3.bin", defaultSlotFilename("qwen-7b@long-ctx", 3))
+	assert.True(t, validSlotFilename(defaultSlotFilename("org/model:q4@a b", 1)))
+}
+
+func TestUnloadSavesAndLoadRestoresSlots(t *testing.T) {
+	server := newFakeSlotServer(t)
+	dir := t.TempDir()
+	port := server.port(t)
+	manager := newSlotTestManager(t, port, dir)
+
+	// 进程管理器中没有该实例，卸载失败但槽位已保存
+	err := manager.UnloadWithOptions("qwen-7b", UnloadOptions{SaveSlots: true})
+	require.Error(t, err)
+
+	saved, err := manager.SavedSlots("qwen-7b")
+	require.NoError(t, err)
+	require.Len(t, saved, 1, "unused slot 2 and empty slot 1 are not catalogued")
+	assert.Equal(t, 0, saved[0].Slot)
+	assert.True(t, saved[0].OnUnload)
+	_, err = os.Stat(filepath.Join(dir, "qwen-7b-slot1.bin"))
+	assert.True(t, os.IsNotExist(err))
+
+	// 槽位存档目录未配置时不保存也不卸载
+	assert.ErrorIs(t, manager.UnloadWithOptions("llama-8b", UnloadOptions{SaveSlots: true}), ErrSlotSaveDisabled)
+
+	server.mu.Lock()
+	server.actions = nil
+	server.mu.Unlock()
+	_, err = manager.SaveSlot(context.Background(), "qwen-7b", 1, "manual.bin")
+	require.NoError(t, err)
+
+	manager.startSlotRestore("qwen-7b", port, dir)
+	manager.wg.Wait()
+
+	// 只恢复卸载时自动保存的槽位
+	assert.Equal(t, []string{
+		"save /slots/1 manual.bin",
+		"restore /slots/0 qwen-7b-slot0.bin",
+	}, server.actions)
+}
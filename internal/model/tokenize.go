@@ -0,0 +1,295 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tokenizer"
+)
+
+// Sources of tokenization results
+const (
+	TokenSourceServer = "llama-server" // 已加载实例的 llama-server
+	TokenSourceGGUF   = "gguf"         // 按 GGUF 词表在本地分词
+)
+
+// ErrInvalidToken is returned when a token ID is outside the vocabulary
+var ErrInvalidToken = errors.New("invalid token id")
+
+// maxCachedTokenizers 本地分词器缓存的最大模型数，词表较大时每个约占数十 MB
+const maxCachedTokenizers = 4
+
+// tokenizeClient 调用 llama-server 分词接口的 HTTP 客户端
+var tokenizeClient = &http.Client{Timeout: 30 * time.Second}
+
+// TokenizeResult is the result of tokenizing text
+type TokenizeResult struct {
+	Tokens []int    `json:"tokens"`
+	Pieces []string `json:"pieces,omitempty"`
+	Count  int      `json:"count"`
+	Source string   `json:"source"`
+}
+
+// DetokenizeResult is the text of a token sequence
+type DetokenizeResult struct {
+	Content string `json:"content"`
+	Source  string `json:"source"`
+}
+
+// TokenCount is the number of prompt tokens of a chat request
+type TokenCount struct {
+	Count    int    `json:"count"`
+	CtxSize  int    `json:"ctxSize"`            // 已加载实例的上下文长度，未加载时为按需加载使用的值
+	Template string `json:"template,omitempty"` // 未加载时使用的内置模板格式
+	Source   string `json:"source"`
+}
+
+// Tokenize converts text to tokens with the running llama-server of the
+// model, or with the GGUF vocabulary when the model is not loaded
+func (m *Manager) Tokenize(ctx context.Context, modelID, content string, addSpecial, withPieces bool) (*TokenizeResult, error) {
+	if port, _, ok := m.tokenizeInstance(modelID); ok {
+		return serverTokenize(ctx, port, content, addSpecial, withPieces)
+	}
+
+	tok, err := m.localTokenizer(modelID)
+	if err != nil {
+		return nil, err
+	}
+	tokens := tok.Encode(content, addSpecial)
+	result := &TokenizeResult{Tokens: tokens, Count: len(tokens), Source: TokenSourceGGUF}
+	if withPieces {
+		result.Pieces = make([]string, len(tokens))
+		for i, id := range tokens {
+			result.Pieces[i] = tok.Piece(id)
+		}
+	}
+	return result, nil
+}
+
+// Detokenize converts tokens back to text
+func (m *Manager) Detokenize(ctx context.Context, modelID string, tokens []int) (*DetokenizeResult, error) {
+	if port, _, ok := m.tokenizeInstance(modelID); ok {
+		var resp struct {
+			Content string `json:"content"`
+		}
+		if err := postLlamaJSON(ctx, port, "/detokenize", map[string]interface{}{"tokens": tokens}, &resp); err != nil {
+			return nil, err
+		}
+		return &DetokenizeResult{Content: resp.Content, Source: TokenSourceServer}, nil
+	}
+
+	tok, err := m.localTokenizer(modelID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range tokens {
+		if id < 0 || id >= tok.VocabSize() {
+			return nil, fmt.Errorf("%w %d (vocabulary size %d)", ErrInvalidToken, id, tok.VocabSize())
+		}
+	}
+	return &DetokenizeResult{Content: tok.Decode(tokens), Source: TokenSourceGGUF}, nil
+}
+
+// CountTokens counts the prompt tokens of OpenAI format chat messages after
+// the model's chat template is applied. A loaded model uses llama-server's
+// Jinja template; otherwise a built-in format detected from the GGUF
+// template is used, which may differ slightly from the real template.
+func (m *Manager) CountTokens(ctx context.Context, modelID string, messages, tools []map[string]interface{}) (*TokenCount, error) {
+	if port, ctxSize, ok := m.tokenizeInstance(modelID); ok {
+		body := map[string]interface{}{"messages": messages}
+		if len(tools) > 0 {
+			body["tools"] = tools
+		}
+		var resp struct {
+			Prompt string `json:"prompt"`
+		}
+		if err := postLlamaJSON(ctx, port, "/apply-template", body, &resp); err != nil {
+			return nil, err
+		}
+		result, err := serverTokenize(ctx, port, resp.Prompt, true, false)
+		if err != nil {
+			return nil, err
+		}
+		return &TokenCount{Count: result.Count, CtxSize: ctxSize, Source: TokenSourceServer}, nil
+	}
+
+	tok, err := m.localTokenizer(modelID)
+	if err != nil {
+		return nil, err
+	}
+	template := tokenizer.DetectTemplate(tok.ChatTemplate())
+	prompt := tokenizer.ApplyTemplate(template, flattenMessages(messages, tools), true)
+
+	count := &TokenCount{Count: len(tok.Encode(prompt, true)), Template: template, Source: TokenSourceGGUF}
+	if req, err := m.autoLoadRequest(modelID); err == nil {
+		count.CtxSize = req.CtxSize
+	}
+	return count, nil
+}
+
+// tokenizeInstance 返回为模型提供服务的已加载实例的端口和上下文长度
+func (m *Manager) tokenizeInstance(modelID string) (int, int, bool) {
+	status, exists := m.GetStatus(m.PickReplica(modelID, ""))
+	if !exists || status.State != StateLoaded || status.Port == 0 {
+		return 0, 0, false
+	}
+	return status.Port, status.CtxSize, true
+}
+
+// localTokenizer 返回按模型 GGUF 词表构建的分词器，构建结果会缓存
+func (m *Manager) localTokenizer(modelID string) (*tokenizer.Tokenizer, error) {
+	model, exists := m.GetModel(modelID)
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrModelNotFound, modelID)
+	}
+
+	m.tokenizerMu.Lock()
+	defer m.tokenizerMu.Unlock()
+
+	if tok, exists := m.tokenizers[modelID]; exists {
+		return tok, nil
+	}
+
+	path := model.Path
+	if len(model.ShardFiles) > 0 {
+		path = model.ShardFiles[0]
+	}
+	startTime := time.Now()
+	tok, err := tokenizer.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("load tokenizer of %s: %w", modelID, err)
+	}
+	logger.Info("已从 GGUF 词表构建分词器", "modelId", modelID, "vocabSize", tok.VocabSize(), "duration", time.Since(startTime).String())
+
+	if len(m.tokenizers) >= maxCachedTokenizers {
+		for id := range m.tokenizers {
+			delete(m.tokenizers, id)
+			break
+		}
+	}
+	m.tokenizers[modelID] = tok
+	return tok, nil
+}
+
+// flattenMessages 将 OpenAI 格式的消息展开为文本，工具定义以 JSON 并入系统提示词
+func flattenMessages(messages, tools []map[string]interface{}) []tokenizer.Message {
+	flattened := make([]tokenizer.Message, 0, len(messages)+1)
+	for _, msg := range messages {
+		role, _ := msg["role"].(string)
+		var parts []string
+		switch content := msg["content"].(type) {
+		case string:
+			parts = append(parts, content)
+		case []interface{}:
+			for _, part := range content {
+				if p, ok := part.(map[string]interface{}); ok {
+					if text, ok := p["text"].(string); ok {
+						parts = append(parts, text)
+					}
+				}
+			}
+		case []map[string]interface{}:
+			for _, p := range content {
+				if text, ok := p["text"].(string); ok {
+					parts = append(parts, text)
+				}
+			}
+		}
+		if toolCalls, exists := msg["tool_calls"]; exists {
+			data, _ := json.Marshal(toolCalls)
+			parts = append(parts, string(data))
+		}
+		flattened = append(flattened, tokenizer.Message{Role: role, Content: strings.Join(parts, "\n")})
+	}
+
+	// 工具定义追加到系统提示词之后，与多数模板一致
+	if len(tools) > 0 {
+		data, _ := json.Marshal(tools)
+		if len(flattened) > 0 && flattened[0].Role == "system" {
+			flattened[0].Content += "\n\n" + string(data)
+		} else {
+			flattened = append([]tokenizer.Message{{Role: "system", Content: string(data)}}, flattened...)
+		}
+	}
+	return flattened
+}
+
+// serverTokenize 调用 llama-server /tokenize
+func serverTokenize(ctx context.Context, port int, content string, addSpecial, withPieces bool) (*TokenizeResult, error) {
+	body := map[string]interface{}{"content": content, "add_special": addSpecial, "with_pieces": withPieces}
+	var resp struct {
+		Tokens []json.RawMessage `json:"tokens"`
+	}
+	if err := postLlamaJSON(ctx, port, "/tokenize", body, &resp); err != nil {
+		return nil, err
+	}
+
+	result := &TokenizeResult{Tokens: make([]int, len(resp.Tokens)), Count: len(resp.Tokens), Source: TokenSourceServer}
+	if withPieces {
+		result.Pieces = make([]string, len(resp.Tokens))
+	}
+	for i, raw := range resp.Tokens {
+		if !withPieces {
+			if err := json.Unmarshal(raw, &result.Tokens[i]); err != nil {
+				return nil, fmt.Errorf("invalid /tokenize response: %w", err)
+			}
+			continue
+		}
+		// with_pieces 时每个 token 为 {"id", "piece"}，piece 不是合法 UTF-8 时为字节数组
+		var token struct {
+			ID    int             `json:"id"`
+			Piece json.RawMessage `json:"piece"`
+		}
+		if err := json.Unmarshal(raw, &token); err != nil {
+			return nil, fmt.Errorf("invalid /tokenize response: %w", err)
+		}
+		result.Tokens[i] = token.ID
+		var piece string
+		if err := json.Unmarshal(token.Piece, &piece); err != nil {
+			var byteValues []int
+			json.Unmarshal(token.Piece, &byteValues)
+			buf := make([]byte, len(byteValues))
+			for j, b := range byteValues {
+				buf[j] = byte(b)
+			}
+			piece = string(buf)
+		}
+		result.Pieces[i] = piece
+	}
+	return result, nil
+}
+
+// postLlamaJSON 向 llama-server 发送 JSON 请求并解析响应
+func postLlamaJSON(ctx context.Context, port int, path string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d%s", port, path), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := tokenizeClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("llama-server returned %d: %s", resp.StatusCode, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid %s response: %w", path, err)
+	}
+	return nil
+}
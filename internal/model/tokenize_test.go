@@ -0,0 +1,139 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/gguf"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tokenizer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeTokenizeServer 模拟 llama-server 的 /tokenize、/detokenize 和 /apply-template 接口
+func newFakeTokenizeServer(t *testing.T) int {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/tokenize":
+			if body["with_pieces"] == true {
+				w.Write([]byte(`{"tokens":[{"id":9906,"piece":"Hello"},{"id":228,"piece":[230,136]}]}`))
+				return
+			}
+			if body["content"] == "<|im_start|>user\nHi<|im_end|>\n<|im_start|>assistant\n" {
+				w.Write([]byte(`{"tokens":[1,2,3,4,5,6,7,8]}`))
+				return
+			}
+			w.Write([]byte(`{"tokens":[9906,228]}`))
+		case "/detokenize":
+			w.Write([]byte(`{"content":"Hello world"}`))
+		case "/apply-template":
+			w.Write([]byte(`{"prompt":"<|im_start|>user\nHi<|im_end|>\n<|im_start|>assistant\n"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(u.Port())
+	require.NoError(t, err)
+	return port
+}
+
+func TestTokenizeLoadedModel(t *testing.T) {
+	manager := NewManager(config.DefaultConfig(), nil, process.NewManager())
+	manager.models["qwen-7b"] = &Model{ID: "qwen-7b", Name: "qwen-7b"}
+	manager.statuses["qwen-7b"] = &ModelStatus{ID: "qwen-7b", ModelID: "qwen-7b", State: StateLoaded, Port: newFakeTokenizeServer(t), CtxSize: 8192}
+	ctx := context.Background()
+
+	result, err := manager.Tokenize(ctx, "qwen-7b", "Hello world", false, false)
+	require.NoError(t, err)
+	assert.Equal(t, &TokenizeResult{Tokens: []int{9906, 228}, Count: 2, Source: TokenSourceServer}, result)
+
+	// 不是合法 UTF-8 的片段以字节数组返回
+	result, err = manager.Tokenize(ctx, "qwen-7b", "Hello world", false, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Hello", "\xe6\x88"}, result.Pieces)
+
+	text, err := manager.Detokenize(ctx, "qwen-7b", []int{9906, 228})
+	require.NoError(t, err)
+	assert.Equal(t, &DetokenizeResult{Content: "Hello world", Source: TokenSourceServer}, text)
+
+	count, err := manager.CountTokens(ctx, "qwen-7b", []map[string]interface{}{{"role": "user", "content": "Hi"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &TokenCount{Count: 8, CtxSize: 8192, Source: TokenSourceServer}, count)
+}
+
+func TestTokenizeUnloadedModel(t *testing.T) {
+	manager := NewManager(config.DefaultConfig(), nil, process.NewManager())
+	manager.models["qwen-7b"] = &Model{ID: "qwen-7b", Name: "qwen-7b"}
+
+	vocab := &gguf.Vocabulary{
+		Model:  "gpt2",
+		Tokens: []string{"<|im_start|>", "<|im_end|>", "H", "i", "Hi", "u", "s", "e", "r", "user", "a", "t", "n", "Ċ"},
+		Merges: []string{"H i", "u s", "us e", "use r"},
+		Types:  []int32{gguf.TokenTypeControl, gguf.TokenTypeControl},
+
+		BosTokenID: -1, EosTokenID: 1, UnknownTokenID: -1,
+		ChatTemplate: "{% for message in messages %}{{'<|im_start|>' + message['role'] }}{% endfor %}",
+	}
+	tok, err := tokenizer.New(vocab)
+	require.NoError(t, err)
+	manager.tokenizers["qwen-7b"] = tok
+	ctx := context.Background()
+
+	result, err := manager.Tokenize(ctx, "qwen-7b", "Hi", true, true)
+	require.NoError(t, err)
+	assert.Equal(t, &TokenizeResult{Tokens: []int{4}, Pieces: []string{"Hi"}, Count: 1, Source: TokenSourceGGUF}, result)
+
+	text, err := manager.Detokenize(ctx, "qwen-7b", []int{0, 4})
+	require.NoError(t, err)
+	assert.Equal(t, "<|im_start|>Hi", text.Content)
+	_, err = manager.Detokenize(ctx, "qwen-7b", []int{99})
+	assert.ErrorIs(t, err, ErrInvalidToken)
+
+	// <|im_start|> user \n Hi <|im_end|> \n <|im_start|> a s s i s t a n t \n
+	count, err := manager.CountTokens(ctx, "qwen-7b", []map[string]interface{}{{"role": "user", "content": "Hi"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, tokenizer.TemplateChatML, count.Template)
+	assert.Equal(t, TokenSourceGGUF, count.Source)
+	assert.Equal(t, 4096, count.CtxSize)
+	assert.Equal(t, 17, count.Count)
+
+	_, err = manager.Tokenize(ctx, "missing", "Hi", false, false)
+	assert.ErrorIs(t, err, ErrModelNotFound)
+}
+
+func TestFlattenMessages(t *testing.T) {
+	messages := []map[string]interface{}{
+		{"role": "system", "content": "Be brief."},
+		{"role": "user", "content": []interface{}{
+			map[string]interface{}{"type": "text", "text": "What is in"},
+			map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": "data:"}},
+			map[string]interface{}{"type": "text", "text": "this image?"},
+		}},
+		{"role": "assistant", "content": nil, "tool_calls": []interface{}{map[string]interface{}{"id": "call_1"}}},
+	}
+	tools := []map[string]interface{}{{"type": "function"}}
+
+	assert.Equal(t, []tokenizer.Message{
+		{Role: "system", Content: "Be brief.\n\n[{\"type\":\"function\"}]"},
+		{Role: "user", Content: "What is in\nthis image?"},
+		{Role: "assistant", Content: "[{\"id\":\"call_1\"}]"},
+	}, flattenMessages(messages, tools))
+
+	assert.Equal(t, []tokenizer.Message{
+		{Role: "system", Content: "[{\"type\":\"function\"}]"},
+		{Role: "user", Content: "Hi"},
+	}, flattenMessages([]map[string]interface{}{{"role": "user", "content": "Hi"}}, tools))
+}
@@ -0,0 +1,53 @@
+package model
+
+import (
+	"context"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
+)
+
+// loadTrace 记录一次模型加载：model.load span 及其下依次进行的阶段子 span
+type loadTrace struct {
+	ctx   context.Context
+	span  *tracing.Span
+	phase *tracing.Span
+}
+
+// startLoadTrace 开始加载 span，父 span 为 req.TraceParent 描述的请求或命令
+func startLoadTrace(req *LoadRequest, instanceID string, async bool) *loadTrace {
+	ctx := tracing.ContextWithTraceParent(context.Background(), req.TraceParent)
+	ctx, span := tracing.Start(ctx, "model.load",
+		tracing.String("shepherd.model.id", instanceID),
+		tracing.Int("shepherd.model.ctx_size", req.CtxSize),
+		tracing.Int("shepherd.model.gpu_layers", req.GPULayers),
+		tracing.Bool("shepherd.model.async", async),
+	)
+	return &loadTrace{ctx: ctx, span: span}
+}
+
+// next 结束当前阶段并开始下一阶段
+func (t *loadTrace) next(phase string) {
+	t.phase.End()
+	_, t.phase = tracing.Start(t.ctx, "model.load."+phase)
+}
+
+// endLoadTrace 结束当前阶段和加载 span，加载未成功时两者均标记为失败
+func (m *Manager) endLoadTrace(t *loadTrace, status *ModelStatus) {
+	m.mu.RLock()
+	state := status.State
+	err := status.Error
+	port := status.Port
+	m.mu.RUnlock()
+
+	if state != StateLoaded {
+		message := "model load failed"
+		if err != nil {
+			message = err.Error()
+		}
+		t.phase.SetError(message)
+		t.span.SetError(message)
+	}
+	t.span.SetAttributes(tracing.String("shepherd.model.state", state.String()), tracing.Int("shepherd.model.port", port))
+	t.phase.End()
+	t.span.End()
+}
@@ -20,6 +20,8 @@ type Model struct {
 	PathPrefix  string   // Path prefix for duplicate identification (e.g., "models/A", "cache/B")
 	Size        int64    // File size in bytes
 	Favourite   bool     // User's favorite flag
+	Pinned      bool     // Pinned models are never unloaded for being idle
+	IdleTTL     int      // Idle unload timeout in seconds (0 = global default, -1 = never)
 	Tags        []string // Model tags for categorization (e.g., "chat", "code", "multilingual")
 	License     string   // Model license
 	Author      string   // Model author/organization
@@ -45,12 +47,14 @@ type Model struct {
 	// Usage statistics
 	LoadCount   int       // Number of times loaded
 	LastLoaded  time.Time // Last load time
-	TotalTokens int64     // Total tokens generated (if tracked)
+	TotalTokens int64     // Total tokens processed by proxied requests since startup
 }
 
 // ModelStatus represents the loading status of a model
 type ModelStatus struct {
-	ID        string
+	ID        string // 实例 ID：默认实例为模型 ID，命名副本为 "模型ID@副本名"
+	ModelID   string // 所属模型 ID
+	Replica   string // 副本名称，默认实例为空
 	Name      string
 	State     LoadState
 	ProcessID string
@@ -58,6 +62,35 @@ type ModelStatus struct {
 	CtxSize   int
 	LoadedAt  time.Time
 	Error     error
+
+	// 运行模式（来自加载参数），用于网关按能力路由
+	Embedding  bool // 以 --embedding 启动，仅提供向量接口
+	Reranking  bool // 以 --reranking 启动，仅提供重排序接口
+	UBatchSize int  // --ubatch-size，0 表示 llama.cpp 默认值
+	Vision     bool // 以 --mmproj 启动，可接受图像输入
+
+	// 并发槽位数（--parallel），网关据此限制同时转发的请求数
+	ParallelSlots int
+
+	// 以 --metrics 启动，/metrics 转发其指标
+	Metrics bool
+
+	// 推测解码：草稿模型及其累计接受统计（从进程输出解析）
+	DraftModelID   string
+	DraftAccepted  int64
+	DraftGenerated int64
+
+	// 启动时挂载的 LoRA 适配器 ID，下标即 llama-server 中的适配器 ID
+	Adapters []string
+
+	// 槽位存档目录（--slot-save-path），卸载后保留以便查看已保存的槽位
+	SlotSavePath string
+
+	// 空闲卸载跟踪
+	LastRequestAt  time.Time     // 最近一次代理请求的时间
+	KeepAlive      time.Duration // 请求指定的保留时间（Ollama keep_alive），负数表示不卸载
+	KeepAliveSet   bool          // KeepAlive 是否生效
+	ActiveRequests int           // 正在处理的代理请求数
 }
 
 // LoadState represents the loading state
@@ -101,6 +134,7 @@ type ScanConfig struct {
 // ScanResult represents the result of a scan operation
 type ScanResult struct {
 	Models       []*Model
+	Adapters     []*Adapter // LoRA 适配器
 	Errors       []ScanError
 	ScannedAt    time.Time
 	Duration     time.Duration
@@ -118,6 +152,7 @@ type ScanError struct {
 type LoadRequest struct {
 	ModelID       string `json:"modelId"`
 	NodeID        string `json:"nodeId"` // 指定运行节点 ID，为空表示自动调度
+	Replica       string `json:"replica"` // 副本名称，同一模型可用不同名称启动多个实例，为空表示默认实例
 	CtxSize       int    `json:"ctxSize"`
 	BatchSize     int    `json:"batchSize"`
 	Threads       int    `json:"threads"`
@@ -149,6 +184,7 @@ type LoadRequest struct {
 	NoWebUI       bool   `json:"noWebUI"`       // --no-webui flag
 	EnableMetrics bool   `json:"enableMetrics"` // --metrics flag
 	SlotSavePath  string `json:"slotSavePath"`  // --slot-save-path
+	RestoreSlots  bool   `json:"restoreSlots"`  // 就绪后恢复卸载时保存到 SlotSavePath 的槽位
 	CacheRAM      int    `json:"cacheRam"`      // --cache-ram size in MB
 
 	// Chat template configuration
@@ -171,6 +207,7 @@ type LoadRequest struct {
 	// Additional sampling parameters
 	LogitsAll       bool    `json:"logitsAll"`       // --logits-all
 	Reranking       bool    `json:"reranking"`       // --reranking
+	Embedding       bool    `json:"embedding"`       // --embedding
 	MinP            float64 `json:"minP"`            // --min-p
 	PresencePenalty float64 `json:"presencePenalty"` // --presence-penalty
 	FrequencyPenalty float64 `json:"frequencyPenalty"` // --frequency-penalty
@@ -180,6 +217,19 @@ type LoadRequest struct {
 	DisableJinja  bool   `json:"disableJinja"`  // --jinja (false to disable)
 	ChatTemplate  string `json:"chatTemplate"`  // --chat-template
 	ContextShift  bool   `json:"contextShift"`  // --context-shift
+
+	// Speculative decoding
+	DraftModelID   string   `json:"draftModelId"`   // 草稿模型 ID（-md），需与目标模型词表兼容
+	DraftMax       int      `json:"draftMax"`       // --draft-max
+	DraftMin       int      `json:"draftMin"`       // --draft-min
+	DraftGPULayers int      `json:"draftGpuLayers"` // -ngld
+	DraftDevices   []string `json:"draftDevices"`   // -devd
+
+	// LoRA adapters (--lora / --lora-scaled)，顺序即 llama-server 中的适配器 ID
+	Adapters []AdapterRef `json:"adapters"`
+
+	// TraceParent 发起加载的请求或命令的 W3C trace 上下文，加载 span 归入该 trace
+	TraceParent string `json:"-"`
 }
 
 // LoadResult represents the result of a load operation
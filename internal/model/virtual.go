@@ -0,0 +1,204 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
+)
+
+// ErrNoVirtualCandidate is returned when no model of a virtual model can
+// serve a request, e.g. because none has a large enough context
+var ErrNoVirtualCandidate = errors.New("no model of the virtual model can serve the request")
+
+// bytesPerToken 估算提示词 token 数时每个 token 对应的平均字节数
+const bytesPerToken = 4
+
+// RouteHints describe what a request needs from the model serving it
+type RouteHints struct {
+	PromptTokens int  // 估算的提示词 token 数
+	Tools        bool // 请求带工具定义
+	Vision       bool // 请求带图像
+}
+
+// EstimateTokens returns a rough token count for prompt text. It is only
+// meant for routing decisions, not for accounting.
+func EstimateTokens(texts ...string) int {
+	n := 0
+	for _, text := range texts {
+		n += len(text)
+	}
+	return (n + bytesPerToken - 1) / bytesPerToken
+}
+
+// VirtualModel returns the definition of a virtual model name
+func (m *Manager) VirtualModel(name string) (config.VirtualModelConfig, bool) {
+	if name == "" {
+		return config.VirtualModelConfig{}, false
+	}
+	for _, vm := range m.currentConfig().Gateway.VirtualModels {
+		if strings.EqualFold(vm.Name, name) {
+			return vm, true
+		}
+	}
+	return config.VirtualModelConfig{}, false
+}
+
+// ListVirtualModels returns all virtual model definitions
+func (m *Manager) ListVirtualModels() []config.VirtualModelConfig {
+	return m.currentConfig().Gateway.VirtualModels
+}
+
+// ResolveVirtual picks the concrete model that serves a request for a
+// virtual model name; ok is false when name is not a virtual model.
+//
+// Candidates are the models of the first matching rule followed by the
+// default list, without models whose context is too small for the prompt
+// or that cannot take images. The first loaded, healthy candidate with a
+// free slot is chosen, then the first loaded, healthy one; otherwise the
+// candidates are loaded on demand in order until one succeeds.
+func (m *Manager) ResolveVirtual(ctx context.Context, name string, hints RouteHints) (modelID string, ok bool, err error) {
+	vm, ok := m.VirtualModel(name)
+	if !ok {
+		return "", false, nil
+	}
+
+	ctx, span := tracing.Start(ctx, "model.route", tracing.String("shepherd.virtual_model", vm.Name))
+	defer func() {
+		span.SetAttributes(tracing.String("shepherd.model.id", modelID))
+		span.RecordError(err)
+		span.End()
+	}()
+
+	candidates := m.virtualCandidates(vm, hints)
+	if len(candidates) == 0 {
+		return "", true, fmt.Errorf("%w: %s", ErrNoVirtualCandidate, vm.Name)
+	}
+
+	now := time.Now()
+	for _, id := range candidates {
+		if m.hasAvailableReplica(id, now, true) {
+			return id, true, nil
+		}
+	}
+	for _, id := range candidates {
+		if m.hasAvailableReplica(id, now, false) {
+			return id, true, nil
+		}
+	}
+
+	for _, id := range candidates {
+		modelID, err = m.EnsureLoaded(ctx, id)
+		if err == nil {
+			return modelID, true, nil
+		}
+		if ctx.Err() != nil {
+			return "", true, err
+		}
+		logger.Warn("虚拟模型候选不可用，尝试下一个", "virtualModel", vm.Name, "modelId", id, "error", err)
+	}
+	return "", true, err
+}
+
+// virtualCandidates 返回按优先顺序排列、满足请求要求的模型 ID
+func (m *Manager) virtualCandidates(vm config.VirtualModelConfig, hints RouteHints) []string {
+	var names []string
+	for _, rule := range vm.Rules {
+		if ruleMatches(rule, hints) {
+			names = append(names, rule.Models...)
+			break
+		}
+	}
+	names = append(names, vm.Models...)
+
+	seen := make(map[string]bool)
+	candidates := make([]string, 0, len(names))
+	for _, name := range names {
+		model, ok := m.ResolveModel(name)
+		if !ok || seen[model.ID] {
+			continue
+		}
+		seen[model.ID] = true
+		if !m.fitsRequest(model, hints) {
+			continue
+		}
+		candidates = append(candidates, model.ID)
+	}
+	return candidates
+}
+
+// ruleMatches 规则中设置的条件全部满足时匹配
+func ruleMatches(rule config.VirtualModelRule, hints RouteHints) bool {
+	if rule.MinPromptTokens > 0 && hints.PromptTokens < rule.MinPromptTokens {
+		return false
+	}
+	if rule.Tools && !hints.Tools {
+		return false
+	}
+	return !rule.Vision || hints.Vision
+}
+
+// fitsRequest reports whether a model can take the request: the prompt must
+// fit its context, and images need a projector. Loaded instances are judged
+// by how they were started, unloaded models by their on-demand load settings.
+func (m *Manager) fitsRequest(model *Model, hints RouteHints) bool {
+	ctxSize := 0
+	vision := model.MmprojPath != ""
+	loaded := false
+
+	m.mu.RLock()
+	for id, status := range m.statuses {
+		if status.State != StateLoaded || statusModelID(id, status) != model.ID {
+			continue
+		}
+		if !loaded {
+			loaded, vision = true, false
+		}
+		ctxSize = max(ctxSize, status.CtxSize)
+		vision = vision || status.Vision
+	}
+	m.mu.RUnlock()
+
+	if !loaded {
+		if req, err := m.autoLoadRequest(model.ID); err == nil {
+			ctxSize = req.CtxSize
+		}
+	}
+
+	if hints.Vision && !vision {
+		return false
+	}
+	// 上下文大小未知（0 = llama.cpp 使用模型训练长度）时不做限制
+	return ctxSize <= 0 || hints.PromptTokens <= ctxSize
+}
+
+// hasAvailableReplica reports whether a model has a loaded, healthy instance;
+// with needFreeSlot the instance must also have an idle slot
+func (m *Manager) hasAvailableReplica(modelID string, now time.Time, needFreeSlot bool) bool {
+	m.mu.RLock()
+	var instances []string
+	for id, status := range m.statuses {
+		if status.State == StateLoaded && statusModelID(id, status) == modelID {
+			instances = append(instances, id)
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, id := range instances {
+		if !m.replicaHealthy(id, now) {
+			continue
+		}
+		if !needFreeSlot {
+			return true
+		}
+		if stats, exists := m.QueueStats(id); !exists || !stats.Saturated {
+			return true
+		}
+	}
+	return false
+}
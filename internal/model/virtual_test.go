@@ -0,0 +1,133 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newVirtualTestManager 创建带有 chat-default 虚拟模型的管理器：
+// small 和 large 已加载，vision 未加载
+func newVirtualTestManager(t *testing.T) *Manager {
+	t.Helper()
+
+	cfg := config.DefaultConfig()
+	cfg.Gateway.AutoLoad.Enabled = false
+	cfg.Gateway.VirtualModels = []config.VirtualModelConfig{{
+		Name:   "chat-default",
+		Models: []string{"small", "large", "vision"},
+		Rules: []config.VirtualModelRule{
+			{Tools: true, Models: []string{"large"}},
+		},
+	}}
+	models := []Model{
+		{ID: "small", Name: "Small"},
+		{ID: "large", Name: "Large"},
+		{ID: "vision", Name: "Vision", MmprojPath: "/models/mmproj.gguf"},
+	}
+	return newTestManager(t, cfg, models,
+		ModelStatus{ID: "small", ModelID: "small", State: StateLoaded, Port: 8081, CtxSize: 4096, ParallelSlots: 1},
+		ModelStatus{ID: "large", ModelID: "large", State: StateLoaded, Port: 8082, CtxSize: 32768, ParallelSlots: 1},
+	)
+}
+
+func TestEstimateTokens(t *testing.T) {
+	assert.Equal(t, 0, EstimateTokens())
+	assert.Equal(t, 1, EstimateTokens("abc"))
+	assert.Equal(t, 3, EstimateTokens("hello", "world!!"))
+}
+
+func TestResolveVirtual(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Not a virtual model", func(t *testing.T) {
+		manager := newVirtualTestManager(t)
+		_, ok, err := manager.ResolveVirtual(ctx, "small", RouteHints{})
+		assert.False(t, ok)
+		assert.NoError(t, err)
+	})
+
+	t.Run("First candidate", func(t *testing.T) {
+		manager := newVirtualTestManager(t)
+		modelID, ok, err := manager.ResolveVirtual(ctx, "Chat-Default", RouteHints{PromptTokens: 100})
+		require.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "small", modelID)
+	})
+
+	t.Run("Prompt longer than context", func(t *testing.T) {
+		manager := newVirtualTestManager(t)
+		modelID, _, err := manager.ResolveVirtual(ctx, "chat-default", RouteHints{PromptTokens: 8000})
+		require.NoError(t, err)
+		assert.Equal(t, "large", modelID)
+	})
+
+	t.Run("Tools rule", func(t *testing.T) {
+		manager := newVirtualTestManager(t)
+		modelID, _, err := manager.ResolveVirtual(ctx, "chat-default", RouteHints{Tools: true})
+		require.NoError(t, err)
+		assert.Equal(t, "large", modelID)
+	})
+
+	t.Run("Saturated falls back", func(t *testing.T) {
+		manager := newVirtualTestManager(t)
+		done, err := manager.AcquireSlot(ctx, "small")
+		require.NoError(t, err)
+		defer done()
+
+		modelID, _, err := manager.ResolveVirtual(ctx, "chat-default", RouteHints{})
+		require.NoError(t, err)
+		assert.Equal(t, "large", modelID)
+	})
+
+	t.Run("Erroring falls back", func(t *testing.T) {
+		manager := newVirtualTestManager(t)
+		manager.ReportUpstreamError("small", errors.New("connection refused"))
+
+		modelID, _, err := manager.ResolveVirtual(ctx, "chat-default", RouteHints{})
+		require.NoError(t, err)
+		assert.Equal(t, "large", modelID)
+	})
+
+	t.Run("All saturated queues on first", func(t *testing.T) {
+		manager := newVirtualTestManager(t)
+		for _, id := range []string{"small", "large"} {
+			done, err := manager.AcquireSlot(ctx, id)
+			require.NoError(t, err)
+			defer done()
+		}
+
+		modelID, _, err := manager.ResolveVirtual(ctx, "chat-default", RouteHints{})
+		require.NoError(t, err)
+		assert.Equal(t, "small", modelID)
+	})
+
+	t.Run("Vision needs a projector", func(t *testing.T) {
+		manager := newVirtualTestManager(t)
+		// vision 未加载且按需加载已关闭
+		_, ok, err := manager.ResolveVirtual(ctx, "chat-default", RouteHints{Vision: true})
+		assert.True(t, ok)
+		assert.ErrorIs(t, err, ErrAutoLoadDisabled)
+
+		manager.mu.Lock()
+		manager.statuses["vision"] = &ModelStatus{
+			ID: "vision", ModelID: "vision", State: StateLoaded, Port: 8083, Vision: true, LoadedAt: time.Now(),
+		}
+		manager.mu.Unlock()
+		modelID, _, err := manager.ResolveVirtual(ctx, "chat-default", RouteHints{Vision: true})
+		require.NoError(t, err)
+		assert.Equal(t, "vision", modelID)
+	})
+
+	t.Run("No candidate", func(t *testing.T) {
+		manager := newVirtualTestManager(t)
+		_, ok, err := manager.ResolveVirtual(ctx, "chat-default", RouteHints{PromptTokens: 100000})
+		assert.True(t, ok)
+		assert.ErrorIs(t, err, ErrNoVirtualCandidate)
+	})
+}
@@ -0,0 +1,150 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/pki"
+)
+
+// httpClient 返回访问 Master 的 HTTP 客户端，开启集群 mTLS 时出示节点证书
+func (n *Node) httpClient(timeout time.Duration) *http.Client {
+	client := &http.Client{Timeout: timeout}
+	if n.config != nil && n.config.Identity != nil {
+		client.Transport = tlsTransport(n.config.Identity.ClientTLSConfig())
+	}
+	return client
+}
+
+// ensureCertificate joins the cluster when mTLS is on and the node holds no
+// certificate yet, or its certificate has expired
+func (n *Node) ensureCertificate(ctx context.Context) error {
+	identity := n.config.Identity
+	if identity == nil || (identity.Ready() && time.Now().Before(identity.ExpiresAt())) {
+		return nil
+	}
+	if n.config.JoinToken == "" {
+		return errors.New("没有有效的节点证书，且未配置加入令牌 (node.client_role.ssl.join_token)")
+	}
+
+	ca, err := n.fetchMasterCA(ctx)
+	if err != nil {
+		return err
+	}
+	transport := tlsTransport(&tls.Config{MinVersion: tls.VersionTLS12, RootCAs: pki.RootPool(ca)})
+	return n.requestCertificate(ctx, transport, "/api/cluster/join", n.config.JoinToken)
+}
+
+// renewCertificate renews the node certificate with the current one once a
+// third of its lifetime is left
+func (n *Node) renewCertificate(ctx context.Context) {
+	identity := n.config.Identity
+	if identity == nil || !identity.Ready() || !identity.NeedsRenewal(time.Now()) {
+		return
+	}
+	if time.Now().After(identity.ExpiresAt()) {
+		// 证书已过期，只能凭加入令牌重新加入
+		if err := n.ensureCertificate(ctx); err != nil {
+			logger.Errorf("节点证书已过期，重新加入集群失败: %v", err)
+		}
+		return
+	}
+
+	transport := tlsTransport(identity.ClientTLSConfig())
+	if err := n.requestCertificate(ctx, transport, "/api/cluster/renew", ""); err != nil {
+		logger.Errorf("节点证书续期失败: %v", err)
+	}
+}
+
+// fetchMasterCA downloads the master's CA before the node trusts it. The
+// connection is not verified yet, so the CA is checked against the configured
+// fingerprint; without one the first CA seen is trusted.
+func (n *Node) fetchMasterCA(ctx context.Context) (*x509.Certificate, error) {
+	transport := tlsTransport(&tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: true})
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, n.config.MasterAddress+"/api/cluster/ca", nil)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		CA string `json:"ca"`
+	}
+	if err := doMasterRequest(&http.Client{Timeout: 30 * time.Second, Transport: transport}, req, &resp); err != nil {
+		return nil, fmt.Errorf("获取 Master CA 失败: %w", err)
+	}
+	ca, err := pki.ParseCertificate([]byte(resp.CA))
+	if err != nil {
+		return nil, fmt.Errorf("解析 Master CA 失败: %w", err)
+	}
+
+	fingerprint := pki.Fingerprint(ca)
+	if n.config.CAFingerprint == "" {
+		logger.Warnf("未配置 ca_fingerprint，信任 Master 提供的 CA: %s", fingerprint)
+	} else if !strings.EqualFold(n.config.CAFingerprint, fingerprint) {
+		return nil, fmt.Errorf("Master CA 指纹不匹配: 期望 %s，实际 %s", n.config.CAFingerprint, fingerprint)
+	}
+	return ca, nil
+}
+
+// requestCertificate 生成新私钥和证书请求，由 Master 签发后保存
+func (n *Node) requestCertificate(ctx context.Context, transport http.RoundTripper, path, token string) error {
+	csrPEM, keyPEM, err := pki.NewCSR(n.GetID(), pki.LocalHosts(n.GetAddress()))
+	if err != nil {
+		return fmt.Errorf("生成证书请求失败: %w", err)
+	}
+	body, err := json.Marshal(&pki.JoinRequest{NodeID: n.GetID(), Token: token, CSR: string(csrPEM)})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.config.MasterAddress+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	var resp pki.CertificateResponse
+	if err := doMasterRequest(&http.Client{Timeout: 30 * time.Second, Transport: transport}, req, &resp); err != nil {
+		return err
+	}
+	if err := n.config.Identity.Update([]byte(resp.Certificate), keyPEM, []byte(resp.CA)); err != nil {
+		return fmt.Errorf("保存节点证书失败: %w", err)
+	}
+	logger.Infof("已获得 Master 签发的节点证书，有效期至 %s", resp.ExpiresAt.Format(time.RFC3339))
+	return nil
+}
+
+// doMasterRequest 发送请求并解析 Master 统一响应中的 data 字段
+func doMasterRequest(client *http.Client, req *http.Request, data interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	envelope := struct {
+		Data interface{} `json:"data"`
+	}{Data: data}
+	return json.Unmarshal(body, &envelope)
+}
+
+func tlsTransport(cfg *tls.Config) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg
+	return transport
+}
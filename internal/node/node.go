@@ -51,6 +51,9 @@ type Node struct {
 	clientRegistry *clientRegistry
 	commandQueue   *commandQueue
 	commandResults *commandResultStore
+
+	// 已加载模型提供者（Client/Hybrid 角色），随心跳上报
+	modelsProvider func() []LoadedModel
 }
 
 // NewNode creates a new Node instance
@@ -475,6 +478,29 @@ func (n *Node) SetCapabilities(capabilities *NodeCapabilities) {
 	n.updatedAt = time.Now()
 }
 
+// SetModelsProvider 设置已加载模型提供者，心跳会上报其返回的模型列表
+func (n *Node) SetModelsProvider(provider func() []LoadedModel) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.modelsProvider = provider
+}
+
+// LoadedModels 返回节点已加载的模型，未设置提供者时返回 nil
+func (n *Node) LoadedModels() []LoadedModel {
+	n.mu.RLock()
+	provider := n.modelsProvider
+	n.mu.RUnlock()
+
+	if provider == nil {
+		return nil
+	}
+	models := provider()
+	if models == nil {
+		models = []LoadedModel{}
+	}
+	return models
+}
+
 // GetResources 获取节点资源信息
 func (n *Node) GetResources() *NodeResources {
 	n.mu.RLock()
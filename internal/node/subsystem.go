@@ -251,6 +251,7 @@ func (hs *HeartbeatSubsystem) heartbeatLoop(ctx context.Context) {
 		case <-ticker.C:
 			// 发送心跳到 Master（如果配置了 Master 地址）
 			if hs.node.config != nil && hs.node.config.MasterAddress != "" {
+				hs.node.renewCertificate(ctx)
 				hs.sendHeartbeatToMaster()
 			}
 			// 更新最后活跃时间
@@ -267,6 +268,7 @@ func (hs *HeartbeatSubsystem) sendHeartbeatToMaster() {
 		Timestamp: time.Now(),
 		Status:    hs.node.GetStatus(),
 		Resources: hs.node.GetResources(),
+		Models:    hs.node.LoadedModels(),
 	}
 
 	// 构建 Master URL
@@ -281,9 +283,7 @@ func (hs *HeartbeatSubsystem) sendHeartbeatToMaster() {
 	}
 
 	// 创建 HTTP 客户端（带超时）
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-	}
+	client := hs.node.httpClient(10 * time.Second)
 
 	// 创建 HTTP 请求
 	req, err := http.NewRequest("POST", masterURL, bytes.NewBuffer(body))
@@ -466,11 +466,6 @@ func (rs *RegistrationSubsystem) registerWithMaster(ctx context.Context) {
 		return
 	}
 
-	// 创建 HTTP 客户端（带超时）
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-
 	// 重试注册逻辑
 	maxRetries := rs.node.config.MaxRetries
 	if maxRetries <= 0 {
@@ -490,6 +485,12 @@ func (rs *RegistrationSubsystem) registerWithMaster(ctx context.Context) {
 			}
 		}
 
+		// 开启集群 mTLS 时先向 Master 申请节点证书
+		if err := rs.node.ensureCertificate(ctx); err != nil {
+			logger.Errorf("申请节点证书失败: %v", err)
+			continue
+		}
+
 		// 创建 HTTP 请求
 		req, err := http.NewRequestWithContext(ctx, "POST", masterURL, bytes.NewBuffer(body))
 		if err != nil {
@@ -498,7 +499,8 @@ func (rs *RegistrationSubsystem) registerWithMaster(ctx context.Context) {
 		}
 		req.Header.Set("Content-Type", "application/json")
 
-		// 发送请求
+		// 发送请求（带超时），证书在申请后才可用，每次重新创建客户端
+		client := rs.node.httpClient(30 * time.Second)
 		resp, err := client.Do(req)
 		if err != nil {
 			logger.Errorf("发送注册请求失败: %v", err)
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/shepherd-project/shepherd/Shepherd/internal/gpu"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/pki"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/types"
 )
 
@@ -137,6 +138,28 @@ type Command struct {
 	MaxRetries int                    `json:"maxRetries"`
 }
 
+// PayloadTraceParent is the payload key carrying the W3C traceparent of the
+// operation that issued the command. It travels in the payload so that it
+// survives the scheduler, which forwards task payloads unchanged.
+const PayloadTraceParent = "traceparent"
+
+// TraceParent returns the traceparent carried in the payload, or ""
+func (c *Command) TraceParent() string {
+	value, _ := c.Payload[PayloadTraceParent].(string)
+	return value
+}
+
+// SetTraceParent stores a traceparent in the payload; "" leaves it unchanged
+func (c *Command) SetTraceParent(value string) {
+	if value == "" {
+		return
+	}
+	if c.Payload == nil {
+		c.Payload = make(map[string]interface{})
+	}
+	c.Payload[PayloadTraceParent] = value
+}
+
 // CommandResult represents the result of a command execution
 type CommandResult struct {
 	CommandID   string                 `json:"commandId"`
@@ -160,6 +183,18 @@ type HeartbeatMessage struct {
 	Capabilities *NodeCapabilities      `json:"capabilities,omitempty"`
 	Metadata     map[string]interface{} `json:"metadata,omitempty"`
 	Sequence     int64                  `json:"sequence"`
+
+	// Models 节点当前已加载的模型，Master 据此维护请求路由表。
+	// nil 表示节点未上报（旧版本客户端），空切片表示没有已加载的模型。
+	Models []LoadedModel `json:"models"`
+}
+
+// LoadedModel describes a model loaded on a node, reported in heartbeats
+type LoadedModel struct {
+	ID    string `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Alias string `json:"alias,omitempty"`
+	Port  int    `json:"port"` // llama-server 端口
 }
 
 // HealthStatus represents the health status of a node
@@ -216,6 +251,10 @@ type NodeConfig struct {
 	Tags                []string          `json:"tags"`           // 节点标签
 	Metadata            map[string]string `json:"metadata"`       // 节点元数据
 	Capabilities        *NodeCapabilities `json:"capabilities"`   // 节点能力
+	// 集群 mTLS：Identity 非空时通过 HTTPS 连接 Master 并出示节点证书
+	Identity      *pki.Identity `json:"-"`
+	JoinToken     string        `json:"-"`                       // 首次加入时出示的令牌
+	CAFingerprint string        `json:"caFingerprint,omitempty"` // Master CA 指纹，空 = 信任首次连接时的 CA
 }
 
 // NodeConnection represents a connection between nodes
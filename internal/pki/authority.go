@@ -0,0 +1,460 @@
+// Package pki runs the built-in cluster certificate authority. The master
+// signs node certificates at join time; clients keep their certificate in an
+// Identity and renew it before it expires.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCACert 内置 CA 证书的默认路径
+	DefaultCACert = "data/pki/ca.crt"
+	// DefaultCAKey 内置 CA 私钥的默认路径
+	DefaultCAKey = "data/pki/ca.key"
+	// DefaultValidity 节点证书的默认有效期
+	DefaultValidity = 30 * 24 * time.Hour
+
+	// caValidity 内置 CA 的有效期
+	caValidity = 10 * 365 * 24 * time.Hour
+	// clockSkew 证书生效时间提前量，容忍节点间时钟偏差
+	clockSkew = 5 * time.Minute
+	// masterUnit Master 为自身签发的证书的组织单位，节点加入时签发的证书不带此项
+	masterUnit = "master"
+)
+
+// Authority signs node certificates with the cluster CA
+type Authority struct {
+	cert     *x509.Certificate
+	key      crypto.Signer
+	certPEM  []byte
+	validity time.Duration
+}
+
+// LoadOrCreateAuthority loads the CA from certPath and keyPath, creating a new
+// self-signed CA when neither file exists. Empty paths use the defaults and a
+// zero validity uses DefaultValidity for issued certificates.
+func LoadOrCreateAuthority(certPath, keyPath string, validity time.Duration) (*Authority, error) {
+	if certPath == "" {
+		certPath = DefaultCACert
+	}
+	if keyPath == "" {
+		keyPath = DefaultCAKey
+	}
+	if validity <= 0 {
+		validity = DefaultValidity
+	}
+
+	certPEM, certErr := os.ReadFile(certPath)
+	keyPEM, keyErr := os.ReadFile(keyPath)
+	switch {
+	case certErr == nil && keyErr == nil:
+		return parseAuthority(certPEM, keyPEM, validity)
+	case errors.Is(certErr, os.ErrNotExist) && errors.Is(keyErr, os.ErrNotExist):
+	case certErr != nil && !errors.Is(certErr, os.ErrNotExist):
+		return nil, fmt.Errorf("读取 CA 证书失败: %w", certErr)
+	case keyErr != nil && !errors.Is(keyErr, os.ErrNotExist):
+		return nil, fmt.Errorf("读取 CA 私钥失败: %w", keyErr)
+	default:
+		return nil, fmt.Errorf("CA 证书和私钥必须同时存在: %s, %s", certPath, keyPath)
+	}
+
+	certPEM, keyPEM, err := newCA()
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(certPath, certPEM, 0644); err != nil {
+		return nil, err
+	}
+	if err := writeFile(keyPath, keyPEM, 0600); err != nil {
+		return nil, err
+	}
+	return parseAuthority(certPEM, keyPEM, validity)
+}
+
+// parseAuthority 解析 CA 证书和私钥
+func parseAuthority(certPEM, keyPEM []byte, validity time.Duration) (*Authority, error) {
+	cert, err := ParseCertificate(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("解析 CA 证书失败: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, errors.New("证书不是 CA 证书")
+	}
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("解析 CA 私钥失败: %w", err)
+	}
+	if !publicKeysEqual(cert.PublicKey, key.Public()) {
+		return nil, errors.New("CA 证书与私钥不匹配")
+	}
+	return &Authority{cert: cert, key: key, certPEM: certPEM, validity: validity}, nil
+}
+
+// newCA 生成自签名 CA
+func newCA() (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Shepherd Cluster CA"},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err = encodePrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM, nil
+}
+
+// CertPEM returns the CA certificate in PEM form
+func (a *Authority) CertPEM() []byte {
+	return a.certPEM
+}
+
+// Fingerprint returns the SHA-256 fingerprint clients use to pin the CA
+func (a *Authority) Fingerprint() string {
+	return Fingerprint(a.cert)
+}
+
+// Pool returns a pool containing only the CA, for verifying node certificates
+func (a *Authority) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(a.cert)
+	return pool
+}
+
+// SignCSR signs a node certificate for nodeID. The node ID becomes the
+// common name and peer, the address the request came from, the only subject
+// alternative name: names in the request are ignored, so a join token cannot
+// obtain a certificate for another host. The certificate also serves the
+// node's own listeners, which the master verifies when forwarding requests.
+func (a *Authority) SignCSR(csrPEM []byte, nodeID string, peer net.IP) ([]byte, error) {
+	if nodeID == "" {
+		return nil, errors.New("节点 ID 不能为空")
+	}
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("无效的证书请求")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析证书请求失败: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("证书请求签名无效: %w", err)
+	}
+
+	var ips []net.IP
+	if peer != nil {
+		ips = []net.IP{peer}
+	}
+	der, err := a.sign(csr.PublicKey, pkix.Name{CommonName: nodeID}, nil, ips)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// Issue creates a key pair and certificate for commonName, used by the master
+// for its own listener and for the connections it makes to client nodes. The
+// certificate is marked as the master's, see PeerIsMaster.
+func (a *Authority) Issue(commonName string, hosts []string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	dnsNames, ips := splitHosts(hosts)
+	subject := pkix.Name{CommonName: commonName, OrganizationalUnit: []string{masterUnit}}
+	der, err := a.sign(key.Public(), subject, dnsNames, ips)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der, a.cert.Raw}, PrivateKey: key, Leaf: leaf}, nil
+}
+
+// ServerTLSConfig returns a listener config that verifies client certificates
+// against the CA when one is presented. cert is served when non-nil;
+// otherwise the authority issues a certificate for commonName and hosts and
+// reissues it before it expires.
+func (a *Authority) ServerTLSConfig(cert *tls.Certificate, commonName string, hosts []string) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  a.Pool(),
+	}
+	if cert != nil {
+		cfg.Certificates = []tls.Certificate{*cert}
+	} else {
+		issued := &issuedCert{authority: a, commonName: commonName, hosts: hosts}
+		cfg.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return issued.get()
+		}
+	}
+	return cfg
+}
+
+// ClientTLSConfig returns a config for connections from the master to client
+// nodes: the node must present a certificate from the CA, and the master
+// authenticates with its own certificate issued for commonName
+func (a *Authority) ClientTLSConfig(commonName string) *tls.Config {
+	issued := &issuedCert{authority: a, commonName: commonName}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    RootPool(a.cert),
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return issued.get()
+		},
+	}
+}
+
+// issuedCert 由 CA 为本节点签发的证书，剩余有效期不足三分之一时重新签发
+type issuedCert struct {
+	authority  *Authority
+	commonName string
+	hosts      []string
+
+	mu   sync.Mutex
+	cert *tls.Certificate
+}
+
+func (c *issuedCert) get() (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cert != nil && !renewalDue(c.cert.Leaf, time.Now()) {
+		return c.cert, nil
+	}
+	cert, err := c.authority.Issue(c.commonName, c.hosts)
+	if err != nil {
+		return nil, err
+	}
+	c.cert = &cert
+	return c.cert, nil
+}
+
+// sign 用 CA 签发同时可用于服务端和客户端认证的证书。节点证书也需要服务端认证：
+// 节点的监听端口出示该证书，Master 转发请求时校验
+func (a *Authority) sign(pub crypto.PublicKey, subject pkix.Name, dnsNames []string, ips []net.IP) ([]byte, error) {
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(a.validity)
+	if notAfter.After(a.cert.NotAfter) {
+		notAfter = a.cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    now.Add(-clockSkew),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, a.cert, pub, a.key)
+	if err != nil {
+		return nil, fmt.Errorf("签发证书失败: %w", err)
+	}
+	return der, nil
+}
+
+// NewCSR creates a private key and a certificate request for a node. hosts
+// are the names and addresses the node's listeners are reached at.
+func NewCSR(nodeID string, hosts []string) (csrPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	dnsNames, ips := splitHosts(hosts)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:     pkix.Name{CommonName: nodeID},
+		DNSNames:    dnsNames,
+		IPAddresses: ips,
+	}, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err = encodePrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), keyPEM, nil
+}
+
+// Fingerprint returns "sha256:" followed by the hex SHA-256 of the certificate
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// PeerNodeID returns the node ID of a request made with a verified client
+// certificate. The listener must verify client certificates against the CA.
+func PeerNodeID(r *http.Request) (string, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	id := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	return id, id != ""
+}
+
+// PeerIsMaster reports whether a request was made with a verified client
+// certificate the master issued for itself. Node certificates never carry
+// the master's mark, whatever the node ID or certificate request.
+func PeerIsMaster(r *http.Request) bool {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return false
+	}
+	for _, unit := range r.TLS.VerifiedChains[0][0].Subject.OrganizationalUnit {
+		if unit == masterUnit {
+			return true
+		}
+	}
+	return false
+}
+
+// LocalHosts returns the names a listener on this machine is reached at:
+// address, the hostname, the loopback addresses and the interface addresses
+func LocalHosts(address string) []string {
+	hosts := []string{"localhost", "127.0.0.1", "::1"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		hosts = append(hosts, hostname)
+	}
+	if address != "" && address != "0.0.0.0" && address != "::" {
+		hosts = append(hosts, address)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() {
+				hosts = append(hosts, ipNet.IP.String())
+			}
+		}
+	}
+	return hosts
+}
+
+// splitHosts 将主机列表拆分为 DNS 名称和 IP 地址
+func splitHosts(hosts []string) (dnsNames []string, ips []net.IP) {
+	seen := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		if host == "" || seen[host] {
+			continue
+		}
+		seen[host] = true
+		if ip := net.ParseIP(host); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			dnsNames = append(dnsNames, host)
+		}
+	}
+	return dnsNames, ips
+}
+
+// renewalDue 证书剩余有效期不足三分之一时需要续期
+func renewalDue(leaf *x509.Certificate, now time.Time) bool {
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return now.After(leaf.NotAfter.Add(-lifetime / 3))
+}
+
+func newSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// ParseCertificate parses a PEM-encoded certificate
+func ParseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("无效的 PEM 证书")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// parsePrivateKey 解析 PKCS#8、EC 或 PKCS#1 格式的私钥
+func parsePrivateKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("无效的 PEM 私钥")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("不支持的私钥类型")
+		}
+		return signer, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+func encodePrivateKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+// writeFile 先写临时文件再重命名，避免中断时留下不完整的证书
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("创建证书目录失败: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return fmt.Errorf("写入 %s 失败: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("写入 %s 失败: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestAuthority 在临时目录创建 CA
+func newTestAuthority(t *testing.T, validity time.Duration) *Authority {
+	t.Helper()
+	dir := t.TempDir()
+	authority, err := LoadOrCreateAuthority(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"), validity)
+	require.NoError(t, err)
+	return authority
+}
+
+func TestLoadOrCreateAuthority(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")
+
+	created, err := LoadOrCreateAuthority(certPath, keyPath, 0)
+	require.NoError(t, err)
+	info, err := os.Stat(keyPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// 再次加载得到同一个 CA
+	loaded, err := LoadOrCreateAuthority(certPath, keyPath, 0)
+	require.NoError(t, err)
+	assert.Equal(t, created.Fingerprint(), loaded.Fingerprint())
+
+	// 只有证书没有私钥时拒绝重新生成
+	require.NoError(t, os.Remove(keyPath))
+	_, err = LoadOrCreateAuthority(certPath, keyPath, 0)
+	assert.Error(t, err)
+}
+
+func TestSignCSR(t *testing.T) {
+	authority := newTestAuthority(t, 24*time.Hour)
+	csrPEM, _, err := NewCSR("node-a", []string{"node-a.local", "10.0.0.5"})
+	require.NoError(t, err)
+
+	certPEM, err := authority.SignCSR(csrPEM, "node-a", net.ParseIP("10.0.0.7"))
+	require.NoError(t, err)
+	cert, err := ParseCertificate(certPEM)
+	require.NoError(t, err)
+
+	// 只保留请求来源地址，忽略证书请求中的名称
+	assert.Equal(t, "node-a", cert.Subject.CommonName)
+	assert.Empty(t, cert.DNSNames)
+	require.Len(t, cert.IPAddresses, 1)
+	assert.Equal(t, "10.0.0.7", cert.IPAddresses[0].String())
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), cert.NotAfter, time.Minute)
+
+	// 证书可同时用于服务端和客户端认证
+	for _, usage := range []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth} {
+		_, err = cert.Verify(x509.VerifyOptions{Roots: authority.Pool(), KeyUsages: []x509.ExtKeyUsage{usage}})
+		assert.NoError(t, err)
+	}
+
+	_, err = authority.SignCSR([]byte("not a csr"), "node-a", nil)
+	assert.Error(t, err)
+	_, err = authority.SignCSR(csrPEM, "", nil)
+	assert.Error(t, err)
+}
+
+func TestSignedByOtherAuthorityIsRejected(t *testing.T) {
+	authority := newTestAuthority(t, 0)
+	other := newTestAuthority(t, 0)
+
+	cert, err := other.Issue("node-a", nil)
+	require.NoError(t, err)
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{
+		Roots:     authority.Pool(),
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	assert.Error(t, err)
+}
+
+func TestPeerIsMaster(t *testing.T) {
+	authority := newTestAuthority(t, 0)
+	peer := func(cert *x509.Certificate) *http.Request {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return req
+	}
+
+	master, err := authority.Issue("master-1", nil)
+	require.NoError(t, err)
+	assert.True(t, PeerIsMaster(peer(master.Leaf)))
+
+	// 节点不能通过证书请求冒充 Master
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: "master-1", OrganizationalUnit: []string{masterUnit}},
+	}, key)
+	require.NoError(t, err)
+	certPEM, err := authority.SignCSR(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), "node-a", nil)
+	require.NoError(t, err)
+	node, err := ParseCertificate(certPEM)
+	require.NoError(t, err)
+	assert.False(t, PeerIsMaster(peer(node)))
+
+	assert.False(t, PeerIsMaster(httptest.NewRequest("POST", "/v1/chat/completions", nil)))
+}
+
+func TestRenewalDue(t *testing.T) {
+	now := time.Now()
+	leaf := &x509.Certificate{NotBefore: now, NotAfter: now.Add(30 * 24 * time.Hour)}
+
+	assert.False(t, renewalDue(leaf, now.Add(10*24*time.Hour)))
+	assert.True(t, renewalDue(leaf, now.Add(21*24*time.Hour)))
+	assert.True(t, renewalDue(leaf, now.Add(31*24*time.Hour)))
+}
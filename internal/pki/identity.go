@@ -0,0 +1,236 @@
+package pki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// DefaultIdentityDir 客户端节点证书的默认目录
+const DefaultIdentityDir = "data/pki/node"
+
+const (
+	identityCertFile = "node.crt"
+	identityKeyFile  = "node.key"
+	identityCAFile   = "ca.crt"
+)
+
+// JoinRequest asks the master for a node certificate. Token is the master's
+// join token on first join and empty when renewing with a valid certificate.
+type JoinRequest struct {
+	NodeID string `json:"nodeId"`
+	Token  string `json:"token,omitempty"`
+	CSR    string `json:"csr"`
+}
+
+// CertificateResponse carries a signed node certificate and the CA it chains to
+type CertificateResponse struct {
+	Certificate string    `json:"certificate"`
+	CA          string    `json:"ca"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// Identity holds a client node's certificate, private key and cluster CA.
+// The TLS configs it hands out read the current certificate on every
+// handshake, so renewals take effect without restarting listeners.
+type Identity struct {
+	dir string
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	ca   *x509.Certificate
+}
+
+// LoadIdentity loads the identity stored in dir. A missing certificate is not
+// an error; the identity is simply not Ready until the node joins.
+func LoadIdentity(dir string) (*Identity, error) {
+	if dir == "" {
+		dir = DefaultIdentityDir
+	}
+	id := &Identity{dir: dir}
+
+	certPEM, err := os.ReadFile(filepath.Join(dir, identityCertFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return id, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取节点证书失败: %w", err)
+	}
+	keyPEM, err := os.ReadFile(filepath.Join(dir, identityKeyFile))
+	if err != nil {
+		return nil, fmt.Errorf("读取节点私钥失败: %w", err)
+	}
+	caPEM, err := os.ReadFile(filepath.Join(dir, identityCAFile))
+	if err != nil {
+		return nil, fmt.Errorf("读取集群 CA 失败: %w", err)
+	}
+
+	cert, ca, err := parseIdentity(certPEM, keyPEM, caPEM)
+	if err != nil {
+		return nil, err
+	}
+	id.cert, id.ca = cert, ca
+	return id, nil
+}
+
+// parseIdentity 校验节点证书与私钥匹配且由 CA 签发
+func parseIdentity(certPEM, keyPEM, caPEM []byte) (*tls.Certificate, *x509.Certificate, error) {
+	ca, err := ParseCertificate(caPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析集群 CA 失败: %w", err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析节点证书失败: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("解析节点证书失败: %w", err)
+	}
+	if err := leaf.CheckSignatureFrom(ca); err != nil {
+		return nil, nil, fmt.Errorf("节点证书不是由集群 CA 签发: %w", err)
+	}
+	cert.Leaf = leaf
+	cert.Certificate = append(cert.Certificate, ca.Raw)
+	return &cert, ca, nil
+}
+
+// Ready reports whether the node holds a certificate
+func (i *Identity) Ready() bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.cert != nil
+}
+
+// NodeID returns the node ID the certificate was issued to
+func (i *Identity) NodeID() string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.cert == nil {
+		return ""
+	}
+	return i.cert.Leaf.Subject.CommonName
+}
+
+// ExpiresAt returns when the certificate expires
+func (i *Identity) ExpiresAt() time.Time {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.cert == nil {
+		return time.Time{}
+	}
+	return i.cert.Leaf.NotAfter
+}
+
+// CAFingerprint returns the fingerprint of the cluster CA the node trusts
+func (i *Identity) CAFingerprint() string {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.ca == nil {
+		return ""
+	}
+	return Fingerprint(i.ca)
+}
+
+// NeedsRenewal reports whether less than a third of the certificate's
+// lifetime is left, or the node has no certificate yet
+func (i *Identity) NeedsRenewal(now time.Time) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.cert == nil {
+		return true
+	}
+	return renewalDue(i.cert.Leaf, now)
+}
+
+// Update validates and stores a newly issued certificate
+func (i *Identity) Update(certPEM, keyPEM, caPEM []byte) error {
+	cert, ca, err := parseIdentity(certPEM, keyPEM, caPEM)
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if err := writeFile(filepath.Join(i.dir, identityCAFile), caPEM, 0644); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(i.dir, identityKeyFile), keyPEM, 0600); err != nil {
+		return err
+	}
+	if err := writeFile(filepath.Join(i.dir, identityCertFile), certPEM, 0644); err != nil {
+		return err
+	}
+	i.cert, i.ca = cert, ca
+	return nil
+}
+
+// ClientTLSConfig returns a config for connections to the master: the server
+// must chain to the cluster CA or a system root, and the node presents its
+// certificate when asked
+func (i *Identity) ClientTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:           tls.VersionTLS12,
+		RootCAs:              i.rootPool(),
+		GetClientCertificate: i.getClientCertificate,
+	}
+}
+
+// ServerTLSConfig returns a config for the node's listeners. They serve the
+// node certificate and verify client certificates against the cluster CA when
+// one is presented.
+func (i *Identity) ServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			i.mu.RLock()
+			cert, ca := i.cert, i.ca
+			i.mu.RUnlock()
+			if cert == nil {
+				return nil, errors.New("节点尚未获得证书")
+			}
+			pool := x509.NewCertPool()
+			pool.AddCert(ca)
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientAuth:   tls.VerifyClientCertIfGiven,
+				ClientCAs:    pool,
+			}, nil
+		},
+	}
+}
+
+func (i *Identity) rootPool() *x509.CertPool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return RootPool(i.ca)
+}
+
+// RootPool returns the system roots plus ca, so a master using a certificate
+// from a public CA verifies as well as one issued by the cluster CA
+func RootPool(ca *x509.Certificate) *x509.CertPool {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if ca != nil {
+		pool.AddCert(ca)
+	}
+	return pool
+}
+
+func (i *Identity) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.cert == nil {
+		// 没有证书时不发送，由服务端决定是否拒绝
+		return &tls.Certificate{}, nil
+	}
+	return i.cert, nil
+}
@@ -0,0 +1,50 @@
+package pki
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdentityUpdateAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	identity, err := LoadIdentity(dir)
+	require.NoError(t, err)
+	assert.False(t, identity.Ready())
+	assert.True(t, identity.NeedsRenewal(time.Now()))
+
+	authority := newTestAuthority(t, 0)
+	csrPEM, keyPEM, err := NewCSR("node-a", []string{"127.0.0.1"})
+	require.NoError(t, err)
+	certPEM, err := authority.SignCSR(csrPEM, "node-a", nil)
+	require.NoError(t, err)
+
+	require.NoError(t, identity.Update(certPEM, keyPEM, authority.CertPEM()))
+	assert.True(t, identity.Ready())
+	assert.Equal(t, "node-a", identity.NodeID())
+	assert.Equal(t, authority.Fingerprint(), identity.CAFingerprint())
+	assert.False(t, identity.NeedsRenewal(time.Now()))
+
+	// 重新加载得到保存的证书
+	loaded, err := LoadIdentity(dir)
+	require.NoError(t, err)
+	assert.Equal(t, "node-a", loaded.NodeID())
+	assert.Equal(t, identity.ExpiresAt(), loaded.ExpiresAt())
+}
+
+func TestIdentityUpdateRejectsForeignCertificate(t *testing.T) {
+	identity, err := LoadIdentity(t.TempDir())
+	require.NoError(t, err)
+
+	authority := newTestAuthority(t, 0)
+	other := newTestAuthority(t, 0)
+	csrPEM, keyPEM, err := NewCSR("node-a", nil)
+	require.NoError(t, err)
+	certPEM, err := other.SignCSR(csrPEM, "node-a", nil)
+	require.NoError(t, err)
+
+	assert.Error(t, identity.Update(certPEM, keyPEM, authority.CertPEM()))
+	assert.False(t, identity.Ready())
+}
@@ -0,0 +1,22 @@
+package process
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// draftAcceptanceRe 匹配 llama-server 在请求结束时打印的草稿接受率，例如
+// "draft acceptance rate = 0.57576 (   19 accepted /    33 generated)"
+var draftAcceptanceRe = regexp.MustCompile(`draft acceptance rate = [0-9.]+ \(\s*(\d+) accepted /\s*(\d+) generated\)`)
+
+// ParseDraftAcceptance extracts the speculative decoding stats of one
+// finished request from a llama-server output line
+func ParseDraftAcceptance(line string) (accepted, generated int, ok bool) {
+	matches := draftAcceptanceRe.FindStringSubmatch(line)
+	if matches == nil {
+		return 0, 0, false
+	}
+	accepted, _ = strconv.Atoi(matches[1])
+	generated, _ = strconv.Atoi(matches[2])
+	return accepted, generated, true
+}
@@ -367,6 +367,7 @@ type LoadRequest struct {
 	// Additional sampling parameters
 	LogitsAll       bool    // --logits-all (input vector mode)
 	Reranking       bool    // --reranking (reranking mode)
+	Embedding       bool    // --embedding (embedding-only mode)
 	MinP            float64 // --min-p (Min-P sampling)
 	PresencePenalty float64 // --presence-penalty
 	FrequencyPenalty float64 // --frequency-penalty
@@ -376,6 +377,22 @@ type LoadRequest struct {
 	DisableJinja bool   // --no-jinja (disable Jinja template)
 	ChatTemplate string // --chat-template (built-in chat template)
 	ContextShift bool   // --context-shift (enable context shift)
+
+	// Speculative decoding
+	DraftModelPath string   // Draft model for speculative decoding (-md)
+	DraftMax       int      // Max draft tokens per step (--draft-max)
+	DraftMin       int      // Min draft tokens per step (--draft-min)
+	DraftGPULayers int      // Draft model GPU layers (-ngld)
+	DraftDevices   []string // Draft model devices (-devd)
+
+	// LoRA adapters, in llama-server adapter ID order
+	LoraAdapters []LoraAdapter
+}
+
+// LoraAdapter is a LoRA adapter attached at load time
+type LoraAdapter struct {
+	Path  string  // Adapter GGUF file
+	Scale float64 // 1 uses --lora, other values --lora-scaled
 }
 
 // BuildCommandFromRequest builds the llama-server command line from a LoadRequest struct
@@ -530,6 +547,9 @@ func BuildCommandFromRequest(req *LoadRequest, binPath string) (string, error) {
 	if req.Reranking {
 		args = append(args, "--reranking")
 	}
+	if req.Embedding && !req.Reranking {
+		args = append(args, "--embedding")
+	}
 	if req.MinP > 0 {
 		args = append(args, "--min-p", fmt.Sprintf("%.2f", req.MinP))
 	}
@@ -557,6 +577,32 @@ func BuildCommandFromRequest(req *LoadRequest, binPath string) (string, error) {
 		args = append(args, "--context-shift")
 	}
 
+	// Speculative decoding
+	if req.DraftModelPath != "" {
+		args = append(args, "-md", req.DraftModelPath)
+		if req.DraftMax > 0 {
+			args = append(args, "--draft-max", strconv.Itoa(req.DraftMax))
+		}
+		if req.DraftMin > 0 {
+			args = append(args, "--draft-min", strconv.Itoa(req.DraftMin))
+		}
+		if req.DraftGPULayers > 0 {
+			args = append(args, "-ngld", strconv.Itoa(req.DraftGPULayers))
+		}
+		if len(req.DraftDevices) > 0 {
+			args = append(args, "-devd", strings.Join(req.DraftDevices, ","))
+		}
+	}
+
+	// LoRA adapters
+	for _, adapter := range req.LoraAdapters {
+		if adapter.Scale == 1 {
+			args = append(args, "--lora", adapter.Path)
+		} else {
+			args = append(args, "--lora-scaled", adapter.Path, strconv.FormatFloat(adapter.Scale, 'f', -1, 64))
+		}
+	}
+
 	// Build the base command string
 	cmd := quoteAndJoin(args)
 
@@ -655,6 +655,18 @@ func TestBuildCommandFromRequest(t *testing.T) {
 			},
 			notContains: []string{"--logits-all", "--dio"},
 		},
+		{
+			name:    "Embedding mode",
+			binPath: "/llama.cpp",
+			req: &LoadRequest{
+				ModelPath:  "/models/embed.gguf",
+				Port:       8081,
+				Embedding:  true,
+				UBatchSize: 2048,
+			},
+			contains:    []string{"--embedding", "--ubatch-size 2048"},
+			notContains: []string{"--reranking"},
+		},
 		{
 			name:    "Template and processing flags",
 			binPath: "/llama.cpp",
@@ -672,6 +684,54 @@ func TestBuildCommandFromRequest(t *testing.T) {
 			},
 			notContains: []string{"--dio"},
 		},
+		{
+			name:    "Speculative decoding",
+			binPath: "/llama.cpp",
+			req: &LoadRequest{
+				ModelPath:      "/models/qwen-32b.gguf",
+				Port:           8081,
+				DraftModelPath: "/models/qwen-0.5b.gguf",
+				DraftMax:       16,
+				DraftMin:       4,
+				DraftGPULayers: 99,
+				DraftDevices:   []string{"cuda:1"},
+			},
+			contains: []string{
+				"-md /models/qwen-0.5b.gguf",
+				"--draft-max 16",
+				"--draft-min 4",
+				"-ngld 99",
+				"-devd cuda:1",
+			},
+		},
+		{
+			name:    "LoRA adapters",
+			binPath: "/llama.cpp",
+			req: &LoadRequest{
+				ModelPath: "/models/llama-8b.gguf",
+				Port:      8081,
+				LoraAdapters: []LoraAdapter{
+					{Path: "/adapters/sql.gguf", Scale: 1},
+					{Path: "/adapters/chat.gguf", Scale: 0.5},
+					{Path: "/adapters/code.gguf", Scale: 0},
+				},
+			},
+			contains: []string{
+				"--lora /adapters/sql.gguf",
+				"--lora-scaled /adapters/chat.gguf 0.5",
+				"--lora-scaled /adapters/code.gguf 0",
+			},
+		},
+		{
+			name:    "Draft settings without draft model",
+			binPath: "/llama.cpp",
+			req: &LoadRequest{
+				ModelPath: "/models/model.gguf",
+				Port:      8081,
+				DraftMax:  16,
+			},
+			notContains: []string{"-md", "--draft-max"},
+		},
 		{
 			name:    "All new fields combined",
 			binPath: "/llama.cpp",
@@ -740,4 +800,14 @@ func TestBuildCommandFromRequest(t *testing.T) {
 		_, err := BuildCommandFromRequest(&LoadRequest{ModelPath: "/model.gguf", Port: 0}, "/llama.cpp")
 		assert.Error(t, err)
 	})
-}
\ No newline at end of file
+}
+
+func TestParseDraftAcceptance(t *testing.T) {
+	accepted, generated, ok := ParseDraftAcceptance("draft acceptance rate = 0.57576 (   19 accepted /    33 generated)")
+	require.True(t, ok)
+	assert.Equal(t, 19, accepted)
+	assert.Equal(t, 33, generated)
+
+	_, _, ok = ParseDraftAcceptance("       eval time =     512.03 ms /    33 tokens")
+	assert.False(t, ok)
+}
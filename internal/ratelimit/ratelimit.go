@@ -0,0 +1,370 @@
+// Package ratelimit enforces per API key and per model limits on requests
+// per minute, concurrent requests and tokens per day. Counters are kept in
+// the storage backend so they survive restarts.
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/auth"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/cluster/routing"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
+)
+
+const (
+	// counterTimeout 计数器读写存储的最长时间
+	counterTimeout = 5 * time.Second
+
+	// pruneInterval 过期计数器的清理间隔
+	pruneInterval = time.Hour
+
+	// anonymousKey 未携带密钥的请求共用的限额对象
+	anonymousKey = "anonymous"
+)
+
+// Limit kinds, used as the OpenAI error type and in counter keys
+const (
+	kindRequests   = "requests"
+	kindTokens     = "tokens"
+	kindConcurrent = "concurrent"
+)
+
+// Limiter admits requests within their limits. A nil *Limiter admits
+// everything.
+type Limiter struct {
+	store     storage.Store
+	configMgr *config.Manager
+
+	mu        sync.Mutex
+	active    map[string]int // 进行中的请求数，按限额对象
+	lastPrune time.Time
+}
+
+// NewLimiter creates a limiter keeping its counters in store. configMgr
+// supplies gateway.rate_limits; with a nil configMgr nothing is limited.
+func NewLimiter(store storage.Store, configMgr *config.Manager) *Limiter {
+	return &Limiter{store: store, configMgr: configMgr, active: make(map[string]int)}
+}
+
+func (l *Limiter) settings() config.RateLimitConfig {
+	if l.configMgr == nil {
+		return config.RateLimitConfig{}
+	}
+	return l.configMgr.Get().Gateway.RateLimits
+}
+
+// bucket is one set of limits applied to a request, either its API key or
+// its model
+type bucket struct {
+	name   string // key:<id> 或 model:<name>
+	limits config.RateLimit
+}
+
+// rejection describes the limit a request exceeded
+type rejection struct {
+	kind       string
+	message    string
+	retryAfter time.Duration
+}
+
+// Middleware limits each POST request passing through it. It must run
+// after authentication and before audit and cluster routing, so requests
+// forwarded to other nodes count against the limits of this node.
+func (l *Limiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 已由 master 转发的请求在 master 上计数；只认 routing.TrustMaster 确认过的请求
+		if l == nil || c.Request.Method != http.MethodPost || routing.Routed(c) {
+			c.Next()
+			return
+		}
+		settings := l.settings()
+		if !settings.Enabled {
+			c.Next()
+			return
+		}
+
+		buckets := requestBuckets(c, settings)
+		now := time.Now()
+		l.maybePrune(now)
+
+		if !l.acquire(buckets) {
+			l.reject(c, &rejection{kind: kindConcurrent, message: "too many concurrent requests", retryAfter: time.Second})
+			return
+		}
+		defer l.release(buckets)
+
+		if rejected := l.admit(c, buckets, now); rejected != nil {
+			l.reject(c, rejected)
+			return
+		}
+
+		// handler 记录用量时回填 token 数；转发的请求从响应中读取
+		report, ok := usage.ReportFrom(c.Request.Context())
+		if !ok {
+			report = &usage.Report{}
+			c.Request = c.Request.WithContext(usage.WithReport(c.Request.Context(), report))
+		}
+		writer := &tokenWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		tokens := writer.counter.total()
+		if modelID, u := report.Result(); modelID != "" {
+			tokens = int64(u.TotalTokens)
+		}
+		l.addTokens(buckets, tokens, time.Now())
+	}
+}
+
+// requestBuckets returns the limits applying to a request: those of its API
+// key and, when configured, those of its model
+func requestBuckets(c *gin.Context, settings config.RateLimitConfig) []bucket {
+	keyID := usage.KeyID(c.Request)
+	if keyID == "" {
+		keyID = anonymousKey
+	}
+	keyLimits := settings.KeyDefaults
+	if key, ok := auth.FromContext(c); ok && key.Limits != nil {
+		keyLimits = config.RateLimit{
+			RequestsPerMinute:  key.Limits.RequestsPerMinute,
+			ConcurrentRequests: key.Limits.ConcurrentRequests,
+			TokensPerDay:       key.Limits.TokensPerDay,
+		}
+	}
+	buckets := []bucket{{name: "key:" + keyID, limits: keyLimits}}
+
+	if name := requestModel(c); name != "" {
+		for _, limit := range settings.Models {
+			if strings.EqualFold(limit.Model, name) {
+				buckets = append(buckets, bucket{name: "model:" + limit.Model, limits: limit.RateLimit})
+				break
+			}
+		}
+	}
+	return buckets
+}
+
+// acquire takes a concurrency slot in every bucket, or none if any bucket
+// is full
+func (l *Limiter) acquire(buckets []bucket) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, b := range buckets {
+		if b.limits.ConcurrentRequests > 0 && l.active[b.name] >= b.limits.ConcurrentRequests {
+			return false
+		}
+	}
+	for _, b := range buckets {
+		l.active[b.name]++
+	}
+	return true
+}
+
+func (l *Limiter) release(buckets []bucket) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, b := range buckets {
+		if l.active[b.name]--; l.active[b.name] <= 0 {
+			delete(l.active, b.name)
+		}
+	}
+}
+
+// admit checks the token and request limits and counts the request. It sets
+// the x-ratelimit-* headers of the most restrictive bucket. Storage errors
+// admit the request rather than blocking traffic.
+func (l *Limiter) admit(c *gin.Context, buckets []bucket, now time.Time) *rejection {
+	ctx, cancel := context.WithTimeout(context.Background(), counterTimeout)
+	defer cancel()
+
+	dayEnd := endOfDay(now)
+	tokenHeader := limitHeader{remaining: -1}
+	for _, b := range buckets {
+		if b.limits.TokensPerDay <= 0 {
+			continue
+		}
+		used, err := l.store.GetCounter(ctx, tokenCounterKey(b.name, now))
+		if err != nil {
+			logger.Warn("读取 token 限额计数失败", "bucket", b.name, "error", err)
+			continue
+		}
+		remaining := b.limits.TokensPerDay - used
+		tokenHeader.update(b.limits.TokensPerDay, remaining)
+		if remaining <= 0 {
+			setHeaders(c, kindTokens, tokenHeader, dayEnd.Sub(now))
+			return &rejection{
+				kind:       kindTokens,
+				message:    fmt.Sprintf("daily token limit of %d reached for %s", b.limits.TokensPerDay, b.name),
+				retryAfter: dayEnd.Sub(now),
+			}
+		}
+	}
+
+	minuteEnd := now.Truncate(time.Minute).Add(time.Minute)
+	requestHeader := limitHeader{remaining: -1}
+	var counted []string
+	for _, b := range buckets {
+		if b.limits.RequestsPerMinute <= 0 {
+			continue
+		}
+		key := requestCounterKey(b.name, now)
+		count, err := l.store.AddCounter(ctx, key, 1, minuteEnd)
+		if err != nil {
+			logger.Warn("更新请求限额计数失败", "bucket", b.name, "error", err)
+			continue
+		}
+		counted = append(counted, key)
+		requestHeader.update(int64(b.limits.RequestsPerMinute), int64(b.limits.RequestsPerMinute)-count)
+		if count > int64(b.limits.RequestsPerMinute) {
+			// 被拒绝的请求不计入限额
+			for _, key := range counted {
+				l.store.AddCounter(ctx, key, -1, minuteEnd)
+			}
+			requestHeader.remaining = 0
+			setHeaders(c, kindRequests, requestHeader, minuteEnd.Sub(now))
+			setHeaders(c, kindTokens, tokenHeader, dayEnd.Sub(now))
+			return &rejection{
+				kind:       kindRequests,
+				message:    fmt.Sprintf("rate limit of %d requests per minute reached for %s", b.limits.RequestsPerMinute, b.name),
+				retryAfter: minuteEnd.Sub(now),
+			}
+		}
+	}
+
+	setHeaders(c, kindRequests, requestHeader, minuteEnd.Sub(now))
+	setHeaders(c, kindTokens, tokenHeader, dayEnd.Sub(now))
+	return nil
+}
+
+// addTokens counts the tokens of a finished request in every bucket
+func (l *Limiter) addTokens(buckets []bucket, tokens int64, now time.Time) {
+	if tokens <= 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), counterTimeout)
+	defer cancel()
+
+	for _, b := range buckets {
+		if _, err := l.store.AddCounter(ctx, tokenCounterKey(b.name, now), tokens, endOfDay(now)); err != nil {
+			logger.Warn("更新 token 限额计数失败", "bucket", b.name, "error", err)
+		}
+	}
+}
+
+// maybePrune deletes expired counters at most once per pruneInterval
+func (l *Limiter) maybePrune(now time.Time) {
+	l.mu.Lock()
+	if now.Sub(l.lastPrune) < pruneInterval {
+		l.mu.Unlock()
+		return
+	}
+	l.lastPrune = now
+	l.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), counterTimeout)
+		defer cancel()
+		if _, err := l.store.PruneCounters(ctx, now); err != nil {
+			logger.Warn("清理过期限额计数失败", "error", err)
+		}
+	}()
+}
+
+// reject writes a 429 response in the format of the API being called
+func (l *Limiter) reject(c *gin.Context, r *rejection) {
+	seconds := int(r.retryAfter.Round(time.Second) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	logger.Debugf("请求超出限额: %s, path=%s", r.message, c.Request.URL.Path)
+
+	path := c.Request.URL.Path
+	switch {
+	case strings.HasPrefix(path, "/v1/messages"):
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"type":  "error",
+			"error": gin.H{"type": "rate_limit_error", "message": r.message},
+		})
+	case strings.HasPrefix(path, "/api/"):
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": r.message})
+	default:
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error": gin.H{"message": r.message, "type": r.kind, "param": nil, "code": "rate_limit_exceeded"},
+		})
+	}
+}
+
+// limitHeader tracks the most restrictive limit of one kind
+type limitHeader struct {
+	limit     int64
+	remaining int64 // -1 = 没有限额
+}
+
+func (h *limitHeader) update(limit, remaining int64) {
+	if remaining < 0 {
+		remaining = 0
+	}
+	if h.remaining < 0 || remaining < h.remaining {
+		h.limit = limit
+		h.remaining = remaining
+	}
+}
+
+// setHeaders sets the OpenAI style x-ratelimit-* headers of one kind
+func setHeaders(c *gin.Context, kind string, h limitHeader, reset time.Duration) {
+	if h.remaining < 0 {
+		return
+	}
+	c.Header("x-ratelimit-limit-"+kind, strconv.FormatInt(h.limit, 10))
+	c.Header("x-ratelimit-remaining-"+kind, strconv.FormatInt(h.remaining, 10))
+	c.Header("x-ratelimit-reset-"+kind, reset.Round(time.Second).String())
+}
+
+func requestCounterKey(bucket string, now time.Time) string {
+	return fmt.Sprintf("%s:%s:%d", kindRequests, bucket, now.Unix()/60)
+}
+
+func tokenCounterKey(bucket string, now time.Time) string {
+	return fmt.Sprintf("%s:%s:%s", kindTokens, bucket, now.UTC().Format("20060102"))
+}
+
+// endOfDay returns the next UTC midnight, when daily token limits reset
+func endOfDay(now time.Time) time.Time {
+	return now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
+
+// requestModel reads the model named in a JSON request body and restores
+// the body for the handler
+func requestModel(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var req struct {
+		Model string `json:"model"`
+	}
+	json.Unmarshal(body, &req)
+	return req.Model
+}
@@ -0,0 +1,216 @@
+package ratelimit
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/cluster/routing"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/pki"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLimiter(t *testing.T, settings config.RateLimitConfig) (*Limiter, storage.Store) {
+	t.Helper()
+	store, err := storage.NewMemoryStore()
+	require.NoError(t, err)
+
+	cfg := config.DefaultConfig()
+	cfg.Gateway.RateLimits = settings
+	configMgr := config.NewManagerWithPath("standalone", filepath.Join(t.TempDir(), "server.config.yaml"))
+	require.NoError(t, configMgr.Save(cfg))
+
+	return NewLimiter(store, configMgr), store
+}
+
+func newTestEngine(limiter *Limiter, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(routing.TrustMaster())
+	engine.POST("/v1/chat/completions", limiter.Middleware(), handler)
+	engine.POST("/v1/messages", limiter.Middleware(), handler)
+	engine.POST("/api/chat", limiter.Middleware(), handler)
+	return engine
+}
+
+func send(engine *gin.Engine, path, key, model string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, strings.NewReader(`{"model":"`+model+`"}`))
+	if key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func ok(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func TestRequestsPerMinute(t *testing.T) {
+	limiter, store := newTestLimiter(t, config.RateLimitConfig{
+		Enabled:     true,
+		KeyDefaults: config.RateLimit{RequestsPerMinute: 2},
+	})
+	engine := newTestEngine(limiter, ok)
+
+	w := send(engine, "/v1/chat/completions", "sk-a", "qwen")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("x-ratelimit-limit-requests"))
+	assert.Equal(t, "1", w.Header().Get("x-ratelimit-remaining-requests"))
+	assert.NotEmpty(t, w.Header().Get("x-ratelimit-reset-requests"))
+
+	require.Equal(t, http.StatusOK, send(engine, "/v1/chat/completions", "sk-a", "qwen").Code)
+
+	w = send(engine, "/v1/chat/completions", "sk-a", "qwen")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("x-ratelimit-remaining-requests"))
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+	var resp struct {
+		Error struct {
+			Type string `json:"type"`
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "requests", resp.Error.Type)
+	assert.Equal(t, "rate_limit_exceeded", resp.Error.Code)
+
+	// 其他密钥有独立的限额
+	assert.Equal(t, http.StatusOK, send(engine, "/v1/chat/completions", "sk-b", "qwen").Code)
+
+	// 计数保存在存储中，重启后仍然有效
+	restarted := &Limiter{store: store, configMgr: limiter.configMgr, active: make(map[string]int)}
+	assert.Equal(t, http.StatusTooManyRequests, send(newTestEngine(restarted, ok), "/v1/chat/completions", "sk-a", "qwen").Code)
+}
+
+func TestModelLimit(t *testing.T) {
+	limiter, _ := newTestLimiter(t, config.RateLimitConfig{
+		Enabled: true,
+		Models:  []config.ModelRateLimit{{Model: "qwen", RateLimit: config.RateLimit{RequestsPerMinute: 1}}},
+	})
+	engine := newTestEngine(limiter, ok)
+
+	require.Equal(t, http.StatusOK, send(engine, "/v1/chat/completions", "sk-a", "qwen").Code)
+	// 模型限额由所有密钥共享
+	assert.Equal(t, http.StatusTooManyRequests, send(engine, "/v1/chat/completions", "sk-b", "Qwen").Code)
+	assert.Equal(t, http.StatusOK, send(engine, "/v1/chat/completions", "sk-b", "llama").Code)
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	limiter, _ := newTestLimiter(t, config.RateLimitConfig{
+		Enabled:     true,
+		KeyDefaults: config.RateLimit{ConcurrentRequests: 1},
+	})
+	started := make(chan struct{})
+	finish := make(chan struct{})
+	engine := newTestEngine(limiter, func(c *gin.Context) {
+		close(started)
+		<-finish
+		c.Status(http.StatusOK)
+	})
+
+	done := make(chan int)
+	go func() { done <- send(engine, "/api/chat", "sk-a", "qwen").Code }()
+	<-started
+
+	w := send(engine, "/api/chat", "sk-a", "qwen")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.JSONEq(t, `{"error":"too many concurrent requests"}`, w.Body.String())
+
+	close(finish)
+	assert.Equal(t, http.StatusOK, <-done)
+	assert.Empty(t, limiter.active)
+}
+
+func TestTokensPerDay(t *testing.T) {
+	limiter, store := newTestLimiter(t, config.RateLimitConfig{
+		Enabled:     true,
+		KeyDefaults: config.RateLimit{TokensPerDay: 100},
+	})
+	recorder := usage.NewRecorder(store, nil)
+	engine := newTestEngine(limiter, func(c *gin.Context) {
+		recorder.Record(c.Request, "qwen", "/v1/messages", usage.Usage{PromptTokens: 40, CompletionTokens: 20}, time.Now(), false)
+		c.JSON(http.StatusOK, gin.H{})
+	})
+
+	w := send(engine, "/v1/messages", "sk-a", "qwen")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "100", w.Header().Get("x-ratelimit-remaining-tokens"))
+
+	w = send(engine, "/v1/messages", "sk-a", "qwen")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "40", w.Header().Get("x-ratelimit-remaining-tokens"))
+
+	w = send(engine, "/v1/messages", "sk-a", "qwen")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.JSONEq(t, `{"type":"error","error":{"type":"rate_limit_error","message":"daily token limit of 100 reached for key:`+usage.Fingerprint("sk-a")+`"}}`, w.Body.String())
+}
+
+func TestForwardedTokens(t *testing.T) {
+	limiter, _ := newTestLimiter(t, config.RateLimitConfig{
+		Enabled:     true,
+		KeyDefaults: config.RateLimit{TokensPerDay: 10},
+	})
+	// 转发到其他节点的请求没有本地用量记录，从响应中读取
+	engine := newTestEngine(limiter, func(c *gin.Context) {
+		c.Header("Content-Type", "text/event-stream")
+		c.String(http.StatusOK, "data: {\"choices\":[]}\n\ndata: {\"choices\":[],\"usage\":{\"prompt_tokens\":8,\"completion_tokens\":4,\"total_tokens\":12}}\n\ndata: [DONE]\n\n")
+	})
+
+	require.Equal(t, http.StatusOK, send(engine, "/v1/chat/completions", "sk-a", "qwen").Code)
+	assert.Equal(t, http.StatusTooManyRequests, send(engine, "/v1/chat/completions", "sk-a", "qwen").Code)
+}
+
+func TestSkipped(t *testing.T) {
+	limiter, _ := newTestLimiter(t, config.RateLimitConfig{
+		Enabled:     true,
+		KeyDefaults: config.RateLimit{RequestsPerMinute: 1},
+	})
+	engine := newTestEngine(limiter, ok)
+
+	dir := t.TempDir()
+	authority, err := pki.LoadOrCreateAuthority(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"), 0)
+	require.NoError(t, err)
+	master, err := authority.Issue("master", nil)
+	require.NoError(t, err)
+	routed := func(cert *x509.Certificate) int {
+		req := httptest.NewRequest("POST", "/v1/chat/completions", strings.NewReader(`{"model":"qwen"}`))
+		req.Header.Set(routing.RoutedHeader, "master")
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		w := httptest.NewRecorder()
+		engine.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// master 转发来的请求已在 master 上计数
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, routed(master.Leaf))
+	}
+	// 没有 master 证书时路由标记无效，请求照常限流
+	assert.Equal(t, http.StatusOK, routed(nil))
+	assert.Equal(t, http.StatusTooManyRequests, routed(nil))
+
+	disabled, _ := newTestLimiter(t, config.RateLimitConfig{KeyDefaults: config.RateLimit{RequestsPerMinute: 1}})
+	engine = newTestEngine(disabled, ok)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, send(engine, "/v1/chat/completions", "", "qwen").Code)
+	}
+
+	var nilLimiter *Limiter
+	engine = newTestEngine(nilLimiter, ok)
+	assert.Equal(t, http.StatusOK, send(engine, "/v1/chat/completions", "", "qwen").Code)
+}
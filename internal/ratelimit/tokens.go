@@ -0,0 +1,139 @@
+package ratelimit
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxLineBytes 解析用量时缓存的单行最大字节数，更长的行不解析
+const maxLineBytes = 1 << 20
+
+// tokenWriter counts the tokens reported in a response while writing it.
+// It is used for requests forwarded to other nodes, whose usage is not
+// recorded on this node.
+type tokenWriter struct {
+	gin.ResponseWriter
+	counter tokenCounter
+}
+
+func (w *tokenWriter) Write(data []byte) (int, error) {
+	w.counter.write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *tokenWriter) WriteString(s string) (int, error) {
+	w.counter.write([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+// tokenCounter reads token usage from a JSON response or an SSE / NDJSON
+// stream in the OpenAI, Responses, Anthropic or Ollama format
+type tokenCounter struct {
+	line     []byte
+	overflow bool
+
+	prompt     int64
+	completion int64
+	reported   int64 // 响应中的 total_tokens
+}
+
+// write feeds response bytes to the counter, one line at a time
+func (t *tokenCounter) write(data []byte) {
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			t.buffer(data)
+			return
+		}
+		t.buffer(data[:i])
+		t.flush()
+		data = data[i+1:]
+	}
+}
+
+func (t *tokenCounter) buffer(data []byte) {
+	if t.overflow || len(t.line)+len(data) > maxLineBytes {
+		t.overflow = true
+		return
+	}
+	t.line = append(t.line, data...)
+}
+
+func (t *tokenCounter) flush() {
+	if !t.overflow {
+		t.parse(t.line)
+	}
+	t.line = t.line[:0]
+	t.overflow = false
+}
+
+// total returns the tokens counted in the whole response
+func (t *tokenCounter) total() int64 {
+	t.flush()
+	if sum := t.prompt + t.completion; sum > t.reported {
+		return sum
+	}
+	return t.reported
+}
+
+// tokenUsage covers the usage fields of all supported APIs
+type tokenUsage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+	InputTokens      int64 `json:"input_tokens"`
+	OutputTokens     int64 `json:"output_tokens"`
+}
+
+// parse reads the usage of one line. Streams report usage cumulatively, so
+// the last non-zero value of each field wins.
+func (t *tokenCounter) parse(line []byte) {
+	line = bytes.TrimSpace(line)
+	line = bytes.TrimSpace(bytes.TrimPrefix(line, []byte("data:")))
+	if len(line) == 0 || line[0] != '{' {
+		return
+	}
+
+	var msg struct {
+		Usage           *tokenUsage     `json:"usage"`
+		Message         json.RawMessage `json:"message"`           // Anthropic message_start
+		Response        json.RawMessage `json:"response"`          // Responses API response.completed；Ollama 中为文本
+		PromptEvalCount int64           `json:"prompt_eval_count"` // Ollama
+		EvalCount       int64           `json:"eval_count"`
+	}
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return
+	}
+
+	for _, u := range []*tokenUsage{msg.Usage, nestedUsage(msg.Message), nestedUsage(msg.Response)} {
+		if u == nil {
+			continue
+		}
+		set(&t.prompt, u.PromptTokens)
+		set(&t.prompt, u.InputTokens)
+		set(&t.completion, u.CompletionTokens)
+		set(&t.completion, u.OutputTokens)
+		set(&t.reported, u.TotalTokens)
+	}
+	set(&t.prompt, msg.PromptEvalCount)
+	set(&t.completion, msg.EvalCount)
+}
+
+// nestedUsage returns the usage block of a nested object, if any
+func nestedUsage(raw json.RawMessage) *tokenUsage {
+	var holder struct {
+		Usage *tokenUsage `json:"usage"`
+	}
+	if len(raw) == 0 || raw[0] != '{' || json.Unmarshal(raw, &holder) != nil {
+		return nil
+	}
+	return holder.Usage
+}
+
+func set(field *int64, value int64) {
+	if value > 0 {
+		*field = value
+	}
+}
@@ -0,0 +1,67 @@
+package ratelimit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenCounter(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   int64
+	}{
+		{
+			name:   "OpenAI JSON",
+			chunks: []string{`{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`},
+			want:   15,
+		},
+		{
+			name: "OpenAI stream split across writes",
+			chunks: []string{
+				"data: {\"choices\":[{\"delta\":{\"content\":\"hi\"}}]}\n\nda",
+				"ta: {\"choices\":[],\"usage\":{\"prompt_tokens\":3,\"completion_tokens\":2,\"total_tokens\":5}}\n\ndata: [DONE]\n\n",
+			},
+			want: 5,
+		},
+		{
+			name: "Anthropic stream",
+			chunks: []string{
+				"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":12,\"output_tokens\":1}}}\n\n",
+				"event: message_delta\ndata: {\"type\":\"message_delta\",\"usage\":{\"output_tokens\":30}}\n\n",
+			},
+			want: 42,
+		},
+		{
+			name: "Responses stream",
+			chunks: []string{
+				"event: response.completed\ndata: {\"type\":\"response.completed\",\"response\":{\"usage\":{\"input_tokens\":7,\"output_tokens\":3,\"total_tokens\":10}}}\n\n",
+			},
+			want: 10,
+		},
+		{
+			name: "Ollama NDJSON",
+			chunks: []string{
+				`{"response":"Hel","done":false}` + "\n",
+				`{"response":"","done":true,"prompt_eval_count":20,"eval_count":6}` + "\n",
+			},
+			want: 26,
+		},
+		{
+			name:   "No usage",
+			chunks: []string{`{"error":"model not found"}`},
+			want:   0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var counter tokenCounter
+			for _, chunk := range tt.chunks {
+				counter.write([]byte(chunk))
+			}
+			assert.Equal(t, tt.want, counter.total())
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	api "github.com/shepherd-project/shepherd/Shepherd/internal/api"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/types"
+)
+
+// loraClient 调用 llama-server /lora-adapters 接口的 HTTP 客户端
+var loraClient = &http.Client{Timeout: 10 * time.Second}
+
+// AdapterDTO is a catalogued LoRA adapter with the models it can be attached to
+type AdapterDTO struct {
+	*model.Adapter
+	BaseModels []string `json:"baseModels"`
+}
+
+// AdapterScale is the current scale of an adapter on a running instance
+type AdapterScale struct {
+	ID    string  `json:"id"`
+	Name  string  `json:"name"`
+	Scale float64 `json:"scale"`
+}
+
+// llamaLoraAdapter 是 llama-server /lora-adapters 接口中的一个适配器
+type llamaLoraAdapter struct {
+	ID    int     `json:"id"`
+	Path  string  `json:"path,omitempty"`
+	Scale float64 `json:"scale"`
+}
+
+// handleListAdapters 返回扫描到的 LoRA 适配器及可挂载的基础模型
+func (s *Server) handleListAdapters(c *gin.Context) {
+	adapters := s.modelMgr.ListAdapters()
+	dtos := make([]AdapterDTO, 0, len(adapters))
+	for _, adapter := range adapters {
+		baseModels := s.modelMgr.AdapterBaseModels(adapter.ID)
+		if baseModels == nil {
+			baseModels = []string{}
+		}
+		dtos = append(dtos, AdapterDTO{Adapter: adapter, BaseModels: baseModels})
+	}
+	api.Success(c, gin.H{"adapters": dtos, "total": len(dtos)})
+}
+
+// handleGetModelAdapters 返回模型可挂载的适配器，模型已加载时附带各适配器的当前权重
+func (s *Server) handleGetModelAdapters(c *gin.Context) {
+	id := c.Param("id")
+	if _, exists := s.modelMgr.GetModel(id); !exists {
+		api.NotFound(c, "模型")
+		return
+	}
+
+	compatible := s.modelMgr.CompatibleAdapters(id)
+	if compatible == nil {
+		compatible = []*model.Adapter{}
+	}
+	result := gin.H{"compatible": compatible, "active": []AdapterScale{}}
+
+	instanceID := model.ReplicaInstanceID(id, c.Query("replica"))
+	if adapterIDs, port, ok := s.modelMgr.InstanceAdapters(instanceID); ok && len(adapterIDs) > 0 {
+		current, err := fetchLoraAdapters(c.Request.Context(), port)
+		if err != nil {
+			api.ErrorWithDetails(c, types.ErrInternalError, "读取适配器权重失败", err.Error())
+			return
+		}
+		result["active"] = s.adapterScales(adapterIDs, current)
+	}
+	api.Success(c, result)
+}
+
+// handleSetModelAdapterScales 在运行时调整已加载实例的适配器权重
+// 只修改请求中列出的适配器，其余适配器保持当前权重
+func (s *Server) handleSetModelAdapterScales(c *gin.Context) {
+	var req struct {
+		Adapters []struct {
+			ID    string   `json:"id" binding:"required"`
+			Scale *float64 `json:"scale" binding:"required"`
+		} `json:"adapters" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "无效的请求: "+err.Error())
+		return
+	}
+
+	instanceID := model.ReplicaInstanceID(c.Param("id"), c.Query("replica"))
+	adapterIDs, port, ok := s.modelMgr.InstanceAdapters(instanceID)
+	if !ok {
+		api.Error(c, types.ErrConflict, "模型未加载: "+instanceID)
+		return
+	}
+
+	index := make(map[string]int, len(adapterIDs))
+	for i, adapterID := range adapterIDs {
+		index[adapterID] = i
+	}
+
+	ctx := c.Request.Context()
+	current, err := fetchLoraAdapters(ctx, port)
+	if err != nil {
+		api.ErrorWithDetails(c, types.ErrInternalError, "读取适配器权重失败", err.Error())
+		return
+	}
+
+	// llama-server 会将未列出的适配器权重置 0，因此始终提交完整列表
+	scales := make([]llamaLoraAdapter, len(current))
+	for i, adapter := range current {
+		scales[i] = llamaLoraAdapter{ID: adapter.ID, Scale: adapter.Scale}
+	}
+	for _, adapter := range req.Adapters {
+		i, exists := index[adapter.ID]
+		if !exists || i >= len(scales) {
+			api.BadRequest(c, "适配器未挂载到该实例: "+adapter.ID)
+			return
+		}
+		scales[i].Scale = *adapter.Scale
+	}
+
+	if err := postLoraAdapters(ctx, port, scales); err != nil {
+		api.ErrorWithDetails(c, types.ErrInternalError, "更新适配器权重失败", err.Error())
+		return
+	}
+	logger.Info("LoRA 适配器权重已更新", "modelId", instanceID, "adapters", len(req.Adapters))
+
+	for i := range current {
+		current[i].Scale = scales[i].Scale
+	}
+	api.Success(c, gin.H{"active": s.adapterScales(adapterIDs, current)})
+}
+
+// adapterScales 将 llama-server 的适配器列表按加载顺序映射回适配器 ID
+func (s *Server) adapterScales(adapterIDs []string, current []llamaLoraAdapter) []AdapterScale {
+	scales := make([]AdapterScale, 0, len(current))
+	for _, adapter := range current {
+		if adapter.ID < 0 || adapter.ID >= len(adapterIDs) {
+			continue
+		}
+		scale := AdapterScale{ID: adapterIDs[adapter.ID], Scale: adapter.Scale}
+		if catalogued, exists := s.modelMgr.GetAdapter(scale.ID); exists {
+			scale.Name = catalogued.Name
+		}
+		scales = append(scales, scale)
+	}
+	return scales
+}
+
+// fetchLoraAdapters 读取 llama-server 上的适配器及当前权重
+func fetchLoraAdapters(ctx context.Context, port int) ([]llamaLoraAdapter, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/lora-adapters", port), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := loraClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, fmt.Errorf("llama-server returned %d: %s", resp.StatusCode, body)
+	}
+	var adapters []llamaLoraAdapter
+	if err := json.NewDecoder(resp.Body).Decode(&adapters); err != nil {
+		return nil, fmt.Errorf("invalid /lora-adapters response: %w", err)
+	}
+	return adapters, nil
+}
+
+// postLoraAdapters 设置 llama-server 上所有适配器的权重
+func postLoraAdapters(ctx context.Context, port int, adapters []llamaLoraAdapter) error {
+	body, err := json.Marshal(adapters)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/lora-adapters", port), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := loraClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("llama-server returned %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
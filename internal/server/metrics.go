@@ -0,0 +1,238 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/auth"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/metrics"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/node"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/pki"
+)
+
+// scrapeTimeout 抓取 llama-server 和客户端节点指标的超时
+const scrapeTimeout = 5 * time.Second
+
+// 网关请求计数和耗时，按路由模板区分
+var (
+	httpRequests = metrics.NewCounterVec("shepherd_http_requests_total",
+		"HTTP requests handled by the gateway.", "method", "route", "status")
+	httpDuration = metrics.NewHistogramVec("shepherd_http_request_duration_seconds",
+		"Latency of HTTP requests handled by the gateway, including streamed responses.", nil, "method", "route")
+)
+
+// metricsMiddleware 记录每个请求的状态码和耗时
+func metricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		httpRequests.Inc(method, route, strconv.Itoa(c.Writer.Status()))
+		httpDuration.Observe(time.Since(start).Seconds(), method, route)
+	}
+}
+
+// metricsAuth allows scrapes from cluster nodes presenting a certificate
+// from the cluster CA, and otherwise requires a key with the read scope
+func (s *Server) metricsAuth() gin.HandlerFunc {
+	read := s.auth.Require(auth.ScopeRead)
+	return func(c *gin.Context) {
+		if _, ok := pki.PeerNodeID(c.Request); ok {
+			c.Next()
+			return
+		}
+		read(c)
+	}
+}
+
+// handleMetrics 以 Prometheus 文本格式导出指标
+func (s *Server) handleMetrics(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), scrapeTimeout)
+	defer cancel()
+
+	families := metrics.Merge(
+		metrics.Default.Gather(),
+		s.buildInfo(),
+		s.modelMgr.Collect(),
+		s.collectResources(),
+		s.collectModelServers(ctx),
+	)
+
+	// Master 模式：本节点序列带 node 标签，并合并各客户端节点的指标
+	if s.nodeAdapter != nil {
+		nodeID := s.nodeAdapter.GetNodeID()
+		metrics.AddLabel(families, "node", nodeID)
+		families = metrics.Merge(families, s.collectNodes(ctx, nodeID, s.nodeAdapter.GetNodeInstance()))
+	}
+
+	c.Header("Content-Type", metrics.ContentType)
+	c.Status(http.StatusOK)
+	if err := metrics.Write(c.Writer, families); err != nil {
+		logger.Warnf("写入指标失败: %v", err)
+	}
+}
+
+// buildInfo 导出版本信息
+func (s *Server) buildInfo() []*metrics.Family {
+	info := metrics.NewFamily("shepherd_build_info", "Shepherd version information.", metrics.TypeGauge)
+	info.Add(1, "version", s.config.Version, "commit", s.config.GitCommit)
+	return []*metrics.Family{info}
+}
+
+// collectResources 导出本节点的 CPU、内存和各 GPU 的显存、利用率、温度和功耗
+func (s *Server) collectResources() []*metrics.Family {
+	if s.config.Resources == nil {
+		return nil
+	}
+	res := s.config.Resources()
+	if res == nil {
+		return nil
+	}
+
+	cpuUsed := metrics.NewFamily("shepherd_node_cpu_used_millicores", "CPU in use, in millicores.", metrics.TypeGauge)
+	cpuUsed.Add(float64(res.CPUUsed))
+	cpuTotal := metrics.NewFamily("shepherd_node_cpu_total_millicores", "CPU capacity, in millicores.", metrics.TypeGauge)
+	cpuTotal.Add(float64(res.CPUTotal))
+	memUsed := metrics.NewFamily("shepherd_node_memory_used_bytes", "Memory in use.", metrics.TypeGauge)
+	memUsed.Add(float64(res.MemoryUsed))
+	memTotal := metrics.NewFamily("shepherd_node_memory_total_bytes", "Total memory.", metrics.TypeGauge)
+	memTotal.Add(float64(res.MemoryTotal))
+
+	vramTotal := metrics.NewFamily("shepherd_gpu_memory_total_bytes", "Total GPU memory.", metrics.TypeGauge)
+	vramUsed := metrics.NewFamily("shepherd_gpu_memory_used_bytes", "GPU memory in use.", metrics.TypeGauge)
+	utilization := metrics.NewFamily("shepherd_gpu_utilization_percent", "GPU utilisation (0-100).", metrics.TypeGauge)
+	temperature := metrics.NewFamily("shepherd_gpu_temperature_celsius", "GPU temperature.", metrics.TypeGauge)
+	power := metrics.NewFamily("shepherd_gpu_power_watts", "GPU power draw.", metrics.TypeGauge)
+	for _, g := range res.GPUInfo {
+		labels := []string{"gpu", strconv.Itoa(g.Index), "name", g.Name, "vendor", g.Vendor}
+		vramTotal.Add(float64(g.TotalMemory), labels...)
+		vramUsed.Add(float64(g.UsedMemory), labels...)
+		utilization.Add(g.Utilization, labels...)
+		temperature.Add(g.Temperature, labels...)
+		power.Add(g.PowerUsage, labels...)
+	}
+
+	return []*metrics.Family{cpuUsed, cpuTotal, memUsed, memTotal, vramTotal, vramUsed, utilization, temperature, power}
+}
+
+// collectModelServers re-exports the /metrics of every loaded llama-server
+// started with --metrics, labelled with the model instance ID
+func (s *Server) collectModelServers(ctx context.Context) []*metrics.Family {
+	var statuses []*model.ModelStatus
+	for _, status := range s.modelMgr.ListStatus() {
+		if status.State == model.StateLoaded && status.Metrics && status.Port > 0 {
+			statuses = append(statuses, status)
+		}
+	}
+	if len(statuses) == 0 {
+		return nil
+	}
+
+	up := metrics.NewFamily("shepherd_model_metrics_up", "Whether the llama-server metrics of the model could be scraped.", metrics.TypeGauge)
+	results := make([][]*metrics.Family, len(statuses))
+	var wg sync.WaitGroup
+	for i, status := range statuses {
+		wg.Add(1)
+		go func(i int, status *model.ModelStatus) {
+			defer wg.Done()
+			families, err := scrapeMetrics(ctx, http.DefaultClient, fmt.Sprintf("http://127.0.0.1:%d/metrics", status.Port))
+			if err != nil {
+				logger.Debugf("抓取模型 %s 的 llama-server 指标失败: %v", status.ID, err)
+				return
+			}
+			metrics.AddLabel(families, "model", status.ID)
+			results[i] = families
+		}(i, status)
+	}
+	wg.Wait()
+
+	for i, status := range statuses {
+		value := 0.0
+		if results[i] != nil {
+			value = 1
+		}
+		up.Add(value, "model", status.ID)
+	}
+	return metrics.Merge(append(results, []*metrics.Family{up})...)
+}
+
+// collectNodes scrapes the /metrics endpoint of every registered client node
+// and labels the series with the node ID
+func (s *Server) collectNodes(ctx context.Context, selfID string, n *node.Node) []*metrics.Family {
+	if n == nil {
+		return nil
+	}
+	var clients []*node.NodeInfo
+	for _, client := range n.ListClients() {
+		if client.ID == selfID || client.Status == node.NodeStatusOffline || client.Status == node.NodeStatusDisabled {
+			continue
+		}
+		clients = append(clients, client)
+	}
+	if len(clients) == 0 {
+		return nil
+	}
+
+	scheme := "http"
+	if s.config.Authority != nil {
+		scheme = "https"
+	}
+
+	up := metrics.NewFamily("shepherd_node_up", "Whether the metrics of the client node could be scraped.", metrics.TypeGauge)
+	results := make([][]*metrics.Family, len(clients))
+	var wg sync.WaitGroup
+	for i, client := range clients {
+		wg.Add(1)
+		go func(i int, client *node.NodeInfo) {
+			defer wg.Done()
+			url := fmt.Sprintf("%s://%s:%d/metrics", scheme, client.Address, client.Port)
+			families, err := scrapeMetrics(ctx, s.nodeClient, url)
+			if err != nil {
+				logger.Debugf("抓取节点 %s 的指标失败: %v", client.ID, err)
+				return
+			}
+			metrics.AddLabel(families, "node", client.ID)
+			results[i] = families
+		}(i, client)
+	}
+	wg.Wait()
+
+	up.Add(1, "node", selfID)
+	for i, client := range clients {
+		value := 0.0
+		if results[i] != nil {
+			value = 1
+		}
+		up.Add(value, "node", client.ID)
+	}
+	return metrics.Merge(append(results, []*metrics.Family{up})...)
+}
+
+// scrapeMetrics 获取并解析文本格式的指标
+func scrapeMetrics(ctx context.Context, client *http.Client, url string) ([]*metrics.Family, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return metrics.Parse(resp.Body)
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/gpu"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/metrics"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/node"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerMetrics(t *testing.T) {
+	server := createTestServer(t)
+	server.config.Resources = func() *node.NodeResources {
+		return &node.NodeResources{
+			MemoryTotal: 64 << 30,
+			GPUInfo: []gpu.Info{
+				{Index: 0, Name: "RTX 4090", Vendor: "NVIDIA", TotalMemory: 24 << 30, UsedMemory: 8 << 30, Temperature: 61, Utilization: 87, PowerUsage: 320},
+			},
+		}
+	}
+	router := server.GetEngine()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/models", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, metrics.ContentType, w.Header().Get("Content-Type"))
+
+	body := w.Body.String()
+	assert.Contains(t, body, "# TYPE shepherd_http_requests_total counter")
+	assert.Contains(t, body, `shepherd_http_requests_total{method="GET",route="/v1/models",status="200"}`)
+	assert.Contains(t, body, `shepherd_http_request_duration_seconds_bucket{method="GET",route="/v1/models",le="+Inf"}`)
+	assert.Contains(t, body, `shepherd_gpu_utilization_percent{gpu="0",name="RTX 4090",vendor="NVIDIA"} 87`)
+	assert.Contains(t, body, `shepherd_gpu_memory_used_bytes{gpu="0",name="RTX 4090",vendor="NVIDIA"} 8.589934592e+09`)
+	assert.Contains(t, body, "shepherd_build_info{")
+
+	// 输出可被重新解析
+	_, err := metrics.Parse(w.Body)
+	assert.NoError(t, err)
+}
+
+func TestScrapeMetrics(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "# TYPE llamacpp:requests_processing gauge\nllamacpp:requests_processing 3\n")
+	}))
+	defer upstream.Close()
+
+	families, err := scrapeMetrics(context.Background(), http.DefaultClient, upstream.URL+"/metrics")
+	require.NoError(t, err)
+	require.Len(t, families, 1)
+	assert.Equal(t, 3.0, families[0].Samples[0].Value)
+
+	_, err = scrapeMetrics(context.Background(), http.DefaultClient, upstream.URL+"/missing")
+	assert.Error(t, err)
+}
@@ -4,12 +4,15 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -18,41 +21,63 @@ import (
 	"github.com/gin-gonic/gin"
 	api "github.com/shepherd-project/shepherd/Shepherd/internal/api"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/api/anthropic"
+	apikeysapi "github.com/shepherd-project/shepherd/Shepherd/internal/api/apikeys"
+	auditapi "github.com/shepherd-project/shepherd/Shepherd/internal/api/audit"
 	benchmarkapi "github.com/shepherd-project/shepherd/Shepherd/internal/api/benchmark"
+	certsapi "github.com/shepherd-project/shepherd/Shepherd/internal/api/certs"
 	compatibilityapi "github.com/shepherd-project/shepherd/Shepherd/internal/api/compatibility"
 	filesystemapi "github.com/shepherd-project/shepherd/Shepherd/internal/api/filesystem"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/api/lmstudio"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/api/ollama"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/api/openai"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/api/paths"
 	storageapi "github.com/shepherd-project/shepherd/Shepherd/internal/api/storage"
+	usageapi "github.com/shepherd-project/shepherd/Shepherd/internal/api/usage"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/audit"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/auth"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/capture"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/cluster/routing"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/filter"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
 	modelrepoclient "github.com/shepherd-project/shepherd/Shepherd/internal/modelrepo"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/node"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/pki"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/port"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/ratelimit"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/types"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/usage"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/websocket"
 )
 
 // ModelDTO represents a model for API responses
 type ModelDTO struct {
-	ID          string                 `json:"id"`
-	Name        string                 `json:"name"`
-	DisplayName string                 `json:"displayName"`
-	Alias       string                 `json:"alias"`
-	Path        string                 `json:"path"`
-	PathPrefix  string                 `json:"pathPrefix"`
-	Size        int64                  `json:"size"`
-	TotalSize   int64                  `json:"totalSize,omitempty"`  // 包含所有分卷的总大小
-	ShardCount  int                    `json:"shardCount,omitempty"` // 分卷数量
-	ShardFiles  []string               `json:"shardFiles,omitempty"` // 所有分卷文件路径
-	MmprojPath  string                 `json:"mmprojPath,omitempty"` // mmproj 文件路径
-	Favourite   bool                   `json:"favourite"`
-	Metadata    map[string]interface{} `json:"metadata"`
-	Status      string                 `json:"status"`
-	IsLoaded    bool                   `json:"isLoaded"`
-	ScannedAt   string                 `json:"scannedAt,omitempty"` // 扫描时间（ISO 8601 格式）
+	ID            string                 `json:"id"`
+	Name          string                 `json:"name"`
+	DisplayName   string                 `json:"displayName"`
+	Alias         string                 `json:"alias"`
+	Path          string                 `json:"path"`
+	PathPrefix    string                 `json:"pathPrefix"`
+	Size          int64                  `json:"size"`
+	TotalSize     int64                  `json:"totalSize,omitempty"`  // 包含所有分卷的总大小
+	ShardCount    int                    `json:"shardCount,omitempty"` // 分卷数量
+	ShardFiles    []string               `json:"shardFiles,omitempty"` // 所有分卷文件路径
+	MmprojPath    string                 `json:"mmprojPath,omitempty"` // mmproj 文件路径
+	Favourite     bool                   `json:"favourite"`
+	Metadata      map[string]interface{} `json:"metadata"`
+	Status        string                 `json:"status"`
+	IsLoaded      bool                   `json:"isLoaded"`
+	ScannedAt     string                 `json:"scannedAt,omitempty"` // 扫描时间（ISO 8601 格式）
+	Pinned        bool                   `json:"pinned"`
+	IdleTTL       int                    `json:"idleTtl,omitempty"`       // 单模型空闲超时（秒），0 = 全局设置，-1 = 从不卸载
+	IdleRemaining *int64                 `json:"idleRemaining,omitempty"` // 剩余空闲时间（秒），未启用空闲卸载时省略
+	LastRequestAt string                 `json:"lastRequestAt,omitempty"` // 最近请求时间（ISO 8601 格式）
+	Queue         *model.QueueStats      `json:"queue,omitempty"`         // 请求排队状态，未收到过请求时省略
+	Replicas      []model.ReplicaInfo    `json:"replicas,omitempty"`      // 运行中的副本，仅有一个实例时省略
+	Draft         *model.DraftStats      `json:"draft,omitempty"`         // 推测解码统计，未使用草稿模型时省略
 }
 
 // nonEmptyString 返回非空字符串，如果是空字符串则返回 nil
@@ -75,6 +100,13 @@ type Server struct {
 	storageMgr  *storage.Manager
 	downloadMgr *DownloadManager        // 下载管理器
 	nodeAdapter *api.NodeAdapter        // Node API 适配器
+	routeProxy  *routing.Proxy          // 集群请求转发（master/hybrid 模式）
+	nodeClient  *http.Client            // 抓取客户端节点指标（master/hybrid 模式）
+	usageRec    *usage.Recorder         // token 用量记录
+	auditRec    *audit.Recorder         // 请求审计日志
+	auth        *auth.Authenticator     // API 密钥认证
+	limiter     *ratelimit.Limiter      // 按密钥和模型限流
+	tlsConfig   *tls.Config             // 监听端口的 TLS 配置，未开启 HTTPS 时为 nil
 	repoClient  *modelrepoclient.Client // 模型仓库客户端
 
 	// 新增字段：WebSocket Hub 和端口管理器
@@ -99,6 +131,19 @@ type ModelCapabilities struct {
 	Embedding bool `json:"embedding"` // 嵌入向量生成
 }
 
+// applyCapabilities 根据模型能力设置 llama-server 的运行模式
+func applyCapabilities(req *model.LoadRequest, caps *ModelCapabilities) {
+	if caps == nil {
+		return
+	}
+	if caps.Rerank {
+		req.Reranking = true
+	}
+	if caps.Embedding {
+		req.Embedding = true
+	}
+}
+
 // Config contains server configuration
 type Config struct {
 	WebPort       int
@@ -117,6 +162,11 @@ type Config struct {
 	Version   string // 版本号
 	BuildTime string // 构建时间
 	GitCommit string // Git commit hash
+	// 集群 mTLS
+	Authority *pki.Authority // 集群 CA（master/hybrid 开启 node.master_role.ssl 时）
+	Identity  *pki.Identity  // 节点证书（client/hybrid 开启 node.client_role.ssl 时）
+	// Resources 返回本节点资源，/metrics 据此导出 CPU、内存和 GPU 指标
+	Resources func() *node.NodeResources
 }
 
 // Handlers contains handler instances
@@ -124,11 +174,15 @@ type Handlers struct {
 	OpenAI        *openai.Handler
 	Ollama        *ollama.Handler
 	Anthropic     *anthropic.Handler
+	LMStudio      *lmstudio.Handler
 	Paths         *paths.Handler
 	Storage       *storageapi.Handler
 	Compatibility *compatibilityapi.Handler
 	Filesystem    *filesystemapi.Handler
 	Benchmark     *benchmarkapi.Handler
+	Usage         *usageapi.Handler
+	Audit         *auditapi.Handler
+	APIKeys       *apikeysapi.Handler
 }
 
 // NewServer creates a new HTTP server
@@ -172,19 +226,72 @@ func NewServer(config *Config, modelMgr *model.Manager) (*Server, error) {
 	}
 	s.repoClient = modelrepoclient.NewClientWithConfig(cfg.ModelRepo.Endpoint, cfg.ModelRepo.Token, timeout)
 
-	// Create compatibility server manager
-	compatServerManager := compatibilityapi.NewServerManager(modelMgr)
-
 	// Create API handlers
 	s.handlers.OpenAI = openai.NewHandler(modelMgr)
 	s.handlers.Ollama = ollama.NewHandler(modelMgr)
+	s.handlers.Ollama.SetModelRepo(s.repoClient)
 	s.handlers.Anthropic = anthropic.NewHandler(modelMgr)
+	s.handlers.LMStudio = lmstudio.NewHandler(modelMgr, s.handlers.OpenAI)
+
+	// server.tls 开启时所有监听端口使用 HTTPS
+	s.tlsConfig, err = s.listenerTLS()
+	if err != nil {
+		storageMgr.Close()
+		cancel()
+		return nil, err
+	}
+
+	// Create compatibility server manager
+	compatServerManager := compatibilityapi.NewServerManager(modelMgr, s.handlers.Ollama, s.handlers.OpenAI, s.handlers.LMStudio)
+	compatServerManager.SetTLSConfig(s.tlsConfig)
+
 	s.handlers.Paths = paths.NewHandler(config.ConfigMgr)
 	s.handlers.Storage = storageapi.NewHandler(config.ConfigMgr, storageMgr)
 	s.handlers.Compatibility = compatibilityapi.NewHandler(config.ConfigMgr, compatServerManager)
 	s.handlers.Filesystem = filesystemapi.NewHandler()
 	// 压测 handler 使用存储层管理数据
 	s.handlers.Benchmark = benchmarkapi.NewHandler(logger.GetLogger(), storageMgr.GetStore())
+	s.handlers.Usage = usageapi.NewHandler(storageMgr.GetStore())
+
+	// 代理请求的 token 用量写入存储
+	s.usageRec = usage.NewRecorder(storageMgr.GetStore(), modelMgr)
+	s.handlers.OpenAI.SetUsageRecorder(s.usageRec)
+	s.handlers.Ollama.SetUsageRecorder(s.usageRec)
+	s.handlers.Anthropic.SetUsageRecorder(s.usageRec)
+	s.handlers.LMStudio.SetUsageRecorder(s.usageRec)
+
+	// 带会话 ID 请求头或全局开启时，对话写入会话存储
+	captureRec := capture.NewRecorder(storageMgr.GetStore(), config.ConfigMgr, modelMgr)
+	s.handlers.OpenAI.SetCaptureRecorder(captureRec)
+	s.handlers.Ollama.SetCaptureRecorder(captureRec)
+	s.handlers.Anthropic.SetCaptureRecorder(captureRec)
+
+	// 按虚拟模型和 API 密钥启用 gateway.filters 中的内容过滤器
+	filters := filter.NewRegistry(config.ConfigMgr, modelMgr)
+	s.handlers.OpenAI.SetFilters(filters)
+	s.handlers.Ollama.SetFilters(filters)
+	s.handlers.Anthropic.SetFilters(filters)
+	s.handlers.LMStudio.SetFilters(filters)
+
+	// Responses API 的响应保存到存储，供 previous_response_id 续接对话
+	s.handlers.OpenAI.SetResponseStore(storageMgr.GetStore())
+
+	// 推理请求和响应写入审计日志
+	s.auditRec = audit.NewRecorder(storageMgr.GetStore(), config.ConfigMgr)
+
+	// security.api_key_enabled 开启后按密钥权限范围保护推理和管理接口
+	s.auth = auth.NewAuthenticator(storageMgr.GetStore(), config.ConfigMgr)
+	s.handlers.APIKeys = apikeysapi.NewHandler(storageMgr.GetStore())
+
+	// 按密钥和模型限制请求数、并发数和每日 token 数，计数保存在存储中
+	s.limiter = ratelimit.NewLimiter(storageMgr.GetStore(), config.ConfigMgr)
+
+	// 兼容端口的推理和模型管理接口与主服务器使用相同的认证、限流和审计
+	compatServerManager.SetAccessControl(s.auth, s.limiter, s.auditRec)
+	compatServerManager.SetClusterRouting(s.clusterRouting())
+
+	// 按需加载时使用前端保存的模型加载配置
+	modelMgr.SetLoadConfigProvider(s.savedLoadRequest)
 
 	// Setup Gin engine
 	if config.WebUIPath == "" {
@@ -194,6 +301,8 @@ func NewServer(config *Config, modelMgr *model.Manager) (*Server, error) {
 	}
 
 	s.engine = gin.New()
+	// 重放的审计请求经过同一引擎处理
+	s.handlers.Audit = auditapi.NewHandler(storageMgr.GetStore(), s.engine)
 	s.setupMiddleware()
 	s.setupRoutes()
 
@@ -203,24 +312,30 @@ func NewServer(config *Config, modelMgr *model.Manager) (*Server, error) {
 // setupMiddleware configures server middleware
 func (s *Server) setupMiddleware() {
 	s.engine.Use(
-		api.RequestID(), // 请求 ID 追踪
+		api.RequestID(),     // 请求 ID 追踪
+		tracingMiddleware(), // 链路追踪
 		api.RecoveryMiddleware(logger.GetLogger()), // 统一恢复中间件
 		api.CORSMiddleware([]string{"*"}),          // 统一 CORS
 		api.LoggerMiddleware(logger.GetLogger()),   // 统一日志
 		api.ErrorHandler(logger.GetLogger()),       // 统一错误处理
+		metricsMiddleware(),                        // 请求计数和耗时
+		routing.TrustMaster(),                      // 只信任 Master 转发的请求的路由标记
 	)
 }
 
 // setupRoutes configures all routes
 func (s *Server) setupRoutes() {
 	// WebSocket endpoint (for SSE)
-	s.engine.GET("/api/events", s.handleEvents)
+	s.engine.GET("/api/events", s.auth.Management(), s.handleEvents)
+
+	// Prometheus 指标
+	s.engine.GET("/metrics", s.metricsAuth(), s.handleMetrics)
 
 	// WebSocket endpoint (新增)
-	s.engine.GET("/ws", s.handleWebSocket)
+	s.engine.GET("/ws", s.auth.Management(), s.handleWebSocket)
 
-	// API routes
-	api := s.engine.Group("/api")
+	// API routes (管理接口：读取需要 read，修改需要 admin)
+	api := s.engine.Group("/api", s.auth.Management())
 	{
 		// Server info
 		api.GET("/info", s.handleServerInfo)
@@ -279,16 +394,43 @@ func (s *Server) setupRoutes() {
 			conversations.DELETE("/:id", s.handlers.Storage.DeleteConversation)
 		}
 
+		// Token usage reports
+		api.GET("/usage", s.handlers.Usage.GetUsage)
+
+		// API key management (全部需要 admin)
+		keys := api.Group("/keys", s.auth.Require(auth.ScopeAdmin))
+		{
+			keys.GET("", s.handlers.APIKeys.ListKeys)
+			keys.POST("", s.handlers.APIKeys.CreateKey)
+			keys.GET("/:id", s.handlers.APIKeys.GetKey)
+			keys.PUT("/:id", s.handlers.APIKeys.UpdateKey)
+			keys.DELETE("/:id", s.handlers.APIKeys.DeleteKey)
+		}
+
+		// Request audit log
+		audits := api.Group("/audit")
+		{
+			audits.GET("", s.handlers.Audit.ListRecords)
+			audits.GET("/:id", s.handlers.Audit.GetRecord)
+			audits.POST("/:id/replay", s.handlers.Audit.ReplayRecord)
+		}
+
 		// Model routes
 		models := api.Group("/models")
 		{
 			models.GET("", s.handleListModels)
 			models.GET("/loaded", s.handleListLoadedModels)
+			models.GET("/queues", s.handleListModelQueues)
 
 			// 模型能力管理（必须在 :id 路由之前）
 			models.GET("/capabilities/get", s.handleGetModelCapabilities)
 			models.POST("/capabilities/set", s.handleSetModelCapabilities)
 
+			// 虚拟模型管理（必须在 :id 路由之前）
+			models.GET("/virtual", s.handleListVirtualModels)
+			models.PUT("/virtual/:name", s.handleSaveVirtualModel)
+			models.DELETE("/virtual/:name", s.handleDeleteVirtualModel)
+
 			// 显存估算（必须在 :id 路由之前）
 			models.POST("/vram/estimate", s.handleEstimateVRAM)
 
@@ -310,15 +452,30 @@ func (s *Server) setupRoutes() {
 			models.GET("/:id", s.handleGetModel)
 			models.POST("/:id/load", s.handleLoadModel)
 			models.POST("/:id/unload", s.handleUnloadModel)
+			models.GET("/:id/replicas", s.handleListModelReplicas)
 			models.PUT("/:id/alias", s.handleSetAlias)
 			models.PUT("/:id/favourite", s.handleSetFavourite)
+			models.PUT("/:id/pinned", s.handleSetPinned)
+			models.PUT("/:id/idle-ttl", s.handleSetIdleTTL)
 
 			// 模型加载配置管理
 			models.GET("/:id/load-config", s.handleGetModelLoadConfig)
 			models.PUT("/:id/load-config", s.handleSaveModelLoadConfig)
 			models.DELETE("/:id/load-config", s.handleDeleteModelLoadConfig)
+
+			// LoRA 适配器挂载与运行时权重
+			models.GET("/:id/adapters", s.handleGetModelAdapters)
+			models.PUT("/:id/adapters", s.handleSetModelAdapterScales)
+
+			// 槽位 KV 缓存保存与恢复
+			models.GET("/:id/slots", s.handleListModelSlots)
+			models.POST("/:id/slots/:slot", s.handleSlotAction)
+			models.DELETE("/:id/saved-slots/:filename", s.handleDeleteSavedSlot)
 		}
 
+		// LoRA adapter catalog
+		api.GET("/adapters", s.handleListAdapters)
+
 		// Model scan routes
 		modelScan := api.Group("/model/scan")
 		{
@@ -386,24 +543,53 @@ func (s *Server) setupRoutes() {
 	}
 
 	// OpenAI compatible API
-	openai := s.engine.Group("/v1")
+	openai := s.engine.Group("/v1", s.auth.Require(auth.ScopeInference), s.limiter.Middleware(), s.auditRec.Middleware(), s.clusterRouting())
 	{
 		openai.POST("/chat/completions", s.handleOpenAIChat)
 		openai.POST("/completions", s.handleOpenAIComplete)
+		openai.POST("/responses", s.handleOpenAIResponses)
+		openai.GET("/responses/:id", s.handleOpenAIGetResponse)
+		openai.DELETE("/responses/:id", s.handleOpenAIDeleteResponse)
+		openai.POST("/embeddings", s.handleOpenAIEmbeddings)
+		openai.POST("/rerank", s.handleOpenAIRerank)
 		openai.GET("/models", s.handleOpenAIModels)
 	}
 
 	// Anthropic compatible API
-	anthropic := s.engine.Group("/v1")
+	anthropic := s.engine.Group("/v1", s.auth.Require(auth.ScopeInference), s.limiter.Middleware(), s.auditRec.Middleware(), s.clusterRouting())
 	{
 		anthropic.POST("/messages", s.handleAnthropicMessages)
+		anthropic.POST("/messages/count_tokens", s.handleAnthropicCountTokens)
+	}
+
+	// 分词与 token 计数：推理密钥可用，模型需在密钥的允许列表中
+	tokenize := s.engine.Group("/api/models", s.auth.Require(auth.ScopeInference))
+	{
+		tokenize.POST("/:id/tokenize", s.handleTokenize)
+		tokenize.POST("/:id/detokenize", s.handleDetokenize)
+		tokenize.POST("/:id/count_tokens", s.handleCountTokens)
 	}
 
 	// Ollama compatible API
-	ollama := s.engine.Group("/api")
+	ollama := s.engine.Group("/api", s.auth.Require(auth.ScopeInference), s.limiter.Middleware(), s.auditRec.Middleware(), s.clusterRouting())
 	{
+		ollama.POST("/generate", s.handleOllamaGenerate)
 		ollama.POST("/chat", s.handleOllamaChat)
-		ollama.POST("/tags", s.handleOllamaTags)
+		ollama.POST("/embed", s.handleOllamaEmbed)
+	}
+	// 模型管理接口作用于本节点，不经过集群路由
+	ollamaModels := s.engine.Group("/api", s.auth.Require(auth.ScopeInference))
+	{
+		ollamaModels.GET("/tags", s.handleOllamaTags)
+		ollamaModels.GET("/ps", s.handleOllamaPs)
+		ollamaModels.GET("/version", s.handleOllamaVersion)
+		ollamaModels.POST("/show", s.handleOllamaShow)
+	}
+	// 下载和删除模型文件需要 admin
+	ollamaAdmin := s.engine.Group("/api", s.auth.Require(auth.ScopeAdmin))
+	{
+		ollamaAdmin.POST("/pull", s.handleOllamaPull)
+		ollamaAdmin.DELETE("/delete", s.handleOllamaDelete)
 	}
 
 	// Static files for Web UI
@@ -435,15 +621,24 @@ func (s *Server) Start() error {
 		Handler:      s.engine,
 		ReadTimeout:  s.config.ReadTimeout,
 		WriteTimeout: s.config.WriteTimeout,
+		TLSConfig:    s.tlsConfig,
 	}
 
+	// 按保留天数清理过期审计记录
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.auditRec.Run(s.ctx)
+	}()
+
 	// Start server in background
+	srv := s.httpServer
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
 
-		logger.Infof("启动 HTTP 服务器，监听 %s", addr)
-		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Infof("启动 HTTP 服务器，监听 %s (TLS: %v)", addr, s.tlsConfig != nil)
+		if err := listen(srv); err != nil && err != http.ErrServerClosed {
 			logger.Errorf("HTTP 服务器错误: %v", err)
 		}
 		logger.Info("HTTP 服务器已停止")
@@ -575,9 +770,108 @@ func (s *Server) RegisterNodeAdapter(nodeAdapter *api.NodeAdapter) {
 	})
 
 	// 注册 Node API 路由
-	api := s.engine.Group("/api")
+	api := s.engine.Group("/api", s.nodeAuth())
 	nodeAdapter.RegisterRoutes(api)
 	logger.Info("Node API 适配器路由已注册")
+
+	// 集群 mTLS：节点凭加入令牌申请证书，到期前凭现有证书续期
+	if s.config.Authority != nil {
+		certs := certsapi.NewHandler(s.config.Authority, s.config.ServerCfg.Node.MasterRole.SSL.JoinToken, s.nodeIDTaken)
+		cluster := s.engine.Group("/api/cluster")
+		cluster.GET("/ca", certs.GetCA)
+		cluster.POST("/join", certs.Join)
+		cluster.POST("/renew", certs.Renew)
+		logger.Infof("集群 mTLS 已开启，CA 指纹: %s", s.config.Authority.Fingerprint())
+	}
+
+	// 本地未加载的模型按路由表转发到客户端节点
+	s.mu.Lock()
+	s.routeProxy = routing.NewProxy(nodeAdapter.GetRoutes(), nodeAdapter.GetNodeID(), s.servesLocally)
+	s.usageRec.SetNodeID(nodeAdapter.GetNodeID())
+	s.auditRec.SetNodeID(nodeAdapter.GetNodeID())
+	if s.config.ServerCfg != nil {
+		s.routeProxy.SetBalancing(s.config.ServerCfg.Gateway.Balancing)
+	}
+	s.nodeClient = http.DefaultClient
+	if s.config.Authority != nil {
+		// 转发请求和抓取指标时出示 Master 的证书
+		tlsConfig := s.config.Authority.ClientTLSConfig(nodeAdapter.GetNodeID())
+		s.routeProxy.SetTLS(tlsConfig)
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		s.nodeClient = &http.Client{Transport: transport}
+	}
+	s.mu.Unlock()
+}
+
+// nodeIDTaken 判断加入集群的节点能否使用该 ID：Master 自身和监听证书的名称保留，
+// 在线的已注册节点的 ID 已被使用；离线节点（如证书已过期）可以凭加入令牌重新加入
+func (s *Server) nodeIDTaken(nodeID string) bool {
+	if strings.EqualFold(nodeID, listenerCommonName) || strings.EqualFold(nodeID, s.nodeAdapter.GetNodeID()) {
+		return true
+	}
+	n := s.nodeAdapter.GetNodeInstance()
+	if n == nil {
+		return false
+	}
+	client, err := n.GetClient(nodeID)
+	return err == nil && client.Status != node.NodeStatusOffline
+}
+
+// clusterRouting 推理接口中间件，master/hybrid 模式下将请求转发到加载了模型的客户端节点
+func (s *Server) clusterRouting() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		s.mu.RLock()
+		proxy := s.routeProxy
+		s.mu.RUnlock()
+
+		if proxy == nil {
+			c.Next()
+			return
+		}
+		proxy.Handle(c)
+	}
+}
+
+// nodeProtocolRoutes 客户端节点调用的接口。节点不持有 API 密钥，不做密钥认证；
+// 开启集群 mTLS 后改为校验节点证书
+var nodeProtocolRoutes = map[string]bool{
+	"POST /api/nodes/register":             true,
+	"POST /api/nodes/:id/heartbeat":        true,
+	"GET /api/nodes/:id/commands":          true,
+	"POST /api/heartbeat":                  true,
+	"POST /api/command/result":             true,
+	"POST /api/master/nodes/register":      true,
+	"POST /api/master/nodes/:id/heartbeat": true,
+	"GET /api/master/nodes/:id/commands":   true,
+	"POST /api/master/clients/register":    true,
+	"POST /api/master/heartbeat":           true,
+	"POST /api/master/command/result":      true,
+}
+
+// nodeAuth Node API 中间件，节点协议接口放行，其余按管理接口认证
+func (s *Server) nodeAuth() gin.HandlerFunc {
+	management := s.auth.Management()
+	return func(c *gin.Context) {
+		if nodeProtocolRoutes[c.Request.Method+" "+c.FullPath()] {
+			if s.config.Authority != nil && !requireNodeCert(c) {
+				return
+			}
+			c.Next()
+			return
+		}
+		management(c)
+	}
+}
+
+// servesLocally 判断模型是否已在本节点加载。Ollama 客户端的模型名带 :latest 标签，
+// 与 Ollama 接口一样去掉后再解析
+func (s *Server) servesLocally(name string) bool {
+	m, ok := s.modelMgr.ResolveModel(strings.TrimSuffix(name, ":latest"))
+	if !ok {
+		return false
+	}
+	return s.modelMgr.HasLoadedReplica(m.ID)
 }
 
 // Middleware
@@ -907,9 +1201,11 @@ func (s *Server) handleGetLlamacppBackends(c *gin.Context) {
 }
 
 // handleEstimateVRAM 估算模型显存需求
+// 指定草稿模型时分别估算目标模型和草稿模型，结果为两者之和
 func (s *Server) handleEstimateVRAM(c *gin.Context) {
 	var req struct {
 		ModelID        string `json:"modelId"`
+		DraftModelID   string `json:"draftModelId"`
 		LlamaBinPath   string `json:"llamaBinPath"`
 		CtxSize        int    `json:"ctxSize"`
 		BatchSize      int    `json:"batchSize"`
@@ -953,44 +1249,116 @@ func (s *Server) handleEstimateVRAM(c *gin.Context) {
 		modelPath = model.Path
 	}
 
-	// 构建 llama-fit-params 命令
-	args := []string{
-		"--model", modelPath,
+	// 草稿模型需与目标模型词表兼容
+	var draftPath string
+	if req.DraftModelID != "" {
+		if err := s.modelMgr.CheckDraftModel(req.ModelID, req.DraftModelID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "草稿模型不可用: " + err.Error()})
+			return
+		}
+		draft, _ := s.modelMgr.GetModel(req.DraftModelID)
+		draftPath = draft.Path
+		if draft.ShardCount > 0 && len(draft.ShardFiles) > 0 {
+			draftPath = draft.ShardFiles[0]
+		}
 	}
 
-	// 添加支持的参数
-	if req.CtxSize > 0 {
-		args = append(args, "--ctx-size", fmt.Sprintf("%d", req.CtxSize))
-	}
-	if req.BatchSize > 0 {
-		args = append(args, "--batch-size", fmt.Sprintf("%d", req.BatchSize))
-	}
-	if req.UBatchSize > 0 {
-		args = append(args, "--ubatch-size", fmt.Sprintf("%d", req.UBatchSize))
+	// 构建 llama-fit-params 命令
+	fitArgs := func(path string) []string {
+		args := []string{
+			"--model", path,
+		}
+
+		// 添加支持的参数
+		if req.CtxSize > 0 {
+			args = append(args, "--ctx-size", fmt.Sprintf("%d", req.CtxSize))
+		}
+		if req.BatchSize > 0 {
+			args = append(args, "--batch-size", fmt.Sprintf("%d", req.BatchSize))
+		}
+		if req.UBatchSize > 0 {
+			args = append(args, "--ubatch-size", fmt.Sprintf("%d", req.UBatchSize))
+		}
+		if req.Parallel > 0 {
+			args = append(args, "--parallel", fmt.Sprintf("%d", req.Parallel))
+		}
+		if req.FlashAttention {
+			args = append(args, "--flash-attn", "1")
+		}
+		if req.KVUnified {
+			args = append(args, "--kv-unified", "1")
+		}
+		if req.CacheTypeK != "" {
+			args = append(args, "--cache-type-k", req.CacheTypeK)
+		}
+		if req.CacheTypeV != "" {
+			args = append(args, "--cache-type-v", req.CacheTypeV)
+		}
+		return args
 	}
-	if req.Parallel > 0 {
-		args = append(args, "--parallel", fmt.Sprintf("%d", req.Parallel))
+
+	cmdPath := filepath.Join(req.LlamaBinPath, "llama-fit-params")
+	vramMB, outputStr, ok := s.runFitParams(c, cmdPath, fitArgs(modelPath))
+	if !ok {
+		return
 	}
-	if req.FlashAttention {
-		args = append(args, "--flash-attn", "1")
+
+	draftVramMB := 0
+	if draftPath != "" && vramMB > 0 {
+		// 草稿模型使用相同的上下文和并发设置，单独估算后累加
+		draftVramMB, outputStr, ok = s.runFitParams(c, cmdPath, fitArgs(draftPath))
+		if !ok {
+			return
+		}
+		if draftVramMB == 0 {
+			vramMB = 0
+		}
 	}
-	if req.KVUnified {
-		args = append(args, "--kv-unified", "1")
+	totalMB := vramMB + draftVramMB
+
+	// 构建响应
+	result := gin.H{
+		"success": vramMB > 0,
 	}
-	if req.CacheTypeK != "" {
-		args = append(args, "--cache-type-k", req.CacheTypeK)
+
+	if vramMB > 0 {
+		result["vram"] = fmt.Sprintf("%d", totalMB)
+		result["vramMB"] = totalMB
+		result["vramGB"] = fmt.Sprintf("%.2f", float64(totalMB)/1024)
+		if draftPath != "" {
+			result["modelVramMB"] = vramMB
+			result["draftVramMB"] = draftVramMB
+		}
+	} else {
+		// 如果没有找到显存值，检查是否有错误信息
+		errorRe := regexp.MustCompile(`llama_init_from_model.*`)
+		if errorMatch := errorRe.FindString(outputStr); errorMatch != "" {
+			result["error"] = strings.TrimSpace(errorMatch)
+		} else {
+			result["error"] = "无法解析显存估算结果"
+		}
+		result["details"] = outputStr
 	}
-	if req.CacheTypeV != "" {
-		args = append(args, "--cache-type-v", req.CacheTypeV)
+
+	if vramMB > 0 {
+		api.Success(c, result)
+	} else {
+		errorMsg := "无法解析显存估算结果"
+		if errStr, ok := result["error"].(string); ok {
+			errorMsg = errStr
+		}
+		api.ErrorWithDetails(c, types.ErrInternalError, "无法解析显存估算结果", errorMsg)
 	}
+}
 
-	// 构建完整命令
-	cmdPath := filepath.Join(req.LlamaBinPath, "llama-fit-params")
+// runFitParams 执行 llama-fit-params 并解析显存估算值（MiB，未找到时为 0）
+// 执行失败时写入错误响应并返回 ok=false
+func (s *Server) runFitParams(c *gin.Context, cmdPath string, args []string) (vramMB int, outputStr string, ok bool) {
 	cmd := exec.Command(cmdPath, args...)
 
 	// 执行命令（设置30秒超时）
 	output, err := cmd.CombinedOutput()
-	outputStr := string(output)
+	outputStr = string(output)
 
 	if err != nil {
 		// 检查是否有部分输出
@@ -1009,47 +1377,15 @@ func (s *Server) handleEstimateVRAM(c *gin.Context) {
 			"error":   errorMsg,
 			"details": outputStr,
 		})
-		return
+		return 0, outputStr, false
 	}
 
-	// 解析输出，提取显存估算值
-	vramMB := 0
-
 	// 匹配格式: "llama_params_fit_impl: projected to use XXX MiB of device memory"
 	vramRe := regexp.MustCompile(`llama_params_fit_impl: projected to use (\d+) MiB`)
 	if matches := vramRe.FindStringSubmatch(outputStr); len(matches) > 1 {
 		vramMB, _ = strconv.Atoi(matches[1])
 	}
-
-	// 构建响应
-	result := gin.H{
-		"success": vramMB > 0,
-	}
-
-	if vramMB > 0 {
-		result["vram"] = fmt.Sprintf("%d", vramMB)
-		result["vramMB"] = vramMB
-		result["vramGB"] = fmt.Sprintf("%.2f", float64(vramMB)/1024)
-	} else {
-		// 如果没有找到显存值，检查是否有错误信息
-		errorRe := regexp.MustCompile(`llama_init_from_model.*`)
-		if errorMatch := errorRe.FindString(outputStr); errorMatch != "" {
-			result["error"] = strings.TrimSpace(errorMatch)
-		} else {
-			result["error"] = "无法解析显存估算结果"
-		}
-		result["details"] = outputStr
-	}
-
-	if vramMB > 0 {
-		api.Success(c, result)
-	} else {
-		errorMsg := "无法解析显存估算结果"
-		if errStr, ok := result["error"].(string); ok {
-			errorMsg = errStr
-		}
-		api.ErrorWithDetails(c, types.ErrInternalError, "无法解析显存估算结果", errorMsg)
-	}
+	return vramMB, outputStr, true
 }
 
 // handleGetConfig 返回当前配置（不包含敏感信息）
@@ -1221,6 +1557,11 @@ func (s *Server) handleListLoadedModels(c *gin.Context) {
 	models := s.modelMgr.ListModels()
 	statuses := s.modelMgr.ListStatus()
 
+	idleInfos := make(map[string]model.IdleInfo)
+	for _, info := range s.modelMgr.ListIdleInfo() {
+		idleInfos[info.ModelID] = info
+	}
+
 	var loadedModels []ModelDTO
 	for _, m := range models {
 		// 只返回已加载的模型
@@ -1236,6 +1577,32 @@ func (s *Server) handleListLoadedModels(c *gin.Context) {
 				Favourite:   m.Favourite,
 				Status:      "loaded",
 				IsLoaded:    true,
+				Pinned:      m.Pinned,
+				IdleTTL:     m.IdleTTL,
+			}
+
+			// 添加空闲卸载信息
+			if info, ok := idleInfos[m.ID]; ok && info.IdleRemaining >= 0 {
+				remaining := info.IdleRemaining
+				dto.IdleRemaining = &remaining
+			}
+			if !status.LastRequestAt.IsZero() {
+				dto.LastRequestAt = status.LastRequestAt.Format(time.RFC3339)
+			}
+
+			// 添加排队信息
+			if queue, ok := s.modelMgr.QueueStats(m.ID); ok {
+				dto.Queue = &queue
+			}
+
+			// 添加副本信息
+			if replicas := s.modelMgr.ListReplicas(m.ID); len(replicas) > 1 {
+				dto.Replicas = replicas
+			}
+
+			// 添加推测解码统计
+			if draft, ok := s.modelMgr.DraftStats(m.ID); ok {
+				dto.Draft = &draft
 			}
 
 			// 添加分卷信息
@@ -1325,6 +1692,9 @@ func (s *Server) handleLoadModel(c *gin.Context) {
 		s.capabilities[req.LoadRequest.ModelID] = req.Capabilities
 		s.capabilitiesMu.Unlock()
 
+		// 向量/重排序能力需要以对应模式启动 llama-server
+		applyCapabilities(&req.LoadRequest, req.Capabilities)
+
 		logger.Info("模型能力已更新", "modelId", req.LoadRequest.ModelID,
 			"thinking", req.Capabilities.Thinking,
 			"tools", req.Capabilities.Tools,
@@ -1351,6 +1721,9 @@ func (s *Server) handleLoadModel(c *gin.Context) {
 			"threads":   req.Threads,
 			"gpuLayers": req.GPULayers,
 		}
+		if traceParent := tracing.TraceParent(c.Request.Context()); traceParent != "" {
+			payload[node.PayloadTraceParent] = traceParent
+		}
 
 		// 提交任务到指定节点
 		task, err := scheduler.SubmitTask("load_model", payload, req.NodeID)
@@ -1373,6 +1746,20 @@ func (s *Server) handleLoadModel(c *gin.Context) {
 		return
 	}
 
+	// 草稿模型需为已扫描且词表兼容的模型
+	if err := s.modelMgr.CheckDraftModel(req.ModelID, req.DraftModelID); err != nil {
+		api.ErrorWithDetails(c, types.ErrInvalidRequest, "草稿模型不可用", err.Error())
+		return
+	}
+	// LoRA 适配器需为已扫描且与模型架构一致的适配器
+	if err := s.modelMgr.CheckAdapters(req.ModelID, req.Adapters); err != nil {
+		api.ErrorWithDetails(c, types.ErrInvalidRequest, "LoRA 适配器不可用", err.Error())
+		return
+	}
+
+	// 加载各阶段的 span 归入本请求的 trace
+	req.TraceParent = tracing.TraceParent(c.Request.Context())
+
 	if asyncMode {
 		// 异步加载
 		result, err = s.modelMgr.LoadAsync(&req.LoadRequest)
@@ -1425,8 +1812,11 @@ func (s *Server) handleLoadModel(c *gin.Context) {
 }
 
 func (s *Server) handleUnloadModel(c *gin.Context) {
-	id := c.Param("id")
-	if err := s.modelMgr.Unload(id); err != nil {
+	// 指定 replica 查询参数时只卸载该副本
+	id := model.ReplicaInstanceID(c.Param("id"), c.Query("replica"))
+	// saveSlots=true 时先保存所有使用过的槽位，下次加载指定 restoreSlots 即可恢复
+	opts := model.UnloadOptions{SaveSlots: c.Query("saveSlots") == "true"}
+	if err := s.modelMgr.UnloadWithOptions(id, opts); err != nil {
 		api.ErrorWithDetails(c, types.ErrInternalError, "卸载模型失败", err.Error())
 		return
 	}
@@ -1471,6 +1861,142 @@ func (s *Server) handleSetFavourite(c *gin.Context) {
 	api.SuccessWithMessage(c, "收藏设置成功")
 }
 
+func (s *Server) handleSetPinned(c *gin.Context) {
+	id := c.Param("id")
+
+	var req struct {
+		Pinned bool `json:"pinned"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "无效的请求")
+		return
+	}
+
+	if err := s.modelMgr.SetPinned(id, req.Pinned); err != nil {
+		api.ErrorWithDetails(c, types.ErrInternalError, "设置固定失败", err.Error())
+		return
+	}
+
+	api.SuccessWithMessage(c, "固定设置成功")
+}
+
+func (s *Server) handleSetIdleTTL(c *gin.Context) {
+	id := c.Param("id")
+
+	var req struct {
+		IdleTTL int `json:"idleTtl"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "无效的请求")
+		return
+	}
+	if req.IdleTTL < -1 {
+		api.BadRequest(c, "idleTtl 必须大于等于 -1")
+		return
+	}
+
+	if err := s.modelMgr.SetIdleTTL(id, req.IdleTTL); err != nil {
+		api.ErrorWithDetails(c, types.ErrInternalError, "设置空闲超时失败", err.Error())
+		return
+	}
+
+	api.SuccessWithMessage(c, "空闲超时设置成功")
+}
+
+// handleListVirtualModels 返回所有虚拟模型定义
+func (s *Server) handleListVirtualModels(c *gin.Context) {
+	virtualModels := s.modelMgr.ListVirtualModels()
+	if virtualModels == nil {
+		virtualModels = []config.VirtualModelConfig{}
+	}
+	api.Success(c, gin.H{"models": virtualModels, "total": len(virtualModels)})
+}
+
+// handleSaveVirtualModel 创建或替换虚拟模型定义并写入配置文件
+func (s *Server) handleSaveVirtualModel(c *gin.Context) {
+	var req config.VirtualModelConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "无效的请求")
+		return
+	}
+	req.Name = c.Param("name")
+	if _, exists := s.modelMgr.ResolveModel(req.Name); exists {
+		api.BadRequest(c, fmt.Sprintf("虚拟模型名 %s 与已有模型重名", req.Name))
+		return
+	}
+
+	cfg := s.config.ConfigMgr.Get()
+	// 复制列表，避免修改配置管理器中的当前配置
+	virtualModels := make([]config.VirtualModelConfig, 0, len(cfg.Gateway.VirtualModels)+1)
+	replaced := false
+	for _, vm := range cfg.Gateway.VirtualModels {
+		if strings.EqualFold(vm.Name, req.Name) {
+			vm, replaced = req, true
+		}
+		virtualModels = append(virtualModels, vm)
+	}
+	if !replaced {
+		virtualModels = append(virtualModels, req)
+	}
+	cfg.Gateway.VirtualModels = virtualModels
+
+	if err := cfg.Validate(); err != nil {
+		api.BadRequest(c, err.Error())
+		return
+	}
+	if err := s.config.ConfigMgr.Save(cfg); err != nil {
+		api.ErrorWithDetails(c, types.ErrInternalError, "保存配置失败", err.Error())
+		return
+	}
+
+	api.Success(c, req)
+}
+
+// handleDeleteVirtualModel 删除虚拟模型定义并写入配置文件
+func (s *Server) handleDeleteVirtualModel(c *gin.Context) {
+	name := c.Param("name")
+
+	cfg := s.config.ConfigMgr.Get()
+	virtualModels := make([]config.VirtualModelConfig, 0, len(cfg.Gateway.VirtualModels))
+	for _, vm := range cfg.Gateway.VirtualModels {
+		if !strings.EqualFold(vm.Name, name) {
+			virtualModels = append(virtualModels, vm)
+		}
+	}
+	if len(virtualModels) == len(cfg.Gateway.VirtualModels) {
+		api.NotFound(c, "虚拟模型")
+		return
+	}
+	cfg.Gateway.VirtualModels = virtualModels
+
+	if err := s.config.ConfigMgr.Save(cfg); err != nil {
+		api.ErrorWithDetails(c, types.ErrInternalError, "保存配置失败", err.Error())
+		return
+	}
+
+	api.SuccessWithMessage(c, "虚拟模型已删除")
+}
+
+// handleListModelReplicas 返回模型的所有运行实例
+func (s *Server) handleListModelReplicas(c *gin.Context) {
+	id := c.Param("id")
+	if _, exists := s.modelMgr.GetModel(id); !exists {
+		api.NotFound(c, "模型")
+		return
+	}
+	api.Success(c, s.modelMgr.ListReplicas(id))
+}
+
+// handleListModelQueues 返回各模型的请求排队状态
+func (s *Server) handleListModelQueues(c *gin.Context) {
+	queues := s.modelMgr.ListQueueStats()
+	sort.Slice(queues, func(i, j int) bool {
+		return queues[i].ModelID < queues[j].ModelID
+	})
+
+	api.Success(c, gin.H{"queues": queues, "total": len(queues)})
+}
+
 // handleGetModelCapabilities 获取模型能力配置
 func (s *Server) handleGetModelCapabilities(c *gin.Context) {
 	modelID := c.Query("modelId")
@@ -1556,12 +2082,14 @@ func (s *Server) handleScanModels(c *gin.Context) {
 		return
 	}
 	api.Success(c, gin.H{
-		"message":      "扫描完成",
-		"models_found": len(result.Models),
-		"errors":       len(result.Errors),
-		"duration_ms":  result.Duration.Milliseconds(),
-		"models":       result.Models,
-		"scan_errors":  result.Errors,
+		"message":        "扫描完成",
+		"models_found":   len(result.Models),
+		"adapters_found": len(result.Adapters),
+		"errors":         len(result.Errors),
+		"duration_ms":    result.Duration.Milliseconds(),
+		"models":         result.Models,
+		"adapters":       result.Adapters,
+		"scan_errors":    result.Errors,
 	})
 }
 
@@ -1817,6 +2345,7 @@ func (s *Server) handleUpdateModelRepoConfig(c *gin.Context) {
 		timeout = 30 * time.Second
 	}
 	s.repoClient = modelrepoclient.NewClientWithConfig(cfg.ModelRepo.Endpoint, cfg.ModelRepo.Token, timeout)
+	s.handlers.Ollama.SetModelRepo(s.repoClient)
 
 	api.Success(c, gin.H{
 		"endpoint": cfg.ModelRepo.Endpoint,
@@ -2217,6 +2746,46 @@ func (s *Server) handleGetModelLoadConfig(c *gin.Context) {
 	})
 }
 
+// savedLoadRequest 读取模型保存的加载配置并转换为加载请求，供按需加载使用
+// 未保存配置时返回 nil，由模型管理器使用默认参数
+func (s *Server) savedLoadRequest(modelID string) (*model.LoadRequest, error) {
+	nodeID := "local"
+	if s.nodeAdapter != nil {
+		nodeID = s.nodeAdapter.GetNodeID()
+	}
+
+	loadConfig, err := s.storageMgr.GetStore().GetModelLoadConfig(context.Background(), nodeID, modelID)
+	if err != nil {
+		if err == storage.ErrModelLoadConfigNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	data, err := json.Marshal(loadConfig.Config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid saved load config: %w", err)
+	}
+	var saved struct {
+		model.LoadRequest
+		Capabilities *ModelCapabilities `json:"capabilities"`
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("invalid saved load config: %w", err)
+	}
+	req := &saved.LoadRequest
+	if saved.Capabilities != nil {
+		s.capabilitiesMu.Lock()
+		s.capabilities[modelID] = saved.Capabilities
+		s.capabilitiesMu.Unlock()
+		applyCapabilities(req, saved.Capabilities)
+	}
+	req.ModelID = modelID
+	// 按需加载始终在本节点执行
+	req.NodeID = ""
+	return req, nil
+}
+
 // handleSaveModelLoadConfig 保存模型加载配置
 func (s *Server) handleSaveModelLoadConfig(c *gin.Context) {
 	modelID := c.Param("id")
@@ -2325,6 +2894,26 @@ func (s *Server) handleOpenAIComplete(c *gin.Context) {
 	s.handlers.OpenAI.HandleCompletions(c)
 }
 
+func (s *Server) handleOpenAIResponses(c *gin.Context) {
+	s.handlers.OpenAI.HandleResponses(c)
+}
+
+func (s *Server) handleOpenAIGetResponse(c *gin.Context) {
+	s.handlers.OpenAI.HandleGetResponse(c)
+}
+
+func (s *Server) handleOpenAIDeleteResponse(c *gin.Context) {
+	s.handlers.OpenAI.HandleDeleteResponse(c)
+}
+
+func (s *Server) handleOpenAIEmbeddings(c *gin.Context) {
+	s.handlers.OpenAI.HandleEmbeddings(c)
+}
+
+func (s *Server) handleOpenAIRerank(c *gin.Context) {
+	s.handlers.OpenAI.HandleRerank(c)
+}
+
 func (s *Server) handleOpenAIModels(c *gin.Context) {
 	s.handlers.OpenAI.HandleModels(c)
 }
@@ -2333,10 +2922,42 @@ func (s *Server) handleAnthropicMessages(c *gin.Context) {
 	s.handlers.Anthropic.HandleMessages(c)
 }
 
+func (s *Server) handleAnthropicCountTokens(c *gin.Context) {
+	s.handlers.Anthropic.HandleCountTokens(c)
+}
+
+func (s *Server) handleOllamaGenerate(c *gin.Context) {
+	s.handlers.Ollama.HandleGenerate(c)
+}
+
 func (s *Server) handleOllamaChat(c *gin.Context) {
 	s.handlers.Ollama.HandleChat(c)
 }
 
+func (s *Server) handleOllamaEmbed(c *gin.Context) {
+	s.handlers.Ollama.HandleEmbed(c)
+}
+
 func (s *Server) handleOllamaTags(c *gin.Context) {
 	s.handlers.Ollama.HandleTags(c)
 }
+
+func (s *Server) handleOllamaPs(c *gin.Context) {
+	s.handlers.Ollama.HandlePs(c)
+}
+
+func (s *Server) handleOllamaVersion(c *gin.Context) {
+	s.handlers.Ollama.HandleVersion(c)
+}
+
+func (s *Server) handleOllamaShow(c *gin.Context) {
+	s.handlers.Ollama.HandleShow(c)
+}
+
+func (s *Server) handleOllamaPull(c *gin.Context) {
+	s.handlers.Ollama.HandlePull(c)
+}
+
+func (s *Server) handleOllamaDelete(c *gin.Context) {
+	s.handlers.Ollama.HandleDelete(c)
+}
@@ -5,10 +5,13 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/shepherd-project/shepherd/Shepherd/internal/auth"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
 	"github.com/shepherd-project/shepherd/Shepherd/internal/process"
@@ -118,6 +121,16 @@ func TestServerRoutes(t *testing.T) {
 		{"Unload model", "POST", "/api/models/test-id/unload", http.StatusInternalServerError}, // 模型不存在时卸载失败
 		{"Set alias", "PUT", "/api/models/test-id/alias", http.StatusBadRequest},               // 缺少请求体
 		{"Set favourite", "PUT", "/api/models/test-id/favourite", http.StatusBadRequest},       // 缺少请求体
+		{"Model adapters", "GET", "/api/models/test-id/adapters", http.StatusNotFound},         // 模型不存在
+		{"Set adapter scales", "PUT", "/api/models/test-id/adapters", http.StatusBadRequest},   // 缺少请求体
+		{"List adapters", "GET", "/api/adapters", http.StatusOK},
+		{"Model slots", "GET", "/api/models/test-id/slots", http.StatusConflict},                      // 模型未加载
+		{"Slot action", "POST", "/api/models/test-id/slots/0?action=erase", http.StatusConflict},      // 模型未加载
+		{"Invalid slot", "POST", "/api/models/test-id/slots/x?action=erase", http.StatusBadRequest},   // 槽位 ID 无效
+		{"Delete saved slot", "DELETE", "/api/models/test-id/saved-slots/a.bin", http.StatusNotFound}, // 存档不存在
+		{"Tokenize", "POST", "/api/models/test-id/tokenize", http.StatusNotFound},                     // 模型不存在
+		{"Detokenize", "POST", "/api/models/test-id/detokenize", http.StatusNotFound},                 // 模型不存在
+		{"Count tokens", "POST", "/api/models/test-id/count_tokens", http.StatusNotFound},             // 模型不存在
 
 		// Scan routes
 		{"Scan models", "POST", "/api/model/scan", http.StatusOK},
@@ -146,9 +159,16 @@ func TestServerRoutes(t *testing.T) {
 
 		// OpenAI API
 		{"OpenAI models", "GET", "/v1/models", http.StatusOK},
+		{"OpenAI response", "GET", "/v1/responses/resp_missing", http.StatusNotFound},
+		{"Delete OpenAI response", "DELETE", "/v1/responses/resp_missing", http.StatusNotFound},
+
+		// Anthropic API
+		{"Anthropic count tokens", "POST", "/v1/messages/count_tokens", http.StatusBadRequest}, // 缺少请求体
 
 		// Ollama API
-		{"Ollama tags", "POST", "/api/tags", http.StatusOK},
+		{"Ollama tags", "GET", "/api/tags", http.StatusOK},
+		{"Ollama ps", "GET", "/api/ps", http.StatusOK},
+		{"Ollama version", "GET", "/api/version", http.StatusOK},
 	}
 
 	for _, tt := range tests {
@@ -180,6 +200,62 @@ func TestServerRoutes(t *testing.T) {
 	}
 }
 
+func TestServerAPIKeyAuth(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Security.APIKeyEnabled = true
+	configMgr := config.NewManagerWithPath("standalone", filepath.Join(t.TempDir(), "server.config.yaml"))
+	require.NoError(t, configMgr.Save(cfg))
+
+	server, err := NewServer(&Config{ServerCfg: cfg, ConfigMgr: configMgr}, model.NewManager(cfg, configMgr, process.NewManager()))
+	require.NoError(t, err)
+	router := server.GetEngine()
+
+	keys := map[string]string{}
+	for _, scope := range []string{auth.ScopeInference, auth.ScopeRead, auth.ScopeAdmin} {
+		secret, key, err := auth.GenerateKey()
+		require.NoError(t, err)
+		key.Scopes = []string{scope}
+		require.NoError(t, server.storageMgr.GetStore().CreateAPIKey(context.Background(), key))
+		keys[scope] = secret
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		path         string
+		scope        string
+		expectedCode int
+	}{
+		{"No key", "GET", "/api/models", "", http.StatusUnauthorized},
+		{"No key inference", "GET", "/v1/models", "", http.StatusUnauthorized},
+		{"No key events", "GET", "/api/events", "", http.StatusUnauthorized},
+		{"Inference key", "GET", "/v1/models", auth.ScopeInference, http.StatusOK},
+		{"Inference key ollama", "GET", "/api/tags", auth.ScopeInference, http.StatusOK},
+		{"Inference key management", "GET", "/api/models", auth.ScopeInference, http.StatusForbidden},
+		{"Read key", "GET", "/api/models", auth.ScopeRead, http.StatusOK},
+		{"Read key change", "POST", "/api/model/scan", auth.ScopeRead, http.StatusForbidden},
+		{"Read key lists keys", "GET", "/api/keys", auth.ScopeRead, http.StatusForbidden},
+		{"Read key ollama pull", "POST", "/api/pull", auth.ScopeRead, http.StatusForbidden},
+		{"Admin key lists keys", "GET", "/api/keys", auth.ScopeAdmin, http.StatusOK},
+		{"Admin key inference", "GET", "/v1/models", auth.ScopeAdmin, http.StatusOK},
+		{"No key metrics", "GET", "/metrics", "", http.StatusUnauthorized},
+		{"Inference key metrics", "GET", "/metrics", auth.ScopeInference, http.StatusForbidden},
+		{"Read key metrics", "GET", "/metrics", auth.ScopeRead, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.scope != "" {
+				req.Header.Set("Authorization", "Bearer "+keys[tt.scope])
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedCode, w.Code, w.Body.String())
+		})
+	}
+}
+
 func TestServerSSEEndpoint(t *testing.T) {
 	server := createTestServer(t)
 	router := server.GetEngine()
@@ -295,3 +371,35 @@ func BenchmarkServerRequest(b *testing.B) {
 		router.ServeHTTP(w, req)
 	}
 }
+
+func TestLoraAdapterClient(t *testing.T) {
+	var posted []llamaLoraAdapter
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/lora-adapters", r.URL.Path)
+		if r.Method == http.MethodPost {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&posted))
+			w.Write([]byte(`{"success":true}`))
+			return
+		}
+		w.Write([]byte(`[{"id":0,"path":"/adapters/sql.gguf","scale":1.0},{"id":1,"path":"/adapters/chat.gguf","scale":0.0}]`))
+	}))
+	defer upstream.Close()
+	port, err := strconv.Atoi(upstream.URL[strings.LastIndex(upstream.URL, ":")+1:])
+	require.NoError(t, err)
+
+	current, err := fetchLoraAdapters(context.Background(), port)
+	require.NoError(t, err)
+	assert.Equal(t, []llamaLoraAdapter{
+		{ID: 0, Path: "/adapters/sql.gguf", Scale: 1},
+		{ID: 1, Path: "/adapters/chat.gguf", Scale: 0},
+	}, current)
+
+	require.NoError(t, postLoraAdapters(context.Background(), port, []llamaLoraAdapter{{ID: 0, Scale: 0.25}, {ID: 1, Scale: 1}}))
+	assert.Equal(t, []llamaLoraAdapter{{ID: 0, Scale: 0.25}, {ID: 1, Scale: 1}}, posted)
+
+	server := createTestServer(t)
+	assert.Equal(t, []AdapterScale{
+		{ID: "sql", Scale: 1},
+		{ID: "chat", Scale: 0},
+	}, server.adapterScales([]string{"sql", "chat"}, current))
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	api "github.com/shepherd-project/shepherd/Shepherd/internal/api"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/types"
+)
+
+// handleListModelSlots 返回已加载实例的槽位及该实例保存的槽位存档
+func (s *Server) handleListModelSlots(c *gin.Context) {
+	instanceID := model.ReplicaInstanceID(c.Param("id"), c.Query("replica"))
+	status, exists := s.modelMgr.GetStatus(instanceID)
+	if !exists {
+		api.Error(c, types.ErrConflict, "模型未加载: "+instanceID)
+		return
+	}
+
+	// 未加载时仍可查看之前保存的槽位存档
+	slots := []model.Slot{}
+	if status.State == model.StateLoaded {
+		current, err := s.modelMgr.ListSlots(c.Request.Context(), instanceID)
+		if err != nil {
+			slotError(c, err)
+			return
+		}
+		slots = current
+	}
+	saved, err := s.modelMgr.SavedSlots(instanceID)
+	if err != nil {
+		slotError(c, err)
+		return
+	}
+	api.Success(c, gin.H{"slots": slots, "saved": saved})
+}
+
+// handleSlotAction 对槽位执行 llama-server 的 save / restore / erase 操作
+func (s *Server) handleSlotAction(c *gin.Context) {
+	instanceID := model.ReplicaInstanceID(c.Param("id"), c.Query("replica"))
+	slot, err := strconv.Atoi(c.Param("slot"))
+	if err != nil || slot < 0 {
+		api.BadRequest(c, "无效的槽位 ID: "+c.Param("slot"))
+		return
+	}
+
+	var req struct {
+		Filename string `json:"filename"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			api.BadRequest(c, "无效的请求: "+err.Error())
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
+	switch action := c.Query("action"); action {
+	case "save":
+		saved, err := s.modelMgr.SaveSlot(ctx, instanceID, slot, req.Filename)
+		if err != nil {
+			slotError(c, err)
+			return
+		}
+		api.Success(c, saved)
+	case "restore":
+		if req.Filename == "" {
+			api.BadRequest(c, "缺少 filename")
+			return
+		}
+		tokens, err := s.modelMgr.RestoreSlot(ctx, instanceID, slot, req.Filename)
+		if err != nil {
+			slotError(c, err)
+			return
+		}
+		api.Success(c, gin.H{"slot": slot, "filename": req.Filename, "tokens": tokens})
+	case "erase":
+		tokens, err := s.modelMgr.EraseSlot(ctx, instanceID, slot)
+		if err != nil {
+			slotError(c, err)
+			return
+		}
+		api.Success(c, gin.H{"slot": slot, "tokens": tokens})
+	default:
+		api.BadRequest(c, "无效的 action，应为 save、restore 或 erase: "+action)
+	}
+}
+
+// handleDeleteSavedSlot 删除实例保存的槽位存档文件
+func (s *Server) handleDeleteSavedSlot(c *gin.Context) {
+	instanceID := model.ReplicaInstanceID(c.Param("id"), c.Query("replica"))
+	if err := s.modelMgr.DeleteSavedSlot(instanceID, c.Param("filename")); err != nil {
+		slotError(c, err)
+		return
+	}
+	api.SuccessWithMessage(c, "槽位存档已删除")
+}
+
+// slotError 将槽位操作错误映射为 API 错误
+func slotError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, model.ErrModelNotLoaded), errors.Is(err, model.ErrSlotSaveDisabled):
+		api.Error(c, types.ErrConflict, err.Error())
+	case errors.Is(err, model.ErrInvalidSlotFile):
+		api.BadRequest(c, err.Error())
+	case errors.Is(err, model.ErrSavedSlotNotFound):
+		api.NotFound(c, "槽位存档")
+	default:
+		api.ErrorWithDetails(c, types.ErrInternalError, "槽位操作失败", err.Error())
+	}
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/api"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/pki"
+)
+
+// listenerCommonName 内置 CA 为监听端口签发的证书名称
+const listenerCommonName = "Shepherd"
+
+// listenerTLS builds the TLS config shared by all listeners, or returns nil
+// when server.tls is off. A configured certificate file takes precedence;
+// otherwise the master serves a certificate from the cluster CA, a client
+// serves its node certificate and a standalone node uses a local CA.
+func (s *Server) listenerTLS() (*tls.Config, error) {
+	if s.config.ServerCfg == nil || !s.config.ServerCfg.Server.TLS.Enabled {
+		return nil, nil
+	}
+	tlsCfg := s.config.ServerCfg.Server.TLS
+
+	var cert *tls.Certificate
+	if tlsCfg.CertFile != "" {
+		loaded, err := tls.LoadX509KeyPair(tlsCfg.CertFile, tlsCfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("加载 TLS 证书失败: %w", err)
+		}
+		cert = &loaded
+	}
+	hosts := pki.LocalHosts(s.config.Host)
+
+	switch {
+	case s.config.Authority != nil:
+		// Master：同时校验节点出示的客户端证书
+		return s.config.Authority.ServerTLSConfig(cert, listenerCommonName, hosts), nil
+	case cert != nil:
+		return &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{*cert}}, nil
+	case s.config.Identity != nil:
+		// Client：使用 Master 签发的节点证书，加入集群前握手会失败
+		return s.config.Identity.ServerTLSConfig(), nil
+	default:
+		authority, err := pki.LoadOrCreateAuthority("", "", 0)
+		if err != nil {
+			return nil, fmt.Errorf("加载内置 CA 失败: %w", err)
+		}
+		logger.Infof("HTTPS 使用内置 CA 签发的证书，客户端需信任 %s", pki.DefaultCACert)
+		cfg := authority.ServerTLSConfig(nil, listenerCommonName, hosts)
+		cfg.ClientAuth = tls.NoClientCert
+		cfg.ClientCAs = nil
+		return cfg, nil
+	}
+}
+
+// listen 启动监听，配置了 TLS 时使用 HTTPS
+func listen(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		return srv.ListenAndServeTLS("", "")
+	}
+	return srv.ListenAndServe()
+}
+
+// requireNodeCert rejects node protocol calls without a client certificate
+// from the cluster CA, or whose node ID in the path or body differs from the
+// one the certificate was issued to
+func requireNodeCert(c *gin.Context) bool {
+	certID, ok := pki.PeerNodeID(c.Request)
+	if !ok {
+		logger.Warnf("拒绝没有节点证书的请求: %s %s, 来源 %s", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+		api.Unauthorized(c, "node client certificate required")
+		c.Abort()
+		return false
+	}
+	for _, id := range claimedNodeIDs(c) {
+		if id != certID {
+			logger.Warnf("拒绝节点 %s 以节点 %s 的身份发起请求: %s", certID, id, c.Request.URL.Path)
+			api.Forbidden(c, "certificate was issued to node "+certID)
+			c.Abort()
+			return false
+		}
+	}
+	return true
+}
+
+// claimedNodeIDs 返回请求路径和请求体中声明的节点 ID
+func claimedNodeIDs(c *gin.Context) []string {
+	var ids []string
+	if id := c.Param("id"); id != "" {
+		ids = append(ids, id)
+	}
+	if c.Request.Body == nil || c.Request.Method == http.MethodGet {
+		return ids
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	c.Request.Body.Close()
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ids
+	}
+
+	// 注册、心跳和结果上报分别使用 id、nodeId、node_id / fromNodeId
+	var fields struct {
+		ID         string `json:"id"`
+		NodeID     string `json:"nodeId"`
+		NodeIDAlt  string `json:"node_id"`
+		FromNodeID string `json:"fromNodeId"`
+	}
+	if json.Unmarshal(body, &fields) != nil {
+		return ids
+	}
+	for _, id := range []string{fields.ID, fields.NodeID, fields.NodeIDAlt, fields.FromNodeID} {
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/pki"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireNodeCert(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	authority, err := pki.LoadOrCreateAuthority(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"), 0)
+	require.NoError(t, err)
+	cert, err := authority.Issue("node-a", nil)
+	require.NoError(t, err)
+
+	router := gin.New()
+	nodes := router.Group("/api/master/nodes", func(c *gin.Context) {
+		if requireNodeCert(c) {
+			c.Next()
+		}
+	})
+	nodes.POST("/register", func(c *gin.Context) { c.Status(http.StatusOK) })
+	nodes.POST("/:id/heartbeat", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name         string
+		path         string
+		body         string
+		withCert     bool
+		expectedCode int
+	}{
+		{"No certificate", "/api/master/nodes/register", `{"id":"node-a"}`, false, http.StatusUnauthorized},
+		{"Own registration", "/api/master/nodes/register", `{"id":"node-a"}`, true, http.StatusOK},
+		{"Other node registration", "/api/master/nodes/register", `{"id":"node-b"}`, true, http.StatusForbidden},
+		{"Own heartbeat", "/api/master/nodes/node-a/heartbeat", `{"nodeId":"node-a"}`, true, http.StatusOK},
+		{"Other node heartbeat path", "/api/master/nodes/node-b/heartbeat", `{}`, true, http.StatusForbidden},
+		{"Other node heartbeat body", "/api/master/nodes/node-a/heartbeat", `{"nodeId":"node-b"}`, true, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			if tt.withCert {
+				req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert.Leaf}}}
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.expectedCode, w.Code, w.Body.String())
+		})
+	}
+}
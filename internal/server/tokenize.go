@@ -0,0 +1,105 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	api "github.com/shepherd-project/shepherd/Shepherd/internal/api"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tokenizer"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/types"
+)
+
+// handleTokenize 将文本转换为 token。模型已加载时由 llama-server 分词，否则按 GGUF 词表分词
+func (s *Server) handleTokenize(c *gin.Context) {
+	modelID, ok := s.tokenizeModel(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Content    string `json:"content"`
+		AddSpecial bool   `json:"addSpecial"`
+		WithPieces bool   `json:"withPieces"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "无效的请求: "+err.Error())
+		return
+	}
+
+	result, err := s.modelMgr.Tokenize(c.Request.Context(), modelID, req.Content, req.AddSpecial, req.WithPieces)
+	if err != nil {
+		tokenizeError(c, err)
+		return
+	}
+	api.Success(c, result)
+}
+
+// handleDetokenize 将 token 转换回文本
+func (s *Server) handleDetokenize(c *gin.Context) {
+	modelID, ok := s.tokenizeModel(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Tokens []int `json:"tokens" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "无效的请求: "+err.Error())
+		return
+	}
+
+	result, err := s.modelMgr.Detokenize(c.Request.Context(), modelID, req.Tokens)
+	if err != nil {
+		tokenizeError(c, err)
+		return
+	}
+	api.Success(c, result)
+}
+
+// handleCountTokens 统计 OpenAI 格式对话套用聊天模板后的提示词 token 数
+func (s *Server) handleCountTokens(c *gin.Context) {
+	modelID, ok := s.tokenizeModel(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Messages []map[string]interface{} `json:"messages" binding:"required"`
+		Tools    []map[string]interface{} `json:"tools"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		api.BadRequest(c, "无效的请求: "+err.Error())
+		return
+	}
+
+	result, err := s.modelMgr.CountTokens(c.Request.Context(), modelID, req.Messages, req.Tools)
+	if err != nil {
+		tokenizeError(c, err)
+		return
+	}
+	api.Success(c, result)
+}
+
+// tokenizeModel 按 ID、别名或名称解析路径中的模型
+func (s *Server) tokenizeModel(c *gin.Context) (string, bool) {
+	m, exists := s.modelMgr.ResolveModel(c.Param("id"))
+	if !exists {
+		api.NotFound(c, "模型")
+		return "", false
+	}
+	return m.ID, true
+}
+
+// tokenizeError 将分词错误映射为 API 错误
+func tokenizeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, model.ErrModelNotFound):
+		api.NotFound(c, "模型")
+	case errors.Is(err, tokenizer.ErrUnsupported), errors.Is(err, model.ErrInvalidToken):
+		api.BadRequest(c, err.Error())
+	default:
+		api.ErrorWithDetails(c, types.ErrInternalError, "分词失败", err.Error())
+	}
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
+)
+
+// TraceIDHeader returns the trace ID of a traced request to the caller
+const TraceIDHeader = "X-Trace-ID"
+
+// untracedRoutes 不记录 span 的接口：指标抓取、事件流和节点的周期性轮询
+var untracedRoutes = map[string]bool{
+	"GET /metrics":                         true,
+	"GET /api/events":                      true,
+	"GET /ws":                              true,
+	"POST /api/nodes/:id/heartbeat":        true,
+	"GET /api/nodes/:id/commands":          true,
+	"POST /api/heartbeat":                  true,
+	"POST /api/master/nodes/:id/heartbeat": true,
+	"GET /api/master/nodes/:id/commands":   true,
+	"POST /api/master/heartbeat":           true,
+}
+
+// tracingMiddleware 为每个请求记录 server span，沿用请求头中的 traceparent，
+// 覆盖从接收请求到响应（含流式响应）结束的全部时间
+func tracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if !tracing.Enabled() || !tracedRoute(c.Request.Method, route) {
+			c.Next()
+			return
+		}
+
+		ctx := tracing.Extract(c.Request.Context(), c.Request.Header)
+		ctx, span := tracing.StartWithKind(ctx, tracing.KindServer, c.Request.Method+" "+route,
+			tracing.String("http.request.method", c.Request.Method),
+			tracing.String("http.route", route),
+			tracing.String("url.path", c.Request.URL.Path),
+			tracing.String("client.address", c.ClientIP()),
+			tracing.String("user_agent.original", c.Request.UserAgent()),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		if traceID := span.TraceID(); traceID != "" {
+			c.Header(TraceIDHeader, traceID)
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(tracing.Int("http.response.status_code", status))
+		if requestID := c.GetString("requestId"); requestID != "" {
+			span.SetAttributes(tracing.String("shepherd.request_id", requestID))
+		}
+		if status >= http.StatusInternalServerError {
+			message := http.StatusText(status)
+			if len(c.Errors) > 0 {
+				message = fmt.Sprintf("%s: %s", message, c.Errors.Last().Error())
+			}
+			span.SetError(message)
+		}
+	}
+}
+
+// tracedRoute 判断请求是否记录 span，未匹配的路由和 Web UI 静态文件不记录
+func tracedRoute(method, route string) bool {
+	if route == "" || route == "/" || route == "/favicon.svg" || strings.HasPrefix(route, "/assets/") {
+		return false
+	}
+	return !untracedRoutes[method+" "+route]
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTracingMiddleware(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer collector.Close()
+
+	server := createTestServer(t)
+	router := server.GetEngine()
+
+	// 未启用追踪时不返回 trace ID
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/models", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(TraceIDHeader))
+
+	tracing.Init(config.TracingConfig{Enabled: true, Endpoint: collector.URL, SampleRatio: 1})
+	defer tracing.Shutdown(context.Background())
+
+	// 沿用调用方的 trace
+	req := httptest.NewRequest("GET", "/v1/models", nil)
+	req.Header.Set(tracing.TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", w.Header().Get(TraceIDHeader))
+
+	// 无上游 trace 时开始新 trace
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/v1/models", nil))
+	assert.Len(t, w.Header().Get(TraceIDHeader), 32)
+
+	// 指标抓取不记录
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(TraceIDHeader))
+}
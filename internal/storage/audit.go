@@ -0,0 +1,29 @@
+package storage
+
+// defaultAuditLimit 未指定数量时每次查询返回的审计记录数
+const defaultAuditLimit = 100
+
+// auditLimit returns the page size of an audit query
+func auditLimit(query *AuditQuery) int {
+	if query.Limit <= 0 {
+		return defaultAuditLimit
+	}
+	return query.Limit
+}
+
+// matchesAuditQuery reports whether a record passes the query filters
+func matchesAuditQuery(query *AuditQuery, record *AuditRecord) bool {
+	if !query.From.IsZero() && record.CreatedAt.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && !record.CreatedAt.Before(query.To) {
+		return false
+	}
+	if query.ModelID != "" && record.ModelID != query.ModelID {
+		return false
+	}
+	if query.APIKey != "" && record.APIKey != query.APIKey {
+		return false
+	}
+	return query.NodeID == "" || record.NodeID == query.NodeID
+}
@@ -4,6 +4,7 @@ package storage
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 )
@@ -17,6 +18,19 @@ type MemoryStore struct {
 	benchmarks        map[string]*Benchmark
 	benchmarkConfigs  map[string]*BenchmarkConfig
 	modelLoadConfigs  map[string]*ModelLoadConfig // key: "nodeID:modelID"
+	usageRecords      []*UsageRecord
+	lastUsageID       int64
+	auditRecords      []*AuditRecord
+	lastAuditID       int64
+	responses         map[string]*ResponseRecord
+	apiKeys           map[string]*APIKey
+	counters          map[string]*memoryCounter
+}
+
+// memoryCounter is a rate limit counter of the memory store
+type memoryCounter struct {
+	value     int64
+	expiresAt time.Time
 }
 
 // NewMemoryStore creates a new in-memory store
@@ -28,6 +42,9 @@ func NewMemoryStore() (*MemoryStore, error) {
 		benchmarks:       make(map[string]*Benchmark),
 		benchmarkConfigs: make(map[string]*BenchmarkConfig),
 		modelLoadConfigs: make(map[string]*ModelLoadConfig),
+		responses:        make(map[string]*ResponseRecord),
+		apiKeys:          make(map[string]*APIKey),
+		counters:         make(map[string]*memoryCounter),
 	}, nil
 }
 
@@ -408,6 +425,75 @@ func (s *MemoryStore) DeleteModelLoadConfig(ctx context.Context, nodeID, modelID
 	return nil
 }
 
+// Usage operations
+
+// RecordUsage stores the token usage of a request
+func (s *MemoryStore) RecordUsage(ctx context.Context, record *UsageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	s.lastUsageID++
+	record.ID = s.lastUsageID
+
+	recordCopy := *record
+	s.usageRecords = append(s.usageRecords, &recordCopy)
+	return nil
+}
+
+// QueryUsage aggregates usage records matching the query
+func (s *MemoryStore) QueryUsage(ctx context.Context, query *UsageQuery) ([]*UsageSummary, error) {
+	if err := validateUsageQuery(query); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	byModel := hasUsageGroup(query, UsageGroupModel)
+	byKey := hasUsageGroup(query, UsageGroupAPIKey)
+	byNode := hasUsageGroup(query, UsageGroupNode)
+
+	groups := make(map[UsageSummary]*UsageSummary)
+	for _, record := range s.usageRecords {
+		if !matchesUsageQuery(query, record) {
+			continue
+		}
+
+		var key UsageSummary
+		key.Bucket = usageBucket(query.Bucket, record.CreatedAt)
+		if byModel {
+			key.ModelID = record.ModelID
+		}
+		if byKey {
+			key.APIKey = record.APIKey
+		}
+		if byNode {
+			key.NodeID = record.NodeID
+		}
+
+		summary, exists := groups[key]
+		if !exists {
+			summary = &UsageSummary{ModelID: key.ModelID, APIKey: key.APIKey, NodeID: key.NodeID, Bucket: key.Bucket}
+			groups[key] = summary
+		}
+		summary.Requests++
+		summary.PromptTokens += int64(record.PromptTokens)
+		summary.CompletionTokens += int64(record.CompletionTokens)
+		summary.TotalTokens += int64(record.TotalTokens)
+		summary.DurationMs += record.DurationMs
+	}
+
+	summaries := make([]*UsageSummary, 0, len(groups))
+	for _, summary := range groups {
+		summaries = append(summaries, summary)
+	}
+	sortUsageSummaries(summaries)
+	return summaries, nil
+}
+
 // Close closes the store (no-op for memory store)
 func (s *MemoryStore) Close() error {
 	s.mu.Lock()
@@ -419,6 +505,10 @@ func (s *MemoryStore) Close() error {
 	s.benchmarks = make(map[string]*Benchmark)
 	s.benchmarkConfigs = make(map[string]*BenchmarkConfig)
 	s.modelLoadConfigs = make(map[string]*ModelLoadConfig)
+	s.usageRecords = nil
+	s.responses = make(map[string]*ResponseRecord)
+	s.apiKeys = make(map[string]*APIKey)
+	s.counters = make(map[string]*memoryCounter)
 
 	return nil
 }
@@ -440,6 +530,258 @@ func (s *MemoryStore) Stats() map[string]interface{} {
 	}
 }
 
+// Audit operations
+
+// RecordAudit stores an audit record
+func (s *MemoryStore) RecordAudit(ctx context.Context, record *AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	s.lastAuditID++
+	record.ID = s.lastAuditID
+
+	recordCopy := *record
+	recordCopy.Events = append([]AuditEvent(nil), record.Events...)
+	s.auditRecords = append(s.auditRecords, &recordCopy)
+	return nil
+}
+
+// GetAudit retrieves an audit record by ID
+func (s *MemoryStore) GetAudit(ctx context.Context, id int64) (*AuditRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, record := range s.auditRecords {
+		if record.ID == id {
+			recordCopy := *record
+			return &recordCopy, nil
+		}
+	}
+	return nil, ErrAuditRecordNotFound
+}
+
+// QueryAudit lists audit records matching the query, newest first
+func (s *MemoryStore) QueryAudit(ctx context.Context, query *AuditQuery) ([]*AuditRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := make([]*AuditRecord, 0)
+	skipped := 0
+	for i := len(s.auditRecords) - 1; i >= 0 && len(records) < auditLimit(query); i-- {
+		record := s.auditRecords[i]
+		if !matchesAuditQuery(query, record) {
+			continue
+		}
+		if skipped < query.Offset {
+			skipped++
+			continue
+		}
+		recordCopy := *record
+		records = append(records, &recordCopy)
+	}
+	return records, nil
+}
+
+// PruneAudit deletes audit records created before the given time
+func (s *MemoryStore) PruneAudit(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.auditRecords[:0]
+	for _, record := range s.auditRecords {
+		if !record.CreatedAt.Before(before) {
+			kept = append(kept, record)
+		}
+	}
+	pruned := int64(len(s.auditRecords) - len(kept))
+	s.auditRecords = kept
+	return pruned, nil
+}
+
+// Response operations
+
+// SaveResponse stores a response, replacing one with the same ID
+func (s *MemoryStore) SaveResponse(ctx context.Context, record *ResponseRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+
+	recordCopy := *record
+	s.responses[record.ID] = &recordCopy
+	return nil
+}
+
+// GetResponse retrieves a stored response by ID
+func (s *MemoryStore) GetResponse(ctx context.Context, id string) (*ResponseRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, exists := s.responses[id]
+	if !exists {
+		return nil, ErrResponseNotFound
+	}
+	recordCopy := *record
+	return &recordCopy, nil
+}
+
+// DeleteResponse deletes a stored response
+func (s *MemoryStore) DeleteResponse(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.responses[id]; !exists {
+		return ErrResponseNotFound
+	}
+	delete(s.responses, id)
+	return nil
+}
+
+// API key operations
+
+// CreateAPIKey stores a new API key
+func (s *MemoryStore) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.apiKeys[key.ID]; exists {
+		return ErrAPIKeyExists
+	}
+
+	now := time.Now()
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = now
+	}
+	key.UpdatedAt = now
+
+	s.apiKeys[key.ID] = copyAPIKey(key)
+	return nil
+}
+
+// GetAPIKey retrieves an API key by ID
+func (s *MemoryStore) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	key, exists := s.apiKeys[id]
+	if !exists {
+		return nil, ErrAPIKeyNotFound
+	}
+	return copyAPIKey(key), nil
+}
+
+// ListAPIKeys lists all API keys, oldest first
+func (s *MemoryStore) ListAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]*APIKey, 0, len(s.apiKeys))
+	for _, key := range s.apiKeys {
+		keys = append(keys, copyAPIKey(key))
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+// UpdateAPIKey updates the name, scopes, allowed models, expiry and limits of an API key
+func (s *MemoryStore) UpdateAPIKey(ctx context.Context, key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, exists := s.apiKeys[key.ID]
+	if !exists {
+		return ErrAPIKeyNotFound
+	}
+
+	key.UpdatedAt = time.Now()
+	keyCopy := copyAPIKey(key)
+	keyCopy.Prefix = existing.Prefix
+	keyCopy.Hash = existing.Hash
+	keyCopy.CreatedAt = existing.CreatedAt
+	s.apiKeys[key.ID] = keyCopy
+	return nil
+}
+
+// DeleteAPIKey deletes an API key
+func (s *MemoryStore) DeleteAPIKey(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.apiKeys[id]; !exists {
+		return ErrAPIKeyNotFound
+	}
+	delete(s.apiKeys, id)
+	return nil
+}
+
+// copyAPIKey returns a copy of key that shares no memory with it
+func copyAPIKey(key *APIKey) *APIKey {
+	keyCopy := *key
+	keyCopy.Scopes = append([]string(nil), key.Scopes...)
+	keyCopy.AllowedModels = append([]string(nil), key.AllowedModels...)
+	keyCopy.Filters = append([]string(nil), key.Filters...)
+	if key.Limits != nil {
+		limits := *key.Limits
+		keyCopy.Limits = &limits
+	}
+	return &keyCopy
+}
+
+// Rate limit counter operations
+
+// AddCounter adds delta to a counter and returns its new value. An expired
+// counter starts again from zero.
+func (s *MemoryStore) AddCounter(ctx context.Context, key string, delta int64, expiresAt time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counter, exists := s.counters[key]
+	if !exists || !time.Now().Before(counter.expiresAt) {
+		counter = &memoryCounter{}
+		s.counters[key] = counter
+	}
+	counter.value += delta
+	counter.expiresAt = expiresAt
+	return counter.value, nil
+}
+
+// GetCounter returns the value of a counter, 0 when missing or expired
+func (s *MemoryStore) GetCounter(ctx context.Context, key string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	counter, exists := s.counters[key]
+	if !exists || !time.Now().Before(counter.expiresAt) {
+		return 0, nil
+	}
+	return counter.value, nil
+}
+
+// PruneCounters deletes counters that expired before the given time
+func (s *MemoryStore) PruneCounters(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for key, counter := range s.counters {
+		if counter.expiresAt.Before(before) {
+			delete(s.counters, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
 // generateID generates a unique ID with a prefix
 func generateID(prefix string) string {
 	return fmt.Sprintf("%s-%d", prefix, time.Now().UnixNano())
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -120,6 +121,71 @@ func (s *SQLiteStore) initSchema(config *SQLiteConfig) error {
 		UNIQUE(node_id, model_id)
 	);
 
+	CREATE TABLE IF NOT EXISTS usage_records (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		model_id TEXT NOT NULL,
+		api_key TEXT NOT NULL DEFAULT '',
+		node_id TEXT NOT NULL DEFAULT '',
+		endpoint TEXT NOT NULL DEFAULT '',
+		stream INTEGER DEFAULT 0,
+		prompt_tokens INTEGER DEFAULT 0,
+		completion_tokens INTEGER DEFAULT 0,
+		total_tokens INTEGER DEFAULT 0,
+		duration_ms INTEGER DEFAULT 0,
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS audit_records (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		request_id TEXT NOT NULL DEFAULT '',
+		model_id TEXT NOT NULL DEFAULT '',
+		api_key TEXT NOT NULL DEFAULT '',
+		node_id TEXT NOT NULL DEFAULT '',
+		method TEXT NOT NULL DEFAULT '',
+		path TEXT NOT NULL DEFAULT '',
+		status INTEGER DEFAULT 0,
+		stream INTEGER DEFAULT 0,
+		latency_ms INTEGER DEFAULT 0,
+		prompt_tokens INTEGER DEFAULT 0,
+		completion_tokens INTEGER DEFAULT 0,
+		total_tokens INTEGER DEFAULT 0,
+		request_body TEXT,
+		response_body TEXT,
+		truncated INTEGER DEFAULT 0,
+		events TEXT,
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS responses (
+		id TEXT PRIMARY KEY,
+		previous_response_id TEXT NOT NULL DEFAULT '',
+		model TEXT NOT NULL DEFAULT '',
+		api_key TEXT NOT NULL DEFAULT '',
+		messages TEXT NOT NULL,
+		response TEXT NOT NULL,
+		created_at INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL DEFAULT '',
+		prefix TEXT NOT NULL DEFAULT '',
+		key_hash TEXT NOT NULL,
+		scopes TEXT,
+		allowed_models TEXT,
+		expires_at INTEGER,
+		limits TEXT,
+		filters TEXT,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS rate_counters (
+		key TEXT PRIMARY KEY,
+		value INTEGER NOT NULL DEFAULT 0,
+		expires_at INTEGER NOT NULL
+	);
+
 	CREATE INDEX IF NOT EXISTS idx_messages_conversation ON messages(conversation_id);
 	CREATE INDEX IF NOT EXISTS idx_conversations_created ON conversations(created_at);
 	CREATE INDEX IF NOT EXISTS idx_conversations_updated ON conversations(updated_at);
@@ -127,6 +193,10 @@ func (s *SQLiteStore) initSchema(config *SQLiteConfig) error {
 	CREATE INDEX IF NOT EXISTS idx_benchmarks_status ON benchmarks(status);
 	CREATE INDEX IF NOT EXISTS idx_benchmarks_created ON benchmarks(created_at);
 	CREATE INDEX IF NOT EXISTS idx_model_load_configs_node_model ON model_load_configs(node_id, model_id);
+	CREATE INDEX IF NOT EXISTS idx_usage_records_created ON usage_records(created_at);
+	CREATE INDEX IF NOT EXISTS idx_usage_records_model ON usage_records(model_id);
+	CREATE INDEX IF NOT EXISTS idx_audit_records_created ON audit_records(created_at);
+	CREATE INDEX IF NOT EXISTS idx_audit_records_model ON audit_records(model_id);
 	`
 
 	if _, err := s.db.Exec(schema); err != nil {
@@ -897,6 +967,566 @@ func (s *SQLiteStore) DeleteModelLoadConfig(ctx context.Context, nodeID, modelID
 	return nil
 }
 
+// Usage operations
+
+// RecordUsage stores the token usage of a request
+func (s *SQLiteStore) RecordUsage(ctx context.Context, record *UsageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = timeNow()
+	}
+
+	query := `
+		INSERT INTO usage_records (model_id, api_key, node_id, endpoint, stream, prompt_tokens, completion_tokens, total_tokens, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		record.ModelID,
+		record.APIKey,
+		record.NodeID,
+		record.Endpoint,
+		record.Stream,
+		record.PromptTokens,
+		record.CompletionTokens,
+		record.TotalTokens,
+		record.DurationMs,
+		record.CreatedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record usage: %w", err)
+	}
+
+	record.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// QueryUsage aggregates usage records matching the query
+func (s *SQLiteStore) QueryUsage(ctx context.Context, query *UsageQuery) ([]*UsageSummary, error) {
+	if err := validateUsageQuery(query); err != nil {
+		return nil, err
+	}
+
+	// 未分组的维度输出空字符串，分组列固定为 bucket, model, api_key, node
+	columns := []string{"''", "''", "''", "''"}
+	if format, ok := usageBuckets[query.Bucket]; ok {
+		columns[0] = fmt.Sprintf("strftime('%s', created_at, 'unixepoch')", format.strftime)
+	}
+	if hasUsageGroup(query, UsageGroupModel) {
+		columns[1] = "model_id"
+	}
+	if hasUsageGroup(query, UsageGroupAPIKey) {
+		columns[2] = "api_key"
+	}
+	if hasUsageGroup(query, UsageGroupNode) {
+		columns[3] = "node_id"
+	}
+
+	var where []string
+	var args []interface{}
+	if !query.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, query.From.Unix())
+	}
+	if !query.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, query.To.Unix())
+	}
+	if query.ModelID != "" {
+		where = append(where, "model_id = ?")
+		args = append(args, query.ModelID)
+	}
+	if query.APIKey != "" {
+		where = append(where, "api_key = ?")
+		args = append(args, query.APIKey)
+	}
+	if query.NodeID != "" {
+		where = append(where, "node_id = ?")
+		args = append(args, query.NodeID)
+	}
+
+	sqlQuery := fmt.Sprintf(`
+		SELECT %s, %s, %s, %s,
+			COUNT(*), SUM(prompt_tokens), SUM(completion_tokens), SUM(total_tokens), SUM(duration_ms)
+		FROM usage_records`, columns[0], columns[1], columns[2], columns[3])
+	if len(where) > 0 {
+		sqlQuery += " WHERE " + strings.Join(where, " AND ")
+	}
+	sqlQuery += " GROUP BY 1, 2, 3, 4 ORDER BY 1, 2, 3, 4"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query usage: %w", err)
+	}
+	defer rows.Close()
+
+	summaries := make([]*UsageSummary, 0)
+	for rows.Next() {
+		var u UsageSummary
+		if err := rows.Scan(&u.Bucket, &u.ModelID, &u.APIKey, &u.NodeID,
+			&u.Requests, &u.PromptTokens, &u.CompletionTokens, &u.TotalTokens, &u.DurationMs); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, &u)
+	}
+
+	return summaries, rows.Err()
+}
+
+// Audit operations
+
+// auditColumns 审计记录查询的列顺序，与 scanAuditRecord 一致
+const auditColumns = `id, request_id, model_id, api_key, node_id, method, path, status, stream, latency_ms,
+	prompt_tokens, completion_tokens, total_tokens, request_body, response_body, truncated, events, created_at`
+
+// RecordAudit stores an audit record
+func (s *SQLiteStore) RecordAudit(ctx context.Context, record *AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = timeNow()
+	}
+
+	query := `
+		INSERT INTO audit_records (request_id, model_id, api_key, node_id, method, path, status, stream, latency_ms,
+			prompt_tokens, completion_tokens, total_tokens, request_body, response_body, truncated, events, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		record.RequestID,
+		record.ModelID,
+		record.APIKey,
+		record.NodeID,
+		record.Method,
+		record.Path,
+		record.Status,
+		record.Stream,
+		record.LatencyMs,
+		record.PromptTokens,
+		record.CompletionTokens,
+		record.TotalTokens,
+		record.RequestBody,
+		record.ResponseBody,
+		record.Truncated,
+		eventsJSON(record.Events),
+		record.CreatedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record audit: %w", err)
+	}
+
+	record.ID, _ = result.LastInsertId()
+	return nil
+}
+
+// GetAudit retrieves an audit record by ID
+func (s *SQLiteStore) GetAudit(ctx context.Context, id int64) (*AuditRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	row := s.db.QueryRowContext(ctx, "SELECT "+auditColumns+" FROM audit_records WHERE id = ?", id)
+	record, err := scanAuditRecord(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrAuditRecordNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get audit record: %w", err)
+	}
+	return record, nil
+}
+
+// QueryAudit lists audit records matching the query, newest first
+func (s *SQLiteStore) QueryAudit(ctx context.Context, query *AuditQuery) ([]*AuditRecord, error) {
+	var where []string
+	var args []interface{}
+	if !query.From.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, query.From.Unix())
+	}
+	if !query.To.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, query.To.Unix())
+	}
+	if query.ModelID != "" {
+		where = append(where, "model_id = ?")
+		args = append(args, query.ModelID)
+	}
+	if query.APIKey != "" {
+		where = append(where, "api_key = ?")
+		args = append(args, query.APIKey)
+	}
+	if query.NodeID != "" {
+		where = append(where, "node_id = ?")
+		args = append(args, query.NodeID)
+	}
+
+	sqlQuery := "SELECT " + auditColumns + " FROM audit_records"
+	if len(where) > 0 {
+		sqlQuery += " WHERE " + strings.Join(where, " AND ")
+	}
+	sqlQuery += " ORDER BY id DESC LIMIT ? OFFSET ?"
+	args = append(args, auditLimit(query), query.Offset)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rows, err := s.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit records: %w", err)
+	}
+	defer rows.Close()
+
+	records := make([]*AuditRecord, 0)
+	for rows.Next() {
+		record, err := scanAuditRecord(rows)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+// PruneAudit deletes audit records created before the given time
+func (s *SQLiteStore) PruneAudit(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM audit_records WHERE created_at < ?", before.Unix())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune audit records: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// scanAuditRecord reads one row selected with auditColumns
+func scanAuditRecord(row interface {
+	Scan(dest ...interface{}) error
+}) (*AuditRecord, error) {
+	var record AuditRecord
+	var requestBody, responseBody, events sql.NullString
+	var createdUnix int64
+	if err := row.Scan(&record.ID, &record.RequestID, &record.ModelID, &record.APIKey, &record.NodeID,
+		&record.Method, &record.Path, &record.Status, &record.Stream, &record.LatencyMs,
+		&record.PromptTokens, &record.CompletionTokens, &record.TotalTokens,
+		&requestBody, &responseBody, &record.Truncated, &events, &createdUnix); err != nil {
+		return nil, err
+	}
+	record.RequestBody = requestBody.String
+	record.ResponseBody = responseBody.String
+	if events.Valid {
+		json.Unmarshal([]byte(events.String), &record.Events)
+	}
+	record.CreatedAt = time.Unix(createdUnix, 0)
+	return &record, nil
+}
+
+// eventsJSON encodes the events of an audit record, NULL when there are none
+func eventsJSON(events []AuditEvent) sql.NullString {
+	if len(events) == 0 {
+		return sql.NullString{}
+	}
+	data, _ := json.Marshal(events)
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+// Response operations
+
+// SaveResponse stores a response, replacing one with the same ID
+func (s *SQLiteStore) SaveResponse(ctx context.Context, record *ResponseRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = timeNow()
+	}
+
+	query := `
+		INSERT OR REPLACE INTO responses (id, previous_response_id, model, api_key, messages, response, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := s.db.ExecContext(ctx, query,
+		record.ID,
+		record.PreviousResponseID,
+		record.Model,
+		record.APIKey,
+		record.Messages,
+		record.Response,
+		record.CreatedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save response: %w", err)
+	}
+	return nil
+}
+
+// GetResponse retrieves a stored response by ID
+func (s *SQLiteStore) GetResponse(ctx context.Context, id string) (*ResponseRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := `
+		SELECT id, previous_response_id, model, api_key, messages, response, created_at
+		FROM responses WHERE id = ?
+	`
+
+	var record ResponseRecord
+	var createdUnix int64
+	err := s.db.QueryRowContext(ctx, query, id).Scan(&record.ID, &record.PreviousResponseID, &record.Model,
+		&record.APIKey, &record.Messages, &record.Response, &createdUnix)
+	if err == sql.ErrNoRows {
+		return nil, ErrResponseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get response: %w", err)
+	}
+	record.CreatedAt = time.Unix(createdUnix, 0)
+	return &record, nil
+}
+
+// DeleteResponse deletes a stored response
+func (s *SQLiteStore) DeleteResponse(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM responses WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete response: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrResponseNotFound
+	}
+	return nil
+}
+
+// API key operations
+
+// CreateAPIKey stores a new API key
+func (s *SQLiteStore) CreateAPIKey(ctx context.Context, key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var exists int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM api_keys WHERE id = ?", key.ID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check api key: %w", err)
+	}
+	if exists > 0 {
+		return ErrAPIKeyExists
+	}
+
+	now := timeNow()
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = now
+	}
+	key.UpdatedAt = now
+
+	scopesJSON, _ := json.Marshal(key.Scopes)
+	modelsJSON, _ := json.Marshal(key.AllowedModels)
+	filtersJSON, _ := json.Marshal(key.Filters)
+
+	query := `
+		INSERT INTO api_keys (id, name, prefix, key_hash, scopes, allowed_models, expires_at, limits, filters, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	_, err := s.db.ExecContext(ctx, query,
+		key.ID, key.Name, key.Prefix, key.Hash,
+		string(scopesJSON), string(modelsJSON), timeToUnix(key.ExpiresAt), limitsJSON(key.Limits), string(filtersJSON),
+		key.CreatedAt.Unix(), key.UpdatedAt.Unix(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+	return nil
+}
+
+// GetAPIKey retrieves an API key by ID
+func (s *SQLiteStore) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := `
+		SELECT id, name, prefix, key_hash, scopes, allowed_models, expires_at, limits, filters, created_at, updated_at
+		FROM api_keys WHERE id = ?
+	`
+
+	key, err := scanAPIKey(s.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+	return key, nil
+}
+
+// ListAPIKeys lists all API keys, oldest first
+func (s *SQLiteStore) ListAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	query := `
+		SELECT id, name, prefix, key_hash, scopes, allowed_models, expires_at, limits, filters, created_at, updated_at
+		FROM api_keys ORDER BY created_at ASC, id ASC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// UpdateAPIKey updates the name, scopes, allowed models, expiry and limits of an API key
+func (s *SQLiteStore) UpdateAPIKey(ctx context.Context, key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key.UpdatedAt = timeNow()
+	scopesJSON, _ := json.Marshal(key.Scopes)
+	modelsJSON, _ := json.Marshal(key.AllowedModels)
+	filtersJSON, _ := json.Marshal(key.Filters)
+
+	query := `
+		UPDATE api_keys
+		SET name = ?, scopes = ?, allowed_models = ?, expires_at = ?, limits = ?, filters = ?, updated_at = ?
+		WHERE id = ?
+	`
+
+	result, err := s.db.ExecContext(ctx, query,
+		key.Name, string(scopesJSON), string(modelsJSON), timeToUnix(key.ExpiresAt), limitsJSON(key.Limits), string(filtersJSON),
+		key.UpdatedAt.Unix(), key.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update api key: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// DeleteAPIKey deletes an API key
+func (s *SQLiteStore) DeleteAPIKey(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM api_keys WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete api key: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// scanAPIKey scans one api_keys row
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*APIKey, error) {
+	var key APIKey
+	var scopesJSON, modelsJSON, limits, filtersJSON sql.NullString
+	var expiresAt sql.NullInt64
+	var createdUnix, updatedUnix int64
+
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.Hash,
+		&scopesJSON, &modelsJSON, &expiresAt, &limits, &filtersJSON, &createdUnix, &updatedUnix)
+	if err != nil {
+		return nil, err
+	}
+
+	json.Unmarshal([]byte(scopesJSON.String), &key.Scopes)
+	json.Unmarshal([]byte(modelsJSON.String), &key.AllowedModels)
+	json.Unmarshal([]byte(filtersJSON.String), &key.Filters)
+	if limits.Valid {
+		json.Unmarshal([]byte(limits.String), &key.Limits)
+	}
+	key.ExpiresAt = unixToTime(expiresAt)
+	key.CreatedAt = time.Unix(createdUnix, 0).UTC()
+	key.UpdatedAt = time.Unix(updatedUnix, 0).UTC()
+	return &key, nil
+}
+
+// limitsJSON encodes the rate limits of a key, NULL when unset
+func limitsJSON(limits *RateLimits) sql.NullString {
+	if limits == nil {
+		return sql.NullString{}
+	}
+	data, _ := json.Marshal(limits)
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+// Rate limit counter operations
+
+// AddCounter adds delta to a counter and returns its new value. An expired
+// counter starts again from zero.
+func (s *SQLiteStore) AddCounter(ctx context.Context, key string, delta int64, expiresAt time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := `
+		INSERT INTO rate_counters (key, value, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET
+			value = CASE WHEN rate_counters.expires_at <= ? THEN excluded.value ELSE rate_counters.value + excluded.value END,
+			expires_at = excluded.expires_at
+		RETURNING value
+	`
+
+	var value int64
+	err := s.db.QueryRowContext(ctx, query, key, delta, expiresAt.UnixMilli(), timeNow().UnixMilli()).Scan(&value)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update counter: %w", err)
+	}
+	return value, nil
+}
+
+// GetCounter returns the value of a counter, 0 when missing or expired
+func (s *SQLiteStore) GetCounter(ctx context.Context, key string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var value int64
+	err := s.db.QueryRowContext(ctx, "SELECT value FROM rate_counters WHERE key = ? AND expires_at > ?",
+		key, timeNow().UnixMilli()).Scan(&value)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get counter: %w", err)
+	}
+	return value, nil
+}
+
+// PruneCounters deletes counters that expired before the given time
+func (s *SQLiteStore) PruneCounters(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.ExecContext(ctx, "DELETE FROM rate_counters WHERE expires_at < ?", before.UnixMilli())
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune counters: %w", err)
+	}
+	return result.RowsAffected()
+}
+
 // Close closes the database connection
 func (s *SQLiteStore) Close() error {
 	s.mu.Lock()
@@ -100,6 +100,137 @@ type ModelLoadConfig struct {
 	UpdatedAt  time.Time              `json:"updatedAt" db:"updated_at"`
 }
 
+// UsageRecord represents the token usage of one proxied inference request
+type UsageRecord struct {
+	ID               int64     `json:"id" db:"id"`
+	ModelID          string    `json:"modelId" db:"model_id"`
+	APIKey           string    `json:"apiKey,omitempty" db:"api_key"` // API key fingerprint, never the key itself
+	NodeID           string    `json:"nodeId,omitempty" db:"node_id"` // Node that served the request
+	Endpoint         string    `json:"endpoint" db:"endpoint"`
+	Stream           bool      `json:"stream" db:"stream"`
+	PromptTokens     int       `json:"promptTokens" db:"prompt_tokens"`
+	CompletionTokens int       `json:"completionTokens" db:"completion_tokens"`
+	TotalTokens      int       `json:"totalTokens" db:"total_tokens"`
+	DurationMs       int64     `json:"durationMs" db:"duration_ms"` // Time the model spent on the request
+	CreatedAt        time.Time `json:"createdAt" db:"created_at"`
+}
+
+// Usage grouping dimensions
+const (
+	UsageGroupModel  = "model"
+	UsageGroupAPIKey = "api_key"
+	UsageGroupNode   = "node"
+)
+
+// Usage time buckets
+const (
+	UsageBucketHour  = "hour"
+	UsageBucketDay   = "day"
+	UsageBucketMonth = "month"
+)
+
+// UsageQuery selects and groups usage records
+type UsageQuery struct {
+	GroupBy []string  // model, api_key, node
+	Bucket  string    // hour, day, month (UTC); empty = no time grouping
+	From    time.Time // inclusive, zero = unbounded
+	To      time.Time // exclusive, zero = unbounded
+	ModelID string
+	APIKey  string
+	NodeID  string
+}
+
+// UsageSummary is one aggregated row of usage records
+type UsageSummary struct {
+	ModelID          string `json:"modelId,omitempty"`
+	APIKey           string `json:"apiKey,omitempty"`
+	NodeID           string `json:"nodeId,omitempty"`
+	Bucket           string `json:"bucket,omitempty"` // Bucket start in UTC, e.g. 2026-10-16
+	Requests         int64  `json:"requests"`
+	PromptTokens     int64  `json:"promptTokens"`
+	CompletionTokens int64  `json:"completionTokens"`
+	TotalTokens      int64  `json:"totalTokens"`
+	DurationMs       int64  `json:"durationMs"`
+}
+
+// AuditRecord is one inference request in the audit log
+type AuditRecord struct {
+	ID               int64        `json:"id" db:"id"`
+	RequestID        string       `json:"requestId" db:"request_id"`
+	ModelID          string       `json:"modelId" db:"model_id"` // Resolved model, or the requested name if it was not served locally
+	APIKey           string       `json:"apiKey,omitempty" db:"api_key"`
+	NodeID           string       `json:"nodeId,omitempty" db:"node_id"`
+	Method           string       `json:"method" db:"method"`
+	Path             string       `json:"path" db:"path"`
+	Status           int          `json:"status" db:"status"`
+	Stream           bool         `json:"stream" db:"stream"`
+	LatencyMs        int64        `json:"latencyMs" db:"latency_ms"`
+	PromptTokens     int          `json:"promptTokens" db:"prompt_tokens"`
+	CompletionTokens int          `json:"completionTokens" db:"completion_tokens"`
+	TotalTokens      int          `json:"totalTokens" db:"total_tokens"`
+	RequestBody      string       `json:"requestBody,omitempty" db:"request_body"`   // Redacted, possibly truncated
+	ResponseBody     string       `json:"responseBody,omitempty" db:"response_body"` // Possibly truncated
+	Truncated        bool         `json:"truncated,omitempty" db:"truncated"`        // A body was cut to the size limit
+	Events           []AuditEvent `json:"events,omitempty" db:"events"`              // JSON; content filter actions
+	CreatedAt        time.Time    `json:"createdAt" db:"created_at"`
+}
+
+// AuditEvent is an action taken on a request while it was served, such as a
+// content filter blocking or rewriting text
+type AuditEvent struct {
+	Type   string    `json:"type"`             // filter.block, filter.rewrite, filter.error
+	Filter string    `json:"filter,omitempty"` // Name of the filter
+	Stage  string    `json:"stage,omitempty"`  // request or response
+	Detail string    `json:"detail,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// AuditQuery selects audit records, newest first
+type AuditQuery struct {
+	From    time.Time // inclusive, zero = unbounded
+	To      time.Time // exclusive, zero = unbounded
+	ModelID string
+	APIKey  string
+	NodeID  string
+	Limit   int // 0 = default 100
+	Offset  int
+}
+
+// ResponseRecord is a stored OpenAI Responses API response, kept so later
+// requests can continue the conversation with previous_response_id
+type ResponseRecord struct {
+	ID                 string    `json:"id" db:"id"`
+	PreviousResponseID string    `json:"previousResponseId,omitempty" db:"previous_response_id"`
+	Model              string    `json:"model" db:"model"`
+	APIKey             string    `json:"apiKey,omitempty" db:"api_key"` // Fingerprint of the key that created the response, empty when anonymous
+	Messages           string    `json:"messages" db:"messages"`        // JSON chat messages up to and including this response, without instructions
+	Response           string    `json:"response" db:"response"`        // JSON response object as returned to the client
+	CreatedAt          time.Time `json:"createdAt" db:"created_at"`
+}
+
+// APIKey is a key allowed to call the server. Only the SHA-256 hash of the
+// secret is stored.
+type APIKey struct {
+	ID            string      `json:"id" db:"id"` // Fingerprint of the key, the api_key of usage and audit records
+	Name          string      `json:"name" db:"name"`
+	Prefix        string      `json:"prefix" db:"prefix"` // Start of the key, shown to tell keys apart
+	Hash          string      `json:"-" db:"key_hash"`
+	Scopes        []string    `json:"scopes" db:"scopes"`                          // JSON array: inference, read, admin
+	AllowedModels []string    `json:"allowedModels,omitempty" db:"allowed_models"` // JSON array; empty = all models
+	ExpiresAt     *time.Time  `json:"expiresAt,omitempty" db:"expires_at"`
+	Limits        *RateLimits `json:"limits,omitempty" db:"limits"`   // JSON; nil = gateway defaults
+	Filters       []string    `json:"filters,omitempty" db:"filters"` // JSON array of gateway filter names
+	CreatedAt     time.Time   `json:"createdAt" db:"created_at"`
+	UpdatedAt     time.Time   `json:"updatedAt" db:"updated_at"`
+}
+
+// RateLimits are the request limits of an API key. Zero means unlimited.
+type RateLimits struct {
+	RequestsPerMinute  int   `json:"requestsPerMinute,omitempty"`
+	ConcurrentRequests int   `json:"concurrentRequests,omitempty"`
+	TokensPerDay       int64 `json:"tokensPerDay,omitempty"`
+}
+
 // Store defines the storage interface
 type Store interface {
 	// Conversation operations
@@ -133,6 +264,34 @@ type Store interface {
 	GetModelLoadConfig(ctx context.Context, nodeID, modelID string) (*ModelLoadConfig, error)
 	DeleteModelLoadConfig(ctx context.Context, nodeID, modelID string) error
 
+	// Usage operations
+	RecordUsage(ctx context.Context, record *UsageRecord) error
+	QueryUsage(ctx context.Context, query *UsageQuery) ([]*UsageSummary, error)
+
+	// Audit operations
+	RecordAudit(ctx context.Context, record *AuditRecord) error
+	GetAudit(ctx context.Context, id int64) (*AuditRecord, error)
+	QueryAudit(ctx context.Context, query *AuditQuery) ([]*AuditRecord, error)
+	PruneAudit(ctx context.Context, before time.Time) (int64, error)
+
+	// Response operations
+	SaveResponse(ctx context.Context, record *ResponseRecord) error
+	GetResponse(ctx context.Context, id string) (*ResponseRecord, error)
+	DeleteResponse(ctx context.Context, id string) error
+
+	// API key operations
+	CreateAPIKey(ctx context.Context, key *APIKey) error
+	GetAPIKey(ctx context.Context, id string) (*APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]*APIKey, error)
+	UpdateAPIKey(ctx context.Context, key *APIKey) error
+	DeleteAPIKey(ctx context.Context, id string) error
+
+	// Rate limit counter operations. Counters are keyed by limit and time
+	// window; expired counters read as 0.
+	AddCounter(ctx context.Context, key string, delta int64, expiresAt time.Time) (int64, error)
+	GetCounter(ctx context.Context, key string) (int64, error)
+	PruneCounters(ctx context.Context, before time.Time) (int64, error)
+
 	// Cleanup
 	Close() error
 }
@@ -197,6 +356,11 @@ var (
 	ErrBenchmarkNotFound     = &StorageError{Code: "NOT_FOUND", Message: "Benchmark not found"}
 	ErrBenchmarkConfigNotFound = &StorageError{Code: "NOT_FOUND", Message: "Benchmark config not found"}
 	ErrModelLoadConfigNotFound = &StorageError{Code: "NOT_FOUND", Message: "Model load config not found"}
+	ErrInvalidUsageQuery       = &StorageError{Code: "INVALID_QUERY", Message: "Invalid usage query"}
+	ErrAuditRecordNotFound     = &StorageError{Code: "NOT_FOUND", Message: "Audit record not found"}
+	ErrResponseNotFound        = &StorageError{Code: "NOT_FOUND", Message: "Response not found"}
+	ErrAPIKeyNotFound          = &StorageError{Code: "NOT_FOUND", Message: "API key not found"}
+	ErrAPIKeyExists            = &StorageError{Code: "ALREADY_EXISTS", Message: "API key already exists"}
 )
 
 // StorageError represents a storage error
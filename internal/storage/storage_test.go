@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -293,6 +294,305 @@ func TestConcurrentOperations(t *testing.T) {
 	assert.Len(t, convs, 10)
 }
 
+// TestUsageRecords tests usage recording and aggregation on both backends
+func TestUsageRecords(t *testing.T) {
+	memory, err := NewMemoryStore()
+	require.NoError(t, err)
+	defer memory.Close()
+
+	sqlite, err := NewSQLiteStore(&SQLiteConfig{Path: ":memory:"})
+	require.NoError(t, err)
+	defer sqlite.Close()
+
+	day1 := time.Date(2026, 10, 15, 9, 30, 0, 0, time.UTC)
+	day2 := time.Date(2026, 10, 16, 14, 0, 0, 0, time.UTC)
+	records := []UsageRecord{
+		{ModelID: "qwen", APIKey: "key-a", NodeID: "node-1", PromptTokens: 10, CompletionTokens: 20, TotalTokens: 30, DurationMs: 100, CreatedAt: day1},
+		{ModelID: "qwen", APIKey: "key-b", NodeID: "node-1", PromptTokens: 5, CompletionTokens: 5, TotalTokens: 10, DurationMs: 50, CreatedAt: day1},
+		{ModelID: "llama", APIKey: "key-a", NodeID: "node-2", PromptTokens: 1, CompletionTokens: 2, TotalTokens: 3, DurationMs: 10, CreatedAt: day2},
+	}
+
+	for name, store := range map[string]Store{"memory": memory, "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for i := range records {
+				record := records[i]
+				require.NoError(t, store.RecordUsage(ctx, &record))
+				assert.NotZero(t, record.ID)
+			}
+
+			// 不分组时汇总全部记录
+			summaries, err := store.QueryUsage(ctx, &UsageQuery{})
+			require.NoError(t, err)
+			require.Len(t, summaries, 1)
+			assert.Equal(t, int64(3), summaries[0].Requests)
+			assert.Equal(t, int64(43), summaries[0].TotalTokens)
+			assert.Equal(t, int64(160), summaries[0].DurationMs)
+
+			summaries, err = store.QueryUsage(ctx, &UsageQuery{GroupBy: []string{UsageGroupModel}, Bucket: UsageBucketDay})
+			require.NoError(t, err)
+			require.Len(t, summaries, 2)
+			assert.Equal(t, UsageSummary{ModelID: "qwen", Bucket: "2026-10-15", Requests: 2,
+				PromptTokens: 15, CompletionTokens: 25, TotalTokens: 40, DurationMs: 150}, *summaries[0])
+			assert.Equal(t, "llama", summaries[1].ModelID)
+			assert.Equal(t, "2026-10-16", summaries[1].Bucket)
+
+			summaries, err = store.QueryUsage(ctx, &UsageQuery{
+				GroupBy: []string{UsageGroupAPIKey, UsageGroupNode},
+				From:    day1,
+				To:      day2,
+				ModelID: "qwen",
+			})
+			require.NoError(t, err)
+			require.Len(t, summaries, 2)
+			assert.Equal(t, "key-a", summaries[0].APIKey)
+			assert.Equal(t, "node-1", summaries[0].NodeID)
+			assert.Equal(t, "key-b", summaries[1].APIKey)
+
+			_, err = store.QueryUsage(ctx, &UsageQuery{GroupBy: []string{"team"}})
+			assert.ErrorIs(t, err, ErrInvalidUsageQuery)
+			_, err = store.QueryUsage(ctx, &UsageQuery{Bucket: "week"})
+			assert.ErrorIs(t, err, ErrInvalidUsageQuery)
+		})
+	}
+}
+
+func TestAuditRecords(t *testing.T) {
+	memory, err := NewMemoryStore()
+	require.NoError(t, err)
+	defer memory.Close()
+
+	sqlite, err := NewSQLiteStore(&SQLiteConfig{Path: ":memory:"})
+	require.NoError(t, err)
+	defer sqlite.Close()
+
+	day1 := time.Date(2026, 10, 15, 9, 30, 0, 0, time.UTC)
+	day2 := time.Date(2026, 10, 16, 14, 0, 0, 0, time.UTC)
+	records := []AuditRecord{
+		{RequestID: "req-1", ModelID: "qwen", APIKey: "key-a", NodeID: "node-1", Method: "POST", Path: "/v1/chat/completions",
+			Status: 200, LatencyMs: 120, TotalTokens: 30, RequestBody: `{"model":"qwen"}`, ResponseBody: `{"choices":[]}`, CreatedAt: day1},
+		{RequestID: "req-2", ModelID: "llama", APIKey: "key-b", NodeID: "node-2", Method: "POST", Path: "/v1/messages",
+			Status: 500, Stream: true, Truncated: true, CreatedAt: day2,
+			Events: []AuditEvent{{Type: "filter.block", Filter: "guard", Stage: "response", Time: day2}}},
+		{RequestID: "req-3", ModelID: "qwen", APIKey: "key-b", NodeID: "node-1", Method: "POST", Path: "/api/chat",
+			Status: 200, CreatedAt: day2},
+	}
+
+	for name, store := range map[string]Store{"memory": memory, "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			for i := range records {
+				record := records[i]
+				require.NoError(t, store.RecordAudit(ctx, &record))
+				assert.NotZero(t, record.ID)
+				records[i].ID = record.ID
+			}
+
+			record, err := store.GetAudit(ctx, records[1].ID)
+			require.NoError(t, err)
+			assert.Equal(t, "req-2", record.RequestID)
+			assert.True(t, record.Stream)
+			assert.True(t, record.Truncated)
+			assert.True(t, record.CreatedAt.Equal(day2))
+			require.Len(t, record.Events, 1)
+			assert.Equal(t, "guard", record.Events[0].Filter)
+			assert.True(t, record.Events[0].Time.Equal(day2))
+
+			_, err = store.GetAudit(ctx, 9999)
+			assert.ErrorIs(t, err, ErrAuditRecordNotFound)
+
+			// 最新的记录在前
+			list, err := store.QueryAudit(ctx, &AuditQuery{})
+			require.NoError(t, err)
+			require.Len(t, list, 3)
+			assert.Equal(t, "req-3", list[0].RequestID)
+			assert.Equal(t, "req-1", list[2].RequestID)
+			assert.Equal(t, `{"model":"qwen"}`, list[2].RequestBody)
+			assert.Empty(t, list[2].Events)
+
+			list, err = store.QueryAudit(ctx, &AuditQuery{ModelID: "qwen", APIKey: "key-b"})
+			require.NoError(t, err)
+			require.Len(t, list, 1)
+			assert.Equal(t, "req-3", list[0].RequestID)
+
+			list, err = store.QueryAudit(ctx, &AuditQuery{From: day1, To: day2, NodeID: "node-1"})
+			require.NoError(t, err)
+			require.Len(t, list, 1)
+			assert.Equal(t, "req-1", list[0].RequestID)
+
+			list, err = store.QueryAudit(ctx, &AuditQuery{Limit: 1, Offset: 1})
+			require.NoError(t, err)
+			require.Len(t, list, 1)
+			assert.Equal(t, "req-2", list[0].RequestID)
+
+			pruned, err := store.PruneAudit(ctx, day2)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), pruned)
+			list, err = store.QueryAudit(ctx, &AuditQuery{})
+			require.NoError(t, err)
+			assert.Len(t, list, 2)
+		})
+	}
+}
+
+func TestResponseRecords(t *testing.T) {
+	memory, err := NewMemoryStore()
+	require.NoError(t, err)
+	defer memory.Close()
+
+	sqlite, err := NewSQLiteStore(&SQLiteConfig{Path: ":memory:"})
+	require.NoError(t, err)
+	defer sqlite.Close()
+
+	for name, store := range map[string]Store{"memory": memory, "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			record := &ResponseRecord{
+				ID:                 "resp_2",
+				PreviousResponseID: "resp_1",
+				Model:              "qwen",
+				APIKey:             "key-0123456789ab",
+				Messages:           `[{"role":"user","content":"Hi"},{"role":"assistant","content":"Hello"}]`,
+				Response:           `{"id":"resp_2","object":"response"}`,
+			}
+			require.NoError(t, store.SaveResponse(ctx, record))
+			assert.False(t, record.CreatedAt.IsZero())
+
+			got, err := store.GetResponse(ctx, "resp_2")
+			require.NoError(t, err)
+			assert.Equal(t, "resp_1", got.PreviousResponseID)
+			assert.Equal(t, "key-0123456789ab", got.APIKey)
+			assert.Equal(t, record.Messages, got.Messages)
+			assert.Equal(t, record.Response, got.Response)
+
+			// 相同 ID 覆盖原记录
+			record.Model = "llama"
+			require.NoError(t, store.SaveResponse(ctx, record))
+			got, err = store.GetResponse(ctx, "resp_2")
+			require.NoError(t, err)
+			assert.Equal(t, "llama", got.Model)
+
+			require.NoError(t, store.DeleteResponse(ctx, "resp_2"))
+			_, err = store.GetResponse(ctx, "resp_2")
+			assert.ErrorIs(t, err, ErrResponseNotFound)
+			assert.ErrorIs(t, store.DeleteResponse(ctx, "resp_2"), ErrResponseNotFound)
+		})
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	memory, err := NewMemoryStore()
+	require.NoError(t, err)
+	defer memory.Close()
+
+	sqlite, err := NewSQLiteStore(&SQLiteConfig{Path: ":memory:"})
+	require.NoError(t, err)
+	defer sqlite.Close()
+
+	for name, store := range map[string]Store{"memory": memory, "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+			key := &APIKey{
+				ID:            "key-000000000001",
+				Name:          "ci",
+				Prefix:        "sk-abcdef12",
+				Hash:          "hash",
+				Scopes:        []string{"inference"},
+				AllowedModels: []string{"qwen"},
+				ExpiresAt:     &expires,
+				Limits:        &RateLimits{RequestsPerMinute: 60, TokensPerDay: 100000},
+				Filters:       []string{"pii"},
+			}
+			require.NoError(t, store.CreateAPIKey(ctx, key))
+			assert.False(t, key.CreatedAt.IsZero())
+			assert.ErrorIs(t, store.CreateAPIKey(ctx, &APIKey{ID: key.ID, Hash: "other"}), ErrAPIKeyExists)
+			require.NoError(t, store.CreateAPIKey(ctx, &APIKey{ID: "key-000000000002", Hash: "hash2", Scopes: []string{"admin"}}))
+
+			got, err := store.GetAPIKey(ctx, key.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "hash", got.Hash)
+			assert.Equal(t, []string{"inference"}, got.Scopes)
+			assert.Equal(t, []string{"qwen"}, got.AllowedModels)
+			require.NotNil(t, got.ExpiresAt)
+			assert.True(t, expires.Equal(*got.ExpiresAt))
+			assert.Equal(t, &RateLimits{RequestsPerMinute: 60, TokensPerDay: 100000}, got.Limits)
+			assert.Equal(t, []string{"pii"}, got.Filters)
+
+			// 更新不会修改密钥哈希
+			require.NoError(t, store.UpdateAPIKey(ctx, &APIKey{ID: key.ID, Name: "renamed", Scopes: []string{"read"}}))
+			got, err = store.GetAPIKey(ctx, key.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "renamed", got.Name)
+			assert.Equal(t, "hash", got.Hash)
+			assert.Equal(t, []string{"read"}, got.Scopes)
+			assert.Empty(t, got.AllowedModels)
+			assert.Nil(t, got.ExpiresAt)
+			assert.Nil(t, got.Limits)
+			assert.Empty(t, got.Filters)
+
+			keys, err := store.ListAPIKeys(ctx)
+			require.NoError(t, err)
+			require.Len(t, keys, 2)
+			assert.Equal(t, key.ID, keys[0].ID)
+
+			require.NoError(t, store.DeleteAPIKey(ctx, key.ID))
+			_, err = store.GetAPIKey(ctx, key.ID)
+			assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+			assert.ErrorIs(t, store.DeleteAPIKey(ctx, key.ID), ErrAPIKeyNotFound)
+			assert.ErrorIs(t, store.UpdateAPIKey(ctx, key), ErrAPIKeyNotFound)
+		})
+	}
+}
+
+func TestCounters(t *testing.T) {
+	memory, err := NewMemoryStore()
+	require.NoError(t, err)
+	defer memory.Close()
+
+	sqlite, err := NewSQLiteStore(&SQLiteConfig{Path: ":memory:"})
+	require.NoError(t, err)
+	defer sqlite.Close()
+
+	for name, store := range map[string]Store{"memory": memory, "sqlite": sqlite} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			expires := time.Now().Add(time.Minute)
+
+			value, err := store.AddCounter(ctx, "requests:key-a", 1, expires)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), value)
+			value, err = store.AddCounter(ctx, "requests:key-a", 2, expires)
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), value)
+
+			value, err = store.GetCounter(ctx, "requests:key-a")
+			require.NoError(t, err)
+			assert.Equal(t, int64(3), value)
+			value, err = store.GetCounter(ctx, "requests:missing")
+			require.NoError(t, err)
+			assert.Zero(t, value)
+
+			// 过期的计数器从零开始
+			expired := time.Now().Add(-time.Second)
+			_, err = store.AddCounter(ctx, "tokens:key-a", 100, expired)
+			require.NoError(t, err)
+			value, err = store.GetCounter(ctx, "tokens:key-a")
+			require.NoError(t, err)
+			assert.Zero(t, value)
+			value, err = store.AddCounter(ctx, "tokens:key-a", 5, expires)
+			require.NoError(t, err)
+			assert.Equal(t, int64(5), value)
+
+			_, err = store.AddCounter(ctx, "tokens:key-b", 1, expired)
+			require.NoError(t, err)
+			deleted, err := store.PruneCounters(ctx, time.Now())
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), deleted)
+		})
+	}
+}
+
 // TestGenerateID tests ID generation
 func TestGenerateID(t *testing.T) {
 	id1 := generateID("test")
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// usageBuckets maps a time bucket to its Go time layout and SQLite strftime format.
+// Both produce the same string for the same instant in UTC.
+var usageBuckets = map[string]struct {
+	layout   string
+	strftime string
+}{
+	UsageBucketHour:  {"2006-01-02T15:00", "%Y-%m-%dT%H:00"},
+	UsageBucketDay:   {"2006-01-02", "%Y-%m-%d"},
+	UsageBucketMonth: {"2006-01", "%Y-%m"},
+}
+
+// validateUsageQuery checks grouping dimensions and bucket names
+func validateUsageQuery(query *UsageQuery) error {
+	for _, group := range query.GroupBy {
+		switch group {
+		case UsageGroupModel, UsageGroupAPIKey, UsageGroupNode:
+		default:
+			return fmt.Errorf("%w: unknown group %q", ErrInvalidUsageQuery, group)
+		}
+	}
+	if _, ok := usageBuckets[query.Bucket]; query.Bucket != "" && !ok {
+		return fmt.Errorf("%w: unknown bucket %q", ErrInvalidUsageQuery, query.Bucket)
+	}
+	return nil
+}
+
+// hasUsageGroup reports whether the query groups by a dimension
+func hasUsageGroup(query *UsageQuery, group string) bool {
+	for _, g := range query.GroupBy {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesUsageQuery reports whether a record passes the query filters
+func matchesUsageQuery(query *UsageQuery, record *UsageRecord) bool {
+	if !query.From.IsZero() && record.CreatedAt.Before(query.From) {
+		return false
+	}
+	if !query.To.IsZero() && !record.CreatedAt.Before(query.To) {
+		return false
+	}
+	if query.ModelID != "" && record.ModelID != query.ModelID {
+		return false
+	}
+	if query.APIKey != "" && record.APIKey != query.APIKey {
+		return false
+	}
+	return query.NodeID == "" || record.NodeID == query.NodeID
+}
+
+// usageBucket formats the bucket a timestamp falls in, or "" without time grouping
+func usageBucket(bucket string, t time.Time) string {
+	format, ok := usageBuckets[bucket]
+	if !ok {
+		return ""
+	}
+	return t.UTC().Format(format.layout)
+}
+
+// sortUsageSummaries orders summaries by bucket, model, API key and node
+func sortUsageSummaries(summaries []*UsageSummary) {
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.Bucket != b.Bucket {
+			return a.Bucket < b.Bucket
+		}
+		if a.ModelID != b.ModelID {
+			return a.ModelID < b.ModelID
+		}
+		if a.APIKey != b.APIKey {
+			return a.APIKey < b.APIKey
+		}
+		return a.NodeID < b.NodeID
+	})
+}
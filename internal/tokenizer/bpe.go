@@ -0,0 +1,270 @@
+package tokenizer
+
+import (
+	"container/heap"
+	"strings"
+	"unicode"
+)
+
+// pretokenizer 是 BPE 编码前将文本切分为单词的规则（对应 llama.cpp 的预分词正则）
+type pretokenizer struct {
+	llama3      bool // llama3 风格：单词可带一个前导标点，换行单独成组
+	maxDigits   int  // 连续数字每组的最大长度，0 表示不限
+	ignoreCase  bool // 缩写（'s 't ...）不区分大小写
+	ignoreMerge bool // 单词整体在词表中时不再合并（llama3 的 ignore_merges）
+}
+
+var (
+	// gpt2Pretokenizer: 's|'t|'re|'ve|'m|'ll|'d| ?\p{L}+| ?\p{N}+| ?[^\s\p{L}\p{N}]+|\s+(?!\S)|\s+
+	gpt2Pretokenizer = pretokenizer{}
+	// llama3Pretokenizer: (?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}| ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+	llama3Pretokenizer = pretokenizer{llama3: true, maxDigits: 3, ignoreCase: true, ignoreMerge: true}
+	// qwen2Pretokenizer 与 llama3 相同，但数字逐个切分
+	qwen2Pretokenizer = pretokenizer{llama3: true, maxDigits: 1, ignoreCase: true}
+)
+
+// pretokenizerFor 按 tokenizer.ggml.pre 选择预分词规则，未知规则使用 GPT-2 规则
+func pretokenizerFor(pre string) pretokenizer {
+	switch pre {
+	case "llama3", "llama-bpe", "llama-v3", "smaug-bpe", "dbrx", "falcon3", "pixtral", "tekken", "gpt-4o", "superbpe":
+		return llama3Pretokenizer
+	case "qwen2", "qwen35", "deepseek-r1-qwen", "stablelm2", "megrez", "hunyuan", "kimi-k2", "seed-coder":
+		return qwen2Pretokenizer
+	default:
+		return gpt2Pretokenizer
+	}
+}
+
+// split 将文本切分为单词
+func (p pretokenizer) split(text string) []string {
+	runes := []rune(text)
+	var words []string
+	for i := 0; i < len(runes); {
+		n := p.match(runes, i)
+		words = append(words, string(runes[i:i+n]))
+		i += n
+	}
+	return words
+}
+
+// match 返回从 i 开始匹配的单词长度（按正则中各分支的顺序尝试）
+func (p pretokenizer) match(r []rune, i int) int {
+	at := func(k int) rune {
+		if k < len(r) {
+			return r[k]
+		}
+		return -1
+	}
+	isLetter := func(k int) bool { return k < len(r) && unicode.IsLetter(r[k]) }
+	isNumber := func(k int) bool { return k < len(r) && unicode.IsNumber(r[k]) }
+	isSpace := func(k int) bool { return k < len(r) && unicode.IsSpace(r[k]) }
+	isNewline := func(k int) bool { return at(k) == '\r' || at(k) == '\n' }
+	isOther := func(k int) bool { return k < len(r) && !isSpace(k) && !isLetter(k) && !isNumber(k) }
+	run := func(k int, pred func(int) bool) int {
+		for pred(k) {
+			k++
+		}
+		return k
+	}
+
+	// 缩写
+	if at(i) == '\'' {
+		lower := func(k int) rune {
+			if p.ignoreCase {
+				return unicode.ToLower(at(k))
+			}
+			return at(k)
+		}
+		switch lower(i + 1) {
+		case 's', 't', 'm', 'd':
+			return 2
+		case 'r', 'v':
+			if lower(i+2) == 'e' {
+				return 3
+			}
+		case 'l':
+			if lower(i+2) == 'l' {
+				return 3
+			}
+		}
+	}
+
+	if p.llama3 {
+		// [^\r\n\p{L}\p{N}]?\p{L}+
+		if isLetter(i) {
+			return run(i, isLetter) - i
+		}
+		if i+1 < len(r) && !isNewline(i) && !isNumber(i) && isLetter(i+1) {
+			return run(i+1, isLetter) - i
+		}
+		// \p{N}{1,3}
+		if isNumber(i) {
+			end := run(i, isNumber)
+			if p.maxDigits > 0 && end-i > p.maxDigits {
+				end = i + p.maxDigits
+			}
+			return end - i
+		}
+		// ' ?[^\s\p{L}\p{N}]+[\r\n]*'
+		start := i
+		if at(i) == ' ' && isOther(i+1) {
+			start = i + 1
+		}
+		if isOther(start) {
+			end := run(start, isOther)
+			return run(end, isNewline) - i
+		}
+		// \s*[\r\n]+
+		end := run(i, isSpace)
+		for k := end - 1; k >= i; k-- {
+			if isNewline(k) {
+				return k + 1 - i
+			}
+		}
+	} else {
+		// ' ?\p{L}+' | ' ?\p{N}+' | ' ?[^\s\p{L}\p{N}]+'
+		start := i
+		if at(i) == ' ' && i+1 < len(r) && !isSpace(i+1) {
+			start = i + 1
+		}
+		switch {
+		case isLetter(start):
+			return run(start, isLetter) - i
+		case isNumber(start):
+			return run(start, isNumber) - i
+		case isOther(start):
+			return run(start, isOther) - i
+		}
+	}
+
+	// \s+(?!\S) | \s+：空白后跟非空白时，最后一个空白留给下一个单词
+	if isSpace(i) {
+		end := run(i, isSpace)
+		if end < len(r) && end-1 > i {
+			return end - 1 - i
+		}
+		return end - i
+	}
+	return 1
+}
+
+// bytesToUnicode 返回 GPT-2 的字节到可见字符映射，使 BPE 词表不含控制字符和空格
+func bytesToUnicode() ([256]rune, map[rune]byte) {
+	var byteRunes [256]rune
+	runeBytes := make(map[rune]byte, 256)
+	n := 0
+	for b := 0; b < 256; b++ {
+		visible := (b >= '!' && b <= '~') || (b >= 0xA1 && b <= 0xAC) || (b >= 0xAE && b <= 0xFF)
+		r := rune(b)
+		if !visible {
+			r = rune(256 + n)
+			n++
+		}
+		byteRunes[b] = r
+		runeBytes[r] = byte(b)
+	}
+	return byteRunes, runeBytes
+}
+
+// bpeSymbol 是 BPE 合并过程中的一个片段
+type bpeSymbol struct {
+	prev, next int
+	text       string
+}
+
+// bpeBigram 是一对相邻片段的候选合并
+type bpeBigram struct {
+	left, right int
+	rank        int
+	text        string
+}
+
+// bpeQueue 按合并优先级、位置从左到右排列候选合并
+type bpeQueue []bpeBigram
+
+func (q bpeQueue) Len() int { return len(q) }
+func (q bpeQueue) Less(i, j int) bool {
+	if q[i].rank != q[j].rank {
+		return q[i].rank < q[j].rank
+	}
+	return q[i].left < q[j].left
+}
+func (q bpeQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *bpeQueue) Push(x interface{}) { *q = append(*q, x.(bpeBigram)) }
+func (q *bpeQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// encodeBPE 使用字节级 BPE 切分文本：预分词后将每个单词的字节映射为可见字符，
+// 再按合并规则的优先级反复合并相邻片段
+func (t *Tokenizer) encodeBPE(text string, tokens []int) []int {
+	for _, word := range t.pre.split(text) {
+		var sb strings.Builder
+		for i := 0; i < len(word); i++ {
+			sb.WriteRune(t.byteRunes[word[i]])
+		}
+		mapped := sb.String()
+
+		if t.pre.ignoreMerge {
+			if id, exists := t.index[mapped]; exists {
+				tokens = append(tokens, id)
+				continue
+			}
+		}
+
+		runes := []rune(mapped)
+		symbols := make([]bpeSymbol, len(runes))
+		for i, r := range runes {
+			symbols[i] = bpeSymbol{prev: i - 1, next: i + 1, text: string(r)}
+		}
+		symbols[len(symbols)-1].next = -1
+
+		queue := &bpeQueue{}
+		tryAdd := func(left, right int) {
+			if left < 0 || right < 0 {
+				return
+			}
+			rank, exists := t.ranks[symbols[left].text+" "+symbols[right].text]
+			if !exists {
+				return
+			}
+			heap.Push(queue, bpeBigram{left: left, right: right, rank: rank, text: symbols[left].text + symbols[right].text})
+		}
+		for i := 1; i < len(symbols); i++ {
+			tryAdd(i-1, i)
+		}
+
+		for queue.Len() > 0 {
+			bigram := heap.Pop(queue).(bpeBigram)
+			left, right := &symbols[bigram.left], &symbols[bigram.right]
+			if left.text == "" || right.text == "" || left.text+right.text != bigram.text {
+				continue
+			}
+			left.text = bigram.text
+			right.text = ""
+			left.next = right.next
+			if right.next >= 0 {
+				symbols[right.next].prev = bigram.left
+			}
+			tryAdd(left.prev, bigram.left)
+			tryAdd(bigram.left, left.next)
+		}
+
+		for i := 0; i >= 0; i = symbols[i].next {
+			if id, exists := t.index[symbols[i].text]; exists {
+				tokens = append(tokens, id)
+				continue
+			}
+			// 合并结果不在词表中时逐字符查找
+			for _, r := range symbols[i].text {
+				if id, exists := t.index[string(r)]; exists {
+					tokens = append(tokens, id)
+				}
+			}
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,112 @@
+package tokenizer
+
+import (
+	"container/heap"
+	"strings"
+	"unicode/utf8"
+)
+
+// spaceMarker 是 SentencePiece 表示空格的字符 "▁"
+const spaceMarker = "▁"
+
+// spmSymbol 是合并过程中的一个片段，n == 0 表示已被合并到左侧片段
+type spmSymbol struct {
+	prev, next int
+	start, n   int
+}
+
+// spmBigram 是一对相邻片段合并后的候选 token
+type spmBigram struct {
+	left, right int
+	score       float32
+	size        int
+}
+
+// spmQueue 按分数从高到低、位置从左到右排列候选合并
+type spmQueue []spmBigram
+
+func (q spmQueue) Len() int { return len(q) }
+func (q spmQueue) Less(i, j int) bool {
+	if q[i].score != q[j].score {
+		return q[i].score > q[j].score
+	}
+	return q[i].left < q[j].left
+}
+func (q spmQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *spmQueue) Push(x interface{}) { *q = append(*q, x.(spmBigram)) }
+func (q *spmQueue) Pop() interface{} {
+	old := *q
+	item := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return item
+}
+
+// encodeSPM 使用 SentencePiece 算法切分文本：从单个字符开始，反复合并词表中
+// 分数最高的相邻片段；无法合并的字符回退为 <0xXX> 字节 token
+func (t *Tokenizer) encodeSPM(text string, tokens []int) []int {
+	text = strings.ReplaceAll(text, " ", spaceMarker)
+	if text == "" {
+		return tokens
+	}
+
+	symbols := make([]spmSymbol, 0, len(text))
+	for offset := 0; offset < len(text); {
+		_, size := utf8.DecodeRuneInString(text[offset:])
+		symbols = append(symbols, spmSymbol{prev: len(symbols) - 1, next: len(symbols) + 1, start: offset, n: size})
+		offset += size
+	}
+	symbols[len(symbols)-1].next = -1
+
+	queue := &spmQueue{}
+	tryAdd := func(left, right int) {
+		if left < 0 || right < 0 {
+			return
+		}
+		piece := text[symbols[left].start : symbols[right].start+symbols[right].n]
+		id, exists := t.index[piece]
+		if !exists {
+			return
+		}
+		var score float32
+		if id < len(t.vocab.Scores) {
+			score = t.vocab.Scores[id]
+		}
+		heap.Push(queue, spmBigram{left: left, right: right, score: score, size: len(piece)})
+	}
+	for i := 1; i < len(symbols); i++ {
+		tryAdd(i-1, i)
+	}
+
+	for queue.Len() > 0 {
+		bigram := heap.Pop(queue).(spmBigram)
+		left, right := &symbols[bigram.left], &symbols[bigram.right]
+		// 其中一个片段已参与其他合并，候选失效
+		if left.n == 0 || right.n == 0 || left.n+right.n != bigram.size {
+			continue
+		}
+		left.n += right.n
+		right.n = 0
+		left.next = right.next
+		if right.next >= 0 {
+			symbols[right.next].prev = bigram.left
+		}
+		tryAdd(left.prev, bigram.left)
+		tryAdd(bigram.left, left.next)
+	}
+
+	for i := 0; i >= 0; i = symbols[i].next {
+		piece := text[symbols[i].start : symbols[i].start+symbols[i].n]
+		if id, exists := t.index[piece]; exists {
+			tokens = append(tokens, id)
+			continue
+		}
+		for j := 0; j < len(piece); j++ {
+			if id := t.byteTokens[piece[j]]; id >= 0 {
+				tokens = append(tokens, id)
+			} else if t.vocab.UnknownTokenID >= 0 {
+				tokens = append(tokens, t.vocab.UnknownTokenID)
+			}
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,126 @@
+package tokenizer
+
+import "strings"
+
+// Built-in chat template formats, detected from the Jinja template like
+// llama.cpp does when it cannot run the template itself
+const (
+	TemplateChatML   = "chatml"
+	TemplateLlama3   = "llama3"
+	TemplateDeepSeek = "deepseek3"
+	TemplateGemma    = "gemma"
+	TemplatePhi3     = "phi3"
+	TemplateMistral  = "mistral"
+)
+
+// Message is a chat message flattened to text
+type Message struct {
+	Role    string
+	Content string
+}
+
+// DetectTemplate returns the built-in format matching a Jinja chat template.
+// Unknown or empty templates use ChatML, the llama.cpp default.
+func DetectTemplate(chatTemplate string) string {
+	contains := strings.Contains
+	switch {
+	case contains(chatTemplate, "<|im_start|>"):
+		return TemplateChatML
+	case contains(chatTemplate, "<|start_header_id|>") && contains(chatTemplate, "<|end_header_id|>"):
+		return TemplateLlama3
+	case contains(chatTemplate, "<｜Assistant｜>") && contains(chatTemplate, "<｜User｜>"):
+		return TemplateDeepSeek
+	case contains(chatTemplate, "<start_of_turn>"):
+		return TemplateGemma
+	case contains(chatTemplate, "<|assistant|>") && contains(chatTemplate, "<|end|>"):
+		return TemplatePhi3
+	case contains(chatTemplate, "[INST]"):
+		return TemplateMistral
+	default:
+		return TemplateChatML
+	}
+}
+
+// ApplyTemplate formats messages with a built-in template. The result does
+// not include the BOS token, which is added when the prompt is tokenized.
+func ApplyTemplate(name string, messages []Message, addGenerationPrompt bool) string {
+	var sb strings.Builder
+	switch name {
+	case TemplateLlama3:
+		for _, msg := range messages {
+			sb.WriteString("<|start_header_id|>" + msg.Role + "<|end_header_id|>\n\n" + strings.TrimSpace(msg.Content) + "<|eot_id|>")
+		}
+		if addGenerationPrompt {
+			sb.WriteString("<|start_header_id|>assistant<|end_header_id|>\n\n")
+		}
+
+	case TemplateDeepSeek:
+		for _, msg := range messages {
+			switch msg.Role {
+			case "system":
+				sb.WriteString(msg.Content)
+			case "assistant":
+				sb.WriteString("<｜Assistant｜>" + msg.Content + "<｜end▁of▁sentence｜>")
+			default:
+				sb.WriteString("<｜User｜>" + msg.Content)
+			}
+		}
+		if addGenerationPrompt {
+			sb.WriteString("<｜Assistant｜>")
+		}
+
+	case TemplateGemma:
+		// Gemma 没有 system 角色，系统提示词并入第一条用户消息
+		system := ""
+		for _, msg := range messages {
+			if msg.Role == "system" {
+				system += msg.Content + "\n\n"
+				continue
+			}
+			role := "user"
+			if msg.Role == "assistant" {
+				role = "model"
+			}
+			content := strings.TrimSpace(msg.Content)
+			if role == "user" && system != "" {
+				content = system + content
+				system = ""
+			}
+			sb.WriteString("<start_of_turn>" + role + "\n" + content + "<end_of_turn>\n")
+		}
+		if addGenerationPrompt {
+			sb.WriteString("<start_of_turn>model\n")
+		}
+
+	case TemplatePhi3:
+		for _, msg := range messages {
+			sb.WriteString("<|" + msg.Role + "|>\n" + msg.Content + "<|end|>\n")
+		}
+		if addGenerationPrompt {
+			sb.WriteString("<|assistant|>\n")
+		}
+
+	case TemplateMistral:
+		system := ""
+		for _, msg := range messages {
+			switch msg.Role {
+			case "system":
+				system += msg.Content + "\n\n"
+			case "assistant":
+				sb.WriteString(" " + strings.TrimSpace(msg.Content) + "</s>")
+			default:
+				sb.WriteString("[INST] " + system + strings.TrimSpace(msg.Content) + " [/INST]")
+				system = ""
+			}
+		}
+
+	default:
+		for _, msg := range messages {
+			sb.WriteString("<|im_start|>" + msg.Role + "\n" + msg.Content + "<|im_end|>\n")
+		}
+		if addGenerationPrompt {
+			sb.WriteString("<|im_start|>assistant\n")
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,233 @@
+// Package tokenizer implements llama.cpp compatible tokenization from the
+// vocabulary stored in GGUF files, so that tokens can be counted for models
+// that are not loaded.
+package tokenizer
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/gguf"
+)
+
+// ErrUnsupported is returned for tokenizer types other than SentencePiece
+// (llama) and byte-level BPE (gpt2)
+var ErrUnsupported = errors.New("unsupported tokenizer")
+
+// 支持的 tokenizer.ggml.model
+const (
+	modelSPM = "llama"
+	modelBPE = "gpt2"
+)
+
+// Tokenizer encodes and decodes text with a GGUF vocabulary
+type Tokenizer struct {
+	vocab *gguf.Vocabulary
+	index map[string]int // token 文本 -> ID
+
+	// 按首字节索引的特殊 token（control / user-defined），同一首字节内按长度降序
+	special map[byte][]int
+
+	// SentencePiece
+	byteTokens [256]int // <0xXX> 字节回退 token，-1 表示不存在
+
+	// BPE
+	ranks     map[string]int // "a b" -> 合并优先级
+	pre       pretokenizer
+	byteRunes [256]rune // 字节 -> 可见字符（GPT-2 bytes_to_unicode）
+	runeBytes map[rune]byte
+}
+
+// New builds a tokenizer from a GGUF vocabulary
+func New(vocab *gguf.Vocabulary) (*Tokenizer, error) {
+	if vocab.Model != modelSPM && vocab.Model != modelBPE {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupported, vocab.Model)
+	}
+	if len(vocab.Tokens) == 0 {
+		return nil, fmt.Errorf("empty vocabulary")
+	}
+
+	t := &Tokenizer{
+		vocab:   vocab,
+		index:   make(map[string]int, len(vocab.Tokens)),
+		special: make(map[byte][]int),
+	}
+	for id, text := range vocab.Tokens {
+		// 重复的 token 文本以第一个为准，与 llama.cpp 一致
+		if _, exists := t.index[text]; !exists {
+			t.index[text] = id
+		}
+		if text != "" && (t.tokenType(id) == gguf.TokenTypeControl || t.tokenType(id) == gguf.TokenTypeUserDefined) {
+			t.special[text[0]] = append(t.special[text[0]], id)
+		}
+	}
+	for first := range t.special {
+		ids := t.special[first]
+		sort.SliceStable(ids, func(i, j int) bool { return len(vocab.Tokens[ids[i]]) > len(vocab.Tokens[ids[j]]) })
+	}
+
+	switch vocab.Model {
+	case modelSPM:
+		for b := 0; b < 256; b++ {
+			t.byteTokens[b] = -1
+			if id, exists := t.index[fmt.Sprintf("<0x%02X>", b)]; exists {
+				t.byteTokens[b] = id
+			}
+		}
+	case modelBPE:
+		t.ranks = make(map[string]int, len(vocab.Merges))
+		for rank, merge := range vocab.Merges {
+			if _, exists := t.ranks[merge]; !exists {
+				t.ranks[merge] = rank
+			}
+		}
+		t.pre = pretokenizerFor(vocab.Pre)
+		t.byteRunes, t.runeBytes = bytesToUnicode()
+	}
+	return t, nil
+}
+
+// Load reads the vocabulary of a GGUF file and builds a tokenizer
+func Load(path string) (*Tokenizer, error) {
+	vocab, err := gguf.ReadVocabulary(path)
+	if err != nil {
+		return nil, err
+	}
+	return New(vocab)
+}
+
+// ChatTemplate returns the Jinja chat template stored in the GGUF file
+func (t *Tokenizer) ChatTemplate() string {
+	return t.vocab.ChatTemplate
+}
+
+// VocabSize returns the number of tokens in the vocabulary
+func (t *Tokenizer) VocabSize() int {
+	return len(t.vocab.Tokens)
+}
+
+// Encode tokenizes text like llama-server /tokenize. addSpecial adds the
+// BOS/EOS tokens the model is configured with; special token text such as
+// "<|im_start|>" is always parsed as the special token.
+func (t *Tokenizer) Encode(text string, addSpecial bool) []int {
+	var tokens []int
+	if addSpecial && t.vocab.AddBOS && t.vocab.BosTokenID >= 0 {
+		tokens = append(tokens, t.vocab.BosTokenID)
+	}
+
+	prevSpecial := true // SentencePiece 在开头和特殊 token 之后的文本前加空格
+	for _, fragment := range t.partition(text) {
+		if fragment.token >= 0 {
+			tokens = append(tokens, fragment.token)
+			prevSpecial = true
+			continue
+		}
+		switch t.vocab.Model {
+		case modelSPM:
+			raw := fragment.text
+			if t.vocab.AddSpacePrefix && prevSpecial {
+				raw = " " + raw
+			}
+			tokens = t.encodeSPM(raw, tokens)
+		case modelBPE:
+			tokens = t.encodeBPE(fragment.text, tokens)
+		}
+		prevSpecial = false
+	}
+
+	if addSpecial && t.vocab.AddEOS && t.vocab.EosTokenID >= 0 {
+		tokens = append(tokens, t.vocab.EosTokenID)
+	}
+	return tokens
+}
+
+// Decode converts tokens back to text like llama-server /detokenize. Special
+// tokens are rendered as their text; unknown IDs are skipped.
+func (t *Tokenizer) Decode(tokens []int) string {
+	var sb strings.Builder
+	for _, id := range tokens {
+		sb.WriteString(t.Piece(id))
+	}
+	return sb.String()
+}
+
+// Piece returns the text of a single token. A piece may be an incomplete
+// UTF-8 sequence when a character spans several byte tokens.
+func (t *Tokenizer) Piece(id int) string {
+	if id < 0 || id >= len(t.vocab.Tokens) {
+		return ""
+	}
+	text := t.vocab.Tokens[id]
+	switch t.tokenType(id) {
+	case gguf.TokenTypeControl, gguf.TokenTypeUserDefined, gguf.TokenTypeUnknown:
+		return text
+	case gguf.TokenTypeUnused:
+		return ""
+	}
+
+	switch t.vocab.Model {
+	case modelSPM:
+		if t.tokenType(id) == gguf.TokenTypeByte {
+			var b byte
+			if _, err := fmt.Sscanf(text, "<0x%02X>", &b); err == nil {
+				return string([]byte{b})
+			}
+		}
+		return strings.ReplaceAll(text, spaceMarker, " ")
+	default:
+		buf := make([]byte, 0, len(text))
+		for _, r := range text {
+			if b, ok := t.runeBytes[r]; ok {
+				buf = append(buf, b)
+			} else {
+				buf = append(buf, string(r)...)
+			}
+		}
+		return string(buf)
+	}
+}
+
+// tokenType 返回 token 类型，未提供类型数组时视为普通 token
+func (t *Tokenizer) tokenType(id int) int32 {
+	if id < len(t.vocab.Types) {
+		return t.vocab.Types[id]
+	}
+	return gguf.TokenTypeNormal
+}
+
+// fragment 是按特殊 token 切分后的文本片段，token >= 0 表示特殊 token
+type fragment struct {
+	text  string
+	token int
+}
+
+// partition 将文本中的特殊 token 切分出来，同一位置优先匹配最长的特殊 token
+func (t *Tokenizer) partition(text string) []fragment {
+	var fragments []fragment
+	start := 0
+	for i := 0; i < len(text); {
+		matched := -1
+		for _, id := range t.special[text[i]] {
+			if strings.HasPrefix(text[i:], t.vocab.Tokens[id]) {
+				matched = id
+				break
+			}
+		}
+		if matched < 0 {
+			i++
+			continue
+		}
+		if start < i {
+			fragments = append(fragments, fragment{text: text[start:i], token: -1})
+		}
+		fragments = append(fragments, fragment{token: matched})
+		i += len(t.vocab.Tokens[matched])
+		start = i
+	}
+	if start < len(text) {
+		fragments = append(fragments, fragment{text: text[start:], token: -1})
+	}
+	return fragments
+}
@@ -0,0 +1,125 @@
+package tokenizer
+
+import (
+	"testing"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/gguf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestVocabulary 由 token 列表构建词表，按 token 长度计分使较长的片段优先合并
+func newTestVocabulary(model string, tokens []string, types map[string]int32) *gguf.Vocabulary {
+	vocab := &gguf.Vocabulary{Model: model, Tokens: tokens, BosTokenID: -1, EosTokenID: -1, UnknownTokenID: -1}
+	vocab.Types = make([]int32, len(tokens))
+	vocab.Scores = make([]float32, len(tokens))
+	for id, text := range tokens {
+		vocab.Types[id] = gguf.TokenTypeNormal
+		if tokenType, exists := types[text]; exists {
+			vocab.Types[id] = tokenType
+		}
+		vocab.Scores[id] = float32(len(text))
+	}
+	return vocab
+}
+
+func newSPMTokenizer(t *testing.T) *Tokenizer {
+	tokens := []string{"<unk>", "<s>", "</s>", "<0x0A>", "<0x21>", "<|im_start|>",
+		"▁", "H", "e", "l", "o", "w", "r", "d", "▁H", "ll", "▁He", "llo", "▁Hello", "▁w", "or", "▁wor", "ld", "▁world"}
+	vocab := newTestVocabulary("llama", tokens, map[string]int32{
+		"<unk>": gguf.TokenTypeUnknown, "<s>": gguf.TokenTypeControl, "</s>": gguf.TokenTypeControl,
+		"<0x0A>": gguf.TokenTypeByte, "<0x21>": gguf.TokenTypeByte, "<|im_start|>": gguf.TokenTypeControl,
+	})
+	vocab.BosTokenID, vocab.EosTokenID, vocab.UnknownTokenID = 1, 2, 0
+	vocab.AddBOS, vocab.AddSpacePrefix = true, true
+
+	tok, err := New(vocab)
+	require.NoError(t, err)
+	return tok
+}
+
+func newBPETokenizer(t *testing.T, pre string) *Tokenizer {
+	tokens := []string{"<|endoftext|>", "<|im_start|>", "H", "e", "l", "o", "Ġ", "w", "r", "d", "!", "Ċ",
+		"He", "ll", "llo", "Hello", "Ġw", "or", "Ġwor", "ld", "Ġworld", "ĊĊ", "1", "2", "3", "12", "123", "Ġ1"}
+	vocab := newTestVocabulary("gpt2", tokens, map[string]int32{
+		"<|endoftext|>": gguf.TokenTypeControl, "<|im_start|>": gguf.TokenTypeControl,
+	})
+	vocab.Pre = pre
+	vocab.Merges = []string{"H e", "l l", "ll o", "He llo", "Ġ w", "o r", "Ġw or", "l d", "Ġwor ld", "Ċ Ċ", "1 2", "12 3", "Ġ 1"}
+	vocab.BosTokenID, vocab.EosTokenID = 0, 0
+
+	tok, err := New(vocab)
+	require.NoError(t, err)
+	return tok
+}
+
+func TestEncodeSPM(t *testing.T) {
+	tok := newSPMTokenizer(t)
+
+	assert.Equal(t, []int{1, 18, 23}, tok.Encode("Hello world", true))
+	assert.Equal(t, []int{18, 23}, tok.Encode("Hello world", false))
+	// 词表中没有的字符回退为字节 token
+	assert.Equal(t, []int{18, 4, 3}, tok.Encode("Hello!\n", false))
+	// 特殊 token 之后的文本同样加空格前缀
+	assert.Equal(t, []int{5, 18}, tok.Encode("<|im_start|>Hello", false))
+	assert.Empty(t, tok.Encode("", false))
+
+	assert.Equal(t, " Hello world!\n", tok.Decode([]int{18, 23, 4, 3}))
+	assert.Equal(t, "<|im_start|> Hello", tok.Decode([]int{5, 18, 999}))
+}
+
+func TestEncodeBPE(t *testing.T) {
+	tok := newBPETokenizer(t, "gpt-2")
+
+	assert.Equal(t, []int{15, 20, 10}, tok.Encode("Hello world!", true), "BPE does not add BOS by default")
+	assert.Equal(t, []int{1, 15, 21}, tok.Encode("<|im_start|>Hello\n\n", false))
+	assert.Equal(t, "<|im_start|>Hello world!\n", tok.Decode([]int{1, 15, 20, 10, 11}))
+	assert.Equal(t, " world", tok.Piece(20))
+
+	// llama3 预分词：连续换行成组，数字三个一组
+	tok = newBPETokenizer(t, "llama-bpe")
+	assert.Equal(t, []int{15, 10, 21}, tok.Encode("Hello!\n\n", false))
+	assert.Equal(t, []int{26, 25}, tok.Encode("12312", false))
+}
+
+func TestPretokenizer(t *testing.T) {
+	text := "Hello, world!\n\nI'm 12345  ok"
+	assert.Equal(t, []string{"Hello", ",", " world", "!", "\n", "\n", "I", "'m", " 12345", " ", " ok"}, gpt2Pretokenizer.split(text))
+	assert.Equal(t, []string{"Hello", ",", " world", "!\n\n", "I", "'m", " ", "123", "45", " ", " ok"}, llama3Pretokenizer.split(text))
+	assert.Equal(t, []string{"1", "2", "3"}, qwen2Pretokenizer.split("123"))
+	assert.Equal(t, []string{"I", "'M"}, llama3Pretokenizer.split("I'M"))
+	assert.Equal(t, []string{"I", "'", "M"}, gpt2Pretokenizer.split("I'M"))
+	assert.Equal(t, []string{"a", "  "}, gpt2Pretokenizer.split("a  "))
+}
+
+func TestBytesToUnicode(t *testing.T) {
+	byteRunes, runeBytes := bytesToUnicode()
+	assert.Equal(t, 'Ġ', byteRunes[' '])
+	assert.Equal(t, 'Ċ', byteRunes['\n'])
+	assert.Equal(t, 'A', byteRunes['A'])
+	assert.Len(t, runeBytes, 256)
+}
+
+func TestUnsupportedTokenizer(t *testing.T) {
+	_, err := New(&gguf.Vocabulary{Model: "bert", Tokens: []string{"[CLS]"}})
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestApplyTemplate(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "Hi"},
+	}
+
+	assert.Equal(t, TemplateChatML, DetectTemplate(""))
+	assert.Equal(t, TemplateLlama3, DetectTemplate("{{ '<|start_header_id|>' + message['role'] + '<|end_header_id|>' }}"))
+	assert.Equal(t, TemplateGemma, DetectTemplate("{{ '<start_of_turn>' + role }}"))
+
+	assert.Equal(t, "<|im_start|>system\nBe brief.<|im_end|>\n<|im_start|>user\nHi<|im_end|>\n<|im_start|>assistant\n",
+		ApplyTemplate(TemplateChatML, messages, true))
+	assert.Equal(t, "<|start_header_id|>system<|end_header_id|>\n\nBe brief.<|eot_id|><|start_header_id|>user<|end_header_id|>\n\nHi<|eot_id|>",
+		ApplyTemplate(TemplateLlama3, messages, false))
+	assert.Equal(t, "<start_of_turn>user\nBe brief.\n\nHi<end_of_turn>\n<start_of_turn>model\n",
+		ApplyTemplate(TemplateGemma, messages, true))
+	assert.Equal(t, "[INST] Be brief.\n\nHi [/INST]", ApplyTemplate(TemplateMistral, messages, true))
+}
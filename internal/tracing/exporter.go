@@ -0,0 +1,331 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+)
+
+const (
+	// DefaultEndpoint is the OTLP/HTTP traces endpoint of a local collector
+	DefaultEndpoint = "http://localhost:4318/v1/traces"
+	// DefaultServiceName is the service.name resource attribute when none is configured
+	DefaultServiceName = "shepherd"
+
+	exportInterval = 5 * time.Second  // 定期导出间隔
+	exportTimeout  = 10 * time.Second // 单次导出超时
+	maxBatchSize   = 512              // 队列达到该长度时立即导出
+	maxQueueSize   = 4096             // 队列上限，超出后丢弃新 span
+	scopeName      = "github.com/shepherd-project/shepherd/Shepherd/internal/tracing"
+)
+
+// active 当前的导出器，未启用追踪时为 nil
+var active atomic.Pointer[exporter]
+
+// current 返回当前导出器
+func current() *exporter { return active.Load() }
+
+// Enabled reports whether tracing is enabled
+func Enabled() bool { return current() != nil }
+
+// Init enables tracing with cfg. resource attributes describe this process
+// (service.name is added from cfg). It does nothing when cfg is disabled.
+func Init(cfg config.TracingConfig, resource ...Attribute) {
+	if !cfg.Enabled {
+		return
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	serviceName := cfg.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+
+	e := newExporter(endpoint, cfg.Headers, cfg.SampleRatio,
+		append([]Attribute{String("service.name", serviceName)}, resource...))
+	if old := active.Swap(e); old != nil {
+		old.shutdown(context.Background())
+	}
+	logger.Infof("链路追踪已启用，导出到 %s，采样比例 %g", endpoint, cfg.SampleRatio)
+}
+
+// Shutdown exports the queued spans and disables tracing
+func Shutdown(ctx context.Context) error {
+	e := active.Swap(nil)
+	if e == nil {
+		return nil
+	}
+	return e.shutdown(ctx)
+}
+
+// exporter 批量将结束的 span 以 OTLP/HTTP JSON 格式发送到采集器
+type exporter struct {
+	endpoint string
+	headers  map[string]string
+	resource []Attribute
+	bound    uint64 // 采样上限，见 sampleBound
+	client   *http.Client
+
+	mu      sync.Mutex
+	queue   []*Span
+	dropped int
+
+	flush chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+func newExporter(endpoint string, headers map[string]string, ratio float64, resource []Attribute) *exporter {
+	e := &exporter{
+		endpoint: endpoint,
+		headers:  headers,
+		resource: resource,
+		bound:    sampleBound(ratio),
+		client:   &http.Client{Timeout: exportTimeout},
+		flush:    make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// sample 按 trace ID 决定新 trace 是否采样
+func (e *exporter) sample(id TraceID) bool {
+	if e.bound == ^uint64(0) {
+		return true
+	}
+	return traceIDValue(id) < e.bound
+}
+
+// enqueue 加入待导出队列
+func (e *exporter) enqueue(s *Span) {
+	e.mu.Lock()
+	if len(e.queue) >= maxQueueSize {
+		e.dropped++
+		e.mu.Unlock()
+		return
+	}
+	e.queue = append(e.queue, s)
+	full := len(e.queue) >= maxBatchSize
+	e.mu.Unlock()
+
+	if full {
+		select {
+		case e.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run 定期或在队列满时导出
+func (e *exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.flush:
+		case <-e.stop:
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+		e.exportQueued(ctx)
+		cancel()
+	}
+}
+
+// shutdown 停止后台导出并发送剩余 span
+func (e *exporter) shutdown(ctx context.Context) error {
+	close(e.stop)
+	<-e.done
+	return e.exportQueued(ctx)
+}
+
+// exportQueued 分批导出队列中的全部 span
+func (e *exporter) exportQueued(ctx context.Context) error {
+	e.mu.Lock()
+	spans := e.queue
+	dropped := e.dropped
+	e.queue = nil
+	e.dropped = 0
+	e.mu.Unlock()
+
+	if dropped > 0 {
+		logger.Warnf("追踪队列已满，丢弃 %d 个 span", dropped)
+	}
+	for len(spans) > 0 {
+		n := min(len(spans), maxBatchSize)
+		if err := e.export(ctx, spans[:n]); err != nil {
+			logger.Warnf("导出 %d 个 span 到 %s 失败: %v", len(spans), e.endpoint, err)
+			return err
+		}
+		spans = spans[n:]
+	}
+	return nil
+}
+
+// export 发送一批 span
+func (e *exporter) export(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(e.payload(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// OTLP/HTTP JSON 编码，字段名和枚举值与 opentelemetry-proto 一致
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+// payload 构造导出请求
+func (e *exporter) payload(spans []*Span) otlpRequest {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		encoded = append(encoded, s.encode())
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: encodeAttributes(e.resource)},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: scopeName},
+			Spans: encoded,
+		}},
+	}}}
+}
+
+// encode 转换为 OTLP span
+func (s *Span) encode() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	span := otlpSpan{
+		TraceID:           s.sc.TraceID.String(),
+		SpanID:            s.sc.SpanID.String(),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: unixNano(s.start),
+		EndTimeUnixNano:   unixNano(s.end),
+		Attributes:        encodeAttributes(s.attrs),
+		Status:            otlpStatus{Code: s.statusCode, Message: s.statusMessage},
+	}
+	if s.parent.IsValid() {
+		span.ParentSpanID = s.parent.String()
+	}
+	for _, ev := range s.events {
+		span.Events = append(span.Events, otlpEvent{
+			TimeUnixNano: unixNano(ev.time),
+			Name:         ev.name,
+			Attributes:   encodeAttributes(ev.attrs),
+		})
+	}
+	return span
+}
+
+// encodeAttributes 转换为 OTLP AnyValue，整数按规范编码为字符串
+func encodeAttributes(attrs []Attribute) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	out := make([]otlpKeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		var value map[string]interface{}
+		switch v := a.Value.(type) {
+		case string:
+			value = map[string]interface{}{"stringValue": v}
+		case int64:
+			value = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]interface{}{"doubleValue": v}
+		case bool:
+			value = map[string]interface{}{"boolValue": v}
+		default:
+			value = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, otlpKeyValue{Key: a.Key, Value: value})
+	}
+	return out
+}
+
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
@@ -0,0 +1,201 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// collector 模拟 OTLP/HTTP 采集器，记录收到的 span
+type collector struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	spans    []map[string]interface{}
+	resource []interface{}
+	headers  http.Header
+}
+
+func newCollector(t *testing.T) *collector {
+	c := &collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ResourceSpans []struct {
+				Resource struct {
+					Attributes []interface{} `json:"attributes"`
+				} `json:"resource"`
+				ScopeSpans []struct {
+					Spans []map[string]interface{} `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.headers = r.Header.Clone()
+		for _, rs := range req.ResourceSpans {
+			c.resource = rs.Resource.Attributes
+			for _, ss := range rs.ScopeSpans {
+				c.spans = append(c.spans, ss.Spans...)
+			}
+		}
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+// span 按名称查找收到的 span
+func (c *collector) span(name string) map[string]interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.spans {
+		if s["name"] == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// attribute 取 span 属性的 OTLP 值
+func attribute(span map[string]interface{}, key string) map[string]interface{} {
+	attrs, _ := span["attributes"].([]interface{})
+	for _, a := range attrs {
+		kv := a.(map[string]interface{})
+		if kv["key"] == key {
+			return kv["value"].(map[string]interface{})
+		}
+	}
+	return nil
+}
+
+func initTracing(t *testing.T, c *collector, ratio float64) {
+	Init(config.TracingConfig{
+		Enabled:     true,
+		Endpoint:    c.URL + "/v1/traces",
+		ServiceName: "shepherd-test",
+		SampleRatio: ratio,
+		Headers:     map[string]string{"Authorization": "Bearer collector-token"},
+	}, String("shepherd.role", "master"))
+	t.Cleanup(func() { Shutdown(context.Background()) })
+}
+
+func TestDisabled(t *testing.T) {
+	require.False(t, Enabled())
+
+	ctx, span := Start(context.Background(), "noop")
+	assert.Nil(t, span)
+	assert.Equal(t, context.Background(), ctx)
+	span.SetAttributes(String("k", "v"))
+	span.RecordError(errors.New("boom"))
+	span.End()
+	assert.Empty(t, span.TraceID())
+}
+
+func TestExportSpans(t *testing.T) {
+	c := newCollector(t)
+	initTracing(t, c, 1)
+
+	ctx, root := StartWithKind(context.Background(), KindServer, "POST /v1/chat/completions", String("http.route", "/v1/chat/completions"))
+	_, child := Start(ctx, "model.queue_wait", Int("queued", 2))
+	child.AddEvent("granted")
+	child.RecordError(errors.New("queue timeout"))
+	child.End()
+	root.End()
+	root.End() // 重复结束不重复导出
+
+	require.NoError(t, Shutdown(context.Background()))
+	assert.False(t, Enabled())
+
+	c.mu.Lock()
+	require.Len(t, c.spans, 2)
+	assert.Equal(t, "Bearer collector-token", c.headers.Get("Authorization"))
+	assert.Contains(t, c.resource, map[string]interface{}{"key": "service.name", "value": map[string]interface{}{"stringValue": "shepherd-test"}})
+	assert.Contains(t, c.resource, map[string]interface{}{"key": "shepherd.role", "value": map[string]interface{}{"stringValue": "master"}})
+	c.mu.Unlock()
+
+	server := c.span("POST /v1/chat/completions")
+	queue := c.span("model.queue_wait")
+	require.NotNil(t, server)
+	require.NotNil(t, queue)
+
+	assert.Equal(t, root.TraceID(), server["traceId"])
+	assert.Equal(t, server["traceId"], queue["traceId"])
+	assert.Equal(t, server["spanId"], queue["parentSpanId"])
+	assert.Nil(t, server["parentSpanId"])
+	assert.Equal(t, float64(KindServer), server["kind"])
+	assert.Equal(t, float64(KindInternal), queue["kind"])
+	assert.Equal(t, map[string]interface{}{"stringValue": "/v1/chat/completions"}, attribute(server, "http.route"))
+	assert.Equal(t, map[string]interface{}{"intValue": "2"}, attribute(queue, "queued"))
+	assert.Equal(t, map[string]interface{}{"code": float64(statusError), "message": "queue timeout"}, queue["status"])
+	assert.Len(t, queue["events"], 2)
+}
+
+func TestSampling(t *testing.T) {
+	c := newCollector(t)
+	initTracing(t, c, 0)
+
+	// 新 trace 不采样，但仍向下游传播不采样的决定
+	ctx, span := Start(context.Background(), "dropped")
+	require.NotNil(t, span)
+	assert.False(t, span.SpanContext().Sampled)
+	assert.Regexp(t, `^00-[0-9a-f]{32}-[0-9a-f]{16}-00$`, TraceParent(ctx))
+	span.End()
+
+	// 上游已采样的 trace 沿用其决定
+	ctx = ContextWithTraceParent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, kept := Start(ctx, "kept")
+	kept.End()
+
+	require.NoError(t, Shutdown(context.Background()))
+	assert.Nil(t, c.span("dropped"))
+	remote := c.span("kept")
+	require.NotNil(t, remote)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", remote["traceId"])
+	assert.Equal(t, "00f067aa0ba902b7", remote["parentSpanId"])
+}
+
+func TestTransport(t *testing.T) {
+	c := newCollector(t)
+	initTracing(t, c, 1)
+
+	var received string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(TraceParentHeader)
+		w.Write([]byte("data: hello\n\n"))
+	}))
+	defer upstream.Close()
+
+	ctx, parent := Start(context.Background(), "request")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, upstream.URL+"/v1/chat/completions", nil)
+	require.NoError(t, err)
+	client := &http.Client{Transport: NewTransport(nil, "llama-server")}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	resp.Body.Close()
+	parent.End()
+	assert.Equal(t, "data: hello\n\n", string(body))
+
+	require.NoError(t, Shutdown(context.Background()))
+	span := c.span("llama-server POST /v1/chat/completions")
+	require.NotNil(t, span)
+	assert.Equal(t, "00-"+parent.TraceID()+"-"+span["spanId"].(string)+"-01", received)
+	assert.Equal(t, float64(KindClient), span["kind"])
+	assert.Equal(t, map[string]interface{}{"intValue": "200"}, attribute(span, "http.response.status_code"))
+	assert.NotNil(t, attribute(span, "ttft_ms"))
+	require.Len(t, span["events"], 1)
+	assert.Equal(t, "first_byte", span["events"].([]interface{})[0].(map[string]interface{})["name"])
+}
@@ -0,0 +1,86 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TraceParentHeader is the W3C trace context header
+const TraceParentHeader = "traceparent"
+
+// TraceParent returns the traceparent value for the span in ctx, or "" when
+// there is none
+func TraceParent(ctx context.Context) string {
+	return FormatTraceParent(SpanContextFromContext(ctx))
+}
+
+// FormatTraceParent formats sc as a version 00 traceparent value
+func FormatTraceParent(sc SpanContext) string {
+	if !sc.IsValid() {
+		return ""
+	}
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceParent parses a traceparent value
+func ParseTraceParent(value string) (SpanContext, bool) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, false
+	}
+	// 版本 00 恰好四段，更高版本允许追加字段
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, false
+	}
+	if !decodeHex(parts[1], sc.TraceID[:]) || !decodeHex(parts[2], sc.SpanID[:]) {
+		return sc, false
+	}
+	var flags [1]byte
+	if !decodeHex(parts[3], flags[:]) {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&0x01 == 1
+	return sc, sc.IsValid()
+}
+
+// ContextWithTraceParent continues the trace described by a traceparent
+// value. Invalid or empty values return ctx unchanged.
+func ContextWithTraceParent(ctx context.Context, value string) context.Context {
+	if value == "" {
+		return ctx
+	}
+	sc, ok := ParseTraceParent(value)
+	if !ok {
+		return ctx
+	}
+	return ContextWithRemote(ctx, sc)
+}
+
+// Inject sets the traceparent header from the span in ctx
+func Inject(ctx context.Context, header http.Header) {
+	if value := TraceParent(ctx); value != "" {
+		header.Set(TraceParentHeader, value)
+	}
+}
+
+// Extract continues the trace carried in the traceparent header, if any
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return ContextWithTraceParent(ctx, header.Get(TraceParentHeader))
+}
+
+// decodeHex 解码定长小写十六进制字符串
+func decodeHex(s string, dst []byte) bool {
+	if len(s) != hex.EncodedLen(len(dst)) || strings.ToLower(s) != s {
+		return false
+	}
+	_, err := hex.Decode(dst, []byte(s))
+	return err == nil
+}
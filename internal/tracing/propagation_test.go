@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTraceParentRoundTrip(t *testing.T) {
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceParent(value)
+	require.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, value, FormatTraceParent(sc))
+
+	sc.Sampled = false
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", FormatTraceParent(sc))
+}
+
+func TestParseTraceParentInvalid(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01", // 全零 trace ID
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", // 全零 span ID
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", // 大写
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", // 无效版本
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		_, ok := ParseTraceParent(value)
+		assert.False(t, ok, value)
+	}
+
+	// 更高版本允许追加字段
+	_, ok := ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	assert.True(t, ok)
+}
+
+func TestInjectExtract(t *testing.T) {
+	header := http.Header{}
+	Inject(context.Background(), header)
+	assert.Empty(t, header.Get(TraceParentHeader), "no span, nothing to inject")
+
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	header.Set(TraceParentHeader, value)
+	ctx := Extract(context.Background(), header)
+	assert.Equal(t, value, TraceParent(ctx))
+
+	out := http.Header{}
+	Inject(ctx, out)
+	assert.Equal(t, value, out.Get(TraceParentHeader))
+}
@@ -0,0 +1,278 @@
+// Package tracing records request traces and exports them over OTLP/HTTP.
+// Trace context is propagated with the W3C traceparent format, both in HTTP
+// headers and inside cluster commands, so that a gateway request, the
+// upstream llama-server call and the commands it triggers on other nodes
+// form a single trace. When tracing is disabled every span is nil and all
+// span methods are no-ops.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// String returns the lowercase hex form
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+// IsValid reports whether the ID is non-zero
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// String returns the lowercase hex form
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// IsValid reports whether the ID is non-zero
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext is the part of a span that is propagated to other processes
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set
+func (sc SpanContext) IsValid() bool { return sc.TraceID.IsValid() && sc.SpanID.IsValid() }
+
+// SpanKind is the OTLP span kind
+type SpanKind int
+
+// Span kinds, numbered as in the OTLP protocol
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+	KindProducer SpanKind = 4
+	KindConsumer SpanKind = 5
+)
+
+// statusError OTLP 中表示失败的状态码
+const statusError = 2
+
+// Attribute is a span or resource attribute
+type Attribute struct {
+	Key   string
+	Value interface{} // string、int64、float64 或 bool
+}
+
+// String creates a string attribute
+func String(key, value string) Attribute { return Attribute{Key: key, Value: value} }
+
+// Int creates an integer attribute
+func Int(key string, value int) Attribute { return Attribute{Key: key, Value: int64(value)} }
+
+// Int64 creates an integer attribute
+func Int64(key string, value int64) Attribute { return Attribute{Key: key, Value: value} }
+
+// Float64 creates a floating point attribute
+func Float64(key string, value float64) Attribute { return Attribute{Key: key, Value: value} }
+
+// Bool creates a boolean attribute
+func Bool(key string, value bool) Attribute { return Attribute{Key: key, Value: value} }
+
+// event 是 span 内的时间点事件
+type event struct {
+	name  string
+	time  time.Time
+	attrs []Attribute
+}
+
+// Span is an operation within a trace. A nil span is valid and does nothing.
+type Span struct {
+	exporter *exporter
+	sc       SpanContext
+	parent   SpanID
+	name     string
+	kind     SpanKind
+	start    time.Time
+
+	mu            sync.Mutex
+	end           time.Time
+	attrs         []Attribute
+	events        []event
+	statusCode    int
+	statusMessage string
+	ended         bool
+}
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// Start starts an internal span as a child of the span in ctx
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	return StartWithKind(ctx, KindInternal, name, attrs...)
+}
+
+// StartWithKind starts a span of the given kind as a child of the span or
+// remote span context in ctx. It returns ctx unchanged and a nil span when
+// tracing is disabled.
+func StartWithKind(ctx context.Context, kind SpanKind, name string, attrs ...Attribute) (context.Context, *Span) {
+	e := current()
+	if e == nil {
+		return ctx, nil
+	}
+
+	parent := SpanContextFromContext(ctx)
+	span := &Span{
+		exporter: e,
+		name:     name,
+		kind:     kind,
+		start:    time.Now(),
+		attrs:    attrs,
+	}
+	if parent.IsValid() {
+		span.sc.TraceID = parent.TraceID
+		span.sc.Sampled = parent.Sampled
+		span.parent = parent.SpanID
+	} else {
+		span.sc.TraceID = newTraceID()
+		span.sc.Sampled = e.sample(span.sc.TraceID)
+	}
+	span.sc.SpanID = newSpanID()
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SpanFromContext returns the span in ctx, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// SpanContextFromContext returns the context of the span in ctx, falling back
+// to a remote span context attached with ContextWithRemote
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.sc
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+// ContextWithRemote attaches a span context received from another process,
+// so that spans started from the returned context continue its trace
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	if !sc.IsValid() {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanContext returns the propagated part of the span
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// TraceID returns the hex trace ID, or "" for a nil span
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.sc.TraceID.String()
+}
+
+// SetAttributes adds attributes to the span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil || !s.sc.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// AddEvent records a point in time within the span
+func (s *Span) AddEvent(name string, attrs ...Attribute) {
+	if s == nil || !s.sc.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event{name: name, time: time.Now(), attrs: attrs})
+}
+
+// SetError marks the span as failed
+func (s *Span) SetError(message string) {
+	if s == nil || !s.sc.Sampled {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statusCode = statusError
+	s.statusMessage = message
+}
+
+// RecordError marks the span as failed with err and records it as an
+// exception event. A nil err is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.AddEvent("exception", String("exception.message", err.Error()))
+	s.SetError(err.Error())
+}
+
+// End finishes the span and queues it for export. Calls after the first are
+// ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	if s.sc.Sampled {
+		s.exporter.enqueue(s)
+	}
+}
+
+// newTraceID 生成随机 trace ID
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// newSpanID 生成随机 span ID
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		rand.Read(id[:])
+	}
+	return id
+}
+
+// sampleBound 将采样比例转换为 trace ID 低 8 字节的上限
+func sampleBound(ratio float64) uint64 {
+	switch {
+	case ratio >= 1:
+		return ^uint64(0)
+	case ratio <= 0:
+		return 0
+	}
+	return uint64(ratio * float64(^uint64(0)))
+}
+
+// traceIDValue 取 trace ID 低 8 字节，用于按比例采样
+func traceIDValue(id TraceID) uint64 {
+	return binary.BigEndian.Uint64(id[8:])
+}
@@ -0,0 +1,101 @@
+package tracing
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Transport is an http.RoundTripper that records a client span for each
+// request and propagates the trace in the traceparent header. The span ends
+// when the response body is fully read or closed, so it covers streamed
+// responses; the arrival of the first body byte is recorded as the
+// "first_byte" event and the ttft_ms attribute.
+type Transport struct {
+	Base http.RoundTripper
+	Peer string // 对端服务名，用于 span 名称和 peer.service 属性
+}
+
+// NewTransport wraps base (http.DefaultTransport when nil) with tracing
+func NewTransport(base http.RoundTripper, peer string) *Transport {
+	return &Transport{Base: base, Peer: peer}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if !Enabled() {
+		return base.RoundTrip(req)
+	}
+
+	ctx, span := StartWithKind(req.Context(), KindClient, t.Peer+" "+req.Method+" "+req.URL.Path,
+		String("http.request.method", req.Method),
+		String("url.full", req.URL.Redacted()),
+		String("server.address", req.URL.Host),
+		String("peer.service", t.Peer),
+	)
+	req = req.Clone(ctx)
+	Inject(ctx, req.Header)
+
+	start := time.Now()
+	resp, err := base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.End()
+		return nil, err
+	}
+
+	span.SetAttributes(Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode >= http.StatusInternalServerError {
+		span.SetError(http.StatusText(resp.StatusCode))
+	}
+	if resp.Body == nil || resp.Body == http.NoBody {
+		span.End()
+		return resp, nil
+	}
+	resp.Body = &tracedBody{ReadCloser: resp.Body, span: span, start: start}
+	return resp, nil
+}
+
+// tracedBody 在读到首个字节时记录 TTFT，读完或关闭时结束 span
+type tracedBody struct {
+	io.ReadCloser
+	span  *Span
+	start time.Time
+
+	once      sync.Once
+	firstByte bool
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 && !b.firstByte {
+		b.firstByte = true
+		b.span.AddEvent("first_byte")
+		b.span.SetAttributes(Int64("ttft_ms", time.Since(b.start).Milliseconds()))
+	}
+	if err == io.EOF {
+		b.finish()
+	} else if err != nil {
+		b.span.RecordError(err)
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.finish()
+	return err
+}
+
+func (b *tracedBody) finish() {
+	b.once.Do(func() {
+		b.span.SetAttributes(Int64("duration_ms", time.Since(b.start).Milliseconds()))
+		b.span.End()
+	})
+}
@@ -0,0 +1,226 @@
+// Package usage extracts token usage from llama-server responses and records
+// it per request, so GPU time can be charged back to the teams using the
+// cluster.
+package usage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/logger"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+)
+
+// recordTimeout 单条用量记录写入存储的最长时间
+const recordTimeout = 5 * time.Second
+
+// Usage is the token usage of one request
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// IsZero reports whether no tokens were counted
+func (u Usage) IsZero() bool {
+	return u.PromptTokens == 0 && u.CompletionTokens == 0 && u.TotalTokens == 0
+}
+
+// Add accumulates the usage of another upstream call, e.g. one embedding batch
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// Parse extracts token usage from a llama-server JSON response or stream
+// chunk. The OpenAI "usage" block is preferred; llama.cpp "timings" are used
+// when it is missing.
+func Parse(body []byte) (Usage, bool) {
+	var resp struct {
+		Usage   *Usage `json:"usage"`
+		Timings *struct {
+			PromptN    int `json:"prompt_n"`
+			PredictedN int `json:"predicted_n"`
+		} `json:"timings"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return Usage{}, false
+	}
+
+	var u Usage
+	switch {
+	case resp.Usage != nil && !resp.Usage.IsZero():
+		u = *resp.Usage
+	case resp.Timings != nil:
+		u = Usage{PromptTokens: resp.Timings.PromptN, CompletionTokens: resp.Timings.PredictedN}
+	default:
+		return Usage{}, false
+	}
+	if u.TotalTokens == 0 {
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	}
+	return u, !u.IsZero()
+}
+
+// ParseStreamLine extracts token usage from one SSE line ("data: {...}").
+// llama-server reports usage in the final chunk of a stream.
+func ParseStreamLine(line string) (Usage, bool) {
+	data, ok := strings.CutPrefix(strings.TrimSpace(line), "data:")
+	if !ok {
+		return Usage{}, false
+	}
+	data = strings.TrimSpace(data)
+	if data == "" || data == "[DONE]" {
+		return Usage{}, false
+	}
+	return Parse([]byte(data))
+}
+
+// KeyID returns a stable fingerprint of the API key a request was made with,
+// or "" for anonymous requests. The key itself is never stored.
+func KeyID(r *http.Request) string {
+	return Fingerprint(RequestKey(r))
+}
+
+// RequestKey returns the API key a request was made with. It accepts the
+// x-api-key header (Anthropic), a Bearer token (OpenAI), a bare
+// Authorization value and the password of Basic auth (Ollama clients that
+// put the key in the host URL).
+func RequestKey(r *http.Request) string {
+	if key := strings.TrimSpace(r.Header.Get("x-api-key")); key != "" {
+		return key
+	}
+	auth := strings.TrimSpace(r.Header.Get("Authorization"))
+	if auth == "" {
+		return ""
+	}
+	if scheme, value, ok := strings.Cut(auth, " "); ok {
+		switch strings.ToLower(scheme) {
+		case "bearer":
+			return strings.TrimSpace(value)
+		case "basic":
+			if _, password, ok := r.BasicAuth(); ok {
+				return password
+			}
+		}
+	}
+	return auth
+}
+
+// Fingerprint returns the stable ID of an API key, or "" for no key
+func Fingerprint(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "key-" + hex.EncodeToString(sum[:6])
+}
+
+// Report receives the usage of a request as it is recorded, for middleware
+// that needs the resolved model and token counts after the handler returns
+type Report struct {
+	mu      sync.Mutex
+	modelID string
+	usage   Usage
+}
+
+type reportKey struct{}
+
+// WithReport returns a context whose recorded usage is copied into report
+func WithReport(ctx context.Context, report *Report) context.Context {
+	return context.WithValue(ctx, reportKey{}, report)
+}
+
+// ReportFrom returns the report attached to ctx, if any
+func ReportFrom(ctx context.Context) (*Report, bool) {
+	report, ok := ctx.Value(reportKey{}).(*Report)
+	return report, ok
+}
+
+// Result returns the reported model ID and usage; the model ID is empty when
+// nothing was recorded
+func (r *Report) Result() (string, Usage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.modelID, r.usage
+}
+
+func (r *Report) set(modelID string, u Usage) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.modelID = modelID
+	r.usage = u
+}
+
+// Recorder stores the token usage of proxied requests. A nil *Recorder
+// discards everything, so handlers can call it unconditionally.
+type Recorder struct {
+	store    storage.Store
+	modelMgr *model.Manager
+	nodeID   string
+	mu       sync.RWMutex
+}
+
+// NewRecorder creates a recorder writing to store. modelMgr may be nil; when
+// set, model totals are updated and replica instance IDs are resolved to
+// their model.
+func NewRecorder(store storage.Store, modelMgr *model.Manager) *Recorder {
+	return &Recorder{store: store, modelMgr: modelMgr}
+}
+
+// SetNodeID sets the node ID stored with each record
+func (r *Recorder) SetNodeID(nodeID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.nodeID = nodeID
+}
+
+// Record stores the usage of a request to a model instance that started at
+// start. Requests without counted tokens are skipped.
+func (r *Recorder) Record(req *http.Request, instanceID, endpoint string, u Usage, start time.Time, stream bool) {
+	if r == nil || u.IsZero() {
+		return
+	}
+	if u.TotalTokens == 0 {
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	}
+
+	modelID := instanceID
+	if r.modelMgr != nil {
+		modelID = r.modelMgr.RecordTokens(instanceID, int64(u.TotalTokens))
+	}
+	if report, ok := ReportFrom(req.Context()); ok {
+		report.set(modelID, u)
+	}
+
+	r.mu.RLock()
+	nodeID := r.nodeID
+	r.mu.RUnlock()
+
+	record := &storage.UsageRecord{
+		ModelID:          modelID,
+		APIKey:           KeyID(req),
+		NodeID:           nodeID,
+		Endpoint:         endpoint,
+		Stream:           stream,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+		DurationMs:       time.Since(start).Milliseconds(),
+	}
+
+	// 请求上下文可能已随客户端断开而取消，使用独立的超时上下文
+	ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+	defer cancel()
+	if err := r.store.RecordUsage(ctx, record); err != nil {
+		logger.Warn("记录 token 用量失败", "modelId", modelID, "error", err)
+	}
+}
@@ -0,0 +1,155 @@
+package usage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want Usage
+		ok   bool
+	}{
+		{
+			name: "OpenAI usage",
+			body: `{"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":30,"total_tokens":42}}`,
+			want: Usage{PromptTokens: 12, CompletionTokens: 30, TotalTokens: 42},
+			ok:   true,
+		},
+		{
+			name: "Missing total",
+			body: `{"usage":{"prompt_tokens":5}}`,
+			want: Usage{PromptTokens: 5, TotalTokens: 5},
+			ok:   true,
+		},
+		{
+			name: "llama.cpp timings",
+			body: `{"timings":{"prompt_n":7,"predicted_n":3}}`,
+			want: Usage{PromptTokens: 7, CompletionTokens: 3, TotalTokens: 10},
+			ok:   true,
+		},
+		{
+			name: "No usage",
+			body: `{"choices":[]}`,
+		},
+		{
+			name: "Invalid JSON",
+			body: `not json`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Parse([]byte(tt.body))
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestParseStreamLine(t *testing.T) {
+	_, ok := ParseStreamLine(`data: {"choices":[{"delta":{"content":"Hi"}}]}` + "\n")
+	assert.False(t, ok)
+
+	_, ok = ParseStreamLine("data: [DONE]\n")
+	assert.False(t, ok)
+
+	u, ok := ParseStreamLine(`data: {"choices":[],"usage":{"prompt_tokens":4,"completion_tokens":6,"total_tokens":10}}` + "\n")
+	require.True(t, ok)
+	assert.Equal(t, 10, u.TotalTokens)
+}
+
+func TestKeyID(t *testing.T) {
+	req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	assert.Empty(t, KeyID(req))
+
+	req.Header.Set("Authorization", "Bearer sk-team-a")
+	bearer := KeyID(req)
+	assert.Regexp(t, `^key-[0-9a-f]{12}$`, bearer)
+	assert.NotContains(t, bearer, "sk-team-a")
+
+	other := httptest.NewRequest("POST", "/v1/messages", nil)
+	other.Header.Set("x-api-key", "sk-team-a")
+	assert.Equal(t, bearer, KeyID(other), "same key must map to the same ID across APIs")
+}
+
+func TestRequestKey(t *testing.T) {
+	cases := map[string]func(r *http.Request){
+		"bearer":    func(r *http.Request) { r.Header.Set("Authorization", "Bearer sk-team-a") },
+		"x-api-key": func(r *http.Request) { r.Header.Set("x-api-key", "sk-team-a") },
+		"bare":      func(r *http.Request) { r.Header.Set("Authorization", "sk-team-a") },
+		"basic":     func(r *http.Request) { r.SetBasicAuth("ollama", "sk-team-a") },
+	}
+	for name, set := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/chat", nil)
+			set(req)
+			assert.Equal(t, "sk-team-a", RequestKey(req))
+		})
+	}
+
+	assert.Empty(t, Fingerprint(""))
+	assert.Equal(t, Fingerprint("sk-team-a"), KeyID(func() *http.Request {
+		req := httptest.NewRequest("POST", "/api/chat", nil)
+		req.SetBasicAuth("", "sk-team-a")
+		return req
+	}()))
+}
+
+func TestRecorder(t *testing.T) {
+	store, err := storage.NewMemoryStore()
+	require.NoError(t, err)
+	defer store.Close()
+
+	recorder := NewRecorder(store, nil)
+	recorder.SetNodeID("node-1")
+
+	req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	req.Header.Set("Authorization", "Bearer sk-team-a")
+	start := time.Now()
+	recorder.Record(req, "model-a", "/v1/chat/completions", Usage{PromptTokens: 10, CompletionTokens: 5}, start, false)
+	recorder.Record(req, "model-a", "/v1/chat/completions", Usage{}, start, true)
+
+	// nil 记录器不做任何事
+	var disabled *Recorder
+	disabled.Record(req, "model-a", "/v1/chat/completions", Usage{TotalTokens: 1}, start, false)
+
+	summaries, err := store.QueryUsage(context.Background(), &storage.UsageQuery{
+		GroupBy: []string{storage.UsageGroupModel, storage.UsageGroupAPIKey, storage.UsageGroupNode},
+	})
+	require.NoError(t, err)
+	require.Len(t, summaries, 1)
+	assert.Equal(t, "model-a", summaries[0].ModelID)
+	assert.Equal(t, KeyID(req), summaries[0].APIKey)
+	assert.Equal(t, "node-1", summaries[0].NodeID)
+	assert.Equal(t, int64(1), summaries[0].Requests)
+	assert.Equal(t, int64(15), summaries[0].TotalTokens)
+}
+
+func TestReport(t *testing.T) {
+	store, err := storage.NewMemoryStore()
+	require.NoError(t, err)
+	defer store.Close()
+
+	recorder := NewRecorder(store, nil)
+	report := &Report{}
+	req := httptest.NewRequest("POST", "/v1/chat/completions", nil)
+	req = req.WithContext(WithReport(req.Context(), report))
+
+	modelID, _ := report.Result()
+	assert.Empty(t, modelID)
+
+	recorder.Record(req, "model-a", "/v1/chat/completions", Usage{PromptTokens: 10, CompletionTokens: 5}, time.Now(), false)
+	modelID, u := report.Result()
+	assert.Equal(t, "model-a", modelID)
+	assert.Equal(t, Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}, u)
+}
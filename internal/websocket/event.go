@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
+
+	"github.com/shepherd-project/shepherd/Shepherd/internal/model"
 )
 
 // EventType represents the type of WebSocket event
@@ -55,6 +57,8 @@ type Event struct {
 	LoadedModels       int `json:"loadedModels,omitempty"`
 	Connections        int `json:"connections,omitempty"`
 	ConfirmedConnections int `json:"confirmedConnections,omitempty"`
+	Models             []model.IdleInfo `json:"models,omitempty"` // 已加载模型的空闲卸载状态
+	Queues             []model.QueueStats `json:"queues,omitempty"` // 各模型的请求排队状态
 }
 
 // NewEvent creates a new event with current timestamp
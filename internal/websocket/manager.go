@@ -155,7 +155,10 @@ func (m *Manager) systemStatusLoop() {
 
 			if count > 0 && m.modelMgr != nil {
 				loadedModels := m.modelMgr.GetLoadedModelCount()
-				m.Broadcast(NewSystemStatusEvent(loadedModels, count, confirmedCount))
+				event := NewSystemStatusEvent(loadedModels, count, confirmedCount)
+				event.Models = m.modelMgr.ListIdleInfo()
+				event.Queues = m.modelMgr.ListQueueStats()
+				m.Broadcast(event)
 				logger.Debugf("发送系统状态: 已加载模型=%d, 连接=%d, 已确认=%d",
 					loadedModels, count, confirmedCount)
 			}